@@ -0,0 +1,468 @@
+package kafka
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/promremotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	kafkaclient "github.com/VictoriaMetrics/VictoriaMetrics/lib/kafka"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite/stream"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	topics = flagutil.NewArrayString("kafka.consumer.topic", "Kafka topic names for data consumption. Messages in the topic must contain data blocks "+
+		"in Prometheus or VictoriaMetrics remote write format, which are written by vmagent with -remoteWrite.url=kafka://... . "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#reading-metrics-from-kafka")
+	topicBrokers = flagutil.NewArrayString("kafka.consumer.topic.brokers", "List of brokers to connect for the corresponding -kafka.consumer.topic, "+
+		"e.g. -kafka.consumer.topic.brokers='host-1:9092;host-2:9092' . See https://docs.victoriametrics.com/victoriametrics/vmagent/#reading-metrics-from-kafka")
+	topicGroupIDs = flagutil.NewArrayString("kafka.consumer.topic.groupID", "Consumer group id for the corresponding -kafka.consumer.topic. "+
+		"Partitions of the topic are split among vmagent instances with the same group id, and offsets of the processed messages are committed to Kafka for this group id. "+
+		"Default value is vmagent. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#reading-metrics-from-kafka")
+	topicSecurityProtocols = flagutil.NewArrayString("kafka.consumer.topic.securityProtocol", "Protocol for connecting to Kafka brokers of the corresponding -kafka.consumer.topic. "+
+		"Supported values: PLAINTEXT, SSL, SASL_PLAINTEXT, SASL_SSL. Default value is PLAINTEXT. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#reading-metrics-from-kafka")
+	topicTLSCAFiles = flagutil.NewArrayString("kafka.consumer.topic.tlsCAFile", "Optional path to TLS CA file to use for verifying connections to Kafka brokers "+
+		"of the corresponding -kafka.consumer.topic. By default, system CA is used")
+	topicTLSCertFiles = flagutil.NewArrayString("kafka.consumer.topic.tlsCertFile", "Optional path to client-side TLS certificate file to use when connecting "+
+		"to Kafka brokers of the corresponding -kafka.consumer.topic")
+	topicTLSKeyFiles = flagutil.NewArrayString("kafka.consumer.topic.tlsKeyFile", "Optional path to client-side TLS certificate key to use when connecting "+
+		"to Kafka brokers of the corresponding -kafka.consumer.topic")
+	topicTLSServerNames = flagutil.NewArrayString("kafka.consumer.topic.tlsServerName", "Optional TLS server name to use for connections to Kafka brokers "+
+		"of the corresponding -kafka.consumer.topic. By default, the server name from -kafka.consumer.topic.brokers is used")
+	topicTLSInsecureSkipVerify = flagutil.NewArrayBool("kafka.consumer.topic.tlsInsecureSkipVerify", "Whether to skip tls verification when connecting "+
+		"to Kafka brokers of the corresponding -kafka.consumer.topic")
+	topicSASLUsernames = flagutil.NewArrayString("kafka.consumer.topic.sasl.username", "SASL PLAIN username for the corresponding -kafka.consumer.topic. "+
+		"It is used if -kafka.consumer.topic.securityProtocol is set to SASL_PLAINTEXT or SASL_SSL")
+	topicSASLPasswords = flagutil.NewArrayString("kafka.consumer.topic.sasl.password", "SASL PLAIN password for the corresponding -kafka.consumer.topic. "+
+		"It is used if -kafka.consumer.topic.securityProtocol is set to SASL_PLAINTEXT or SASL_SSL")
+	topicSASLPasswordFiles = flagutil.NewArrayString("kafka.consumer.topic.sasl.passwordFile", "Optional path to SASL PLAIN password for the corresponding -kafka.consumer.topic. "+
+		"It is used instead of -kafka.consumer.topic.sasl.password if set")
+	maxFetchBytes = flagutil.NewBytes("kafka.consumer.maxFetchBytes", 16*1024*1024, "The maximum size of data to fetch from a single Kafka partition per request. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#reading-metrics-from-kafka")
+)
+
+var (
+	messagesRead      = metrics.NewCounter(`vmagent_kafka_consumer_messages_read_total`)
+	messagesInvalid   = metrics.NewCounter(`vmagent_kafka_consumer_messages_invalid_total`)
+	fetchErrors       = metrics.NewCounter(`vmagent_kafka_consumer_errors_total{action="fetch"}`)
+	commitErrors      = metrics.NewCounter(`vmagent_kafka_consumer_errors_total{action="commit"}`)
+	groupErrors       = metrics.NewCounter(`vmagent_kafka_consumer_errors_total{action="group"}`)
+	pushRetries       = metrics.NewCounter(`vmagent_kafka_consumer_push_retries_total`)
+	offsetOutOfRanges = metrics.NewCounter(`vmagent_kafka_consumer_offset_out_of_range_total`)
+)
+
+const (
+	// fetchMaxWait is the maximum duration to wait for new messages in Kafka partition.
+	fetchMaxWait = time.Second
+
+	// retryInterval is the interval between retries on errors.
+	retryInterval = 5 * time.Second
+
+	// partitionsRefreshInterval is the interval for checking for new partitions in the consumed topics by the consumer group leader.
+	partitionsRefreshInterval = time.Minute
+
+	// sessionTimeout is the duration after which the consumer group coordinator re-assigns partitions of vmagent,
+	// which doesn't send heartbeats, to other group members.
+	sessionTimeout = 30 * time.Second
+
+	// rebalanceTimeout is the maximum duration for the group members to stop consuming partitions and re-join the group on rebalance.
+	rebalanceTimeout = time.Minute
+
+	// heartbeatInterval is the interval between heartbeats sent to the consumer group coordinator.
+	heartbeatInterval = 3 * time.Second
+
+	defaultGroupID = "vmagent"
+)
+
+var (
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+)
+
+// Init starts consuming messages from Kafka topics specified via -kafka.consumer.topic.
+//
+// Consumed messages are pushed to remote storage via remotewrite.TryPush, so remotewrite.Init must be called before Init.
+//
+// MustStop must be called when consuming is no longer needed.
+func Init() {
+	if len(*topics) == 0 {
+		return
+	}
+	stopCh = make(chan struct{})
+	for i, topic := range *topics {
+		brokersStr := topicBrokers.GetOptionalArg(i)
+		if brokersStr == "" {
+			logger.Fatalf("missing -kafka.consumer.topic.brokers for -kafka.consumer.topic=%q", topic)
+		}
+		groupID := topicGroupIDs.GetOptionalArg(i)
+		if groupID == "" {
+			groupID = defaultGroupID
+		}
+		opts, err := getClientOptions(i)
+		if err != nil {
+			logger.Fatalf("cannot initialize Kafka client for -kafka.consumer.topic=%q: %s", topic, err)
+		}
+		tc := &topicConsumer{
+			topic:   topic,
+			brokers: strings.Split(brokersStr, ";"),
+			groupID: groupID,
+			opts:    opts,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tc.run()
+		}()
+	}
+}
+
+// getClientOptions returns Kafka client options for the -kafka.consumer.topic at the given argIdx.
+func getClientOptions(argIdx int) (*kafkaclient.ClientOptions, error) {
+	getTLSConfig := func() (*tls.Config, error) {
+		return promauth.NewTLSConfig(topicTLSCertFiles.GetOptionalArg(argIdx), topicTLSKeyFiles.GetOptionalArg(argIdx), topicTLSCAFiles.GetOptionalArg(argIdx),
+			topicTLSServerNames.GetOptionalArg(argIdx), topicTLSInsecureSkipVerify.GetOptionalArg(argIdx))
+	}
+	password := topicSASLPasswords.GetOptionalArg(argIdx)
+	if passwordFile := topicSASLPasswordFiles.GetOptionalArg(argIdx); passwordFile != "" {
+		var err error
+		password, err = fscore.ReadPasswordFromFileOrHTTP(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read -kafka.consumer.topic.sasl.passwordFile: %w", err)
+		}
+	}
+	opts := &kafkaclient.ClientOptions{}
+	if err := opts.InitSecurity(topicSecurityProtocols.GetOptionalArg(argIdx), getTLSConfig, topicSASLUsernames.GetOptionalArg(argIdx), password); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// MustStop stops consuming messages from Kafka.
+//
+// It waits until the messages, which are being processed, are pushed to remote storage and their offsets are committed.
+func MustStop() {
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	wg.Wait()
+	stopCh = nil
+}
+
+type topicConsumer struct {
+	topic   string
+	brokers []string
+	groupID string
+	opts    *kafkaclient.ClientOptions
+
+	// memberID is the id assigned to vmagent by the consumer group coordinator. It is empty until the first join.
+	memberID string
+
+	// groupPartitions contains partitions per topic, which were assigned to group members. It is set only at the group leader.
+	groupPartitions map[string][]int32
+}
+
+func (tc *topicConsumer) run() {
+	kc := kafkaclient.NewClient(tc.brokers, tc.opts)
+	defer kc.Close()
+
+	for !isStopped(stopCh) {
+		gg, partitions, err := tc.joinGroup(kc)
+		if err != nil {
+			if errors.Is(err, kafkaclient.ErrRebalanceInProgress) {
+				// Another member joined the group in the middle of joining. Re-join immediately.
+				continue
+			}
+			groupErrors.Inc()
+			logger.Errorf("cannot join consumer group %q for -kafka.consumer.topic=%q: %s; retrying in %s", tc.groupID, tc.topic, err, retryInterval)
+			sleep(stopCh, retryInterval)
+			continue
+		}
+		tc.consumePartitions(kc, gg, partitions)
+	}
+	if tc.memberID != "" {
+		// Leave the group, so the partitions are re-assigned to other vmagent instances without waiting for session timeout.
+		gg := &kafkaclient.GroupGeneration{
+			Group:    tc.groupID,
+			MemberID: tc.memberID,
+		}
+		if err := kc.LeaveGroup(gg); err != nil {
+			logger.Warnf("cannot leave consumer group %q for -kafka.consumer.topic=%q: %s", tc.groupID, tc.topic, err)
+		}
+	}
+	logger.Infof("stopped consuming -kafka.consumer.topic=%q", tc.topic)
+}
+
+// joinGroup joins the consumer group and returns the partitions of tc.topic assigned to vmagent.
+func (tc *topicConsumer) joinGroup(kc *kafkaclient.Client) (*kafkaclient.GroupGeneration, []int32, error) {
+	gg, err := kc.JoinGroup(tc.groupID, tc.memberID, []string{tc.topic}, sessionTimeout, rebalanceTimeout)
+	if err != nil {
+		if errors.Is(err, kafkaclient.ErrUnknownMemberID) {
+			// The coordinator has removed vmagent from the group, e.g. because of missing heartbeats. Join as a new member.
+			tc.memberID = ""
+		}
+		return nil, nil, err
+	}
+	tc.memberID = gg.MemberID
+
+	var assignments map[string]map[string][]int32
+	tc.groupPartitions = nil
+	if gg.IsLeader() {
+		partitions, err := getGroupPartitions(kc, gg.Members)
+		if err != nil {
+			return nil, nil, err
+		}
+		assignments = kafkaclient.AssignPartitions(gg.Members, partitions)
+		tc.groupPartitions = partitions
+	}
+	assignment, err := kc.SyncGroup(gg, assignments)
+	if err != nil {
+		if errors.Is(err, kafkaclient.ErrUnknownMemberID) {
+			tc.memberID = ""
+		}
+		return nil, nil, err
+	}
+	return gg, assignment[tc.topic], nil
+}
+
+// getGroupPartitions returns partitions per each topic the given group members are subscribed to.
+func getGroupPartitions(kc *kafkaclient.Client, members []kafkaclient.GroupMember) (map[string][]int32, error) {
+	partitions := make(map[string][]int32)
+	for _, m := range members {
+		for _, topic := range m.Topics {
+			if _, ok := partitions[topic]; ok {
+				continue
+			}
+			ps, err := kc.Partitions(topic)
+			if err != nil {
+				return nil, err
+			}
+			partitions[topic] = ps
+		}
+	}
+	return partitions, nil
+}
+
+// consumePartitions consumes the given partitions until the consumer group must be re-joined or until vmagent is stopped.
+func (tc *topicConsumer) consumePartitions(kc *kafkaclient.Client, gg *kafkaclient.GroupGeneration, partitions []int32) {
+	logger.Infof("started consuming %d partitions %v of -kafka.consumer.topic=%q with groupID=%q; generation: %d; group members: %d",
+		len(partitions), partitions, tc.topic, tc.groupID, gg.GenerationID, len(gg.Members))
+
+	generationStopCh := make(chan struct{})
+	var partitionsWG sync.WaitGroup
+	for _, partition := range partitions {
+		pc := &partitionConsumer{
+			topic:     tc.topic,
+			partition: partition,
+			gg:        gg,
+			kc:        kafkaclient.NewClient(tc.brokers, tc.opts),
+			offset:    -1,
+			stopCh:    generationStopCh,
+		}
+		partitionsWG.Add(1)
+		go func() {
+			defer partitionsWG.Done()
+			pc.run()
+			pc.kc.Close()
+		}()
+	}
+
+	tc.sendHeartbeats(kc, gg)
+
+	// Stop consuming the partitions before re-joining the group, since they may be assigned to another member.
+	// Offsets for the processed messages are committed by partition consumers before they stop.
+	close(generationStopCh)
+	partitionsWG.Wait()
+}
+
+// sendHeartbeats sends heartbeats to the group coordinator until the consumer group must be re-joined or until vmagent is stopped.
+func (tc *topicConsumer) sendHeartbeats(kc *kafkaclient.Client, gg *kafkaclient.GroupGeneration) {
+	lastHeartbeat := time.Now()
+	lastPartitionsCheck := time.Now()
+	for sleep(stopCh, heartbeatInterval) {
+		if err := kc.Heartbeat(gg); err != nil {
+			if errors.Is(err, kafkaclient.ErrRebalanceInProgress) {
+				logger.Infof("re-joining consumer group %q for -kafka.consumer.topic=%q, since the group is rebalancing", tc.groupID, tc.topic)
+				return
+			}
+			groupErrors.Inc()
+			if errors.Is(err, kafkaclient.ErrUnknownMemberID) || errors.Is(err, kafkaclient.ErrIllegalGeneration) {
+				logger.Warnf("re-joining consumer group %q for -kafka.consumer.topic=%q: %s", tc.groupID, tc.topic, err)
+				if errors.Is(err, kafkaclient.ErrUnknownMemberID) {
+					tc.memberID = ""
+				}
+				return
+			}
+			if time.Since(lastHeartbeat) > sessionTimeout {
+				// The coordinator has already re-assigned the partitions to other members, so stop consuming them.
+				logger.Errorf("cannot send heartbeats to consumer group %q for -kafka.consumer.topic=%q during %s: %s; re-joining the group",
+					tc.groupID, tc.topic, sessionTimeout, err)
+				return
+			}
+			logger.Errorf("cannot send heartbeat to consumer group %q for -kafka.consumer.topic=%q: %s", tc.groupID, tc.topic, err)
+			continue
+		}
+		lastHeartbeat = time.Now()
+
+		// Partitions may be added to the topics after the start. The group leader re-joins the group when this happens,
+		// so the new partitions are assigned to group members.
+		if !gg.IsLeader() || time.Since(lastPartitionsCheck) < partitionsRefreshInterval {
+			continue
+		}
+		lastPartitionsCheck = time.Now()
+		partitions, err := getGroupPartitions(kc, gg.Members)
+		if err != nil {
+			logger.Errorf("cannot obtain partitions for consumer group %q: %s", tc.groupID, err)
+			continue
+		}
+		if !reflect.DeepEqual(partitions, tc.groupPartitions) {
+			logger.Infof("re-joining consumer group %q for -kafka.consumer.topic=%q, since partitions of the consumed topics have been changed", tc.groupID, tc.topic)
+			return
+		}
+	}
+}
+
+type partitionConsumer struct {
+	topic     string
+	partition int32
+	gg        *kafkaclient.GroupGeneration
+	kc        *kafkaclient.Client
+
+	// offset is the offset of the next message to consume. It is negative if it must be obtained from Kafka.
+	offset int64
+
+	// stopCh is closed when the partition must no longer be consumed.
+	stopCh <-chan struct{}
+}
+
+func (pc *partitionConsumer) run() {
+	for !isStopped(pc.stopCh) {
+		if err := pc.consumeMessages(); err != nil {
+			fetchErrors.Inc()
+			logger.Errorf("cannot consume messages from -kafka.consumer.topic=%q partition %d: %s; retrying in %s", pc.topic, pc.partition, err, retryInterval)
+			sleep(pc.stopCh, retryInterval)
+		}
+	}
+}
+
+func (pc *partitionConsumer) consumeMessages() error {
+	if pc.offset < 0 {
+		offset, err := pc.initOffset()
+		if err != nil {
+			return err
+		}
+		pc.offset = offset
+	}
+
+	records, err := pc.kc.Fetch(pc.topic, pc.partition, pc.offset, fetchMaxWait, maxFetchBytes.IntN())
+	if err != nil {
+		if errors.Is(err, kafkaclient.ErrOffsetOutOfRange) {
+			// Messages at the committed offset were removed due to retention. Continue from the earliest available message.
+			offsetOutOfRanges.Inc()
+			offset, errList := pc.kc.ListOffset(pc.topic, pc.partition, kafkaclient.OffsetEarliest)
+			if errList != nil {
+				return errList
+			}
+			logger.Warnf("offset %d is out of range for -kafka.consumer.topic=%q partition %d; continue consuming from the earliest offset %d",
+				pc.offset, pc.topic, pc.partition, offset)
+			pc.offset = offset
+			return nil
+		}
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	for i := range records {
+		r := &records[i]
+		if !processMessage(pc.stopCh, r.Value) {
+			// The partition consumer is stopped before the message has been pushed to remote storage.
+			// Commit offsets for already processed messages, so they aren't consumed again by the next partition owner.
+			break
+		}
+		pc.offset = r.Offset + 1
+	}
+
+	// Offsets are committed after the messages are pushed to remote storage in order to guarantee at-least-once delivery.
+	if err := pc.kc.CommitOffset(pc.gg, pc.topic, pc.partition, pc.offset); err != nil {
+		commitErrors.Inc()
+		logger.Errorf("cannot commit offset %d for -kafka.consumer.topic=%q partition %d: %s; the messages may be consumed again after restart or rebalance",
+			pc.offset, pc.topic, pc.partition, err)
+	}
+	return nil
+}
+
+// initOffset returns the offset committed for the consumer group or the earliest available offset if there is no committed offset.
+func (pc *partitionConsumer) initOffset() (int64, error) {
+	offset, err := pc.kc.FetchCommittedOffset(pc.gg.Group, pc.topic, pc.partition)
+	if err != nil {
+		return 0, err
+	}
+	if offset >= 0 {
+		return offset, nil
+	}
+	return pc.kc.ListOffset(pc.topic, pc.partition, kafkaclient.OffsetEarliest)
+}
+
+// processMessage pushes data from Kafka message to remote storage.
+//
+// It returns false if stopCh is closed before the data has been pushed.
+func processMessage(stopCh <-chan struct{}, data []byte) bool {
+	messagesRead.Inc()
+	isVMRemoteWrite := encoding.IsZstd(data)
+	isRemoteWriteV2 := !isVMRemoteWrite && stream.IsRemoteWriteV2Block(data)
+	for {
+		err := promremotewrite.InsertHandlerForReader(nil, bytes.NewReader(data), isVMRemoteWrite, isRemoteWriteV2)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, remotewrite.ErrQueueFullHTTPRetry) {
+			messagesInvalid.Inc()
+			logger.Errorf("skipping invalid Kafka message with size %d bytes: %s", len(data), err)
+			return true
+		}
+		// Remote storage cannot keep up with the data ingestion rate. Retry later without committing the offset.
+		pushRetries.Inc()
+		if !sleep(stopCh, time.Second) {
+			return false
+		}
+	}
+}
+
+func isStopped(stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep sleeps for the given duration d.
+//
+// It returns false if stopCh is closed during the sleep.
+func sleep(stopCh <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stopCh:
+		return false
+	case <-t.C:
+		return true
+	}
+}
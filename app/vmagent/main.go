@@ -18,6 +18,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/datadogv2"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/graphite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/influx"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/kafka"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/logmetrics"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/native"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/newrelic"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/opentelemetry"
@@ -26,6 +28,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/prometheusimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/promremotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/statsd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/vmimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
@@ -37,8 +40,10 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/influxutil"
 	graphiteserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/graphite"
 	influxserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/influx"
+	logmetricsserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/logmetrics"
 	opentsdbserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/opentsdb"
 	opentsdbhttpserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/opentsdbhttp"
+	statsdserver "github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver/statsd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
@@ -47,6 +52,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeserieslimits"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 var (
@@ -65,6 +71,10 @@ var (
 		"See also -graphiteListenAddr.useProxyProtocol")
 	graphiteUseProxyProtocol = flag.Bool("graphiteListenAddr.useProxyProtocol", false, "Whether to use proxy protocol for connections accepted at -graphiteListenAddr . "+
 		"See https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt")
+	graphitePickleListenAddr = flag.String("graphitePickleListenAddr", "", "TCP address to listen for Graphite pickle protocol data. Usually :2004 must be set. Doesn't work if empty. "+
+		"See https://graphite.readthedocs.io/en/latest/feeding-carbon.html#the-pickle-protocol . See also -graphitePickleListenAddr.useProxyProtocol")
+	graphitePickleUseProxyProtocol = flag.Bool("graphitePickleListenAddr.useProxyProtocol", false, "Whether to use proxy protocol for connections accepted at -graphitePickleListenAddr . "+
+		"See https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt")
 	opentsdbListenAddr = flag.String("opentsdbListenAddr", "", "TCP and UDP address to listen for OpenTSDB metrics. "+
 		"Telnet put messages and HTTP /api/put messages are simultaneously served on TCP port. "+
 		"Usually :4242 must be set. Doesn't work if empty. See also -opentsdbListenAddr.useProxyProtocol")
@@ -74,9 +84,24 @@ var (
 		"See also -opentsdbHTTPListenAddr.useProxyProtocol")
 	opentsdbHTTPUseProxyProtocol = flag.Bool("opentsdbHTTPListenAddr.useProxyProtocol", false, "Whether to use proxy protocol for connections accepted "+
 		"at -opentsdbHTTPListenAddr . See https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt")
+	statsdListenAddr = flag.String("statsdListenAddr", "", "TCP and UDP address to listen for StatsD metrics. Usually :8125 must be set. Doesn't work if empty. "+
+		"StatsD metrics must be aggregated with -streamAggr.config or -remoteWrite.streamAggr.config. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#statsd . See also -statsdListenAddr.useProxyProtocol")
+	statsdUseProxyProtocol = flag.Bool("statsdListenAddr.useProxyProtocol", false, "Whether to use proxy protocol for connections accepted at -statsdListenAddr . "+
+		"See https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt")
+	statsdDisableAggregationEnforcement = flag.Bool("statsd.disableAggregationEnforcement", false, "Whether to allow accepting StatsD metrics at -statsdListenAddr "+
+		"without -streamAggr.config and -remoteWrite.streamAggr.config. In this case raw StatsD samples are written to remote storage as is. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#statsd")
+	logMetricsListenAddr = flag.String("logMetricsListenAddr", "", "TCP and UDP address to listen for log lines in JSON, syslog or plain text format. "+
+		"Metrics are derived from the accepted lines according to -logMetrics.config . Doesn't work if empty. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#log-derived-metrics . See also -logMetricsListenAddr.useProxyProtocol")
+	logMetricsUseProxyProtocol = flag.Bool("logMetricsListenAddr.useProxyProtocol", false, "Whether to use proxy protocol for connections accepted at -logMetricsListenAddr . "+
+		"See https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt")
 	configAuthKey = flagutil.NewPassword("configAuthKey", "Authorization key for accessing /config page. It must be passed via authKey query arg. It overrides -httpAuth.*")
 	reloadAuthKey = flagutil.NewPassword("reloadAuthKey", "Auth key for /-/reload http endpoint. It must be passed via authKey query arg. It overrides -httpAuth.*")
-	dryRun        = flag.Bool("dryRun", false, "Whether to check config files without running vmagent. The following files are checked: "+
+	queueAuthKey  = flagutil.NewPassword("queueAuthKey", "Auth key for /remotewrite/queues, /remotewrite/queue/export and /remotewrite/queue/replay http endpoints. "+
+		"It must be passed via authKey query arg. These endpoints are disabled if -queueAuthKey isn't set. See https://docs.victoriametrics.com/victoriametrics/vmagent/#inspecting-persistent-queue")
+	dryRun = flag.Bool("dryRun", false, "Whether to check config files without running vmagent. The following files are checked: "+
 		"-promscrape.config, -remoteWrite.relabelConfig, -remoteWrite.urlRelabelConfig, -remoteWrite.streamAggr.config . "+
 		"Unknown config entries aren't allowed in -promscrape.config by default. This can be changed by passing -promscrape.config.strictParse=false command-line flag")
 	maxLabelsPerTimeseries = flag.Int("maxLabelsPerTimeseries", 0, "The maximum number of labels per time series to be accepted. Series with superfluous labels are ignored. In this case the vm_rows_ignored_total{reason=\"too_many_labels\"} metric at /metrics page is incremented")
@@ -85,10 +110,13 @@ var (
 )
 
 var (
-	influxServer       *influxserver.Server
-	graphiteServer     *graphiteserver.Server
-	opentsdbServer     *opentsdbserver.Server
-	opentsdbhttpServer *opentsdbhttpserver.Server
+	influxServer         *influxserver.Server
+	graphiteServer       *graphiteserver.Server
+	graphitePickleServer *graphiteserver.PickleServer
+	opentsdbServer       *opentsdbserver.Server
+	opentsdbhttpServer   *opentsdbhttpserver.Server
+	statsdServer         *statsdserver.Server
+	logMetricsServer     *logmetricsserver.Server
 )
 
 var (
@@ -137,6 +165,15 @@ func main() {
 		return
 	}
 
+	if len(*statsdListenAddr) > 0 && !*statsdDisableAggregationEnforcement && !remotewrite.HasAnyStreamAggrConfigs() {
+		logger.Fatalf("-statsdListenAddr requires -streamAggr.config or -remoteWrite.streamAggr.config, since StatsD metrics must be aggregated before writing them to remote storage; " +
+			"pass -statsd.disableAggregationEnforcement command-line flag in order to write raw StatsD samples to remote storage")
+	}
+
+	if len(*logMetricsListenAddr) > 0 && !logmetrics.IsEnabled() {
+		logger.Fatalf("-logMetricsListenAddr requires -logMetrics.config")
+	}
+
 	listenAddrs := *httpListenAddrs
 	if len(listenAddrs) == 0 {
 		listenAddrs = []string{":8429"}
@@ -154,6 +191,9 @@ func main() {
 	if len(*graphiteListenAddr) > 0 {
 		graphiteServer = graphiteserver.MustStart(*graphiteListenAddr, *graphiteUseProxyProtocol, graphite.InsertHandler)
 	}
+	if len(*graphitePickleListenAddr) > 0 {
+		graphitePickleServer = graphiteserver.MustStartPickle(*graphitePickleListenAddr, *graphitePickleUseProxyProtocol, graphite.PickleInsertHandler)
+	}
 	if len(*opentsdbListenAddr) > 0 {
 		httpInsertHandler := getOpenTSDBHTTPInsertHandler()
 		opentsdbServer = opentsdbserver.MustStart(*opentsdbListenAddr, *opentsdbUseProxyProtocol, opentsdb.InsertHandler, httpInsertHandler)
@@ -162,9 +202,19 @@ func main() {
 		httpInsertHandler := getOpenTSDBHTTPInsertHandler()
 		opentsdbhttpServer = opentsdbhttpserver.MustStart(*opentsdbHTTPListenAddr, *opentsdbHTTPUseProxyProtocol, httpInsertHandler)
 	}
+	if len(*statsdListenAddr) > 0 {
+		statsdServer = statsdserver.MustStart(*statsdListenAddr, *statsdUseProxyProtocol, statsd.InsertHandler)
+	}
+	logmetrics.Init()
+	if len(*logMetricsListenAddr) > 0 {
+		logMetricsServer = logmetricsserver.MustStart(*logMetricsListenAddr, *logMetricsUseProxyProtocol, logmetrics.InsertHandler)
+	}
+
+	kafka.Init()
 
 	promscrape.Init(remotewrite.PushDropSamplesOnFailure)
 
+	tracing.Init()
 	go httpserver.Serve(listenAddrs, requestHandler, httpserver.ServeOptions{
 		UseProxyProtocol: useProxyProtocol,
 	})
@@ -182,6 +232,7 @@ func main() {
 		logger.Fatalf("cannot stop the webservice: %s", err)
 	}
 	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
+	tracing.Stop()
 
 	promscrape.Stop()
 
@@ -191,12 +242,23 @@ func main() {
 	if len(*graphiteListenAddr) > 0 {
 		graphiteServer.MustStop()
 	}
+	if len(*graphitePickleListenAddr) > 0 {
+		graphitePickleServer.MustStop()
+	}
 	if len(*opentsdbListenAddr) > 0 {
 		opentsdbServer.MustStop()
 	}
 	if len(*opentsdbHTTPListenAddr) > 0 {
 		opentsdbhttpServer.MustStop()
 	}
+	if len(*statsdListenAddr) > 0 {
+		statsdServer.MustStop()
+	}
+	if len(*logMetricsListenAddr) > 0 {
+		logMetricsServer.MustStop()
+	}
+	logmetrics.Stop()
+	kafka.MustStop()
 	protoparserutil.StopUnmarshalWorkers()
 	remotewrite.Stop()
 
@@ -252,6 +314,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 			{"metric-relabel-debug", "debug metric relabeling"},
 			{"api/v1/targets", "advanced information about discovered targets in JSON format"},
 			{"config", "-promscrape.config contents"},
+			{"remotewrite/queues", "persistent queues for -remoteWrite.url"},
 			{"metrics", "available service metrics"},
 			{"flags", "command-line flags"},
 			{"-/reload", "reload configuration"},
@@ -288,7 +351,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		prometheusWriteRequests.Inc()
-		if err := promremotewrite.InsertHandler(nil, r); err != nil {
+		if err := promremotewrite.InsertHandler(nil, w, r); err != nil {
 			prometheusWriteErrors.Inc()
 			httpserver.Errorf(w, r, "%s", err)
 			return true
@@ -348,6 +411,15 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		}
 		firehose.WriteSuccessResponse(w, r)
 		return true
+	case "/logmetrics/api/v1/push":
+		logMetricsPushRequests.Inc()
+		if err := logmetrics.InsertHandlerForHTTP(r); err != nil {
+			logMetricsPushErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return true
 	case "/newrelic":
 		newrelicCheckRequest.Inc()
 		w.Header().Set("Content-Type", "application/json")
@@ -477,6 +549,36 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		promscrape.WriteConfigData(&bb)
 		fmt.Fprintf(w, `{"status":"success","data":{"yaml":%s}}`, stringsutil.JSONString(string(bb.B)))
 		return true
+	case "/remotewrite/queues":
+		if !checkQueueAuthKey(w, r) {
+			return true
+		}
+		remotewriteQueuesRequests.Inc()
+		w.Header().Set("Content-Type", "application/json")
+		remotewrite.WriteQueues(w)
+		return true
+	case "/remotewrite/queue/export":
+		if !checkQueueAuthKey(w, r) {
+			return true
+		}
+		remotewriteQueueExportRequests.Inc()
+		if err := remotewrite.ExportQueue(w, r); err != nil {
+			remotewriteQueueExportErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
+	case "/remotewrite/queue/replay":
+		if !checkQueueAuthKey(w, r) {
+			return true
+		}
+		remotewriteQueueReplayRequests.Inc()
+		if err := remotewrite.ReplayQueue(w, r); err != nil {
+			remotewriteQueueReplayErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
 	case "/prometheus/-/reload", "/-/reload":
 		if !httpserver.CheckAuthFlag(w, r, reloadAuthKey) {
 			return true
@@ -507,6 +609,18 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+// checkQueueAuthKey verifies the authKey query arg for the persistent queue endpoints.
+//
+// Unlike httpserver.CheckAuthFlag, it doesn't fall back to -httpAuth.* if -queueAuthKey isn't set,
+// since these endpoints allow reading and removing the pending data.
+func checkQueueAuthKey(w http.ResponseWriter, r *http.Request) bool {
+	if queueAuthKey.Get() == "" {
+		http.Error(w, "The endpoint is disabled; set -queueAuthKey command-line flag for enabling it", http.StatusForbidden)
+		return false
+	}
+	return httpserver.CheckAuthFlag(w, r, queueAuthKey)
+}
+
 func processMultitenantRequest(w http.ResponseWriter, r *http.Request, path string) bool {
 	p, err := httpserver.ParsePath(path)
 	if err != nil {
@@ -546,7 +660,7 @@ func processMultitenantRequest(w http.ResponseWriter, r *http.Request, path stri
 	switch p.Suffix {
 	case "prometheus/", "prometheus", "prometheus/api/v1/write", "prometheus/api/v1/push":
 		prometheusWriteRequests.Inc()
-		if err := promremotewrite.InsertHandler(at, r); err != nil {
+		if err := promremotewrite.InsertHandler(at, w, r); err != nil {
 			prometheusWriteErrors.Inc()
 			httpserver.Errorf(w, r, "%s", err)
 			return true
@@ -727,6 +841,9 @@ var (
 	opentelemetryPushRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/opentelemetry/v1/metrics", protocol="opentelemetry"}`)
 	opentelemetryPushErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/opentelemetry/v1/metrics", protocol="opentelemetry"}`)
 
+	logMetricsPushRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/logmetrics/api/v1/push", protocol="logmetrics"}`)
+	logMetricsPushErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/logmetrics/api/v1/push", protocol="logmetrics"}`)
+
 	newrelicWriteRequests = metrics.NewCounter(`vm_http_requests_total{path="/newrelic/infra/v2/metrics/events/bulk", protocol="newrelic"}`)
 	newrelicWriteErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/newrelic/infra/v2/metrics/events/bulk", protocol="newrelic"}`)
 
@@ -748,6 +865,12 @@ var (
 	promscrapeStatusConfigRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/api/v1/status/config"}`)
 
 	promscrapeConfigReloadRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/-/reload"}`)
+
+	remotewriteQueuesRequests      = metrics.NewCounter(`vmagent_http_requests_total{path="/remotewrite/queues"}`)
+	remotewriteQueueExportRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/remotewrite/queue/export"}`)
+	remotewriteQueueExportErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/remotewrite/queue/export"}`)
+	remotewriteQueueReplayRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/remotewrite/queue/replay"}`)
+	remotewriteQueueReplayErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/remotewrite/queue/replay"}`)
 )
 
 func usage() {
@@ -1,11 +1,13 @@
 package promremotewrite
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite/stream"
@@ -20,32 +22,72 @@ var (
 	rowsTenantInserted     = tenantmetrics.NewCounterMap(`vmagent_tenant_inserted_rows_total{type="promremotewrite"}`)
 	metadataTenantInserted = tenantmetrics.NewCounterMap(`vmagent_tenant_inserted_metadata_total{type="promremotewrite"}`)
 	rowsPerInsert          = metrics.NewHistogram(`vmagent_rows_per_insert{type="promremotewrite"}`)
+
+	unsupportedNativeHistograms = metrics.NewCounter(`vmagent_rows_ignored_total{type="promremotewrite",reason="unsupported_native_histogram"}`)
 )
 
 // InsertHandler processes remote write for prometheus.
-func InsertHandler(at *auth.Token, req *http.Request) error {
+//
+// Response headers with the number of written samples are set at w for Prometheus remote write 2.0 requests.
+func InsertHandler(at *auth.Token, w http.ResponseWriter, req *http.Request) error {
 	extraLabels, err := protoparserutil.GetExtraLabels(req)
 	if err != nil {
 		return err
 	}
 	isVMRemoteWrite := req.Header.Get("Content-Encoding") == "zstd"
-	return stream.Parse(req.Body, isVMRemoteWrite, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
-		return insertRows(at, tss, mms, extraLabels)
+	isRemoteWriteV2, err := stream.IsRemoteWriteV2(req.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	samplesWritten := 0
+	histogramsWritten := 0
+	err = stream.Parse(req.Body, isVMRemoteWrite, isRemoteWriteV2, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+		samples, histograms, err := insertRows(at, tss, mms, extraLabels)
+		if err != nil {
+			return err
+		}
+		samplesWritten += samples
+		histogramsWritten += histograms
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if isRemoteWriteV2 {
+		// vmagent doesn't forward exemplars, so they are never reported as written.
+		stream.SetWrittenHeaders(w.Header(), samplesWritten, histogramsWritten, 0)
+	}
+	return nil
+}
+
+// InsertHandlerForReader processes Prometheus remote write request read from r.
+//
+// It is used for processing remote write requests obtained from sources other than HTTP, such as Kafka messages.
+func InsertHandlerForReader(at *auth.Token, r io.Reader, isVMRemoteWrite, isRemoteWriteV2 bool) error {
+	return stream.Parse(r, isVMRemoteWrite, isRemoteWriteV2, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+		_, _, err := insertRows(at, tss, mms, nil)
+		return err
 	})
 }
 
-func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, mms []prompb.MetricMetadata, extraLabels []prompb.Label) error {
+// insertRows pushes timeseries and mms to remote storage and returns the number of pushed samples and native histograms.
+func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, mms []prompb.MetricMetadata, extraLabels []prompb.Label) (int, int, error) {
 	ctx := common.GetPushCtx()
 	defer common.PutPushCtx(ctx)
 
 	rowsTotal := 0
+	samplesTotal := 0
+	histogramsTotal := 0
 	tssDst := ctx.WriteRequest.Timeseries[:0]
 	mmsDst := ctx.WriteRequest.Metadata[:0]
 	labels := ctx.Labels[:0]
 	samples := ctx.Samples[:0]
+	isNativeHistogramsEnabled := nativehistogram.IsEnabled()
+	var components []nativehistogram.Component
 	for i := range timeseries {
 		ts := &timeseries[i]
 		rowsTotal += len(ts.Samples)
+		samplesTotal += len(ts.Samples)
 		labelsLen := len(labels)
 		for i := range ts.Labels {
 			label := &ts.Labels[i]
@@ -64,9 +106,42 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, mms []prompb.Met
 			})
 		}
 		tssDst = append(tssDst, prompb.TimeSeries{
-			Labels:  labels[labelsLen:],
-			Samples: samples[samplesLen:],
+			Labels:           labels[labelsLen:],
+			Samples:          samples[samplesLen:],
+			CreatedTimestamp: ts.CreatedTimestamp,
 		})
+		if isNativeHistogramsEnabled {
+			// Every native histogram component is sent as a separate series with the additional label.
+			seriesLabels := labels[labelsLen:]
+			for j := range ts.Histograms {
+				h := &ts.Histograms[j]
+				var err error
+				components, err = nativehistogram.AppendComponents(components[:0], h)
+				if err != nil {
+					unsupportedNativeHistograms.Inc()
+					continue
+				}
+				for _, c := range components {
+					componentLabelsLen := len(labels)
+					labels = append(labels, seriesLabels...)
+					labels = append(labels, prompb.Label{
+						Name:  nativehistogram.ComponentLabel,
+						Value: c.Name,
+					})
+					componentSamplesLen := len(samples)
+					samples = append(samples, prompb.Sample{
+						Value:     c.Value,
+						Timestamp: h.Timestamp,
+					})
+					tssDst = append(tssDst, prompb.TimeSeries{
+						Labels:  labels[componentLabelsLen:],
+						Samples: samples[componentSamplesLen:],
+					})
+				}
+				rowsTotal += len(components)
+				histogramsTotal++
+			}
+		}
 	}
 	ctx.WriteRequest.Timeseries = tssDst
 
@@ -96,7 +171,7 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, mms []prompb.Met
 	ctx.Labels = labels
 	ctx.Samples = samples
 	if !remotewrite.TryPush(at, &ctx.WriteRequest) {
-		return remotewrite.ErrQueueFullHTTPRetry
+		return 0, 0, remotewrite.ErrQueueFullHTTPRetry
 	}
 	rowsInserted.Add(rowsTotal)
 	if at != nil {
@@ -105,5 +180,5 @@ func insertRows(at *auth.Token, timeseries []prompb.TimeSeries, mms []prompb.Met
 	}
 	metadataInserted.Add(metadataTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
-	return nil
+	return samplesTotal, histogramsTotal, nil
 }
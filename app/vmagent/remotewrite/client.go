@@ -18,9 +18,13 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/kafka"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite/stream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
@@ -33,6 +37,9 @@ var (
 		"to the corresponding -remoteWrite.url . See https://docs.victoriametrics.com/victoriametrics/vmagent/#victoriametrics-remote-write-protocol")
 	forceVMProto = flagutil.NewArrayBool("remoteWrite.forceVMProto", "Whether to force VictoriaMetrics remote write protocol for sending data "+
 		"to the corresponding -remoteWrite.url . See https://docs.victoriametrics.com/victoriametrics/vmagent/#victoriametrics-remote-write-protocol")
+	usePromRemoteWriteV2 = flagutil.NewArrayBool("remoteWrite.usePromRemoteWriteV2", "Whether to send data to the corresponding -remoteWrite.url via Prometheus remote write 2.0 protocol. "+
+		"It reduces network bandwidth usage compared to Prometheus remote write 1.0 protocol. vmagent falls back to Prometheus remote write 1.0 protocol "+
+		"if the remote storage doesn't support 2.0 protocol. See https://docs.victoriametrics.com/victoriametrics/vmagent/#prometheus-remote-write-20")
 
 	rateLimit = flagutil.NewArrayInt("remoteWrite.rateLimit", 0, "Optional rate limit in bytes per second for data sent to the corresponding -remoteWrite.url. "+
 		"By default, the rate limit is disabled. It can be useful for limiting load on remote storage when big amounts of buffered data "+
@@ -95,6 +102,15 @@ type client struct {
 	useVMProto          atomic.Bool
 	canDowngradeVMProto atomic.Bool
 
+	// Whether to use Prometheus remote write 2.0 protocol for sending the data to remoteWriteURL
+	usePromRemoteWriteV2 atomic.Bool
+
+	// Whether to use OpenTelemetry protocol for sending the data to remoteWriteURL
+	useOTLP bool
+
+	// otlpResourceRelabelConfigs is used for obtaining OpenTelemetry resource attributes from series labels if useOTLP is set.
+	otlpResourceRelabelConfigs *promrelabel.ParsedConfigs
+
 	fq *persistentqueue.FastQueue
 	hc *http.Client
 
@@ -107,6 +123,12 @@ type client struct {
 
 	rl *ratelimiter.RateLimiter
 
+	// kafkaTopic is the topic for writing data blocks to if remoteWriteURL has kafka:// scheme.
+	kafkaTopic string
+
+	// kafkaClientsCh contains Kafka clients for concurrent workers if remoteWriteURL has kafka:// scheme.
+	kafkaClientsCh chan *kafka.Client
+
 	bytesSent       *metrics.Counter
 	blocksSent      *metrics.Counter
 	requestDuration *metrics.Histogram
@@ -175,12 +197,20 @@ func newHTTPClient(argIdx int, remoteWriteURL, sanitizedURL string, fq *persiste
 	if useVMProto && usePromProto {
 		logger.Fatalf("-remoteWrite.useVMProto and -remoteWrite.usePromProto cannot be set simultaneously for -remoteWrite.url=%s", sanitizedURL)
 	}
+	if usePromRemoteWriteV2.GetOptionalArg(argIdx) {
+		if useVMProto {
+			logger.Fatalf("-remoteWrite.forceVMProto and -remoteWrite.usePromRemoteWriteV2 cannot be set simultaneously for -remoteWrite.url=%s", sanitizedURL)
+		}
+		usePromProto = true
+		c.usePromRemoteWriteV2.Store(true)
+	}
 	if !useVMProto && !usePromProto {
 		// The VM protocol could be downgraded later at runtime if unsupported media type response status is received.
 		useVMProto = true
 		c.canDowngradeVMProto.Store(true)
 	}
 	c.useVMProto.Store(useVMProto)
+	c.initOTLP(argIdx)
 
 	return c
 }
@@ -218,6 +248,7 @@ func (c *client) init(argIdx, concurrency int, sanitizedURL string) {
 func (c *client) MustStop() {
 	close(c.stopCh)
 	c.wg.Wait()
+	c.closeKafkaClients()
 	logger.Infof("stopped client for -remoteWrite.url=%q", c.sanitizedURL)
 }
 
@@ -388,10 +419,17 @@ func (c *client) newRequest(url string, body []byte) (*http.Request, error) {
 	h := req.Header
 	h.Set("User-Agent", "vmagent")
 	h.Set("Content-Type", "application/x-protobuf")
-	if encoding.IsZstd(body) {
+	switch {
+	case c.useOTLP:
+		// OpenTelemetry protocol requests are sent without compression.
+	case encoding.IsZstd(body):
 		h.Set("Content-Encoding", "zstd")
 		h.Set("X-VictoriaMetrics-Remote-Write-Version", "1")
-	} else {
+	case stream.IsRemoteWriteV2Block(body):
+		h.Set("Content-Type", "application/x-protobuf;proto=io.prometheus.write.v2.Request")
+		h.Set("Content-Encoding", "snappy")
+		h.Set("X-Prometheus-Remote-Write-Version", "2.0.0")
+	default:
 		h.Set("Content-Encoding", "snappy")
 		h.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
 	}
@@ -439,6 +477,17 @@ again:
 	}
 
 	statusCode := resp.StatusCode
+	if statusCode/100 == 2 && resp.Header.Get("X-Prometheus-Remote-Write-Samples-Written") == "" && !c.useOTLP && stream.IsRemoteWriteV2Block(block) {
+		// Remote storage must return X-Prometheus-Remote-Write-*-Written headers for remote write 2.0 requests.
+		// Their absence means the remote storage supports only remote write 1.0 and silently ignored the data.
+		// See https://prometheus.io/docs/specs/prw/remote_write_spec_2_0/#required-written-response-headers
+		_ = resp.Body.Close()
+		if c.tryDowngradePromRemoteWriteV2(&block) {
+			goto again
+		}
+		c.packetsDropped.Inc()
+		return true
+	}
 	if statusCode/100 == 2 {
 		_ = resp.Body.Close()
 		c.requestsOKCount.Inc()
@@ -463,13 +512,21 @@ again:
 		// - Real-world implementations of v1 use both 400 and 415 status codes.
 		// See more in research: https://github.com/VictoriaMetrics/VictoriaMetrics/pull/8462#issuecomment-2786918054
 	case 415, 400:
+		if statusCode == 415 && !c.useOTLP && stream.IsRemoteWriteV2Block(block) {
+			_ = resp.Body.Close()
+			if c.tryDowngradePromRemoteWriteV2(&block) {
+				goto again
+			}
+			c.packetsDropped.Inc()
+			return true
+		}
 		if c.canDowngradeVMProto.Swap(false) {
 			logger.Infof("received unsupported media type or bad request from remote storage at %q. Downgrading protocol from VictoriaMetrics to Prometheus remote write for all future requests. "+
 				"See https://docs.victoriametrics.com/victoriametrics/vmagent/#victoriametrics-remote-write-protocol", c.sanitizedURL)
 			c.useVMProto.Store(false)
 		}
 
-		if encoding.IsZstd(block) {
+		if !c.useOTLP && encoding.IsZstd(block) {
 			logger.Infof("received unsupported media type or bad request from remote storage at %q. Re-packing the block to Prometheus remote write and retrying."+
 				"See https://docs.victoriametrics.com/victoriametrics/vmagent/#victoriametrics-remote-write-protocol", c.sanitizedURL)
 
@@ -568,6 +625,67 @@ func repackBlockFromZstdToSnappy(zstdBlock []byte) ([]byte, error) {
 	return snappy.Encode(nil, plainBlock), nil
 }
 
+// tryDowngradePromRemoteWriteV2 switches c to Prometheus remote write 1.0 protocol
+// and repacks the given Prometheus remote write 2.0 block to remote write 1.0 block.
+//
+// It returns false if the block cannot be repacked, so it must be dropped.
+func (c *client) tryDowngradePromRemoteWriteV2(block *[]byte) bool {
+	if c.usePromRemoteWriteV2.Swap(false) {
+		logger.Infof("remote storage at %q doesn't support Prometheus remote write 2.0 protocol. Downgrading protocol to Prometheus remote write 1.0 for all future requests. "+
+			"See https://docs.victoriametrics.com/victoriametrics/vmagent/#prometheus-remote-write-20", c.sanitizedURL)
+	}
+	v1Block, err := repackBlockFromPromV2ToV1(*block)
+	if err != nil {
+		logger.Warnf("failed to repack Prometheus remote write 2.0 block (%d bytes) to remote write 1.0 block: %s; the block will be dropped. "+
+			"Possible cause: ungraceful shutdown leading to persisted queue corruption.", len(*block), err)
+		return false
+	}
+	*block = v1Block
+	c.retriesCount.Inc()
+	return true
+}
+
+// repackBlockFromPromV2ToV1 repacks the given Prometheus remote write 2.0 block to remote write 1.0 block.
+func repackBlockFromPromV2ToV1(v2Block []byte) ([]byte, error) {
+	plainBlock, err := snappy.Decode(nil, v2Block)
+	if err != nil {
+		return nil, fmt.Errorf("snappy: decode: %w", err)
+	}
+	var wru prompb.WriteRequestUnmarshaler
+	wr, err := wru.UnmarshalProtobufV2(plainBlock)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal remote write 2.0 request: %w", err)
+	}
+	return snappy.Encode(nil, wr.MarshalProtobuf(nil)), nil
+}
+
+// unmarshalBlock unmarshals the given block in any of the formats supported by remote write clients.
+//
+// The block may be encoded in VictoriaMetrics remote write protocol, Prometheus remote write 1.0 or 2.0 protocol.
+func unmarshalBlock(block []byte) (wr *prompb.WriteRequest, isVMRemoteWrite, isRemoteWriteV2 bool, err error) {
+	isVMRemoteWrite = encoding.IsZstd(block)
+	isRemoteWriteV2 = !isVMRemoteWrite && stream.IsRemoteWriteV2Block(block)
+	var data []byte
+	if isVMRemoteWrite {
+		data, err = zstd.Decompress(nil, block)
+	} else {
+		data, err = snappy.Decode(nil, block)
+	}
+	if err != nil {
+		return nil, false, false, fmt.Errorf("cannot decompress block: %w", err)
+	}
+	var wru prompb.WriteRequestUnmarshaler
+	if isRemoteWriteV2 {
+		wr, err = wru.UnmarshalProtobufV2(data)
+	} else {
+		wr, err = wru.UnmarshalProtobuf(data)
+	}
+	if err != nil {
+		return nil, false, false, fmt.Errorf("cannot unmarshal block: %w", err)
+	}
+	return wr, isVMRemoteWrite, isRemoteWriteV2, nil
+}
+
 func logBlockRejected(block []byte, sanitizedURL string, resp *http.Response) {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
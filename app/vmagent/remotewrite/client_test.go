@@ -3,10 +3,13 @@ package remotewrite
 import (
 	"math"
 	"net/http"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite/stream"
 	"github.com/golang/snappy"
 )
 
@@ -130,3 +133,31 @@ func TestRepackBlockFromZstdToSnappyInvalidBlock(t *testing.T) {
 		t.Fatalf("expected empty snappy block; got %d bytes", len(snappyBlock))
 	}
 }
+
+func TestRepackBlockFromPromV2ToV1(t *testing.T) {
+	wr := newTestWriteRequest(100, 5)
+	v2Block := snappy.Encode(nil, wr.MarshalProtobufV2(nil))
+	if !stream.IsRemoteWriteV2Block(v2Block) {
+		t.Fatalf("expecting remote write 2.0 block")
+	}
+
+	v1Block, err := repackBlockFromPromV2ToV1(v2Block)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stream.IsRemoteWriteV2Block(v1Block) {
+		t.Fatalf("unexpected remote write 2.0 block after repacking")
+	}
+	plainBlock, err := snappy.Decode(nil, v1Block)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var wru prompb.WriteRequestUnmarshaler
+	wrGot, err := wru.UnmarshalProtobuf(plainBlock)
+	if err != nil {
+		t.Fatalf("cannot unmarshal repacked block: %s", err)
+	}
+	if !reflect.DeepEqual(wrGot.Timeseries, wr.Timeseries) {
+		t.Fatalf("unexpected timeseries after repacking\ngot\n%v\nwant\n%v", wrGot.Timeseries, wr.Timeseries)
+	}
+}
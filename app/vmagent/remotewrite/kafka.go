@@ -0,0 +1,380 @@
+package remotewrite
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/easyproto"
+	"github.com/cespare/xxhash/v2"
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/kafka"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite/stream"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+// newKafkaClient returns a client, which writes data blocks to the Kafka topic specified in remoteWriteURL.
+//
+// remoteWriteURL must have the following format: kafka://<broker>/?topic=<topic>[&concurrency=<n>][&client.id=<id>][&security.protocol=<protocol>][&sasl.mechanism=PLAIN]
+//
+// The second returned value is the number of concurrent Kafka producers.
+func newKafkaClient(argIdx int, remoteWriteURL *url.URL, sanitizedURL string, fq *persistentqueue.FastQueue) (*client, int) {
+	q := remoteWriteURL.Query()
+	topic := q.Get("topic")
+	if topic == "" {
+		logger.Fatalf("missing `topic` query arg in -remoteWrite.url=%q; for example, kafka://localhost:9092/?topic=prom-rw", sanitizedURL)
+	}
+	if remoteWriteURL.Host == "" {
+		logger.Fatalf("missing Kafka broker address in -remoteWrite.url=%q; for example, kafka://localhost:9092/?topic=prom-rw", sanitizedURL)
+	}
+	brokers := strings.Split(remoteWriteURL.Host, ";")
+
+	concurrency := 1
+	if s := q.Get("concurrency"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			logger.Fatalf("invalid `concurrency` query arg in -remoteWrite.url=%q; it must be positive integer; got %q", sanitizedURL, s)
+		}
+		concurrency = n
+	}
+
+	authCfg, err := getAuthConfig(argIdx)
+	if err != nil {
+		logger.Fatalf("cannot initialize auth config for -remoteWrite.url=%q: %s", sanitizedURL, err)
+	}
+	opts := &kafka.ClientOptions{
+		ClientID:       q.Get("client.id"),
+		RequestTimeout: sendTimeout.GetOptionalArg(argIdx),
+	}
+	if mechanism := q.Get("sasl.mechanism"); mechanism != "" && mechanism != "PLAIN" {
+		logger.Fatalf("unsupported `sasl.mechanism=%q` query arg in -remoteWrite.url=%q; supported values: PLAIN", mechanism, sanitizedURL)
+	}
+	saslPassword := basicAuthPassword.GetOptionalArg(argIdx)
+	if passwordFile := basicAuthPasswordFile.GetOptionalArg(argIdx); passwordFile != "" {
+		saslPassword, err = fscore.ReadPasswordFromFileOrHTTP(passwordFile)
+		if err != nil {
+			logger.Fatalf("cannot read -remoteWrite.basicAuth.passwordFile for -remoteWrite.url=%q: %s", sanitizedURL, err)
+		}
+	}
+	if err := opts.InitSecurity(q.Get("security.protocol"), authCfg.GetTLSConfig, basicAuthUsername.GetOptionalArg(argIdx), saslPassword); err != nil {
+		logger.Fatalf("cannot initialize security config for -remoteWrite.url=%q: %s", sanitizedURL, err)
+	}
+
+	retryMaxIntervalFlag := retryMaxTime
+	if retryMaxInterval.String() != "" {
+		retryMaxIntervalFlag = retryMaxInterval
+	}
+	c := &client{
+		sanitizedURL:     sanitizedURL,
+		remoteWriteURL:   remoteWriteURL.String(),
+		authCfg:          authCfg,
+		fq:               fq,
+		retryMinInterval: retryMinInterval.GetOptionalArg(argIdx),
+		retryMaxInterval: retryMaxIntervalFlag.GetOptionalArg(argIdx),
+		stopCh:           make(chan struct{}),
+
+		kafkaTopic:     topic,
+		kafkaClientsCh: make(chan *kafka.Client, concurrency),
+	}
+	for i := 0; i < concurrency; i++ {
+		c.kafkaClientsCh <- kafka.NewClient(brokers, opts)
+	}
+	c.sendBlock = c.sendBlockKafka
+
+	// Kafka messages are consumed by vmagent, so there is no need in protocol downgrade.
+	useVMProto := forceVMProto.GetOptionalArg(argIdx)
+	if usePromRemoteWriteV2.GetOptionalArg(argIdx) {
+		if useVMProto {
+			logger.Fatalf("-remoteWrite.forceVMProto and -remoteWrite.usePromRemoteWriteV2 cannot be set simultaneously for -remoteWrite.url=%s", sanitizedURL)
+		}
+		c.usePromRemoteWriteV2.Store(true)
+	}
+	c.useVMProto.Store(useVMProto)
+
+	return c, concurrency
+}
+
+func (c *client) closeKafkaClients() {
+	if c.kafkaClientsCh == nil {
+		return
+	}
+	for i := 0; i < cap(c.kafkaClientsCh); i++ {
+		kc := <-c.kafkaClientsCh
+		kc.Close()
+	}
+}
+
+// sendBlockKafka sends block to Kafka topic.
+//
+// Samples for the same series are sent to the same partition, so they are consumed in order.
+// The block is sent with at-least-once semantics: it is re-sent to all the partitions, which didn't confirm the write.
+//
+// It returns false only if c is stopped. Otherwise, it tries sending the block to Kafka indefinitely.
+func (c *client) sendBlockKafka(block []byte) bool {
+	c.rl.Register(len(block))
+	maxRetryDuration := timeutil.AddJitterToDuration(c.retryMaxInterval)
+	retryDuration := timeutil.AddJitterToDuration(c.retryMinInterval)
+
+	kc := <-c.kafkaClientsCh
+	defer func() {
+		c.kafkaClientsCh <- kc
+	}()
+
+	var blocks [][]byte
+	for {
+		startTime := time.Now()
+		err := c.produceKafkaBlocks(kc, block, &blocks)
+		c.requestDuration.UpdateDuration(startTime)
+		if err == nil {
+			c.requestsOKCount.Inc()
+			c.bytesSent.Add(len(block))
+			c.blocksSent.Inc()
+			return true
+		}
+		if _, ok := err.(*invalidBlockError); ok {
+			remoteWriteRejectedLogger.Errorf("cannot send a block with size %d bytes to %q: %s; skipping the block", len(block), c.sanitizedURL, err)
+			c.packetsDropped.Inc()
+			return true
+		}
+
+		c.errorsCount.Inc()
+		retryDuration *= 2
+		if retryDuration > maxRetryDuration {
+			retryDuration = maxRetryDuration
+		}
+		remoteWriteRetryLogger.Warnf("couldn't send a block with size %d bytes to %q: %s; re-sending the block in %.3f seconds",
+			len(block), c.sanitizedURL, err, retryDuration.Seconds())
+		t := timerpool.Get(retryDuration)
+		select {
+		case <-c.stopCh:
+			timerpool.Put(t)
+			return false
+		case <-t.C:
+			timerpool.Put(t)
+		}
+		c.retriesCount.Inc()
+	}
+}
+
+// produceKafkaBlocks sends block to Kafka partitions.
+//
+// blocks contains per-partition blocks, which weren't sent yet. It is initialized on the first call.
+// Successfully sent blocks are removed from blocks, so they aren't re-sent on retries.
+func (c *client) produceKafkaBlocks(kc *kafka.Client, block []byte, blocks *[][]byte) error {
+	if *blocks == nil {
+		partitions, err := kc.Partitions(c.kafkaTopic)
+		if err != nil {
+			return err
+		}
+		bs, err := splitBlockByPartitions(block, len(partitions))
+		if err != nil {
+			return &invalidBlockError{err: err}
+		}
+		*blocks = bs
+	}
+
+	timestamp := time.Now().UnixMilli()
+	for partition, b := range *blocks {
+		if b == nil {
+			continue
+		}
+		records := []kafka.Record{{
+			Timestamp: timestamp,
+			Value:     b,
+		}}
+		if _, err := kc.Produce(c.kafkaTopic, int32(partition), records); err != nil {
+			return err
+		}
+		(*blocks)[partition] = nil
+	}
+	return nil
+}
+
+type invalidBlockError struct {
+	err error
+}
+
+func (e *invalidBlockError) Error() string {
+	return e.err.Error()
+}
+
+// splitBlockByPartitions splits the given block into blocks per each of partitionsCount Kafka partitions.
+//
+// Series are distributed among partitions by hash of their labels, so samples for the same series always go to the same partition.
+// The returned blocks are encoded in the same format as the original block. Blocks for partitions without series are nil.
+func splitBlockByPartitions(block []byte, partitionsCount int) ([][]byte, error) {
+	if partitionsCount <= 1 {
+		return [][]byte{block}, nil
+	}
+
+	isVMRemoteWrite := encoding.IsZstd(block)
+	if !isVMRemoteWrite && stream.IsRemoteWriteV2Block(block) {
+		return splitBlockByPartitionsV2(block, partitionsCount)
+	}
+
+	var data []byte
+	var err error
+	if isVMRemoteWrite {
+		data, err = zstd.Decompress(nil, block)
+	} else {
+		data, err = snappy.Decode(nil, block)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress block: %w", err)
+	}
+
+	// Copy the encoded timeseries and metadata to per-partition messages as is
+	// in order to avoid the overhead of unmarshaling and marshaling every series.
+	//
+	// message WriteRequest {
+	//    repeated TimeSeries timeseries = 1;
+	//    reserved 2;
+	//    repeated Metadata metadata = 3;
+	// }
+	datas := make([][]byte, partitionsCount)
+	d := xxhash.New()
+	var fc easyproto.FieldContext
+	for len(data) > 0 {
+		tail, err := fc.NextField(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		field := data[:len(data)-len(tail)]
+		data = tail
+
+		d.Reset()
+		switch fc.FieldNum {
+		case 1:
+			ts, ok := fc.MessageData()
+			if !ok {
+				return nil, fmt.Errorf("cannot read timeseries data")
+			}
+			if err := hashTimeSeriesLabels(d, ts); err != nil {
+				return nil, fmt.Errorf("cannot read timeseries labels: %w", err)
+			}
+		case 3:
+			md, ok := fc.MessageData()
+			if !ok {
+				return nil, fmt.Errorf("cannot read metricMetadata data")
+			}
+			if err := hashMetricFamilyName(d, md); err != nil {
+				return nil, fmt.Errorf("cannot read metricMetadata: %w", err)
+			}
+		default:
+			continue
+		}
+		idx := d.Sum64() % uint64(partitionsCount)
+		datas[idx] = append(datas[idx], field...)
+	}
+
+	blocks := make([][]byte, partitionsCount)
+	for i, data := range datas {
+		if len(data) == 0 {
+			continue
+		}
+		if isVMRemoteWrite {
+			blocks[i] = zstd.CompressLevel(nil, data, *vmProtoCompressLevel)
+		} else {
+			blocks[i] = snappy.Encode(nil, data)
+		}
+	}
+	return blocks, nil
+}
+
+// hashTimeSeriesLabels writes the encoded labels of the TimeSeries message from src to d.
+func hashTimeSeriesLabels(d *xxhash.Digest, src []byte) error {
+	// message TimeSeries {
+	//   repeated Label labels       = 1;
+	//   ...
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		tail, err := fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		if fc.FieldNum == 1 {
+			_, _ = d.Write(src[:len(src)-len(tail)])
+		}
+		src = tail
+	}
+	return nil
+}
+
+// hashMetricFamilyName writes the metric family name of the MetricMetadata message from src to d.
+func hashMetricFamilyName(d *xxhash.Digest, src []byte) error {
+	// message MetricMetadata {
+	//   MetricType type = 1;
+	//   string metric_family_name = 2;
+	//   ...
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		if fc.FieldNum == 2 {
+			name, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read metric_family_name")
+			}
+			_, _ = d.WriteString(name)
+		}
+	}
+	return nil
+}
+
+// splitBlockByPartitionsV2 splits the given Prometheus remote write 2.0 block into blocks per each of partitionsCount Kafka partitions.
+//
+// Series in remote write 2.0 messages refer to the symbols table shared among all the series in the message,
+// so the per-partition messages are re-encoded with their own symbols tables.
+func splitBlockByPartitionsV2(block []byte, partitionsCount int) ([][]byte, error) {
+	wr, _, _, err := unmarshalBlock(block)
+	if err != nil {
+		return nil, err
+	}
+
+	wrs := make([]prompb.WriteRequest, partitionsCount)
+	var buf []byte
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		buf = buf[:0]
+		for _, label := range ts.Labels {
+			buf = append(buf, label.Name...)
+			buf = append(buf, 0)
+			buf = append(buf, label.Value...)
+			buf = append(buf, 0)
+		}
+		idx := xxhash.Sum64(buf) % uint64(partitionsCount)
+		wrs[idx].Timeseries = append(wrs[idx].Timeseries, *ts)
+	}
+	for i := range wr.Metadata {
+		md := &wr.Metadata[i]
+		idx := xxhash.Sum64String(md.MetricFamilyName) % uint64(partitionsCount)
+		wrs[idx].Metadata = append(wrs[idx].Metadata, *md)
+	}
+
+	var data []byte
+	blocks := make([][]byte, partitionsCount)
+	for i := range wrs {
+		pwr := &wrs[i]
+		if pwr.IsEmpty() {
+			continue
+		}
+		data = pwr.MarshalProtobufV2(data[:0])
+		blocks[i] = snappy.Encode(nil, data)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,133 @@
+package remotewrite
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestSplitBlockByPartitions(t *testing.T) {
+	f := func(isVMRemoteWrite, isRemoteWriteV2 bool, partitionsCount int) {
+		t.Helper()
+
+		wr := newTestWriteRequest(100, 3)
+		// Remote write 2.0 messages store metadata per each series, so standalone metadata is checked only for v1 messages.
+		for i := 0; i < 10 && !isRemoteWriteV2; i++ {
+			wr.Metadata = append(wr.Metadata, prompb.MetricMetadata{
+				Type:             1,
+				MetricFamilyName: fmt.Sprintf("metric_%d", i),
+				Help:             "some help",
+			})
+		}
+		var data []byte
+		if isRemoteWriteV2 {
+			data = wr.MarshalProtobufV2(nil)
+		} else {
+			data = wr.MarshalProtobuf(nil)
+		}
+		var block []byte
+		if isVMRemoteWrite {
+			block = encoding.CompressZSTDLevel(nil, data, 1)
+		} else {
+			block = snappy.Encode(nil, data)
+		}
+
+		blocks, err := splitBlockByPartitions(block, partitionsCount)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(blocks) != partitionsCount {
+			t.Fatalf("unexpected number of blocks; got %d; want %d", len(blocks), partitionsCount)
+		}
+
+		// Verify that the split is deterministic, so samples for the same series go to the same partition.
+		blocksExpected, err := splitBlockByPartitions(block, partitionsCount)
+		if err != nil {
+			t.Fatalf("unexpected error on the second split: %s", err)
+		}
+		if !reflect.DeepEqual(blocks, blocksExpected) {
+			t.Fatalf("split results mismatch for the same block")
+		}
+
+		// Verify that all the series are preserved and every series is stored in a single partition.
+		seriesPartitions := make(map[string]int)
+		metadataCount := 0
+		for partition, b := range blocks {
+			if b == nil {
+				continue
+			}
+			if encoding.IsZstd(b) != isVMRemoteWrite {
+				t.Fatalf("unexpected block encoding for partition %d", partition)
+			}
+			var data []byte
+			if isVMRemoteWrite {
+				data, err = encoding.DecompressZSTD(nil, b)
+			} else {
+				data, err = snappy.Decode(nil, b)
+			}
+			if err != nil {
+				t.Fatalf("cannot decompress block for partition %d: %s", partition, err)
+			}
+			var wru prompb.WriteRequestUnmarshaler
+			var pwr *prompb.WriteRequest
+			if isRemoteWriteV2 {
+				pwr, err = wru.UnmarshalProtobufV2(data)
+			} else {
+				pwr, err = wru.UnmarshalProtobuf(data)
+			}
+			if err != nil {
+				t.Fatalf("cannot unmarshal block for partition %d: %s", partition, err)
+			}
+			for _, ts := range pwr.Timeseries {
+				name := strings.Clone(ts.Labels[0].Value)
+				if _, ok := seriesPartitions[name]; ok {
+					t.Fatalf("series %q is stored in multiple partitions", name)
+				}
+				seriesPartitions[name] = partition
+				if len(ts.Labels) != 3 || len(ts.Samples) != 1 {
+					t.Fatalf("unexpected series %q after the split; labels: %d, samples: %d", name, len(ts.Labels), len(ts.Samples))
+				}
+			}
+			metadataCount += len(pwr.Metadata)
+		}
+		if metadataCount != len(wr.Metadata) {
+			t.Fatalf("unexpected number of metadata entries after the split; got %d; want %d", metadataCount, len(wr.Metadata))
+		}
+		if len(seriesPartitions) != len(wr.Timeseries) {
+			t.Fatalf("unexpected number of series after the split; got %d; want %d", len(seriesPartitions), len(wr.Timeseries))
+		}
+		if partitionsCount > 1 {
+			partitionsUsed := make(map[int]struct{})
+			for _, partition := range seriesPartitions {
+				partitionsUsed[partition] = struct{}{}
+			}
+			if len(partitionsUsed) < 2 {
+				t.Fatalf("series must be distributed among multiple partitions; got %d partitions used", len(partitionsUsed))
+			}
+		}
+	}
+
+	// VictoriaMetrics remote write protocol
+	f(true, false, 1)
+	f(true, false, 4)
+
+	// Prometheus remote write protocol v1
+	f(false, false, 1)
+	f(false, false, 3)
+
+	// Prometheus remote write protocol v2
+	f(false, true, 1)
+	f(false, true, 5)
+}
+
+func TestSplitBlockByPartitionsInvalidBlock(t *testing.T) {
+	if _, err := splitBlockByPartitions([]byte("invalid block"), 3); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
@@ -0,0 +1,252 @@
+package remotewrite
+
+import (
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
+)
+
+var (
+	useOTLP = flagutil.NewArrayBool("remoteWrite.useOTLP", "Whether to send data to the corresponding -remoteWrite.url via OpenTelemetry protocol (OTLP/HTTP protobuf). "+
+		"In this case -remoteWrite.url must point to OTLP metrics endpoint, e.g. http://otel-collector:4318/v1/metrics . "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#sending-data-via-opentelemetry-protocol")
+	otlpResourceRelabelConfigPaths = flagutil.NewArrayString("remoteWrite.otlpResourceRelabelConfig", "Optional path to relabel configs for obtaining OpenTelemetry "+
+		"resource attributes from series labels for the corresponding -remoteWrite.url with enabled -remoteWrite.useOTLP. "+
+		"The path can point either to local file or to http url. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmagent/#sending-data-via-opentelemetry-protocol")
+)
+
+// initOTLP switches c to sending data via OpenTelemetry protocol if -remoteWrite.useOTLP is set for the given argIdx.
+func (c *client) initOTLP(argIdx int) {
+	if !useOTLP.GetOptionalArg(argIdx) {
+		return
+	}
+	if forcePromProto.GetOptionalArg(argIdx) || usePromRemoteWriteV2.GetOptionalArg(argIdx) {
+		logger.Fatalf("-remoteWrite.useOTLP cannot be used together with -remoteWrite.forcePromProto or -remoteWrite.usePromRemoteWriteV2 for -remoteWrite.url=%s", c.sanitizedURL)
+	}
+	if path := otlpResourceRelabelConfigPaths.GetOptionalArg(argIdx); path != "" {
+		pcs, err := promrelabel.LoadRelabelConfigs(path)
+		if err != nil {
+			logger.Fatalf("cannot load relabel configs from -remoteWrite.otlpResourceRelabelConfig=%q: %s", path, err)
+		}
+		c.otlpResourceRelabelConfigs = pcs
+	}
+	c.useOTLP = true
+	c.sendBlock = c.sendBlockOTLP
+
+	// Data blocks are stored in the persistent queue in VictoriaMetrics remote write format, since it is the most compact format.
+	// They are converted to OpenTelemetry protocol just before sending.
+	c.useVMProto.Store(true)
+	c.canDowngradeVMProto.Store(false)
+	c.usePromRemoteWriteV2.Store(false)
+}
+
+// sendBlockOTLP converts the given block to OpenTelemetry protocol and sends it to c.remoteWriteURL.
+//
+// The function returns false only if c.stopCh is closed.
+// Otherwise, it tries sending the block to remote storage indefinitely.
+func (c *client) sendBlockOTLP(block []byte) bool {
+	otlpBlock, err := marshalOTLPRequest(nil, block, c.otlpResourceRelabelConfigs)
+	if err != nil {
+		remoteWriteRejectedLogger.Errorf("cannot convert a block with size %d bytes to OpenTelemetry protocol for %q: %s; skipping the block", len(block), c.sanitizedURL, err)
+		c.packetsDropped.Inc()
+		return true
+	}
+	return c.sendBlockHTTP(otlpBlock)
+}
+
+// marshalOTLPRequest converts the given block to OpenTelemetry ExportMetricsServiceRequest,
+// appends its protobuf representation to dst and returns the result.
+//
+// Resource attributes are obtained by applying resourcePCS to series labels.
+func marshalOTLPRequest(dst, block []byte, resourcePCS *promrelabel.ParsedConfigs) ([]byte, error) {
+	wr, _, _, err := unmarshalBlock(block)
+	if err != nil {
+		return dst, err
+	}
+	req := convertToOTLP(wr, resourcePCS)
+	return req.MarshalProtobuf(dst), nil
+}
+
+// convertToOTLP converts wr to OpenTelemetry ExportMetricsServiceRequest.
+//
+// Series with the same resource attributes obtained via resourcePCS are grouped into a single ResourceMetrics.
+// Counters are converted to monotonic cumulative sums, while the rest of series are converted to gauges.
+// Series are detected as counters if their metadata has counter type or if their names end with _total.
+func convertToOTLP(wr *prompb.WriteRequest, resourcePCS *promrelabel.ParsedConfigs) *pb.ExportMetricsServiceRequest {
+	mds := make(map[string]*prompb.MetricMetadata, len(wr.Metadata))
+	for i := range wr.Metadata {
+		md := &wr.Metadata[i]
+		mds[md.MetricFamilyName] = md
+	}
+
+	var req pb.ExportMetricsServiceRequest
+	resources := make(map[string]*otlpResourceMetrics)
+	var resourceLabels []prompb.Label
+	var key []byte
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		metricName := getMetricName(ts.Labels)
+		if metricName == "" || len(ts.Samples) == 0 {
+			continue
+		}
+
+		resourceLabels = getResourceLabels(resourceLabels[:0], ts.Labels, resourcePCS)
+		key = marshalLabelsKey(key[:0], resourceLabels)
+		rm := resources[string(key)]
+		if rm == nil {
+			rm = newOTLPResourceMetrics(resourceLabels)
+			resources[string(key)] = rm
+			req.ResourceMetrics = append(req.ResourceMetrics, rm.rm)
+		}
+
+		m := rm.getMetric(metricName, mds)
+		attrs := labelsToAttributes(ts.Labels, resourceLabels)
+		var startTimeUnixNano uint64
+		if ts.CreatedTimestamp > 0 {
+			startTimeUnixNano = uint64(ts.CreatedTimestamp) * 1e6
+		}
+		for _, s := range ts.Samples {
+			v := s.Value
+			dp := &pb.NumberDataPoint{
+				Attributes:   attrs,
+				TimeUnixNano: uint64(s.Timestamp) * 1e6,
+				DoubleValue:  &v,
+			}
+			if decimal.IsStaleNaN(v) {
+				// Staleness markers are sent as data points without recorded value.
+				// See https://opentelemetry.io/docs/specs/otel/metrics/data-model/#no-recorded-value
+				dp.Flags = 1
+			}
+			if m.Sum != nil {
+				dp.StartTimeUnixNano = startTimeUnixNano
+				m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+			} else {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+			}
+		}
+	}
+	return &req
+}
+
+type otlpResourceMetrics struct {
+	rm      *pb.ResourceMetrics
+	metrics map[string]*pb.Metric
+}
+
+func newOTLPResourceMetrics(resourceLabels []prompb.Label) *otlpResourceMetrics {
+	return &otlpResourceMetrics{
+		rm: &pb.ResourceMetrics{
+			Resource: &pb.Resource{
+				Attributes: labelsToAttributes(resourceLabels, nil),
+			},
+			ScopeMetrics: []*pb.ScopeMetrics{{}},
+		},
+		metrics: make(map[string]*pb.Metric),
+	}
+}
+
+func (rm *otlpResourceMetrics) getMetric(metricName string, mds map[string]*prompb.MetricMetadata) *pb.Metric {
+	if m := rm.metrics[metricName]; m != nil {
+		return m
+	}
+
+	md := mds[metricName]
+	if md == nil {
+		md = mds[strings.TrimSuffix(metricName, "_total")]
+	}
+	m := &pb.Metric{
+		Name: metricName,
+	}
+	isCounter := strings.HasSuffix(metricName, "_total")
+	if md != nil {
+		m.Description = md.Help
+		m.Unit = md.Unit
+		isCounter = prompb.MetricMetadataType(md.Type) == prompb.MetricMetadataCOUNTER
+	}
+	if isCounter {
+		m.Sum = &pb.Sum{
+			AggregationTemporality: pb.AggregationTemporalityCumulative,
+			IsMonotonic:            true,
+		}
+	} else {
+		m.Gauge = &pb.Gauge{}
+	}
+	rm.metrics[metricName] = m
+
+	sm := rm.rm.ScopeMetrics[0]
+	sm.Metrics = append(sm.Metrics, m)
+	return m
+}
+
+func getMetricName(labels []prompb.Label) string {
+	for _, label := range labels {
+		if label.Name == "__name__" {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// getResourceLabels appends labels obtained by applying pcs to labels to dst and returns the result.
+func getResourceLabels(dst, labels []prompb.Label, pcs *promrelabel.ParsedConfigs) []prompb.Label {
+	if pcs.Len() == 0 {
+		return dst
+	}
+	dstLen := len(dst)
+	dst = append(dst, labels...)
+	dst = pcs.Apply(dst, dstLen)
+	resourceLabels := dst[dstLen:]
+	dst = dst[:dstLen]
+	for _, label := range promrelabel.FinalizeLabels(nil, resourceLabels) {
+		if label.Name == "__name__" {
+			continue
+		}
+		dst = append(dst, label)
+	}
+	return dst
+}
+
+func marshalLabelsKey(dst []byte, labels []prompb.Label) []byte {
+	for _, label := range labels {
+		dst = append(dst, label.Name...)
+		dst = append(dst, 0)
+		dst = append(dst, label.Value...)
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+// labelsToAttributes converts labels to OpenTelemetry attributes.
+//
+// __name__ label and labels, which are present in excludeLabels, are skipped.
+func labelsToAttributes(labels, excludeLabels []prompb.Label) []*pb.KeyValue {
+	attrs := make([]*pb.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		if label.Name == "__name__" || hasLabel(excludeLabels, label) {
+			continue
+		}
+		value := label.Value
+		attrs = append(attrs, &pb.KeyValue{
+			Key: label.Name,
+			Value: &pb.AnyValue{
+				StringValue: &value,
+			},
+		})
+	}
+	return attrs
+}
+
+func hasLabel(labels []prompb.Label, label prompb.Label) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
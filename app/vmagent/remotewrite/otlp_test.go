@@ -0,0 +1,158 @@
+package remotewrite
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
+)
+
+func TestMarshalOTLPRequest(t *testing.T) {
+	f := func(wr *prompb.WriteRequest, resourceRelabelConfigs, resultExpected string) {
+		t.Helper()
+
+		pcs, err := promrelabel.ParseRelabelConfigsData([]byte(resourceRelabelConfigs))
+		if err != nil {
+			t.Fatalf("cannot parse relabel configs: %s", err)
+		}
+
+		blocks := [][]byte{
+			encoding.CompressZSTDLevel(nil, wr.MarshalProtobuf(nil), 1),
+			snappy.Encode(nil, wr.MarshalProtobuf(nil)),
+			snappy.Encode(nil, wr.MarshalProtobufV2(nil)),
+		}
+		for _, block := range blocks {
+			data, err := marshalOTLPRequest(nil, block, pcs)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var req pb.ExportMetricsServiceRequest
+			if err := req.UnmarshalProtobuf(data); err != nil {
+				t.Fatalf("cannot unmarshal OTLP request: %s", err)
+			}
+			result := formatOTLPRequest(&req)
+			if result != resultExpected {
+				t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+			}
+		}
+	}
+
+	newSeries := func(labels []prompb.Label, value float64, timestamp int64) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels: labels,
+			Samples: []prompb.Sample{{
+				Value:     value,
+				Timestamp: timestamp,
+			}},
+		}
+	}
+
+	wr := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			newSeries([]prompb.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "api"}, {Name: "path", Value: "/foo"}}, 10, 1000),
+			newSeries([]prompb.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "api"}, {Name: "path", Value: "/bar"}}, 20, 1000),
+			newSeries([]prompb.Label{{Name: "__name__", Value: "temperature"}, {Name: "job", Value: "sensor"}}, 23.5, 2000),
+			newSeries([]prompb.Label{{Name: "__name__", Value: "errors"}, {Name: "job", Value: "api"}}, 3, 3000),
+			newSeries([]prompb.Label{{Name: "__name__", Value: "temperature"}, {Name: "job", Value: "sensor"}}, decimal.StaleNaN, 4000),
+		},
+		Metadata: []prompb.MetricMetadata{{
+			Type:             uint32(prompb.MetricMetadataCOUNTER),
+			MetricFamilyName: "errors",
+			Help:             "The number of errors",
+		}},
+	}
+
+	// without resource relabeling
+	f(wr, ``, `resource{}
+  sum requests_total{job="api",path="/foo"} 10 @1000
+  sum requests_total{job="api",path="/bar"} 20 @1000
+  gauge temperature{job="sensor"} 23.5 @2000
+  gauge temperature{job="sensor"} NaN @4000 flags=1
+  sum errors{job="api"} 3 @3000 help="The number of errors"
+`)
+
+	// resource attributes obtained from job label
+	f(wr, `
+- action: labelkeep
+  regex: job
+`, `resource{job="api"}
+  sum requests_total{path="/foo"} 10 @1000
+  sum requests_total{path="/bar"} 20 @1000
+  sum errors{} 3 @3000 help="The number of errors"
+resource{job="sensor"}
+  gauge temperature{} 23.5 @2000
+  gauge temperature{} NaN @4000 flags=1
+`)
+
+	// renamed resource attributes
+	f(wr, `
+- action: labelmap
+  regex: job
+  replacement: service.name
+- action: labelkeep
+  regex: service\.name
+`, `resource{service.name="api"}
+  sum requests_total{job="api",path="/foo"} 10 @1000
+  sum requests_total{job="api",path="/bar"} 20 @1000
+  sum errors{job="api"} 3 @3000 help="The number of errors"
+resource{service.name="sensor"}
+  gauge temperature{job="sensor"} 23.5 @2000
+  gauge temperature{job="sensor"} NaN @4000 flags=1
+`)
+}
+
+func TestMarshalOTLPRequestInvalidBlock(t *testing.T) {
+	if _, err := marshalOTLPRequest(nil, []byte("invalid block"), nil); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func formatOTLPRequest(req *pb.ExportMetricsServiceRequest) string {
+	var sb strings.Builder
+	for _, rm := range req.ResourceMetrics {
+		fmt.Fprintf(&sb, "resource%s\n", formatOTLPAttributes(rm.Resource.Attributes))
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				var kind string
+				var dps []*pb.NumberDataPoint
+				switch {
+				case m.Gauge != nil:
+					kind = "gauge"
+					dps = m.Gauge.DataPoints
+				case m.Sum != nil:
+					kind = "sum"
+					dps = m.Sum.DataPoints
+					if !m.Sum.IsMonotonic || m.Sum.AggregationTemporality != pb.AggregationTemporalityCumulative {
+						kind = "invalid_sum"
+					}
+				}
+				for _, dp := range dps {
+					fmt.Fprintf(&sb, "  %s %s%s %v @%d", kind, m.Name, formatOTLPAttributes(dp.Attributes), *dp.DoubleValue, dp.TimeUnixNano/1e6)
+					if dp.Flags != 0 {
+						fmt.Fprintf(&sb, " flags=%d", dp.Flags)
+					}
+					if m.Description != "" {
+						fmt.Fprintf(&sb, " help=%q", m.Description)
+					}
+					sb.WriteString("\n")
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+func formatOTLPAttributes(attrs []*pb.KeyValue) string {
+	a := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		a = append(a, fmt.Sprintf("%s=%q", attr.Key, *attr.Value.StringValue))
+	}
+	return "{" + strings.Join(a, ",") + "}"
+}
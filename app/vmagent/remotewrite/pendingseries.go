@@ -41,10 +41,11 @@ type pendingSeries struct {
 	periodicFlusherWG sync.WaitGroup
 }
 
-func newPendingSeries(fq *persistentqueue.FastQueue, isVMRemoteWrite *atomic.Bool, significantFigures, roundDigits int) *pendingSeries {
+func newPendingSeries(fq *persistentqueue.FastQueue, isVMRemoteWrite, isPromRemoteWriteV2 *atomic.Bool, significantFigures, roundDigits int) *pendingSeries {
 	var ps pendingSeries
 	ps.wr.fq = fq
 	ps.wr.isVMRemoteWrite = isVMRemoteWrite
+	ps.wr.isPromRemoteWriteV2 = isPromRemoteWriteV2
 	ps.wr.significantFigures = significantFigures
 	ps.wr.roundDigits = roundDigits
 	ps.stopCh = make(chan struct{})
@@ -110,6 +111,9 @@ type writeRequest struct {
 	// Whether to encode the write request with VictoriaMetrics remote write protocol.
 	isVMRemoteWrite *atomic.Bool
 
+	// Whether to encode the write request with Prometheus remote write 2.0 protocol.
+	isPromRemoteWriteV2 *atomic.Bool
+
 	// How many significant figures must be left before sending the writeRequest to fq.
 	significantFigures int
 
@@ -130,7 +134,7 @@ type writeRequest struct {
 }
 
 func (wr *writeRequest) reset() {
-	// Do not reset lastFlushTime, fq, isVMRemoteWrite, significantFigures and roundDigits, since they are reused.
+	// Do not reset lastFlushTime, fq, isVMRemoteWrite, isPromRemoteWriteV2, significantFigures and roundDigits, since they are reused.
 
 	wr.wr.Timeseries = nil
 	wr.wr.Metadata = nil
@@ -155,7 +159,7 @@ func (wr *writeRequest) reset() {
 func (wr *writeRequest) mustFlushOnStop() {
 	wr.wr.Timeseries = wr.tss
 	wr.wr.Metadata = wr.mms
-	if !tryPushWriteRequest(&wr.wr, wr.mustWriteBlock, wr.isVMRemoteWrite.Load()) {
+	if !tryPushWriteRequest(&wr.wr, wr.mustWriteBlock, wr.isVMRemoteWrite.Load(), wr.isPromRemoteWriteV2.Load()) {
 		logger.Panicf("BUG: final flush must always return true")
 	}
 	wr.reset()
@@ -170,7 +174,7 @@ func (wr *writeRequest) tryFlush() bool {
 	wr.wr.Timeseries = wr.tss
 	wr.wr.Metadata = wr.mms
 	wr.lastFlushTime.Store(fasttime.UnixTimestamp())
-	if !tryPushWriteRequest(&wr.wr, wr.fq.TryWriteBlock, wr.isVMRemoteWrite.Load()) {
+	if !tryPushWriteRequest(&wr.wr, wr.fq.TryWriteBlock, wr.isVMRemoteWrite.Load(), wr.isPromRemoteWriteV2.Load()) {
 		return false
 	}
 	wr.reset()
@@ -295,12 +299,14 @@ func (wr *writeRequest) copyTimeSeries(dst, src *prompb.TimeSeries) {
 	samplesLen := len(wr.samples)
 	wr.samples = append(wr.samples, src.Samples...)
 	dst.Samples = wr.samples[samplesLen:]
+
+	dst.CreatedTimestamp = src.CreatedTimestamp
 }
 
 // marshalConcurrency limits the maximum number of concurrent workers, which marshal and compress WriteRequest.
 var marshalConcurrencyCh = make(chan struct{}, cgroup.AvailableCPUs())
 
-func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte) bool, isVMRemoteWrite bool) bool {
+func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte) bool, isVMRemoteWrite, isPromRemoteWriteV2 bool) bool {
 	if wr.IsEmpty() {
 		// Nothing to push
 		return true
@@ -309,7 +315,11 @@ func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte
 	marshalConcurrencyCh <- struct{}{}
 
 	bb := writeRequestBufPool.Get()
-	bb.B = wr.MarshalProtobuf(bb.B[:0])
+	if isPromRemoteWriteV2 && !isVMRemoteWrite {
+		bb.B = wr.MarshalProtobufV2(bb.B[:0])
+	} else {
+		bb.B = wr.MarshalProtobuf(bb.B[:0])
+	}
 	if len(bb.B) <= maxUnpackedBlockSize.IntN() {
 		zb := compressBufPool.Get()
 		if isVMRemoteWrite {
@@ -349,12 +359,12 @@ func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte
 		metadata := wr.Metadata
 		n := len(metadata) / 2
 		wr.Metadata = metadata[:n]
-		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
+		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite, isPromRemoteWriteV2) {
 			wr.Metadata = metadata
 			return false
 		}
 		wr.Metadata = metadata[n:]
-		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
+		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite, isPromRemoteWriteV2) {
 			wr.Metadata = metadata
 			return false
 		}
@@ -373,14 +383,14 @@ func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte
 		m := len(metaData) / 2
 		wr.Timeseries[0].Samples = samples[:n]
 		wr.Metadata = metaData[:m]
-		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
+		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite, isPromRemoteWriteV2) {
 			wr.Timeseries[0].Samples = samples
 			wr.Metadata = metaData
 			return false
 		}
 		wr.Timeseries[0].Samples = samples[n:]
 		wr.Metadata = metaData[m:]
-		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
+		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite, isPromRemoteWriteV2) {
 			wr.Timeseries[0].Samples = samples
 			wr.Metadata = metaData
 			return false
@@ -397,14 +407,14 @@ func tryPushWriteRequest(wr *prompb.WriteRequest, tryPushBlock func(block []byte
 		m := len(metaData) / 2
 		wr.Timeseries = timeseries[:n]
 		wr.Metadata = metaData[:m]
-		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
+		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite, isPromRemoteWriteV2) {
 			wr.Timeseries = timeseries
 			wr.Metadata = metaData
 			return false
 		}
 		wr.Timeseries = timeseries[n:]
 		wr.Metadata = metaData[m:]
-		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite) {
+		if !tryPushWriteRequest(wr, tryPushBlock, isVMRemoteWrite, isPromRemoteWriteV2) {
 			wr.Timeseries = timeseries
 			wr.Metadata = metaData
 			return false
@@ -0,0 +1,406 @@
+package remotewrite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+// WriteQueues writes information about persistent queues for -remoteWrite.url in JSON format to w.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmagent/#inspecting-persistent-queue
+func WriteQueues(w io.Writer) {
+	fmt.Fprintf(w, `{"status":"success","data":[`)
+	for i, rwctx := range rwctxsGlobal {
+		if i > 0 {
+			fmt.Fprintf(w, `,`)
+		}
+		fmt.Fprintf(w, `{"url_index":%d,"url":%s,"path":%s,"pending_bytes":%d,"inmemory_blocks":%d}`,
+			rwctx.idx+1, stringsutil.JSONString(rwctx.c.sanitizedURL), stringsutil.JSONString(rwctx.fq.Dirname()),
+			rwctx.fq.GetPendingBytes(), rwctx.fq.GetInmemoryQueueLen())
+	}
+	fmt.Fprintf(w, `]}`)
+}
+
+// ExportQueue exports samples pending in the persistent queue for the -remoteWrite.url
+// specified via url_index query arg in JSON line format.
+//
+// The exported samples may be limited by start and end query args.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmagent/#inspecting-persistent-queue
+func ExportQueue(w http.ResponseWriter, r *http.Request) error {
+	rwctx, err := getQueueRemoteWriteCtx(r)
+	if err != nil {
+		return err
+	}
+	tr, err := getQueueTimeRange(r)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/stream+json; charset=utf-8")
+	bw := bufio.NewWriterSize(w, 64*1024)
+	var buf []byte
+	invalidBlocks := 0
+	err = rwctx.fq.ForEachBlock(func(block []byte) error {
+		wr, _, _, err := unmarshalBlock(block)
+		if err != nil {
+			invalidBlocks++
+			return nil
+		}
+		for i := range wr.Timeseries {
+			buf = appendTimeSeriesJSON(buf[:0], &wr.Timeseries[i], tr)
+			if _, err := bw.Write(buf); err != nil {
+				return fmt.Errorf("cannot send exported data to the client: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if invalidBlocks > 0 {
+		logger.Warnf("skipped %d blocks, which couldn't be decoded, while exporting persistent queue for -remoteWrite.url=%q", invalidBlocks, rwctx.c.sanitizedURL)
+	}
+	return bw.Flush()
+}
+
+// ReplayQueue sends samples pending in the persistent queue for the -remoteWrite.url specified via url_index query arg
+// to the -remoteWrite.url specified via target_url query arg.
+//
+// The replayed samples may be limited by start and end query args.
+// If drain query arg is set, then the replayed samples are removed from the queue.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmagent/#inspecting-persistent-queue
+func ReplayQueue(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("unsupported method %q; use POST", r.Method)
+	}
+	rwctx, err := getQueueRemoteWriteCtx(r)
+	if err != nil {
+		return err
+	}
+	tr, err := getQueueTimeRange(r)
+	if err != nil {
+		return err
+	}
+	target, err := getQueueReplayTarget(r)
+	if err != nil {
+		return err
+	}
+	drain, _ := strconv.ParseBool(r.FormValue("drain"))
+
+	qr := &queueReplayer{
+		target: target,
+		tr:     tr,
+	}
+	if drain {
+		// Pause the readers for the queue, so they don't send the drained blocks concurrently
+		// and don't interleave with the blocks written back to the queue.
+		if !rwctx.fq.PauseReaders() {
+			return fmt.Errorf("the persistent queue for -remoteWrite.url=%q is already being drained", rwctx.c.sanitizedURL)
+		}
+		err = qr.drain(rwctx.fq)
+		rwctx.fq.ResumeReaders()
+	} else {
+		err = qr.replay(rwctx.fq)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot replay persistent queue for -remoteWrite.url=%q to %q: %w", rwctx.c.sanitizedURL, target.sanitizedURL, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"success","data":{"blocks_read":%d,"invalid_blocks":%d,"series_replayed":%d,"samples_replayed":%d}}`,
+		qr.blocksRead, qr.invalidBlocks, qr.seriesReplayed, qr.samplesReplayed)
+	return nil
+}
+
+// getQueueReplayTarget returns the client for the -remoteWrite.url specified via target_url query arg.
+//
+// Only the configured -remoteWrite.url values are allowed as target_url, so the queue cannot be sent to arbitrary urls.
+func getQueueReplayTarget(r *http.Request) (*client, error) {
+	targetURL := r.FormValue("target_url")
+	if targetURL == "" {
+		return nil, fmt.Errorf("missing target_url query arg")
+	}
+	for _, rwctx := range rwctxsGlobal {
+		c := rwctx.c
+		if c.remoteWriteURL != targetURL {
+			continue
+		}
+		if c.kafkaTopic != "" || c.useOTLP {
+			return nil, fmt.Errorf("target_url=%q must point to Prometheus remote write endpoint", c.sanitizedURL)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("target_url must match one of the -remoteWrite.url values")
+}
+
+func getQueueRemoteWriteCtx(r *http.Request) (*remoteWriteCtx, error) {
+	s := r.FormValue("url_index")
+	if s == "" {
+		return nil, fmt.Errorf("missing url_index query arg")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse url_index=%q: %w", s, err)
+	}
+	if n < 1 || n > len(rwctxsGlobal) {
+		return nil, fmt.Errorf("url_index=%d must be in the range [1..%d]", n, len(rwctxsGlobal))
+	}
+	return rwctxsGlobal[n-1], nil
+}
+
+// queueTimeRange is an inclusive time range in milliseconds for the samples to select from the persistent queue.
+type queueTimeRange struct {
+	minTimestamp int64
+	maxTimestamp int64
+}
+
+func (tr *queueTimeRange) contains(timestamp int64) bool {
+	return timestamp >= tr.minTimestamp && timestamp <= tr.maxTimestamp
+}
+
+func getQueueTimeRange(r *http.Request) (queueTimeRange, error) {
+	tr := queueTimeRange{
+		minTimestamp: math.MinInt64,
+		maxTimestamp: math.MaxInt64,
+	}
+	if s := r.FormValue("start"); s != "" {
+		msecs, err := timeutil.ParseTimeMsec(s)
+		if err != nil {
+			return tr, fmt.Errorf("cannot parse start=%q: %w", s, err)
+		}
+		tr.minTimestamp = msecs
+	}
+	if s := r.FormValue("end"); s != "" {
+		msecs, err := timeutil.ParseTimeMsec(s)
+		if err != nil {
+			return tr, fmt.Errorf("cannot parse end=%q: %w", s, err)
+		}
+		tr.maxTimestamp = msecs
+	}
+	if tr.minTimestamp > tr.maxTimestamp {
+		return tr, fmt.Errorf("start cannot exceed end")
+	}
+	return tr, nil
+}
+
+// appendTimeSeriesJSON appends ts samples on the given tr to dst in the JSON line format
+// used by /api/v1/export at VictoriaMetrics.
+//
+// Nothing is appended if ts has no samples on the given tr.
+func appendTimeSeriesJSON(dst []byte, ts *prompb.TimeSeries, tr queueTimeRange) []byte {
+	samples := ts.Samples
+	n := 0
+	for _, s := range samples {
+		if tr.contains(s.Timestamp) {
+			n++
+		}
+	}
+	if n == 0 {
+		return dst
+	}
+
+	dst = append(dst, `{"metric":{`...)
+	for i, label := range ts.Labels {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, stringsutil.JSONString(label.Name)...)
+		dst = append(dst, ':')
+		dst = append(dst, stringsutil.JSONString(label.Value)...)
+	}
+	dst = append(dst, `},"values":[`...)
+	n = 0
+	for _, s := range samples {
+		if !tr.contains(s.Timestamp) {
+			continue
+		}
+		if n > 0 {
+			dst = append(dst, ',')
+		}
+		n++
+		dst = appendValueJSON(dst, s.Value)
+	}
+	dst = append(dst, `],"timestamps":[`...)
+	n = 0
+	for _, s := range samples {
+		if !tr.contains(s.Timestamp) {
+			continue
+		}
+		if n > 0 {
+			dst = append(dst, ',')
+		}
+		n++
+		dst = strconv.AppendInt(dst, s.Timestamp, 10)
+	}
+	dst = append(dst, "]}\n"...)
+	return dst
+}
+
+func appendValueJSON(dst []byte, v float64) []byte {
+	switch {
+	case math.IsNaN(v):
+		return append(dst, `"NaN"`...)
+	case math.IsInf(v, 1):
+		return append(dst, `"Infinity"`...)
+	case math.IsInf(v, -1):
+		return append(dst, `"-Infinity"`...)
+	default:
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	}
+}
+
+// splitWriteRequestByTime splits wr into samples on the given tr and the remaining samples.
+//
+// Metadata is put into the inRange request.
+func splitWriteRequestByTime(wr *prompb.WriteRequest, tr queueTimeRange) (inRange, outOfRange *prompb.WriteRequest) {
+	inRange = &prompb.WriteRequest{
+		Metadata: wr.Metadata,
+	}
+	outOfRange = &prompb.WriteRequest{}
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		var tsIn, tsOut prompb.TimeSeries
+		for _, s := range ts.Samples {
+			if tr.contains(s.Timestamp) {
+				tsIn.Samples = append(tsIn.Samples, s)
+			} else {
+				tsOut.Samples = append(tsOut.Samples, s)
+			}
+		}
+		for _, h := range ts.Histograms {
+			if tr.contains(h.Timestamp) {
+				tsIn.Histograms = append(tsIn.Histograms, h)
+			} else {
+				tsOut.Histograms = append(tsOut.Histograms, h)
+			}
+		}
+		for _, e := range ts.Exemplars {
+			if tr.contains(e.Timestamp) {
+				tsIn.Exemplars = append(tsIn.Exemplars, e)
+			} else {
+				tsOut.Exemplars = append(tsOut.Exemplars, e)
+			}
+		}
+		if len(tsIn.Samples) > 0 || len(tsIn.Histograms) > 0 || len(tsIn.Exemplars) > 0 {
+			tsIn.Labels = ts.Labels
+			tsIn.CreatedTimestamp = ts.CreatedTimestamp
+			inRange.Timeseries = append(inRange.Timeseries, tsIn)
+		}
+		if len(tsOut.Samples) > 0 || len(tsOut.Histograms) > 0 || len(tsOut.Exemplars) > 0 {
+			tsOut.Labels = ts.Labels
+			tsOut.CreatedTimestamp = ts.CreatedTimestamp
+			outOfRange.Timeseries = append(outOfRange.Timeseries, tsOut)
+		}
+	}
+	return inRange, outOfRange
+}
+
+// queueReplayer sends samples from the persistent queue to the target -remoteWrite.url via Prometheus remote write protocol.
+type queueReplayer struct {
+	target *client
+	tr     queueTimeRange
+
+	blocksRead      int
+	invalidBlocks   int
+	seriesReplayed  int
+	samplesReplayed int
+}
+
+// replay sends the samples on qr.tr from fq to qr.target without removing them from fq.
+func (qr *queueReplayer) replay(fq *persistentqueue.FastQueue) error {
+	return fq.ForEachBlock(func(block []byte) error {
+		qr.blocksRead++
+		wr, _, _, err := unmarshalBlock(block)
+		if err != nil {
+			qr.invalidBlocks++
+			return nil
+		}
+		inRange, _ := splitWriteRequestByTime(wr, qr.tr)
+		return qr.send(inRange)
+	})
+}
+
+// drain sends the samples on qr.tr from fq to qr.target and removes them from fq.
+//
+// The remaining samples are written back to fq.
+func (qr *queueReplayer) drain(fq *persistentqueue.FastQueue) error {
+	// Limit the number of bytes to read from fq, since blocks with the remaining samples are written back to fq.
+	pendingBytes := fq.GetPendingBytes()
+	readBytes := uint64(0)
+	var block []byte
+	for readBytes < pendingBytes {
+		var ok bool
+		block, ok = fq.TryReadBlock(block[:0])
+		if !ok {
+			return nil
+		}
+		readBytes += uint64(len(block)) + 8
+		qr.blocksRead++
+		wr, isVMRemoteWrite, isRemoteWriteV2, err := unmarshalBlock(block)
+		if err != nil {
+			qr.invalidBlocks++
+			fq.MustWriteBlockIgnoreDisabledPQ(block)
+			continue
+		}
+		inRange, outOfRange := splitWriteRequestByTime(wr, qr.tr)
+		if err := qr.send(inRange); err != nil {
+			fq.MustWriteBlockIgnoreDisabledPQ(block)
+			return err
+		}
+		_ = tryPushWriteRequest(outOfRange, func(block []byte) bool {
+			fq.MustWriteBlockIgnoreDisabledPQ(block)
+			return true
+		}, isVMRemoteWrite, isRemoteWriteV2)
+	}
+	return nil
+}
+
+func (qr *queueReplayer) send(wr *prompb.WriteRequest) error {
+	if len(wr.Timeseries) == 0 {
+		return nil
+	}
+	var sendErr error
+	tryPushWriteRequest(wr, func(block []byte) bool {
+		sendErr = qr.sendBlock(block)
+		return sendErr == nil
+	}, false, false)
+	if sendErr != nil {
+		return sendErr
+	}
+	qr.seriesReplayed += len(wr.Timeseries)
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		qr.samplesReplayed += len(ts.Samples) + len(ts.Histograms)
+	}
+	return nil
+}
+
+// sendBlock sends the given block to qr.target with the auth, TLS and proxy settings configured for it.
+func (qr *queueReplayer) sendBlock(block []byte) error {
+	c := qr.target
+	resp, err := c.doRequest(c.remoteWriteURL, block)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4*1024))
+		return fmt.Errorf("unexpected status code %d; response body: %q", resp.StatusCode, bytesutil.ToUnsafeString(body))
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package remotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestAppendTimeSeriesJSON(t *testing.T) {
+	f := func(ts *prompb.TimeSeries, tr queueTimeRange, resultExpected string) {
+		t.Helper()
+
+		result := appendTimeSeriesJSON(nil, ts, tr)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	ts := &prompb.TimeSeries{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "foo"},
+			{Name: "job", Value: `a"b`},
+		},
+		Samples: []prompb.Sample{
+			{Value: 1.5, Timestamp: 1000},
+			{Value: math.NaN(), Timestamp: 2000},
+			{Value: math.Inf(-1), Timestamp: 3000},
+		},
+	}
+	allTime := queueTimeRange{
+		minTimestamp: math.MinInt64,
+		maxTimestamp: math.MaxInt64,
+	}
+
+	// all the samples
+	f(ts, allTime, `{"metric":{"__name__":"foo","job":"a\"b"},"values":[1.5,"NaN","-Infinity"],"timestamps":[1000,2000,3000]}`+"\n")
+
+	// samples on the time range
+	f(ts, queueTimeRange{minTimestamp: 2000, maxTimestamp: 3000}, `{"metric":{"__name__":"foo","job":"a\"b"},"values":["NaN","-Infinity"],"timestamps":[2000,3000]}`+"\n")
+
+	// no samples on the time range
+	f(ts, queueTimeRange{minTimestamp: 4000, maxTimestamp: 5000}, ``)
+
+	// series without samples
+	f(&prompb.TimeSeries{}, allTime, ``)
+}
+
+func TestSplitWriteRequestByTime(t *testing.T) {
+	f := func(wr *prompb.WriteRequest, tr queueTimeRange, inRangeExpected, outOfRangeExpected *prompb.WriteRequest) {
+		t.Helper()
+
+		inRange, outOfRange := splitWriteRequestByTime(wr, tr)
+		if !reflect.DeepEqual(inRange, inRangeExpected) {
+			t.Fatalf("unexpected inRange\ngot\n%+v\nwant\n%+v", inRange, inRangeExpected)
+		}
+		if !reflect.DeepEqual(outOfRange, outOfRangeExpected) {
+			t.Fatalf("unexpected outOfRange\ngot\n%+v\nwant\n%+v", outOfRange, outOfRangeExpected)
+		}
+	}
+
+	labelsFoo := []prompb.Label{{Name: "__name__", Value: "foo"}}
+	labelsBar := []prompb.Label{{Name: "__name__", Value: "bar"}}
+	metadata := []prompb.MetricMetadata{{MetricFamilyName: "foo"}}
+	wr := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: labelsFoo,
+				Samples: []prompb.Sample{
+					{Value: 1, Timestamp: 1000},
+					{Value: 2, Timestamp: 2000},
+				},
+			},
+			{
+				Labels: labelsBar,
+				Samples: []prompb.Sample{
+					{Value: 3, Timestamp: 3000},
+				},
+				Histograms: []prompb.Histogram{{Count: 1, Timestamp: 1000}},
+			},
+		},
+		Metadata: metadata,
+	}
+
+	// all the samples are on the time range
+	f(wr, queueTimeRange{minTimestamp: 0, maxTimestamp: 5000}, &prompb.WriteRequest{
+		Timeseries: wr.Timeseries,
+		Metadata:   metadata,
+	}, &prompb.WriteRequest{})
+
+	// samples are split
+	f(wr, queueTimeRange{minTimestamp: 0, maxTimestamp: 1000}, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  labelsFoo,
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+			},
+			{
+				Labels:     labelsBar,
+				Histograms: []prompb.Histogram{{Count: 1, Timestamp: 1000}},
+			},
+		},
+		Metadata: metadata,
+	}, &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  labelsFoo,
+				Samples: []prompb.Sample{{Value: 2, Timestamp: 2000}},
+			},
+			{
+				Labels:  labelsBar,
+				Samples: []prompb.Sample{{Value: 3, Timestamp: 3000}},
+			},
+		},
+	})
+
+	// no samples on the time range
+	f(wr, queueTimeRange{minTimestamp: 10000, maxTimestamp: 20000}, &prompb.WriteRequest{
+		Metadata: metadata,
+	}, &prompb.WriteRequest{
+		Timeseries: wr.Timeseries,
+	})
+}
+
+func TestQueueReplayer(t *testing.T) {
+	var mu sync.Mutex
+	var received []prompb.TimeSeries
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Replay") != "foo" {
+			t.Errorf("unexpected X-Replay header: %q", r.Header.Get("X-Replay"))
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("unexpected Content-Encoding header: %q", r.Header.Get("Content-Encoding"))
+		}
+		block, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request body: %s", err)
+		}
+		wr, _, _, err := unmarshalBlock(block)
+		if err != nil {
+			t.Errorf("cannot unmarshal request body: %s", err)
+		}
+		received = append(received, wr.Timeseries...)
+	}))
+	defer srv.Close()
+
+	authCfg, err := (&promauth.Options{
+		Headers: []string{"X-Replay: foo"},
+	}).NewConfig()
+	if err != nil {
+		t.Fatalf("cannot create auth config: %s", err)
+	}
+	target := &client{
+		sanitizedURL:   srv.URL,
+		remoteWriteURL: srv.URL,
+		authCfg:        authCfg,
+		hc:             &http.Client{},
+	}
+
+	fq := persistentqueue.MustOpenFastQueue(t.TempDir(), "test", 100, 0, false)
+	defer fq.MustClose()
+
+	newSeries := func(name string, timestamps ...int64) prompb.TimeSeries {
+		ts := prompb.TimeSeries{
+			Labels: []prompb.Label{{Name: "__name__", Value: name}},
+		}
+		for _, timestamp := range timestamps {
+			ts.Samples = append(ts.Samples, prompb.Sample{Value: 1, Timestamp: timestamp})
+		}
+		return ts
+	}
+	writeBlock := func(tss ...prompb.TimeSeries) {
+		t.Helper()
+		block := snappy.Encode(nil, (&prompb.WriteRequest{Timeseries: tss}).MarshalProtobuf(nil))
+		if !fq.TryWriteBlock(block) {
+			t.Fatalf("cannot write block to the queue")
+		}
+	}
+	writeBlock(newSeries("foo", 1000, 2000))
+	writeBlock(newSeries("bar", 3000))
+	// invalid block
+	if !fq.TryWriteBlock([]byte("invalid")) {
+		t.Fatalf("cannot write block to the queue")
+	}
+
+	tr := queueTimeRange{
+		minTimestamp: 2000,
+		maxTimestamp: 3000,
+	}
+
+	// replay doesn't remove data from the queue
+	pendingBytes := fq.GetPendingBytes()
+	qr := &queueReplayer{
+		target: target,
+		tr:     tr,
+	}
+	if err := qr.replay(fq); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if qr.blocksRead != 3 || qr.invalidBlocks != 1 || qr.seriesReplayed != 2 || qr.samplesReplayed != 2 {
+		t.Fatalf("unexpected replay stats: %+v", qr)
+	}
+	receivedExpected := []prompb.TimeSeries{newSeries("foo", 2000), newSeries("bar", 3000)}
+	if !reflect.DeepEqual(received, receivedExpected) {
+		t.Fatalf("unexpected series received\ngot\n%+v\nwant\n%+v", received, receivedExpected)
+	}
+	if n := fq.GetPendingBytes(); n != pendingBytes {
+		t.Fatalf("unexpected pending bytes after replay; got %d; want %d", n, pendingBytes)
+	}
+
+	// drain failure keeps data in the queue
+	mu.Lock()
+	fail = true
+	received = nil
+	mu.Unlock()
+	qr = &queueReplayer{
+		target: target,
+		tr:     tr,
+	}
+	if err := qr.drain(fq); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if n := fq.GetPendingBytes(); n != pendingBytes {
+		t.Fatalf("unexpected pending bytes after failed drain; got %d; want %d", n, pendingBytes)
+	}
+
+	// drain removes the replayed samples from the queue
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	qr = &queueReplayer{
+		target: target,
+		tr:     tr,
+	}
+	if err := qr.drain(fq); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if qr.seriesReplayed != 2 || qr.samplesReplayed != 2 {
+		t.Fatalf("unexpected drain stats: %+v", qr)
+	}
+	// the block, which failed to be sent, is moved to the end of the queue
+	receivedExpected = []prompb.TimeSeries{newSeries("bar", 3000), newSeries("foo", 2000)}
+	if !reflect.DeepEqual(received, receivedExpected) {
+		t.Fatalf("unexpected series received\ngot\n%+v\nwant\n%+v", received, receivedExpected)
+	}
+
+	// only the samples outside the time range and the invalid block must remain in the queue
+	var remaining []prompb.TimeSeries
+	invalidBlocks := 0
+	if err := fq.ForEachBlock(func(block []byte) error {
+		wr, _, _, err := unmarshalBlock(block)
+		if err != nil {
+			invalidBlocks++
+			return nil
+		}
+		remaining = append(remaining, wr.Timeseries...)
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	remainingExpected := []prompb.TimeSeries{newSeries("foo", 1000)}
+	if !reflect.DeepEqual(remaining, remainingExpected) {
+		t.Fatalf("unexpected series remaining in the queue\ngot\n%+v\nwant\n%+v", remaining, remainingExpected)
+	}
+	if invalidBlocks != 1 {
+		t.Fatalf("unexpected number of invalid blocks remaining in the queue; got %d; want 1", invalidBlocks)
+	}
+}
+
+func TestGetQueueReplayTarget(t *testing.T) {
+	newRemoteWriteCtx := func(remoteWriteURL string) *remoteWriteCtx {
+		return &remoteWriteCtx{
+			c: &client{
+				sanitizedURL:   remoteWriteURL,
+				remoteWriteURL: remoteWriteURL,
+			},
+		}
+	}
+	rwctxsGlobalOrig := rwctxsGlobal
+	defer func() {
+		rwctxsGlobal = rwctxsGlobalOrig
+	}()
+	rwctxsGlobal = []*remoteWriteCtx{
+		newRemoteWriteCtx("http://foo/api/v1/write"),
+		newRemoteWriteCtx("http://bar/api/v1/write"),
+	}
+	kafkaCtx := newRemoteWriteCtx("kafka://broker:9092/?topic=baz")
+	kafkaCtx.c.kafkaTopic = "baz"
+	rwctxsGlobal = append(rwctxsGlobal, kafkaCtx)
+
+	f := func(targetURL, urlExpected string) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodPost, "/remotewrite/queue/replay?target_url="+url.QueryEscape(targetURL), nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		c, err := getQueueReplayTarget(r)
+		if urlExpected == "" {
+			if err == nil {
+				t.Fatalf("expecting non-nil error for target_url=%q", targetURL)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for target_url=%q: %s", targetURL, err)
+		}
+		if c.remoteWriteURL != urlExpected {
+			t.Fatalf("unexpected target for target_url=%q; got %q; want %q", targetURL, c.remoteWriteURL, urlExpected)
+		}
+	}
+
+	// configured -remoteWrite.url values
+	f("http://foo/api/v1/write", "http://foo/api/v1/write")
+	f("http://bar/api/v1/write", "http://bar/api/v1/write")
+
+	// missing target_url
+	f("", "")
+
+	// arbitrary url
+	f("http://attacker/api/v1/write", "")
+	f("http://169.254.169.254/latest/meta-data", "")
+
+	// non-Prometheus remote write target
+	f("kafka://broker:9092/?topic=baz", "")
+}
@@ -18,6 +18,10 @@ var (
 	streamAggrGlobalConfig = flag.String("streamAggr.config", "", "Optional path to file with stream aggregation config. "+
 		"See https://docs.victoriametrics.com/victoriametrics/stream-aggregation/ . "+
 		"See also -streamAggr.keepInput, -streamAggr.dropInput and -streamAggr.dedupInterval")
+	streamAggrGlobalCarbonAggregationRules = flag.String("streamAggr.carbonAggregationRules", "", "Optional path to file with carbon aggregation rules. "+
+		"The rules are converted to stream aggregation configs, which are applied to Graphite metrics. This flag cannot be set together with -streamAggr.config. "+
+		"Use -streamAggr.keepInput for keeping the input metrics in the same way as carbon-aggregator does with FORWARD_ALL=True. "+
+		"See https://docs.victoriametrics.com/victoriametrics/integrations/graphite/#carbon-aggregation-rules")
 	streamAggrGlobalKeepInput = flag.Bool("streamAggr.keepInput", false, "Whether to keep all the input samples after the aggregation "+
 		"with -streamAggr.config. By default, only aggregates samples are dropped, while the remaining samples "+
 		"are written to remote storages write. See also -streamAggr.dropInput and https://docs.victoriametrics.com/victoriametrics/stream-aggregation/")
@@ -67,7 +71,7 @@ var (
 		"See https://docs.victoriametrics.com/victoriametrics/stream-aggregation/#aggregation-windows.")
 )
 
-// CheckStreamAggrConfigs checks -remoteWrite.streamAggr.config and -streamAggr.config.
+// CheckStreamAggrConfigs checks -remoteWrite.streamAggr.config, -streamAggr.config and -streamAggr.carbonAggregationRules.
 func CheckStreamAggrConfigs() error {
 	// Check global config
 	sas, err := newStreamAggrConfigGlobal()
@@ -91,6 +95,19 @@ func CheckStreamAggrConfigs() error {
 	return nil
 }
 
+// HasAnyStreamAggrConfigs returns true if -streamAggr.config, -streamAggr.carbonAggregationRules or -remoteWrite.streamAggr.config is set.
+func HasAnyStreamAggrConfigs() bool {
+	if _, path := getStreamAggrGlobalConfigPath(); path != "" {
+		return true
+	}
+	for _, path := range *streamAggrConfig {
+		if path != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func reloadStreamAggrConfigs() {
 	reloadStreamAggrConfigGlobal()
 	for _, rwctx := range rwctxsGlobal {
@@ -99,19 +116,19 @@ func reloadStreamAggrConfigs() {
 }
 
 func reloadStreamAggrConfigGlobal() {
-	path := *streamAggrGlobalConfig
+	flagName, path := getStreamAggrGlobalConfigPath()
 	if path == "" {
 		return
 	}
 
-	logger.Infof("reloading stream aggregation configs pointed by -streamAggr.config=%q", path)
+	logger.Infof("reloading stream aggregation configs pointed by -%s=%q", flagName, path)
 	metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_streamaggr_config_reloads_total{path=%q}`, path)).Inc()
 
 	sasNew, err := newStreamAggrConfigGlobal()
 	if err != nil {
 		metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_streamaggr_config_reloads_errors_total{path=%q}`, path)).Inc()
 		metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_streamaggr_config_reload_successful{path=%q}`, path)).Set(0)
-		logger.Errorf("cannot reload -streamAggr.config=%q; continue using the previously loaded config; error: %s", path, err)
+		logger.Errorf("cannot reload -%s=%q; continue using the previously loaded config; error: %s", flagName, path, err)
 		return
 	}
 
@@ -119,10 +136,10 @@ func reloadStreamAggrConfigGlobal() {
 	if !sasNew.Equal(sas) {
 		sasOld := sasGlobal.Swap(sasNew)
 		sasOld.MustStop()
-		logger.Infof("successfully reloaded -streamAggr.config=%q", path)
+		logger.Infof("successfully reloaded -%s=%q", flagName, path)
 	} else {
 		sasNew.MustStop()
-		logger.Infof("-streamAggr.config=%q wasn't changed since the last reload", path)
+		logger.Infof("-%s=%q wasn't changed since the last reload", flagName, path)
 	}
 	metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_streamaggr_config_reload_successful{path=%q}`, path)).Set(1)
 	metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_streamaggr_config_reload_success_timestamp_seconds{path=%q}`, path)).Set(fasttime.UnixTimestamp())
@@ -201,8 +218,19 @@ func (rwctx *remoteWriteCtx) reloadStreamAggrConfig() {
 	metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_streamaggr_config_reload_success_timestamp_seconds{path=%q}`, path)).Set(fasttime.UnixTimestamp())
 }
 
+// getStreamAggrGlobalConfigPath returns the name and the value for the flag with the path to global stream aggregation config.
+func getStreamAggrGlobalConfigPath() (string, string) {
+	if *streamAggrGlobalCarbonAggregationRules != "" {
+		return "streamAggr.carbonAggregationRules", *streamAggrGlobalCarbonAggregationRules
+	}
+	return "streamAggr.config", *streamAggrGlobalConfig
+}
+
 func newStreamAggrConfigGlobal() (*streamaggr.Aggregators, error) {
-	path := *streamAggrGlobalConfig
+	if *streamAggrGlobalConfig != "" && *streamAggrGlobalCarbonAggregationRules != "" {
+		return nil, fmt.Errorf("-streamAggr.config and -streamAggr.carbonAggregationRules cannot be set simultaneously")
+	}
+	flagName, path := getStreamAggrGlobalConfigPath()
 	if path == "" {
 		return nil, nil
 	}
@@ -216,9 +244,13 @@ func newStreamAggrConfigGlobal() (*streamaggr.Aggregators, error) {
 		EnableWindows:        *streamAggrGlobalEnableWindows,
 	}
 
-	sas, err := streamaggr.LoadFromFile(path, pushTimeSeriesToRemoteStoragesTrackDropped, opts, "global")
+	loadFromFile := streamaggr.LoadFromFile
+	if *streamAggrGlobalCarbonAggregationRules != "" {
+		loadFromFile = streamaggr.LoadFromCarbonRulesFile
+	}
+	sas, err := loadFromFile(path, pushTimeSeriesToRemoteStoragesTrackDropped, opts, "global")
 	if err != nil {
-		return nil, fmt.Errorf("cannot load -streamAggr.config=%q: %w", *streamAggrGlobalConfig, err)
+		return nil, fmt.Errorf("cannot load -%s=%q: %w", flagName, path, err)
 	}
 	return sas, nil
 }
@@ -0,0 +1,172 @@
+package statsd
+
+import (
+	"io"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/statsd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/statsd/stream"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	rowsInserted  = metrics.NewCounter(`vmagent_rows_inserted_total{type="statsd"}`)
+	rowsPerInsert = metrics.NewHistogram(`vmagent_rows_per_insert{type="statsd"}`)
+)
+
+// metricTypeLabel is the label name, which contains StatsD metric type for every ingested sample.
+//
+// It can be used for matching StatsD metrics of the particular type in stream aggregation configs.
+const metricTypeLabel = "__statsd_metric_type__"
+
+// InsertHandler processes StatsD lines.
+//
+// See https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+func InsertHandler(r io.Reader) error {
+	return stream.Parse(r, insertRows)
+}
+
+func insertRows(rows []parser.Row) error {
+	ctx := common.GetPushCtx()
+	defer common.PutPushCtx(ctx)
+
+	tssDst := ctx.WriteRequest.Timeseries[:0]
+	labels := ctx.Labels[:0]
+	samples := ctx.Samples[:0]
+	for i := range rows {
+		r := &rows[i]
+		labelsLen := len(labels)
+		labels = append(labels, prompb.Label{
+			Name:  "__name__",
+			Value: r.Metric,
+		})
+		for j := range r.Tags {
+			tag := &r.Tags[j]
+			labels = append(labels, prompb.Label{
+				Name:  tag.Key,
+				Value: tag.Value,
+			})
+		}
+		labels = append(labels, prompb.Label{
+			Name:  metricTypeLabel,
+			Value: r.Type,
+		})
+		value := r.Value
+		switch {
+		case r.Type == parser.TypeCounter:
+			value = counters.add(labels[labelsLen:], value)
+		case r.IsGaugeDelta:
+			value = gauges.add(labels[labelsLen:], value)
+		case r.Type == parser.TypeGauge:
+			gauges.set(labels[labelsLen:], value)
+		}
+		samples = append(samples, prompb.Sample{
+			Value:     value,
+			Timestamp: r.Timestamp,
+		})
+		tssDst = append(tssDst, prompb.TimeSeries{
+			Labels:  labels[labelsLen:],
+			Samples: samples[len(samples)-1:],
+		})
+	}
+	ctx.WriteRequest.Timeseries = tssDst
+	ctx.Labels = labels
+	ctx.Samples = samples
+	if !remotewrite.TryPush(nil, &ctx.WriteRequest) {
+		return remotewrite.ErrQueueFullHTTPRetry
+	}
+	rowsInserted.Add(len(rows))
+	rowsPerInsert.Update(float64(len(rows)))
+	return nil
+}
+
+// counters converts StatsD counter increments into cumulative counters,
+// so they could be aggregated with `total` and `increase` stream aggregation outputs.
+var counters = newSeriesStates()
+
+// gauges contains the current gauge values, so gauge deltas such as `foo:+5|g` could be applied to them.
+var gauges = newSeriesStates()
+
+// stateStaleInterval is the interval after which the series state is dropped
+// if no new samples are received for it.
+const stateStaleInterval = 3600
+
+type seriesState struct {
+	value    float64
+	lastSeen uint64
+}
+
+// seriesStates contains the current values per every series.
+type seriesStates struct {
+	mu          sync.Mutex
+	m           map[string]*seriesState
+	nextCleanup uint64
+	keyBuf      []byte
+}
+
+func newSeriesStates() *seriesStates {
+	return &seriesStates{
+		m:           make(map[string]*seriesState),
+		nextCleanup: fasttime.UnixTimestamp() + stateStaleInterval,
+	}
+}
+
+// add adds the increment to the value of the series identified by labels and returns the updated value.
+//
+// The value for the new series starts from zero.
+func (ss *seriesStates) add(labels []prompb.Label, increment float64) float64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	s := ss.getStateLocked(labels)
+	s.value += increment
+	return s.value
+}
+
+// set sets the value for the series identified by labels.
+func (ss *seriesStates) set(labels []prompb.Label, value float64) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	s := ss.getStateLocked(labels)
+	s.value = value
+}
+
+func (ss *seriesStates) getStateLocked(labels []prompb.Label) *seriesState {
+	currentTime := fasttime.UnixTimestamp()
+	if currentTime >= ss.nextCleanup {
+		ss.removeStaleLocked(currentTime)
+		ss.nextCleanup = currentTime + stateStaleInterval
+	}
+
+	ss.keyBuf = marshalLabels(ss.keyBuf[:0], labels)
+	s := ss.m[string(ss.keyBuf)]
+	if s == nil {
+		s = &seriesState{}
+		ss.m[string(ss.keyBuf)] = s
+	}
+	s.lastSeen = currentTime
+	return s
+}
+
+func (ss *seriesStates) removeStaleLocked(currentTime uint64) {
+	for k, s := range ss.m {
+		if s.lastSeen+stateStaleInterval < currentTime {
+			delete(ss.m, k)
+		}
+	}
+}
+
+func marshalLabels(dst []byte, labels []prompb.Label) []byte {
+	for _, label := range labels {
+		dst = append(dst, label.Name...)
+		dst = append(dst, 0)
+		dst = append(dst, label.Value...)
+		dst = append(dst, 0)
+	}
+	return dst
+}
@@ -0,0 +1,67 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestSeriesStatesAdd(t *testing.T) {
+	cs := newSeriesStates()
+
+	f := func(labels []prompb.Label, increment, resultExpected float64) {
+		t.Helper()
+		result := cs.add(labels, increment)
+		if result != resultExpected {
+			t.Fatalf("unexpected cumulative value; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	foo := []prompb.Label{{Name: "__name__", Value: "foo"}, {Name: metricTypeLabel, Value: "c"}}
+	fooTagged := []prompb.Label{{Name: "__name__", Value: "foo"}, {Name: "x", Value: "y"}, {Name: metricTypeLabel, Value: "c"}}
+
+	f(foo, 1, 1)
+	f(foo, 2.5, 3.5)
+	f(fooTagged, 10, 10)
+	f(foo, 1, 4.5)
+	f(fooTagged, 0, 10)
+
+	// stale counters must be removed
+	cs.removeStaleLocked(cs.m["__name__\x00foo\x00"+metricTypeLabel+"\x00c\x00"].lastSeen + stateStaleInterval + 1)
+	if len(cs.m) != 0 {
+		t.Fatalf("expecting empty counter states after removing stale entries; got %d entries", len(cs.m))
+	}
+	f(foo, 1, 1)
+}
+
+func TestSeriesStatesSet(t *testing.T) {
+	ss := newSeriesStates()
+
+	f := func(labels []prompb.Label, value float64, isDelta bool, resultExpected float64) {
+		t.Helper()
+		result := value
+		if isDelta {
+			result = ss.add(labels, value)
+		} else {
+			ss.set(labels, value)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected gauge value; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	foo := []prompb.Label{{Name: "__name__", Value: "foo"}, {Name: metricTypeLabel, Value: "g"}}
+	bar := []prompb.Label{{Name: "__name__", Value: "bar"}, {Name: metricTypeLabel, Value: "g"}}
+
+	// deltas are applied to the last gauge value
+	f(foo, 10, false, 10)
+	f(foo, 5, true, 15)
+	f(foo, -3, true, 12)
+
+	// the gauge value is replaced
+	f(foo, 2, false, 2)
+	f(foo, 1, true, 3)
+
+	// delta for unknown gauge starts from zero
+	f(bar, -3, true, -3)
+}
@@ -72,7 +72,7 @@ func UnitTest(files []string, disableGroupLabel bool, externalLabels []string, e
 				httpserver.Errorf(w, r, "%s", err)
 			}
 		case "/prometheus/api/v1/write", "/api/v1/write":
-			if err := promremotewrite.InsertHandler(r); err != nil {
+			if err := promremotewrite.InsertHandler(w, r); err != nil {
 				httpserver.Errorf(w, r, "%s", err)
 			}
 		default:
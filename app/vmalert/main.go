@@ -176,6 +176,9 @@ func main() {
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1240
 	sighupCh := procutil.NewSighupChan()
 
+	if err := rule.InitState(); err != nil {
+		logger.Fatalf("cannot init alerts state: %s", err)
+	}
 	if err := manager.start(ctx, groupsCfg); err != nil {
 		logger.Fatalf("failed to start: %s", err)
 	}
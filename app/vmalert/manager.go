@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
@@ -68,7 +69,17 @@ func (m *manager) alertAPI(gID, aID uint64) (*apiAlert, error) {
 }
 
 func (m *manager) start(ctx context.Context, groupsCfg []config.Group) error {
-	return m.update(ctx, groupsCfg, true)
+	if err := m.update(ctx, groupsCfg, true); err != nil {
+		return err
+	}
+	if rule.IsStateEnabled() {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.saveStatePeriodically(ctx)
+		}()
+	}
+	return nil
 }
 
 func (m *manager) close() {
@@ -79,6 +90,36 @@ func (m *manager) close() {
 		}
 	}
 	m.wg.Wait()
+	// save the alerts state after all the groups are stopped,
+	// so it contains the results of the latest evaluations.
+	m.saveState()
+}
+
+// saveStatePeriodically saves alerts state to -rule.stateDir until ctx is cancelled.
+func (m *manager) saveStatePeriodically(ctx context.Context) {
+	t := time.NewTicker(rule.StateSaveInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.saveState()
+		}
+	}
+}
+
+func (m *manager) saveState() {
+	m.groupsMu.RLock()
+	groups := make([]*rule.Group, 0, len(m.groups))
+	for _, g := range m.groups {
+		groups = append(groups, g)
+	}
+	m.groupsMu.RUnlock()
+
+	if err := rule.SaveState(groups); err != nil {
+		logger.Errorf("cannot save alerts state: %s", err)
+	}
 }
 
 func (m *manager) startGroup(ctx context.Context, g *rule.Group, restore bool) error {
@@ -157,14 +157,38 @@ func NewAlertManager(alertManagerURL string, fn AlertURLGenerator, authCfg proma
 		return nil, fmt.Errorf("invalid alertmanager URL: %w", err)
 	}
 
+	client, aCfg, err := newHTTPClient(authCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client for alertmanager URL=%q: %w", alertManagerURL, err)
+	}
+
+	amURL, err := url.Parse(alertManagerURL)
+	if err != nil {
+		return nil, fmt.Errorf("provided incorrect notifier url: %w", err)
+	}
+	if !*showNotifierURL {
+		alertManagerURL = amURL.Redacted()
+	}
+	return &AlertManager{
+		addr:           amURL,
+		argFunc:        fn,
+		authCfg:        aCfg,
+		relabelConfigs: relabelCfg,
+		client:         client,
+		timeout:        timeout,
+		metrics:        newNotifierMetrics(alertManagerURL),
+	}, nil
+}
+
+// newHTTPClient returns HTTP client and auth config for the given authCfg.
+func newHTTPClient(authCfg promauth.HTTPClientConfig) (*http.Client, *promauth.Config, error) {
 	tls := &promauth.TLSConfig{}
 	if authCfg.TLSConfig != nil {
 		tls = authCfg.TLSConfig
 	}
 	tr, err := promauth.NewTLSTransport(tls.CertFile, tls.KeyFile, tls.CAFile, tls.ServerName, tls.InsecureSkipVerify, "vmalert_notifier")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create transport for alertmanager URL=%q: %w", alertManagerURL, err)
-
+		return nil, nil, fmt.Errorf("failed to create transport: %w", err)
 	}
 
 	ba := new(promauth.BasicAuthConfig)
@@ -183,25 +207,11 @@ func NewAlertManager(alertManagerURL string, fn AlertURLGenerator, authCfg proma
 		vmalertutil.WithHeaders(strings.Join(authCfg.Headers, "^^")),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to configure auth: %w", err)
+		return nil, nil, fmt.Errorf("failed to configure auth: %w", err)
 	}
 
-	amURL, err := url.Parse(alertManagerURL)
-	if err != nil {
-		return nil, fmt.Errorf("provided incorrect notifier url: %w", err)
+	client := &http.Client{
+		Transport: tr,
 	}
-	if !*showNotifierURL {
-		alertManagerURL = amURL.Redacted()
-	}
-	return &AlertManager{
-		addr:           amURL,
-		argFunc:        fn,
-		authCfg:        aCfg,
-		relabelConfigs: relabelCfg,
-		client: &http.Client{
-			Transport: tr,
-		},
-		timeout: timeout,
-		metrics: newNotifierMetrics(alertManagerURL),
-	}, nil
+	return client, aCfg, nil
 }
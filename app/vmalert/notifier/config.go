@@ -37,6 +37,15 @@ type Config struct {
 	// StaticConfigs contains list of static targets
 	StaticConfigs []StaticConfig `yaml:"static_configs,omitempty"`
 
+	// WebhookConfigs contains list of generic webhooks
+	WebhookConfigs []WebhookConfig `yaml:"webhook_configs,omitempty"`
+	// SlackConfigs contains list of Slack-compatible incoming webhooks
+	SlackConfigs []SlackConfig `yaml:"slack_configs,omitempty"`
+	// PagerDutyConfigs contains list of PagerDuty Events API v2 integrations
+	PagerDutyConfigs []PagerDutyConfig `yaml:"pagerduty_configs,omitempty"`
+	// EmailConfigs contains list of SMTP receivers
+	EmailConfigs []EmailConfig `yaml:"email_configs,omitempty"`
+
 	// HTTPClientConfig contains HTTP configuration for Notifier clients
 	HTTPClientConfig promauth.HTTPClientConfig `yaml:",inline"`
 	// RelabelConfigs contains list of relabeling rules for entities discovered via SD
@@ -95,6 +104,27 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(any) error) error {
 	}
 	cfg.parsedAlertRelabelConfigs = arCfg
 
+	for i := range cfg.WebhookConfigs {
+		if err := cfg.WebhookConfigs[i].validate(); err != nil {
+			return fmt.Errorf("invalid webhook_configs #%d: %w", i+1, err)
+		}
+	}
+	for i := range cfg.SlackConfigs {
+		if err := cfg.SlackConfigs[i].validate(); err != nil {
+			return fmt.Errorf("invalid slack_configs #%d: %w", i+1, err)
+		}
+	}
+	for i := range cfg.PagerDutyConfigs {
+		if err := cfg.PagerDutyConfigs[i].validate(); err != nil {
+			return fmt.Errorf("invalid pagerduty_configs #%d: %w", i+1, err)
+		}
+	}
+	for i := range cfg.EmailConfigs {
+		if err := cfg.EmailConfigs[i].validate(); err != nil {
+			return fmt.Errorf("invalid email_configs #%d: %w", i+1, err)
+		}
+	}
+
 	b, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal configuration for checksum: %w", err)
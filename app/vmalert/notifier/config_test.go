@@ -18,6 +18,7 @@ func TestParseConfig_Success(t *testing.T) {
 	f("testdata/consul.good.yaml")
 	f("testdata/dns.good.yaml")
 	f("testdata/static.good.yaml")
+	f("testdata/receivers.good.yaml")
 }
 
 func TestParseConfig_Failure(t *testing.T) {
@@ -35,4 +36,6 @@ func TestParseConfig_Failure(t *testing.T) {
 
 	f("testdata/unknownFields.bad.yaml", "unknown field")
 	f("non-existing-file", "error reading")
+	f("testdata/receivers.bad.yaml", "missing `routing_key`")
+	f("testdata/receiversTemplate.bad.yaml", "error parsing template")
 }
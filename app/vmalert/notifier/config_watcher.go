@@ -155,25 +155,37 @@ func getTargetMetadata(labelsFn getLabels, cfg *Config) (map[string]*promutil.La
 type getLabels func() ([]*promutil.Labels, error)
 
 func (cw *configWatcher) start() error {
-	if len(cw.cfg.StaticConfigs) > 0 {
-		var targets []Target
-		for _, cfg := range cw.cfg.StaticConfigs {
-			httpCfg := mergeHTTPClientConfigs(cw.cfg.HTTPClientConfig, cfg.HTTPClientConfig)
-			for _, target := range cfg.Targets {
-				address, labels, err := parseLabels(target, nil, cw.cfg)
-				if err != nil {
-					return fmt.Errorf("failed to parse labels for target %q: %w", target, err)
-				}
-				notifier, err := NewAlertManager(address, cw.genFn, httpCfg, cw.cfg.parsedAlertRelabelConfigs, cw.cfg.Timeout.Duration())
-				if err != nil {
-					return fmt.Errorf("failed to init alertmanager for addr %q: %w", address, err)
-				}
-				targets = append(targets, Target{
-					Notifier: notifier,
-					Labels:   labels,
-				})
+	var targets []Target
+	for _, cfg := range cw.cfg.StaticConfigs {
+		httpCfg := mergeHTTPClientConfigs(cw.cfg.HTTPClientConfig, cfg.HTTPClientConfig)
+		for _, target := range cfg.Targets {
+			address, labels, err := parseLabels(target, nil, cw.cfg)
+			if err != nil {
+				return fmt.Errorf("failed to parse labels for target %q: %w", target, err)
 			}
+			notifier, err := NewAlertManager(address, cw.genFn, httpCfg, cw.cfg.parsedAlertRelabelConfigs, cw.cfg.Timeout.Duration())
+			if err != nil {
+				return fmt.Errorf("failed to init alertmanager for addr %q: %w", address, err)
+			}
+			targets = append(targets, Target{
+				Notifier: notifier,
+				Labels:   labels,
+			})
 		}
+	}
+	receivers, err := cw.newReceivers()
+	if err != nil {
+		for _, t := range targets {
+			t.Close()
+		}
+		return err
+	}
+	for _, nt := range receivers {
+		targets = append(targets, Target{
+			Notifier: nt,
+		})
+	}
+	if len(targets) > 0 {
 		cw.setTargets(TargetStatic, targets)
 	}
 
@@ -215,6 +227,51 @@ func (cw *configWatcher) start() error {
 	return nil
 }
 
+// newReceivers returns notifiers for webhook_configs, slack_configs, pagerduty_configs and email_configs.
+func (cw *configWatcher) newReceivers() ([]Notifier, error) {
+	cfg := cw.cfg
+	relabelCfg := cfg.parsedAlertRelabelConfigs
+	timeout := cfg.Timeout.Duration()
+
+	var notifiers []Notifier
+	var newFns []func() (Notifier, error)
+	for i := range cfg.WebhookConfigs {
+		wc := &cfg.WebhookConfigs[i]
+		newFns = append(newFns, func() (Notifier, error) {
+			return newWebhookNotifier(wc, cw.genFn, relabelCfg, timeout)
+		})
+	}
+	for i := range cfg.SlackConfigs {
+		sc := &cfg.SlackConfigs[i]
+		newFns = append(newFns, func() (Notifier, error) {
+			return newSlackNotifier(sc, cw.genFn, relabelCfg, timeout)
+		})
+	}
+	for i := range cfg.PagerDutyConfigs {
+		pc := &cfg.PagerDutyConfigs[i]
+		newFns = append(newFns, func() (Notifier, error) {
+			return newPagerDutyNotifier(pc, cfg.baseDir, cw.genFn, relabelCfg, timeout)
+		})
+	}
+	for i := range cfg.EmailConfigs {
+		ec := &cfg.EmailConfigs[i]
+		newFns = append(newFns, func() (Notifier, error) {
+			return newEmailNotifier(ec, cfg.baseDir, cw.genFn, relabelCfg, timeout)
+		})
+	}
+	for _, newFn := range newFns {
+		nt, err := newFn()
+		if err != nil {
+			for _, nt := range notifiers {
+				nt.Close()
+			}
+			return nil, fmt.Errorf("failed to init notifier: %w", err)
+		}
+		notifiers = append(notifiers, nt)
+	}
+	return notifiers, nil
+}
+
 func (cw *configWatcher) mustStop() {
 	close(cw.syncCh)
 	cw.wg.Wait()
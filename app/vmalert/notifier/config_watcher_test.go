@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -112,6 +113,50 @@ consul_sd_configs:
 	}
 }
 
+func TestConfigWatcherStartReceivers(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.MustRemovePath(f.Name())
+
+	writeToFile(f.Name(), `
+static_configs:
+  - targets:
+      - localhost:9093
+webhook_configs:
+  - url: http://localhost:8080/alerts
+slack_configs:
+  - url: https://hooks.slack.com/services/T000/B000/XXXX
+pagerduty_configs:
+  - routing_key: foo
+email_configs:
+  - smarthost: localhost:587
+    from: vmalert@example.com
+    to: [oncall@example.com]
+`)
+	cw, err := newWatcher(f.Name(), nil)
+	if err != nil {
+		t.Fatalf("failed to start config watcher: %s", err)
+	}
+	defer cw.mustStop()
+
+	var addrs []string
+	for _, n := range cw.notifiers() {
+		addrs = append(addrs, n.Addr())
+	}
+	expAddrs := []string{
+		"http://localhost:8080/alerts",
+		"http://localhost:9093/api/v2/alerts",
+		"https://events.pagerduty.com/v2/enqueue",
+		"https://hooks.slack.com/<hidden>",
+		"smtp://localhost:587/oncall@example.com",
+	}
+	if !reflect.DeepEqual(addrs, expAddrs) {
+		t.Fatalf("unexpected notifier addresses\ngot\n%q\nwant\n%q", addrs, expAddrs)
+	}
+}
+
 // TestConfigWatcherReloadConcurrent supposed to test concurrent
 // execution of configuration update.
 // Should be executed with -race flag
@@ -0,0 +1,292 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/vmalertutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+const (
+	defaultEmailSubject = `[{{ $status | toUpper }}] {{ $labels.alertname }}`
+	defaultEmailBody    = `Alert {{ $labels.alertname }} is {{ $status }}.
+{{ range $k, $v := $annotations }}
+{{ $k }}: {{ $v }}{{ end }}
+
+Labels:
+{{ range $k, $v := $labels }}  {{ $k }}={{ $v }}
+{{ end }}
+Source: {{ .GeneratorURL }}
+`
+)
+
+// EmailConfig contains settings for sending alerts via SMTP.
+type EmailConfig struct {
+	// Smarthost is the SMTP server address in the host:port form.
+	// Implicit TLS is used for port 465, while STARTTLS is used for other ports if the server supports it.
+	Smarthost string `yaml:"smarthost"`
+	// From is the sender address
+	From string `yaml:"from"`
+	// To is the list of recipient addresses
+	To []string `yaml:"to"`
+	// Hello is the hostname to send in the HELO command. By default, localhost is used
+	Hello string `yaml:"hello,omitempty"`
+	// AuthUsername is the username for SMTP PLAIN authentication
+	AuthUsername string `yaml:"auth_username,omitempty"`
+	// AuthPassword is the password for SMTP PLAIN authentication
+	AuthPassword *promauth.Secret `yaml:"auth_password,omitempty"`
+	// AuthPasswordFile is the path to file with the password for SMTP PLAIN authentication
+	AuthPasswordFile string `yaml:"auth_password_file,omitempty"`
+	// RequireTLS defines whether to fail if the server doesn't support STARTTLS. True by default
+	RequireTLS *bool `yaml:"require_tls,omitempty"`
+	// TLSConfig contains TLS configuration for connections to Smarthost
+	TLSConfig *promauth.TLSConfig `yaml:"tls_config,omitempty"`
+	// Subject is a template for the email subject
+	Subject string `yaml:"subject,omitempty"`
+	// Body is a template for the plain text email body
+	Body string `yaml:"body,omitempty"`
+
+	subject *notificationTemplate
+	body    *notificationTemplate
+}
+
+func (ec *EmailConfig) validate() error {
+	if ec.Smarthost == "" {
+		return fmt.Errorf("missing `smarthost`")
+	}
+	if _, _, err := net.SplitHostPort(ec.Smarthost); err != nil {
+		return fmt.Errorf("invalid `smarthost` %q; it must have host:port form: %w", ec.Smarthost, err)
+	}
+	if ec.From == "" {
+		return fmt.Errorf("missing `from`")
+	}
+	if len(ec.To) == 0 {
+		return fmt.Errorf("missing `to`")
+	}
+	if ec.AuthPassword != nil && ec.AuthPasswordFile != "" {
+		return fmt.Errorf("only one of `auth_password` or `auth_password_file` must be set")
+	}
+	var err error
+	if ec.subject, err = newNotificationTemplateWithDefault(ec.Subject, defaultEmailSubject); err != nil {
+		return fmt.Errorf("invalid `subject`: %w", err)
+	}
+	if ec.body, err = newNotificationTemplateWithDefault(ec.Body, defaultEmailBody); err != nil {
+		return fmt.Errorf("invalid `body`: %w", err)
+	}
+	return nil
+}
+
+// emailNotifier sends every alert in a separate email.
+type emailNotifier struct {
+	cfg     *EmailConfig
+	argFunc AlertURLGenerator
+	timeout time.Duration
+
+	host        string
+	implicitTLS bool
+	requireTLS  bool
+	tlsCfg      *tls.Config
+	password    string
+
+	// stores already parsed AlertRelabelConfigs object
+	relabelConfigs *promrelabel.ParsedConfigs
+
+	metrics *notifierMetrics
+}
+
+// newEmailNotifier returns a Notifier, which sends alerts via SMTP according to ec.
+//
+// ec must be validated before the call.
+func newEmailNotifier(ec *EmailConfig, baseDir string, gen AlertURLGenerator, relabelCfg *promrelabel.ParsedConfigs, timeout time.Duration) (Notifier, error) {
+	host, port, err := net.SplitHostPort(ec.Smarthost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `smarthost` %q: %w", ec.Smarthost, err)
+	}
+	hcc := &promauth.HTTPClientConfig{
+		TLSConfig: ec.TLSConfig,
+	}
+	ac, err := hcc.NewConfig(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize TLS config: %w", err)
+	}
+	tlsCfg, err := ac.GetTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize TLS config: %w", err)
+	}
+	tlsCfg = tlsCfg.Clone()
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = host
+	}
+	password := ec.AuthPassword.String()
+	if ec.AuthPasswordFile != "" {
+		path := fscore.GetFilepath(baseDir, ec.AuthPasswordFile)
+		password, err = fscore.ReadPasswordFromFileOrHTTP(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read `auth_password_file`: %w", err)
+		}
+	}
+	en := &emailNotifier{
+		cfg:            ec,
+		argFunc:        gen,
+		timeout:        timeout,
+		host:           host,
+		implicitTLS:    port == "465",
+		requireTLS:     ec.RequireTLS == nil || *ec.RequireTLS,
+		tlsCfg:         tlsCfg,
+		password:       password,
+		relabelConfigs: relabelCfg,
+	}
+	en.metrics = newNotifierMetrics(en.Addr())
+	return en, nil
+}
+
+// Addr returns address where alerts are sent.
+func (en *emailNotifier) Addr() string {
+	return fmt.Sprintf("smtp://%s/%s", en.cfg.Smarthost, strings.Join(en.cfg.To, ","))
+}
+
+// Close is a destructor method for emailNotifier
+func (en *emailNotifier) Close() {
+	en.metrics.close()
+}
+
+// Send sends every alert in a separate email.
+//
+// notifierHeaders are ignored, since they are applicable to HTTP-based notifiers only.
+func (en *emailNotifier) Send(ctx context.Context, alerts []Alert, _ map[string]string) error {
+	en.metrics.alertsSent.Add(len(alerts))
+	startTime := time.Now()
+	errs := 0
+	eg := new(vmalertutil.ErrGroup)
+	for _, a := range alerts {
+		labels := alertLabelsAfterRelabeling(a, en.relabelConfigs)
+		if labels == nil {
+			continue
+		}
+		if err := en.send(ctx, newNotificationTplData(a, labels, en.argFunc)); err != nil {
+			errs++
+			eg.Add(fmt.Errorf("alert %q: %w", a.Name, err))
+		}
+	}
+	en.metrics.alertsSendDuration.UpdateDuration(startTime)
+	en.metrics.alertsSendErrors.Add(errs)
+	return eg.Err()
+}
+
+func (en *emailNotifier) send(ctx context.Context, data *notificationTplData) error {
+	msg, err := en.buildMessage(data, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if en.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, en.timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", en.cfg.Smarthost)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %q: %w", en.cfg.Smarthost, err)
+	}
+	// Unblock SMTP client if ctx is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+	if en.implicitTLS {
+		conn = tls.Client(conn, en.tlsCfg)
+	}
+
+	c, err := smtp.NewClient(conn, en.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot create SMTP client for %q: %w", en.cfg.Smarthost, err)
+	}
+	defer func() { _ = c.Close() }()
+
+	hello := en.cfg.Hello
+	if hello == "" {
+		hello = "localhost"
+	}
+	if err := c.Hello(hello); err != nil {
+		return fmt.Errorf("HELO error: %w", err)
+	}
+	if !en.implicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(en.tlsCfg); err != nil {
+				return fmt.Errorf("STARTTLS error: %w", err)
+			}
+		} else if en.requireTLS {
+			return fmt.Errorf("%q doesn't support STARTTLS; set `require_tls: false` in order to send emails without TLS", en.cfg.Smarthost)
+		}
+	}
+	if en.cfg.AuthUsername != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("%q doesn't support AUTH, while `auth_username` is set", en.cfg.Smarthost)
+		}
+		if err := c.Auth(smtp.PlainAuth("", en.cfg.AuthUsername, en.password, en.host)); err != nil {
+			return fmt.Errorf("AUTH error: %w", err)
+		}
+	}
+	if err := c.Mail(en.cfg.From); err != nil {
+		return fmt.Errorf("MAIL FROM error: %w", err)
+	}
+	for _, to := range en.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("RCPT TO %q error: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA error: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("cannot write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("cannot send message: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage returns email message for the given data.
+func (en *emailNotifier) buildMessage(data *notificationTplData, now time.Time) ([]byte, error) {
+	subject, err := en.cfg.subject.exec(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate subject: %w", err)
+	}
+	body, err := en.cfg.body.exec(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate body: %w", err)
+	}
+
+	var bb bytes.Buffer
+	fmt.Fprintf(&bb, "From: %s\r\n", en.cfg.From)
+	fmt.Fprintf(&bb, "To: %s\r\n", strings.Join(en.cfg.To, ", "))
+	fmt.Fprintf(&bb, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	fmt.Fprintf(&bb, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	bb.WriteString("MIME-Version: 1.0\r\n")
+	bb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	bb.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	bb.WriteString("\r\n")
+	qw := quotedprintable.NewWriter(&bb)
+	if _, err := qw.Write([]byte(body)); err != nil {
+		return nil, fmt.Errorf("cannot encode body: %w", err)
+	}
+	if err := qw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot encode body: %w", err)
+	}
+	return bb.Bytes(), nil
+}
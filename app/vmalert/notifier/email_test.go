@@ -0,0 +1,183 @@
+package notifier
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmailNotifier_BuildMessage(t *testing.T) {
+	ec := &EmailConfig{
+		Smarthost: "localhost:25",
+		From:      "vmalert@example.com",
+		To:        []string{"foo@example.com", "bar@example.com"},
+		Body:      `{{ $labels.alertname }} is {{ $status }}: {{ $annotations.summary }}`,
+	}
+	if err := ec.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nt, err := newEmailNotifier(ec, "", nil, nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer nt.Close()
+
+	data := newNotificationTplData(Alert{
+		State:       StateFiring,
+		Annotations: map[string]string{"summary": "значение=42"},
+	}, map[string]string{"alertname": "foo"}, nil)
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg, err := nt.(*emailNotifier).buildMessage(data, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	msgExpected := "From: vmalert@example.com\r\n" +
+		"To: foo@example.com, bar@example.com\r\n" +
+		"Subject: [FIRING] foo\r\n" +
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"foo is firing: =D0=B7=D0=BD=D0=B0=D1=87=D0=B5=D0=BD=D0=B8=D0=B5=3D42"
+	if string(msg) != msgExpected {
+		t.Fatalf("unexpected message\ngot\n%q\nwant\n%q", msg, msgExpected)
+	}
+}
+
+func TestEmailNotifier_Send(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start listener: %s", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	var wg sync.WaitGroup
+	var commands []string
+	var data string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		tc := textproto.NewConn(conn)
+		_ = tc.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			commands = append(commands, line)
+			switch cmd {
+			case "EHLO":
+				_ = tc.PrintfLine("250 localhost")
+			case "DATA":
+				_ = tc.PrintfLine("354 go ahead")
+				lines, err := tc.ReadDotLines()
+				if err != nil {
+					return
+				}
+				data = strings.Join(lines, "\n")
+				_ = tc.PrintfLine("250 ok")
+			case "QUIT":
+				_ = tc.PrintfLine("221 bye")
+				return
+			default:
+				_ = tc.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	requireTLS := false
+	ec := &EmailConfig{
+		Smarthost:  ln.Addr().String(),
+		From:       "vmalert@example.com",
+		To:         []string{"foo@example.com"},
+		RequireTLS: &requireTLS,
+		Subject:    "{{ $labels.alertname }}",
+		Body:       "{{ $annotations.summary }}",
+	}
+	if err := ec.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nt, err := newEmailNotifier(ec, "", nil, nil, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer nt.Close()
+	err = nt.Send(context.Background(), []Alert{{
+		State:       StateFiring,
+		Labels:      map[string]string{"alertname": "foo"},
+		Annotations: map[string]string{"summary": "bar"},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	wg.Wait()
+
+	commandsExpected := []string{
+		"EHLO localhost",
+		"MAIL FROM:<vmalert@example.com>",
+		"RCPT TO:<foo@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	if strings.Join(commands, "\n") != strings.Join(commandsExpected, "\n") {
+		t.Fatalf("unexpected SMTP commands\ngot\n%q\nwant\n%q", commands, commandsExpected)
+	}
+	if !strings.Contains(data, "Subject: foo\n") || !strings.HasSuffix(data, "\nbar") {
+		t.Fatalf("unexpected message:\n%s", data)
+	}
+}
+
+func TestEmailNotifier_SendRequireTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start listener: %s", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		tc := textproto.NewConn(conn)
+		_ = tc.PrintfLine("220 localhost ESMTP")
+		for {
+			if _, err := tc.ReadLine(); err != nil {
+				return
+			}
+			_ = tc.PrintfLine("250 localhost")
+		}
+	}()
+
+	ec := &EmailConfig{
+		Smarthost: ln.Addr().String(),
+		From:      "vmalert@example.com",
+		To:        []string{"foo@example.com"},
+	}
+	if err := ec.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nt, err := newEmailNotifier(ec, "", nil, nil, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer nt.Close()
+	err = nt.Send(context.Background(), []Alert{{
+		Labels: map[string]string{"alertname": "foo"},
+	}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expecting STARTTLS error; got %v", err)
+	}
+}
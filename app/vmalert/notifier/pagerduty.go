@@ -0,0 +1,153 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+const (
+	defaultPagerDutyURL      = "https://events.pagerduty.com/v2/enqueue"
+	defaultPagerDutySummary  = `{{ $labels.alertname }}{{ if $annotations.summary }}: {{ $annotations.summary }}{{ end }}`
+	defaultPagerDutySeverity = `{{ if $labels.severity }}{{ $labels.severity }}{{ else }}error{{ end }}`
+	defaultPagerDutySource   = `vmalert`
+
+	// maxPagerDutySummaryLen is the max length of the summary field accepted by PagerDuty Events API v2
+	maxPagerDutySummaryLen = 1024
+)
+
+// PagerDutyConfig contains settings for sending alerts to PagerDuty Events API v2.
+//
+// See https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+type PagerDutyConfig struct {
+	// URL is the Events API v2 address. By default, https://events.pagerduty.com/v2/enqueue is used
+	URL string `yaml:"url,omitempty"`
+	// RoutingKey is the integration key for the PagerDuty service
+	RoutingKey string `yaml:"routing_key,omitempty"`
+	// RoutingKeyFile is the path to file with the integration key for the PagerDuty service
+	RoutingKeyFile string `yaml:"routing_key_file,omitempty"`
+	// Summary is a template for the event summary
+	Summary string `yaml:"summary,omitempty"`
+	// Severity is a template for the event severity.
+	// It must be evaluated into one of critical, error, warning or info.
+	Severity string `yaml:"severity,omitempty"`
+	// Source is a template for the event source
+	Source string `yaml:"source,omitempty"`
+	// HTTPClientConfig contains HTTP configuration for the Events API
+	HTTPClientConfig promauth.HTTPClientConfig `yaml:",inline"`
+
+	summary  *notificationTemplate
+	severity *notificationTemplate
+	source   *notificationTemplate
+}
+
+func (pc *PagerDutyConfig) validate() error {
+	if pc.RoutingKey == "" && pc.RoutingKeyFile == "" {
+		return fmt.Errorf("missing `routing_key` or `routing_key_file`")
+	}
+	if pc.RoutingKey != "" && pc.RoutingKeyFile != "" {
+		return fmt.Errorf("only one of `routing_key` or `routing_key_file` must be set")
+	}
+	if pc.URL == "" {
+		pc.URL = defaultPagerDutyURL
+	}
+	var err error
+	if pc.summary, err = newNotificationTemplateWithDefault(pc.Summary, defaultPagerDutySummary); err != nil {
+		return fmt.Errorf("invalid `summary`: %w", err)
+	}
+	if pc.severity, err = newNotificationTemplateWithDefault(pc.Severity, defaultPagerDutySeverity); err != nil {
+		return fmt.Errorf("invalid `severity`: %w", err)
+	}
+	if pc.source, err = newNotificationTemplateWithDefault(pc.Source, defaultPagerDutySource); err != nil {
+		return fmt.Errorf("invalid `source`: %w", err)
+	}
+	return nil
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	ClientURL   string            `json:"client_url,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// newPagerDutyNotifier returns a Notifier, which sends alerts to PagerDuty according to pc.
+//
+// Firing alerts trigger PagerDuty incidents, while resolved alerts resolve them.
+// pc must be validated before the call.
+func newPagerDutyNotifier(pc *PagerDutyConfig, baseDir string, gen AlertURLGenerator, relabelCfg *promrelabel.ParsedConfigs, timeout time.Duration) (Notifier, error) {
+	routingKey := pc.RoutingKey
+	if pc.RoutingKeyFile != "" {
+		path := fscore.GetFilepath(baseDir, pc.RoutingKeyFile)
+		key, err := fscore.ReadPasswordFromFileOrHTTP(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read `routing_key_file`: %w", err)
+		}
+		routingKey = key
+	}
+	bodyFn := func(data *notificationTplData) ([]byte, error) {
+		event := &pagerDutyEvent{
+			RoutingKey:  routingKey,
+			EventAction: "trigger",
+			DedupKey:    fmt.Sprintf("%d-%d", data.GroupID, data.AlertID),
+			ClientURL:   data.GeneratorURL,
+		}
+		if data.Status == "resolved" {
+			event.EventAction = "resolve"
+			return json.Marshal(event)
+		}
+		summary, err := pc.summary.exec(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate summary: %w", err)
+		}
+		if len(summary) > maxPagerDutySummaryLen {
+			summary = summary[:maxPagerDutySummaryLen]
+		}
+		severity, err := pc.severity.exec(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate severity: %w", err)
+		}
+		switch severity {
+		case "critical", "error", "warning", "info":
+		default:
+			// PagerDuty rejects events with unknown severity, so fall back to the default one
+			// in order to deliver the alert.
+			severity = "error"
+		}
+		source, err := pc.source.exec(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate source: %w", err)
+		}
+		details := make(map[string]string, len(data.Labels)+len(data.Annotations))
+		for k, v := range data.Labels {
+			details[k] = v
+		}
+		for k, v := range data.Annotations {
+			details[k] = v
+		}
+		event.Payload = &pagerDutyPayload{
+			Summary:       summary,
+			Source:        source,
+			Severity:      severity,
+			CustomDetails: details,
+		}
+		if !data.StartsAt.IsZero() {
+			event.Payload.Timestamp = data.StartsAt.Format(time.RFC3339)
+		}
+		return json.Marshal(event)
+	}
+	return newHTTPReceiver("pagerduty", pc.URL, gen, pc.HTTPClientConfig, relabelCfg, timeout, false, bodyFn)
+}
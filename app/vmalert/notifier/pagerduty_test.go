@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPagerDutyNotifier_Send(t *testing.T) {
+	var events []pagerDutyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Fatalf("cannot unmarshal pagerduty event: %s", err)
+		}
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	f := func(pc *PagerDutyConfig, alert Alert, eventExpected pagerDutyEvent) {
+		t.Helper()
+
+		events = events[:0]
+		pc.URL = srv.URL
+		if err := pc.validate(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		nt, err := newPagerDutyNotifier(pc, "", func(_ Alert) string {
+			return "http://vmalert/alert"
+		}, nil, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer nt.Close()
+		if err := nt.Send(context.Background(), []Alert{alert}, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event; got %d", len(events))
+		}
+		if !reflect.DeepEqual(events[0], eventExpected) {
+			t.Fatalf("unexpected event\ngot\n%#v\nwant\n%#v", events[0], eventExpected)
+		}
+	}
+
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// firing alert with default templates
+	f(&PagerDutyConfig{
+		RoutingKey: "foo",
+	}, Alert{
+		GroupID:     1,
+		ID:          2,
+		State:       StateFiring,
+		Start:       ts,
+		Labels:      map[string]string{"alertname": "foo", "severity": "warning"},
+		Annotations: map[string]string{"summary": "bar"},
+	}, pagerDutyEvent{
+		RoutingKey:  "foo",
+		EventAction: "trigger",
+		DedupKey:    "1-2",
+		ClientURL:   "http://vmalert/alert",
+		Payload: &pagerDutyPayload{
+			Summary:   "foo: bar",
+			Source:    "vmalert",
+			Severity:  "warning",
+			Timestamp: "2025-01-02T03:04:05Z",
+			CustomDetails: map[string]string{
+				"alertname": "foo",
+				"severity":  "warning",
+				"summary":   "bar",
+			},
+		},
+	})
+
+	// unknown severity falls back to error
+	f(&PagerDutyConfig{
+		RoutingKey: "foo",
+		Severity:   "{{ $labels.priority }}",
+		Source:     "{{ $labels.instance }}",
+	}, Alert{
+		GroupID: 1,
+		ID:      2,
+		State:   StateFiring,
+		Labels:  map[string]string{"alertname": "foo", "priority": "P1", "instance": "host1"},
+	}, pagerDutyEvent{
+		RoutingKey:  "foo",
+		EventAction: "trigger",
+		DedupKey:    "1-2",
+		ClientURL:   "http://vmalert/alert",
+		Payload: &pagerDutyPayload{
+			Summary:  "foo",
+			Source:   "host1",
+			Severity: "error",
+			CustomDetails: map[string]string{
+				"alertname": "foo",
+				"priority":  "P1",
+				"instance":  "host1",
+			},
+		},
+	})
+
+	// resolved alert with routing key from file
+	keyFile := filepath.Join(t.TempDir(), "routing_key")
+	if err := os.WriteFile(keyFile, []byte("bar\n"), 0o600); err != nil {
+		t.Fatalf("cannot write routing key file: %s", err)
+	}
+	f(&PagerDutyConfig{
+		RoutingKeyFile: keyFile,
+	}, Alert{
+		GroupID: 1,
+		ID:      2,
+		State:   StateInactive,
+		Labels:  map[string]string{"alertname": "foo"},
+	}, pagerDutyEvent{
+		RoutingKey:  "bar",
+		EventAction: "resolve",
+		DedupKey:    "1-2",
+		ClientURL:   "http://vmalert/alert",
+	})
+}
@@ -0,0 +1,313 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	textTpl "text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/templates"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/vmalertutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+// notificationTplData is used for executing notification templates
+// for webhook, Slack, PagerDuty and email notifiers.
+type notificationTplData struct {
+	tplData
+	// Status is either `firing` or `resolved`
+	Status string
+	// Annotations contains already templated alert annotations
+	Annotations map[string]string
+	// StartsAt is the moment when alert has become firing
+	StartsAt time.Time
+	// EndsAt is the moment when alert is supposed to expire or has been resolved
+	EndsAt time.Time
+	// GeneratorURL is the link to the alert source
+	GeneratorURL string
+}
+
+var notificationTplHeaders = append(append([]string{}, tplHeaders...),
+	"{{ $status := .Status }}",
+	"{{ $annotations := .Annotations }}",
+)
+
+// newNotificationTplData returns template data for the given alert.
+//
+// labels must contain alert labels after applying alert_relabel_configs.
+func newNotificationTplData(a Alert, labels map[string]string, gen AlertURLGenerator) *notificationTplData {
+	status := "firing"
+	if a.State != StateFiring {
+		status = "resolved"
+	}
+	var generatorURL string
+	if gen != nil {
+		generatorURL = gen(a)
+	}
+	return &notificationTplData{
+		tplData: tplData{
+			AlertTplData: AlertTplData{
+				Type:     a.Type,
+				Labels:   labels,
+				Value:    a.Value,
+				Expr:     a.Expr,
+				AlertID:  a.ID,
+				GroupID:  a.GroupID,
+				ActiveAt: a.ActiveAt,
+				For:      a.For,
+			},
+			ExternalLabels: externalLabels,
+			ExternalURL:    externalURL,
+		},
+		Status:       status,
+		Annotations:  a.Annotations,
+		StartsAt:     a.Start,
+		EndsAt:       a.End,
+		GeneratorURL: generatorURL,
+	}
+}
+
+// notificationTemplate is a text template for rendering notifications.
+//
+// It supports the same functions and variables as annotation templates
+// plus $status and $annotations variables.
+type notificationTemplate struct {
+	text string
+
+	// tmpl is the parsed template for text.
+	//
+	// It is nil if text doesn't contain template actions.
+	tmpl *textTpl.Template
+}
+
+// newNotificationTemplate parses the given template text and returns notificationTemplate for it.
+func newNotificationTemplate(text string) (*notificationTemplate, error) {
+	nt := &notificationTemplate{
+		text: text,
+	}
+	if !strings.Contains(text, "{{") {
+		return nt, nil
+	}
+	tmpl, err := templates.GetWithFuncs(templates.FuncsWithQuery(nil))
+	if err != nil {
+		return nil, fmt.Errorf("error cloning template: %w", err)
+	}
+	tmpl, err = tmpl.Parse(strings.Join(notificationTplHeaders, "") + text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template %q: %w", text, err)
+	}
+	nt.tmpl = tmpl
+	return nt, nil
+}
+
+// newNotificationTemplateWithDefault returns notificationTemplate for the given text or for defaultText if text is empty.
+func newNotificationTemplateWithDefault(text, defaultText string) (*notificationTemplate, error) {
+	if text == "" {
+		text = defaultText
+	}
+	return newNotificationTemplate(text)
+}
+
+// exec executes nt for the given data.
+//
+// It is safe calling exec from concurrently running goroutines.
+func (nt *notificationTemplate) exec(data *notificationTplData) (string, error) {
+	if nt.tmpl == nil {
+		return nt.text, nil
+	}
+	var bb bytes.Buffer
+	if err := nt.tmpl.Execute(&bb, data); err != nil {
+		return "", fmt.Errorf("error evaluating template %q: %w", nt.text, err)
+	}
+	return bb.String(), nil
+}
+
+// httpReceiver sends every alert in a separate HTTP POST request
+// with the body generated by bodyFn.
+//
+// If batchBodyFn is set, then all the alerts passed to Send are sent in a single HTTP POST request
+// with the body generated by batchBodyFn.
+//
+// It is used as a base for webhook, Slack and PagerDuty notifiers.
+type httpReceiver struct {
+	addr    *url.URL
+	argFunc AlertURLGenerator
+	client  *http.Client
+	timeout time.Duration
+
+	authCfg *promauth.Config
+	// stores already parsed AlertRelabelConfigs object
+	relabelConfigs *promrelabel.ParsedConfigs
+
+	// hideURLPath defines whether to hide URL path in Addr() output,
+	// since it may contain secrets such as Slack webhook token.
+	hideURLPath bool
+
+	// bodyFn must return the request body for the given notification data.
+	bodyFn func(data *notificationTplData) ([]byte, error)
+
+	// batchBodyFn must return the request body for the given notifications data.
+	batchBodyFn func(data []*notificationTplData) ([]byte, error)
+
+	metrics *notifierMetrics
+}
+
+func newHTTPReceiver(kind, rawURL string, gen AlertURLGenerator, authCfg promauth.HTTPClientConfig,
+	relabelCfg *promrelabel.ParsedConfigs, timeout time.Duration, hideURLPath bool,
+	bodyFn func(data *notificationTplData) ([]byte, error),
+) (*httpReceiver, error) {
+	if err := httputil.CheckURL(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid %s URL: %w", kind, err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("provided incorrect %s url: %w", kind, err)
+	}
+	client, aCfg, err := newHTTPClient(authCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client for %s notifier: %w", kind, err)
+	}
+	hr := &httpReceiver{
+		addr:           u,
+		argFunc:        gen,
+		client:         client,
+		timeout:        timeout,
+		authCfg:        aCfg,
+		relabelConfigs: relabelCfg,
+		hideURLPath:    hideURLPath,
+		bodyFn:         bodyFn,
+	}
+	hr.metrics = newNotifierMetrics(hr.Addr())
+	return hr, nil
+}
+
+// Addr returns address where alerts are sent.
+func (hr *httpReceiver) Addr() string {
+	if *showNotifierURL {
+		return hr.addr.String()
+	}
+	if hr.hideURLPath {
+		return fmt.Sprintf("%s://%s/<hidden>", hr.addr.Scheme, hr.addr.Host)
+	}
+	return hr.addr.Redacted()
+}
+
+// Close is a destructor method for httpReceiver
+func (hr *httpReceiver) Close() {
+	hr.metrics.close()
+}
+
+// Send sends every alert in a separate request or all the alerts in a single request if hr.batchBodyFn is set.
+func (hr *httpReceiver) Send(ctx context.Context, alerts []Alert, headers map[string]string) error {
+	hr.metrics.alertsSent.Add(len(alerts))
+	startTime := time.Now()
+	defer hr.metrics.alertsSendDuration.UpdateDuration(startTime)
+
+	if hr.batchBodyFn != nil {
+		return hr.sendBatch(ctx, alerts, headers)
+	}
+
+	errs := 0
+	eg := new(vmalertutil.ErrGroup)
+	for _, a := range alerts {
+		labels := alertLabelsAfterRelabeling(a, hr.relabelConfigs)
+		if labels == nil {
+			continue
+		}
+		body, err := hr.bodyFn(newNotificationTplData(a, labels, hr.argFunc))
+		if err == nil {
+			err = hr.send(ctx, body, headers)
+		}
+		if err != nil {
+			errs++
+			eg.Add(fmt.Errorf("alert %q: %w", a.Name, err))
+		}
+	}
+	hr.metrics.alertsSendErrors.Add(errs)
+	return eg.Err()
+}
+
+func (hr *httpReceiver) sendBatch(ctx context.Context, alerts []Alert, headers map[string]string) error {
+	data := make([]*notificationTplData, 0, len(alerts))
+	for _, a := range alerts {
+		labels := alertLabelsAfterRelabeling(a, hr.relabelConfigs)
+		if labels == nil {
+			continue
+		}
+		data = append(data, newNotificationTplData(a, labels, hr.argFunc))
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	body, err := hr.batchBodyFn(data)
+	if err == nil {
+		err = hr.send(ctx, body, headers)
+	}
+	if err != nil {
+		hr.metrics.alertsSendErrors.Add(len(data))
+		return fmt.Errorf("failed to send %d alerts: %w", len(data), err)
+	}
+	return nil
+}
+
+func (hr *httpReceiver) send(ctx context.Context, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, hr.addr.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if hr.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hr.timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
+	if hr.authCfg != nil {
+		if err := hr.authCfg.SetHeaders(req, true); err != nil {
+			return err
+		}
+	}
+	// external headers have higher priority
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := hr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response from %q: %w", hr.Addr(), err)
+		}
+		return fmt.Errorf("invalid SC %d from %q; response body: %s", resp.StatusCode, hr.Addr(), string(body))
+	}
+	return nil
+}
+
+// alertLabelsAfterRelabeling returns alert labels after applying relabelCfg.
+//
+// nil is returned if the alert has been dropped during relabeling.
+func alertLabelsAfterRelabeling(a Alert, relabelCfg *promrelabel.ParsedConfigs) map[string]string {
+	lbls := a.applyRelabelingIfNeeded(relabelCfg)
+	if len(lbls) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(lbls))
+	for _, l := range lbls {
+		labels[l.Name] = l.Value
+	}
+	return labels
+}
@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+const defaultSlackText = `[{{ $status | toUpper }}] {{ $labels.alertname }}` +
+	`{{ if $annotations.summary }}: {{ $annotations.summary }}{{ end }}` +
+	`{{ if $annotations.description }}{{ "\n" }}{{ $annotations.description }}{{ end }}`
+
+// SlackConfig contains settings for sending alerts to Slack-compatible incoming webhooks.
+//
+// See https://api.slack.com/messaging/webhooks
+type SlackConfig struct {
+	// URL is the incoming webhook address.
+	// It contains secret token, so it is hidden in logs and UI unless -notifier.showURL is set
+	URL string `yaml:"url"`
+	// Channel overrides the default channel of the incoming webhook
+	Channel string `yaml:"channel,omitempty"`
+	// Username overrides the default username of the incoming webhook
+	Username string `yaml:"username,omitempty"`
+	// IconEmoji overrides the default icon of the incoming webhook
+	IconEmoji string `yaml:"icon_emoji,omitempty"`
+	// Text is a template for the message text
+	Text string `yaml:"text,omitempty"`
+	// HTTPClientConfig contains HTTP configuration for the incoming webhook
+	HTTPClientConfig promauth.HTTPClientConfig `yaml:",inline"`
+
+	text *notificationTemplate
+}
+
+func (sc *SlackConfig) validate() error {
+	if sc.URL == "" {
+		return fmt.Errorf("missing `url`")
+	}
+	var err error
+	if sc.text, err = newNotificationTemplateWithDefault(sc.Text, defaultSlackText); err != nil {
+		return fmt.Errorf("invalid `text`: %w", err)
+	}
+	return nil
+}
+
+type slackMessage struct {
+	Channel   string `json:"channel,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IconEmoji string `json:"icon_emoji,omitempty"`
+	Text      string `json:"text"`
+}
+
+// newSlackNotifier returns a Notifier, which sends alerts to Slack-compatible incoming webhook according to sc.
+//
+// sc must be validated before the call.
+func newSlackNotifier(sc *SlackConfig, gen AlertURLGenerator, relabelCfg *promrelabel.ParsedConfigs, timeout time.Duration) (Notifier, error) {
+	bodyFn := func(data *notificationTplData) ([]byte, error) {
+		text, err := sc.text.exec(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate message text: %w", err)
+		}
+		return json.Marshal(&slackMessage{
+			Channel:   sc.Channel,
+			Username:  sc.Username,
+			IconEmoji: sc.IconEmoji,
+			Text:      text,
+		})
+	}
+	// Incoming webhook URL contains secret token in the path, so hide it.
+	return newHTTPReceiver("slack", sc.URL, gen, sc.HTTPClientConfig, relabelCfg, timeout, true, bodyFn)
+}
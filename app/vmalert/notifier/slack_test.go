@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlackNotifier_Send(t *testing.T) {
+	var msgs []slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var msg slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatalf("cannot unmarshal slack message: %s", err)
+		}
+		msgs = append(msgs, msg)
+	}))
+	defer srv.Close()
+
+	f := func(text string, alert Alert, msgExpected slackMessage) {
+		t.Helper()
+
+		msgs = msgs[:0]
+		sc := &SlackConfig{
+			URL:     srv.URL + "/services/T000/B000/XXXX",
+			Channel: "#alerts",
+			Text:    text,
+		}
+		if err := sc.validate(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		nt, err := newSlackNotifier(sc, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer nt.Close()
+		if err := nt.Send(context.Background(), []Alert{alert}, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(msgs) != 1 {
+			t.Fatalf("expected 1 message; got %d", len(msgs))
+		}
+		if msgs[0] != msgExpected {
+			t.Fatalf("unexpected message\ngot\n%#v\nwant\n%#v", msgs[0], msgExpected)
+		}
+	}
+
+	// default text
+	f("", Alert{
+		State:       StateFiring,
+		Labels:      map[string]string{"alertname": "foo"},
+		Annotations: map[string]string{"summary": "bar", "description": "baz"},
+	}, slackMessage{
+		Channel: "#alerts",
+		Text:    "[FIRING] foo: bar\nbaz",
+	})
+	f("", Alert{
+		State:  StateInactive,
+		Labels: map[string]string{"alertname": "foo"},
+	}, slackMessage{
+		Channel: "#alerts",
+		Text:    "[RESOLVED] foo",
+	})
+
+	// custom text
+	f(`{{ $labels.instance }} value is {{ $value }}`, Alert{
+		State:  StateFiring,
+		Labels: map[string]string{"alertname": "foo", "instance": "localhost"},
+		Value:  42,
+	}, slackMessage{
+		Channel: "#alerts",
+		Text:    "localhost value is 42",
+	})
+}
+
+func TestSlackNotifier_Addr(t *testing.T) {
+	sc := &SlackConfig{
+		URL: "https://hooks.slack.com/services/T000/B000/XXXX",
+	}
+	if err := sc.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nt, err := newSlackNotifier(sc, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer nt.Close()
+	const addrExpected = "https://hooks.slack.com/<hidden>"
+	if nt.Addr() != addrExpected {
+		t.Fatalf("unexpected addr; got %q; want %q", nt.Addr(), addrExpected)
+	}
+}
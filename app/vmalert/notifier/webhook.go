@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+// WebhookConfig contains settings for sending alerts to a generic webhook.
+//
+// All the alerts passed to a single Send call are sent in a single HTTP POST request as JSON array.
+type WebhookConfig struct {
+	// URL is the webhook address
+	URL string `yaml:"url"`
+	// Body is a template for the JSON object per every alert in the request body.
+	// If empty, then every alert is sent in the same JSON format as a single alert is sent to Alertmanager.
+	Body string `yaml:"body,omitempty"`
+	// HTTPClientConfig contains HTTP configuration for the webhook
+	HTTPClientConfig promauth.HTTPClientConfig `yaml:",inline"`
+
+	body *notificationTemplate
+}
+
+func (wc *WebhookConfig) validate() error {
+	if wc.URL == "" {
+		return fmt.Errorf("missing `url`")
+	}
+	if wc.Body == "" {
+		return nil
+	}
+	body, err := newNotificationTemplate(wc.Body)
+	if err != nil {
+		return fmt.Errorf("invalid `body`: %w", err)
+	}
+	wc.body = body
+	return nil
+}
+
+// webhookAlert is the default JSON body for webhook notifier.
+type webhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	// Value is encoded as string in the same way as vmalert API does, since JSON doesn't support NaN and Inf values.
+	Value string `json:"value"`
+}
+
+// newWebhookNotifier returns a Notifier, which sends alerts to the webhook according to wc.
+//
+// wc must be validated before the call.
+func newWebhookNotifier(wc *WebhookConfig, gen AlertURLGenerator, relabelCfg *promrelabel.ParsedConfigs, timeout time.Duration) (Notifier, error) {
+	// bodyFn isn't needed, since alerts are sent in batches via batchBodyFn.
+	hr, err := newHTTPReceiver("webhook", wc.URL, gen, wc.HTTPClientConfig, relabelCfg, timeout, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	hr.batchBodyFn = func(data []*notificationTplData) ([]byte, error) {
+		dst := []byte{'['}
+		for i, d := range data {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			dst, err = wc.marshalAlert(dst, d)
+			if err != nil {
+				return nil, err
+			}
+		}
+		dst = append(dst, ']')
+		return dst, nil
+	}
+	return hr, nil
+}
+
+// marshalAlert appends JSON representation of the alert with the given data to dst and returns the result.
+func (wc *WebhookConfig) marshalAlert(dst []byte, data *notificationTplData) ([]byte, error) {
+	if wc.body == nil {
+		b, err := json.Marshal(&webhookAlert{
+			Status:       data.Status,
+			Labels:       data.Labels,
+			Annotations:  data.Annotations,
+			StartsAt:     data.StartsAt,
+			EndsAt:       data.EndsAt,
+			GeneratorURL: data.GeneratorURL,
+			Value:        strconv.FormatFloat(data.Value, 'f', -1, 32),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(dst, b...), nil
+	}
+	body, err := wc.body.exec(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate request body: %w", err)
+	}
+	if !json.Valid([]byte(body)) {
+		return nil, fmt.Errorf("request body generated from the template must be a valid JSON; got %q", body)
+	}
+	return append(dst, body...), nil
+}
@@ -0,0 +1,168 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func TestWebhookNotifier_Send(t *testing.T) {
+	const token = "foo"
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			t.Fatalf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("unexpected Content-Type header %q", r.Header.Get("Content-Type"))
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("cannot read request body: %s", err)
+		}
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	relabelCfg, err := promrelabel.ParseRelabelConfigsData([]byte(`
+- target_label: "env"
+  replacement: "prod"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error when parse relabeling config: %s", err)
+	}
+
+	f := func(body string, alerts []Alert, bodyExpected string) {
+		t.Helper()
+
+		bodies = bodies[:0]
+		wc := &WebhookConfig{
+			URL:  srv.URL,
+			Body: body,
+			HTTPClientConfig: promauth.HTTPClientConfig{
+				BearerToken: promauth.NewSecret(token),
+			},
+		}
+		if err := wc.validate(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		nt, err := newWebhookNotifier(wc, nil, relabelCfg, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer nt.Close()
+		if err := nt.Send(context.Background(), alerts, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(bodies) != 1 {
+			t.Fatalf("expected 1 request; got %d", len(bodies))
+		}
+		if bodies[0] != bodyExpected {
+			t.Fatalf("unexpected request body\ngot\n%s\nwant\n%s", bodies[0], bodyExpected)
+		}
+	}
+
+	// templated body
+	f(`{"alert":{{ $labels.alertname | jsonEscape }},"env":{{ $labels.env | jsonEscape }},"status":"{{ $status }}","summary":{{ $annotations.summary | jsonEscape }}}`, []Alert{{
+		Name:        "foo",
+		State:       StateFiring,
+		Labels:      map[string]string{"alertname": "foo"},
+		Annotations: map[string]string{"summary": `value is "high"`},
+	}}, `[{"alert":"foo","env":"prod","status":"firing","summary":"value is \"high\""}]`)
+
+	// multiple alerts are sent in a single request
+	f(`{"alert":{{ $labels.alertname | jsonEscape }},"status":"{{ $status }}"}`, []Alert{
+		{
+			Name:   "foo",
+			State:  StateFiring,
+			Labels: map[string]string{"alertname": "foo"},
+		},
+		{
+			Name:   "bar",
+			State:  StateInactive,
+			Labels: map[string]string{"alertname": "bar"},
+		},
+	}, `[{"alert":"foo","status":"firing"},{"alert":"bar","status":"resolved"}]`)
+
+	// default body
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	wa := webhookAlert{
+		Status:      "resolved",
+		Labels:      map[string]string{"alertname": "foo", "env": "prod"},
+		Annotations: map[string]string{"summary": "bar"},
+		StartsAt:    ts,
+		EndsAt:      ts.Add(time.Minute),
+		Value:       "42",
+	}
+	b, err := json.Marshal(&wa)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f("", []Alert{{
+		Name:        "foo",
+		State:       StateInactive,
+		Labels:      map[string]string{"alertname": "foo"},
+		Annotations: map[string]string{"summary": "bar"},
+		Start:       ts,
+		End:         ts.Add(time.Minute),
+		Value:       42,
+	}}, "["+string(b)+"]")
+
+	// NaN value
+	wa.Value = "NaN"
+	b, err = json.Marshal(&wa)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f("", []Alert{{
+		Name:        "foo",
+		State:       StateInactive,
+		Labels:      map[string]string{"alertname": "foo"},
+		Annotations: map[string]string{"summary": "bar"},
+		Start:       ts,
+		End:         ts.Add(time.Minute),
+		Value:       math.NaN(),
+	}}, "["+string(b)+"]")
+}
+
+func TestWebhookNotifier_SendFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	f := func(body string) {
+		t.Helper()
+
+		wc := &WebhookConfig{
+			URL:  srv.URL,
+			Body: body,
+		}
+		if err := wc.validate(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		nt, err := newWebhookNotifier(wc, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer nt.Close()
+		if err := nt.Send(context.Background(), []Alert{{Labels: map[string]string{"alertname": "foo"}}}, nil); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid JSON body
+	f(`{"alert": {{ $labels.alertname }}}`)
+
+	// unexpected status code
+	f(`{"alert": {{ $labels.alertname | jsonEscape }}}`)
+	f("")
+}
@@ -0,0 +1,311 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	stateDir = flag.String("rule.stateDir", "", "Optional path to directory for persisting alerts state across restarts. "+
+		"If set, then vmalert periodically saves active alerts of alerting rules with their activeAt, keep_firing_for timers "+
+		"and the last evaluation state to a local file, and restores them on startup. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmalert/#alerts-state-on-restarts")
+	stateSaveInterval = flag.Duration("rule.stateSaveInterval", 10*time.Second, "Interval for saving alerts state to -rule.stateDir")
+	stateMaxAge       = flag.Duration("rule.stateMaxAge", time.Hour, "The maximum age of alerts state in -rule.stateDir, which can be restored on startup. "+
+		"Older state is ignored, so alerts with `for` param start from scratch")
+)
+
+const stateFilename = "alerts_state.json"
+
+// IsStateEnabled returns true if alerts state must be persisted to -rule.stateDir.
+func IsStateEnabled() bool {
+	return *stateDir != ""
+}
+
+// StateSaveInterval returns the interval for calling SaveState.
+func StateSaveInterval() time.Duration {
+	return *stateSaveInterval
+}
+
+// stateSnapshot is the contents of the state file.
+type stateSnapshot struct {
+	// Timestamp is the time when the snapshot has been made
+	Timestamp time.Time    `json:"timestamp"`
+	Groups    []groupState `json:"groups"`
+}
+
+type groupState struct {
+	ID    uint64              `json:"id"`
+	Name  string              `json:"name"`
+	File  string              `json:"file"`
+	Rules []alertingRuleState `json:"rules"`
+}
+
+type alertingRuleState struct {
+	ID       uint64              `json:"id"`
+	Name     string              `json:"name"`
+	LastEval *stateEntrySnapshot `json:"last_evaluation,omitempty"`
+	Alerts   []alertState        `json:"alerts,omitempty"`
+}
+
+// alertState is a serializable copy of notifier.Alert.
+type alertState struct {
+	notifier.Alert
+
+	// Value overrides notifier.Alert.Value, since JSON doesn't support NaN and Inf values.
+	Value stateValue `json:"Value"`
+}
+
+// stateValue is a float64, which is encoded as JSON string in the same way as vmalert API does.
+type stateValue float64
+
+// MarshalJSON implements json.Marshaler interface.
+func (v stateValue) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, strconv.FormatFloat(float64(v), 'f', -1, 64)), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+//
+// It accepts both strings and numbers for backwards compatibility with state files, which store values as numbers.
+func (v *stateValue) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if len(s) > 0 && s[0] == '"' {
+		var err error
+		s, err = strconv.Unquote(s)
+		if err != nil {
+			return fmt.Errorf("cannot unquote value %s: %w", data, err)
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse value %s: %w", data, err)
+	}
+	*v = stateValue(f)
+	return nil
+}
+
+// stateEntrySnapshot is a serializable copy of StateEntry.
+type stateEntrySnapshot struct {
+	Time          time.Time     `json:"time"`
+	At            time.Time     `json:"at"`
+	Duration      time.Duration `json:"duration"`
+	Err           string        `json:"error,omitempty"`
+	Samples       int           `json:"samples"`
+	SeriesFetched *int          `json:"series_fetched,omitempty"`
+	Curl          string        `json:"curl,omitempty"`
+}
+
+func newStateEntrySnapshot(e StateEntry) *stateEntrySnapshot {
+	if e.Time.IsZero() && e.At.IsZero() {
+		// the rule wasn't evaluated yet
+		return nil
+	}
+	es := &stateEntrySnapshot{
+		Time:          e.Time,
+		At:            e.At,
+		Duration:      e.Duration,
+		Samples:       e.Samples,
+		SeriesFetched: e.SeriesFetched,
+		Curl:          e.Curl,
+	}
+	if e.Err != nil {
+		es.Err = e.Err.Error()
+	}
+	return es
+}
+
+func (es *stateEntrySnapshot) toStateEntry() StateEntry {
+	e := StateEntry{
+		Time:          es.Time,
+		At:            es.At,
+		Duration:      es.Duration,
+		Samples:       es.Samples,
+		SeriesFetched: es.SeriesFetched,
+		Curl:          es.Curl,
+	}
+	if es.Err != "" {
+		e.Err = errors.New(es.Err)
+	}
+	return e
+}
+
+var (
+	restoredStateMu sync.Mutex
+	// restoredState contains alerting rules state loaded from -rule.stateDir by groupID and ruleID.
+	// Entries are deleted after being restored, so the state is restored only once.
+	restoredState map[uint64]map[uint64]*alertingRuleState
+)
+
+// InitState loads alerts state from -rule.stateDir.
+//
+// The loaded state is applied to the matching groups on their Start.
+// InitState must be called before starting groups.
+func InitState() error {
+	if !IsStateEnabled() {
+		return nil
+	}
+	if err := os.MkdirAll(*stateDir, 0o755); err != nil {
+		return fmt.Errorf("cannot create -rule.stateDir=%q: %w", *stateDir, err)
+	}
+	path := filepath.Join(*stateDir, stateFilename)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot read alerts state: %w", err)
+	}
+	var ss stateSnapshot
+	if err := json.Unmarshal(data, &ss); err != nil {
+		// Do not prevent vmalert from starting because of broken state file,
+		// since it is going to be overwritten soon.
+		logger.Errorf("cannot parse alerts state from %q: %s; ignoring it", path, err)
+		return nil
+	}
+	if age := time.Since(ss.Timestamp); age > *stateMaxAge {
+		logger.Infof("ignoring alerts state from %q, since it is older than -rule.stateMaxAge=%s: %s", path, *stateMaxAge, age)
+		return nil
+	}
+
+	rs := make(map[uint64]map[uint64]*alertingRuleState, len(ss.Groups))
+	for i := range ss.Groups {
+		gs := &ss.Groups[i]
+		m := make(map[uint64]*alertingRuleState, len(gs.Rules))
+		for j := range gs.Rules {
+			m[gs.Rules[j].ID] = &gs.Rules[j]
+		}
+		rs[gs.ID] = m
+	}
+	restoredStateMu.Lock()
+	restoredState = rs
+	restoredStateMu.Unlock()
+	logger.Infof("loaded alerts state for %d groups from %q saved at %s", len(ss.Groups), path, ss.Timestamp.Format(time.RFC3339))
+	return nil
+}
+
+// SaveState saves alerts state for the given groups to -rule.stateDir.
+func SaveState(groups []*Group) error {
+	if !IsStateEnabled() {
+		return nil
+	}
+	ss := stateSnapshot{
+		Timestamp: time.Now(),
+		Groups:    make([]groupState, 0, len(groups)),
+	}
+	for _, g := range groups {
+		if gs := g.stateSnapshot(); gs != nil {
+			ss.Groups = append(ss.Groups, *gs)
+		}
+	}
+	data, err := json.Marshal(&ss)
+	if err != nil {
+		return fmt.Errorf("cannot marshal alerts state: %w", err)
+	}
+
+	// Write the state atomically, so the state file isn't corrupted on unclean shutdown.
+	path := filepath.Join(*stateDir, stateFilename)
+	fs.MustWriteAtomic(path, data, true)
+	return nil
+}
+
+// stateSnapshot returns alerting rules state for g.
+//
+// nil is returned if g has no alerting rules.
+func (g *Group) stateSnapshot() *groupState {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var rules []alertingRuleState
+	for _, r := range g.Rules {
+		ar, ok := r.(*AlertingRule)
+		if !ok {
+			continue
+		}
+		rules = append(rules, ar.stateSnapshot())
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &groupState{
+		ID:    g.GetID(),
+		Name:  g.Name,
+		File:  g.File,
+		Rules: rules,
+	}
+}
+
+// restoreState restores alerting rules state loaded via InitState for g.
+func (g *Group) restoreState() {
+	restoredStateMu.Lock()
+	rs := restoredState[g.GetID()]
+	delete(restoredState, g.GetID())
+	restoredStateMu.Unlock()
+
+	if len(rs) == 0 {
+		return
+	}
+	var restored int
+	for _, r := range g.Rules {
+		ar, ok := r.(*AlertingRule)
+		if !ok {
+			continue
+		}
+		// Rule ID depends on the rule definition,
+		// so the state isn't restored for modified rules.
+		if ars, ok := rs[ar.ID()]; ok {
+			ar.restoreState(ars)
+			restored++
+		}
+	}
+	if restored > 0 {
+		g.infof("restored alerts state for %d rules from -rule.stateDir", restored)
+	}
+}
+
+func (ar *AlertingRule) stateSnapshot() alertingRuleState {
+	ars := alertingRuleState{
+		ID:       ar.ID(),
+		Name:     ar.Name,
+		LastEval: newStateEntrySnapshot(ar.state.getLast()),
+	}
+	ar.alertsMu.RLock()
+	for _, a := range ar.alerts {
+		ars.Alerts = append(ars.Alerts, alertState{
+			Alert: *a,
+			Value: stateValue(a.Value),
+		})
+	}
+	ar.alertsMu.RUnlock()
+	return ars
+}
+
+func (ar *AlertingRule) restoreState(ars *alertingRuleState) {
+	if ars.LastEval != nil {
+		ar.state.add(ars.LastEval.toStateEntry())
+	}
+
+	ar.alertsMu.Lock()
+	defer ar.alertsMu.Unlock()
+
+	for i := range ars.Alerts {
+		a := ars.Alerts[i].Alert
+		a.Value = float64(ars.Alerts[i].Value)
+		a.GroupID = ar.GroupID
+		if a.State != notifier.StateInactive {
+			a.Restored = true
+		}
+		ar.alerts[a.ID] = &a
+		ar.logDebugf(time.Now(), &a, "restored in state %s from -rule.stateDir", a.State)
+	}
+}
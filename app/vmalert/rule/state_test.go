@@ -0,0 +1,180 @@
+package rule
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+)
+
+func TestStateSaveRestore(t *testing.T) {
+	const rules = `
+- name: groupTest
+  rules:
+    - alert: VMRows
+      for: 5m
+      keep_firing_for: 10m
+      expr: vm_rows > 0
+    - record: vm_rows:sum
+      expr: sum(vm_rows)
+`
+	var groups []config.Group
+	if err := yaml.Unmarshal([]byte(rules), &groups); err != nil {
+		t.Fatalf("failed to parse rules: %s", err)
+	}
+
+	defer func(dir string, maxAge time.Duration) {
+		*stateDir = dir
+		*stateMaxAge = maxAge
+	}(*stateDir, *stateMaxAge)
+	*stateDir = filepath.Join(t.TempDir(), "state")
+
+	newGroup := func() (*Group, *datasource.FakeQuerier) {
+		t.Helper()
+		fq := &datasource.FakeQuerier{}
+		g := NewGroup(groups[0], fq, time.Minute, nil)
+		g.Init()
+		t.Cleanup(g.closeGroupMetrics)
+		return g, fq
+	}
+
+	// evaluate the rule, so it gets a pending alert
+	g, fq := newGroup()
+	ar := g.Rules[0].(*AlertingRule)
+	fq.Add(metricWithLabels(t, "instance", "foo"))
+	ts := time.Now().Add(-time.Minute)
+	if _, err := ar.exec(context.Background(), ts, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	alerts := ar.GetAlerts()
+	if len(alerts) != 1 || alerts[0].State != notifier.StatePending {
+		t.Fatalf("expected to get 1 pending alert; got %v", alerts)
+	}
+	alertExpected := *alerts[0]
+
+	// NaN values must be persisted, since JSON doesn't support them
+	ar.alertsMu.Lock()
+	ar.alerts[alertExpected.ID].Value = math.NaN()
+	ar.alertsMu.Unlock()
+
+	if err := InitState(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := SaveState([]*Group{g}); err != nil {
+		t.Fatalf("cannot save state: %s", err)
+	}
+	if err := InitState(); err != nil {
+		t.Fatalf("cannot load state: %s", err)
+	}
+
+	// restore the state into a fresh group with the same config
+	g, fq = newGroup()
+	g.restoreState()
+	ar = g.Rules[0].(*AlertingRule)
+	a := ar.GetAlert(alertExpected.ID)
+	if a == nil {
+		t.Fatalf("expected alert %d to be restored", alertExpected.ID)
+	}
+	if !a.Restored {
+		t.Fatalf("expected alert to be marked as restored")
+	}
+	if !a.ActiveAt.Equal(alertExpected.ActiveAt) {
+		t.Fatalf("unexpected ActiveAt; got %s; want %s", a.ActiveAt, alertExpected.ActiveAt)
+	}
+	if a.State != notifier.StatePending {
+		t.Fatalf("unexpected alert state; got %s; want %s", a.State, notifier.StatePending)
+	}
+	if !math.IsNaN(a.Value) {
+		t.Fatalf("unexpected alert value; got %v; want NaN", a.Value)
+	}
+	if last := ar.state.getLast(); !last.At.Equal(ts) || last.Samples != 1 {
+		t.Fatalf("unexpected last evaluation state: %+v", last)
+	}
+
+	// the alert must become firing once `for` elapses since the restored ActiveAt
+	fq.Add(metricWithLabels(t, "instance", "foo"))
+	if _, err := ar.exec(context.Background(), ts.Add(5*time.Minute), 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a := ar.GetAlert(alertExpected.ID); a == nil || a.State != notifier.StateFiring {
+		t.Fatalf("expected alert to become firing; got %v", a)
+	}
+
+	// the state must be restored only once
+	g, _ = newGroup()
+	g.restoreState()
+	if alerts := g.Rules[0].(*AlertingRule).GetAlerts(); len(alerts) != 0 {
+		t.Fatalf("expected no alerts to be restored twice; got %d", len(alerts))
+	}
+
+	// outdated state must be ignored
+	*stateMaxAge = time.Nanosecond
+	if err := InitState(); err != nil {
+		t.Fatalf("cannot load state: %s", err)
+	}
+	g, _ = newGroup()
+	g.restoreState()
+	if alerts := g.Rules[0].(*AlertingRule).GetAlerts(); len(alerts) != 0 {
+		t.Fatalf("expected outdated state to be ignored; got %d alerts", len(alerts))
+	}
+	*stateMaxAge = time.Hour
+
+	// broken state file must be ignored
+	if err := os.WriteFile(filepath.Join(*stateDir, stateFilename), []byte("foo"), 0o644); err != nil {
+		t.Fatalf("cannot write state file: %s", err)
+	}
+	if err := InitState(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestStateValueMarshalUnmarshal(t *testing.T) {
+	f := func(v float64, dataExpected string) {
+		t.Helper()
+
+		data, err := json.Marshal(stateValue(v))
+		if err != nil {
+			t.Fatalf("cannot marshal %v: %s", v, err)
+		}
+		if string(data) != dataExpected {
+			t.Fatalf("unexpected marshaled value; got %s; want %s", data, dataExpected)
+		}
+		var sv stateValue
+		if err := json.Unmarshal(data, &sv); err != nil {
+			t.Fatalf("cannot unmarshal %s: %s", data, err)
+		}
+		if math.IsNaN(v) {
+			if !math.IsNaN(float64(sv)) {
+				t.Fatalf("unexpected unmarshaled value; got %v; want NaN", sv)
+			}
+			return
+		}
+		if float64(sv) != v {
+			t.Fatalf("unexpected unmarshaled value; got %v; want %v", sv, v)
+		}
+	}
+	f(0, `"0"`)
+	f(1.5, `"1.5"`)
+	f(-123456789.123, `"-123456789.123"`)
+	f(math.NaN(), `"NaN"`)
+	f(math.Inf(1), `"+Inf"`)
+	f(math.Inf(-1), `"-Inf"`)
+
+	// values stored as numbers must be accepted for backwards compatibility
+	var sv stateValue
+	if err := json.Unmarshal([]byte("42.5"), &sv); err != nil {
+		t.Fatalf("cannot unmarshal number: %s", err)
+	}
+	if sv != 42.5 {
+		t.Fatalf("unexpected unmarshaled value; got %v; want 42.5", sv)
+	}
+}
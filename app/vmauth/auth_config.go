@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"net/http"
@@ -30,6 +31,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
 )
 
 var (
@@ -55,6 +57,9 @@ type AuthConfig struct {
 
 	// ms holds all the metrics for the given AuthConfig
 	ms *metrics.Set
+
+	// jwtUsers contains users with `jwt` section in the order they are defined in the config
+	jwtUsers []*UserInfo
 }
 
 // UserInfo is user information read from authConfigPath
@@ -66,12 +71,15 @@ type UserInfo struct {
 	Username    string `yaml:"username,omitempty"`
 	Password    string `yaml:"password,omitempty"`
 
+	JWT *JWTConfig `yaml:"jwt,omitempty"`
+
 	URLPrefix              *URLPrefix  `yaml:"url_prefix,omitempty"`
 	DiscoverBackendIPs     *bool       `yaml:"discover_backend_ips,omitempty"`
 	URLMaps                []URLMap    `yaml:"url_map,omitempty"`
 	DumpRequestOnErrors    bool        `yaml:"dump_request_on_errors,omitempty"`
 	HeadersConf            HeadersConf `yaml:",inline"`
 	MaxConcurrentRequests  int         `yaml:"max_concurrent_requests,omitempty"`
+	RateLimits             RateLimits  `yaml:",inline"`
 	DefaultURL             *URLPrefix  `yaml:"default_url,omitempty"`
 	RetryStatusCodes       []int       `yaml:"retry_status_codes,omitempty"`
 	LoadBalancingPolicy    string      `yaml:"load_balancing_policy,omitempty"`
@@ -115,6 +123,197 @@ func (ui *UserInfo) endConcurrencyLimit() {
 	<-ui.concurrencyLimitCh
 }
 
+// RateLimits represents config for limiting the rate of requests and proxied bytes.
+type RateLimits struct {
+	// MaxRequestsPerSecond is the maximum average number of requests per second.
+	MaxRequestsPerSecond float64 `yaml:"max_requests_per_second,omitempty"`
+
+	// RequestsBurst is the maximum number of requests, which can be served at once before MaxRequestsPerSecond is applied.
+	RequestsBurst int `yaml:"requests_burst,omitempty"`
+
+	// MaxBytesPerSecond is the maximum average number of request and response body bytes per second.
+	MaxBytesPerSecond string `yaml:"max_bytes_per_second,omitempty"`
+
+	// BytesBurst is the maximum number of bytes, which can be proxied at once before MaxBytesPerSecond is applied.
+	BytesBurst string `yaml:"bytes_burst,omitempty"`
+
+	// name is used in error messages when the limits are exceeded.
+	name string
+
+	requestsRateLimiter      *ratelimiter.TokenBucket
+	requestsRateLimitReached *metrics.Counter
+	bytesRateLimiter         *ratelimiter.TokenBucket
+	bytesRateLimitReached    *metrics.Counter
+}
+
+// beginRateLimit checks whether the request to up can be processed according to max_requests_per_second and max_bytes_per_second limits
+// set at ui and at the `url_map` entry for up.
+//
+// Tokens are taken from the limiters only if all the limits allow processing the request.
+// It returns the duration after which the request can be retried if some limit is exceeded.
+func (ui *UserInfo) beginRateLimit(r *http.Request, up *URLPrefix) (time.Duration, error) {
+	rls := [2]*RateLimits{&ui.RateLimits, nil}
+	if up != nil {
+		rls[1] = up.rateLimits
+	}
+
+	// Take the request body size into account if it is known beforehand.
+	// Otherwise, the read request body and the response body are accounted during proxying.
+	// See rateLimitedReader.
+	n := max(r.ContentLength, 0)
+	var tbs [2 * len(rls)]*ratelimiter.TokenBucket
+	var ns [2 * len(rls)]float64
+	for i, rl := range rls {
+		if rl == nil {
+			continue
+		}
+		tbs[2*i], ns[2*i] = rl.requestsRateLimiter, 1
+		tbs[2*i+1], ns[2*i+1] = rl.bytesRateLimiter, float64(n)
+	}
+	if d, idx := ratelimiter.TryTakeAll(tbs[:], ns[:]); idx >= 0 {
+		rl := rls[idx/2]
+		if idx%2 == 0 {
+			rl.requestsRateLimitReached.Inc()
+			return d, fmt.Errorf("cannot handle more than %v requests per second from %s", rl.MaxRequestsPerSecond, rl.name)
+		}
+		rl.bytesRateLimitReached.Inc()
+		return d, fmt.Errorf("cannot handle more than %s bytes per second from %s", rl.MaxBytesPerSecond, rl.name)
+	}
+
+	if r.Body != nil {
+		if brls := getBytesRateLimiters(rls[:]); len(brls) > 0 {
+			r.Body = &rateLimitedReader{
+				r:            r.Body,
+				skipBytes:    n,
+				rateLimiters: brls,
+			}
+		}
+	}
+	return 0, nil
+}
+
+// getBytesRateLimiters returns max_bytes_per_second limiters from ui and from the `url_map` entry for up.
+func (ui *UserInfo) getBytesRateLimiters(up *URLPrefix) []*ratelimiter.TokenBucket {
+	rls := [2]*RateLimits{&ui.RateLimits, nil}
+	if up != nil {
+		rls[1] = up.rateLimits
+	}
+	return getBytesRateLimiters(rls[:])
+}
+
+func getBytesRateLimiters(rls []*RateLimits) []*ratelimiter.TokenBucket {
+	var tbs []*ratelimiter.TokenBucket
+	for _, rl := range rls {
+		if rl != nil && rl.bytesRateLimiter != nil {
+			tbs = append(tbs, rl.bytesRateLimiter)
+		}
+	}
+	return tbs
+}
+
+// rateLimitedReader accounts bytes read from r at rateLimiters.
+type rateLimitedReader struct {
+	r io.ReadCloser
+
+	// skipBytes is the number of bytes, which were already accounted at rateLimiters.
+	skipBytes int64
+
+	rateLimiters []*ratelimiter.TokenBucket
+}
+
+// Read implements io.Reader interface.
+func (rlr *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := rlr.r.Read(p)
+	m := int64(n)
+	if rlr.skipBytes > 0 {
+		skip := min(rlr.skipBytes, m)
+		rlr.skipBytes -= skip
+		m -= skip
+	}
+	if m > 0 {
+		for _, tb := range rlr.rateLimiters {
+			tb.Take(float64(m))
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface.
+func (rlr *rateLimitedReader) Close() error {
+	return rlr.r.Close()
+}
+
+func (ui *UserInfo) initRateLimits(ms *metrics.Set, metricPrefix, metricLabels string) error {
+	if err := ui.RateLimits.init(ms, metricPrefix, metricLabels, "user "+ui.name()); err != nil {
+		return err
+	}
+	for i := range ui.URLMaps {
+		e := &ui.URLMaps[i]
+		labels := addMetricLabel(metricLabels, "url_map", strconv.Itoa(i+1))
+		name := fmt.Sprintf("user %s to url_map #%d", ui.name(), i+1)
+		if err := e.RateLimits.init(ms, metricPrefix+"_url_map", labels, name); err != nil {
+			return fmt.Errorf("cannot initialize rate limits for url_map #%d: %w", i+1, err)
+		}
+		e.URLPrefix.rateLimits = &e.RateLimits
+	}
+	return nil
+}
+
+// addMetricLabel adds name="value" label to metricLabels obtained via UserInfo.getMetricLabels.
+func addMetricLabel(metricLabels, name, value string) string {
+	label := fmt.Sprintf(`%s=%q`, name, value)
+	if metricLabels == "" {
+		return "{" + label + "}"
+	}
+	return metricLabels[:len(metricLabels)-1] + "," + label + "}"
+}
+
+func (rl *RateLimits) init(ms *metrics.Set, metricPrefix, metricLabels, name string) error {
+	rl.name = name
+	if rl.MaxRequestsPerSecond < 0 {
+		return fmt.Errorf("max_requests_per_second cannot be negative; got %v", rl.MaxRequestsPerSecond)
+	}
+	if rl.RequestsBurst < 0 {
+		return fmt.Errorf("requests_burst cannot be negative; got %d", rl.RequestsBurst)
+	}
+	if rl.MaxRequestsPerSecond > 0 {
+		burst := float64(rl.RequestsBurst)
+		if burst <= 0 {
+			burst = max(rl.MaxRequestsPerSecond, 1)
+		}
+		rl.requestsRateLimiter = ratelimiter.NewTokenBucket(rl.MaxRequestsPerSecond, burst)
+		rl.requestsRateLimitReached = ms.GetOrCreateCounter(metricPrefix + `_requests_rate_limit_reached_total` + metricLabels)
+	} else if rl.RequestsBurst > 0 {
+		return fmt.Errorf("requests_burst cannot be set without max_requests_per_second")
+	}
+
+	var bytesPerSecond, bytesBurst int64
+	if rl.MaxBytesPerSecond != "" {
+		n, err := flagutil.ParseBytes(rl.MaxBytesPerSecond)
+		if err != nil {
+			return fmt.Errorf("cannot parse max_bytes_per_second=%q: %w", rl.MaxBytesPerSecond, err)
+		}
+		bytesPerSecond = n
+	}
+	if rl.BytesBurst != "" {
+		n, err := flagutil.ParseBytes(rl.BytesBurst)
+		if err != nil {
+			return fmt.Errorf("cannot parse bytes_burst=%q: %w", rl.BytesBurst, err)
+		}
+		bytesBurst = n
+	}
+	if bytesPerSecond < 0 || bytesBurst < 0 {
+		return fmt.Errorf("max_bytes_per_second and bytes_burst cannot be negative")
+	}
+	if bytesPerSecond > 0 {
+		rl.bytesRateLimiter = ratelimiter.NewTokenBucket(float64(bytesPerSecond), float64(bytesBurst))
+		rl.bytesRateLimitReached = ms.GetOrCreateCounter(metricPrefix + `_bytes_rate_limit_reached_total` + metricLabels)
+	} else if bytesBurst > 0 {
+		return fmt.Errorf("bytes_burst cannot be set without max_bytes_per_second")
+	}
+	return nil
+}
+
 func (ui *UserInfo) getMaxConcurrentRequests() int {
 	mcr := ui.MaxConcurrentRequests
 	if mcr <= 0 {
@@ -167,6 +366,9 @@ type URLMap struct {
 	// SrcHeaders is an optional list of headers, which must match request headers.
 	SrcHeaders []*Header `yaml:"src_headers,omitempty"`
 
+	// SrcClaims is an optional list of `claim=value` filters, which must match claims of JWT used for request authorization.
+	SrcClaims []*QueryArg `yaml:"src_claims,omitempty"`
+
 	// UrlPrefix contains backend url prefixes for the proxied request url.
 	URLPrefix *URLPrefix `yaml:"url_prefix,omitempty"`
 
@@ -184,6 +386,11 @@ type URLMap struct {
 
 	// DropSrcPathPrefixParts is the number of `/`-delimited request path prefix parts to drop before proxying the request to backend.
 	DropSrcPathPrefixParts *int `yaml:"drop_src_path_prefix_parts,omitempty"`
+
+	// RateLimits contains rate limits for requests matching the url_map entry.
+	//
+	// These limits are applied in addition to the rate limits set for the user.
+	RateLimits RateLimits `yaml:",inline"`
 }
 
 // QueryArg represents HTTP query arg
@@ -239,6 +446,11 @@ type URLPrefix struct {
 	// how many request path prefix parts to drop before routing the request to backendURL
 	dropSrcPathPrefixParts int
 
+	// rateLimits contains rate limits for the `url_map` entry with the given URLPrefix.
+	//
+	// It is nil for URLPrefix outside `url_map`.
+	rateLimits *RateLimits
+
 	// busOriginal contains the original list of backends specified in yaml config.
 	busOriginal []*url.URL
 
@@ -748,6 +960,9 @@ func parseAuthConfig(data []byte) (*AuthConfig, error) {
 		if ui.Name != "" {
 			return nil, fmt.Errorf("field name can't be specified for unauthorized_user section")
 		}
+		if ui.JWT != nil {
+			return nil, fmt.Errorf("field jwt can't be specified for unauthorized_user section")
+		}
 		if err := ui.initURLs(); err != nil {
 			return nil, err
 		}
@@ -761,6 +976,9 @@ func parseAuthConfig(data []byte) (*AuthConfig, error) {
 		ui.requestsDuration = ac.ms.NewSummary(`vmauth_unauthorized_user_request_duration_seconds` + metricLabels)
 		ui.concurrencyLimitCh = make(chan struct{}, ui.getMaxConcurrentRequests())
 		ui.concurrencyLimitReached = ac.ms.NewCounter(`vmauth_unauthorized_user_concurrent_requests_limit_reached_total` + metricLabels)
+		if err := ui.initRateLimits(ac.ms, "vmauth_unauthorized_user", metricLabels); err != nil {
+			return nil, fmt.Errorf("cannot initialize rate limits for unauthorized_user: %w", err)
+		}
 		_ = ac.ms.NewGauge(`vmauth_unauthorized_user_concurrent_requests_capacity`+metricLabels, func() float64 {
 			return float64(cap(ui.concurrencyLimitCh))
 		})
@@ -786,9 +1004,21 @@ func parseAuthConfigUsers(ac *AuthConfig) (map[string]*UserInfo, error) {
 	}
 	for i := range uis {
 		ui := &uis[i]
-		ats, err := getAuthTokens(ui.AuthToken, ui.BearerToken, ui.Username, ui.Password)
-		if err != nil {
-			return nil, err
+		var ats []string
+		if ui.JWT != nil {
+			if ui.AuthToken != "" || ui.BearerToken != "" || ui.Username != "" || ui.Password != "" {
+				return nil, fmt.Errorf("auth_token, bearer_token, username and password cannot be specified if jwt is set")
+			}
+			if err := ui.JWT.init(); err != nil {
+				return nil, fmt.Errorf("cannot initialize jwt for user %q: %w", ui.name(), err)
+			}
+			ac.jwtUsers = append(ac.jwtUsers, ui)
+		} else {
+			var err error
+			ats, err = getAuthTokens(ui.AuthToken, ui.BearerToken, ui.Username, ui.Password)
+			if err != nil {
+				return nil, err
+			}
 		}
 		for _, at := range ats {
 			if uiOld := byAuthToken[at]; uiOld != nil {
@@ -810,6 +1040,9 @@ func parseAuthConfigUsers(ac *AuthConfig) (map[string]*UserInfo, error) {
 		mcr := ui.getMaxConcurrentRequests()
 		ui.concurrencyLimitCh = make(chan struct{}, mcr)
 		ui.concurrencyLimitReached = ac.ms.GetOrCreateCounter(`vmauth_user_concurrent_requests_limit_reached_total` + metricLabels)
+		if err := ui.initRateLimits(ac.ms, "vmauth_user", metricLabels); err != nil {
+			return nil, fmt.Errorf("cannot initialize rate limits for user %q: %w", ui.name(), err)
+		}
 		_ = ac.ms.GetOrCreateGauge(`vmauth_user_concurrent_requests_capacity`+metricLabels, func() float64 {
 			return float64(cap(ui.concurrencyLimitCh))
 		})
@@ -888,8 +1121,16 @@ func (ui *UserInfo) initURLs() error {
 		}
 	}
 	for _, e := range ui.URLMaps {
-		if len(e.SrcPaths) == 0 && len(e.SrcHosts) == 0 && len(e.SrcQueryArgs) == 0 && len(e.SrcHeaders) == 0 {
-			return fmt.Errorf("missing `src_paths`, `src_hosts`, `src_query_args` and `src_headers` in `url_map`")
+		if len(e.SrcPaths) == 0 && len(e.SrcHosts) == 0 && len(e.SrcQueryArgs) == 0 && len(e.SrcHeaders) == 0 && len(e.SrcClaims) == 0 {
+			return fmt.Errorf("missing `src_paths`, `src_hosts`, `src_query_args`, `src_headers` and `src_claims` in `url_map`")
+		}
+		if len(e.SrcClaims) > 0 && ui.JWT == nil {
+			return fmt.Errorf("`src_claims` in `url_map` can be set only for users with `jwt` section")
+		}
+		for _, sc := range e.SrcClaims {
+			if sc.Value == nil {
+				return fmt.Errorf("missing value for `src_claims` filter %q in `url_map`; expected format - 'claim=value'", sc.sOriginal)
+			}
 		}
 		if e.URLPrefix == nil {
 			return fmt.Errorf("missing `url_prefix` in `url_map`")
@@ -941,6 +1182,11 @@ func (ui *UserInfo) name() string {
 		h := xxhash.Sum64([]byte(ui.AuthToken))
 		return fmt.Sprintf("auth_token:hash:%016X", h)
 	}
+	if ui.JWT != nil {
+		data, _ := yaml.Marshal(ui.JWT)
+		h := xxhash.Sum64(data)
+		return fmt.Sprintf("jwt:hash:%016X", h)
+	}
 	return ""
 }
 
@@ -277,6 +277,91 @@ users:
   metric_labels:
     not-prometheus-compatible: value
 `)
+
+	// Invalid rate limits
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  max_requests_per_second: -1
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  requests_burst: 10
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  max_bytes_per_second: foobar
+`)
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo.bar
+  bytes_burst: 1MiB
+`)
+	f(`
+unauthorized_user:
+  url_prefix: http://foo.bar
+  max_bytes_per_second: -1KiB
+`)
+
+	// Missing keys in jwt section
+	f(`
+users:
+- jwt:
+    issuer: foo
+  url_prefix: http://foo.bar
+`)
+	// Invalid public key in jwt section
+	f(`
+users:
+- jwt:
+    public_keys: [foobar]
+  url_prefix: http://foo.bar
+`)
+	// Missing jwks file
+	f(`
+users:
+- jwt:
+    jwks_files: [/non-existing-file]
+  url_prefix: http://foo.bar
+`)
+	// jwt with other auth options
+	f(`
+users:
+- username: foo
+  jwt:
+    jwks_files: [testdata/jwks.json]
+  url_prefix: http://foo.bar
+`)
+	// jwt for unauthorized_user
+	f(`
+unauthorized_user:
+  jwt:
+    jwks_files: [testdata/jwks.json]
+  url_prefix: http://foo.bar
+`)
+	// src_claims without jwt
+	f(`
+users:
+- username: foo
+  url_map:
+  - src_claims: ["team=foo"]
+    url_prefix: http://foo.bar
+`)
+	// src_claims without value
+	f(`
+users:
+- jwt:
+    jwks_files: [testdata/jwks.json]
+  url_map:
+  - src_claims: ["team"]
+    url_prefix: http://foo.bar
+`)
 }
 
 func TestParseAuthConfigSuccess(t *testing.T) {
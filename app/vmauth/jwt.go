@@ -0,0 +1,649 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	jwtClockSkew = flag.Duration("jwt.clockSkew", time.Minute, "The maximum allowed clock skew when validating exp, nbf and iat claims of JWT tokens. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmauth/#jwt-authorization")
+	jwksRefreshInterval = flag.Duration("jwt.jwksRefreshInterval", time.Hour, "Interval for re-reading jwks_files from jwt sections of -auth.config, "+
+		"so rotated signing keys are picked up without config reload. The previously loaded keys are used if JWKS cannot be re-read. "+
+		"See https://docs.victoriametrics.com/victoriametrics/vmauth/#jwt-authorization")
+)
+
+// JWTConfig represents config for authorizing requests with JWT bearer tokens.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmauth/#jwt-authorization
+type JWTConfig struct {
+	// PublicKeys is a list of PEM-encoded public keys or certificates for verifying token signatures.
+	PublicKeys []string `yaml:"public_keys,omitempty"`
+
+	// PublicKeyFiles is a list of paths to files with PEM-encoded public keys or certificates.
+	PublicKeyFiles []string `yaml:"public_key_files,omitempty"`
+
+	// JWKSFiles is a list of paths or http urls to JSON Web Key Sets for verifying token signatures.
+	JWKSFiles []string `yaml:"jwks_files,omitempty"`
+
+	// Issuer is an optional value, which must match the `iss` claim.
+	Issuer string `yaml:"issuer,omitempty"`
+
+	// Audience is an optional list of values, where at least a single value must match the `aud` claim.
+	Audience []string `yaml:"audience,omitempty"`
+
+	// MatchClaims is an optional list of `claim=value` filters, which must match token claims.
+	MatchClaims []*QueryArg `yaml:"match_claims,omitempty"`
+
+	// staticKeys contains keys from PublicKeys and PublicKeyFiles.
+	staticKeys []jwtKey
+
+	// keys contains staticKeys plus keys loaded from JWKSFiles.
+	keys atomic.Pointer[[]jwtKey]
+
+	// jwksLastRefresh is the unix timestamp in seconds for the last attempt to load JWKSFiles.
+	jwksLastRefresh atomic.Uint64
+
+	// jwksRefreshing is set to true while JWKSFiles are re-read in background.
+	jwksRefreshing atomic.Bool
+
+	validator *jwt.Validator
+}
+
+type jwtKey struct {
+	kid string
+	key crypto.PublicKey
+}
+
+// jwtClaims contains claims of the verified JWT.
+type jwtClaims map[string]any
+
+func (jc *JWTConfig) init() error {
+	var keys []jwtKey
+	for i, s := range jc.PublicKeys {
+		ks, err := parsePEMPublicKeys([]byte(s))
+		if err != nil {
+			return fmt.Errorf("cannot parse public_keys #%d: %w", i+1, err)
+		}
+		keys = append(keys, ks...)
+	}
+	for _, path := range jc.PublicKeyFiles {
+		data, err := fscore.ReadFileOrHTTP(path)
+		if err != nil {
+			return fmt.Errorf("cannot read public_key_files: %w", err)
+		}
+		ks, err := parsePEMPublicKeys(data)
+		if err != nil {
+			return fmt.Errorf("cannot parse public key file %q: %w", path, err)
+		}
+		keys = append(keys, ks...)
+	}
+	jc.staticKeys = keys
+	jwksKeys, err := jc.loadJWKS()
+	if err != nil {
+		return err
+	}
+	jc.jwksLastRefresh.Store(fasttime.UnixTimestamp())
+	keys = append(keys[:len(keys):len(keys)], jwksKeys...)
+	if len(keys) == 0 {
+		return fmt.Errorf("missing `public_keys`, `public_key_files` or `jwks_files` in `jwt` section")
+	}
+	for _, mc := range jc.MatchClaims {
+		if mc.Value == nil {
+			return fmt.Errorf("missing value for `match_claims` filter %q; expected format - 'claim=value'", mc.sOriginal)
+		}
+	}
+	jc.keys.Store(&keys)
+
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(*jwtClockSkew),
+	}
+	if jc.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(jc.Issuer))
+	}
+	if len(jc.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(jc.Audience...))
+	}
+	jc.validator = jwt.NewValidator(opts...)
+	return nil
+}
+
+// loadJWKS loads keys from jc.JWKSFiles.
+func (jc *JWTConfig) loadJWKS() ([]jwtKey, error) {
+	var keys []jwtKey
+	for _, path := range jc.JWKSFiles {
+		data, err := fscore.ReadFileOrHTTP(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read jwks_files: %w", err)
+		}
+		ks, err := parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse JWKS file %q: %w", path, err)
+		}
+		keys = append(keys, ks...)
+	}
+	return keys, nil
+}
+
+// getKeys returns keys for verifying token signatures.
+//
+// It starts re-reading jc.JWKSFiles in background if -jwt.jwksRefreshInterval has passed since the last attempt.
+func (jc *JWTConfig) getKeys() []jwtKey {
+	keys := *jc.keys.Load()
+	if len(jc.JWKSFiles) == 0 || *jwksRefreshInterval <= 0 {
+		return keys
+	}
+	ct := fasttime.UnixTimestamp()
+	if ct-jc.jwksLastRefresh.Load() < uint64(jwksRefreshInterval.Seconds()) {
+		return keys
+	}
+	if !jc.jwksRefreshing.CompareAndSwap(false, true) {
+		// JWKS is already being refreshed.
+		return keys
+	}
+	go func() {
+		defer jc.jwksRefreshing.Store(false)
+		jc.refreshJWKS()
+	}()
+	return keys
+}
+
+func (jc *JWTConfig) refreshJWKS() {
+	jc.jwksLastRefresh.Store(fasttime.UnixTimestamp())
+	jwksKeys, err := jc.loadJWKS()
+	if err != nil {
+		jwksRefreshErrors.Inc()
+		logger.Errorf("cannot refresh JWKS; continue using the previously loaded keys: %s", err)
+		return
+	}
+	keys := append(jc.staticKeys[:len(jc.staticKeys):len(jc.staticKeys)], jwksKeys...)
+	if len(keys) == 0 {
+		jwksRefreshErrors.Inc()
+		logger.Errorf("cannot refresh JWKS: missing signing keys; continue using the previously loaded keys")
+		return
+	}
+	jc.keys.Store(&keys)
+}
+
+var jwksRefreshErrors = metrics.NewCounter(`vmauth_jwks_refresh_errors_total`)
+
+// jwtValidMethods contains the list of supported signing methods.
+//
+// Symmetric methods such as HS256 aren't supported, since public keys mustn't be used as shared secrets.
+var jwtValidMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// parsedJWT contains JWT parsed without signature verification.
+//
+// It allows verifying the same token against multiple JWTConfig entries without re-parsing it.
+type parsedJWT struct {
+	token         *jwt.Token
+	claims        jwt.MapClaims
+	signingString string
+}
+
+var jwtUnverifiedParser = jwt.NewParser()
+
+// parseJWT parses the given token without verifying its signature and claims.
+//
+// The returned token must be verified via JWTConfig.verify before using its claims.
+func parseJWT(token string) (*parsedJWT, error) {
+	claims := make(jwt.MapClaims)
+	t, parts, err := jwtUnverifiedParser.ParseUnverified(token, claims)
+	if err != nil {
+		return nil, err
+	}
+	t.Signature, err = jwtUnverifiedParser.DecodeSegment(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token signature: %w", err)
+	}
+	return &parsedJWT{
+		token:         t,
+		claims:        claims,
+		signingString: parts[0] + "." + parts[1],
+	}, nil
+}
+
+// verify verifies the given token and returns its claims.
+func (jc *JWTConfig) verify(pt *parsedJWT) (jwtClaims, error) {
+	alg := pt.token.Method.Alg()
+	if !slices.Contains(jwtValidMethods, alg) {
+		return nil, fmt.Errorf("unsupported signing method %s", alg)
+	}
+	ks, err := jc.getVerificationKeys(pt.token)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range ks {
+		if err = pt.token.Method.Verify(pt.signingString, pt.token.Signature, key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+	if err := jc.validator.Validate(pt.claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	for _, mc := range jc.MatchClaims {
+		if !matchClaim(pt.claims, mc) {
+			return nil, fmt.Errorf("claim %q doesn't match %q", mc.Name, mc.Value.sOriginal)
+		}
+	}
+	return jwtClaims(pt.claims), nil
+}
+
+func (jc *JWTConfig) getVerificationKeys(token *jwt.Token) ([]crypto.PublicKey, error) {
+	kid, _ := token.Header["kid"].(string)
+	var ks []crypto.PublicKey
+	for _, k := range jc.getKeys() {
+		if kid != "" && k.kid != "" && kid != k.kid {
+			continue
+		}
+		if !isKeyCompatibleWithMethod(k.key, token.Method) {
+			continue
+		}
+		ks = append(ks, k.key)
+	}
+	if len(ks) == 0 {
+		return nil, fmt.Errorf("cannot find key for verifying token signed with %s and kid=%q", token.Method.Alg(), kid)
+	}
+	return ks, nil
+}
+
+func isKeyCompatibleWithMethod(key crypto.PublicKey, m jwt.SigningMethod) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		switch m.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := m.(*jwt.SigningMethodECDSA)
+		return ok
+	case ed25519.PublicKey:
+		_, ok := m.(*jwt.SigningMethodEd25519)
+		return ok
+	}
+	return false
+}
+
+func parsePEMPublicKeys(data []byte) ([]jwtKey, error) {
+	var keys []jwtKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			k, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse public key: %w", err)
+			}
+			key = k
+		case "RSA PUBLIC KEY":
+			k, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse RSA public key: %w", err)
+			}
+			key = k
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse certificate: %w", err)
+			}
+			key = cert.PublicKey
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %q; supported types: PUBLIC KEY, RSA PUBLIC KEY, CERTIFICATE", block.Type)
+		}
+		if !isKeyCompatibleWithMethod(key, jwt.SigningMethodRS256) &&
+			!isKeyCompatibleWithMethod(key, jwt.SigningMethodES256) &&
+			!isKeyCompatibleWithMethod(key, jwt.SigningMethodEdDSA) {
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+		keys = append(keys, jwtKey{
+			key: key,
+		})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("cannot find PEM-encoded public keys")
+	}
+	return keys, nil
+}
+
+// jwk represents JSON Web Key. See https://www.rfc-editor.org/rfc/rfc7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA key params
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP key params
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(data []byte) ([]jwtKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal JWKS: %w", err)
+	}
+	var keys []jwtKey
+	for i, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			// Skip keys, which cannot be used for signature verification.
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse key #%d with kid=%q: %w", i+1, k.Kid, err)
+		}
+		keys = append(keys, jwtKey{
+			kid: k.Kid,
+			key: key,
+		})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("cannot find signing keys in JWKS")
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `n`: %w", err)
+		}
+		e, err := decodeJWKBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `e`: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("too big `e`")
+		}
+		return &rsa.PublicKey{
+			N: n,
+			E: int(e.Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported `crv`: %q; supported values: P-256, P-384, P-521", k.Crv)
+		}
+		x, err := decodeJWKBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `x`: %w", err)
+		}
+		y, err := decodeJWKBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `y`: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("the point isn't on the %s curve", k.Crv)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     x,
+			Y:     y,
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported `crv`: %q; supported values: Ed25519", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `x`: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unexpected `x` size; got %d bytes; want %d bytes", len(x), ed25519.PublicKeySize)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported `kty`: %q; supported values: RSA, EC, OKP", k.Kty)
+	}
+}
+
+func decodeJWKBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// getBearerTokenFromAuthTokens returns JWT from the given auth tokens obtained via getAuthTokensFromRequest.
+func getBearerTokenFromAuthTokens(ats []string) string {
+	for _, at := range ats {
+		if token, ok := strings.CutPrefix(at, "http_auth:Bearer "); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// getUserInfoByJWT returns the first user with the `jwt` section, which successfully verifies the bearer token from ats.
+func getUserInfoByJWT(ats []string) (*UserInfo, jwtClaims) {
+	uis := authConfig.Load().jwtUsers
+	if len(uis) == 0 {
+		return nil, nil
+	}
+	token := getBearerTokenFromAuthTokens(ats)
+	if token == "" {
+		return nil, nil
+	}
+	// Parse the token only once, since it may be verified against multiple users.
+	pt, err := parseJWT(token)
+	if err != nil {
+		return nil, nil
+	}
+	for _, ui := range uis {
+		claims, err := ui.JWT.verify(pt)
+		if err == nil {
+			return ui, claims
+		}
+	}
+	return nil, nil
+}
+
+// getClaimValues returns string values for the claim with the given name.
+//
+// Nested claims can be referred via dot-separated path such as `realm_access.roles`.
+func getClaimValues(claims map[string]any, name string) ([]string, bool) {
+	var v any = claims
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	switch x := v.(type) {
+	case []any:
+		vs := make([]string, 0, len(x))
+		for _, xx := range x {
+			s, ok := formatClaimValue(xx)
+			if !ok {
+				return nil, false
+			}
+			vs = append(vs, s)
+		}
+		return vs, true
+	default:
+		s, ok := formatClaimValue(x)
+		if !ok {
+			return nil, false
+		}
+		return []string{s}, true
+	}
+}
+
+func formatClaimValue(v any) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(x), true
+	default:
+		return "", false
+	}
+}
+
+func matchClaim(claims map[string]any, qa *QueryArg) bool {
+	vs, ok := getClaimValues(claims, qa.Name)
+	if !ok {
+		return false
+	}
+	for _, v := range vs {
+		if qa.Value.match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyClaim(qas []*QueryArg, claims jwtClaims) bool {
+	if len(qas) == 0 {
+		return true
+	}
+	for _, qa := range qas {
+		if matchClaim(claims, qa) {
+			return true
+		}
+	}
+	return false
+}
+
+var claimPlaceholderRegexp = regexp.MustCompile(`\{\{\s*\.claims\.([^}\s]+)\s*\}\}`)
+
+// substituteClaims replaces `{{.claims.<name>}}` placeholders in s with the corresponding claim values.
+//
+// Multiple claim values are joined with comma.
+func substituteClaims(s string, claims jwtClaims) (string, error) {
+	if !strings.Contains(s, "{{") {
+		// Fast path - nothing to substitute
+		return s, nil
+	}
+	var err error
+	result := claimPlaceholderRegexp.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name := claimPlaceholderRegexp.FindStringSubmatch(placeholder)[1]
+		vs, ok := getClaimValues(claims, name)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("missing claim %q or it has unsupported type", name)
+			}
+			return ""
+		}
+		return strings.Join(vs, ",")
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// substituteClaimsInHeaders returns hc with `{{.claims.<name>}}` placeholders substituted in request headers.
+func substituteClaimsInHeaders(hc HeadersConf, claims jwtClaims) (HeadersConf, error) {
+	if claims == nil || len(hc.RequestHeaders) == 0 {
+		return hc, nil
+	}
+	headers := make([]*Header, len(hc.RequestHeaders))
+	for i, h := range hc.RequestHeaders {
+		v, err := substituteClaims(h.Value, claims)
+		if err != nil {
+			return hc, fmt.Errorf("cannot substitute claims in header %q: %w", h.Name, err)
+		}
+		headers[i] = &Header{
+			Name:      h.Name,
+			Value:     v,
+			sOriginal: h.sOriginal,
+		}
+	}
+	hc.RequestHeaders = headers
+	return hc, nil
+}
+
+// substituteClaimsInQueryArgs returns a copy of u with `{{.claims.<name>}}` placeholders substituted in query args.
+func substituteClaimsInQueryArgs(u *url.URL, claims jwtClaims) (*url.URL, error) {
+	if claims == nil || !strings.Contains(u.RawQuery, "{{") && !strings.Contains(u.RawQuery, "%7B%7B") {
+		return u, nil
+	}
+	args := u.Query()
+	for k, vs := range args {
+		for i, v := range vs {
+			vNew, err := substituteClaims(v, claims)
+			if err != nil {
+				return nil, fmt.Errorf("cannot substitute claims in query arg %q: %w", k, err)
+			}
+			vs[i] = vNew
+		}
+	}
+	uCopy := *u
+	uCopy.RawQuery = args.Encode()
+	return &uCopy, nil
+}
+
+func handleInvalidClaimsError(w http.ResponseWriter, r *http.Request, err error) {
+	invalidClaimsRequests.Inc()
+	err = &httpserver.ErrorWithStatusCode{
+		Err:        err,
+		StatusCode: http.StatusForbidden,
+	}
+	httpserver.Errorf(w, r, "%s", err)
+}
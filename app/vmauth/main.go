@@ -6,12 +6,14 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +31,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
 )
 
 var (
@@ -157,7 +160,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		// Process requests for unauthorized users
 		ui := authConfig.Load().UnauthorizedUser
 		if ui != nil {
-			processUserRequest(w, r, ui)
+			processUserRequest(w, r, ui, nil)
 			return true
 		}
 
@@ -166,10 +169,14 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 
 	ui := getUserInfoByAuthTokens(ats)
+	var claims jwtClaims
+	if ui == nil {
+		ui, claims = getUserInfoByJWT(ats)
+	}
 	if ui == nil {
 		uu := authConfig.Load().UnauthorizedUser
 		if uu != nil {
-			processUserRequest(w, r, uu)
+			processUserRequest(w, r, uu, nil)
 			return true
 		}
 
@@ -187,7 +194,7 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return true
 	}
 
-	processUserRequest(w, r, ui)
+	processUserRequest(w, r, ui, claims)
 	return true
 }
 
@@ -202,7 +209,10 @@ func getUserInfoByAuthTokens(ats []string) *UserInfo {
 	return nil
 }
 
-func processUserRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
+// processUserRequest proxies r according to ui config.
+//
+// claims must contain claims of the verified JWT if ui has `jwt` section.
+func processUserRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, claims jwtClaims) {
 	startTime := time.Now()
 	defer ui.requestsDuration.UpdateDuration(startTime)
 
@@ -223,21 +233,21 @@ func processUserRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
 		handleConcurrencyLimitError(w, r, err)
 		return
 	}
-	processRequest(w, r, ui)
+	processRequest(w, r, ui, claims)
 	ui.endConcurrencyLimit()
 	<-concurrencyLimitCh
 }
 
-func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
+func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo, claims jwtClaims) {
 	u := normalizeURL(r.URL)
-	up, hc := ui.getURLPrefixAndHeaders(u, r.Host, r.Header)
+	up, hc := ui.getURLPrefixAndHeaders(u, r.Host, r.Header, claims)
 	isDefault := false
 	if up == nil {
 		if ui.DefaultURL == nil {
 			// Authorization should be requested for http requests without credentials
 			// to a route that is not in the configuration for unauthorized user.
 			// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/5236
-			if ui.BearerToken == "" && ui.Username == "" && len(*authUsers.Load()) > 0 {
+			if ui.BearerToken == "" && ui.Username == "" && ui.JWT == nil && (len(*authUsers.Load()) > 0 || len(authConfig.Load().jwtUsers) > 0) {
 				handleMissingAuthorizationError(w)
 				return
 			}
@@ -253,6 +263,22 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
 		isDefault = true
 	}
 
+	// Limit the rate of requests and bytes per user and per url_map entry
+	if retryAfter, err := ui.beginRateLimit(r, up); err != nil {
+		handleRateLimitError(w, r, retryAfter, err)
+		return
+	}
+	bytesRateLimiters := ui.getBytesRateLimiters(up)
+
+	if claims != nil {
+		var err error
+		hc, err = substituteClaimsInHeaders(hc, claims)
+		if err != nil {
+			handleInvalidClaimsError(w, r, err)
+			return
+		}
+	}
+
 	rtb := newReadTrackingBody(r.Body, maxRequestBodySizeToRetry.IntN())
 	r.Body = rtb
 
@@ -262,7 +288,12 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
 		if bu == nil {
 			break
 		}
-		targetURL := bu.url
+		targetURL, err := substituteClaimsInQueryArgs(bu.url, claims)
+		if err != nil {
+			bu.put()
+			handleInvalidClaimsError(w, r, err)
+			return
+		}
 		// Don't change path and add request_path query param for default route.
 		if isDefault {
 			query := targetURL.Query()
@@ -274,7 +305,7 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
 
 		wasLocalRetry := false
 	again:
-		ok, needLocalRetry := tryProcessingRequest(w, r, targetURL, hc, up.retryStatusCodes, ui)
+		ok, needLocalRetry := tryProcessingRequest(w, r, targetURL, hc, up.retryStatusCodes, bytesRateLimiters, ui)
 		if needLocalRetry && !wasLocalRetry {
 			wasLocalRetry = true
 			goto again
@@ -294,7 +325,9 @@ func processRequest(w http.ResponseWriter, r *http.Request, ui *UserInfo) {
 	ui.backendErrors.Inc()
 }
 
-func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url.URL, hc HeadersConf, retryStatusCodes []int, ui *UserInfo) (bool, bool) {
+func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url.URL, hc HeadersConf, retryStatusCodes []int,
+	bytesRateLimiters []*ratelimiter.TokenBucket, ui *UserInfo,
+) (bool, bool) {
 	req := sanitizeRequestHeaders(r)
 
 	req.URL = targetURL
@@ -372,9 +405,17 @@ func tryProcessingRequest(w http.ResponseWriter, r *http.Request, targetURL *url
 	updateHeadersByConfig(w.Header(), hc.ResponseHeaders)
 	w.WriteHeader(res.StatusCode)
 
+	var body io.Reader = res.Body
+	if len(bytesRateLimiters) > 0 {
+		// Account the response body size at max_bytes_per_second limits.
+		body = &rateLimitedReader{
+			r:            res.Body,
+			rateLimiters: bytesRateLimiters,
+		}
+	}
 	copyBuf := copyBufPool.Get()
 	copyBuf.B = bytesutil.ResizeNoCopyNoOverallocate(copyBuf.B, 16*1024)
-	_, err = io.CopyBuffer(w, res.Body, copyBuf.B)
+	_, err = io.CopyBuffer(w, body, copyBuf.B)
 	copyBufPool.Put(copyBuf)
 	_ = res.Body.Close()
 	if err != nil && !netutil.IsTrivialNetworkError(err) {
@@ -472,6 +513,7 @@ var (
 	configReloadRequests     = metrics.NewCounter(`vmauth_http_requests_total{path="/-/reload"}`)
 	invalidAuthTokenRequests = metrics.NewCounter(`vmauth_http_request_errors_total{reason="invalid_auth_token"}`)
 	missingRouteRequests     = metrics.NewCounter(`vmauth_http_request_errors_total{reason="missing_route"}`)
+	invalidClaimsRequests    = metrics.NewCounter(`vmauth_http_request_errors_total{reason="invalid_jwt_claims"}`)
 )
 
 func newRoundTripper(caFileOpt, certFileOpt, keyFileOpt, serverNameOpt string, insecureSkipVerifyP *bool) (http.RoundTripper, error) {
@@ -563,6 +605,18 @@ func handleConcurrencyLimitError(w http.ResponseWriter, r *http.Request, err err
 	httpserver.Errorf(w, r, "%s", err)
 }
 
+func handleRateLimitError(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, err error) {
+	// Retry-After must contain an integer number of seconds.
+	// See https://www.rfc-editor.org/rfc/rfc9110#field.retry-after
+	retryAfterSecs := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(max(retryAfterSecs, 1), 10))
+	err = &httpserver.ErrorWithStatusCode{
+		Err:        err,
+		StatusCode: http.StatusTooManyRequests,
+	}
+	httpserver.Errorf(w, r, "%s", err)
+}
+
 // readTrackingBody must be obtained via getReadTrackingBody()
 type readTrackingBody struct {
 	// maxBodySize is the maximum body size to cache in buf.
@@ -51,7 +51,7 @@ func dropPrefixParts(path string, parts int) string {
 	return path
 }
 
-func (ui *UserInfo) getURLPrefixAndHeaders(u *url.URL, host string, h http.Header) (*URLPrefix, HeadersConf) {
+func (ui *UserInfo) getURLPrefixAndHeaders(u *url.URL, host string, h http.Header, claims jwtClaims) (*URLPrefix, HeadersConf) {
 	for _, e := range ui.URLMaps {
 		if !matchAnyRegex(e.SrcHosts, host) {
 			continue
@@ -65,6 +65,9 @@ func (ui *UserInfo) getURLPrefixAndHeaders(u *url.URL, host string, h http.Heade
 		if !matchAnyHeader(e.SrcHeaders, h) {
 			continue
 		}
+		if !matchAnyClaim(e.SrcClaims, claims) {
+			continue
+		}
 
 		return e.URLPrefix, e.HeadersConf
 	}
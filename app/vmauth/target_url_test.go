@@ -95,7 +95,7 @@ func TestCreateTargetURLSuccess(t *testing.T) {
 			t.Fatalf("cannot parse %q: %s", requestURI, err)
 		}
 		u = normalizeURL(u)
-		up, hc := ui.getURLPrefixAndHeaders(u, u.Host, nil)
+		up, hc := ui.getURLPrefixAndHeaders(u, u.Host, nil, nil)
 		if up == nil {
 			t.Fatalf("cannot match available backend: %s", err)
 			return
@@ -346,7 +346,7 @@ func TestUserInfoGetBackendURL_SRV(t *testing.T) {
 			t.Fatalf("cannot parse %q: %s", requestURI, err)
 		}
 		u = normalizeURL(u)
-		up, _ := ui.getURLPrefixAndHeaders(u, u.Host, nil)
+		up, _ := ui.getURLPrefixAndHeaders(u, u.Host, nil, nil)
 		if up == nil {
 			t.Fatalf("cannot match available backend: %s", err)
 			return
@@ -425,7 +425,7 @@ func TestUserInfoGetBackendURL_SRVZeroBackends(t *testing.T) {
 			t.Fatalf("cannot parse %q: %s", requestURI, err)
 		}
 		u = normalizeURL(u)
-		up, _ := ui.getURLPrefixAndHeaders(u, u.Host, nil)
+		up, _ := ui.getURLPrefixAndHeaders(u, u.Host, nil, nil)
 		if up == nil {
 			t.Fatalf("cannot match available backend: %s", err)
 		}
@@ -473,7 +473,7 @@ func TestCreateTargetURLFailure(t *testing.T) {
 			t.Fatalf("cannot parse %q: %s", requestURI, err)
 		}
 		u = normalizeURL(u)
-		up, hc := ui.getURLPrefixAndHeaders(u, u.Host, nil)
+		up, hc := ui.getURLPrefixAndHeaders(u, u.Host, nil, nil)
 		if up != nil {
 			t.Fatalf("unexpected non-empty up=%#v", up)
 		}
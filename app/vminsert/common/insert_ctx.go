@@ -3,6 +3,7 @@ package common
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
@@ -53,6 +56,13 @@ type InsertCtx struct {
 	mrs            []storage.MetricRow
 	metricNamesBuf []byte
 
+	exemplarRows []storage.ExemplarRow
+
+	// nhComponents and nhLabels are scratch buffers for WriteNativeHistogram.
+	// They aren't reset at Reset, since Reset may be called by FlushBufs while they are in use.
+	nhComponents []nativehistogram.Component
+	nhLabels     []prompb.Label
+
 	relabelCtx    relabel.Ctx
 	streamAggrCtx streamAggrCtx
 
@@ -75,6 +85,10 @@ func (ctx *InsertCtx) Reset(rowsLen int) {
 	ctx.mrs = mrs[:0]
 
 	ctx.metricNamesBuf = ctx.metricNamesBuf[:0]
+
+	clear(ctx.exemplarRows)
+	ctx.exemplarRows = ctx.exemplarRows[:0]
+
 	ctx.relabelCtx.Reset()
 	ctx.streamAggrCtx.Reset()
 	ctx.skipStreamAggr = false
@@ -131,6 +145,64 @@ func (ctx *InsertCtx) WriteDataPointExt(metricNameRaw []byte, labels []prompb.La
 	return metricNameRaw, err
 }
 
+// WriteExemplars writes exemplars for the series with the given metricNameRaw and labels into ctx buffer.
+//
+// caller must invoke TryPrepareLabels before using this function.
+// exemplars must remain valid until FlushBufs call.
+//
+// It returns metricNameRaw for the given labels if len(metricNameRaw) == 0.
+func (ctx *InsertCtx) WriteExemplars(metricNameRaw []byte, labels []prompb.Label, exemplars []prompb.Exemplar) []byte {
+	if len(exemplars) == 0 {
+		return metricNameRaw
+	}
+	if len(metricNameRaw) == 0 {
+		metricNameRaw = ctx.marshalMetricNameRaw(nil, labels)
+	}
+	for i := range exemplars {
+		ctx.exemplarRows = append(ctx.exemplarRows, storage.ExemplarRow{
+			MetricNameRaw: metricNameRaw,
+			Exemplar:      exemplars[i],
+		})
+	}
+	return metricNameRaw
+}
+
+// WriteNativeHistogram writes native histogram h with the given labels into ctx buffer.
+//
+// Every histogram component is written as a separate series with labels plus nativehistogram.ComponentLabel label.
+// Histograms with unsupported schemas are skipped.
+//
+// caller must invoke TryPrepareLabels before using this function.
+//
+// It returns the number of written rows.
+func (ctx *InsertCtx) WriteNativeHistogram(labels []prompb.Label, h *prompb.Histogram) (int, error) {
+	components, err := nativehistogram.AppendComponents(ctx.nhComponents[:0], h)
+	ctx.nhComponents = components
+	if err != nil {
+		unsupportedNativeHistograms.Inc()
+		unsupportedNativeHistogramLogger.Warnf("skipping native histogram for %s: %s", prompb.LabelsToString(labels), err)
+		return 0, nil
+	}
+	nhLabels := append(ctx.nhLabels[:0], labels...)
+	nhLabels = append(nhLabels, prompb.Label{
+		Name: nativehistogram.ComponentLabel,
+	})
+	ctx.nhLabels = nhLabels
+	componentLabel := &nhLabels[len(nhLabels)-1]
+	for _, c := range components {
+		componentLabel.Value = c.Name
+		if err := ctx.WriteDataPoint(nil, nhLabels, h.Timestamp, c.Value); err != nil {
+			return 0, err
+		}
+	}
+	return len(components), nil
+}
+
+var (
+	unsupportedNativeHistograms      = metrics.NewCounter(`vm_rows_ignored_total{reason="unsupported_native_histogram"}`)
+	unsupportedNativeHistogramLogger = logger.WithThrottler("unsupported_native_histogram", 5*time.Second)
+)
+
 func (ctx *InsertCtx) addRow(metricNameRaw []byte, timestamp int64, value float64) error {
 	mrs := ctx.mrs
 	if cap(mrs) > len(mrs) {
@@ -210,6 +282,9 @@ func (ctx *InsertCtx) FlushBufs() error {
 	// since the number of concurrent FlushBufs() calls should be already limited via writeconcurrencylimiter
 	// used at every stream.Parse() call under lib/protoparser/*
 
+	if len(ctx.exemplarRows) > 0 {
+		vmstorage.AddExemplars(ctx.exemplarRows)
+	}
 	err := vmstorage.AddRows(ctx.mrs)
 	ctx.Reset(0)
 	if err == nil {
@@ -0,0 +1,16 @@
+package common
+
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+// AddMetricsMetadata stores mms in the underlying storage.
+//
+// The caller must check whether metadata processing is enabled via -enableMetadata command-line flag.
+func AddMetricsMetadata(mms []prompb.MetricMetadata) {
+	if len(mms) == 0 {
+		return
+	}
+	vmstorage.AddMetricsMetadata(mms)
+}
@@ -22,6 +22,10 @@ var (
 	streamAggrConfig = flag.String("streamAggr.config", "", "Optional path to file with stream aggregation config. "+
 		"See https://docs.victoriametrics.com/victoriametrics/stream-aggregation/ . "+
 		"See also -streamAggr.keepInput, -streamAggr.dropInput and -streamAggr.dedupInterval")
+	streamAggrCarbonAggregationRules = flag.String("streamAggr.carbonAggregationRules", "", "Optional path to file with carbon aggregation rules. "+
+		"The rules are converted to stream aggregation configs, which are applied to Graphite metrics. This flag cannot be set together with -streamAggr.config. "+
+		"Use -streamAggr.keepInput for keeping the input metrics in the same way as carbon-aggregator does with FORWARD_ALL=True. "+
+		"See https://docs.victoriametrics.com/victoriametrics/integrations/graphite/#carbon-aggregation-rules")
 	streamAggrKeepInput = flag.Bool("streamAggr.keepInput", false, "Whether to keep all the input samples after the aggregation with -streamAggr.config. "+
 		"By default, only aggregated samples are dropped, while the remaining samples are stored in the database. "+
 		"See also -streamAggr.dropInput and https://docs.victoriametrics.com/victoriametrics/stream-aggregation/")
@@ -54,9 +58,9 @@ var (
 	deduplicator *streamaggr.Deduplicator
 )
 
-// CheckStreamAggrConfig checks config pointed by -stramaggr.config
+// CheckStreamAggrConfig checks config pointed by -streamAggr.config or -streamAggr.carbonAggregationRules
 func CheckStreamAggrConfig() error {
-	if *streamAggrConfig == "" {
+	if _, path := getStreamAggrConfigPath(); path == "" {
 		return nil
 	}
 	pushNoop := func(_ []prompb.TimeSeries) {}
@@ -67,9 +71,9 @@ func CheckStreamAggrConfig() error {
 		IgnoreFirstIntervals: *streamAggrIgnoreFirstIntervals,
 		EnableWindows:        *streamAggrEnableWindows,
 	}
-	sas, err := streamaggr.LoadFromFile(*streamAggrConfig, pushNoop, opts, "global")
+	sas, err := loadStreamAggrConfig(pushNoop, opts)
 	if err != nil {
-		return fmt.Errorf("error when loading -streamAggr.config=%q: %w", *streamAggrConfig, err)
+		return err
 	}
 	sas.MustStop()
 	return nil
@@ -80,7 +84,7 @@ func CheckStreamAggrConfig() error {
 // MustStopStreamAggr must be called when stream aggr is no longer needed.
 func InitStreamAggr() {
 	saCfgReloaderStopCh = make(chan struct{})
-	if *streamAggrConfig == "" {
+	if _, path := getStreamAggrConfigPath(); path == "" {
 		if *streamAggrDedupInterval > 0 {
 			deduplicator = streamaggr.NewDeduplicator(pushAggregateSeries, *streamAggrEnableWindows, *streamAggrDedupInterval, *streamAggrDropInputLabels, "global")
 		}
@@ -100,9 +104,9 @@ func InitStreamAggr() {
 		IgnoreOldSamples:     *streamAggrIgnoreOldSamples,
 		IgnoreFirstIntervals: *streamAggrIgnoreFirstIntervals,
 	}
-	sas, err := streamaggr.LoadFromFile(*streamAggrConfig, pushAggregateSeries, opts, "global")
+	sas, err := loadStreamAggrConfig(pushAggregateSeries, opts)
 	if err != nil {
-		logger.Fatalf("cannot load -streamAggr.config=%q: %s", *streamAggrConfig, err)
+		logger.Fatalf("%s", err)
 	}
 
 	sasGlobal.Store(sas)
@@ -125,7 +129,8 @@ func InitStreamAggr() {
 }
 
 func reloadStreamAggrConfig() {
-	logger.Infof("reloading -streamAggr.config=%q", *streamAggrConfig)
+	flagName, path := getStreamAggrConfigPath()
+	logger.Infof("reloading -%s=%q", flagName, path)
 	saCfgReloads.Inc()
 
 	opts := &streamaggr.Options{
@@ -134,26 +139,50 @@ func reloadStreamAggrConfig() {
 		IgnoreOldSamples:     *streamAggrIgnoreOldSamples,
 		IgnoreFirstIntervals: *streamAggrIgnoreFirstIntervals,
 	}
-	sasNew, err := streamaggr.LoadFromFile(*streamAggrConfig, pushAggregateSeries, opts, "global")
+	sasNew, err := loadStreamAggrConfig(pushAggregateSeries, opts)
 	if err != nil {
 		saCfgSuccess.Set(0)
 		saCfgReloadErr.Inc()
-		logger.Errorf("cannot reload -streamAggr.config=%q: use the previously loaded config; error: %s", *streamAggrConfig, err)
+		logger.Errorf("cannot reload -%s=%q: use the previously loaded config; error: %s", flagName, path, err)
 		return
 	}
 	sas := sasGlobal.Load()
 	if !sasNew.Equal(sas) {
 		sasOld := sasGlobal.Swap(sasNew)
 		sasOld.MustStop()
-		logger.Infof("successfully reloaded stream aggregation config at -streamAggr.config=%q", *streamAggrConfig)
+		logger.Infof("successfully reloaded stream aggregation config at -%s=%q", flagName, path)
 	} else {
-		logger.Infof("nothing changed in -streamAggr.config=%q", *streamAggrConfig)
+		logger.Infof("nothing changed in -%s=%q", flagName, path)
 		sasNew.MustStop()
 	}
 	saCfgSuccess.Set(1)
 	saCfgTimestamp.Set(fasttime.UnixTimestamp())
 }
 
+// getStreamAggrConfigPath returns the name and the value for the flag with the path to stream aggregation config.
+func getStreamAggrConfigPath() (string, string) {
+	if *streamAggrCarbonAggregationRules != "" {
+		return "streamAggr.carbonAggregationRules", *streamAggrCarbonAggregationRules
+	}
+	return "streamAggr.config", *streamAggrConfig
+}
+
+func loadStreamAggrConfig(pushFunc streamaggr.PushFunc, opts *streamaggr.Options) (*streamaggr.Aggregators, error) {
+	if *streamAggrConfig != "" && *streamAggrCarbonAggregationRules != "" {
+		return nil, fmt.Errorf("-streamAggr.config and -streamAggr.carbonAggregationRules cannot be set simultaneously")
+	}
+	flagName, path := getStreamAggrConfigPath()
+	loadFromFile := streamaggr.LoadFromFile
+	if *streamAggrCarbonAggregationRules != "" {
+		loadFromFile = streamaggr.LoadFromCarbonRulesFile
+	}
+	sas, err := loadFromFile(path, pushFunc, opts, "global")
+	if err != nil {
+		return nil, fmt.Errorf("cannot load -%s=%q: %w", flagName, path, err)
+	}
+	return sas, nil
+}
+
 // MustStopStreamAggr stops stream aggregators.
 func MustStopStreamAggr() {
 	close(saCfgReloaderStopCh)
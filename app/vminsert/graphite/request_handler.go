@@ -22,6 +22,13 @@ func InsertHandler(r io.Reader) error {
 	return stream.Parse(r, "", insertRows)
 }
 
+// PickleInsertHandler processes remote write for graphite pickle protocol.
+//
+// See https://graphite.readthedocs.io/en/latest/feeding-carbon.html#the-pickle-protocol
+func PickleInsertHandler(r io.Reader) error {
+	return stream.ParsePickle(r, insertRows)
+}
+
 func insertRows(rows []parser.Row) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
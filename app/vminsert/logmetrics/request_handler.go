@@ -0,0 +1,170 @@
+package logmetrics
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logmetrics"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var logMetricsConfig = flag.String("logMetrics.config", "", "Optional path to file with rules for deriving metrics from logs accepted at -logMetricsListenAddr "+
+	"and /logmetrics/api/v1/push . The path can point either to local file or to http url. The config is reloaded on SIGHUP signal. "+
+	"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#log-derived-metrics")
+
+var (
+	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="logmetrics"}`)
+	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="logmetrics"}`)
+)
+
+var (
+	processor *logmetrics.Processor
+
+	reloaderStopCh chan struct{}
+	reloaderWG     sync.WaitGroup
+)
+
+var (
+	configReloads      = metrics.NewCounter(`vminsert_logmetrics_config_reloads_total`)
+	configReloadErrors = metrics.NewCounter(`vminsert_logmetrics_config_reloads_errors_total`)
+	configSuccess      = metrics.NewGauge(`vminsert_logmetrics_config_last_reload_successful`, nil)
+	configTimestamp    = metrics.NewCounter(`vminsert_logmetrics_config_last_reload_success_timestamp_seconds`)
+)
+
+// Init initializes processing of logs according to -logMetrics.config.
+//
+// It does nothing if -logMetrics.config isn't set.
+// The config is reloaded on SIGHUP signal.
+func Init() {
+	if *logMetricsConfig == "" {
+		return
+	}
+	sighupCh := procutil.NewSighupChan()
+
+	p, err := logmetrics.LoadFromFile(*logMetricsConfig, pushAggregatedSeries)
+	if err != nil {
+		logger.Fatalf("cannot load -logMetrics.config=%q: %s", *logMetricsConfig, err)
+	}
+	processor = p
+	configSuccess.Set(1)
+	configTimestamp.Set(fasttime.UnixTimestamp())
+
+	reloaderStopCh = make(chan struct{})
+	reloaderWG.Add(1)
+	go func() {
+		defer reloaderWG.Done()
+		for {
+			select {
+			case <-sighupCh:
+			case <-reloaderStopCh:
+				return
+			}
+			reloadConfig()
+		}
+	}()
+}
+
+func reloadConfig() {
+	logger.Infof("reloading -logMetrics.config=%q", *logMetricsConfig)
+	configReloads.Inc()
+	ok, err := processor.Reload()
+	if err != nil {
+		configSuccess.Set(0)
+		configReloadErrors.Inc()
+		logger.Errorf("cannot reload -logMetrics.config=%q; continue using the previously loaded config; error: %s", *logMetricsConfig, err)
+		return
+	}
+	if ok {
+		logger.Infof("successfully reloaded -logMetrics.config=%q", *logMetricsConfig)
+	} else {
+		logger.Infof("-logMetrics.config=%q wasn't changed since the last reload", *logMetricsConfig)
+	}
+	configSuccess.Set(1)
+	configTimestamp.Set(fasttime.UnixTimestamp())
+}
+
+// Stop stops processing of logs.
+func Stop() {
+	if processor == nil {
+		return
+	}
+	close(reloaderStopCh)
+	reloaderWG.Wait()
+
+	processor.MustStop()
+	processor = nil
+}
+
+// IsEnabled returns true if -logMetrics.config is set.
+func IsEnabled() bool {
+	return *logMetricsConfig != ""
+}
+
+// InsertHandler processes log lines read from r.
+func InsertHandler(r io.Reader) error {
+	if processor == nil {
+		return fmt.Errorf("missing -logMetrics.config command-line flag")
+	}
+	return processor.ProcessStream(r)
+}
+
+// InsertHandlerForHTTP processes log lines from req body.
+func InsertHandlerForHTTP(req *http.Request) error {
+	encoding := req.Header.Get("Content-Encoding")
+	r, err := protoparserutil.GetUncompressedReader(req.Body, encoding)
+	if err != nil {
+		return fmt.Errorf("cannot read log lines: %w", err)
+	}
+	defer protoparserutil.PutUncompressedReader(r)
+	return InsertHandler(r)
+}
+
+func pushAggregatedSeries(tss []prompb.TimeSeries) {
+	ctx := common.GetInsertCtx()
+	defer common.PutInsertCtx(ctx)
+
+	rowsLen := 0
+	for i := range tss {
+		rowsLen += len(tss[i].Samples)
+	}
+	ctx.Reset(rowsLen)
+	rowsTotal := 0
+	hasRelabeling := relabel.HasRelabeling()
+	for i := range tss {
+		ts := &tss[i]
+		rowsTotal += len(ts.Samples)
+		ctx.Labels = ctx.Labels[:0]
+		for j := range ts.Labels {
+			label := &ts.Labels[j]
+			ctx.AddLabel(label.Name, label.Value)
+		}
+		if !ctx.TryPrepareLabels(hasRelabeling) {
+			continue
+		}
+		var metricNameRaw []byte
+		var err error
+		for j := range ts.Samples {
+			r := &ts.Samples[j]
+			metricNameRaw, err = ctx.WriteDataPointExt(metricNameRaw, ctx.Labels, r.Timestamp, r.Value)
+			if err != nil {
+				logger.Errorf("cannot write log-derived metrics to storage: %s", err)
+				return
+			}
+		}
+	}
+	rowsInserted.Add(rowsTotal)
+	rowsPerInsert.Update(float64(rowsTotal))
+	if err := ctx.FlushBufs(); err != nil {
+		logger.Errorf("cannot flush log-derived metrics to storage: %s", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/firehose"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/stream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
@@ -16,6 +17,9 @@ import (
 var (
 	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="opentelemetry"}`)
 	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="opentelemetry"}`)
+
+	metadataInserted  = metrics.NewCounter(`vm_metadata_inserted_total{type="opentelemetry"}`)
+	exemplarsInserted = metrics.NewCounter(`vm_exemplars_inserted_total{type="opentelemetry"}`)
 )
 
 // InsertHandler processes opentelemetry metrics.
@@ -33,7 +37,11 @@ func InsertHandler(req *http.Request) error {
 			return fmt.Errorf("json encoding isn't supported for opentelemetry format. Use protobuf encoding")
 		}
 	}
-	return stream.ParseStream(req.Body, encoding, processBody, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+	return stream.ParseStream(req.Body, encoding, processBody, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+		if promscrape.IsMetadataEnabled() {
+			common.AddMetricsMetadata(mms)
+			metadataInserted.Add(len(mms))
+		}
 		return insertRows(tss, extraLabels)
 	})
 }
@@ -48,6 +56,8 @@ func insertRows(tss []prompb.TimeSeries, extraLabels []prompb.Label) error {
 	}
 	ctx.Reset(rowsLen)
 	rowsTotal := 0
+	exemplarsTotal := 0
+	isExemplarsEnabled := promscrape.IsExemplarsEnabled()
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range tss {
 		ts := &tss[i]
@@ -72,8 +82,13 @@ func insertRows(tss []prompb.TimeSeries, extraLabels []prompb.Label) error {
 				return err
 			}
 		}
+		if isExemplarsEnabled && len(ts.Exemplars) > 0 {
+			ctx.WriteExemplars(metricNameRaw, ctx.Labels, ts.Exemplars)
+			exemplarsTotal += len(ts.Exemplars)
+		}
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
+	exemplarsInserted.Add(exemplarsTotal)
 	return ctx.FlushBufs()
 }
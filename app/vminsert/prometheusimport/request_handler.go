@@ -17,6 +17,8 @@ import (
 var (
 	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="prometheus"}`)
 	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="prometheus"}`)
+
+	metadataInserted = metrics.NewCounter(`vm_metadata_inserted_total{type="prometheus"}`)
 )
 
 // InsertHandler processes `/api/v1/import/prometheus` request.
@@ -30,13 +32,30 @@ func InsertHandler(req *http.Request) error {
 		return err
 	}
 	encoding := req.Header.Get("Content-Encoding")
-	return stream.Parse(req.Body, defaultTimestamp, encoding, true, promscrape.IsMetadataEnabled(), func(rows []prometheus.Row, _ []prometheus.Metadata) error {
+	return stream.Parse(req.Body, defaultTimestamp, encoding, true, promscrape.IsMetadataEnabled(), func(rows []prometheus.Row, mds []prometheus.Metadata) error {
+		insertMetadata(mds)
 		return insertRows(rows, extraLabels)
 	}, func(s string) {
 		httpserver.LogError(req, s)
 	})
 }
 
+func insertMetadata(mds []prometheus.Metadata) {
+	if len(mds) == 0 {
+		return
+	}
+	mms := make([]prompb.MetricMetadata, len(mds))
+	for i := range mds {
+		md := &mds[i]
+		mm := &mms[i]
+		mm.MetricFamilyName = md.Metric
+		mm.Type = md.Type
+		mm.Help = md.Help
+	}
+	common.AddMetricsMetadata(mms)
+	metadataInserted.Add(len(mms))
+}
+
 func insertRows(rows []prometheus.Row, extraLabels []prompb.Label) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
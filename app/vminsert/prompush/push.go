@@ -11,6 +11,9 @@ import (
 var (
 	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="promscrape"}`)
 	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="promscrape"}`)
+
+	metadataInserted  = metrics.NewCounter(`vm_metadata_inserted_total{type="promscrape"}`)
+	exemplarsInserted = metrics.NewCounter(`vm_exemplars_inserted_total{type="promscrape"}`)
 )
 
 const maxRowsPerBlock = 10000
@@ -20,6 +23,10 @@ func Push(wr *prompb.WriteRequest) {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
 
+	// Metadata is added to wr by promscrape only if -enableMetadata is set.
+	common.AddMetricsMetadata(wr.Metadata)
+	metadataInserted.Add(len(wr.Metadata))
+
 	tss := wr.Timeseries
 	for len(tss) > 0 {
 		// Process big tss in smaller blocks in order to reduce maximum memory usage
@@ -50,6 +57,7 @@ func push(ctx *common.InsertCtx, tss []prompb.TimeSeries) {
 	}
 	ctx.Reset(rowsLen)
 	rowsTotal := 0
+	exemplarsTotal := 0
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range tss {
 		ts := &tss[i]
@@ -72,9 +80,15 @@ func push(ctx *common.InsertCtx, tss []prompb.TimeSeries) {
 				return
 			}
 		}
+		// Exemplars are added to ts by promscrape only if -enableExemplars is set.
+		if len(ts.Exemplars) > 0 {
+			ctx.WriteExemplars(metricNameRaw, ctx.Labels, ts.Exemplars)
+			exemplarsTotal += len(ts.Exemplars)
+		}
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
+	exemplarsInserted.Add(exemplarsTotal)
 	if err := ctx.FlushBufs(); err != nil {
 		logger.Errorf("cannot flush promscrape data to storage: %s", err)
 	}
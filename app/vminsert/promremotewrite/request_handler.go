@@ -5,7 +5,9 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite/stream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 	"github.com/VictoriaMetrics/metrics"
@@ -14,21 +16,51 @@ import (
 var (
 	rowsInserted  = metrics.NewCounter(`vm_rows_inserted_total{type="promremotewrite"}`)
 	rowsPerInsert = metrics.NewHistogram(`vm_rows_per_insert{type="promremotewrite"}`)
+
+	metadataInserted  = metrics.NewCounter(`vm_metadata_inserted_total{type="promremotewrite"}`)
+	exemplarsInserted = metrics.NewCounter(`vm_exemplars_inserted_total{type="promremotewrite"}`)
+
+	nativeHistogramsInserted = metrics.NewCounter(`vm_native_histograms_inserted_total{type="promremotewrite"}`)
 )
 
 // InsertHandler processes remote write for prometheus.
-func InsertHandler(req *http.Request) error {
+//
+// Response headers with the number of written samples are set at w for Prometheus remote write 2.0 requests.
+func InsertHandler(w http.ResponseWriter, req *http.Request) error {
 	extraLabels, err := protoparserutil.GetExtraLabels(req)
 	if err != nil {
 		return err
 	}
 	isVMRemoteWrite := req.Header.Get("Content-Encoding") == "zstd"
-	return stream.Parse(req.Body, isVMRemoteWrite, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
-		return insertRows(tss, extraLabels)
+	isRemoteWriteV2, err := stream.IsRemoteWriteV2(req.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	var ws writtenStats
+	err = stream.Parse(req.Body, isVMRemoteWrite, isRemoteWriteV2, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+		if promscrape.IsMetadataEnabled() {
+			common.AddMetricsMetadata(mms)
+			metadataInserted.Add(len(mms))
+		}
+		return insertRows(tss, extraLabels, &ws)
 	})
+	if err != nil {
+		return err
+	}
+	if isRemoteWriteV2 {
+		stream.SetWrittenHeaders(w.Header(), ws.samples, ws.histograms, ws.exemplars)
+	}
+	return nil
+}
+
+// writtenStats holds the number of written samples, native histograms and exemplars.
+type writtenStats struct {
+	samples    int
+	histograms int
+	exemplars  int
 }
 
-func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompb.Label) error {
+func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompb.Label, ws *writtenStats) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
 
@@ -38,6 +70,11 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompb.Label) erro
 	}
 	ctx.Reset(rowsLen)
 	rowsTotal := 0
+	samplesTotal := 0
+	exemplarsTotal := 0
+	nativeHistogramsTotal := 0
+	isExemplarsEnabled := promscrape.IsExemplarsEnabled()
+	isNativeHistogramsEnabled := nativehistogram.IsEnabled()
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range timeseries {
 		ts := &timeseries[i]
@@ -55,6 +92,7 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompb.Label) erro
 		if !ctx.TryPrepareLabels(hasRelabeling) {
 			continue
 		}
+		samplesTotal += len(ts.Samples)
 		var metricNameRaw []byte
 		var err error
 		samples := ts.Samples
@@ -65,8 +103,30 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompb.Label) erro
 				return err
 			}
 		}
+		if isExemplarsEnabled && len(ts.Exemplars) > 0 {
+			ctx.WriteExemplars(metricNameRaw, ctx.Labels, ts.Exemplars)
+			exemplarsTotal += len(ts.Exemplars)
+		}
+		if isNativeHistogramsEnabled {
+			for j := range ts.Histograms {
+				n, err := ctx.WriteNativeHistogram(ctx.Labels, &ts.Histograms[j])
+				if err != nil {
+					return err
+				}
+				rowsTotal += n
+			}
+			nativeHistogramsTotal += len(ts.Histograms)
+		}
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
-	return ctx.FlushBufs()
+	exemplarsInserted.Add(exemplarsTotal)
+	nativeHistogramsInserted.Add(nativeHistogramsTotal)
+	if err := ctx.FlushBufs(); err != nil {
+		return err
+	}
+	ws.samples += samplesTotal
+	ws.histograms += nativeHistogramsTotal
+	ws.exemplars += exemplarsTotal
+	return nil
 }
@@ -18,6 +18,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
@@ -233,6 +234,69 @@ func (rss *Results) RunParallel(qt *querytracer.Tracer, f func(rs *Result, worke
 	return err
 }
 
+// RunSorted runs f sequentially for all the time series in rss in the order defined by sort keys returned from appendSortKey.
+//
+// Unlike RunParallel, time series are unpacked one by one, so f may stream them to the client without holding all of them in memory.
+// Only the sort keys for all the time series are held in memory.
+// f shouldn't hold references to rs after returning.
+//
+// rss becomes unusable after the call to RunSorted.
+func (rss *Results) RunSorted(qt *querytracer.Tracer, appendSortKey func(dst []byte, mn *storage.MetricName) []byte, f func(rs *Result) error) error {
+	qt = qt.NewChild("sorted process of fetched data")
+	defer rss.mustClose()
+
+	// Build sort keys for all the time series.
+	var mn storage.MetricName
+	var keysBuf []byte
+	keys := make([]string, len(rss.packedTimeseries))
+	for i := range rss.packedTimeseries {
+		pts := &rss.packedTimeseries[i]
+		if err := mn.Unmarshal(bytesutil.ToUnsafeBytes(pts.metricName)); err != nil {
+			return fmt.Errorf("cannot unmarshal metricName %q: %w", pts.metricName, err)
+		}
+		keysBufLen := len(keysBuf)
+		keysBuf = appendSortKey(keysBuf, &mn)
+		keys[i] = bytesutil.ToUnsafeString(keysBuf[keysBufLen:])
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return keys[order[i]] < keys[order[j]]
+	})
+	qt.Printf("sort %d series", len(order))
+
+	var tsw timeseriesWork
+	var mustStop atomic.Bool
+	tsw.rss = rss
+	tsw.mustStop = &mustStop
+	tsw.f = func(rs *Result, _ uint) error {
+		return f(rs)
+	}
+	tmpResult := getTmpResult()
+	rowsProcessedTotal := 0
+	var err error
+	for _, idx := range order {
+		tsw.pts = &rss.packedTimeseries[idx]
+		err = tsw.do(&tmpResult.rs, 0)
+		rowsReadPerSeries.Update(float64(tsw.rowsProcessed))
+		rowsProcessedTotal += tsw.rowsProcessed
+		if err != nil {
+			break
+		}
+	}
+	putTmpResult(tmpResult)
+
+	seriesProcessedTotal := len(rss.packedTimeseries)
+	rss.packedTimeseries = rss.packedTimeseries[:0]
+	rowsReadPerQuery.Update(float64(rowsProcessedTotal))
+	seriesReadPerQuery.Update(float64(seriesProcessedTotal))
+
+	qt.Donef("series=%d, samples=%d", seriesProcessedTotal, rowsProcessedTotal)
+	return err
+}
+
 func (rss *Results) runParallel(qt *querytracer.Tracer, f func(rs *Result, workerID uint) error) (int, error) {
 	tswsLen := len(rss.packedTimeseries)
 	if tswsLen == 0 {
@@ -618,7 +682,10 @@ func mergeSortBlocks(dst *Result, sbh *sortBlocksHeap, dedupInterval int64) {
 			putSortBlock(top)
 		}
 	}
-	timestamps, values := storage.DeduplicateSamples(dst.Timestamps, dst.Values, dedupInterval)
+	// Apply downsampling at query time in the same way as it is applied during background merges,
+	// so query results do not depend on whether the samples have been already merged.
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	timestamps, values := storage.DownsampleSamples(dst.Timestamps, dst.Values, dedupInterval, currentTimestamp)
 	dedups := len(dst.Timestamps) - len(timestamps)
 	dedupsDuringSelect.Add(dedups)
 	dst.Timestamps = timestamps
@@ -1115,6 +1182,33 @@ func SearchMetricNames(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline
 	return metricNames, nil
 }
 
+// SearchSeriesCount returns the number of series for the given sq until the given deadline.
+//
+// sq.MaxMetrics+1 is returned if the number of series exceeds sq.MaxMetrics.
+func SearchSeriesCount(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline) (int, error) {
+	qt = qt.NewChild("fetch series count: %s", sq)
+	defer qt.Done()
+	if deadline.Exceeded() {
+		return 0, fmt.Errorf("timeout exceeded before starting to search series count: %s", deadline.String())
+	}
+
+	// Setup search.
+	tr := sq.GetTimeRange()
+	if err := vmstorage.CheckTimeRange(tr); err != nil {
+		return 0, err
+	}
+	tfss, err := setupTfss(qt, tr, sq.TagFilterss, sq.MaxMetrics, deadline)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := vmstorage.SearchSeriesCount(qt, tfss, tr, sq.MaxMetrics, deadline.Deadline())
+	if err != nil {
+		return 0, fmt.Errorf("cannot find series count: %w", err)
+	}
+	return n, nil
+}
+
 // ProcessSearchQuery performs sq until the given deadline.
 //
 // Results.RunParallel or Results.Cancel must be called on the returned Results.
@@ -1382,3 +1476,53 @@ func ResetMetricNamesStats(qt *querytracer.Tracer) error {
 	vmstorage.ResetMetricNamesStats(qt)
 	return nil
 }
+
+// MetricsMetadata returns metrics metadata for the given metricFamilyName until the given deadline.
+//
+// Metadata for all the metric names is returned if metricFamilyName is empty.
+func MetricsMetadata(qt *querytracer.Tracer, metricFamilyName string, limit, limitPerMetric int, deadline searchutil.Deadline) ([]prompb.MetricMetadata, error) {
+	qt = qt.NewChild("get metrics metadata: metric=%q, limit=%d, limit_per_metric=%d", metricFamilyName, limit, limitPerMetric)
+	defer qt.Done()
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	return vmstorage.SearchMetricsMetadata(qt, metricFamilyName, limit, limitPerMetric), nil
+}
+
+// SeriesExemplars contains exemplars for a single series.
+type SeriesExemplars struct {
+	// MetricName is marshaled storage.MetricName for the series.
+	MetricName string
+
+	// Exemplars contains exemplars for the series sorted by timestamp.
+	Exemplars []prompb.Exemplar
+}
+
+// QueryExemplars returns exemplars for series matching the given sq until the given deadline.
+//
+// Series without exemplars on the sq time range are skipped.
+func QueryExemplars(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline) ([]SeriesExemplars, error) {
+	qt = qt.NewChild("query exemplars: %s", sq)
+	defer qt.Done()
+
+	metricNames, err := SearchMetricNames(qt, sq, deadline)
+	if err != nil {
+		return nil, err
+	}
+	tr := sq.GetTimeRange()
+	var result []SeriesExemplars
+	exemplarsCount := 0
+	for _, metricName := range metricNames {
+		exemplars := vmstorage.SearchExemplars(metricName, tr)
+		if len(exemplars) == 0 {
+			continue
+		}
+		result = append(result, SeriesExemplars{
+			MetricName: metricName,
+			Exemplars:  exemplars,
+		})
+		exemplarsCount += len(exemplars)
+	}
+	qt.Printf("found %d exemplars for %d out of %d series", exemplarsCount, len(result), len(metricNames))
+	return result, nil
+}
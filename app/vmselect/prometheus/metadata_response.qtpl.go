@@ -0,0 +1,114 @@
+// Code generated by qtc from "metadata_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vmselect/prometheus/metadata_response.qtpl:3
+package prometheus
+
+//line app/vmselect/prometheus/metadata_response.qtpl:3
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+)
+
+// MetadataResponse generates response for /api/v1/metadata .mms must be sorted by MetricFamilyName.See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+
+//line app/vmselect/prometheus/metadata_response.qtpl:11
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vmselect/prometheus/metadata_response.qtpl:11
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vmselect/prometheus/metadata_response.qtpl:11
+func StreamMetadataResponse(qw422016 *qt422016.Writer, mms []prompb.MetricMetadata, qt *querytracer.Tracer) {
+//line app/vmselect/prometheus/metadata_response.qtpl:11
+	qw422016.N().S(`{"status":"success","data":{`)
+//line app/vmselect/prometheus/metadata_response.qtpl:15
+	for i := range mms {
+//line app/vmselect/prometheus/metadata_response.qtpl:16
+		mm := &mms[i]
+
+//line app/vmselect/prometheus/metadata_response.qtpl:17
+		if i == 0 || mms[i-1].MetricFamilyName != mm.MetricFamilyName {
+//line app/vmselect/prometheus/metadata_response.qtpl:18
+			if i > 0 {
+//line app/vmselect/prometheus/metadata_response.qtpl:18
+				qw422016.N().S(`],`)
+//line app/vmselect/prometheus/metadata_response.qtpl:18
+			}
+//line app/vmselect/prometheus/metadata_response.qtpl:19
+			qw422016.N().Q(mm.MetricFamilyName)
+//line app/vmselect/prometheus/metadata_response.qtpl:19
+			qw422016.N().S(`:[`)
+//line app/vmselect/prometheus/metadata_response.qtpl:20
+		} else {
+//line app/vmselect/prometheus/metadata_response.qtpl:20
+			qw422016.N().S(`,`)
+//line app/vmselect/prometheus/metadata_response.qtpl:22
+		}
+//line app/vmselect/prometheus/metadata_response.qtpl:22
+		qw422016.N().S(`{"type":`)
+//line app/vmselect/prometheus/metadata_response.qtpl:24
+		qw422016.N().Q(prompb.MetricMetadataType(mm.Type).String())
+//line app/vmselect/prometheus/metadata_response.qtpl:24
+		qw422016.N().S(`,"help":`)
+//line app/vmselect/prometheus/metadata_response.qtpl:25
+		qw422016.N().Q(mm.Help)
+//line app/vmselect/prometheus/metadata_response.qtpl:25
+		qw422016.N().S(`,"unit":`)
+//line app/vmselect/prometheus/metadata_response.qtpl:26
+		qw422016.N().Q(mm.Unit)
+//line app/vmselect/prometheus/metadata_response.qtpl:26
+		qw422016.N().S(`}`)
+//line app/vmselect/prometheus/metadata_response.qtpl:28
+	}
+//line app/vmselect/prometheus/metadata_response.qtpl:29
+	if len(mms) > 0 {
+//line app/vmselect/prometheus/metadata_response.qtpl:29
+		qw422016.N().S(`]`)
+//line app/vmselect/prometheus/metadata_response.qtpl:29
+	}
+//line app/vmselect/prometheus/metadata_response.qtpl:29
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/metadata_response.qtpl:32
+	qt.Printf("generate response for %d metadata entries", len(mms))
+	qt.Done()
+
+//line app/vmselect/prometheus/metadata_response.qtpl:35
+	streamdumpQueryTrace(qw422016, qt)
+//line app/vmselect/prometheus/metadata_response.qtpl:35
+	qw422016.N().S(`}`)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+}
+
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+func WriteMetadataResponse(qq422016 qtio422016.Writer, mms []prompb.MetricMetadata, qt *querytracer.Tracer) {
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	StreamMetadataResponse(qw422016, mms, qt)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	qt422016.ReleaseWriter(qw422016)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+}
+
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+func MetadataResponse(mms []prompb.MetricMetadata, qt *querytracer.Tracer) string {
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	WriteMetadataResponse(qb422016, mms, qt)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	qs422016 := string(qb422016.B)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+	return qs422016
+//line app/vmselect/prometheus/metadata_response.qtpl:37
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/querylog"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/querystats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bufferedwriter"
@@ -643,6 +644,104 @@ func LabelsHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseW
 
 var labelsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/labels"}`)
 
+// MetadataHandler processes /api/v1/metadata request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+func MetadataHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer metadataDuration.UpdateDuration(startTime)
+
+	deadline := searchutil.GetDeadlineForStatusRequest(r, startTime)
+	limit, err := httputil.GetInt(r, "limit")
+	if err != nil {
+		return err
+	}
+	limitPerMetric, err := httputil.GetInt(r, "limit_per_metric")
+	if err != nil {
+		return err
+	}
+	metricFamilyName := r.FormValue("metric")
+	mms, err := netstorage.MetricsMetadata(qt, metricFamilyName, limit, limitPerMetric, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain metrics metadata: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteMetadataResponse(bw, mms, qt)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send metadata response to remote client: %w", err)
+	}
+	return nil
+}
+
+var metadataDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/metadata"}`)
+
+// QueryExemplarsHandler processes /api/v1/query_exemplars request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func QueryExemplarsHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryExemplarsDuration.UpdateDuration(startTime)
+
+	cp, err := getCommonParamsForLabelsAPI(r, startTime, false)
+	if err != nil {
+		return err
+	}
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.IntN() {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	tfss, err := getTagFilterssFromQuery(query)
+	if err != nil {
+		return err
+	}
+	etfs, err := searchutil.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	tfss = searchutil.JoinTagFilterss(tfss, etfs)
+
+	sq := storage.NewSearchQuery(cp.start, cp.end, tfss, *maxSeriesLimit)
+	ses, err := netstorage.QueryExemplars(qt, sq, cp.deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain exemplars: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryExemplarsResponse(bw, ses, qt)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send exemplars response to remote client: %w", err)
+	}
+	return nil
+}
+
+var queryExemplarsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_exemplars"}`)
+
+// getTagFilterssFromQuery returns or-delimited tag filters for all the series selectors in the given query.
+func getTagFilterssFromQuery(query string) ([][]storage.TagFilter, error) {
+	e, err := metricsql.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	var tfss [][]storage.TagFilter
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok || me.IsEmpty() {
+			return
+		}
+		tfss = append(tfss, searchutil.ToTagFilterss(me.LabelFilterss)...)
+	})
+	if len(tfss) == 0 {
+		return nil, fmt.Errorf("query %q must contain at least a single series selector", query)
+	}
+	return tfss, nil
+}
+
 // SeriesCountHandler processes /api/v1/series/count request.
 func SeriesCountHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
 	defer seriesCountDuration.UpdateDuration(startTime)
@@ -827,7 +926,9 @@ func QueryHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWr
 	qs := promql.NewQueryStats(query, nil, ec)
 	ec.QueryStats = qs
 
+	execStartTime := time.Now()
 	result, err := promql.Exec(qt, ec, query, true)
+	logQuery(r, ec, query, execStartTime, err)
 	if err != nil {
 		return fmt.Errorf("error when executing query=%q for (time=%d, step=%d): %w", query, start, step, err)
 	}
@@ -937,7 +1038,9 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	qs := promql.NewQueryStats(query, nil, ec)
 	ec.QueryStats = qs
 
+	execStartTime := time.Now()
 	result, err := promql.Exec(qt, ec, query, false)
+	logQuery(r, ec, query, execStartTime, err)
 	if err != nil {
 		return err
 	}
@@ -969,6 +1072,25 @@ func queryRangeHandler(qt *querytracer.Tracer, startTime time.Time, w http.Respo
 	return nil
 }
 
+// logQuery writes the query executed with the given ec into the query log if it is enabled via -search.queryLog.path.
+func logQuery(r *http.Request, ec *promql.EvalConfig, query string, startTime time.Time, err error) {
+	if !querylog.Enabled() {
+		return
+	}
+	qs := ec.QueryStats
+	querylog.LogQuery(r, &querylog.Record{
+		Query:          query,
+		Start:          ec.Start,
+		End:            ec.End,
+		Step:           ec.Step,
+		StartTime:      startTime,
+		SeriesFetched:  qs.SeriesFetched.Load(),
+		SamplesScanned: qs.SamplesScanned.Load(),
+		MemoryUsage:    qs.MemoryUsage.Load(),
+		Err:            err,
+	})
+}
+
 func removeEmptyValuesAndTimeseries(tss []netstorage.Result) []netstorage.Result {
 	dst := tss[:0]
 	for i := range tss {
@@ -1012,6 +1134,105 @@ func removeEmptyValuesAndTimeseries(tss []netstorage.Result) []netstorage.Result
 
 var queryRangeDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_range"}`)
 
+// QueryCostHandler processes /api/v1/query_cost request.
+//
+// It estimates the number of series, raw samples and memory needed for the query execution without evaluating the query.
+// The query is estimated as an instant query at `time` if `start` arg is missing. Otherwise it is estimated as a range query.
+//
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#query-cost-estimation
+func QueryCostHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer queryCostDuration.UpdateDuration(startTime)
+
+	ct := startTime.UnixNano() / 1e6
+	deadline := searchutil.GetDeadlineForQuery(r, startTime)
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(query) > maxQueryLen.IntN() {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	var start, end, step int64
+	var err error
+	if r.FormValue("start") == "" {
+		start, err = httputil.GetTime(r, "time", ct)
+		if err != nil {
+			return err
+		}
+		end = start
+		lookbackDelta, err := getMaxLookback(r)
+		if err != nil {
+			return err
+		}
+		step, err = httputil.GetDuration(r, "step", lookbackDelta)
+		if err != nil {
+			return err
+		}
+	} else {
+		start, err = httputil.GetTime(r, "start", ct-defaultStep)
+		if err != nil {
+			return err
+		}
+		end, err = httputil.GetTime(r, "end", ct)
+		if err != nil {
+			return err
+		}
+		step, err = httputil.GetDuration(r, "step", defaultStep)
+		if err != nil {
+			return err
+		}
+	}
+	if step <= 0 {
+		step = defaultStep
+	}
+	if start > end {
+		end = start + defaultStep
+	}
+	scrapeInterval, err := httputil.GetDuration(r, "scrape_interval", defaultScrapeInterval)
+	if err != nil {
+		return err
+	}
+	if scrapeInterval <= 0 {
+		scrapeInterval = defaultScrapeInterval
+	}
+	etfs, err := searchutil.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+
+	ec := &promql.EvalConfig{
+		Start:               start,
+		End:                 end,
+		Step:                step,
+		MaxPointsPerSeries:  *maxPointsPerTimeseries,
+		MaxSeries:           GetMaxUniqueTimeSeries(),
+		QuotedRemoteAddr:    httpserver.GetQuotedRemoteAddr(r),
+		Deadline:            deadline,
+		EnforcedTagFilterss: etfs,
+		GetRequestURI: func() string {
+			return httpserver.GetRequestURI(r)
+		},
+	}
+	qc, err := promql.EstimateQueryCost(qt, ec, query, scrapeInterval)
+	if err != nil {
+		return fmt.Errorf("cannot estimate cost for query=%q on the time range (start=%d, end=%d, step=%d): %w", query, start, end, step, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryCostResponse(bw, qc, qt)
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot send query cost response to remote client: %w", err)
+	}
+	return nil
+}
+
+// defaultScrapeInterval is the default interval in milliseconds between raw samples used by /api/v1/query_cost for estimating the number of samples.
+const defaultScrapeInterval = 30 * 1000
+
+var queryCostDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_cost"}`)
+
 var nan = math.NaN()
 
 // adjustLastPoints substitutes the last point values on the time range (start..end]
@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
 
 func TestRemoveEmptyValuesAndTimeseries(t *testing.T) {
@@ -256,3 +258,80 @@ func TestCalculateMaxMetricsLimitByResource(t *testing.T) {
 	f(4, 0, 0)
 
 }
+
+func TestMetadataResponse(t *testing.T) {
+	f := func(mms []prompb.MetricMetadata, resultExpected string) {
+		t.Helper()
+		result := MetadataResponse(mms, nil)
+		if result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(nil, `{"status":"success","data":{}}`)
+	f([]prompb.MetricMetadata{
+		{MetricFamilyName: "foo", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "foo help"},
+	}, `{"status":"success","data":{"foo":[{"type":"counter","help":"foo help","unit":""}]}}`)
+	f([]prompb.MetricMetadata{
+		{MetricFamilyName: "bar", Type: uint32(prompb.MetricMetadataHISTOGRAM), Unit: "seconds"},
+		{MetricFamilyName: "foo", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "a"},
+		{MetricFamilyName: "foo", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "b\"c"},
+	}, `{"status":"success","data":{"bar":[{"type":"histogram","help":"","unit":"seconds"}],`+
+		`"foo":[{"type":"counter","help":"a","unit":""},{"type":"counter","help":"b\"c","unit":""}]}}`)
+}
+
+func TestQueryExemplarsResponse(t *testing.T) {
+	f := func(ses []netstorage.SeriesExemplars, resultExpected string) {
+		t.Helper()
+		result := QueryExemplarsResponse(ses, nil)
+		if result != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(nil, `{"status":"success","data":[]}`)
+
+	var mn storage.MetricName
+	mn.MetricGroup = []byte("foo_bucket")
+	mn.AddTag("le", "0.5")
+	f([]netstorage.SeriesExemplars{
+		{
+			MetricName: string(mn.Marshal(nil)),
+			Exemplars: []prompb.Exemplar{
+				{
+					Labels:    []prompb.Label{{Name: "trace_id", Value: "abc"}},
+					Value:     0.25,
+					Timestamp: 1600096945479,
+				},
+				{
+					Value:     0.5,
+					Timestamp: 1600096946000,
+				},
+			},
+		},
+	}, `{"status":"success","data":[{"seriesLabels":{"__name__":"foo_bucket","le":"0.5"},"exemplars":[`+
+		`{"labels":{"trace_id":"abc"},"value":"0.25","timestamp":1600096945.479},{"labels":{},"value":"0.5","timestamp":1600096946}]}]}`)
+}
+
+func TestGetTagFilterssFromQuery(t *testing.T) {
+	f := func(query string, tfssExpected int) {
+		t.Helper()
+		tfss, err := getTagFilterssFromQuery(query)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(tfss) != tfssExpected {
+			t.Fatalf("unexpected number of tag filters for %q; got %d; want %d", query, len(tfss), tfssExpected)
+		}
+	}
+
+	f(`foo`, 1)
+	f(`foo{bar="baz" or x="y"}`, 2)
+	f(`histogram_quantile(0.9, rate(foo_bucket[5m])) / sum(bar)`, 2)
+
+	for _, query := range []string{"", "foo(", "1+2"} {
+		if _, err := getTagFilterssFromQuery(query); err == nil {
+			t.Fatalf("expecting non-nil error for query %q", query)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Code generated by qtc from "query_cost_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line query_cost_response.qtpl:1
+package prometheus
+
+//line query_cost_response.qtpl:1
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+)
+
+// QueryCostResponse generates response for /api/v1/query_cost .
+
+//line query_cost_response.qtpl:8
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line query_cost_response.qtpl:8
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line query_cost_response.qtpl:8
+func StreamQueryCostResponse(qw422016 *qt422016.Writer, qc *promql.QueryCost, qt *querytracer.Tracer) {
+//line query_cost_response.qtpl:8
+	qw422016.N().S(`{"status":"success","data":{"series":`)
+//line query_cost_response.qtpl:12
+	qw422016.N().D(qc.Series)
+//line query_cost_response.qtpl:12
+	qw422016.N().S(`,"seriesLimitReached":`)
+//line query_cost_response.qtpl:13
+	if qc.SeriesLimitReached {
+//line query_cost_response.qtpl:13
+		qw422016.N().S(`true`)
+//line query_cost_response.qtpl:13
+	} else {
+//line query_cost_response.qtpl:13
+		qw422016.N().S(`false`)
+//line query_cost_response.qtpl:13
+	}
+//line query_cost_response.qtpl:13
+	qw422016.N().S(`,"samples":`)
+//line query_cost_response.qtpl:14
+	qw422016.N().DL(qc.Samples)
+//line query_cost_response.qtpl:14
+	qw422016.N().S(`,"memoryBytes":`)
+//line query_cost_response.qtpl:15
+	qw422016.N().DL(qc.MemoryBytes)
+//line query_cost_response.qtpl:15
+	qw422016.N().S(`,"selectors":[`)
+//line query_cost_response.qtpl:17
+	for i, sc := range qc.Selectors {
+//line query_cost_response.qtpl:17
+		qw422016.N().S(`{"selector":`)
+//line query_cost_response.qtpl:19
+		qw422016.N().Q(sc.Selector)
+//line query_cost_response.qtpl:19
+		qw422016.N().S(`,"start":`)
+//line query_cost_response.qtpl:20
+		qw422016.N().DL(sc.Start)
+//line query_cost_response.qtpl:20
+		qw422016.N().S(`,"end":`)
+//line query_cost_response.qtpl:21
+		qw422016.N().DL(sc.End)
+//line query_cost_response.qtpl:21
+		qw422016.N().S(`,"step":`)
+//line query_cost_response.qtpl:22
+		qw422016.N().DL(sc.Step)
+//line query_cost_response.qtpl:22
+		qw422016.N().S(`,"window":`)
+//line query_cost_response.qtpl:23
+		qw422016.N().DL(sc.Window)
+//line query_cost_response.qtpl:23
+		qw422016.N().S(`,"series":`)
+//line query_cost_response.qtpl:24
+		qw422016.N().D(sc.Series)
+//line query_cost_response.qtpl:24
+		qw422016.N().S(`,"seriesLimitReached":`)
+//line query_cost_response.qtpl:25
+		if sc.SeriesLimitReached {
+//line query_cost_response.qtpl:25
+			qw422016.N().S(`true`)
+//line query_cost_response.qtpl:25
+		} else {
+//line query_cost_response.qtpl:25
+			qw422016.N().S(`false`)
+//line query_cost_response.qtpl:25
+		}
+//line query_cost_response.qtpl:25
+		qw422016.N().S(`,"samples":`)
+//line query_cost_response.qtpl:26
+		qw422016.N().DL(sc.Samples)
+//line query_cost_response.qtpl:26
+		qw422016.N().S(`,"memoryBytes":`)
+//line query_cost_response.qtpl:27
+		qw422016.N().DL(sc.MemoryBytes)
+//line query_cost_response.qtpl:27
+		qw422016.N().S(`}`)
+//line query_cost_response.qtpl:29
+		if i+1 < len(qc.Selectors) {
+//line query_cost_response.qtpl:29
+			qw422016.N().S(`,`)
+//line query_cost_response.qtpl:29
+		}
+//line query_cost_response.qtpl:30
+	}
+//line query_cost_response.qtpl:30
+	qw422016.N().S(`]}`)
+//line query_cost_response.qtpl:33
+	qt.Done()
+
+//line query_cost_response.qtpl:34
+	streamdumpQueryTrace(qw422016, qt)
+//line query_cost_response.qtpl:34
+	qw422016.N().S(`}`)
+//line query_cost_response.qtpl:36
+}
+
+//line query_cost_response.qtpl:36
+func WriteQueryCostResponse(qq422016 qtio422016.Writer, qc *promql.QueryCost, qt *querytracer.Tracer) {
+//line query_cost_response.qtpl:36
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line query_cost_response.qtpl:36
+	StreamQueryCostResponse(qw422016, qc, qt)
+//line query_cost_response.qtpl:36
+	qt422016.ReleaseWriter(qw422016)
+//line query_cost_response.qtpl:36
+}
+
+//line query_cost_response.qtpl:36
+func QueryCostResponse(qc *promql.QueryCost, qt *querytracer.Tracer) string {
+//line query_cost_response.qtpl:36
+	qb422016 := qt422016.AcquireByteBuffer()
+//line query_cost_response.qtpl:36
+	WriteQueryCostResponse(qb422016, qc, qt)
+//line query_cost_response.qtpl:36
+	qs422016 := string(qb422016.B)
+//line query_cost_response.qtpl:36
+	qt422016.ReleaseByteBuffer(qb422016)
+//line query_cost_response.qtpl:36
+	return qs422016
+//line query_cost_response.qtpl:36
+}
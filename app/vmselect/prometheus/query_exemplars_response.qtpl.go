@@ -0,0 +1,192 @@
+// Code generated by qtc from "query_exemplars_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line query_exemplars_response.qtpl:3
+package prometheus
+
+//line query_exemplars_response.qtpl:3
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// QueryExemplarsResponse generates response for /api/v1/query_exemplars .See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+
+//line query_exemplars_response.qtpl:12
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line query_exemplars_response.qtpl:12
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line query_exemplars_response.qtpl:12
+func StreamQueryExemplarsResponse(qw422016 *qt422016.Writer, ses []netstorage.SeriesExemplars, qt *querytracer.Tracer) {
+//line query_exemplars_response.qtpl:12
+	qw422016.N().S(`{"status":"success","data":[`)
+//line query_exemplars_response.qtpl:17
+	var mn storage.MetricName
+	exemplarsCount := 0
+
+//line query_exemplars_response.qtpl:20
+	for i := range ses {
+//line query_exemplars_response.qtpl:21
+		se := &ses[i]
+
+//line query_exemplars_response.qtpl:21
+		qw422016.N().S(`{`)
+//line query_exemplars_response.qtpl:23
+		err := mn.UnmarshalString(se.MetricName)
+
+//line query_exemplars_response.qtpl:24
+		if err != nil {
+//line query_exemplars_response.qtpl:24
+			qw422016.N().S(`"seriesLabels":`)
+//line query_exemplars_response.qtpl:25
+			qw422016.N().Q(err.Error())
+//line query_exemplars_response.qtpl:25
+			qw422016.N().S(`,`)
+//line query_exemplars_response.qtpl:26
+		} else {
+//line query_exemplars_response.qtpl:26
+			qw422016.N().S(`"seriesLabels":`)
+//line query_exemplars_response.qtpl:27
+			streammetricNameObject(qw422016, &mn)
+//line query_exemplars_response.qtpl:27
+			qw422016.N().S(`,`)
+//line query_exemplars_response.qtpl:28
+		}
+//line query_exemplars_response.qtpl:28
+		qw422016.N().S(`"exemplars":[`)
+//line query_exemplars_response.qtpl:30
+		for j := range se.Exemplars {
+//line query_exemplars_response.qtpl:31
+			streamexemplarObject(qw422016, &se.Exemplars[j])
+//line query_exemplars_response.qtpl:32
+			if j+1 < len(se.Exemplars) {
+//line query_exemplars_response.qtpl:32
+				qw422016.N().S(`,`)
+//line query_exemplars_response.qtpl:32
+			}
+//line query_exemplars_response.qtpl:33
+		}
+//line query_exemplars_response.qtpl:33
+		qw422016.N().S(`]}`)
+//line query_exemplars_response.qtpl:36
+		exemplarsCount += len(se.Exemplars)
+
+//line query_exemplars_response.qtpl:37
+		if i+1 < len(ses) {
+//line query_exemplars_response.qtpl:37
+			qw422016.N().S(`,`)
+//line query_exemplars_response.qtpl:37
+		}
+//line query_exemplars_response.qtpl:38
+	}
+//line query_exemplars_response.qtpl:38
+	qw422016.N().S(`]`)
+//line query_exemplars_response.qtpl:41
+	qt.Printf("generate response: series=%d, exemplars=%d", len(ses), exemplarsCount)
+	qt.Done()
+
+//line query_exemplars_response.qtpl:44
+	streamdumpQueryTrace(qw422016, qt)
+//line query_exemplars_response.qtpl:44
+	qw422016.N().S(`}`)
+//line query_exemplars_response.qtpl:46
+}
+
+//line query_exemplars_response.qtpl:46
+func WriteQueryExemplarsResponse(qq422016 qtio422016.Writer, ses []netstorage.SeriesExemplars, qt *querytracer.Tracer) {
+//line query_exemplars_response.qtpl:46
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line query_exemplars_response.qtpl:46
+	StreamQueryExemplarsResponse(qw422016, ses, qt)
+//line query_exemplars_response.qtpl:46
+	qt422016.ReleaseWriter(qw422016)
+//line query_exemplars_response.qtpl:46
+}
+
+//line query_exemplars_response.qtpl:46
+func QueryExemplarsResponse(ses []netstorage.SeriesExemplars, qt *querytracer.Tracer) string {
+//line query_exemplars_response.qtpl:46
+	qb422016 := qt422016.AcquireByteBuffer()
+//line query_exemplars_response.qtpl:46
+	WriteQueryExemplarsResponse(qb422016, ses, qt)
+//line query_exemplars_response.qtpl:46
+	qs422016 := string(qb422016.B)
+//line query_exemplars_response.qtpl:46
+	qt422016.ReleaseByteBuffer(qb422016)
+//line query_exemplars_response.qtpl:46
+	return qs422016
+//line query_exemplars_response.qtpl:46
+}
+
+//line query_exemplars_response.qtpl:48
+func streamexemplarObject(qw422016 *qt422016.Writer, e *prompb.Exemplar) {
+//line query_exemplars_response.qtpl:48
+	qw422016.N().S(`{"labels":{`)
+//line query_exemplars_response.qtpl:51
+	for i := range e.Labels {
+//line query_exemplars_response.qtpl:52
+		label := &e.Labels[i]
+
+//line query_exemplars_response.qtpl:53
+		qw422016.N().Q(label.Name)
+//line query_exemplars_response.qtpl:53
+		qw422016.N().S(`:`)
+//line query_exemplars_response.qtpl:53
+		qw422016.N().Q(label.Value)
+//line query_exemplars_response.qtpl:54
+		if i+1 < len(e.Labels) {
+//line query_exemplars_response.qtpl:54
+			qw422016.N().S(`,`)
+//line query_exemplars_response.qtpl:54
+		}
+//line query_exemplars_response.qtpl:55
+	}
+//line query_exemplars_response.qtpl:55
+	qw422016.N().S(`},"value":"`)
+//line query_exemplars_response.qtpl:57
+	qw422016.N().F(e.Value)
+//line query_exemplars_response.qtpl:57
+	qw422016.N().S(`","timestamp":`)
+//line query_exemplars_response.qtpl:58
+	qw422016.N().F(float64(e.Timestamp) / 1e3)
+//line query_exemplars_response.qtpl:58
+	qw422016.N().S(`}`)
+//line query_exemplars_response.qtpl:60
+}
+
+//line query_exemplars_response.qtpl:60
+func writeexemplarObject(qq422016 qtio422016.Writer, e *prompb.Exemplar) {
+//line query_exemplars_response.qtpl:60
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line query_exemplars_response.qtpl:60
+	streamexemplarObject(qw422016, e)
+//line query_exemplars_response.qtpl:60
+	qt422016.ReleaseWriter(qw422016)
+//line query_exemplars_response.qtpl:60
+}
+
+//line query_exemplars_response.qtpl:60
+func exemplarObject(e *prompb.Exemplar) string {
+//line query_exemplars_response.qtpl:60
+	qb422016 := qt422016.AcquireByteBuffer()
+//line query_exemplars_response.qtpl:60
+	writeexemplarObject(qb422016, e)
+//line query_exemplars_response.qtpl:60
+	qs422016 := string(qb422016.B)
+//line query_exemplars_response.qtpl:60
+	qt422016.ReleaseByteBuffer(qb422016)
+//line query_exemplars_response.qtpl:60
+	return qs422016
+//line query_exemplars_response.qtpl:60
+}
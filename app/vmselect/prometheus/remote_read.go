@@ -0,0 +1,336 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// maxBytesInFrame is the maximum size of a single ChunkedReadResponse frame in streamed remote read response.
+//
+// This is the same value as Prometheus uses.
+const maxBytesInFrame = 1024 * 1024
+
+// RemoteReadHandler processes /api/v1/read request.
+//
+// Both samples and streamed XOR chunks response types are supported.
+// See https://prometheus.io/docs/prometheus/latest/querying/remote_read_api/
+func RemoteReadHandler(qt *querytracer.Tracer, startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	defer remoteReadDuration.UpdateDuration(startTime)
+
+	deadline := searchutil.GetDeadlineForExport(r, startTime)
+	rr, err := readRemoteReadRequest(r)
+	if err != nil {
+		return err
+	}
+	etfs, err := searchutil.GetExtraTagFilters(r)
+	if err != nil {
+		return err
+	}
+	sqs := make([]*storage.SearchQuery, len(rr.Queries))
+	for i := range rr.Queries {
+		q := &rr.Queries[i]
+		tfss := searchutil.JoinTagFilterss([][]storage.TagFilter{toTagFilters(q.Matchers)}, etfs)
+		sqs[i] = storage.NewSearchQuery(q.StartTimestampMs, q.EndTimestampMs, tfss, *maxExportSeries)
+	}
+
+	if getRemoteReadResponseType(rr.AcceptedResponseTypes) == prompb.ReadResponseTypeStreamedXORChunks {
+		remoteReadStreamedRequests.Inc()
+		return remoteReadStreamed(qt, w, sqs, deadline)
+	}
+	remoteReadSamplesRequests.Inc()
+	return remoteReadSamples(qt, w, sqs, deadline)
+}
+
+var (
+	remoteReadDuration         = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/read"}`)
+	remoteReadSamplesRequests  = metrics.NewCounter(`vm_remote_read_requests_total{response_type="samples"}`)
+	remoteReadStreamedRequests = metrics.NewCounter(`vm_remote_read_requests_total{response_type="streamed_xor_chunks"}`)
+)
+
+func readRemoteReadRequest(r *http.Request) (*prompb.ReadRequest, error) {
+	maxRequestLen := maxQueryLen.IntN()
+	compressed, err := io.ReadAll(io.LimitReader(r.Body, int64(maxRequestLen)+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read remote read request body: %w", err)
+	}
+	if len(compressed) > maxRequestLen {
+		return nil, fmt.Errorf("too big remote read request; mustn't exceed `-search.maxQueryLen=%d` bytes", maxRequestLen)
+	}
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode snappy-compressed remote read request: %w", err)
+	}
+	if n > maxRequestLen {
+		return nil, fmt.Errorf("too big remote read request after decompression; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", n, maxRequestLen)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode snappy-compressed remote read request: %w", err)
+	}
+	var rr prompb.ReadRequest
+	if err := rr.UnmarshalProtobuf(data); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal remote read request: %w", err)
+	}
+	for i := range rr.Queries {
+		if len(rr.Queries[i].Matchers) == 0 {
+			return nil, fmt.Errorf("query #%d in remote read request must contain at least a single matcher", i)
+		}
+	}
+	return &rr, nil
+}
+
+// getRemoteReadResponseType returns the first supported response type from accepted response types.
+//
+// Samples response type is returned if accepted response types are missing, as Prometheus does.
+func getRemoteReadResponseType(accepted []prompb.ReadResponseType) prompb.ReadResponseType {
+	for _, rt := range accepted {
+		switch rt {
+		case prompb.ReadResponseTypeSamples, prompb.ReadResponseTypeStreamedXORChunks:
+			return rt
+		}
+	}
+	return prompb.ReadResponseTypeSamples
+}
+
+func toTagFilters(matchers []prompb.LabelMatcher) []storage.TagFilter {
+	tfs := make([]storage.TagFilter, len(matchers))
+	for i := range matchers {
+		m := &matchers[i]
+		tf := &tfs[i]
+		if m.Name != "__name__" {
+			tf.Key = []byte(m.Name)
+		}
+		tf.Value = []byte(m.Value)
+		tf.IsNegative = m.Type == prompb.LabelMatcherNEQ || m.Type == prompb.LabelMatcherNRE
+		tf.IsRegexp = m.Type == prompb.LabelMatcherRE || m.Type == prompb.LabelMatcherNRE
+	}
+	return tfs
+}
+
+func remoteReadSamples(qt *querytracer.Tracer, w http.ResponseWriter, sqs []*storage.SearchQuery, deadline searchutil.Deadline) error {
+	var resp prompb.ReadResponse
+	resp.Results = make([]prompb.QueryResult, len(sqs))
+	for i, sq := range sqs {
+		var tssLock sync.Mutex
+		var tss []prompb.TimeSeries
+		err := processRemoteReadQuery(qt, sq, deadline, func(rs *netstorage.Result) {
+			samples := make([]prompb.Sample, len(rs.Timestamps))
+			for j, ts := range rs.Timestamps {
+				samples[j] = prompb.Sample{
+					Value:     rs.Values[j],
+					Timestamp: ts,
+				}
+			}
+			labels := metricNameToLabels(&rs.MetricName)
+
+			tssLock.Lock()
+			tss = append(tss, prompb.TimeSeries{
+				Labels:  labels,
+				Samples: samples,
+			})
+			tssLock.Unlock()
+		})
+		if err != nil {
+			return err
+		}
+		// Prometheus expects series sorted by labels.
+		sort.Slice(tss, func(i, j int) bool {
+			return compareLabels(tss[i].Labels, tss[j].Labels) < 0
+		})
+		resp.Results[i].Timeseries = tss
+	}
+
+	data := resp.MarshalProtobuf(nil)
+	compressed := snappy.Encode(nil, data)
+	qt.Printf("generate response with %d bytes, compressed to %d bytes", len(data), len(compressed))
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	if _, err := w.Write(compressed); err != nil && !netutil.IsTrivialNetworkError(err) {
+		return fmt.Errorf("cannot send remote read response to remote client: %w", err)
+	}
+	return nil
+}
+
+func remoteReadStreamed(qt *querytracer.Tracer, w http.ResponseWriter, sqs []*storage.SearchQuery, deadline searchutil.Deadline) error {
+	w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+
+	var frameBuf []byte
+	for i, sq := range sqs {
+		rss, err := netstorage.ProcessSearchQuery(qt, sq, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+		}
+		// Series must be sorted by labels, since Prometheus merges them with the series from other sources.
+		// Series are unpacked and sent one by one in sorted order, so the whole response isn't buffered in memory.
+		var labels []prompb.Label
+		var chunks []prompb.Chunk
+		err = rss.RunSorted(qt, appendRemoteReadSortKey, func(rs *netstorage.Result) error {
+			labels = appendMetricNameLabels(labels[:0], &rs.MetricName)
+			chunks = prompb.AppendXORChunks(chunks[:0], rs.Timestamps, rs.Values)
+			cs := prompb.ChunkedSeries{
+				Labels: labels,
+				Chunks: chunks,
+			}
+			var err error
+			frameBuf, err = writeChunkedSeries(bw, frameBuf[:0], &cs, int64(i))
+			return err
+		})
+		if err != nil {
+			if netutil.IsTrivialNetworkError(err) {
+				return nil
+			}
+			return fmt.Errorf("cannot send remote read response for %q to remote client: %w", sq, err)
+		}
+	}
+	return nil
+}
+
+// appendRemoteReadSortKey appends a key to dst, which sorts series in the same order as compareLabels does for labels returned from metricNameToLabels.
+func appendRemoteReadSortKey(dst []byte, mn *storage.MetricName) []byte {
+	labels := metricNameToLabels(mn)
+	return appendLabelsSortKey(dst, labels)
+}
+
+func appendLabelsSortKey(dst []byte, labels []prompb.Label) []byte {
+	for _, label := range labels {
+		dst = append(dst, label.Name...)
+		dst = append(dst, 0)
+		dst = append(dst, label.Value...)
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+// writeChunkedSeries writes cs to w in frames, which do not exceed maxBytesInFrame if possible.
+//
+// Every frame is flushed to the client as soon as it is written if w supports flushing.
+func writeChunkedSeries(w io.Writer, buf []byte, cs *prompb.ChunkedSeries, queryIndex int64) ([]byte, error) {
+	labelsSize := 0
+	for _, label := range cs.Labels {
+		labelsSize += len(label.Name) + len(label.Value)
+	}
+	chunks := cs.Chunks
+	for len(chunks) > 0 {
+		// Put at least a single chunk into every frame.
+		n := 1
+		frameSize := labelsSize + len(chunks[0].Data)
+		for n < len(chunks) && frameSize+len(chunks[n].Data) <= maxBytesInFrame {
+			frameSize += len(chunks[n].Data)
+			n++
+		}
+		crr := prompb.ChunkedReadResponse{
+			ChunkedSeries: []prompb.ChunkedSeries{
+				{
+					Labels: cs.Labels,
+					Chunks: chunks[:n],
+				},
+			},
+			QueryIndex: queryIndex,
+		}
+		buf = crr.MarshalProtobuf(buf[:0])
+		if err := writeChunkedFrame(w, buf); err != nil {
+			return buf, err
+		}
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return buf, err
+			}
+		}
+		chunks = chunks[n:]
+	}
+	return buf, nil
+}
+
+// writeChunkedFrame writes a frame with the given msg to w.
+//
+// The frame consists of uvarint-encoded msg length, big-endian CRC32 Castagnoli checksum of the msg and the msg itself.
+func writeChunkedFrame(w io.Writer, msg []byte) error {
+	var header [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(header[:], uint64(len(msg)))
+	binary.BigEndian.PutUint32(header[n:], crc32.Checksum(msg, castagnoliTable))
+	if _, err := w.Write(header[:n+4]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+func processRemoteReadQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline searchutil.Deadline, f func(rs *netstorage.Result)) error {
+	rss, err := netstorage.ProcessSearchQuery(qt, sq, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+	}
+	err = rss.RunParallel(qt, func(rs *netstorage.Result, _ uint) error {
+		if len(rs.Timestamps) == 0 {
+			return nil
+		}
+		f(rs)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error during remote read query processing for %q: %w", sq, err)
+	}
+	return nil
+}
+
+// metricNameToLabels returns labels sorted by name for the given mn.
+func metricNameToLabels(mn *storage.MetricName) []prompb.Label {
+	return appendMetricNameLabels(nil, mn)
+}
+
+// appendMetricNameLabels appends labels sorted by name for the given mn to labels.
+func appendMetricNameLabels(labels []prompb.Label, mn *storage.MetricName) []prompb.Label {
+	labelsLen := len(labels)
+	if len(mn.MetricGroup) > 0 {
+		labels = append(labels, prompb.Label{
+			Name:  "__name__",
+			Value: string(mn.MetricGroup),
+		})
+	}
+	for _, tag := range mn.Tags {
+		labels = append(labels, prompb.Label{
+			Name:  string(tag.Key),
+			Value: string(tag.Value),
+		})
+	}
+	a := labels[labelsLen:]
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].Name < a[j].Name
+	})
+	return labels
+}
+
+func compareLabels(a, b []prompb.Label) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if n := strings.Compare(a[i].Name, b[i].Name); n != 0 {
+			return n
+		}
+		if n := strings.Compare(a[i].Value, b[i].Value); n != 0 {
+			return n
+		}
+	}
+	return len(a) - len(b)
+}
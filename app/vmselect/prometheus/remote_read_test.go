@@ -0,0 +1,140 @@
+package prometheus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	promprompb "github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestWriteChunkedSeries(t *testing.T) {
+	f := func(chunkSizes []int, framesExpected int) {
+		t.Helper()
+
+		cs := &prompb.ChunkedSeries{
+			Labels: []prompb.Label{{Name: "__name__", Value: "foo"}},
+		}
+		for i, size := range chunkSizes {
+			cs.Chunks = append(cs.Chunks, prompb.Chunk{
+				MinTimeMs: int64(i),
+				MaxTimeMs: int64(i),
+				Type:      prompb.ChunkEncodingXOR,
+				Data:      bytes.Repeat([]byte{byte(i)}, size),
+			})
+		}
+		var bb bytes.Buffer
+		if _, err := writeChunkedSeries(&bb, nil, cs, 2); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		// Verify the response can be read by Prometheus
+		cr := remote.NewChunkedReader(&bb, 10*maxBytesInFrame, nil)
+		frames := 0
+		var chunks []promprompb.Chunk
+		for {
+			var crr promprompb.ChunkedReadResponse
+			err := cr.NextProto(&crr)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("cannot read frame: %s", err)
+			}
+			frames++
+			if crr.QueryIndex != 2 {
+				t.Fatalf("unexpected query index; got %d; want 2", crr.QueryIndex)
+			}
+			if len(crr.ChunkedSeries) != 1 {
+				t.Fatalf("unexpected number of series in frame; got %d; want 1", len(crr.ChunkedSeries))
+			}
+			if labels := crr.ChunkedSeries[0].Labels; len(labels) != 1 || labels[0].Name != "__name__" || labels[0].Value != "foo" {
+				t.Fatalf("unexpected labels: %v", labels)
+			}
+			chunks = append(chunks, crr.ChunkedSeries[0].Chunks...)
+		}
+		if frames != framesExpected {
+			t.Fatalf("unexpected number of frames; got %d; want %d", frames, framesExpected)
+		}
+		if len(chunks) != len(cs.Chunks) {
+			t.Fatalf("unexpected number of chunks; got %d; want %d", len(chunks), len(cs.Chunks))
+		}
+		for i, c := range chunks {
+			if !bytes.Equal(c.Data, cs.Chunks[i].Data) || c.MinTimeMs != int64(i) {
+				t.Fatalf("unexpected chunk #%d", i)
+			}
+		}
+	}
+
+	f(nil, 0)
+	f([]int{10}, 1)
+	f([]int{10, 20, 30}, 1)
+	f([]int{maxBytesInFrame / 2, maxBytesInFrame / 2, 10}, 2)
+	f([]int{2 * maxBytesInFrame, 10}, 2)
+}
+
+func TestMetricNameToLabels(t *testing.T) {
+	var mn storage.MetricName
+	mn.MetricGroup = []byte("foo")
+	mn.AddTag("job", "bar")
+	mn.AddTag("Instance", "baz")
+	labels := metricNameToLabels(&mn)
+	labelsExpected := []prompb.Label{
+		{Name: "Instance", Value: "baz"},
+		{Name: "__name__", Value: "foo"},
+		{Name: "job", Value: "bar"},
+	}
+	if !reflect.DeepEqual(labels, labelsExpected) {
+		t.Fatalf("unexpected labels\ngot\n%v\nwant\n%v", labels, labelsExpected)
+	}
+}
+
+func TestCompareLabels(t *testing.T) {
+	f := func(a, b []prompb.Label, resultExpected int) {
+		t.Helper()
+		result := compareLabels(a, b)
+		if (result < 0 && resultExpected >= 0) || (result > 0 && resultExpected <= 0) || (result == 0 && resultExpected != 0) {
+			t.Fatalf("unexpected result; got %d; want %d", result, resultExpected)
+		}
+
+		// sort keys must have the same order as labels
+		result = strings.Compare(string(appendLabelsSortKey(nil, a)), string(appendLabelsSortKey(nil, b)))
+		if result != resultExpected {
+			t.Fatalf("unexpected result for sort keys; got %d; want %d", result, resultExpected)
+		}
+	}
+
+	f(nil, nil, 0)
+	f(nil, []prompb.Label{{Name: "a", Value: "b"}}, -1)
+	f([]prompb.Label{{Name: "a", Value: "b"}}, []prompb.Label{{Name: "a", Value: "b"}}, 0)
+	f([]prompb.Label{{Name: "a", Value: "b"}}, []prompb.Label{{Name: "a", Value: "c"}}, -1)
+	f([]prompb.Label{{Name: "b", Value: "a"}}, []prompb.Label{{Name: "a", Value: "c"}}, 1)
+	f([]prompb.Label{{Name: "a", Value: "b"}, {Name: "c", Value: "d"}}, []prompb.Label{{Name: "a", Value: "b"}}, 1)
+	f([]prompb.Label{{Name: "a", Value: "b"}}, []prompb.Label{{Name: "ab", Value: "b"}}, -1)
+	f([]prompb.Label{{Name: "a", Value: "b"}}, []prompb.Label{{Name: "a", Value: "bc"}}, -1)
+}
+
+func TestToTagFilters(t *testing.T) {
+	tfs := toTagFilters([]prompb.LabelMatcher{
+		{Type: prompb.LabelMatcherEQ, Name: "__name__", Value: "foo"},
+		{Type: prompb.LabelMatcherNEQ, Name: "a", Value: "b"},
+		{Type: prompb.LabelMatcherRE, Name: "c", Value: "d.+"},
+		{Type: prompb.LabelMatcherNRE, Name: "e", Value: "f|g"},
+	})
+	tfsExpected := []storage.TagFilter{
+		{Value: []byte("foo")},
+		{Key: []byte("a"), Value: []byte("b"), IsNegative: true},
+		{Key: []byte("c"), Value: []byte("d.+"), IsRegexp: true},
+		{Key: []byte("e"), Value: []byte("f|g"), IsNegative: true, IsRegexp: true},
+	}
+	if !reflect.DeepEqual(tfs, tfsExpected) {
+		t.Fatalf("unexpected tag filters\ngot\n%v\nwant\n%v", tfs, tfsExpected)
+	}
+}
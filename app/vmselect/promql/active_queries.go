@@ -1,13 +1,16 @@
 package promql
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
 )
 
@@ -34,6 +37,29 @@ func ActiveQueriesHandler(w http.ResponseWriter, _ *http.Request) {
 	fmt.Fprintf(w, `]}`)
 }
 
+// CancelQueryHandler processes /api/v1/admin/query/cancel request.
+//
+// It cancels the active query with the id from `id` query arg.
+// The id must match the id returned from /api/v1/status/active_queries.
+func CancelQueryHandler(w http.ResponseWriter, r *http.Request) error {
+	idStr := r.FormValue("id")
+	if idStr == "" {
+		return fmt.Errorf("missing `id` query arg")
+	}
+	qid, err := strconv.ParseUint(idStr, 16, 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse `id` query arg %q: %w", idStr, err)
+	}
+	if !activeQueriesV.Cancel(qid) {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot find active query with id=%q", idStr),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 var activeQueriesV = newActiveQueries()
 
 type activeQueries struct {
@@ -49,6 +75,10 @@ type activeQueryEntry struct {
 	quotedRemoteAddr string
 	q                string
 	startTime        time.Time
+
+	// ctx is canceled when the query must be stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func newActiveQueries() *activeQueries {
@@ -57,8 +87,13 @@ func newActiveQueries() *activeQueries {
 	}
 }
 
+// Add registers the query q with the given ec as active and returns its id.
+//
+// ec.Deadline is bound to the context of the active query, which is canceled by Cancel call for the returned id.
 func (aq *activeQueries) Add(ec *EvalConfig, q string) uint64 {
 	var aqe activeQueryEntry
+	aqe.ctx, aqe.cancel = context.WithCancel(context.Background())
+	ec.Deadline = ec.Deadline.WithContext(aqe.ctx)
 	aqe.start = ec.Start
 	aqe.end = ec.End
 	aqe.step = ec.Step
@@ -73,10 +108,29 @@ func (aq *activeQueries) Add(ec *EvalConfig, q string) uint64 {
 	return aqe.qid
 }
 
+// Remove unregisters the query with the given qid and releases its context.
 func (aq *activeQueries) Remove(qid uint64) {
 	aq.mu.Lock()
+	aqe, ok := aq.m[qid]
 	delete(aq.m, qid)
 	aq.mu.Unlock()
+	if ok {
+		aqe.cancel()
+	}
+}
+
+// Cancel cancels the active query with the given qid.
+//
+// false is returned if there is no active query with the given qid.
+func (aq *activeQueries) Cancel(qid uint64) bool {
+	aq.mu.Lock()
+	aqe, ok := aq.m[qid]
+	aq.mu.Unlock()
+	if !ok {
+		return false
+	}
+	aqe.cancel()
+	return true
 }
 
 func (aq *activeQueries) GetAll() []activeQueryEntry {
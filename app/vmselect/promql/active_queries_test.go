@@ -0,0 +1,83 @@
+package promql
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+)
+
+func TestActiveQueriesCancel(t *testing.T) {
+	aq := newActiveQueries()
+	ec := &EvalConfig{
+		Deadline: searchutil.NewDeadline(time.Now(), time.Minute, ""),
+	}
+	qid := aq.Add(ec, "foo")
+	ctx := aq.m[qid].ctx
+	ecCopy := copyEvalConfig(ec)
+	if ec.Deadline.Exceeded() {
+		t.Fatalf("unexpected exceeded deadline for active query")
+	}
+	if aq.Cancel(qid + 1) {
+		t.Fatalf("unexpected cancel of missing query")
+	}
+	if !aq.Cancel(qid) {
+		t.Fatalf("cannot cancel active query")
+	}
+	if !ec.Deadline.Canceled() || !ecCopy.Deadline.Canceled() {
+		t.Fatalf("expecting canceled deadline after query cancel")
+	}
+	if ctx.Err() == nil {
+		t.Fatalf("expecting canceled context after query cancel")
+	}
+	aq.Remove(qid)
+	if aq.Cancel(qid) {
+		t.Fatalf("unexpected cancel of removed query")
+	}
+}
+
+func TestCancelQueryHandler(t *testing.T) {
+	f := func(id string, statusCodeExpected int) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/query/cancel?id="+id, nil)
+		w := httptest.NewRecorder()
+		err := CancelQueryHandler(w, r)
+		if statusCodeExpected == http.StatusNoContent {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if w.Code != statusCodeExpected {
+				t.Fatalf("unexpected status code; got %d; want %d", w.Code, statusCodeExpected)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	ec := &EvalConfig{
+		Deadline: searchutil.NewDeadline(time.Now(), time.Minute, ""),
+	}
+	qid := activeQueriesV.Add(ec, "foo")
+	defer activeQueriesV.Remove(qid)
+
+	// missing id
+	f("", http.StatusBadRequest)
+
+	// invalid id
+	f("foobar", http.StatusBadRequest)
+
+	// unknown id
+	f(fmt.Sprintf("%016X", qid+1), http.StatusNotFound)
+
+	// active query
+	f(fmt.Sprintf("%016X", qid), http.StatusNoContent)
+	if !ec.Deadline.Canceled() {
+		t.Fatalf("expecting canceled query")
+	}
+}
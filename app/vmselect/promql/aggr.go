@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/VictoriaMetrics/metricsql"
@@ -97,7 +98,14 @@ func removeGroupTags(metricName *storage.MetricName, modifier *metricsql.Modifie
 	groupOp := strings.ToLower(modifier.Op)
 	switch groupOp {
 	case "", "by":
+		// Preserve native histogram components, so aggregate functions are applied to every component individually
+		// in the same way as Prometheus applies them to native histograms.
+		// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#native-histograms
+		nhComponent := string(metricName.GetTagValue(nativehistogram.ComponentLabel))
 		metricName.RemoveTagsOn(modifier.Args)
+		if nhComponent != "" && len(metricName.GetTagValue(nativehistogram.ComponentLabel)) == 0 {
+			metricName.AddTag(nativehistogram.ComponentLabel, nhComponent)
+		}
 	case "without":
 		metricName.RemoveTagsIgnoring(modifier.Args)
 		// Reset metric group as Prometheus does on `aggr(...) without (...)` call.
@@ -63,8 +63,14 @@ func Exec(qt *querytracer.Tracer, ec *EvalConfig, q string, isFirstPointOnly boo
 
 	qid := activeQueriesV.Add(ec, q)
 	rv, err := evalExpr(qt, ec, e)
+	// The query context is canceled by Remove, so check for the cancellation before the call.
+	canceled := ec.Deadline.Canceled()
 	activeQueriesV.Remove(qid)
 	if err != nil {
+		if canceled {
+			// we don't add query=%q to err message as it will be added by the caller
+			return nil, fmt.Errorf("the query has been canceled via /api/v1/admin/query/cancel?id=%016X", qid)
+		}
 		return nil, err
 	}
 	if isFirstPointOnly {
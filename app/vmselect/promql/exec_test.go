@@ -4183,6 +4183,41 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r}
 		f(q, resultExpected)
 	})
+	t.Run(`histogram_quantile(native-histogram)`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_quantile(0.5, union(
+			label_set(4, "__nh__", "pos:0:1", "foo", "bar"),
+			label_set(2, "__nh__", "pos:0:2", "foo", "bar"),
+			label_set(2, "__nh__", "zero:0.001", "foo", "bar"),
+			label_set(2, "__nh__", "neg:0:2", "foo", "bar"),
+		))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1.189207115002721, 1.189207115002721, 1.189207115002721, 1.189207115002721, 1.189207115002721, 1.189207115002721},
+			Timestamps: timestampsExpected,
+		}
+		r.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
+	t.Run(`histogram_quantile(sum(native-histogram))`, func(t *testing.T) {
+		t.Parallel()
+		q := `histogram_quantile(0.5, sum(union(
+			label_set(1, "__nh__", "pos:0:1", "x", "a"),
+			label_set(1, "__nh__", "pos:0:1", "x", "b"),
+			label_set(2, "__nh__", "pos:0:2", "x", "a"),
+		)))`
+		r := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{2, 2, 2, 2, 2, 2},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r}
+		f(q, resultExpected)
+	})
 	t.Run(`histogram_quantile(single-value-valid-le, boundsLabel)`, func(t *testing.T) {
 		t.Parallel()
 		q := `sort(histogram_quantile(0.6, label_set(100, "le", "200"), "foobar"))`
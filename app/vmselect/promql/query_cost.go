@@ -0,0 +1,250 @@
+package promql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// QueryCost contains the estimated cost of the query execution.
+type QueryCost struct {
+	// Selectors contains the estimated cost per each series selector in the query
+	Selectors []*SelectorCost
+
+	// Series is the total number of series selected by the query
+	Series int
+
+	// SeriesLimitReached is set if the number of series for at least a single selector in the query exceeds EvalConfig.MaxSeries.
+	//
+	// In this case Series contains the lower bound for the number of series.
+	SeriesLimitReached bool
+
+	// Samples is the estimated total number of raw samples scanned by the query
+	Samples int64
+
+	// MemoryBytes is the estimated total memory in bytes needed for the query execution
+	MemoryBytes int64
+}
+
+// SelectorCost contains the estimated cost for a single series selector in the query.
+type SelectorCost struct {
+	// Selector is the series selector
+	Selector string
+
+	// Start and End is the time range in milliseconds for selecting raw samples
+	Start int64
+	End   int64
+
+	// Step is the step in milliseconds for the rollup calculations over the selected series
+	Step int64
+
+	// Window is the lookbehind window in milliseconds for the rollup calculations over the selected series
+	Window int64
+
+	// Series is the number of series matching the selector on the [Start ... End] time range
+	//
+	// It is limited by EvalConfig.MaxSeries if SeriesLimitReached is set.
+	Series int
+
+	// SeriesLimitReached is set if the number of series matching the selector exceeds EvalConfig.MaxSeries.
+	SeriesLimitReached bool
+
+	// Samples is the estimated number of raw samples for the selected series
+	Samples int64
+
+	// MemoryBytes is the estimated memory in bytes needed for the rollup calculations over the selected series
+	MemoryBytes int64
+
+	// me is the parsed series selector
+	me *metricsql.MetricExpr
+
+	// pointsPerSeries is the number of points per each selected series calculated by rollup functions
+	pointsPerSeries int64
+}
+
+// EstimateQueryCost estimates the cost of q execution for the given ec without evaluating rollups.
+//
+// The number of series is obtained from the index per each series selector in q,
+// while the number of raw samples is estimated under the assumption that samples are stored with the given scrapeInterval in milliseconds.
+func EstimateQueryCost(qt *querytracer.Tracer, ec *EvalConfig, q string, scrapeInterval int64) (*QueryCost, error) {
+	if scrapeInterval <= 0 {
+		return nil, fmt.Errorf("scrapeInterval must be positive; got %dms", scrapeInterval)
+	}
+	ec.validate()
+
+	e, err := parsePromQLWithCache(q)
+	if err != nil {
+		return nil, err
+	}
+	qc := &QueryCost{}
+	if err := qc.addExpr(ec, e, "default_rollup"); err != nil {
+		return nil, err
+	}
+	for _, sc := range qc.Selectors {
+		if err := sc.estimate(qt, ec, scrapeInterval); err != nil {
+			return nil, err
+		}
+		qc.Series += sc.Series
+		qc.SeriesLimitReached = qc.SeriesLimitReached || sc.SeriesLimitReached
+		qc.Samples = sumNoOverflow(qc.Samples, sc.Samples)
+		qc.MemoryBytes = sumNoOverflow(qc.MemoryBytes, sc.MemoryBytes)
+	}
+	qt.Printf("estimated cost for the query %q: selectors=%d, series=%d, seriesLimitReached=%v, samples=%d, memoryBytes=%d",
+		q, len(qc.Selectors), qc.Series, qc.SeriesLimitReached, qc.Samples, qc.MemoryBytes)
+	return qc, nil
+}
+
+func (qc *QueryCost) addExpr(ec *EvalConfig, e metricsql.Expr, funcName string) error {
+	switch t := e.(type) {
+	case *metricsql.MetricExpr:
+		qc.addSelector(ec, t, funcName, 0)
+		return nil
+	case *metricsql.RollupExpr:
+		return qc.addRollupExpr(ec, t, funcName)
+	case *metricsql.FuncExpr:
+		funcName := "default_rollup"
+		if getRollupFunc(t.Name) != nil {
+			funcName = strings.ToLower(t.Name)
+		}
+		return qc.addExprs(ec, t.Args, funcName)
+	case *metricsql.AggrFuncExpr:
+		return qc.addExprs(ec, t.Args, "default_rollup")
+	case *metricsql.BinaryOpExpr:
+		return qc.addExprs(ec, []metricsql.Expr{t.Left, t.Right}, "default_rollup")
+	default:
+		return nil
+	}
+}
+
+func (qc *QueryCost) addExprs(ec *EvalConfig, es []metricsql.Expr, funcName string) error {
+	for _, e := range es {
+		if err := qc.addExpr(ec, e, funcName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (qc *QueryCost) addRollupExpr(ec *EvalConfig, re *metricsql.RollupExpr, funcName string) error {
+	ecNew := ec
+	if re.At != nil {
+		// Only simple `@` modifiers are supported, since the estimation mustn't evaluate expressions.
+		// The original time range is used for the rest of `@` modifiers.
+		atTimestamp, ok := getAtTimestamp(ec, re.At)
+		if ok {
+			ecNew = copyEvalConfig(ecNew)
+			ecNew.Start = atTimestamp
+			ecNew.End = atTimestamp
+		}
+	}
+	if re.Offset != nil {
+		offset := re.Offset.Duration(ec.Step)
+		ecNew = copyEvalConfig(ecNew)
+		ecNew.Start -= offset
+		ecNew.End -= offset
+	}
+	window, err := re.Window.NonNegativeDuration(ec.Step)
+	if err != nil {
+		return fmt.Errorf("cannot parse lookbehind window in square brackets at %s: %w", re.AppendString(nil), err)
+	}
+	if me, ok := re.Expr.(*metricsql.MetricExpr); ok && !re.ForSubquery() {
+		qc.addSelector(ecNew, me, funcName, window)
+		return nil
+	}
+
+	// Subquery
+	step, err := re.Step.NonNegativeDuration(ec.Step)
+	if err != nil {
+		return fmt.Errorf("cannot parse step in square brackets at %s: %w", re.AppendString(nil), err)
+	}
+	if step == 0 {
+		step = ec.Step
+	}
+	ecSQ := copyEvalConfig(ecNew)
+	ecSQ.Start -= window + step + maxSilenceInterval()
+	ecSQ.End += step
+	ecSQ.Step = step
+	ecSQ.Start, ecSQ.End = alignStartEnd(ecSQ.Start, ecSQ.End, ecSQ.Step)
+	return qc.addExpr(ecSQ, re.Expr, "default_rollup")
+}
+
+func getAtTimestamp(ec *EvalConfig, e metricsql.Expr) (int64, bool) {
+	switch t := e.(type) {
+	case *metricsql.NumberExpr:
+		return int64(t.N * 1000), true
+	case *metricsql.FuncExpr:
+		if len(t.Args) > 0 {
+			return 0, false
+		}
+		switch strings.ToLower(t.Name) {
+		case "start":
+			return ec.Start, true
+		case "end":
+			return ec.End, true
+		}
+	}
+	return 0, false
+}
+
+func (qc *QueryCost) addSelector(ec *EvalConfig, me *metricsql.MetricExpr, funcName string, window int64) {
+	// The time range for raw samples is calculated in the same way as in evalRollupFuncNoCache.
+	minTimestamp := ec.Start
+	if needSilenceIntervalForRollupFunc[funcName] {
+		minTimestamp -= maxSilenceInterval()
+	}
+	if window > ec.Step {
+		minTimestamp -= window
+	} else {
+		minTimestamp -= ec.Step
+	}
+	qc.Selectors = append(qc.Selectors, &SelectorCost{
+		Selector: string(me.AppendString(nil)),
+		Start:    minTimestamp,
+		End:      ec.End,
+		Step:     ec.Step,
+		Window:   window,
+
+		me:              me,
+		pointsPerSeries: 1 + (ec.End-ec.Start)/ec.Step,
+	})
+}
+
+// estimate obtains the number of series for sc from the index and estimates the number of samples and memory usage for these series.
+//
+// The number of series is limited by ec.MaxSeries, so the estimation doesn't fail for selectors matching too many series.
+func (sc *SelectorCost) estimate(qt *querytracer.Tracer, ec *EvalConfig, scrapeInterval int64) error {
+	tfss := searchutil.ToTagFilterss(sc.me.LabelFilterss)
+	tfss = searchutil.JoinTagFilterss(tfss, ec.EnforcedTagFilterss)
+	sq := storage.NewSearchQuery(sc.Start, sc.End, tfss, ec.MaxSeries)
+	n, err := netstorage.SearchSeriesCount(qt, sq, ec.Deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain series count for %s: %w", sc.Selector, err)
+	}
+	sc.setSeries(n, ec.MaxSeries)
+	sc.estimateSamplesAndMemory(scrapeInterval)
+	return nil
+}
+
+// setSeries sets sc.Series to n, which is limited by maxSeries.
+func (sc *SelectorCost) setSeries(n, maxSeries int) {
+	if n > maxSeries {
+		n = maxSeries
+		sc.SeriesLimitReached = true
+	}
+	sc.Series = n
+}
+
+func (sc *SelectorCost) estimateSamplesAndMemory(scrapeInterval int64) {
+	// The memory estimation is performed in the same way as in evalRollupFuncNoCache.
+	rollupPoints := mulNoOverflow(int64(sc.Series), sc.pointsPerSeries)
+	sc.MemoryBytes = sumNoOverflow(mulNoOverflow(int64(sc.Series), 1000), mulNoOverflow(rollupPoints, 16))
+
+	samplesPerSeries := (sc.End-sc.Start)/scrapeInterval + 1
+	sc.Samples = mulNoOverflow(int64(sc.Series), samplesPerSeries)
+}
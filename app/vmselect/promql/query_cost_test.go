@@ -0,0 +1,99 @@
+package promql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+func TestQueryCostAddExpr(t *testing.T) {
+	f := func(q string, resultExpected string) {
+		t.Helper()
+
+		e, err := metricsql.Parse(q)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", q, err)
+		}
+		ec := &EvalConfig{
+			Start: 3600000,
+			End:   7200000,
+			Step:  60000,
+		}
+		var qc QueryCost
+		if err := qc.addExpr(ec, e, "default_rollup"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var a []string
+		for _, sc := range qc.Selectors {
+			a = append(a, fmt.Sprintf("%s start=%d end=%d step=%d window=%d points=%d", sc.Selector, sc.Start, sc.End, sc.Step, sc.Window, sc.pointsPerSeries))
+		}
+		result := strings.Join(a, "\n")
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q\ngot\n%s\nwant\n%s", q, result, resultExpected)
+		}
+	}
+
+	// no series selectors
+	f(`time()`, ``)
+	f(`1 + 2`, ``)
+
+	// default_rollup needs silence interval
+	f(`foo`, `foo start=3240000 end=7200000 step=60000 window=0 points=61`)
+	f(`abs(foo{bar="baz"})`, `foo{bar="baz"} start=3240000 end=7200000 step=60000 window=0 points=61`)
+
+	// lookbehind window bigger than step
+	f(`rate(foo[5m])`, `foo start=3000000 end=7200000 step=60000 window=300000 points=61`)
+
+	// rollup function without silence interval and offset
+	f(`sum(max_over_time(foo[2m] offset 1m))`, `foo start=3420000 end=7140000 step=60000 window=120000 points=61`)
+
+	// `@` modifier
+	f(`rate(foo[1m] @ 1000)`, `foo start=640000 end=1000000 step=60000 window=60000 points=1`)
+	f(`rate(foo[1m] @ end())`, `foo start=6840000 end=7200000 step=60000 window=60000 points=1`)
+
+	// subquery
+	f(`max_over_time(rate(foo[1m])[10m:2m])`, `foo start=2100000 end=7320000 step=120000 window=60000 points=41`)
+
+	// multiple selectors
+	f(`foo / on() max_over_time(bar{x="y"}[10m])`, "foo start=3240000 end=7200000 step=60000 window=0 points=61\n"+
+		`bar{x="y"} start=3000000 end=7200000 step=60000 window=600000 points=61`)
+}
+
+func TestSelectorCostSetSeries(t *testing.T) {
+	f := func(n, maxSeries int, seriesExpected int, seriesLimitReachedExpected bool, samplesExpected, memoryBytesExpected int64) {
+		t.Helper()
+
+		sc := &SelectorCost{
+			Start: 3600000,
+			End:   7200000,
+
+			pointsPerSeries: 61,
+		}
+		sc.setSeries(n, maxSeries)
+		sc.estimateSamplesAndMemory(30000)
+		if sc.Series != seriesExpected {
+			t.Fatalf("unexpected series; got %d; want %d", sc.Series, seriesExpected)
+		}
+		if sc.SeriesLimitReached != seriesLimitReachedExpected {
+			t.Fatalf("unexpected seriesLimitReached; got %v; want %v", sc.SeriesLimitReached, seriesLimitReachedExpected)
+		}
+		if sc.Samples != samplesExpected {
+			t.Fatalf("unexpected samples; got %d; want %d", sc.Samples, samplesExpected)
+		}
+		if sc.MemoryBytes != memoryBytesExpected {
+			t.Fatalf("unexpected memoryBytes; got %d; want %d", sc.MemoryBytes, memoryBytesExpected)
+		}
+	}
+
+	// no matching series
+	f(0, 100, 0, false, 0, 0)
+
+	// the number of series doesn't exceed maxSeries
+	f(10, 100, 10, false, 1210, 19760)
+	f(100, 100, 100, false, 12100, 197600)
+
+	// the number of series exceeds maxSeries
+	f(101, 100, 100, true, 12100, 197600)
+}
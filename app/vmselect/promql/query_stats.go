@@ -13,6 +13,10 @@ type QueryStats struct {
 	ExecutionDuration atomic.Pointer[time.Duration]
 	// SeriesFetched contains the number of series fetched from storage or cache.
 	SeriesFetched atomic.Int64
+	// SamplesScanned contains the number of raw samples scanned during rollup calculations.
+	SamplesScanned atomic.Int64
+	// MemoryUsage contains the estimated memory in bytes needed for rollup calculations.
+	MemoryUsage atomic.Int64
 
 	at *auth.Token
 
@@ -46,6 +50,20 @@ func (qs *QueryStats) addSeriesFetched(n int) {
 	qs.SeriesFetched.Add(int64(n))
 }
 
+func (qs *QueryStats) addSamplesScanned(n uint64) {
+	if qs == nil {
+		return
+	}
+	qs.SamplesScanned.Add(int64(n))
+}
+
+func (qs *QueryStats) addMemoryUsage(n int64) {
+	if qs == nil {
+		return
+	}
+	qs.MemoryUsage.Add(n)
+}
+
 func (qs *QueryStats) addExecutionTimeMsec(startTime time.Time) {
 	if qs == nil {
 		return
@@ -17,6 +17,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 )
 
@@ -901,8 +902,11 @@ func transformHistogramQuantile(tfa *transformFuncArg) ([]*timeseries, error) {
 		return nil, fmt.Errorf("cannot parse phi: %w", err)
 	}
 
+	// Native histograms are processed separately from buckets with `le` and `vmrange` labels.
+	nhs, tss := groupNativeHistograms(args[1])
+
 	// Convert buckets with `vmrange` labels to buckets with `le` labels.
-	tss := vmrangeBucketsToLE(args[1])
+	tss = vmrangeBucketsToLE(tss)
 	// Parse boundsLabel. See https://github.com/prometheus/prometheus/issues/5706 for details.
 	var boundsLabel string
 	if len(args) > 2 {
@@ -1006,9 +1010,79 @@ func transformHistogramQuantile(tfa *transformFuncArg) ([]*timeseries, error) {
 			rvs = append(rvs, tsUpper)
 		}
 	}
+	rvs = appendNativeHistogramResults(rvs, nhs, func(i int, h *nativehistogram.Histogram) float64 {
+		return h.Quantile(phis[i])
+	})
 	return rvs, nil
 }
 
+// nativeHistogramGroup contains series with components of native histograms with identical labels.
+type nativeHistogramGroup struct {
+	keys []nativehistogram.ComponentKey
+	tss  []*timeseries
+}
+
+// groupNativeHistograms groups native histogram components from tss by labels.
+//
+// It returns the remaining series without native histogram components in tssRemaining.
+//
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#native-histograms
+func groupNativeHistograms(tss []*timeseries) (map[string]*nativeHistogramGroup, []*timeseries) {
+	var m map[string]*nativeHistogramGroup
+	tssRemaining := tss[:0]
+	bb := bbPool.Get()
+	for _, ts := range tss {
+		tagValue := ts.MetricName.GetTagValue(nativehistogram.ComponentLabel)
+		if len(tagValue) == 0 {
+			tssRemaining = append(tssRemaining, ts)
+			continue
+		}
+		var ck nativehistogram.ComponentKey
+		if err := nativehistogram.ParseComponentKey(&ck, bytesutil.ToUnsafeString(tagValue)); err != nil {
+			// Skip series with broken components.
+			continue
+		}
+		ts.MetricName.ResetMetricGroup()
+		ts.MetricName.RemoveTag(nativehistogram.ComponentLabel)
+		bb.B = marshalMetricTagsSorted(bb.B[:0], &ts.MetricName)
+		if m == nil {
+			m = make(map[string]*nativeHistogramGroup)
+		}
+		g := m[string(bb.B)]
+		if g == nil {
+			g = &nativeHistogramGroup{}
+			m[string(bb.B)] = g
+		}
+		g.keys = append(g.keys, ck)
+		g.tss = append(g.tss, ts)
+	}
+	bbPool.Put(bb)
+	return m, tssRemaining
+}
+
+// appendNativeHistogramResults appends series with f results calculated per every point of native histograms from nhs to dst.
+func appendNativeHistogramResults(dst []*timeseries, nhs map[string]*nativeHistogramGroup, f func(i int, h *nativehistogram.Histogram) float64) []*timeseries {
+	var h nativehistogram.Histogram
+	for _, g := range nhs {
+		rv := &timeseries{}
+		rv.CopyFromShallowTimestamps(g.tss[0])
+		for i := range rv.Values {
+			h.Reset()
+			for j, ts := range g.tss {
+				h.Add(&g.keys[j], ts.Values[i])
+			}
+			if h.IsEmpty() {
+				rv.Values[i] = nan
+				continue
+			}
+			h.Normalize()
+			rv.Values[i] = f(i, &h)
+		}
+		dst = append(dst, rv)
+	}
+	return dst
+}
+
 type leTimeseries struct {
 	le float64
 	ts *timeseries
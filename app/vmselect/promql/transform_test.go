@@ -244,6 +244,49 @@ foo{vmrange="1...2"} 0 123`,
 	)
 }
 
+func TestTransformNativeHistograms(t *testing.T) {
+	f := func(tf transformFunc, scalarArgs []float64, metrics, resultExpected string) {
+		t.Helper()
+		var args [][]*timeseries
+		for _, v := range scalarArgs {
+			args = append(args, []*timeseries{{
+				Values:     []float64{v},
+				Timestamps: []int64{123},
+			}})
+		}
+		args = append(args, promMetricsToTimeseries(metrics))
+		tfa := &transformFuncArg{
+			args: args,
+		}
+		tss, err := tf(tfa)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := timeseriesToPromMetrics(tss)
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	metrics := `foo{__nh__="count",job="a"} 10 123
+foo{__nh__="sum",job="a"} 20 123
+foo{__nh__="zero:0.001",job="a"} 2 123
+foo{__nh__="pos:0:1",job="a"} 4 123
+foo{__nh__="pos:0:2",job="a"} 2 123
+foo{__nh__="neg:0:2",job="a"} 2 123
+foo{le="1",job="b"} 1 123
+foo{le="+Inf",job="b"} 2 123`
+
+	f(transformHistogramQuantile, []float64{0.5}, metrics, `{job="b"} 1 123
+{job="a"} 1.189207115002721 123`)
+
+	// buckets without count and sum
+	f(transformHistogramQuantile, []float64{0.5}, `foo{__nh__="pos:0:1"} 4 123`, `{} 1.414213562373095 123`)
+
+	// broken components are ignored
+	f(transformHistogramQuantile, []float64{0.5}, `foo{__nh__="bar"} 4 123`, ``)
+}
+
 func promMetricsToTimeseries(s string) []*timeseries {
 	var rows prometheus.Rows
 	rows.UnmarshalWithErrLogger(s, func(errStr string) {
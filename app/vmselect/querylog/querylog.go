@@ -0,0 +1,294 @@
+package querylog
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	logPath = flag.String("search.queryLog.path", "", "Optional path to file for logging executed queries in JSON lines format. "+
+		"The file is rotated when its size exceeds -search.queryLog.maxFileSize. The query log is disabled by default. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#query-log")
+	maxFileSize = flagutil.NewBytes("search.queryLog.maxFileSize", 100*1024*1024, "The maximum size of the file at -search.queryLog.path. "+
+		"The file is rotated when its size exceeds this value")
+	maxFiles = flag.Int("search.queryLog.maxFiles", 5, "The maximum number of rotated files to keep for -search.queryLog.path. "+
+		"The oldest rotated files are deleted")
+	minQueryDuration = flag.Duration("search.queryLog.minQueryDuration", 0, "The minimum duration for queries to write into -search.queryLog.path. "+
+		"Queries with lower duration aren't logged")
+	logHeaders = flagutil.NewArrayString("search.queryLog.header", "Optional HTTP request header to write into -search.queryLog.path for every logged query. "+
+		"For example, -search.queryLog.header=X-Grafana-User writes the user from Grafana into the query log")
+)
+
+var ql *queryLog
+
+// Init initializes the query log.
+//
+// Init must be called after flag.Parse.
+func Init() {
+	if *logPath == "" {
+		return
+	}
+	if *maxFiles < 0 {
+		logger.Fatalf("-search.queryLog.maxFiles cannot be negative; got %d", *maxFiles)
+	}
+	q, err := newQueryLog(*logPath, maxFileSize.IntN(), *maxFiles)
+	if err != nil {
+		logger.Fatalf("cannot initialize -search.queryLog.path=%q: %s", *logPath, err)
+	}
+	ql = q
+}
+
+// MustStop stops the query log.
+func MustStop() {
+	if ql == nil {
+		return
+	}
+	ql.mustClose()
+	ql = nil
+}
+
+// Enabled returns true if the query log is enabled via -search.queryLog.path.
+func Enabled() bool {
+	return ql != nil
+}
+
+// Record contains information about the executed query.
+type Record struct {
+	// Query is the executed query
+	Query string
+
+	// Start, End and Step are the query time range and step in milliseconds
+	Start int64
+	End   int64
+	Step  int64
+
+	// StartTime is the time when the query execution has been started
+	StartTime time.Time
+
+	// SeriesFetched is the number of series fetched from storage or cache
+	SeriesFetched int64
+
+	// SamplesScanned is the number of raw samples scanned during the query execution
+	SamplesScanned int64
+
+	// MemoryUsage is the estimated memory in bytes used during the query execution
+	MemoryUsage int64
+
+	// Err is an optional error returned by the query
+	Err error
+}
+
+// entry is a single line in the query log
+type entry struct {
+	Timestamp       string            `json:"ts"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query"`
+	Type            string            `json:"type"`
+	Start           int64             `json:"start"`
+	End             int64             `json:"end"`
+	Step            int64             `json:"step"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	SeriesFetched   int64             `json:"series_fetched"`
+	SamplesScanned  int64             `json:"samples_scanned"`
+	MemoryBytes     int64             `json:"memory_bytes"`
+	RemoteAddr      string            `json:"remote_addr"`
+	ForwardedFor    string            `json:"forwarded_for,omitempty"`
+	User            string            `json:"user,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// LogQuery writes the given rec for the query from r into the query log.
+//
+// It is safe calling LogQuery from concurrently running goroutines.
+func LogQuery(r *http.Request, rec *Record) {
+	if ql == nil {
+		return
+	}
+	d := time.Since(rec.StartTime)
+	if d < *minQueryDuration {
+		return
+	}
+	e := newEntry(r, rec, time.Now(), d, *logHeaders)
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal query log entry: %s", err)
+	}
+	data = append(data, '\n')
+	ql.write(data)
+}
+
+func newEntry(r *http.Request, rec *Record, currentTime time.Time, d time.Duration, headers []string) *entry {
+	e := &entry{
+		Timestamp:       currentTime.UTC().Format(time.RFC3339Nano),
+		Path:            r.URL.Path,
+		Query:           rec.Query,
+		Type:            "range",
+		Start:           rec.Start,
+		End:             rec.End,
+		Step:            rec.Step,
+		DurationSeconds: d.Seconds(),
+		SeriesFetched:   rec.SeriesFetched,
+		SamplesScanned:  rec.SamplesScanned,
+		MemoryBytes:     rec.MemoryUsage,
+		RemoteAddr:      r.RemoteAddr,
+		ForwardedFor:    r.Header.Get("X-Forwarded-For"),
+	}
+	if rec.Start == rec.End {
+		e.Type = "instant"
+	}
+	if username, _, ok := r.BasicAuth(); ok {
+		e.User = username
+	}
+	for _, h := range headers {
+		v := r.Header.Get(h)
+		if v == "" {
+			continue
+		}
+		if e.Headers == nil {
+			e.Headers = make(map[string]string, len(headers))
+		}
+		e.Headers[h] = v
+	}
+	if rec.Err != nil {
+		e.Error = rec.Err.Error()
+	}
+	return e
+}
+
+// queryLog writes query log entries into the file at path and rotates it when its size exceeds maxFileSize.
+type queryLog struct {
+	path        string
+	maxFileSize int
+	maxFiles    int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int
+}
+
+func newQueryLog(path string, maxFileSize, maxFiles int) (*queryLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("cannot create directory for the query log: %w", err)
+	}
+	ql := &queryLog{
+		path:        path,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+	}
+	if err := ql.openLocked(); err != nil {
+		return nil, err
+	}
+	return ql, nil
+}
+
+func (ql *queryLog) openLocked() error {
+	f, err := os.OpenFile(ql.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open query log: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot obtain query log size: %w", err)
+	}
+	ql.f = f
+	ql.size = int(fi.Size())
+	return nil
+}
+
+func (ql *queryLog) write(data []byte) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	if ql.f == nil {
+		// The previous rotation has failed. Try opening the file again.
+		if err := ql.openLocked(); err != nil {
+			writeErrors.Inc()
+			queryLogErrorLogger.Errorf("cannot write to -search.queryLog.path=%q: %s", ql.path, err)
+			return
+		}
+	}
+	if ql.size > 0 && ql.size+len(data) > ql.maxFileSize {
+		if err := ql.rotateLocked(); err != nil {
+			writeErrors.Inc()
+			queryLogErrorLogger.Errorf("cannot rotate -search.queryLog.path=%q: %s", ql.path, err)
+			return
+		}
+	}
+	n, err := ql.f.Write(data)
+	ql.size += n
+	if err != nil {
+		writeErrors.Inc()
+		queryLogErrorLogger.Errorf("cannot write to -search.queryLog.path=%q: %s", ql.path, err)
+		return
+	}
+	writtenEntries.Inc()
+}
+
+// rotateLocked renames the current file to path.1, while shifting the previously rotated files.
+//
+// The oldest rotated file is deleted if the number of rotated files exceeds maxFiles.
+func (ql *queryLog) rotateLocked() error {
+	if err := ql.f.Close(); err != nil {
+		return fmt.Errorf("cannot close query log: %w", err)
+	}
+	ql.f = nil
+	if ql.maxFiles == 0 {
+		if err := os.Remove(ql.path); err != nil {
+			return fmt.Errorf("cannot remove query log: %w", err)
+		}
+	} else {
+		oldest := rotatedPath(ql.path, ql.maxFiles)
+		if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove the oldest rotated query log: %w", err)
+		}
+		for i := ql.maxFiles - 1; i >= 1; i-- {
+			if err := os.Rename(rotatedPath(ql.path, i), rotatedPath(ql.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("cannot rename rotated query log: %w", err)
+			}
+		}
+		if err := os.Rename(ql.path, rotatedPath(ql.path, 1)); err != nil {
+			return fmt.Errorf("cannot rename query log: %w", err)
+		}
+	}
+	rotations.Inc()
+	return ql.openLocked()
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (ql *queryLog) mustClose() {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	if ql.f == nil {
+		return
+	}
+	if err := ql.f.Close(); err != nil {
+		logger.Panicf("FATAL: cannot close -search.queryLog.path=%q: %s", ql.path, err)
+	}
+	ql.f = nil
+}
+
+// queryLogErrorLogger limits the rate of errors logged on the query path, while vm_query_log_errors_total counts all of them.
+var queryLogErrorLogger = logger.WithThrottler("queryLogError", 5*time.Second)
+
+var (
+	writtenEntries = metrics.NewCounter(`vm_query_log_entries_total`)
+	writeErrors    = metrics.NewCounter(`vm_query_log_errors_total`)
+	rotations      = metrics.NewCounter(`vm_query_log_rotations_total`)
+)
@@ -0,0 +1,108 @@
+package querylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewEntry(t *testing.T) {
+	f := func(r *http.Request, rec *Record, headers []string, resultExpected string) {
+		t.Helper()
+
+		currentTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		e := newEntry(r, rec, currentTime, 1500*time.Millisecond, headers)
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("cannot marshal entry: %s", err)
+		}
+		if string(data) != resultExpected {
+			t.Fatalf("unexpected entry\ngot\n%s\nwant\n%s", data, resultExpected)
+		}
+	}
+
+	// instant query
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	f(r, &Record{
+		Query:          "up",
+		Start:          1000,
+		End:            1000,
+		Step:           300000,
+		SeriesFetched:  2,
+		SamplesScanned: 40,
+		MemoryUsage:    2000,
+	}, nil, `{"ts":"2025-01-02T03:04:05Z","path":"/api/v1/query","query":"up","type":"instant","start":1000,"end":1000,"step":300000,`+
+		`"duration_seconds":1.5,"series_fetched":2,"samples_scanned":40,"memory_bytes":2000,"remote_addr":"1.2.3.4:5678"}`)
+
+	// range query with user, headers and error
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/query_range", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.SetBasicAuth("foo", "bar")
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+	r.Header.Set("X-Grafana-User", "admin")
+	f(r, &Record{
+		Query: "sum(rate(foo[5m]))",
+		Start: 1000,
+		End:   61000,
+		Step:  30000,
+		Err:   fmt.Errorf("some error"),
+	}, []string{"X-Grafana-User", "X-Missing-Header"}, `{"ts":"2025-01-02T03:04:05Z","path":"/api/v1/query_range","query":"sum(rate(foo[5m]))","type":"range","start":1000,"end":61000,"step":30000,`+
+		`"duration_seconds":1.5,"series_fetched":0,"samples_scanned":0,"memory_bytes":0,"remote_addr":"1.2.3.4:5678","forwarded_for":"5.6.7.8","user":"foo",`+
+		`"headers":{"X-Grafana-User":"admin"},"error":"some error"}`)
+}
+
+func TestQueryLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "query.log")
+	ql, err := newQueryLog(path, 10, 2)
+	if err != nil {
+		t.Fatalf("cannot create query log: %s", err)
+	}
+	for i := range 5 {
+		ql.write([]byte(fmt.Sprintf("line %d\n", i)))
+	}
+	ql.mustClose()
+
+	f := func(path, contentExpected string) {
+		t.Helper()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %s", path, err)
+		}
+		if string(data) != contentExpected {
+			t.Fatalf("unexpected content for %q\ngot\n%s\nwant\n%s", path, data, contentExpected)
+		}
+	}
+
+	f(path, "line 4\n")
+	f(path+".1", "line 3\n")
+	f(path+".2", "line 2\n")
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expecting the oldest rotated file to be deleted; got %v", err)
+	}
+
+	// The query log must be appended after the restart
+	ql, err = newQueryLog(path, 100, 2)
+	if err != nil {
+		t.Fatalf("cannot open query log: %s", err)
+	}
+	ql.write([]byte("line 5\n"))
+	ql.mustClose()
+	f(path, "line 4\nline 5\n")
+
+	// Lines longer than maxFileSize are written to a separate file
+	ql, err = newQueryLog(path, 10, 0)
+	if err != nil {
+		t.Fatalf("cannot open query log: %s", err)
+	}
+	ql.write([]byte(strings.Repeat("x", 20) + "\n"))
+	ql.mustClose()
+	f(path, strings.Repeat("x", 20)+"\n")
+}
@@ -0,0 +1,464 @@
+package searchqueue
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/regexutil"
+)
+
+var configPath = flag.String("search.queuesConfig", "", "Optional path to file with search queues config. Search queues allow sharing -search.maxConcurrentRequests "+
+	"between requests with different priority, e.g. alerting queries from vmalert and dashboard queries from Grafana. "+
+	"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#search-queues")
+
+// ErrTimeout is returned from Queue.Acquire if the request couldn't be started in the given timeout.
+var ErrTimeout = errors.New("timeout waiting for free concurrency slot")
+
+// defaultQueueName is the name of the queue for requests, which do not match any queue from -search.queuesConfig
+const defaultQueueName = "default"
+
+var sched *scheduler
+
+// Init initializes search queues with the given maxConcurrentRequests and the default maxQueueDuration.
+//
+// Init must be called before GetQueue.
+func Init(maxConcurrentRequests int, maxQueueDuration time.Duration) {
+	var cfgs []*QueueConfig
+	if *configPath != "" {
+		var err error
+		cfgs, err = loadConfigFromFile(*configPath)
+		if err != nil {
+			logger.Fatalf("cannot load -search.queuesConfig=%q: %s", *configPath, err)
+		}
+	}
+	s, err := newScheduler(cfgs, maxConcurrentRequests, maxQueueDuration)
+	if err != nil {
+		logger.Fatalf("cannot initialize search queues from -search.queuesConfig=%q: %s", *configPath, err)
+	}
+	metrics.RegisterSet(s.ms)
+	sched = s
+}
+
+// GetQueue returns the queue for the given r.
+func GetQueue(r *http.Request) *Queue {
+	return sched.getQueue(r)
+}
+
+// Capacity returns the maximum number of concurrently executed requests across all the queues.
+func Capacity() int {
+	return sched.capacity
+}
+
+// Running returns the number of currently executed requests across all the queues.
+func Running() int {
+	return sched.getRunning()
+}
+
+// QueueConfig is a config for a single search queue.
+//
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#search-queues
+type QueueConfig struct {
+	// Name is the queue name. It is used in the exposed metrics and in error messages.
+	Name string `yaml:"name"`
+
+	// Match contains conditions for requests, which must be put into the queue.
+	//
+	// The queue without Match conditions accepts all the requests.
+	Match *MatchConfig `yaml:"match,omitempty"`
+
+	// Share is the share of -search.maxConcurrentRequests for the queue relative to the shares of other queues.
+	//
+	// By default the share equals to 1.
+	Share float64 `yaml:"share,omitempty"`
+
+	// MaxConcurrentRequests is an optional limit on the number of concurrently executed requests from the queue.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests,omitempty"`
+
+	// MaxQueueDuration is the maximum duration the request may wait in the queue.
+	//
+	// By default -search.maxQueueDuration is used.
+	MaxQueueDuration *promutil.Duration `yaml:"max_queue_duration,omitempty"`
+}
+
+// MatchConfig contains conditions for matching requests to search queue.
+//
+// All the conditions must match. Every condition is an anchored regular expression.
+type MatchConfig struct {
+	// Headers contains regexps for request header values
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// User contains regexp for the username from Basic Auth
+	User string `yaml:"user,omitempty"`
+
+	// Path contains regexp for the request path
+	Path string `yaml:"path,omitempty"`
+}
+
+func loadConfigFromFile(path string) ([]*QueueConfig, error) {
+	data, err := fscore.ReadFileOrHTTP(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	data = envtemplate.ReplaceBytes(data)
+	return parseConfig(data)
+}
+
+func parseConfig(data []byte) ([]*QueueConfig, error) {
+	var cfgs []*QueueConfig
+	if err := yaml.UnmarshalStrict(data, &cfgs); err != nil {
+		return nil, fmt.Errorf("cannot parse search queues config: %w", err)
+	}
+	return cfgs, nil
+}
+
+// Queue is a search queue with its own share of concurrency slots.
+type Queue struct {
+	s *scheduler
+
+	name                  string
+	match                 *requestMatcher
+	share                 float64
+	maxConcurrentRequests int
+	maxQueueDuration      time.Duration
+
+	// running is the number of executed requests from the queue. It is protected by scheduler.mu
+	running int
+
+	// waiters contains requests waiting for free concurrency slot in the order of their arrival. It is protected by scheduler.mu
+	waiters []*waiter
+
+	requestsTotal *metrics.Counter
+	timeoutsTotal *metrics.Counter
+	waitDuration  *metrics.Histogram
+}
+
+type waiter struct {
+	// ch is notified when the concurrency slot is granted to the waiter
+	ch chan struct{}
+}
+
+// Name returns q name.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// MaxQueueDuration returns the maximum duration for waiting in q.
+func (q *Queue) MaxQueueDuration() time.Duration {
+	return q.maxQueueDuration
+}
+
+// TryAcquire tries acquiring concurrency slot for the request from q without waiting.
+//
+// Release must be called when the request is finished if TryAcquire returns true.
+func (q *Queue) TryAcquire() bool {
+	s := q.s
+	s.mu.Lock()
+	ok := len(q.waiters) == 0 && s.canRunLocked(q)
+	if ok {
+		s.runLocked(q)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		q.requestsTotal.Inc()
+		q.waitDuration.Update(0)
+	}
+	return ok
+}
+
+// Acquire waits for concurrency slot for the request from q up to the given timeout.
+//
+// ErrTimeout is returned if the slot couldn't be acquired in the given timeout.
+// ctx.Err() is returned if ctx is canceled while waiting.
+//
+// Release must be called when the request is finished if Acquire returns nil.
+func (q *Queue) Acquire(ctx context.Context, timeout time.Duration) error {
+	startTime := time.Now()
+	q.requestsTotal.Inc()
+	defer func() {
+		q.waitDuration.UpdateDuration(startTime)
+	}()
+
+	s := q.s
+	w := &waiter{
+		ch: make(chan struct{}, 1),
+	}
+	s.mu.Lock()
+	if len(q.waiters) == 0 && s.canRunLocked(q) {
+		s.runLocked(q)
+		s.mu.Unlock()
+		return nil
+	}
+	q.waiters = append(q.waiters, w)
+	s.mu.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	var err error
+	select {
+	case <-w.ch:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-t.C:
+		err = ErrTimeout
+	}
+
+	s.mu.Lock()
+	n := slices.Index(q.waiters, w)
+	if n >= 0 {
+		q.waiters = slices.Delete(q.waiters, n, n+1)
+	}
+	s.mu.Unlock()
+	if n < 0 {
+		// The slot has been granted concurrently. Release it, since the request won't be executed.
+		<-w.ch
+		q.Release()
+	}
+	if errors.Is(err, ErrTimeout) {
+		q.timeoutsTotal.Inc()
+	}
+	return err
+}
+
+// Release releases the concurrency slot acquired via TryAcquire or Acquire.
+func (q *Queue) Release() {
+	s := q.s
+	s.mu.Lock()
+	q.running--
+	s.running--
+	s.dispatchLocked()
+	s.mu.Unlock()
+}
+
+type scheduler struct {
+	capacity int
+	queues   []*Queue
+
+	mu      sync.Mutex
+	running int
+
+	ms *metrics.Set
+}
+
+func newScheduler(cfgs []*QueueConfig, capacity int, maxQueueDuration time.Duration) (*scheduler, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("maxConcurrentRequests must be positive; got %d", capacity)
+	}
+	s := &scheduler{
+		capacity: capacity,
+		ms:       metrics.NewSet(),
+	}
+	hasCatchAll := false
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("missing name for the queue #%d", i+1)
+		}
+		for _, q := range s.queues {
+			if q.name == cfg.Name {
+				return nil, fmt.Errorf("duplicate queue name %q", cfg.Name)
+			}
+		}
+		if hasCatchAll {
+			return nil, fmt.Errorf("the queue %q is never used, since the previous queue has no match conditions", cfg.Name)
+		}
+		if cfg.Share < 0 {
+			return nil, fmt.Errorf("share for the queue %q cannot be negative; got %v", cfg.Name, cfg.Share)
+		}
+		if cfg.MaxConcurrentRequests < 0 {
+			return nil, fmt.Errorf("max_concurrent_requests for the queue %q cannot be negative; got %d", cfg.Name, cfg.MaxConcurrentRequests)
+		}
+		rm, err := newRequestMatcher(cfg.Match)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse match for the queue %q: %w", cfg.Name, err)
+		}
+		if rm == nil {
+			hasCatchAll = true
+		}
+		share := cfg.Share
+		if share == 0 {
+			share = 1
+		}
+		d := cfg.MaxQueueDuration.Duration()
+		if d <= 0 {
+			d = maxQueueDuration
+		}
+		s.addQueue(cfg.Name, rm, share, cfg.MaxConcurrentRequests, d)
+	}
+	if !hasCatchAll {
+		for _, q := range s.queues {
+			if q.name == defaultQueueName {
+				return nil, fmt.Errorf("the queue %q must have no match conditions", defaultQueueName)
+			}
+		}
+		s.addQueue(defaultQueueName, nil, 1, 0, maxQueueDuration)
+	}
+	return s, nil
+}
+
+func (s *scheduler) addQueue(name string, rm *requestMatcher, share float64, maxConcurrentRequests int, maxQueueDuration time.Duration) {
+	q := &Queue{
+		s:                     s,
+		name:                  name,
+		match:                 rm,
+		share:                 share,
+		maxConcurrentRequests: maxConcurrentRequests,
+		maxQueueDuration:      maxQueueDuration,
+
+		requestsTotal: s.ms.NewCounter(fmt.Sprintf(`vm_search_queue_requests_total{queue=%q}`, name)),
+		timeoutsTotal: s.ms.NewCounter(fmt.Sprintf(`vm_search_queue_timeouts_total{queue=%q}`, name)),
+		waitDuration:  s.ms.NewHistogram(fmt.Sprintf(`vm_search_queue_wait_duration_seconds{queue=%q}`, name)),
+	}
+	_ = s.ms.NewGauge(fmt.Sprintf(`vm_search_queue_requests_waiting{queue=%q}`, name), func() float64 {
+		s.mu.Lock()
+		n := len(q.waiters)
+		s.mu.Unlock()
+		return float64(n)
+	})
+	_ = s.ms.NewGauge(fmt.Sprintf(`vm_search_queue_requests_running{queue=%q}`, name), func() float64 {
+		s.mu.Lock()
+		n := q.running
+		s.mu.Unlock()
+		return float64(n)
+	})
+	s.queues = append(s.queues, q)
+}
+
+func (s *scheduler) getQueue(r *http.Request) *Queue {
+	for _, q := range s.queues {
+		if q.match.matches(r) {
+			return q
+		}
+	}
+	logger.Panicf("BUG: the last queue must match all the requests")
+	return nil
+}
+
+func (s *scheduler) getRunning() int {
+	s.mu.Lock()
+	n := s.running
+	s.mu.Unlock()
+	return n
+}
+
+func (s *scheduler) canRunLocked(q *Queue) bool {
+	if s.running >= s.capacity {
+		return false
+	}
+	return q.maxConcurrentRequests <= 0 || q.running < q.maxConcurrentRequests
+}
+
+func (s *scheduler) runLocked(q *Queue) {
+	q.running++
+	s.running++
+}
+
+// dispatchLocked grants free concurrency slots to waiting requests.
+//
+// The slot is granted to the first waiter from the queue with the lowest ratio of running requests to the queue share.
+// This guarantees that every queue gets at least its share of concurrency slots under load,
+// while idle slots can be used by other queues.
+func (s *scheduler) dispatchLocked() {
+	for s.running < s.capacity {
+		var qBest *Queue
+		for _, q := range s.queues {
+			if len(q.waiters) == 0 || !s.canRunLocked(q) {
+				continue
+			}
+			if qBest == nil || float64(q.running)/q.share < float64(qBest.running)/qBest.share {
+				qBest = q
+			}
+		}
+		if qBest == nil {
+			return
+		}
+		w := qBest.waiters[0]
+		qBest.waiters = qBest.waiters[1:]
+		s.runLocked(qBest)
+		w.ch <- struct{}{}
+	}
+}
+
+type requestMatcher struct {
+	headers []headerMatcher
+	user    *regexutil.PromRegex
+	path    *regexutil.PromRegex
+}
+
+type headerMatcher struct {
+	name  string
+	value *regexutil.PromRegex
+}
+
+func newRequestMatcher(mc *MatchConfig) (*requestMatcher, error) {
+	if mc == nil || (len(mc.Headers) == 0 && mc.User == "" && mc.Path == "") {
+		return nil, nil
+	}
+	var rm requestMatcher
+	for name, value := range mc.Headers {
+		re, err := regexutil.NewPromRegex(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse regexp for header %q: %w", name, err)
+		}
+		rm.headers = append(rm.headers, headerMatcher{
+			name:  http.CanonicalHeaderKey(name),
+			value: re,
+		})
+	}
+	slices.SortFunc(rm.headers, func(a, b headerMatcher) int {
+		return strings.Compare(a.name, b.name)
+	})
+	if mc.User != "" {
+		re, err := regexutil.NewPromRegex(mc.User)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse regexp for user: %w", err)
+		}
+		rm.user = re
+	}
+	if mc.Path != "" {
+		re, err := regexutil.NewPromRegex(mc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse regexp for path: %w", err)
+		}
+		rm.path = re
+	}
+	return &rm, nil
+}
+
+// matches returns true if r matches rm.
+//
+// nil rm matches all the requests.
+func (rm *requestMatcher) matches(r *http.Request) bool {
+	if rm == nil {
+		return true
+	}
+	for _, hm := range rm.headers {
+		if !hm.value.MatchString(r.Header.Get(hm.name)) {
+			return false
+		}
+	}
+	if rm.user != nil {
+		username, _, _ := r.BasicAuth()
+		if !rm.user.MatchString(username) {
+			return false
+		}
+	}
+	if rm.path != nil && !rm.path.MatchString(r.URL.Path) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package searchqueue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewSchedulerFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		cfgs, err := parseConfig([]byte(data))
+		if err != nil {
+			return
+		}
+		if _, err := newScheduler(cfgs, 4, time.Second); err == nil {
+			t.Fatalf("expecting non-nil error for config\n%s", data)
+		}
+	}
+
+	// unknown field
+	f(`
+- name: foo
+  foobar: baz
+`)
+
+	// missing name
+	f(`
+- share: 2
+`)
+
+	// duplicate name
+	f(`
+- name: foo
+  match:
+    path: /api/v1/export
+- name: foo
+`)
+
+	// queue after catch-all queue
+	f(`
+- name: foo
+- name: bar
+  match:
+    path: /api/v1/export
+`)
+
+	// negative share
+	f(`
+- name: foo
+  share: -1
+`)
+
+	// negative max_concurrent_requests
+	f(`
+- name: foo
+  max_concurrent_requests: -1
+`)
+
+	// invalid regexp
+	f(`
+- name: foo
+  match:
+    headers:
+      User-Agent: "vmalert("
+`)
+	f(`
+- name: foo
+  match:
+    user: "("
+`)
+
+	// default queue with match conditions
+	f(`
+- name: default
+  match:
+    path: /api/v1/export
+`)
+}
+
+func TestSchedulerGetQueue(t *testing.T) {
+	cfgs, err := parseConfig([]byte(`
+- name: alerting
+  match:
+    headers:
+      user-agent: "vmalert.*"
+  share: 3
+  max_queue_duration: 1m
+- name: export
+  match:
+    path: "/api/v1/export.*"
+- name: team-a
+  match:
+    user: "team-a|team-b"
+`))
+	if err != nil {
+		t.Fatalf("cannot parse config: %s", err)
+	}
+	s, err := newScheduler(cfgs, 4, 10*time.Second)
+	if err != nil {
+		t.Fatalf("cannot create scheduler: %s", err)
+	}
+
+	f := func(r *http.Request, nameExpected string, maxQueueDurationExpected time.Duration) {
+		t.Helper()
+
+		q := s.getQueue(r)
+		if q.Name() != nameExpected {
+			t.Fatalf("unexpected queue; got %q; want %q", q.Name(), nameExpected)
+		}
+		if q.MaxQueueDuration() != maxQueueDurationExpected {
+			t.Fatalf("unexpected max queue duration; got %s; want %s", q.MaxQueueDuration(), maxQueueDurationExpected)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set("User-Agent", "vmalert/v1.120.0")
+	f(r, "alerting", time.Minute)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/export", nil)
+	f(r, "export", 10*time.Second)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.SetBasicAuth("team-b", "secret")
+	f(r, "team-a", 10*time.Second)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.SetBasicAuth("team-c", "secret")
+	f(r, "default", 10*time.Second)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set("User-Agent", "Grafana/12.0.0")
+	f(r, "default", 10*time.Second)
+}
+
+func TestQueueAcquireRelease(t *testing.T) {
+	cfgs, err := parseConfig([]byte(`
+- name: alerting
+  match:
+    path: /alerting
+  share: 3
+- name: dashboards
+  max_concurrent_requests: 2
+`))
+	if err != nil {
+		t.Fatalf("cannot parse config: %s", err)
+	}
+	s, err := newScheduler(cfgs, 3, time.Second)
+	if err != nil {
+		t.Fatalf("cannot create scheduler: %s", err)
+	}
+	qAlerting := s.queues[0]
+	qDashboards := s.queues[1]
+
+	// dashboards queue cannot exceed max_concurrent_requests
+	if !qDashboards.TryAcquire() || !qDashboards.TryAcquire() {
+		t.Fatalf("expecting successful TryAcquire for dashboards queue")
+	}
+	if qDashboards.TryAcquire() {
+		t.Fatalf("expecting unsuccessful TryAcquire for dashboards queue with max_concurrent_requests=2")
+	}
+	if err := qDashboards.Acquire(context.Background(), 10*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error; got %v; want %v", err, ErrTimeout)
+	}
+
+	// the remaining slot can be used by alerting queue
+	if !qAlerting.TryAcquire() {
+		t.Fatalf("expecting successful TryAcquire for alerting queue")
+	}
+	if n := s.getRunning(); n != 3 {
+		t.Fatalf("unexpected number of running requests; got %d; want 3", n)
+	}
+
+	// canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := qAlerting.Acquire(ctx, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error; got %v; want %v", err, context.Canceled)
+	}
+
+	// the freed slot must be granted to the queue with the lowest running/share ratio,
+	// e.g. to alerting queue with 1/3 ratio instead of dashboards queue with 1/1 ratio.
+	qDashboards.Release()
+	if !qDashboards.TryAcquire() {
+		t.Fatalf("expecting successful TryAcquire for dashboards queue")
+	}
+	resultCh := make(chan string, 2)
+	go func() {
+		if err := qDashboards.Acquire(context.Background(), 5*time.Second); err != nil {
+			resultCh <- err.Error()
+			return
+		}
+		resultCh <- "dashboards"
+	}()
+	go func() {
+		if err := qAlerting.Acquire(context.Background(), 5*time.Second); err != nil {
+			resultCh <- err.Error()
+			return
+		}
+		resultCh <- "alerting"
+	}()
+	for {
+		s.mu.Lock()
+		n := len(qAlerting.waiters) + len(qDashboards.waiters)
+		s.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	qDashboards.Release()
+	if result := <-resultCh; result != "alerting" {
+		t.Fatalf("unexpected request granted the free slot; got %q; want %q", result, "alerting")
+	}
+	qAlerting.Release()
+	if result := <-resultCh; result != "dashboards" {
+		t.Fatalf("unexpected request granted the free slot; got %q; want %q", result, "dashboards")
+	}
+
+	// release all the slots
+	qAlerting.Release()
+	qDashboards.Release()
+	qDashboards.Release()
+	if n := s.getRunning(); n != 0 {
+		t.Fatalf("unexpected number of running requests; got %d; want 0", n)
+	}
+}
@@ -1,6 +1,7 @@
 package searchutil
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -81,6 +82,9 @@ func getDeadlineWithMaxDuration(r *http.Request, startTime time.Time, dMax int64
 type Deadline struct {
 	deadline uint64
 
+	// ctx is set via WithContext. The request is canceled when ctx is canceled.
+	ctx context.Context
+
 	timeout  time.Duration
 	flagHint string
 }
@@ -97,18 +101,39 @@ func NewDeadline(startTime time.Time, timeout time.Duration, flagHint string) De
 	}
 }
 
-// Exceeded returns true if deadline is exceeded.
+// WithContext returns a copy of d, which becomes exceeded when ctx is canceled.
+func (d *Deadline) WithContext(ctx context.Context) Deadline {
+	dNew := *d
+	dNew.ctx = ctx
+	return dNew
+}
+
+// Canceled returns true if the context passed to WithContext has been canceled.
+func (d *Deadline) Canceled() bool {
+	return d.ctx != nil && d.ctx.Err() != nil
+}
+
+// Exceeded returns true if deadline is exceeded or if d has been canceled.
 func (d *Deadline) Exceeded() bool {
-	return fasttime.UnixTimestamp() > d.deadline
+	return fasttime.UnixTimestamp() > d.deadline || d.Canceled()
 }
 
-// Deadline returns deadline in unix timestamp seconds.
-func (d *Deadline) Deadline() uint64 {
-	return d.deadline
+// Deadline returns deadline for search operations in lib/storage.
+//
+// The search operations are stopped when the context passed to WithContext is canceled.
+func (d *Deadline) Deadline() storage.Deadline {
+	var done <-chan struct{}
+	if d.ctx != nil {
+		done = d.ctx.Done()
+	}
+	return storage.NewDeadline(d.deadline, done)
 }
 
 // String returns human-readable string representation for d.
 func (d *Deadline) String() string {
+	if d.Canceled() {
+		return "the request has been canceled"
+	}
 	startTime := time.Unix(int64(d.deadline), 0).Add(-d.timeout)
 	elapsed := time.Since(startTime)
 	msg := fmt.Sprintf("%.3f seconds (elapsed %.3f seconds)", d.timeout.Seconds(), elapsed.Seconds())
@@ -1,6 +1,7 @@
 package searchutil
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -281,3 +282,27 @@ func TestGetDeadline(t *testing.T) {
 	f(GetDeadlineForStatusRequest(r, start), expDeadline(time.Second))
 	f(GetDeadlineForQuery(r, start), expDeadline(time.Second))
 }
+
+func TestDeadlineWithContext(t *testing.T) {
+	d := NewDeadline(time.Now(), time.Hour, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	dc := d.WithContext(ctx)
+	dCopy := dc
+	if dc.Exceeded() || dCopy.Exceeded() {
+		t.Fatalf("unexpected exceeded deadline before cancel")
+	}
+	sd := dc.Deadline()
+	cancel()
+	if !dc.Canceled() || !dc.Exceeded() {
+		t.Fatalf("expecting canceled deadline after cancel")
+	}
+	if !dCopy.Canceled() || !dCopy.Exceeded() {
+		t.Fatalf("expecting canceled deadline copy after cancel")
+	}
+	if d.Canceled() || d.Exceeded() {
+		t.Fatalf("the original deadline mustn't be canceled")
+	}
+	if sd != dc.Deadline() {
+		t.Fatalf("the storage deadline must remain the same after cancel")
+	}
+}
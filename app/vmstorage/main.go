@@ -20,6 +20,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
@@ -60,6 +61,15 @@ var (
 		"Excess series are logged and dropped. This can be useful for limiting series churn rate. See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#cardinality-limiter . "+
 		"See also -storage.maxHourlySeries")
 
+	retentionFilters = flagutil.NewArrayString("retentionFilter", "Retention filter in the format 'series_selector:duration'. "+
+		"For example, '{team=\"dev\"}:7d' keeps samples for time series with team=\"dev\" label for 7 days. "+
+		"The smallest retention across matching filters is applied to every time series. Time series, which do not match any filter, use -retentionPeriod. "+
+		"The duration cannot exceed -retentionPeriod. See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#retention-filters")
+	downsamplingPeriods = flagutil.NewArrayString("downsampling.period", "Comma-separated downsampling periods in the format 'offset:interval'. "+
+		"For example, '30d:5m,180d:1h' leaves the last sample per each 5-minute interval for samples older than 30 days "+
+		"and the last sample per each hour for samples older than 180 days. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#downsampling")
+
 	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which the storage stops accepting new data")
 
 	cacheSizeStorageTSID = flagutil.NewBytes("storage.cacheSizeStorageTSID", 0, "Overrides max size for storage/tsid cache. "+
@@ -84,6 +94,16 @@ var (
 		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#track-ingested-metrics-usage")
 	cacheSizeMetricNamesStats = flagutil.NewBytes("storage.cacheSizeMetricNamesStats", 0, "Overrides max size for storage/metricNamesStatsTracker cache. "+
 		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#cache-tuning")
+	cacheSizeMetricsMetadata = flagutil.NewBytes("storage.cacheSizeMetricsMetadata", 0, "Overrides max size for storage/metricsMetadata cache, which holds metrics metadata ingested with -enableMetadata. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#cache-tuning")
+	metricsMetadataMaxAge = flag.Duration("storage.metricsMetadataMaxAge", 24*time.Hour, "The maximum duration for keeping metrics metadata, which wasn't ingested during this duration. "+
+		"Metrics metadata is available via /api/v1/metadata API. See also -enableMetadata")
+	cacheSizeExemplars = flagutil.NewBytes("storage.cacheSizeExemplars", 0, "Overrides max size for storage/exemplars cache, which holds exemplars ingested with -enableExemplars. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#cache-tuning")
+	maxExemplarsPerSeries = flag.Int("storage.maxExemplarsPerSeries", 10, "The maximum number of the most recent exemplars to keep per each series. "+
+		"Exemplars are available via /api/v1/query_exemplars API. See also -enableExemplars and -storage.exemplarsRetention")
+	exemplarsRetention = flag.Duration("storage.exemplarsRetention", 24*time.Hour, "The maximum age of exemplars to keep. Older exemplars are dropped. "+
+		"See also -enableExemplars and -storage.maxExemplarsPerSeries")
 
 	idbPrefillStart = flag.Duration("storage.idbPrefillStart", time.Hour, "Specifies how early VictoriaMetrics starts pre-filling indexDB records before indexDB rotation. "+
 		"Starting the pre-fill process earlier can help reduce resource usage spikes during rotation. "+
@@ -119,6 +139,8 @@ func Init(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 	storage.SetTSIDCacheSize(cacheSizeStorageTSID.IntN())
 	storage.SetTagFiltersCacheSize(cacheSizeIndexDBTagFilters.IntN())
 	storage.SetMetricNamesStatsCacheSize(cacheSizeMetricNamesStats.IntN())
+	storage.SetMetricsMetadataCacheSize(cacheSizeMetricsMetadata.IntN())
+	storage.SetExemplarsCacheSize(cacheSizeExemplars.IntN())
 	storage.SetMetricNameCacheSize(cacheSizeStorageMetricName.IntN())
 	mergeset.SetIndexBlocksCacheSize(cacheSizeIndexDBIndexBlocks.IntN())
 	mergeset.SetDataBlocksCacheSize(cacheSizeIndexDBDataBlocks.IntN())
@@ -127,6 +149,13 @@ func Init(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 	if retentionPeriod.Duration() < 24*time.Hour {
 		logger.Fatalf("-retentionPeriod cannot be smaller than a day; got %s", retentionPeriod)
 	}
+	if err := storage.SetDownsamplingPeriods(*downsamplingPeriods); err != nil {
+		logger.Fatalf("invalid -downsampling.period: %s", err)
+	}
+	rfs, err := parseRetentionFilters(*retentionFilters)
+	if err != nil {
+		logger.Fatalf("invalid -retentionFilter: %s", err)
+	}
 	if *idbPrefillStart > 23*time.Hour {
 		logger.Panicf("-storage.idbPrefillStart cannot exceed 23 hours; got %s", idbPrefillStart)
 	}
@@ -141,6 +170,10 @@ func Init(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 		TrackMetricNamesStats: *trackMetricNamesStats,
 		IDBPrefillStart:       *idbPrefillStart,
 		LogNewSeries:          *logNewSeries,
+		MetricsMetadataMaxAge: *metricsMetadataMaxAge,
+		MaxExemplarsPerSeries: *maxExemplarsPerSeries,
+		ExemplarsRetention:    *exemplarsRetention,
+		RetentionFilters:      rfs,
 	}
 	strg := storage.MustOpenStorage(*DataPath, opts)
 	Storage = strg
@@ -196,6 +229,36 @@ func AddRows(mrs []storage.MetricRow) error {
 
 var errReadOnly = errors.New("the storage is in read-only mode; check -storage.minFreeDiskSpaceBytes command-line flag value")
 
+// AddMetricsMetadata adds mms to the storage.
+func AddMetricsMetadata(mms []prompb.MetricMetadata) {
+	WG.Add(1)
+	Storage.AddMetricsMetadata(mms)
+	WG.Done()
+}
+
+// SearchMetricsMetadata returns metrics metadata for the given metricFamilyName.
+func SearchMetricsMetadata(qt *querytracer.Tracer, metricFamilyName string, limit, limitPerMetric int) []prompb.MetricMetadata {
+	WG.Add(1)
+	mms := Storage.SearchMetricsMetadata(qt, metricFamilyName, limit, limitPerMetric)
+	WG.Done()
+	return mms
+}
+
+// AddExemplars adds ers to the storage.
+func AddExemplars(ers []storage.ExemplarRow) {
+	WG.Add(1)
+	Storage.AddExemplars(ers)
+	WG.Done()
+}
+
+// SearchExemplars returns exemplars on the given tr for the given metricName.
+func SearchExemplars(metricName string, tr storage.TimeRange) []prompb.Exemplar {
+	WG.Add(1)
+	exemplars := Storage.SearchExemplars(metricName, tr)
+	WG.Done()
+	return exemplars
+}
+
 // RegisterMetricNames registers all the metrics from mrs in the storage.
 func RegisterMetricNames(qt *querytracer.Tracer, mrs []storage.MetricRow) {
 	WG.Add(1)
@@ -229,15 +292,23 @@ func ResetMetricNamesStats(qt *querytracer.Tracer) {
 }
 
 // SearchMetricNames returns metric names for the given tfss on the given tr.
-func SearchMetricNames(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline uint64) ([]string, error) {
+func SearchMetricNames(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline storage.Deadline) ([]string, error) {
 	WG.Add(1)
 	metricNames, err := Storage.SearchMetricNames(qt, tfss, tr, maxMetrics, deadline)
 	WG.Done()
 	return metricNames, err
 }
 
+// SearchSeriesCount returns the number of series matching the given tfss on tr.
+func SearchSeriesCount(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline storage.Deadline) (int, error) {
+	WG.Add(1)
+	n, err := Storage.SearchSeriesCount(qt, tfss, tr, maxMetrics, deadline)
+	WG.Done()
+	return n, err
+}
+
 // SearchLabelNames searches for tag keys matching the given tfss on tr.
-func SearchLabelNames(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, maxTagKeys, maxMetrics int, deadline uint64) ([]string, error) {
+func SearchLabelNames(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr storage.TimeRange, maxTagKeys, maxMetrics int, deadline storage.Deadline) ([]string, error) {
 	WG.Add(1)
 	labelNames, err := Storage.SearchLabelNames(qt, tfss, tr, maxTagKeys, maxMetrics, deadline)
 	WG.Done()
@@ -246,7 +317,7 @@ func SearchLabelNames(qt *querytracer.Tracer, tfss []*storage.TagFilters, tr sto
 
 // SearchLabelValues searches for label values for the given labelName, tfss and
 // tr.
-func SearchLabelValues(qt *querytracer.Tracer, labelName string, tfss []*storage.TagFilters, tr storage.TimeRange, maxLabelValues, maxMetrics int, deadline uint64) ([]string, error) {
+func SearchLabelValues(qt *querytracer.Tracer, labelName string, tfss []*storage.TagFilters, tr storage.TimeRange, maxLabelValues, maxMetrics int, deadline storage.Deadline) ([]string, error) {
 	WG.Add(1)
 	labelValues, err := Storage.SearchLabelValues(qt, labelName, tfss, tr, maxLabelValues, maxMetrics, deadline)
 	WG.Done()
@@ -256,7 +327,7 @@ func SearchLabelValues(qt *querytracer.Tracer, labelName string, tfss []*storage
 // SearchTagValueSuffixes returns all the tag value suffixes for the given tagKey and tagValuePrefix on the given tr.
 //
 // This allows implementing https://graphite-api.readthedocs.io/en/latest/api.html#metrics-find or similar APIs.
-func SearchTagValueSuffixes(qt *querytracer.Tracer, tr storage.TimeRange, tagKey, tagValuePrefix string, delimiter byte, maxTagValueSuffixes int, deadline uint64) ([]string, error) {
+func SearchTagValueSuffixes(qt *querytracer.Tracer, tr storage.TimeRange, tagKey, tagValuePrefix string, delimiter byte, maxTagValueSuffixes int, deadline storage.Deadline) ([]string, error) {
 	WG.Add(1)
 	suffixes, err := Storage.SearchTagValueSuffixes(qt, tr, tagKey, tagValuePrefix, delimiter, maxTagValueSuffixes, deadline)
 	WG.Done()
@@ -264,7 +335,7 @@ func SearchTagValueSuffixes(qt *querytracer.Tracer, tr storage.TimeRange, tagKey
 }
 
 // SearchGraphitePaths returns all the metric names matching the given Graphite query.
-func SearchGraphitePaths(qt *querytracer.Tracer, tr storage.TimeRange, query []byte, maxPaths int, deadline uint64) ([]string, error) {
+func SearchGraphitePaths(qt *querytracer.Tracer, tr storage.TimeRange, query []byte, maxPaths int, deadline storage.Deadline) ([]string, error) {
 	WG.Add(1)
 	paths, err := Storage.SearchGraphitePaths(qt, tr, query, maxPaths, deadline)
 	WG.Done()
@@ -272,7 +343,7 @@ func SearchGraphitePaths(qt *querytracer.Tracer, tr storage.TimeRange, query []b
 }
 
 // GetTSDBStatus returns TSDB status for given filters on the given date.
-func GetTSDBStatus(qt *querytracer.Tracer, tfss []*storage.TagFilters, date uint64, focusLabel string, topN, maxMetrics int, deadline uint64) (*storage.TSDBStatus, error) {
+func GetTSDBStatus(qt *querytracer.Tracer, tfss []*storage.TagFilters, date uint64, focusLabel string, topN, maxMetrics int, deadline storage.Deadline) (*storage.TSDBStatus, error) {
 	WG.Add(1)
 	status, err := Storage.GetTSDBStatus(qt, tfss, date, focusLabel, topN, maxMetrics, deadline)
 	WG.Done()
@@ -280,13 +351,31 @@ func GetTSDBStatus(qt *querytracer.Tracer, tfss []*storage.TagFilters, date uint
 }
 
 // GetSeriesCount returns the number of time series in the storage.
-func GetSeriesCount(deadline uint64) (uint64, error) {
+func GetSeriesCount(deadline storage.Deadline) (uint64, error) {
 	WG.Add(1)
 	n, err := Storage.GetSeriesCount(deadline)
 	WG.Done()
 	return n, err
 }
 
+func parseRetentionFilters(items []string) ([]storage.RetentionFilter, error) {
+	var rfs []storage.RetentionFilter
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		rf, err := storage.ParseRetentionFilter(item)
+		if err != nil {
+			return nil, err
+		}
+		if rf.Retention > retentionPeriod.Duration() {
+			return nil, fmt.Errorf("retention in %q cannot exceed -retentionPeriod=%s", item, retentionPeriod)
+		}
+		rfs = append(rfs, *rf)
+	}
+	return rfs, nil
+}
+
 // Stop stops the vmstorage
 func Stop() {
 	// deregister storage metrics
@@ -696,8 +785,21 @@ func writeStorageMetrics(w io.Writer, strg *storage.Storage) {
 		metrics.WriteCounterUint64(w, `vm_cache_size_max_bytes{type="storage/metricNamesStatsTracker"}`, m.MetricNamesUsageTrackerSizeMaxBytes)
 	}
 
+	metrics.WriteGaugeUint64(w, `vm_cache_entries{type="storage/metricsMetadata"}`, m.MetricsMetadataSize)
+	metrics.WriteGaugeUint64(w, `vm_cache_size_bytes{type="storage/metricsMetadata"}`, m.MetricsMetadataSizeBytes)
+	metrics.WriteGaugeUint64(w, `vm_cache_size_max_bytes{type="storage/metricsMetadata"}`, m.MetricsMetadataSizeMaxBytes)
+	metrics.WriteCounterUint64(w, `vm_metrics_metadata_dropped_total{reason="cache_size"}`, m.MetricsMetadataDropped)
+
+	metrics.WriteGaugeUint64(w, `vm_cache_entries{type="storage/exemplars"}`, m.ExemplarsSize)
+	metrics.WriteGaugeUint64(w, `vm_cache_size_bytes{type="storage/exemplars"}`, m.ExemplarsSizeBytes)
+	metrics.WriteGaugeUint64(w, `vm_cache_size_max_bytes{type="storage/exemplars"}`, m.ExemplarsSizeMaxBytes)
+	metrics.WriteGaugeUint64(w, `vm_exemplars_series`, m.ExemplarsSeriesCount)
+	metrics.WriteCounterUint64(w, `vm_exemplars_dropped_total{reason="cache_size"}`, m.ExemplarsDropped)
+
 	metrics.WriteGaugeUint64(w, `vm_downsampling_partitions_scheduled`, tm.ScheduledDownsamplingPartitions)
 	metrics.WriteGaugeUint64(w, `vm_downsampling_partitions_scheduled_size_bytes`, tm.ScheduledDownsamplingPartitionsSize)
+	metrics.WriteGaugeUint64(w, `vm_retention_filters_partitions_scheduled`, tm.ScheduledRetentionFiltersPartitions)
+	metrics.WriteGaugeUint64(w, `vm_retention_filters_partitions_scheduled_size_bytes`, tm.ScheduledRetentionFiltersPartitionsSize)
 }
 
 func jsonResponseError(w http.ResponseWriter, err error) {
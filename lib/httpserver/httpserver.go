@@ -31,6 +31,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 var (
@@ -351,9 +352,16 @@ func handlerWrapper(w http.ResponseWriter, r *http.Request, rh RequestHandler) {
 		r.URL.Path = path
 	}
 
-	w = &responseWriterWithAbort{
+	rwa := &responseWriterWithAbort{
 		ResponseWriter: w,
 	}
+	w = rwa
+	if span := tracing.StartRequestSpan(r); span != nil {
+		r = r.WithContext(tracing.NewContext(r.Context(), span))
+		defer func() {
+			span.End(rwa.getStatusCode())
+		}()
+	}
 	if rh(w, r) {
 		return
 	}
@@ -577,6 +585,17 @@ type responseWriterWithAbort struct {
 
 	sentHeaders bool
 	aborted     bool
+
+	// statusCode is the response status code passed to WriteHeader.
+	statusCode int
+}
+
+// getStatusCode returns the response status code sent to the client.
+func (rwa *responseWriterWithAbort) getStatusCode() int {
+	if rwa.statusCode == 0 {
+		return http.StatusOK
+	}
+	return rwa.statusCode
 }
 
 func (rwa *responseWriterWithAbort) Write(data []byte) (int, error) {
@@ -600,6 +619,7 @@ func (rwa *responseWriterWithAbort) WriteHeader(statusCode int) {
 	}
 	rwa.ResponseWriter.WriteHeader(statusCode)
 	rwa.sentHeaders = true
+	rwa.statusCode = statusCode
 }
 
 // Flush implements net/http.Flusher interface
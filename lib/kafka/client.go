@@ -0,0 +1,771 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+)
+
+// Special timestamps for Client.ListOffset.
+const (
+	// OffsetLatest is the timestamp for obtaining the offset of the next record to be produced to the partition.
+	OffsetLatest = -1
+
+	// OffsetEarliest is the timestamp for obtaining the offset of the first available record in the partition.
+	OffsetEarliest = -2
+)
+
+// ClientOptions contains options for Client.
+type ClientOptions struct {
+	// ClientID is sent to Kafka brokers in every request. It is used by brokers for logging and quotas.
+	ClientID string
+
+	// TLSConfig is used for connecting to Kafka brokers if set.
+	TLSConfig *tls.Config
+
+	// SASLUsername and SASLPassword are used for authenticating at Kafka brokers with SASL PLAIN mechanism if SASLUsername is set.
+	SASLUsername string
+	SASLPassword string
+
+	// DialTimeout is the timeout for establishing connections to Kafka brokers.
+	DialTimeout time.Duration
+
+	// RequestTimeout is the timeout for Kafka requests.
+	RequestTimeout time.Duration
+}
+
+// InitSecurity initializes TLS and SASL options according to the given Kafka securityProtocol.
+//
+// Supported securityProtocol values are PLAINTEXT, SSL, SASL_PLAINTEXT and SASL_SSL. An empty value means PLAINTEXT.
+// getTLSConfig is called only for SSL and SASL_SSL, while username and password are used only for SASL_PLAINTEXT and SASL_SSL.
+func (opts *ClientOptions) InitSecurity(securityProtocol string, getTLSConfig func() (*tls.Config, error), username, password string) error {
+	var useTLS, useSASL bool
+	switch securityProtocol {
+	case "", "PLAINTEXT":
+	case "SSL":
+		useTLS = true
+	case "SASL_PLAINTEXT":
+		useSASL = true
+	case "SASL_SSL":
+		useTLS = true
+		useSASL = true
+	default:
+		return fmt.Errorf("unsupported security protocol %q; supported values: PLAINTEXT, SSL, SASL_PLAINTEXT, SASL_SSL", securityProtocol)
+	}
+	if useTLS {
+		tlsCfg, err := getTLSConfig()
+		if err != nil {
+			return fmt.Errorf("cannot initialize TLS config: %w", err)
+		}
+		opts.TLSConfig = tlsCfg
+	}
+	if useSASL {
+		if username == "" {
+			return fmt.Errorf("missing SASL username for security protocol %q", securityProtocol)
+		}
+		opts.SASLUsername = username
+		opts.SASLPassword = password
+	}
+	return nil
+}
+
+// Client is a minimal Kafka client.
+//
+// It supports producing records to the given partitions, fetching records from the given partitions,
+// consumer group membership and storing consumer offsets at Kafka group coordinator.
+//
+// Client is safe for concurrent use. Requests to the same broker are sent sequentially.
+type Client struct {
+	bootstrapBrokers []string
+	opts             ClientOptions
+
+	mu           sync.Mutex
+	brokers      map[int32]string
+	conns        map[string]*brokerConn
+	topics       map[string]*topicMetadata
+	coordinators map[string]string
+}
+
+type topicMetadata struct {
+	// leaders contains leader broker id per each partition
+	leaders    map[int32]int32
+	partitions []int32
+	updatedAt  time.Time
+}
+
+// metadataRefreshInterval is the interval for refreshing topic metadata.
+const metadataRefreshInterval = time.Minute
+
+// NewClient returns new Client for the given bootstrapBrokers.
+//
+// Call Close when the client is no longer needed.
+func NewClient(bootstrapBrokers []string, opts *ClientOptions) *Client {
+	c := &Client{
+		bootstrapBrokers: append([]string{}, bootstrapBrokers...),
+		brokers:          make(map[int32]string),
+		conns:            make(map[string]*brokerConn),
+		topics:           make(map[string]*topicMetadata),
+		coordinators:     make(map[string]string),
+	}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.ClientID == "" {
+		c.opts.ClientID = "vmagent"
+	}
+	if c.opts.DialTimeout <= 0 {
+		c.opts.DialTimeout = 10 * time.Second
+	}
+	if c.opts.RequestTimeout <= 0 {
+		c.opts.RequestTimeout = 30 * time.Second
+	}
+	return c
+}
+
+// Close closes all the connections to Kafka brokers.
+func (c *Client) Close() {
+	c.mu.Lock()
+	conns := c.conns
+	c.conns = make(map[string]*brokerConn)
+	c.mu.Unlock()
+
+	for _, bc := range conns {
+		bc.close()
+	}
+}
+
+// Partitions returns partition ids for the given topic.
+func (c *Client) Partitions(topic string) ([]int32, error) {
+	tm, err := c.getTopicMetadata(topic)
+	if err != nil {
+		return nil, err
+	}
+	return tm.partitions, nil
+}
+
+// Produce writes records to the given topic partition and waits until they are written to all the in-sync replicas.
+//
+// It returns the offset of the first written record.
+func (c *Client) Produce(topic string, partition int32, records []Record) (int64, error) {
+	bc, err := c.getLeaderConn(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	e := encoder{}
+	e.nullString() // transactional_id
+	e.int16(-1)    // acks=all
+	e.int32(int32(c.opts.RequestTimeout.Milliseconds()))
+	e.arrayLen(1)
+	e.string(topic)
+	e.arrayLen(1)
+	e.int32(partition)
+	e.bytes(marshalRecordBatch(nil, records))
+
+	resp, err := c.roundTrip(bc, apiKeyProduce, apiVersionProduce, e.b, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot produce records to topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	var errCode int16
+	var baseOffset int64
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		_ = d.string() // topic
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			_ = d.int32() // partition
+			errCode = d.int16()
+			baseOffset = d.int64()
+			_ = d.int64() // log_append_time_ms
+		}
+	}
+	_ = d.int32() // throttle_time_ms
+	if d.err != nil {
+		return 0, fmt.Errorf("cannot parse produce response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleError(topic, err)
+		return 0, fmt.Errorf("cannot produce records to topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+	return baseOffset, nil
+}
+
+// Fetch returns records with offsets starting from the given offset for the given topic partition.
+//
+// It waits for up to maxWait if there are no new records in the partition.
+// It returns up to maxBytes of record batches, but may return more if the first record batch exceeds maxBytes.
+func (c *Client) Fetch(topic string, partition int32, offset int64, maxWait time.Duration, maxBytes int) ([]Record, error) {
+	bc, err := c.getLeaderConn(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	e := encoder{}
+	e.int32(-1) // replica_id
+	e.int32(int32(maxWait.Milliseconds()))
+	e.int32(1) // min_bytes
+	e.int32(int32(maxBytes))
+	e.int8(1) // isolation_level=READ_COMMITTED
+	e.arrayLen(1)
+	e.string(topic)
+	e.arrayLen(1)
+	e.int32(partition)
+	e.int64(offset)
+	e.int32(int32(maxBytes))
+
+	resp, err := c.roundTrip(bc, apiKeyFetch, apiVersionFetch, e.b, maxWait)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch records from topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	_ = d.int32() // throttle_time_ms
+	var errCode int16
+	var recordsData []byte
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		_ = d.string() // topic
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			_ = d.int32() // partition_index
+			errCode = d.int16()
+			_ = d.int64() // high_watermark
+			_ = d.int64() // last_stable_offset
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				_ = d.int64() // aborted_transactions.producer_id
+				_ = d.int64() // aborted_transactions.first_offset
+			}
+			recordsData = d.bytes()
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("cannot parse fetch response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleError(topic, err)
+		return nil, fmt.Errorf("cannot fetch records from topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+	records, err := unmarshalRecordBatches(nil, recordsData, offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal records fetched from topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+	return records, nil
+}
+
+// ListOffset returns the offset for the given timestamp in milliseconds at the given topic partition.
+//
+// Use OffsetEarliest and OffsetLatest timestamps for obtaining the earliest and the latest offsets.
+func (c *Client) ListOffset(topic string, partition int32, timestamp int64) (int64, error) {
+	bc, err := c.getLeaderConn(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	e := encoder{}
+	e.int32(-1) // replica_id
+	e.arrayLen(1)
+	e.string(topic)
+	e.arrayLen(1)
+	e.int32(partition)
+	e.int64(timestamp)
+
+	resp, err := c.roundTrip(bc, apiKeyListOffsets, apiVersionListOffsets, e.b, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot list offsets for topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	var errCode int16
+	var offset int64
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		_ = d.string() // topic
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			_ = d.int32() // partition_index
+			errCode = d.int16()
+			_ = d.int64() // timestamp
+			offset = d.int64()
+		}
+	}
+	if d.err != nil {
+		return 0, fmt.Errorf("cannot parse list offsets response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleError(topic, err)
+		return 0, fmt.Errorf("cannot list offsets for topic %q partition %d at %q: %w", topic, partition, bc.addr, err)
+	}
+	return offset, nil
+}
+
+// FetchCommittedOffset returns the offset committed by the given consumer group for the given topic partition.
+//
+// It returns -1 if there is no committed offset.
+func (c *Client) FetchCommittedOffset(group, topic string, partition int32) (int64, error) {
+	bc, err := c.getCoordinatorConn(group)
+	if err != nil {
+		return 0, err
+	}
+
+	e := encoder{}
+	e.string(group)
+	e.arrayLen(1)
+	e.string(topic)
+	e.arrayLen(1)
+	e.int32(partition)
+
+	resp, err := c.roundTrip(bc, apiKeyOffsetFetch, apiVersionOffsetFetch, e.b, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot fetch committed offset for group %q topic %q partition %d at %q: %w", group, topic, partition, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	offset := int64(-1)
+	var errCode int16
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		_ = d.string() // topic
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			_ = d.int32() // partition_index
+			offset = d.int64()
+			_ = d.string() // metadata
+			errCode = d.int16()
+		}
+	}
+	if d.err != nil {
+		return 0, fmt.Errorf("cannot parse offset fetch response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleCoordinatorError(group, err)
+		return 0, fmt.Errorf("cannot fetch committed offset for group %q topic %q partition %d at %q: %w", group, topic, partition, bc.addr, err)
+	}
+	return offset, nil
+}
+
+// CommitOffset commits the offset of the next record to consume by the consumer group member gg at the given topic partition.
+//
+// The coordinator rejects the commit with ErrIllegalGeneration or ErrUnknownMemberID if the partition may be assigned to another member.
+// Set gg.GenerationID to -1 and leave gg.MemberID empty for committing the offset without group membership.
+func (c *Client) CommitOffset(gg *GroupGeneration, topic string, partition int32, offset int64) error {
+	group := gg.Group
+	bc, err := c.getCoordinatorConn(group)
+	if err != nil {
+		return err
+	}
+
+	e := encoder{}
+	e.string(group)
+	e.int32(gg.GenerationID)
+	e.string(gg.MemberID)
+	e.int64(-1) // retention_time_ms; -1 means the broker default retention
+	e.arrayLen(1)
+	e.string(topic)
+	e.arrayLen(1)
+	e.int32(partition)
+	e.int64(offset)
+	e.nullString() // committed_metadata
+
+	resp, err := c.roundTrip(bc, apiKeyOffsetCommit, apiVersionOffsetCommit, e.b, 0)
+	if err != nil {
+		return fmt.Errorf("cannot commit offset for group %q topic %q partition %d at %q: %w", group, topic, partition, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	var errCode int16
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		_ = d.string() // topic
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			_ = d.int32() // partition_index
+			errCode = d.int16()
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("cannot parse offset commit response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleCoordinatorError(group, err)
+		return fmt.Errorf("cannot commit offset for group %q topic %q partition %d at %q: %w", group, topic, partition, bc.addr, err)
+	}
+	return nil
+}
+
+func (c *Client) getTopicMetadata(topic string) (*topicMetadata, error) {
+	c.mu.Lock()
+	tm := c.topics[topic]
+	c.mu.Unlock()
+	if tm != nil && time.Since(tm.updatedAt) < metadataRefreshInterval {
+		return tm, nil
+	}
+	return c.refreshMetadata(topic)
+}
+
+func (c *Client) refreshMetadata(topic string) (*topicMetadata, error) {
+	var errs []error
+	for _, addr := range c.getMetadataBrokers() {
+		tm, err := c.fetchMetadata(addr, topic)
+		if err == nil {
+			return tm, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("cannot obtain metadata for topic %q: %w", topic, errors.Join(errs...))
+}
+
+// getMetadataBrokers returns broker addresses for metadata requests.
+//
+// Already known brokers are tried before bootstrap brokers.
+func (c *Client) getMetadataBrokers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addrs := make([]string, 0, len(c.brokers)+len(c.bootstrapBrokers))
+	for _, addr := range c.brokers {
+		addrs = append(addrs, addr)
+	}
+	return append(addrs, c.bootstrapBrokers...)
+}
+
+func (c *Client) fetchMetadata(addr, topic string) (*topicMetadata, error) {
+	bc := c.getConn(addr)
+
+	e := encoder{}
+	e.arrayLen(1)
+	e.string(topic)
+
+	resp, err := c.roundTrip(bc, apiKeyMetadata, apiVersionMetadata, e.b, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain metadata from %q: %w", addr, err)
+	}
+
+	d := decoder{b: resp}
+	brokers := make(map[int32]string)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		nodeID := d.int32()
+		host := d.string()
+		port := d.int32()
+		_ = d.string() // rack
+		brokers[nodeID] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	_ = d.int32() // controller_id
+
+	tm := &topicMetadata{
+		leaders:   make(map[int32]int32),
+		updatedAt: time.Now(),
+	}
+	var topicErrCode int16
+	found := false
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		errCode := d.int16()
+		name := d.string()
+		_ = d.bool() // is_internal
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			_ = d.int16() // partition error_code
+			partition := d.int32()
+			leader := d.int32()
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				_ = d.int32() // replica_nodes
+			}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				_ = d.int32() // isr_nodes
+			}
+			if name == topic {
+				tm.leaders[partition] = leader
+				tm.partitions = append(tm.partitions, partition)
+			}
+		}
+		if name == topic {
+			found = true
+			topicErrCode = errCode
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("cannot parse metadata response from %q: %w", addr, d.err)
+	}
+	if err := errorFromCode(topicErrCode); err != nil {
+		return nil, fmt.Errorf("cannot obtain metadata for topic %q from %q: %w", topic, addr, err)
+	}
+	if !found || len(tm.partitions) == 0 {
+		return nil, fmt.Errorf("cannot obtain metadata for topic %q from %q: %w", topic, addr, ErrUnknownTopicOrPartition)
+	}
+
+	c.mu.Lock()
+	for nodeID, brokerAddr := range brokers {
+		c.brokers[nodeID] = brokerAddr
+	}
+	c.topics[topic] = tm
+	c.mu.Unlock()
+
+	return tm, nil
+}
+
+func (c *Client) getLeaderConn(topic string, partition int32) (*brokerConn, error) {
+	tm, err := c.getTopicMetadata(topic)
+	if err != nil {
+		return nil, err
+	}
+	leader, ok := tm.leaders[partition]
+	if !ok {
+		return nil, fmt.Errorf("cannot find partition %d for topic %q: %w", partition, topic, ErrUnknownTopicOrPartition)
+	}
+	if leader < 0 {
+		c.handleError(topic, ErrLeaderNotAvailable)
+		return nil, fmt.Errorf("cannot find leader for topic %q partition %d: %w", topic, partition, ErrLeaderNotAvailable)
+	}
+
+	c.mu.Lock()
+	addr, ok := c.brokers[leader]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("cannot find address for broker %d, which is the leader for topic %q partition %d", leader, topic, partition)
+	}
+	return c.getConn(addr), nil
+}
+
+func (c *Client) getCoordinatorConn(group string) (*brokerConn, error) {
+	c.mu.Lock()
+	addr, ok := c.coordinators[group]
+	c.mu.Unlock()
+	if ok {
+		return c.getConn(addr), nil
+	}
+
+	var errs []error
+	for _, brokerAddr := range c.getMetadataBrokers() {
+		addr, err := c.findCoordinator(brokerAddr, group)
+		if err == nil {
+			c.mu.Lock()
+			c.coordinators[group] = addr
+			c.mu.Unlock()
+			return c.getConn(addr), nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("cannot find coordinator for group %q: %w", group, errors.Join(errs...))
+}
+
+func (c *Client) findCoordinator(addr, group string) (string, error) {
+	bc := c.getConn(addr)
+
+	e := encoder{}
+	e.string(group)
+
+	resp, err := c.roundTrip(bc, apiKeyFindCoordinator, apiVersionFindCoordinator, e.b, 0)
+	if err != nil {
+		return "", fmt.Errorf("cannot find coordinator at %q: %w", addr, err)
+	}
+
+	d := decoder{b: resp}
+	errCode := d.int16()
+	_ = d.int32() // node_id
+	host := d.string()
+	port := d.int32()
+	if d.err != nil {
+		return "", fmt.Errorf("cannot parse find coordinator response from %q: %w", addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		return "", fmt.Errorf("cannot find coordinator at %q: %w", addr, err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// handleError drops cached metadata for the given topic if err indicates that the metadata is outdated.
+func (c *Client) handleError(topic string, err error) {
+	switch err {
+	case ErrNotLeaderForPartition, ErrLeaderNotAvailable, ErrUnknownTopicOrPartition:
+		c.mu.Lock()
+		delete(c.topics, topic)
+		c.mu.Unlock()
+	}
+}
+
+// handleCoordinatorError drops cached coordinator for the given group if err indicates that the coordinator has been changed.
+func (c *Client) handleCoordinatorError(group string, err error) {
+	switch err {
+	case ErrNotCoordinator, ErrCoordinatorNotAvailable:
+		c.mu.Lock()
+		delete(c.coordinators, group)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) getConn(addr string) *brokerConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bc := c.conns[addr]
+	if bc == nil {
+		bc = &brokerConn{
+			addr: addr,
+		}
+		c.conns[addr] = bc
+	}
+	return bc
+}
+
+// roundTrip sends the request with the given body to bc and returns the response body.
+//
+// extraTimeout is added to the request timeout. It is used for long-polling fetch requests.
+func (c *Client) roundTrip(bc *brokerConn, apiKey, apiVersion int16, body []byte, extraTimeout time.Duration) ([]byte, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.conn == nil {
+		conn, err := c.dial(bc.addr)
+		if err != nil {
+			return nil, err
+		}
+		bc.conn = conn
+		if c.opts.SASLUsername != "" {
+			if err := c.authenticateLocked(bc); err != nil {
+				_ = bc.conn.Close()
+				bc.conn = nil
+				return nil, err
+			}
+		}
+	}
+
+	resp, err := bc.roundTripLocked(c.opts.ClientID, apiKey, apiVersion, body, c.opts.RequestTimeout+extraTimeout)
+	if err != nil {
+		// The connection state is unknown after the error, so close it.
+		// It will be re-established on the next request.
+		_ = bc.conn.Close()
+		bc.conn = nil
+
+		// Drop cached metadata, since the broker may be unavailable.
+		c.mu.Lock()
+		clear(c.topics)
+		clear(c.coordinators)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// authenticateLocked authenticates the newly established connection at bc with SASL PLAIN mechanism.
+//
+// See https://kafka.apache.org/protocol.html#sasl_handshake
+func (c *Client) authenticateLocked(bc *brokerConn) error {
+	e := encoder{}
+	e.string("PLAIN")
+	resp, err := bc.roundTripLocked(c.opts.ClientID, apiKeySaslHandshake, apiVersionSaslHandshake, e.b, c.opts.RequestTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot perform SASL handshake with %q: %w", bc.addr, err)
+	}
+	d := decoder{b: resp}
+	errCode := d.int16()
+	var mechanisms []string
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		mechanisms = append(mechanisms, d.string())
+	}
+	if d.err != nil {
+		return fmt.Errorf("cannot parse SASL handshake response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		return fmt.Errorf("cannot perform SASL handshake with %q; mechanisms supported by the broker: %q: %w", bc.addr, mechanisms, err)
+	}
+
+	// See https://www.rfc-editor.org/rfc/rfc4616
+	authBytes := make([]byte, 0, 2+len(c.opts.SASLUsername)+len(c.opts.SASLPassword))
+	authBytes = append(authBytes, 0)
+	authBytes = append(authBytes, c.opts.SASLUsername...)
+	authBytes = append(authBytes, 0)
+	authBytes = append(authBytes, c.opts.SASLPassword...)
+	e = encoder{}
+	e.bytes(authBytes)
+	resp, err = bc.roundTripLocked(c.opts.ClientID, apiKeySaslAuthenticate, apiVersionSaslAuthenticate, e.b, c.opts.RequestTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot perform SASL authentication at %q: %w", bc.addr, err)
+	}
+	d = decoder{b: resp}
+	errCode = d.int16()
+	errMsg := d.string()
+	_ = d.bytes() // auth_bytes
+	if d.err != nil {
+		return fmt.Errorf("cannot parse SASL authenticate response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		return fmt.Errorf("cannot authenticate as %q at %q: %s: %w", c.opts.SASLUsername, bc.addr, errMsg, err)
+	}
+	return nil
+}
+
+func (c *Client) dial(addr string) (net.Conn, error) {
+	d := &net.Dialer{
+		Timeout: c.opts.DialTimeout,
+	}
+	network := netutil.GetTCPNetwork()
+	if c.opts.TLSConfig != nil {
+		conn, err := tls.DialWithDialer(d, network, addr, c.opts.TLSConfig)
+		if err != nil {
+			return nil, fmt.Errorf("cannot establish TLS connection to Kafka broker %q: %w", addr, err)
+		}
+		return conn, nil
+	}
+	conn, err := d.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Kafka broker %q: %w", addr, err)
+	}
+	return conn, nil
+}
+
+type brokerConn struct {
+	addr string
+
+	mu            sync.Mutex
+	conn          net.Conn
+	correlationID int32
+	buf           []byte
+}
+
+func (bc *brokerConn) close() {
+	bc.mu.Lock()
+	if bc.conn != nil {
+		_ = bc.conn.Close()
+		bc.conn = nil
+	}
+	bc.mu.Unlock()
+}
+
+func (bc *brokerConn) roundTripLocked(clientID string, apiKey, apiVersion int16, body []byte, timeout time.Duration) ([]byte, error) {
+	if err := bc.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("cannot set deadline: %w", err)
+	}
+
+	bc.correlationID++
+	e := encoder{b: bc.buf[:0]}
+	e.int32(0) // size; it is updated below
+	e.int16(apiKey)
+	e.int16(apiVersion)
+	e.int32(bc.correlationID)
+	e.string(clientID)
+	e.b = append(e.b, body...)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	bc.buf = e.b
+
+	if _, err := bc.conn.Write(e.b); err != nil {
+		return nil, fmt.Errorf("cannot send request to %q: %w", bc.addr, err)
+	}
+
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(bc.conn, sizeBuf[:]); err != nil {
+		return nil, fmt.Errorf("cannot read response size from %q: %w", bc.addr, err)
+	}
+	size := binary.BigEndian.Uint32(sizeBuf[:])
+	if size < 4 || size > maxResponseSize {
+		return nil, fmt.Errorf("unexpected response size from %q: %d bytes", bc.addr, size)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(bc.conn, resp); err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", bc.addr, err)
+	}
+	if correlationID := int32(binary.BigEndian.Uint32(resp)); correlationID != bc.correlationID {
+		return nil, fmt.Errorf("unexpected correlation id in the response from %q; got %d; want %d", bc.addr, correlationID, bc.correlationID)
+	}
+	return resp[4:], nil
+}
+
+// maxResponseSize is the maximum size of the response from Kafka broker.
+const maxResponseSize = 256 * 1024 * 1024
@@ -0,0 +1,865 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is an in-process Kafka broker stub, which supports the subset of Kafka protocol used by Client.
+type testBroker struct {
+	ln   net.Listener
+	host string
+	port int32
+
+	mu         sync.Mutex
+	partitions map[string][][]Record
+	offsets    map[string]int64
+	requests   map[int16]int
+
+	// groupMembers contains subscriptions per member id for the single consumer group supported by testBroker.
+	groupMembers     map[string][]byte
+	groupGeneration  int32
+	groupAssignments map[string][]byte
+	nextMemberID     int
+
+	// saslUsername and saslPassword are required for SASL PLAIN authentication if saslUsername is set.
+	saslUsername string
+	saslPassword string
+
+	wg sync.WaitGroup
+}
+
+func newTestBroker(t *testing.T, topics map[string]int) *testBroker {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start test broker: %s", err)
+	}
+	host, portStr, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("cannot parse listener address: %s", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("cannot parse listener port: %s", err)
+	}
+	tb := &testBroker{
+		ln:         ln,
+		host:       host,
+		port:       int32(port),
+		partitions: make(map[string][][]Record),
+		offsets:    make(map[string]int64),
+		requests:   make(map[int16]int),
+
+		groupMembers:     make(map[string][]byte),
+		groupAssignments: make(map[string][]byte),
+	}
+	for topic, n := range topics {
+		tb.partitions[topic] = make([][]Record, n)
+	}
+	tb.wg.Add(1)
+	go func() {
+		defer tb.wg.Done()
+		tb.serve()
+	}()
+	t.Cleanup(tb.stop)
+	return tb
+}
+
+func (tb *testBroker) addr() string {
+	return tb.ln.Addr().String()
+}
+
+func (tb *testBroker) stop() {
+	_ = tb.ln.Close()
+	tb.wg.Wait()
+}
+
+func (tb *testBroker) serve() {
+	for {
+		c, err := tb.ln.Accept()
+		if err != nil {
+			return
+		}
+		tb.wg.Add(1)
+		go func() {
+			defer tb.wg.Done()
+			defer c.Close()
+			tb.serveConn(c)
+		}()
+	}
+}
+
+func (tb *testBroker) serveConn(c net.Conn) {
+	authenticated := false
+	for {
+		var sizeBuf [4]byte
+		if _, err := io.ReadFull(c, sizeBuf[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+		d := decoder{b: req}
+		apiKey := d.int16()
+		_ = d.int16() // api_version
+		correlationID := d.int32()
+		_ = d.string() // client_id
+
+		e := encoder{}
+		e.int32(0) // size
+		e.int32(correlationID)
+		if !tb.handleRequest(&e, apiKey, &d, &authenticated) {
+			return
+		}
+		if d.err != nil {
+			panic(fmt.Errorf("cannot parse request with api key %d: %w", apiKey, d.err))
+		}
+		binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+		if _, err := c.Write(e.b); err != nil {
+			return
+		}
+	}
+}
+
+func (tb *testBroker) setSASLCredentials(username, password string) {
+	tb.mu.Lock()
+	tb.saslUsername = username
+	tb.saslPassword = password
+	tb.mu.Unlock()
+}
+
+// handleRequest writes the response for the request to e.
+//
+// It returns false if the connection must be closed.
+func (tb *testBroker) handleRequest(e *encoder, apiKey int16, d *decoder, authenticated *bool) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.requests[apiKey]++
+	if tb.saslUsername != "" && !*authenticated && apiKey != apiKeySaslHandshake && apiKey != apiKeySaslAuthenticate {
+		// Kafka closes connections, which send requests before the authentication.
+		return false
+	}
+	switch apiKey {
+	case apiKeySaslHandshake:
+		if mechanism := d.string(); mechanism == "PLAIN" {
+			e.int16(0)
+		} else {
+			e.int16(int16(ErrUnsupportedSASLMechanism))
+		}
+		e.arrayLen(1)
+		e.string("PLAIN")
+	case apiKeySaslAuthenticate:
+		authBytes := d.bytes()
+		if string(authBytes) == "\x00"+tb.saslUsername+"\x00"+tb.saslPassword {
+			*authenticated = true
+			e.int16(0)
+			e.nullString()
+		} else {
+			e.int16(int16(ErrSASLAuthenticationFailed))
+			e.string("invalid credentials")
+		}
+		e.bytes(nil)
+	case apiKeyMetadata:
+		e.arrayLen(1)
+		e.int32(1) // node_id
+		e.string(tb.host)
+		e.int32(tb.port)
+		e.nullString() // rack
+		e.int32(1)     // controller_id
+		n := d.arrayLen()
+		e.arrayLen(n)
+		for i := 0; i < n; i++ {
+			topic := d.string()
+			partitions, ok := tb.partitions[topic]
+			if !ok {
+				e.int16(int16(ErrUnknownTopicOrPartition))
+			} else {
+				e.int16(0)
+			}
+			e.string(topic)
+			e.int8(0) // is_internal
+			e.arrayLen(len(partitions))
+			for p := range partitions {
+				e.int16(0)
+				e.int32(int32(p))
+				e.int32(1) // leader
+				e.arrayLen(1)
+				e.int32(1) // replica_nodes
+				e.arrayLen(1)
+				e.int32(1) // isr_nodes
+			}
+		}
+	case apiKeyProduce:
+		_ = d.string() // transactional_id
+		_ = d.int16()  // acks
+		_ = d.int32()  // timeout_ms
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		data := d.bytes()
+		records, err := unmarshalRecordBatches(nil, data, 0)
+		if err != nil {
+			panic(fmt.Errorf("cannot unmarshal produced records: %w", err))
+		}
+		baseOffset := int64(len(tb.partitions[topic][partition]))
+		for i := range records {
+			r := records[i]
+			r.Offset = baseOffset + int64(i)
+			r.Key = cloneBytes(r.Key)
+			r.Value = cloneBytes(r.Value)
+			tb.partitions[topic][partition] = append(tb.partitions[topic][partition], r)
+		}
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int16(0)
+		e.int64(baseOffset)
+		e.int64(-1)
+		e.int32(0) // throttle_time_ms
+	case apiKeyFetch:
+		_ = d.int32() // replica_id
+		_ = d.int32() // max_wait_ms
+		_ = d.int32() // min_bytes
+		_ = d.int32() // max_bytes
+		_ = d.int8()  // isolation_level
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		offset := d.int64()
+		_ = d.int32() // partition_max_bytes
+
+		e.int32(0) // throttle_time_ms
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		records := tb.partitions[topic][partition]
+		if offset > int64(len(records)) {
+			e.int16(int16(ErrOffsetOutOfRange))
+		} else {
+			e.int16(0)
+		}
+		e.int64(int64(len(records))) // high_watermark
+		e.int64(int64(len(records))) // last_stable_offset
+		e.arrayLen(0)                // aborted_transactions
+		var data []byte
+		if offset < int64(len(records)) {
+			// Return all the records in a single batch starting from the zero offset like Kafka does
+			// when the requested offset is in the middle of the batch.
+			data = marshalRecordBatch(nil, records)
+			// Append truncated batch like Kafka does when the response exceeds max_bytes.
+			data = append(data, marshalRecordBatch(nil, records[:1])[:20]...)
+		}
+		e.bytes(data)
+	case apiKeyListOffsets:
+		_ = d.int32() // replica_id
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		timestamp := d.int64()
+		offset := int64(0)
+		if timestamp == OffsetLatest {
+			offset = int64(len(tb.partitions[topic][partition]))
+		}
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int16(0)
+		e.int64(-1)
+		e.int64(offset)
+	case apiKeyFindCoordinator:
+		_ = d.string() // key
+		e.int16(0)
+		e.int32(1)
+		e.string(tb.host)
+		e.int32(tb.port)
+	case apiKeyOffsetCommit:
+		group := d.string()
+		generation := d.int32()
+		memberID := d.string()
+		_ = d.int64() // retention_time_ms
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		offset := d.int64()
+		_ = d.string() // committed_metadata
+		errCode := ErrNone
+		if generation >= 0 {
+			errCode = tb.checkGroupMember(generation, memberID)
+		}
+		if errCode == ErrNone {
+			tb.offsets[fmt.Sprintf("%s/%s/%d", group, topic, partition)] = offset
+		}
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int16(int16(errCode))
+	case apiKeyJoinGroup:
+		_ = d.string() // group_id
+		_ = d.int32()  // session_timeout_ms
+		_ = d.int32()  // rebalance_timeout_ms
+		memberID := d.string()
+		_ = d.string() // protocol_type
+		_ = d.arrayLen()
+		_ = d.string() // protocol_name
+		metadata := d.bytes()
+		if memberID == "" {
+			tb.nextMemberID++
+			memberID = fmt.Sprintf("member-%d", tb.nextMemberID)
+		}
+		tb.groupMembers[memberID] = cloneBytes(metadata)
+		tb.groupGeneration++
+		clear(tb.groupAssignments)
+		memberIDs := make([]string, 0, len(tb.groupMembers))
+		for id := range tb.groupMembers {
+			memberIDs = append(memberIDs, id)
+		}
+		sort.Strings(memberIDs)
+		leader := memberIDs[0]
+		e.int32(0) // throttle_time_ms
+		e.int16(0)
+		e.int32(tb.groupGeneration)
+		e.string(rangeAssignorName)
+		e.string(leader)
+		e.string(memberID)
+		if memberID != leader {
+			memberIDs = nil
+		}
+		e.arrayLen(len(memberIDs))
+		for _, id := range memberIDs {
+			e.string(id)
+			e.bytes(tb.groupMembers[id])
+		}
+	case apiKeySyncGroup:
+		_ = d.string() // group_id
+		generation := d.int32()
+		memberID := d.string()
+		for i, n := 0, d.arrayLen(); i < n; i++ {
+			id := d.string()
+			tb.groupAssignments[id] = cloneBytes(d.bytes())
+		}
+		e.int32(0) // throttle_time_ms
+		e.int16(int16(tb.checkGroupMember(generation, memberID)))
+		e.bytes(tb.groupAssignments[memberID])
+	case apiKeyHeartbeat:
+		_ = d.string() // group_id
+		generation := d.int32()
+		memberID := d.string()
+		e.int32(0) // throttle_time_ms
+		e.int16(int16(tb.checkGroupMember(generation, memberID)))
+	case apiKeyLeaveGroup:
+		_ = d.string() // group_id
+		memberID := d.string()
+		delete(tb.groupMembers, memberID)
+		e.int32(0) // throttle_time_ms
+		e.int16(0)
+	case apiKeyOffsetFetch:
+		group := d.string()
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		offset, ok := tb.offsets[fmt.Sprintf("%s/%s/%d", group, topic, partition)]
+		if !ok {
+			offset = -1
+		}
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int64(offset)
+		e.nullString()
+		e.int16(0)
+	default:
+		panic(fmt.Errorf("unsupported api key: %d", apiKey))
+	}
+	return true
+}
+
+// checkGroupMember returns an error code for the request from the given group member at the given generation.
+func (tb *testBroker) checkGroupMember(generation int32, memberID string) Error {
+	if _, ok := tb.groupMembers[memberID]; !ok {
+		return ErrUnknownMemberID
+	}
+	if generation != tb.groupGeneration {
+		return ErrIllegalGeneration
+	}
+	if _, ok := tb.groupAssignments[memberID]; !ok {
+		// The group leader hasn't sent assignments for the member yet, so the member must re-join the group.
+		return ErrRebalanceInProgress
+	}
+	return ErrNone
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func TestClientProduceFetch(t *testing.T) {
+	tb := newTestBroker(t, map[string]int{
+		"metrics": 3,
+	})
+	c := NewClient([]string{tb.addr()}, &ClientOptions{
+		RequestTimeout: 5 * time.Second,
+	})
+	defer c.Close()
+
+	partitions, err := c.Partitions("metrics")
+	if err != nil {
+		t.Fatalf("cannot obtain partitions: %s", err)
+	}
+	if !reflect.DeepEqual(partitions, []int32{0, 1, 2}) {
+		t.Fatalf("unexpected partitions; got %v; want [0 1 2]", partitions)
+	}
+
+	if _, err := c.Partitions("missing"); err == nil {
+		t.Fatalf("expecting non-nil error for missing topic")
+	}
+
+	f := func(partition int32, values []string, baseOffsetExpected int64) {
+		t.Helper()
+		records := make([]Record, len(values))
+		for i, v := range values {
+			records[i] = Record{
+				Timestamp: 1000 + int64(i),
+				Value:     []byte(v),
+			}
+		}
+		baseOffset, err := c.Produce("metrics", partition, records)
+		if err != nil {
+			t.Fatalf("cannot produce records: %s", err)
+		}
+		if baseOffset != baseOffsetExpected {
+			t.Fatalf("unexpected base offset; got %d; want %d", baseOffset, baseOffsetExpected)
+		}
+	}
+	f(1, []string{"foo", "bar"}, 0)
+	f(1, []string{"baz"}, 2)
+	f(2, []string{"qwe"}, 0)
+
+	// Records with offsets smaller than the requested offset must be skipped.
+	records, err := c.Fetch("metrics", 1, 1, 100*time.Millisecond, 1024*1024)
+	if err != nil {
+		t.Fatalf("cannot fetch records: %s", err)
+	}
+	recordsExpected := []Record{
+		{Offset: 1, Timestamp: 1001, Value: []byte("bar")},
+		{Offset: 2, Timestamp: 1000, Value: []byte("baz")},
+	}
+	if !reflect.DeepEqual(records, recordsExpected) {
+		t.Fatalf("unexpected records\ngot\n%+v\nwant\n%+v", records, recordsExpected)
+	}
+
+	// Fetch from empty partition
+	records, err = c.Fetch("metrics", 0, 0, 100*time.Millisecond, 1024*1024)
+	if err != nil {
+		t.Fatalf("cannot fetch records: %s", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("unexpected records fetched from empty partition: %+v", records)
+	}
+
+	// Fetch with out of range offset
+	if _, err := c.Fetch("metrics", 2, 10, 100*time.Millisecond, 1024*1024); err == nil {
+		t.Fatalf("expecting non-nil error for out of range offset")
+	}
+
+	offset, err := c.ListOffset("metrics", 1, OffsetLatest)
+	if err != nil {
+		t.Fatalf("cannot list offsets: %s", err)
+	}
+	if offset != 3 {
+		t.Fatalf("unexpected latest offset; got %d; want 3", offset)
+	}
+}
+
+func TestClientCommitOffset(t *testing.T) {
+	tb := newTestBroker(t, map[string]int{
+		"metrics": 1,
+	})
+	c := NewClient([]string{tb.addr()}, nil)
+	defer c.Close()
+
+	offset, err := c.FetchCommittedOffset("group", "metrics", 0)
+	if err != nil {
+		t.Fatalf("cannot fetch committed offset: %s", err)
+	}
+	if offset != -1 {
+		t.Fatalf("unexpected committed offset; got %d; want -1", offset)
+	}
+
+	gg := &GroupGeneration{
+		Group:        "group",
+		GenerationID: -1,
+	}
+	if err := c.CommitOffset(gg, "metrics", 0, 42); err != nil {
+		t.Fatalf("cannot commit offset: %s", err)
+	}
+	offset, err = c.FetchCommittedOffset("group", "metrics", 0)
+	if err != nil {
+		t.Fatalf("cannot fetch committed offset: %s", err)
+	}
+	if offset != 42 {
+		t.Fatalf("unexpected committed offset; got %d; want 42", offset)
+	}
+
+	// The coordinator must be cached
+	tb.mu.Lock()
+	n := tb.requests[apiKeyFindCoordinator]
+	tb.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("unexpected number of find coordinator requests; got %d; want 1", n)
+	}
+}
+
+func TestClientConsumerGroup(t *testing.T) {
+	tb := newTestBroker(t, map[string]int{
+		"metrics": 3,
+	})
+	c := NewClient([]string{tb.addr()}, nil)
+	defer c.Close()
+
+	join := func(memberID string) *GroupGeneration {
+		t.Helper()
+		gg, err := c.JoinGroup("group", memberID, []string{"metrics"}, 30*time.Second, time.Minute)
+		if err != nil {
+			t.Fatalf("cannot join group: %s", err)
+		}
+		return gg
+	}
+	syncGroup := func(gg *GroupGeneration, partitionsExpected []int32) {
+		t.Helper()
+		var assignments map[string]map[string][]int32
+		if gg.IsLeader() {
+			partitions, err := c.Partitions("metrics")
+			if err != nil {
+				t.Fatalf("cannot obtain partitions: %s", err)
+			}
+			assignments = AssignPartitions(gg.Members, map[string][]int32{
+				"metrics": partitions,
+			})
+		}
+		assignment, err := c.SyncGroup(gg, assignments)
+		if err != nil {
+			t.Fatalf("cannot sync group: %s", err)
+		}
+		if !reflect.DeepEqual(assignment["metrics"], partitionsExpected) {
+			t.Fatalf("unexpected assigned partitions; got %v; want %v", assignment["metrics"], partitionsExpected)
+		}
+	}
+
+	// The first member becomes the leader and obtains all the partitions.
+	gg1 := join("")
+	if !gg1.IsLeader() {
+		t.Fatalf("the first member must be the group leader")
+	}
+	membersExpected := []GroupMember{{ID: gg1.MemberID, Topics: []string{"metrics"}}}
+	if !reflect.DeepEqual(gg1.Members, membersExpected) {
+		t.Fatalf("unexpected group members\ngot\n%+v\nwant\n%+v", gg1.Members, membersExpected)
+	}
+	syncGroup(gg1, []int32{0, 1, 2})
+	if err := c.Heartbeat(gg1); err != nil {
+		t.Fatalf("unexpected heartbeat error: %s", err)
+	}
+	if err := c.CommitOffset(gg1, "metrics", 1, 10); err != nil {
+		t.Fatalf("cannot commit offset: %s", err)
+	}
+
+	// The second member joins the group. The first member must detect the rebalance via heartbeat.
+	gg2 := join("")
+	if gg2.IsLeader() {
+		t.Fatalf("the second member mustn't be the group leader")
+	}
+	if err := c.Heartbeat(gg1); !errors.Is(err, ErrIllegalGeneration) {
+		t.Fatalf("unexpected heartbeat error; got %v; want %s", err, ErrIllegalGeneration)
+	}
+	// The offset commit from the outdated generation must be rejected.
+	if err := c.CommitOffset(gg1, "metrics", 1, 20); !errors.Is(err, ErrIllegalGeneration) {
+		t.Fatalf("unexpected commit error; got %v; want %s", err, ErrIllegalGeneration)
+	}
+
+	// The partitions must be split among members after the first member re-joins the group.
+	// The stub coordinator doesn't block JoinGroup until all the members re-join, so propagate the new generation manually.
+	gg1 = join(gg1.MemberID)
+	gg2.GenerationID = gg1.GenerationID
+	syncGroup(gg1, []int32{0, 1})
+	syncGroup(gg2, []int32{2})
+	if err := c.Heartbeat(gg2); err != nil {
+		t.Fatalf("unexpected heartbeat error: %s", err)
+	}
+
+	// The left member mustn't be able to send heartbeats.
+	if err := c.LeaveGroup(gg2); err != nil {
+		t.Fatalf("cannot leave group: %s", err)
+	}
+	if err := c.Heartbeat(gg2); !errors.Is(err, ErrUnknownMemberID) {
+		t.Fatalf("unexpected heartbeat error; got %v; want %s", err, ErrUnknownMemberID)
+	}
+
+	offset, err := c.FetchCommittedOffset("group", "metrics", 1)
+	if err != nil {
+		t.Fatalf("cannot fetch committed offset: %s", err)
+	}
+	if offset != 10 {
+		t.Fatalf("unexpected committed offset; got %d; want 10", offset)
+	}
+}
+
+func TestAssignPartitions(t *testing.T) {
+	f := func(members []GroupMember, partitions map[string][]int32, assignmentsExpected map[string]map[string][]int32) {
+		t.Helper()
+		assignments := AssignPartitions(members, partitions)
+		if !reflect.DeepEqual(assignments, assignmentsExpected) {
+			t.Fatalf("unexpected assignments\ngot\n%v\nwant\n%v", assignments, assignmentsExpected)
+		}
+	}
+
+	// single member
+	f([]GroupMember{{ID: "a", Topics: []string{"foo"}}}, map[string][]int32{
+		"foo": {2, 0, 1},
+	}, map[string]map[string][]int32{
+		"a": {"foo": {0, 1, 2}},
+	})
+
+	// partitions are split into ranges
+	f([]GroupMember{
+		{ID: "b", Topics: []string{"foo"}},
+		{ID: "a", Topics: []string{"foo"}},
+		{ID: "c", Topics: []string{"foo"}},
+	}, map[string][]int32{
+		"foo": {0, 1, 2, 3, 4},
+	}, map[string]map[string][]int32{
+		"a": {"foo": {0, 1}},
+		"b": {"foo": {2, 3}},
+		"c": {"foo": {4}},
+	})
+
+	// more members than partitions
+	f([]GroupMember{
+		{ID: "a", Topics: []string{"foo"}},
+		{ID: "b", Topics: []string{"foo"}},
+	}, map[string][]int32{
+		"foo": {0},
+	}, map[string]map[string][]int32{
+		"a": {"foo": {0}},
+		"b": {},
+	})
+
+	// members subscribed to distinct topics
+	f([]GroupMember{
+		{ID: "a", Topics: []string{"foo"}},
+		{ID: "b", Topics: []string{"foo", "bar"}},
+		{ID: "c", Topics: []string{"bar"}},
+	}, map[string][]int32{
+		"foo": {0, 1},
+		"bar": {0, 1, 2},
+	}, map[string]map[string][]int32{
+		"a": {"foo": {0}},
+		"b": {"foo": {1}, "bar": {0, 1}},
+		"c": {"bar": {2}},
+	})
+}
+
+func TestAssignmentMarshalUnmarshal(t *testing.T) {
+	assignment := map[string][]int32{
+		"foo": {0, 3},
+		"bar": {1},
+	}
+	result, err := unmarshalAssignment(marshalAssignment(assignment))
+	if err != nil {
+		t.Fatalf("cannot unmarshal assignment: %s", err)
+	}
+	if !reflect.DeepEqual(result, assignment) {
+		t.Fatalf("unexpected assignment\ngot\n%v\nwant\n%v", result, assignment)
+	}
+
+	topics, err := unmarshalSubscription(marshalSubscription([]string{"foo", "bar"}))
+	if err != nil {
+		t.Fatalf("cannot unmarshal subscription: %s", err)
+	}
+	if !reflect.DeepEqual(topics, []string{"foo", "bar"}) {
+		t.Fatalf("unexpected topics; got %q; want [foo bar]", topics)
+	}
+
+	// Corrupted data must be detected
+	if _, err := unmarshalAssignment([]byte{0, 0, 0, 0, 0, 1}); err == nil {
+		t.Fatalf("expecting non-nil error for corrupted assignment")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	tb := newTestBroker(t, map[string]int{
+		"metrics": 1,
+	})
+	c := NewClient([]string{tb.addr()}, nil)
+	defer c.Close()
+
+	if _, err := c.Produce("metrics", 0, []Record{{Value: []byte("foo")}}); err != nil {
+		t.Fatalf("cannot produce records: %s", err)
+	}
+
+	// Close all the connections at client side. The client must re-establish them on the next request.
+	c.mu.Lock()
+	for _, bc := range c.conns {
+		bc.close()
+	}
+	c.mu.Unlock()
+
+	if _, err := c.Produce("metrics", 0, []Record{{Value: []byte("bar")}}); err != nil {
+		t.Fatalf("cannot produce records after reconnect: %s", err)
+	}
+	records, err := c.Fetch("metrics", 0, 0, 100*time.Millisecond, 1024*1024)
+	if err != nil {
+		t.Fatalf("cannot fetch records: %s", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("unexpected number of records; got %d; want 2", len(records))
+	}
+}
+
+func TestClientSASLAuthentication(t *testing.T) {
+	tb := newTestBroker(t, map[string]int{
+		"metrics": 1,
+	})
+	tb.setSASLCredentials("user", "secret")
+
+	f := func(username, password string, errExpected error) {
+		t.Helper()
+
+		c := NewClient([]string{tb.addr()}, &ClientOptions{
+			SASLUsername:   username,
+			SASLPassword:   password,
+			RequestTimeout: 5 * time.Second,
+		})
+		defer c.Close()
+
+		_, err := c.Produce("metrics", 0, []Record{{Value: []byte("foo")}})
+		if errExpected == nil {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if errExpected != errAny && !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected error; got %s; want %s", err, errExpected)
+		}
+	}
+
+	// valid credentials
+	f("user", "secret", nil)
+
+	// invalid credentials
+	f("user", "invalid", ErrSASLAuthenticationFailed)
+	f("foo", "secret", ErrSASLAuthenticationFailed)
+
+	// missing authentication
+	f("", "", errAny)
+}
+
+var errAny = errors.New("any error")
+
+func TestClientOptionsInitSecurity(t *testing.T) {
+	tlsCfg := &tls.Config{
+		ServerName: "kafka",
+	}
+	getTLSConfig := func() (*tls.Config, error) {
+		return tlsCfg, nil
+	}
+
+	f := func(securityProtocol, username string, tlsExpected, saslExpected bool) {
+		t.Helper()
+
+		var opts ClientOptions
+		if err := opts.InitSecurity(securityProtocol, getTLSConfig, username, "secret"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if (opts.TLSConfig == tlsCfg) != tlsExpected {
+			t.Fatalf("unexpected TLS config; got %v; want TLS=%v", opts.TLSConfig, tlsExpected)
+		}
+		if (opts.SASLUsername != "") != saslExpected {
+			t.Fatalf("unexpected SASL username; got %q; want SASL=%v", opts.SASLUsername, saslExpected)
+		}
+		if saslExpected && opts.SASLPassword != "secret" {
+			t.Fatalf("unexpected SASL password; got %q; want %q", opts.SASLPassword, "secret")
+		}
+	}
+
+	f("", "", false, false)
+	f("PLAINTEXT", "user", false, false)
+	f("SSL", "user", true, false)
+	f("SASL_PLAINTEXT", "user", false, true)
+	f("SASL_SSL", "user", true, true)
+
+	fError := func(securityProtocol, username string) {
+		t.Helper()
+
+		var opts ClientOptions
+		if err := opts.InitSecurity(securityProtocol, getTLSConfig, username, ""); err == nil {
+			t.Fatalf("expecting non-nil error for security protocol %q", securityProtocol)
+		}
+	}
+
+	// unsupported protocol
+	fError("ssl", "")
+	fError("SASL", "user")
+
+	// missing SASL username
+	fError("SASL_PLAINTEXT", "")
+	fError("SASL_SSL", "")
+}
+
+func TestRecordBatchMarshalUnmarshal(t *testing.T) {
+	records := []Record{
+		{Timestamp: 123, Key: []byte("key"), Value: []byte("value")},
+		{Timestamp: 100, Value: []byte{}},
+		{Timestamp: 200},
+	}
+	data := marshalRecordBatch(nil, records)
+	binary.BigEndian.PutUint64(data, 10) // baseOffset
+
+	result, err := unmarshalRecordBatches(nil, data, 0)
+	if err != nil {
+		t.Fatalf("cannot unmarshal record batch: %s", err)
+	}
+	resultExpected := []Record{
+		{Offset: 10, Timestamp: 123, Key: []byte("key"), Value: []byte("value")},
+		{Offset: 11, Timestamp: 100, Value: []byte{}},
+		{Offset: 12, Timestamp: 200},
+	}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected records\ngot\n%+v\nwant\n%+v", result, resultExpected)
+	}
+
+	// Corrupted batch must be detected
+	data[len(data)-1]++
+	if _, err := unmarshalRecordBatches(nil, data, 0); err == nil {
+		t.Fatalf("expecting non-nil error for corrupted record batch")
+	}
+}
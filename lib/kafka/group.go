@@ -0,0 +1,336 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// consumerProtocolType is the protocol type used by Kafka consumers. It allows inspecting the group with standard Kafka tools.
+const consumerProtocolType = "consumer"
+
+// rangeAssignorName is the name of the partition assignment strategy implemented by AssignPartitions.
+const rangeAssignorName = "range"
+
+// GroupMember is a member of consumer group returned by Client.JoinGroup.
+type GroupMember struct {
+	// ID is the member id assigned by the group coordinator.
+	ID string
+
+	// Topics contains topics the member is subscribed to.
+	Topics []string
+}
+
+// GroupGeneration is the state of consumer group membership obtained via Client.JoinGroup.
+type GroupGeneration struct {
+	// Group is the consumer group id.
+	Group string
+
+	// GenerationID is the generation of the group. It is incremented by the group coordinator on every rebalance.
+	//
+	// GenerationID is set to -1 for committing offsets without group membership.
+	GenerationID int32
+
+	// MemberID is the id assigned to the member by the group coordinator.
+	MemberID string
+
+	// LeaderID is the id of the group leader, which assigns partitions to group members.
+	LeaderID string
+
+	// Members contains all the group members. It is set only for the group leader.
+	Members []GroupMember
+}
+
+// IsLeader returns true if the member is the group leader.
+//
+// The leader must assign partitions to group members via AssignPartitions and pass the assignments to Client.SyncGroup.
+func (gg *GroupGeneration) IsLeader() bool {
+	return gg.MemberID == gg.LeaderID
+}
+
+// JoinGroup joins the consumer group with the given memberID subscribed to the given topics.
+//
+// memberID must be empty on the first join. The member id assigned by the group coordinator is returned in GroupGeneration.MemberID.
+// It must be passed to subsequent JoinGroup calls until the coordinator responds with ErrUnknownMemberID.
+//
+// The call blocks until all the group members re-join the group, but for no longer than rebalanceTimeout.
+// The member is removed from the group if it doesn't send heartbeats during sessionTimeout.
+//
+// Client.SyncGroup must be called after JoinGroup in order to obtain partitions assigned to the member.
+func (c *Client) JoinGroup(group, memberID string, topics []string, sessionTimeout, rebalanceTimeout time.Duration) (*GroupGeneration, error) {
+	bc, err := c.getCoordinatorConn(group)
+	if err != nil {
+		return nil, err
+	}
+
+	e := encoder{}
+	e.string(group)
+	e.int32(int32(sessionTimeout.Milliseconds()))
+	e.int32(int32(rebalanceTimeout.Milliseconds()))
+	e.string(memberID)
+	e.string(consumerProtocolType)
+	e.arrayLen(1)
+	e.string(rangeAssignorName)
+	e.bytes(marshalSubscription(topics))
+
+	resp, err := c.roundTrip(bc, apiKeyJoinGroup, apiVersionJoinGroup, e.b, rebalanceTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot join group %q at %q: %w", group, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	_ = d.int32() // throttle_time_ms
+	errCode := d.int16()
+	gg := &GroupGeneration{
+		Group: group,
+	}
+	gg.GenerationID = d.int32()
+	_ = d.string() // protocol_name
+	gg.LeaderID = d.string()
+	gg.MemberID = d.string()
+	var members []GroupMember
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.string()
+		metadata := d.bytes()
+		if d.err != nil {
+			break
+		}
+		topics, err := unmarshalSubscription(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse subscription for member %q of group %q: %w", id, group, err)
+		}
+		members = append(members, GroupMember{
+			ID:     id,
+			Topics: topics,
+		})
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("cannot parse join group response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleCoordinatorError(group, err)
+		return nil, fmt.Errorf("cannot join group %q at %q: %w", group, bc.addr, err)
+	}
+	gg.Members = members
+	return gg, nil
+}
+
+// SyncGroup completes joining the group and returns partitions per topic assigned to the member.
+//
+// The group leader must pass assignments per member id obtained via AssignPartitions, while the rest of members must pass nil.
+func (c *Client) SyncGroup(gg *GroupGeneration, assignments map[string]map[string][]int32) (map[string][]int32, error) {
+	bc, err := c.getCoordinatorConn(gg.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs := make([]string, 0, len(assignments))
+	for memberID := range assignments {
+		memberIDs = append(memberIDs, memberID)
+	}
+	sort.Strings(memberIDs)
+
+	e := encoder{}
+	e.string(gg.Group)
+	e.int32(gg.GenerationID)
+	e.string(gg.MemberID)
+	e.arrayLen(len(memberIDs))
+	for _, memberID := range memberIDs {
+		e.string(memberID)
+		e.bytes(marshalAssignment(assignments[memberID]))
+	}
+
+	// Members wait at the coordinator until the leader sends the assignments, so give them additional time.
+	resp, err := c.roundTrip(bc, apiKeySyncGroup, apiVersionSyncGroup, e.b, c.opts.RequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sync group %q at %q: %w", gg.Group, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	_ = d.int32() // throttle_time_ms
+	errCode := d.int16()
+	data := d.bytes()
+	if d.err != nil {
+		return nil, fmt.Errorf("cannot parse sync group response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleCoordinatorError(gg.Group, err)
+		return nil, fmt.Errorf("cannot sync group %q at %q: %w", gg.Group, bc.addr, err)
+	}
+	assignment, err := unmarshalAssignment(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse partitions assigned to member %q of group %q: %w", gg.MemberID, gg.Group, err)
+	}
+	return assignment, nil
+}
+
+// Heartbeat notifies the group coordinator that the member is alive.
+//
+// It returns ErrRebalanceInProgress if the member must re-join the group via JoinGroup.
+func (c *Client) Heartbeat(gg *GroupGeneration) error {
+	bc, err := c.getCoordinatorConn(gg.Group)
+	if err != nil {
+		return err
+	}
+
+	e := encoder{}
+	e.string(gg.Group)
+	e.int32(gg.GenerationID)
+	e.string(gg.MemberID)
+
+	resp, err := c.roundTrip(bc, apiKeyHeartbeat, apiVersionHeartbeat, e.b, 0)
+	if err != nil {
+		return fmt.Errorf("cannot send heartbeat for group %q at %q: %w", gg.Group, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	_ = d.int32() // throttle_time_ms
+	errCode := d.int16()
+	if d.err != nil {
+		return fmt.Errorf("cannot parse heartbeat response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleCoordinatorError(gg.Group, err)
+		return fmt.Errorf("cannot send heartbeat for group %q at %q: %w", gg.Group, bc.addr, err)
+	}
+	return nil
+}
+
+// LeaveGroup removes the member from the group, so its partitions are re-assigned to the rest of members without waiting for session timeout.
+func (c *Client) LeaveGroup(gg *GroupGeneration) error {
+	bc, err := c.getCoordinatorConn(gg.Group)
+	if err != nil {
+		return err
+	}
+
+	e := encoder{}
+	e.string(gg.Group)
+	e.string(gg.MemberID)
+
+	resp, err := c.roundTrip(bc, apiKeyLeaveGroup, apiVersionLeaveGroup, e.b, 0)
+	if err != nil {
+		return fmt.Errorf("cannot leave group %q at %q: %w", gg.Group, bc.addr, err)
+	}
+
+	d := decoder{b: resp}
+	_ = d.int32() // throttle_time_ms
+	errCode := d.int16()
+	if d.err != nil {
+		return fmt.Errorf("cannot parse leave group response from %q: %w", bc.addr, d.err)
+	}
+	if err := errorFromCode(errCode); err != nil {
+		c.handleCoordinatorError(gg.Group, err)
+		return fmt.Errorf("cannot leave group %q at %q: %w", gg.Group, bc.addr, err)
+	}
+	return nil
+}
+
+// AssignPartitions assigns the given partitions per topic to the given group members.
+//
+// Partitions of every topic are split into contiguous ranges among the members subscribed to the topic in the same way
+// as the range assignor of Kafka consumers does. The returned assignments contain partitions per topic per member id.
+func AssignPartitions(members []GroupMember, partitions map[string][]int32) map[string]map[string][]int32 {
+	assignments := make(map[string]map[string][]int32, len(members))
+	topicMembers := make(map[string][]string)
+	for _, m := range members {
+		assignments[m.ID] = make(map[string][]int32)
+		for _, topic := range m.Topics {
+			topicMembers[topic] = append(topicMembers[topic], m.ID)
+		}
+	}
+	for topic, memberIDs := range topicMembers {
+		sort.Strings(memberIDs)
+		ps := append([]int32{}, partitions[topic]...)
+		sort.Slice(ps, func(i, j int) bool {
+			return ps[i] < ps[j]
+		})
+		perMember := len(ps) / len(memberIDs)
+		extra := len(ps) % len(memberIDs)
+		for i, memberID := range memberIDs {
+			n := perMember
+			if i < extra {
+				n++
+			}
+			if n > 0 {
+				assignments[memberID][topic] = ps[:n:n]
+			}
+			ps = ps[n:]
+		}
+	}
+	return assignments
+}
+
+// marshalSubscription marshals ConsumerProtocolSubscription v0 for the given topics.
+//
+// See https://github.com/apache/kafka/blob/trunk/clients/src/main/resources/common/message/ConsumerProtocolSubscription.json
+func marshalSubscription(topics []string) []byte {
+	e := encoder{}
+	e.int16(0) // version
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic)
+	}
+	e.bytes(nil) // user_data
+	return e.b
+}
+
+func unmarshalSubscription(data []byte) ([]string, error) {
+	d := decoder{b: data}
+	_ = d.int16() // version
+	var topics []string
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topics = append(topics, d.string())
+	}
+	// The rest of fields are ignored, since they aren't used by the range assignor.
+	if d.err != nil {
+		return nil, d.err
+	}
+	return topics, nil
+}
+
+// marshalAssignment marshals ConsumerProtocolAssignment v0 for the given partitions per topic.
+//
+// See https://github.com/apache/kafka/blob/trunk/clients/src/main/resources/common/message/ConsumerProtocolAssignment.json
+func marshalAssignment(assignment map[string][]int32) []byte {
+	topics := make([]string, 0, len(assignment))
+	for topic := range assignment {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	e := encoder{}
+	e.int16(0) // version
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic)
+		partitions := assignment[topic]
+		e.arrayLen(len(partitions))
+		for _, partition := range partitions {
+			e.int32(partition)
+		}
+	}
+	e.bytes(nil) // user_data
+	return e.b
+}
+
+func unmarshalAssignment(data []byte) (map[string][]int32, error) {
+	assignment := make(map[string][]int32)
+	if len(data) == 0 {
+		// The member has no assigned partitions.
+		return assignment, nil
+	}
+	d := decoder{b: data}
+	_ = d.int16() // version
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topic := d.string()
+		var partitions []int32
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			partitions = append(partitions, d.int32())
+		}
+		assignment[topic] = partitions
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return assignment, nil
+}
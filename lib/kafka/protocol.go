@@ -0,0 +1,290 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Kafka API keys used by the client.
+//
+// See https://kafka.apache.org/protocol.html#protocol_api_keys
+const (
+	apiKeyProduce          = 0
+	apiKeyFetch            = 1
+	apiKeyListOffsets      = 2
+	apiKeyMetadata         = 3
+	apiKeyOffsetCommit     = 8
+	apiKeyOffsetFetch      = 9
+	apiKeyFindCoordinator  = 10
+	apiKeyJoinGroup        = 11
+	apiKeyHeartbeat        = 12
+	apiKeyLeaveGroup       = 13
+	apiKeySyncGroup        = 14
+	apiKeySaslHandshake    = 17
+	apiKeySaslAuthenticate = 36
+)
+
+// Kafka API versions used by the client.
+//
+// The oldest versions, which are still supported by Kafka 4.x and which do not use flexible encoding, are used
+// in order to keep the protocol implementation simple.
+const (
+	apiVersionProduce          = 3
+	apiVersionFetch            = 4
+	apiVersionListOffsets      = 1
+	apiVersionMetadata         = 1
+	apiVersionOffsetCommit     = 2
+	apiVersionOffsetFetch      = 1
+	apiVersionFindCoordinator  = 0
+	apiVersionJoinGroup        = 2
+	apiVersionHeartbeat        = 1
+	apiVersionLeaveGroup       = 1
+	apiVersionSyncGroup        = 1
+	apiVersionSaslHandshake    = 1
+	apiVersionSaslAuthenticate = 0
+)
+
+// Error is an error code returned by Kafka broker.
+//
+// See https://kafka.apache.org/protocol.html#protocol_error_codes
+type Error int16
+
+// Kafka error codes handled by the client.
+const (
+	ErrNone                      Error = 0
+	ErrOffsetOutOfRange          Error = 1
+	ErrUnknownTopicOrPartition   Error = 3
+	ErrLeaderNotAvailable        Error = 5
+	ErrNotLeaderForPartition     Error = 6
+	ErrRequestTimedOut           Error = 7
+	ErrCoordinatorLoadInProgress Error = 14
+	ErrCoordinatorNotAvailable   Error = 15
+	ErrNotCoordinator            Error = 16
+	ErrIllegalGeneration         Error = 22
+	ErrUnknownMemberID           Error = 25
+	ErrRebalanceInProgress       Error = 27
+	ErrUnsupportedSASLMechanism  Error = 33
+	ErrIllegalSASLState          Error = 34
+	ErrSASLAuthenticationFailed  Error = 58
+)
+
+// Error implements error interface.
+func (e Error) Error() string {
+	switch e {
+	case ErrOffsetOutOfRange:
+		return "kafka: offset out of range"
+	case ErrUnknownTopicOrPartition:
+		return "kafka: unknown topic or partition"
+	case ErrLeaderNotAvailable:
+		return "kafka: leader not available"
+	case ErrNotLeaderForPartition:
+		return "kafka: not leader for partition"
+	case ErrRequestTimedOut:
+		return "kafka: request timed out"
+	case ErrCoordinatorLoadInProgress:
+		return "kafka: coordinator load in progress"
+	case ErrCoordinatorNotAvailable:
+		return "kafka: coordinator not available"
+	case ErrNotCoordinator:
+		return "kafka: not coordinator"
+	case ErrIllegalGeneration:
+		return "kafka: illegal generation"
+	case ErrUnknownMemberID:
+		return "kafka: unknown member id"
+	case ErrRebalanceInProgress:
+		return "kafka: rebalance in progress"
+	case ErrUnsupportedSASLMechanism:
+		return "kafka: unsupported SASL mechanism"
+	case ErrIllegalSASLState:
+		return "kafka: illegal SASL state"
+	case ErrSASLAuthenticationFailed:
+		return "kafka: SASL authentication failed"
+	default:
+		return fmt.Sprintf("kafka: error code %d", int16(e))
+	}
+}
+
+func errorFromCode(code int16) error {
+	if code == 0 {
+		return nil
+	}
+	return Error(code)
+}
+
+// encoder appends Kafka protocol primitives to b.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) arrayLen(n int) {
+	e.int32(int32(n))
+}
+
+// decoder reads Kafka protocol primitives from b.
+//
+// The first error is stored in err, while the subsequent reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) need(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = fmt.Errorf("unexpected end of data; need %d bytes; got %d bytes", n, len(d.b))
+		return false
+	}
+	return true
+}
+
+func (d *decoder) int8() int8 {
+	if !d.need(1) {
+		return 0
+	}
+	v := int8(d.b[0])
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) bool() bool {
+	return d.int8() != 0
+}
+
+func (d *decoder) int16() int16 {
+	if !d.need(2) {
+		return 0
+	}
+	v := int16(binary.BigEndian.Uint16(d.b))
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) int32() int32 {
+	if !d.need(4) {
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(d.b))
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	if !d.need(8) {
+		return 0
+	}
+	v := int64(binary.BigEndian.Uint64(d.b))
+	d.b = d.b[8:]
+	return v
+}
+
+// string returns a string, which refers to d.b.
+func (d *decoder) string() string {
+	n := int(d.int16())
+	if n < 0 {
+		return ""
+	}
+	if !d.need(n) {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+// bytes returns a byte slice, which refers to d.b.
+func (d *decoder) bytes() []byte {
+	n := int(d.int32())
+	if n < 0 {
+		return nil
+	}
+	if !d.need(n) {
+		return nil
+	}
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
+
+// arrayLen returns the number of items in the array.
+//
+// It returns 0 for null arrays.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	// Every array item occupies at least a single byte.
+	// This prevents from allocating too big slices on malformed data.
+	if !d.need(int(n)) {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = fmt.Errorf("cannot read varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varBytes reads varint-prefixed byte slice, which refers to d.b.
+func (d *decoder) varBytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	if n > math.MaxInt32 {
+		d.err = fmt.Errorf("too big length for varint-prefixed bytes: %d", n)
+		return nil
+	}
+	if !d.need(int(n)) {
+		return nil
+	}
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
@@ -0,0 +1,224 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+// Record is a single Kafka record.
+type Record struct {
+	// Offset is the record offset in the partition. It is set only for fetched records.
+	Offset int64
+
+	// Timestamp is the record timestamp in milliseconds.
+	Timestamp int64
+
+	Key   []byte
+	Value []byte
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Record batch attributes.
+//
+// See https://kafka.apache.org/documentation/#recordbatch
+const (
+	compressionCodecMask = 0x07
+	compressionNone      = 0
+	compressionGzip      = 1
+	compressionZstd      = 4
+
+	controlBatchFlag = 0x20
+)
+
+// marshalRecordBatch appends records in the Kafka record batch format v2 to dst and returns the result.
+//
+// Records are stored without compression, since vmagent sends already compressed data blocks.
+func marshalRecordBatch(dst []byte, records []Record) []byte {
+	if len(records) == 0 {
+		return dst
+	}
+	firstTimestamp := records[0].Timestamp
+	maxTimestamp := firstTimestamp
+	for i := range records {
+		maxTimestamp = max(maxTimestamp, records[i].Timestamp)
+	}
+
+	batchStart := len(dst)
+	e := encoder{b: dst}
+	e.int64(0)  // baseOffset
+	e.int32(0)  // batchLength; it is updated below
+	e.int32(-1) // partitionLeaderEpoch
+	e.int8(2)   // magic
+	e.int32(0)  // crc; it is updated below
+	crcStart := len(e.b)
+	e.int16(compressionNone) // attributes
+	e.int32(int32(len(records) - 1))
+	e.int64(firstTimestamp)
+	e.int64(maxTimestamp)
+	e.int64(-1) // producerId
+	e.int16(-1) // producerEpoch
+	e.int32(-1) // baseSequence
+	e.arrayLen(len(records))
+
+	var rb []byte
+	for i := range records {
+		r := &records[i]
+		rb = rb[:0]
+		rb = append(rb, 0) // attributes
+		rb = binary.AppendVarint(rb, r.Timestamp-firstTimestamp)
+		rb = binary.AppendVarint(rb, int64(i))
+		rb = appendVarBytes(rb, r.Key)
+		rb = appendVarBytes(rb, r.Value)
+		rb = binary.AppendVarint(rb, 0) // headers count
+		e.b = binary.AppendVarint(e.b, int64(len(rb)))
+		e.b = append(e.b, rb...)
+	}
+
+	dst = e.b
+	binary.BigEndian.PutUint32(dst[batchStart+8:], uint32(len(dst)-batchStart-12))
+	binary.BigEndian.PutUint32(dst[crcStart-4:], crc32.Checksum(dst[crcStart:], crc32cTable))
+	return dst
+}
+
+func appendVarBytes(dst, b []byte) []byte {
+	if b == nil {
+		return binary.AppendVarint(dst, -1)
+	}
+	dst = binary.AppendVarint(dst, int64(len(b)))
+	return append(dst, b...)
+}
+
+// unmarshalRecordBatches appends records from Kafka record batches at src to dst and returns the result.
+//
+// Records with offsets smaller than minOffset are skipped.
+// The last batch is ignored if it is truncated, since Kafka broker may return partial batches in fetch responses.
+//
+// The returned records refer to src for uncompressed batches.
+func unmarshalRecordBatches(dst []Record, src []byte, minOffset int64) ([]Record, error) {
+	for len(src) > 0 {
+		if len(src) < 12 {
+			// Truncated batch header
+			return dst, nil
+		}
+		batchLen := int(int32(binary.BigEndian.Uint32(src[8:])))
+		if batchLen < 0 {
+			return dst, fmt.Errorf("invalid record batch length: %d", batchLen)
+		}
+		if len(src) < 12+batchLen {
+			// Truncated batch
+			return dst, nil
+		}
+		batch := src[:12+batchLen]
+		src = src[12+batchLen:]
+
+		var err error
+		dst, err = unmarshalRecordBatch(dst, batch, minOffset)
+		if err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+func unmarshalRecordBatch(dst []Record, src []byte, minOffset int64) ([]Record, error) {
+	d := decoder{b: src}
+	baseOffset := d.int64()
+	_ = d.int32() // batchLength
+	_ = d.int32() // partitionLeaderEpoch
+	magic := d.int8()
+	if d.err != nil {
+		return dst, d.err
+	}
+	if magic != 2 {
+		return dst, fmt.Errorf("unsupported record batch magic: %d; only magic=2 is supported", magic)
+	}
+	crc := uint32(d.int32())
+	if d.err != nil {
+		return dst, d.err
+	}
+	if crcGot := crc32.Checksum(d.b, crc32cTable); crcGot != crc {
+		return dst, fmt.Errorf("record batch checksum mismatch; got %08x; want %08x", crcGot, crc)
+	}
+	attributes := d.int16()
+	_ = d.int32() // lastOffsetDelta
+	firstTimestamp := d.int64()
+	_ = d.int64() // maxTimestamp
+	_ = d.int64() // producerId
+	_ = d.int16() // producerEpoch
+	_ = d.int32() // baseSequence
+	recordsCount := d.int32()
+	if d.err != nil {
+		return dst, d.err
+	}
+	if attributes&controlBatchFlag != 0 {
+		// Skip control batches for transactions
+		return dst, nil
+	}
+
+	data := d.b
+	switch codec := attributes & compressionCodecMask; codec {
+	case compressionNone:
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return dst, fmt.Errorf("cannot initialize gzip reader for record batch: %w", err)
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return dst, fmt.Errorf("cannot decompress gzipped record batch: %w", err)
+		}
+	case compressionZstd:
+		var err error
+		data, err = encoding.DecompressZSTD(nil, data)
+		if err != nil {
+			return dst, fmt.Errorf("cannot decompress zstd record batch: %w", err)
+		}
+	default:
+		return dst, fmt.Errorf("unsupported record batch compression codec: %d; supported codecs: none, gzip, zstd", codec)
+	}
+
+	d = decoder{b: data}
+	for i := int32(0); i < recordsCount; i++ {
+		recordLen := d.varint()
+		if d.err != nil {
+			return dst, fmt.Errorf("cannot read record length: %w", d.err)
+		}
+		if recordLen < 0 || int64(len(d.b)) < recordLen {
+			return dst, fmt.Errorf("invalid record length: %d", recordLen)
+		}
+		rd := decoder{b: d.b[:recordLen]}
+		d.b = d.b[recordLen:]
+
+		_ = rd.int8() // attributes
+		timestampDelta := rd.varint()
+		offsetDelta := rd.varint()
+		key := rd.varBytes()
+		value := rd.varBytes()
+		headersCount := rd.varint()
+		for j := int64(0); j < headersCount && rd.err == nil; j++ {
+			_ = rd.varBytes() // header key
+			_ = rd.varBytes() // header value
+		}
+		if rd.err != nil {
+			return dst, fmt.Errorf("cannot unmarshal record: %w", rd.err)
+		}
+		offset := baseOffset + offsetDelta
+		if offset < minOffset {
+			continue
+		}
+		dst = append(dst, Record{
+			Offset:    offset,
+			Timestamp: firstTimestamp + timestampDelta,
+			Key:       key,
+			Value:     value,
+		})
+	}
+	return dst, nil
+}
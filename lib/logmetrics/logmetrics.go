@@ -0,0 +1,671 @@
+package logmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/cespare/xxhash/v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/streamaggr"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Supported metric types for Config.Type.
+const (
+	// TypeCounter is a counter, which is incremented by the value from every matching log line.
+	TypeCounter = "counter"
+
+	// TypeHistogram is a histogram, which is updated with the value from every matching log line.
+	TypeHistogram = "histogram"
+)
+
+// Config is a rule for deriving metrics from log lines.
+//
+// See https://docs.victoriametrics.com/victoriametrics/vmagent/#log-derived-metrics
+type Config struct {
+	// Name is the name of the generated metric.
+	Name string `yaml:"name"`
+
+	// Type is the type of the generated metric. See TypeCounter and TypeHistogram.
+	Type string `yaml:"type"`
+
+	// Interval is the interval for flushing the generated metric. By default, it is 1m.
+	Interval string `yaml:"interval,omitempty"`
+
+	// Source is the field the Regex is applied to. By default, `message` field is used.
+	Source string `yaml:"source,omitempty"`
+
+	// Regex is an optional regular expression, which must match the Source field.
+	//
+	// Named capture groups from Regex are available as fields with the corresponding names.
+	Regex string `yaml:"regex,omitempty"`
+
+	// Labels maps label names for the generated metric to field names.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Value is the field with the value for the generated metric.
+	//
+	// It is required for histograms. Counters are incremented by 1 if Value is empty.
+	Value string `yaml:"value,omitempty"`
+
+	// RelabelConfigs is an optional relabeling for the generated metric labels.
+	//
+	// Fields are available as `__field_<name>` labels during relabeling.
+	RelabelConfigs []promrelabel.RelabelConfig `yaml:"relabel_configs,omitempty"`
+}
+
+// Processor derives metrics from log lines and aggregates them with stream aggregation.
+type Processor struct {
+	path     string
+	pushFunc streamaggr.PushFunc
+
+	// rs contains the currently used rules. It is replaced on Reload.
+	rs atomic.Pointer[ruleSet]
+
+	// counters are shared among the loaded rule sets, so cumulative values survive config reloads.
+	counters *counterStates
+}
+
+// ruleSet contains rules loaded from a single config.
+type ruleSet struct {
+	configData []byte
+	rules      []*rule
+	as         *streamaggr.Aggregators
+}
+
+// LoadFromFile loads rules from the given path and returns a Processor for them.
+//
+// The aggregated metrics are passed to pushFunc.
+//
+// The returned Processor must be stopped with MustStop when no longer needed.
+func LoadFromFile(path string, pushFunc streamaggr.PushFunc) (*Processor, error) {
+	rs, err := loadRuleSet(path, pushFunc)
+	if err != nil {
+		return nil, err
+	}
+	p := &Processor{
+		path:     path,
+		pushFunc: pushFunc,
+		counters: newCounterStates(),
+	}
+	p.rs.Store(rs)
+	return p, nil
+}
+
+// Reload reloads rules from the path passed to LoadFromFile.
+//
+// The previously loaded rules remain in use if the new rules cannot be loaded.
+// false is returned if the rules weren't changed since the previous load.
+func (p *Processor) Reload() (bool, error) {
+	rsNew, err := loadRuleSet(p.path, p.pushFunc)
+	if err != nil {
+		return false, err
+	}
+	rs := p.rs.Load()
+	if string(rsNew.configData) == string(rs.configData) {
+		rsNew.as.MustStop()
+		return false, nil
+	}
+	rsOld := p.rs.Swap(rsNew)
+	rsOld.as.MustStop()
+	return true, nil
+}
+
+func loadRuleSet(path string, pushFunc streamaggr.PushFunc) (*ruleSet, error) {
+	data, err := fscore.ReadFileOrHTTP(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load log metrics rules: %w", err)
+	}
+	data = envtemplate.ReplaceBytes(data)
+
+	var cfgs []*Config
+	if err := yaml.UnmarshalStrict(data, &cfgs); err != nil {
+		return nil, fmt.Errorf("cannot parse log metrics rules from %q: %w", path, err)
+	}
+	rs, err := newRuleSet(cfgs, path, pushFunc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize log metrics rules from %q: %w", path, err)
+	}
+	rs.configData = data
+	return rs, nil
+}
+
+func newProcessor(cfgs []*Config, path string, pushFunc streamaggr.PushFunc) (*Processor, error) {
+	rs, err := newRuleSet(cfgs, path, pushFunc)
+	if err != nil {
+		return nil, err
+	}
+	p := &Processor{
+		path:     path,
+		pushFunc: pushFunc,
+		counters: newCounterStates(),
+	}
+	p.rs.Store(rs)
+	return p, nil
+}
+
+func newRuleSet(cfgs []*Config, path string, pushFunc streamaggr.PushFunc) (*ruleSet, error) {
+	rules := make([]*rule, 0, len(cfgs))
+	var sacfgs []*streamaggr.Config
+	metricNames := make(map[string]struct{})
+	for i, cfg := range cfgs {
+		r, err := newRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse rule #%d: %w", i+1, err)
+		}
+		for _, name := range r.metricNames() {
+			if _, ok := metricNames[name]; ok {
+				return nil, fmt.Errorf("duplicate metric name %q at rule #%d", name, i+1)
+			}
+			metricNames[name] = struct{}{}
+		}
+		rules = append(rules, r)
+
+		cfgsLocal, err := r.streamAggrConfigs(cfg.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create stream aggregation config for rule #%d: %w", i+1, err)
+		}
+		sacfgs = append(sacfgs, cfgsLocal...)
+	}
+	as, err := streamaggr.LoadFromConfigs(sacfgs, path, pushFunc, nil, "logmetrics")
+	if err != nil {
+		return nil, err
+	}
+	return &ruleSet{
+		rules: rules,
+		as:    as,
+	}, nil
+}
+
+// MustStop stops p.
+func (p *Processor) MustStop() {
+	p.rs.Load().as.MustStop()
+}
+
+// ProcessStream reads log lines delimited by '\n' from r and derives metrics from them.
+func (p *Processor) ProcessStream(r io.Reader) error {
+	wcr := writeconcurrencylimiter.GetReader(r)
+	defer writeconcurrencylimiter.PutReader(wcr)
+
+	ctx := getProcessCtx()
+	defer putProcessCtx(ctx)
+
+	br := bufio.NewReaderSize(wcr, 64*1024)
+	var reqBuf, tailBuf []byte
+	for {
+		readCalls.Inc()
+		var err error
+		reqBuf, tailBuf, err = protoparserutil.ReadLinesBlock(br, reqBuf, tailBuf)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			readErrors.Inc()
+			return fmt.Errorf("cannot read log lines: %w", err)
+		}
+		p.processLines(ctx, reqBuf)
+		wcr.DecConcurrency()
+	}
+}
+
+// ProcessLines derives metrics from log lines delimited by '\n' in data.
+func (p *Processor) ProcessLines(data []byte) {
+	ctx := getProcessCtx()
+	p.processLines(ctx, data)
+	putProcessCtx(ctx)
+}
+
+func (p *Processor) processLines(ctx *processCtx, data []byte) {
+	rs := p.rs.Load()
+	p.appendSamplesForRules(ctx, rs.rules, data, time.Now().UnixMilli())
+	if len(ctx.tss) > 0 {
+		samplesGenerated.Add(len(ctx.tss))
+		rs.as.Push(ctx.tss, nil)
+	}
+	ctx.reset()
+}
+
+// appendSamples appends samples derived from log lines in data to ctx.tss.
+func (p *Processor) appendSamples(ctx *processCtx, data []byte, timestamp int64) {
+	p.appendSamplesForRules(ctx, p.rs.Load().rules, data, timestamp)
+}
+
+func (p *Processor) appendSamplesForRules(ctx *processCtx, rules []*rule, data []byte, timestamp int64) {
+	for len(data) > 0 {
+		var line []byte
+		if n := bytes.IndexByte(data, '\n'); n >= 0 {
+			line, data = data[:n], data[n+1:]
+		} else {
+			line, data = data, nil
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		linesRead.Inc()
+		ctx.fields.Parse(bytesutil.ToUnsafeString(line))
+		for _, r := range rules {
+			p.applyRule(ctx, r, timestamp)
+		}
+	}
+}
+
+func (p *Processor) applyRule(ctx *processCtx, r *rule, timestamp int64) {
+	ctx.captures = ctx.captures[:0]
+	if r.re != nil {
+		src, ok := ctx.fields.Get(r.source)
+		if !ok {
+			return
+		}
+		m := r.re.FindStringSubmatchIndex(src)
+		if m == nil {
+			return
+		}
+		for i, name := range r.re.SubexpNames() {
+			if name == "" || m[2*i] < 0 {
+				continue
+			}
+			ctx.captures = append(ctx.captures, Field{
+				Name:  name,
+				Value: src[m[2*i]:m[2*i+1]],
+			})
+		}
+	}
+
+	value := 1.0
+	if r.value != "" {
+		s, ok := ctx.getField(r.value)
+		if !ok {
+			return
+		}
+		v, err := parseValue(s)
+		if err != nil {
+			invalidValues.Inc()
+			return
+		}
+		value = v
+	}
+
+	labelsLen := len(ctx.labels)
+	for _, lf := range r.labels {
+		if v, ok := ctx.getField(lf.field); ok && v != "" {
+			ctx.labels = append(ctx.labels, prompb.Label{
+				Name:  lf.label,
+				Value: v,
+			})
+		}
+	}
+	if r.prc != nil {
+		fieldsLabelsLen := len(ctx.labels)
+		for _, f := range ctx.fields.Fields {
+			ctx.labels = ctx.appendFieldLabel(ctx.labels, f)
+		}
+		for _, f := range ctx.captures {
+			ctx.labels = ctx.appendFieldLabel(ctx.labels, f)
+		}
+		hasFields := len(ctx.labels) > fieldsLabelsLen
+		ctx.labels = r.prc.Apply(ctx.labels, labelsLen)
+		if hasFields && len(ctx.labels) == labelsLen {
+			// The log line has been dropped by relabeling
+			return
+		}
+		ctx.labels = promrelabel.FinalizeLabels(ctx.labels[:labelsLen], ctx.labels[labelsLen:])
+	}
+
+	labels := ctx.labels[labelsLen:]
+	if r.isHistogram {
+		ctx.appendSample(r.bucketName, labels, value, timestamp, false, nil)
+		ctx.appendSample(r.sumName, labels, value, timestamp, true, p.counters)
+		ctx.appendSample(r.countName, labels, 1, timestamp, true, p.counters)
+	} else {
+		ctx.appendSample(r.name, labels, value, timestamp, true, p.counters)
+	}
+}
+
+// parseValue parses numeric value or Go duration from s.
+//
+// Durations are converted to seconds.
+func parseValue(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err == nil {
+		return v, nil
+	}
+	d, errDuration := time.ParseDuration(s)
+	if errDuration == nil {
+		return d.Seconds(), nil
+	}
+	return 0, err
+}
+
+type processCtx struct {
+	fields   Fields
+	captures []Field
+
+	labels  []prompb.Label
+	samples []prompb.Sample
+	tss     []prompb.TimeSeries
+
+	labelNameBuf  []byte
+	counterKeyBuf []byte
+}
+
+func (ctx *processCtx) reset() {
+	ctx.fields.Reset()
+	clear(ctx.captures)
+	ctx.captures = ctx.captures[:0]
+
+	promrelabel.CleanLabels(ctx.labels)
+	ctx.labels = ctx.labels[:0]
+	ctx.samples = ctx.samples[:0]
+	clear(ctx.tss)
+	ctx.tss = ctx.tss[:0]
+}
+
+func (ctx *processCtx) getField(name string) (string, bool) {
+	for i := len(ctx.captures) - 1; i >= 0; i-- {
+		f := &ctx.captures[i]
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return ctx.fields.Get(name)
+}
+
+func (ctx *processCtx) appendFieldLabel(dst []prompb.Label, f Field) []prompb.Label {
+	ctx.labelNameBuf = append(ctx.labelNameBuf[:0], "__field_"...)
+	ctx.labelNameBuf = append(ctx.labelNameBuf, f.Name...)
+	return append(dst, prompb.Label{
+		Name:  promrelabel.SanitizeLabelName(bytesutil.ToUnsafeString(ctx.labelNameBuf)),
+		Value: f.Value,
+	})
+}
+
+// appendSample appends a sample for the series with the given name and labels to ctx.tss.
+//
+// If isCumulative is set, then value is added to the cumulative value for the series tracked in counters.
+func (ctx *processCtx) appendSample(name string, labels []prompb.Label, value float64, timestamp int64, isCumulative bool, counters *counterStates) {
+	labelsLen := len(ctx.labels)
+	ctx.labels = append(ctx.labels, prompb.Label{
+		Name:  "__name__",
+		Value: name,
+	})
+	ctx.labels = append(ctx.labels, labels...)
+	seriesLabels := ctx.labels[labelsLen:]
+	if isCumulative {
+		ctx.counterKeyBuf = ctx.counterKeyBuf[:0]
+		for _, label := range seriesLabels {
+			ctx.counterKeyBuf = append(ctx.counterKeyBuf, label.Name...)
+			ctx.counterKeyBuf = append(ctx.counterKeyBuf, 0)
+			ctx.counterKeyBuf = append(ctx.counterKeyBuf, label.Value...)
+			ctx.counterKeyBuf = append(ctx.counterKeyBuf, 0)
+		}
+		value = counters.add(ctx.counterKeyBuf, value)
+	}
+	ctx.samples = append(ctx.samples, prompb.Sample{
+		Value:     value,
+		Timestamp: timestamp,
+	})
+	ctx.tss = append(ctx.tss, prompb.TimeSeries{
+		Labels:  seriesLabels,
+		Samples: ctx.samples[len(ctx.samples)-1:],
+	})
+}
+
+func getProcessCtx() *processCtx {
+	v := processCtxPool.Get()
+	if v == nil {
+		return &processCtx{}
+	}
+	return v.(*processCtx)
+}
+
+func putProcessCtx(ctx *processCtx) {
+	ctx.reset()
+	processCtxPool.Put(ctx)
+}
+
+var processCtxPool sync.Pool
+
+type rule struct {
+	name        string
+	isHistogram bool
+	bucketName  string
+	sumName     string
+	countName   string
+
+	source string
+	re     *regexp.Regexp
+	labels []labelField
+	value  string
+	prc    *promrelabel.ParsedConfigs
+}
+
+type labelField struct {
+	label string
+	field string
+}
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func newRule(cfg *Config) (*rule, error) {
+	if !metricNameRegexp.MatchString(cfg.Name) {
+		return nil, fmt.Errorf("invalid metric name %q; it must match %s", cfg.Name, metricNameRegexp)
+	}
+	r := &rule{
+		name:   cfg.Name,
+		source: cfg.Source,
+		value:  cfg.Value,
+	}
+	switch cfg.Type {
+	case TypeCounter:
+	case TypeHistogram:
+		if cfg.Value == "" {
+			return nil, fmt.Errorf("missing `value` for histogram %q", cfg.Name)
+		}
+		r.isHistogram = true
+		r.bucketName = cfg.Name + "_bucket"
+		r.sumName = cfg.Name + "_sum"
+		r.countName = cfg.Name + "_count"
+	default:
+		return nil, fmt.Errorf("unsupported type %q for %q; supported types: %s, %s", cfg.Type, cfg.Name, TypeCounter, TypeHistogram)
+	}
+	if r.source == "" {
+		r.source = "message"
+	}
+	if cfg.Regex != "" {
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `regex` for %q: %w", cfg.Name, err)
+		}
+		r.re = re
+	}
+	for label, field := range cfg.Labels {
+		if !labelNameRegexp.MatchString(label) || strings.HasPrefix(label, "__") {
+			return nil, fmt.Errorf("invalid label name %q for %q", label, cfg.Name)
+		}
+		if field == "" {
+			return nil, fmt.Errorf("missing field name for label %q at %q", label, cfg.Name)
+		}
+		r.labels = append(r.labels, labelField{
+			label: label,
+			field: field,
+		})
+	}
+	slices.SortFunc(r.labels, func(a, b labelField) int {
+		return strings.Compare(a.label, b.label)
+	})
+	if len(cfg.RelabelConfigs) > 0 {
+		prc, err := promrelabel.ParseRelabelConfigs(cfg.RelabelConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `relabel_configs` for %q: %w", cfg.Name, err)
+		}
+		r.prc = prc
+	}
+	return r, nil
+}
+
+// metricNames returns names of metrics generated by r.
+func (r *rule) metricNames() []string {
+	if r.isHistogram {
+		return []string{r.bucketName, r.sumName, r.countName}
+	}
+	return []string{r.name}
+}
+
+// streamAggrConfigs returns stream aggregation configs for the metrics generated by r.
+//
+// Cumulative values are aggregated with `last` output, while histogram observations are aggregated with `histogram_bucket` output.
+func (r *rule) streamAggrConfigs(interval string) ([]*streamaggr.Config, error) {
+	if interval == "" {
+		interval = "1m"
+	}
+	newConfig := func(output string, names ...string) (*streamaggr.Config, error) {
+		var ie promrelabel.IfExpression
+		if err := ie.Parse(fmt.Sprintf(`{__name__=~%s}`, strconv.Quote(strings.Join(names, "|")))); err != nil {
+			return nil, fmt.Errorf("BUG: cannot parse match expression: %w", err)
+		}
+		cfg := &streamaggr.Config{
+			Name:     r.name,
+			Match:    &ie,
+			Interval: interval,
+			Outputs:  []string{output},
+		}
+		if output == "last" {
+			keepMetricNames := true
+			cfg.KeepMetricNames = &keepMetricNames
+		} else {
+			// keep_metric_names cannot be used for outputs generating multiple series,
+			// so remove the suffix added by stream aggregation with relabeling.
+			cfg.OutputRelabelConfigs = []promrelabel.RelabelConfig{{
+				Action:       "replace",
+				SourceLabels: []string{"__name__"},
+				Regex: &promrelabel.MultiLineRegex{
+					S: "(.+):" + regexp.QuoteMeta(interval+"_"+output),
+				},
+				TargetLabel: "__name__",
+				Replacement: &metricNameReplacement,
+			}}
+		}
+		return cfg, nil
+	}
+	if !r.isHistogram {
+		cfg, err := newConfig("last", r.name)
+		if err != nil {
+			return nil, err
+		}
+		return []*streamaggr.Config{cfg}, nil
+	}
+	cfgBucket, err := newConfig("histogram_bucket", r.bucketName)
+	if err != nil {
+		return nil, err
+	}
+	cfgLast, err := newConfig("last", r.sumName, r.countName)
+	if err != nil {
+		return nil, err
+	}
+	return []*streamaggr.Config{cfgBucket, cfgLast}, nil
+}
+
+var metricNameReplacement = "$1"
+
+// counterStateStaleInterval is the interval in seconds after which the cumulative value is dropped
+// if no new values are received for it.
+const counterStateStaleInterval = 3600
+
+type counterState struct {
+	value    float64
+	lastSeen uint64
+}
+
+// counterStatesShardsCount is the number of shards for counterStates.
+//
+// Sharding reduces lock contention when log lines are processed concurrently.
+const counterStatesShardsCount = 64
+
+// counterStates tracks cumulative values for the generated counters.
+type counterStates struct {
+	shards []counterStatesShard
+}
+
+type counterStatesShard struct {
+	counterStatesShardNopad
+
+	// The padding prevents false sharing
+	_ [atomicutil.CacheLineSize - unsafe.Sizeof(counterStatesShardNopad{})%atomicutil.CacheLineSize]byte
+}
+
+type counterStatesShardNopad struct {
+	mu          sync.Mutex
+	m           map[string]*counterState
+	nextCleanup uint64
+}
+
+func newCounterStates() *counterStates {
+	nextCleanup := fasttime.UnixTimestamp() + counterStateStaleInterval
+	shards := make([]counterStatesShard, counterStatesShardsCount)
+	for i := range shards {
+		shards[i].m = make(map[string]*counterState)
+		shards[i].nextCleanup = nextCleanup
+	}
+	return &counterStates{
+		shards: shards,
+	}
+}
+
+// add adds the increment to the counter identified by key and returns the updated cumulative value.
+func (cs *counterStates) add(key []byte, increment float64) float64 {
+	currentTime := fasttime.UnixTimestamp()
+	h := xxhash.Sum64(key)
+	shard := &cs.shards[h%uint64(len(cs.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if currentTime >= shard.nextCleanup {
+		for k, s := range shard.m {
+			if s.lastSeen+counterStateStaleInterval < currentTime {
+				delete(shard.m, k)
+			}
+		}
+		shard.nextCleanup = currentTime + counterStateStaleInterval
+	}
+
+	s := shard.m[string(key)]
+	if s == nil {
+		s = &counterState{}
+		shard.m[string(key)] = s
+	}
+	s.value += increment
+	s.lastSeen = currentTime
+	return s.value
+}
+
+var (
+	readCalls        = metrics.NewCounter(`vm_protoparser_read_calls_total{type="logmetrics"}`)
+	readErrors       = metrics.NewCounter(`vm_protoparser_read_errors_total{type="logmetrics"}`)
+	linesRead        = metrics.NewCounter(`vm_protoparser_rows_read_total{type="logmetrics"}`)
+	invalidValues    = metrics.NewCounter(`vm_logmetrics_invalid_values_total`)
+	samplesGenerated = metrics.NewCounter(`vm_logmetrics_samples_generated_total`)
+)
@@ -0,0 +1,292 @@
+package logmetrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func mustNewProcessor(t *testing.T, config string) (*Processor, error) {
+	t.Helper()
+
+	var cfgs []*Config
+	if err := yaml.UnmarshalStrict([]byte(config), &cfgs); err != nil {
+		t.Fatalf("cannot parse config: %s", err)
+	}
+	return newProcessor(cfgs, "inmemory", func(_ []prompb.TimeSeries) {})
+}
+
+func TestNewProcessorFailure(t *testing.T) {
+	f := func(config string) {
+		t.Helper()
+
+		p, err := mustNewProcessor(t, config)
+		if err == nil {
+			p.MustStop()
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid metric name
+	f(`
+- name: foo-bar
+  type: counter
+`)
+
+	// unsupported type
+	f(`
+- name: foo
+  type: gauge
+`)
+
+	// missing value for histogram
+	f(`
+- name: foo
+  type: histogram
+`)
+
+	// invalid regex
+	f(`
+- name: foo
+  type: counter
+  regex: "(foo"
+`)
+
+	// invalid label name
+	f(`
+- name: foo
+  type: counter
+  labels:
+    __name__: bar
+`)
+
+	// invalid relabel_configs
+	f(`
+- name: foo
+  type: counter
+  relabel_configs:
+  - action: unknown
+`)
+
+	// invalid interval
+	f(`
+- name: foo
+  type: counter
+  interval: foo
+`)
+
+	// duplicate metric names
+	f(`
+- name: foo
+  type: counter
+- name: foo
+  type: counter
+`)
+	f(`
+- name: foo_count
+  type: counter
+- name: foo
+  type: histogram
+  value: duration
+`)
+}
+
+func TestProcessorAppendSamples(t *testing.T) {
+	f := func(config, data, resultExpected string) {
+		t.Helper()
+
+		p, err := mustNewProcessor(t, config)
+		if err != nil {
+			t.Fatalf("cannot initialize processor: %s", err)
+		}
+		defer p.MustStop()
+
+		ctx := getProcessCtx()
+		defer putProcessCtx(ctx)
+
+		p.appendSamples(ctx, []byte(data), 1000)
+		var lines []string
+		for _, ts := range ctx.tss {
+			for _, s := range ts.Samples {
+				lines = append(lines, promrelabel.LabelsToString(ts.Labels)+" "+strconv.FormatFloat(s.Value, 'g', -1, 64))
+			}
+		}
+		result := strings.Join(lines, "\n")
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// counter for all the lines
+	f(`
+- name: lines_total
+  type: counter
+`, "foo\n\nbar\n", `lines_total 1
+lines_total 2`)
+
+	// counter with regex and labels
+	f(`
+- name: requests_total
+  type: counter
+  regex: '^(?P<method>[A-Z]+) \S+ (?P<status>\d+)'
+  labels:
+    method: method
+    code: status
+    host: hostname
+`, `GET /foo 200
+<13>Oct 11 22:14:15 myhost nginx[1234]: POST /bar 500
+unmatched line
+GET /baz 200`, `requests_total{code="200",method="GET"} 1
+requests_total{code="500",host="myhost",method="POST"} 1
+requests_total{code="200",method="GET"} 2`)
+
+	// counter with value from json field
+	f(`
+- name: bytes_sent_total
+  type: counter
+  value: resp.bytes
+  labels:
+    path: req.path
+`, `{"req":{"path":"/foo"},"resp":{"bytes":100}}
+{"req":{"path":"/foo"},"resp":{"bytes":"invalid"}}
+{"req":{"path":"/foo"}}
+{"req":{"path":"/foo"},"resp":{"bytes":50}}`, `bytes_sent_total{path="/foo"} 100
+bytes_sent_total{path="/foo"} 150`)
+
+	// histogram with duration values
+	f(`
+- name: request_duration_seconds
+  type: histogram
+  source: msg
+  regex: 'took (?P<duration>\S+)'
+  value: duration
+`, `{"msg":"request took 1.5"}
+{"msg":"request took 500ms"}`, `request_duration_seconds_bucket 1.5
+request_duration_seconds_sum 1.5
+request_duration_seconds_count 1
+request_duration_seconds_bucket 0.5
+request_duration_seconds_sum 2
+request_duration_seconds_count 2`)
+
+	// relabeling with fields
+	f(`
+- name: errors_total
+  type: counter
+  relabel_configs:
+  - action: keep
+    source_labels: [__field_level]
+    regex: error
+  - source_labels: [__field_kubernetes_pod]
+    target_label: pod
+`, `{"level":"info","kubernetes":{"pod":"foo"}}
+{"level":"error","kubernetes":{"pod":"foo"}}
+{"level":"error"}`, `errors_total{pod="foo"} 1
+errors_total 1`)
+}
+
+func TestProcessorReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logmetrics.yml")
+	writeConfig := func(config string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatalf("cannot write config: %s", err)
+		}
+	}
+	f := func(p *Processor, data, resultExpected string) {
+		t.Helper()
+
+		ctx := getProcessCtx()
+		defer putProcessCtx(ctx)
+
+		p.appendSamples(ctx, []byte(data), 1000)
+		var lines []string
+		for _, ts := range ctx.tss {
+			for _, s := range ts.Samples {
+				lines = append(lines, promrelabel.LabelsToString(ts.Labels)+" "+strconv.FormatFloat(s.Value, 'g', -1, 64))
+			}
+		}
+		result := strings.Join(lines, "\n")
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	writeConfig(`
+- name: lines_total
+  type: counter
+`)
+	p, err := LoadFromFile(path, func(_ []prompb.TimeSeries) {})
+	if err != nil {
+		t.Fatalf("cannot load config: %s", err)
+	}
+	defer p.MustStop()
+	f(p, "foo\n", `lines_total 1`)
+
+	// unchanged config
+	ok, err := p.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ok {
+		t.Fatalf("expecting unchanged config")
+	}
+
+	// invalid config keeps the previously loaded rules
+	writeConfig(`
+- name: foo-bar
+  type: counter
+`)
+	if _, err := p.Reload(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	f(p, "foo\n", `lines_total 2`)
+
+	// new rules are applied, while cumulative values for the existing counters are preserved
+	writeConfig(`
+- name: lines_total
+  type: counter
+- name: errors_total
+  type: counter
+  regex: error
+`)
+	ok, err = p.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ok {
+		t.Fatalf("expecting changed config")
+	}
+	f(p, "some error\n", `lines_total 3
+errors_total 1`)
+}
+
+func TestCounterStatesAddConcurrent(t *testing.T) {
+	cs := newCounterStates()
+	const workers = 4
+	const iterations = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				cs.add([]byte(fmt.Sprintf("key_%d", j%10)), 1)
+			}
+		}()
+	}
+	wg.Wait()
+	for j := 0; j < 10; j++ {
+		if v := cs.add([]byte(fmt.Sprintf("key_%d", j)), 0); v != workers*iterations/10 {
+			t.Fatalf("unexpected value for key_%d; got %v; want %d", j, v, workers*iterations/10)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package logmetrics
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// Field is a named value extracted from a log line.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Fields contains fields extracted from a single log line.
+type Fields struct {
+	// Fields contains the extracted fields.
+	Fields []Field
+
+	p fastjson.Parser
+}
+
+// Reset resets fs.
+func (fs *Fields) Reset() {
+	clear(fs.Fields)
+	fs.Fields = fs.Fields[:0]
+}
+
+// Get returns the value for the field with the given name.
+func (fs *Fields) Get(name string) (string, bool) {
+	for i := len(fs.Fields) - 1; i >= 0; i-- {
+		f := &fs.Fields[i]
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Parse extracts fields from the given log line.
+//
+// The following line formats are supported:
+//
+//   - JSON object. Nested object keys are joined with `.`, e.g. `{"a":{"b":"c"}}` results in `a.b` field.
+//   - Syslog message in RFC5424 or RFC3164 format. See ParseSyslog for the list of extracted fields.
+//   - Plain text. The whole line is put into `message` field.
+//
+// The extracted fields may refer to line and to the internal buffers of fs, so they are valid until the next call to Parse or Reset.
+func (fs *Fields) Parse(line string) {
+	fs.Reset()
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		v, err := fs.p.Parse(line)
+		if err == nil && v.Type() == fastjson.TypeObject {
+			fs.appendJSONObject("", v.GetObject())
+			return
+		}
+	}
+	if strings.HasPrefix(line, "<") && fs.ParseSyslog(line) {
+		return
+	}
+	fs.Fields = append(fs.Fields, Field{
+		Name:  "message",
+		Value: line,
+	})
+}
+
+func (fs *Fields) appendJSONObject(prefix string, o *fastjson.Object) {
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		name := string(k)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		switch v.Type() {
+		case fastjson.TypeObject:
+			fs.appendJSONObject(name, v.GetObject())
+		case fastjson.TypeString:
+			fs.Fields = append(fs.Fields, Field{
+				Name:  name,
+				Value: string(v.GetStringBytes()),
+			})
+		case fastjson.TypeNull:
+			// Skip null values
+		default:
+			fs.Fields = append(fs.Fields, Field{
+				Name:  name,
+				Value: v.String(),
+			})
+		}
+	})
+}
+
+// ParseSyslog extracts fields from syslog line in RFC5424 or RFC3164 format.
+//
+// The following fields are extracted: `priority`, `facility`, `severity`, `hostname`, `app_name`, `proc_id`, `msg_id` and `message`.
+// Structured data params from RFC5424 messages are put into `<sd_id>.<param_name>` fields.
+// Timestamps are ignored.
+//
+// See https://datatracker.ietf.org/doc/html/rfc5424 and https://datatracker.ietf.org/doc/html/rfc3164
+//
+// false is returned if line doesn't contain valid syslog message.
+func (fs *Fields) ParseSyslog(line string) bool {
+	if !strings.HasPrefix(line, "<") {
+		return false
+	}
+	n := strings.IndexByte(line, '>')
+	if n < 2 || n > 4 {
+		return false
+	}
+	priority, err := strconv.ParseUint(line[1:n], 10, 8)
+	if err != nil || priority > 191 {
+		return false
+	}
+	s := line[n+1:]
+	fieldsLen := len(fs.Fields)
+	fs.Fields = append(fs.Fields, Field{
+		Name:  "priority",
+		Value: line[1:n],
+	}, Field{
+		Name:  "facility",
+		Value: syslogFacilities[priority/8],
+	}, Field{
+		Name:  "severity",
+		Value: syslogSeverities[priority%8],
+	})
+	if strings.HasPrefix(s, "1 ") {
+		if !fs.parseRFC5424(s[len("1 "):]) {
+			fs.Fields = fs.Fields[:fieldsLen]
+			return false
+		}
+		return true
+	}
+	fs.parseRFC3164(s)
+	return true
+}
+
+func (fs *Fields) parseRFC5424(s string) bool {
+	// Skip timestamp
+	_, s, ok := strings.Cut(s, " ")
+	if !ok {
+		return false
+	}
+	for _, name := range []string{"hostname", "app_name", "proc_id", "msg_id"} {
+		var value string
+		value, s, ok = strings.Cut(s, " ")
+		if !ok && name != "msg_id" {
+			return false
+		}
+		if value != "-" {
+			fs.Fields = append(fs.Fields, Field{
+				Name:  name,
+				Value: value,
+			})
+		}
+	}
+	s, ok = fs.parseStructuredData(s)
+	if !ok {
+		return false
+	}
+	s = strings.TrimPrefix(s, " ")
+	s = strings.TrimPrefix(s, "\ufeff")
+	fs.Fields = append(fs.Fields, Field{
+		Name:  "message",
+		Value: s,
+	})
+	return true
+}
+
+// parseStructuredData parses RFC5424 structured data from the beginning of s and returns the tail.
+func (fs *Fields) parseStructuredData(s string) (string, bool) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], true
+	}
+	if !strings.HasPrefix(s, "[") {
+		return s, false
+	}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		n := strings.IndexAny(s, " ]")
+		if n < 0 {
+			return s, false
+		}
+		sdID := s[:n]
+		s = s[n:]
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			n := strings.Index(s, `="`)
+			if n < 0 {
+				return s, false
+			}
+			name := sdID + "." + s[:n]
+			s = s[n+len(`="`):]
+			value, tail, ok := parseSDParamValue(s)
+			if !ok {
+				return s, false
+			}
+			fs.Fields = append(fs.Fields, Field{
+				Name:  name,
+				Value: value,
+			})
+			s = tail
+		}
+		if !strings.HasPrefix(s, "]") {
+			return s, false
+		}
+		s = s[1:]
+	}
+	return s, true
+}
+
+// parseSDParamValue parses structured data param value from the beginning of s until the closing quote.
+func parseSDParamValue(s string) (string, string, bool) {
+	n := strings.IndexByte(s, '"')
+	if n < 0 {
+		return "", s, false
+	}
+	if !strings.Contains(s[:n], `\`) {
+		return s[:n], s[n+1:], true
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", s, false
+}
+
+func (fs *Fields) parseRFC3164(s string) {
+	// Skip optional timestamp in `Mmm dd hh:mm:ss` format
+	if len(s) >= len("Mmm dd hh:mm:ss ") && s[3] == ' ' && s[6] == ' ' && s[9] == ':' && s[12] == ':' && s[15] == ' ' {
+		s = s[len("Mmm dd hh:mm:ss "):]
+		if hostname, tail, ok := strings.Cut(s, " "); ok && !strings.HasSuffix(hostname, ":") {
+			fs.Fields = append(fs.Fields, Field{
+				Name:  "hostname",
+				Value: hostname,
+			})
+			s = tail
+		}
+	}
+	if n := strings.Index(s, ": "); n > 0 && !strings.Contains(s[:n], " ") {
+		tag := s[:n]
+		s = s[n+len(": "):]
+		if m := strings.IndexByte(tag, '['); m > 0 && strings.HasSuffix(tag, "]") {
+			fs.Fields = append(fs.Fields, Field{
+				Name:  "proc_id",
+				Value: tag[m+1 : len(tag)-1],
+			})
+			tag = tag[:m]
+		}
+		fs.Fields = append(fs.Fields, Field{
+			Name:  "app_name",
+			Value: tag,
+		})
+	}
+	fs.Fields = append(fs.Fields, Field{
+		Name:  "message",
+		Value: s,
+	})
+}
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
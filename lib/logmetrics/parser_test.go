@@ -0,0 +1,82 @@
+package logmetrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldsParse(t *testing.T) {
+	f := func(line string, fieldsExpected []Field) {
+		t.Helper()
+
+		var fs Fields
+		fs.Parse(line)
+		if !reflect.DeepEqual(fs.Fields, fieldsExpected) {
+			t.Fatalf("unexpected fields\ngot\n%q\nwant\n%q", fs.Fields, fieldsExpected)
+		}
+
+		// Try parsing again
+		fs.Parse(line)
+		if !reflect.DeepEqual(fs.Fields, fieldsExpected) {
+			t.Fatalf("unexpected fields on the second parse\ngot\n%q\nwant\n%q", fs.Fields, fieldsExpected)
+		}
+	}
+
+	// plain text
+	f("GET /foo 200", []Field{{"message", "GET /foo 200"}})
+	f("  {not a json  ", []Field{{"message", "{not a json"}})
+	f("<bad syslog", []Field{{"message", "<bad syslog"}})
+
+	// json
+	f(`{"level":"error","status":500,"ok":false,"skip":null,"req":{"method":"GET","tags":["a","b"]}}`, []Field{
+		{"level", "error"},
+		{"status", "500"},
+		{"ok", "false"},
+		{"req.method", "GET"},
+		{"req.tags", `["a","b"]`},
+	})
+	f(`{"msg":"a \"quoted\" string"}`, []Field{{"msg", `a "quoted" string`}})
+
+	// RFC5424 syslog
+	f(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\"lication"] An application event`, []Field{
+		{"priority", "165"},
+		{"facility", "local4"},
+		{"severity", "notice"},
+		{"hostname", "mymachine.example.com"},
+		{"app_name", "evntslog"},
+		{"msg_id", "ID47"},
+		{"exampleSDID@32473.iut", "3"},
+		{"exampleSDID@32473.eventSource", `App"lication`},
+		{"message", "An application event"},
+	})
+	f(`<34>1 2003-10-11T22:14:15.003Z host su 123 - - 'su root' failed`, []Field{
+		{"priority", "34"},
+		{"facility", "auth"},
+		{"severity", "crit"},
+		{"hostname", "host"},
+		{"app_name", "su"},
+		{"proc_id", "123"},
+		{"message", "'su root' failed"},
+	})
+
+	// invalid RFC5424 syslog is parsed as plain text
+	f(`<34>1 2003-10-11T22:14:15.003Z host su 123 - [broken`, []Field{{"message", "<34>1 2003-10-11T22:14:15.003Z host su 123 - [broken"}})
+
+	// RFC3164 syslog
+	f(`<13>Oct 11 22:14:15 mymachine nginx[1234]: GET /foo 200`, []Field{
+		{"priority", "13"},
+		{"facility", "user"},
+		{"severity", "notice"},
+		{"hostname", "mymachine"},
+		{"proc_id", "1234"},
+		{"app_name", "nginx"},
+		{"message", "GET /foo 200"},
+	})
+	f(`<11>myapp: something failed`, []Field{
+		{"priority", "11"},
+		{"facility", "user"},
+		{"severity", "err"},
+		{"app_name", "myapp"},
+		{"message", "something failed"},
+	})
+}
@@ -0,0 +1,286 @@
+package nativehistogram
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+var enableNativeHistograms = flag.Bool("enableNativeHistograms", false, "Whether to enable ingestion of Prometheus native histograms received via Prometheus remote write "+
+	"and OpenTelemetry exponential histograms. Every histogram is stored as a set of series with the same labels plus the __nh__ label. "+
+	"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#native-histograms")
+
+// IsEnabled returns true if native histograms processing is enabled via -enableNativeHistograms command-line flag.
+func IsEnabled() bool {
+	return *enableNativeHistograms
+}
+
+// ComponentLabel is the name of the label, which identifies the component of native histogram stored in a separate series.
+//
+// The label value is one of the following:
+//
+//   - count - the total number of observations
+//   - sum - the sum of observations
+//   - zero:<threshold> - the number of observations in the zero bucket with the given threshold
+//   - pos:<schema>:<index> - the number of observations in the positive bucket with the given schema and index
+//   - neg:<schema>:<index> - the number of observations in the negative bucket with the given schema and index
+//
+// All the components are counters for cumulative histograms, so functions such as rate() and increase() can be applied to them.
+const ComponentLabel = "__nh__"
+
+const (
+	// ComponentCount is the ComponentLabel value for the total number of observations.
+	ComponentCount = "count"
+
+	// ComponentSum is the ComponentLabel value for the sum of observations.
+	ComponentSum = "sum"
+)
+
+const (
+	// MinSchema is the minimum supported schema for native histograms.
+	MinSchema = -4
+
+	// MaxSchema is the maximum supported schema for native histograms.
+	//
+	// Histograms with bigger schemas are converted to MaxSchema in the same way as Prometheus does.
+	MaxSchema = 8
+)
+
+// Component is a single component of native histogram.
+type Component struct {
+	// Name is the value for ComponentLabel.
+	Name string
+
+	// Value is the component value.
+	Value float64
+}
+
+// AppendComponents appends components for h to dst and returns the result.
+//
+// An error is returned if h has unsupported schema. Histograms with custom buckets (schema -53) aren't supported.
+func AppendComponents(dst []Component, h *prompb.Histogram) ([]Component, error) {
+	return appendComponents(dst, h.Count, h.Sum, h.Schema, h.ZeroThreshold, h.ZeroCount, h.VisitPositiveBuckets, h.VisitNegativeBuckets)
+}
+
+// AppendExponentialComponents appends components for OpenTelemetry exponential histogram to dst and returns the result.
+//
+// positive and negative must contain absolute counts for consecutive buckets starting from the given offsets.
+// sum must be set to NaN if it is missing.
+// See https://opentelemetry.io/docs/specs/otel/metrics/data-model/#exponentialhistogram
+func AppendExponentialComponents(dst []Component, count, sum float64, scale int32, zeroThreshold, zeroCount float64,
+	positiveOffset int32, positive []uint64, negativeOffset int32, negative []uint64) ([]Component, error) {
+	// OpenTelemetry bucket with index i covers the range (base^i ... base^(i+1)],
+	// while Prometheus bucket with index i covers the range (base^(i-1) ... base^i].
+	visitPositive := func(f func(index int32, count float64)) {
+		for i, n := range positive {
+			f(positiveOffset+int32(i)+1, float64(n))
+		}
+	}
+	visitNegative := func(f func(index int32, count float64)) {
+		for i, n := range negative {
+			f(negativeOffset+int32(i)+1, float64(n))
+		}
+	}
+	return appendComponents(dst, count, sum, scale, zeroThreshold, zeroCount, visitPositive, visitNegative)
+}
+
+func appendComponents(dst []Component, count, sum float64, schema int32, zeroThreshold, zeroCount float64,
+	visitPositive, visitNegative func(f func(index int32, count float64))) ([]Component, error) {
+	if schema < MinSchema {
+		return dst, fmt.Errorf("unsupported native histogram schema %d; supported schemas: [%d...%d]", schema, MinSchema, MaxSchema)
+	}
+	d := uint(0)
+	if schema > MaxSchema {
+		d = uint(schema - MaxSchema)
+		schema = MaxSchema
+	}
+
+	dst = append(dst, Component{
+		Name:  ComponentCount,
+		Value: count,
+	})
+	if !math.IsNaN(sum) {
+		dst = append(dst, Component{
+			Name:  ComponentSum,
+			Value: sum,
+		})
+	}
+	if zeroCount > 0 || zeroThreshold > 0 {
+		dst = append(dst, Component{
+			Name:  zeroComponentName(zeroThreshold),
+			Value: zeroCount,
+		})
+	}
+	dst = appendBucketComponents(dst, "pos", schema, d, visitPositive)
+	dst = appendBucketComponents(dst, "neg", schema, d, visitNegative)
+	return dst, nil
+}
+
+func appendBucketComponents(dst []Component, prefix string, schema int32, d uint, visit func(f func(index int32, count float64))) []Component {
+	prevIndex := int32(math.MinInt32)
+	visit(func(index int32, count float64) {
+		index = reduceIndex(index, d)
+		if index == prevIndex {
+			// Merge buckets, which fall into the same bucket after the reduction of schema.
+			dst[len(dst)-1].Value += count
+			return
+		}
+		prevIndex = index
+		dst = append(dst, Component{
+			Name:  bucketComponentName(prefix, schema, index),
+			Value: count,
+		})
+	})
+	return dst
+}
+
+// reduceIndex returns the index of the bucket, which contains the bucket with the given index after the reduction of schema by d.
+func reduceIndex(index int32, d uint) int32 {
+	if d == 0 {
+		return index
+	}
+	return ((index - 1) >> d) + 1
+}
+
+func bucketComponentName(prefix string, schema, index int32) string {
+	if index < -maxCachedBucketIndex || index > maxCachedBucketIndex {
+		return prefix + ":" + strconv.Itoa(int(schema)) + ":" + strconv.Itoa(int(index))
+	}
+	key := bucketNameKey{
+		negative: prefix == "neg",
+		schema:   schema,
+		index:    index,
+	}
+	if v, ok := bucketNamesCache.Load(key); ok {
+		return v.(string)
+	}
+	name := prefix + ":" + strconv.Itoa(int(schema)) + ":" + strconv.Itoa(int(index))
+	bucketNamesCache.Store(key, name)
+	return name
+}
+
+type bucketNameKey struct {
+	negative bool
+	schema   int32
+	index    int32
+}
+
+// bucketNamesCache contains bucket component names in order to reduce memory allocations.
+//
+// Only names for buckets with indexes in the range [-maxCachedBucketIndex ... maxCachedBucketIndex] are cached
+// in order to limit the cache size. This range covers values in the range [1e-10 ... 1e10] for all the supported schemas.
+var bucketNamesCache sync.Map
+
+const maxCachedBucketIndex = 8800
+
+func zeroComponentName(threshold float64) string {
+	if v, ok := zeroNamesCache.Load(threshold); ok {
+		return v.(string)
+	}
+	name := "zero:" + strconv.FormatFloat(threshold, 'g', -1, 64)
+	zeroNamesCache.Store(threshold, name)
+	return name
+}
+
+// zeroNamesCache contains zero bucket component names in order to reduce memory allocations.
+//
+// Clients usually use the same zero threshold for all the histograms, so the number of entries in the cache is small.
+var zeroNamesCache sync.Map
+
+// ComponentKind is the kind of native histogram component.
+type ComponentKind int
+
+const (
+	// ComponentKindCount is the component with the total number of observations.
+	ComponentKindCount = ComponentKind(iota)
+
+	// ComponentKindSum is the component with the sum of observations.
+	ComponentKindSum
+
+	// ComponentKindZero is the component with the number of observations in the zero bucket.
+	ComponentKindZero
+
+	// ComponentKindPositive is the component with the number of observations in a positive bucket.
+	ComponentKindPositive
+
+	// ComponentKindNegative is the component with the number of observations in a negative bucket.
+	ComponentKindNegative
+)
+
+// ComponentKey is parsed ComponentLabel value.
+type ComponentKey struct {
+	// Kind is the component kind.
+	Kind ComponentKind
+
+	// Schema is the bucket schema for ComponentKindPositive and ComponentKindNegative.
+	Schema int32
+
+	// Index is the bucket index for ComponentKindPositive and ComponentKindNegative.
+	Index int32
+
+	// ZeroThreshold is the zero bucket threshold for ComponentKindZero.
+	ZeroThreshold float64
+}
+
+// ParseComponentKey parses ComponentLabel value s into ck.
+func ParseComponentKey(ck *ComponentKey, s string) error {
+	*ck = ComponentKey{}
+	switch s {
+	case ComponentCount:
+		ck.Kind = ComponentKindCount
+		return nil
+	case ComponentSum:
+		ck.Kind = ComponentKindSum
+		return nil
+	}
+	prefix, tail, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("unexpected native histogram component %q", s)
+	}
+	switch prefix {
+	case "zero":
+		threshold, err := strconv.ParseFloat(tail, 64)
+		if err != nil || threshold < 0 {
+			return fmt.Errorf("cannot parse zero threshold for native histogram component %q", s)
+		}
+		ck.Kind = ComponentKindZero
+		ck.ZeroThreshold = threshold
+		return nil
+	case "pos":
+		ck.Kind = ComponentKindPositive
+	case "neg":
+		ck.Kind = ComponentKindNegative
+	default:
+		return fmt.Errorf("unexpected native histogram component %q", s)
+	}
+	schemaStr, indexStr, ok := strings.Cut(tail, ":")
+	if !ok {
+		return fmt.Errorf("missing bucket index in native histogram component %q", s)
+	}
+	schema, err := strconv.ParseInt(schemaStr, 10, 32)
+	if err != nil || schema < MinSchema || schema > MaxSchema {
+		return fmt.Errorf("cannot parse schema for native histogram component %q", s)
+	}
+	index, err := strconv.ParseInt(indexStr, 10, 32)
+	if err != nil {
+		return fmt.Errorf("cannot parse bucket index for native histogram component %q", s)
+	}
+	ck.Schema = int32(schema)
+	ck.Index = int32(index)
+	return nil
+}
+
+// BucketBounds returns (lower ... upper] bounds for the positive bucket with the given schema and index.
+//
+// The negative bucket with the same schema and index covers [-upper ... -lower) range.
+func BucketBounds(schema, index int32) (float64, float64) {
+	f := math.Exp2(-float64(schema))
+	lower := math.Exp2(float64(index-1) * f)
+	upper := math.Exp2(float64(index) * f)
+	return lower, upper
+}
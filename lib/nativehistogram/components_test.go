@@ -0,0 +1,167 @@
+package nativehistogram
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestAppendComponents(t *testing.T) {
+	f := func(h *prompb.Histogram, resultExpected []Component) {
+		t.Helper()
+		result, err := AppendComponents(nil, h)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected components\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// integer histogram with delta-encoded buckets
+	f(&prompb.Histogram{
+		Count:         10,
+		Sum:           12.5,
+		Schema:        1,
+		ZeroThreshold: 0.001,
+		ZeroCount:     1,
+		PositiveSpans: []prompb.BucketSpan{
+			{Offset: 0, Length: 2},
+			{Offset: 2, Length: 1},
+		},
+		PositiveDeltas: []int64{2, 1, -2},
+		NegativeSpans: []prompb.BucketSpan{
+			{Offset: -1, Length: 1},
+		},
+		NegativeDeltas: []int64{3},
+	}, []Component{
+		{Name: "count", Value: 10},
+		{Name: "sum", Value: 12.5},
+		{Name: "zero:0.001", Value: 1},
+		{Name: "pos:1:0", Value: 2},
+		{Name: "pos:1:1", Value: 3},
+		{Name: "pos:1:4", Value: 1},
+		{Name: "neg:1:-1", Value: 3},
+	})
+
+	// float histogram without zero bucket
+	f(&prompb.Histogram{
+		Count:  3.5,
+		Sum:    7,
+		Schema: 0,
+		PositiveSpans: []prompb.BucketSpan{
+			{Offset: 3, Length: 2},
+		},
+		PositiveCounts: []float64{1.5, 2},
+	}, []Component{
+		{Name: "count", Value: 3.5},
+		{Name: "sum", Value: 7},
+		{Name: "pos:0:3", Value: 1.5},
+		{Name: "pos:0:4", Value: 2},
+	})
+
+	// too big schema is reduced to MaxSchema
+	f(&prompb.Histogram{
+		Count:  6,
+		Sum:    10,
+		Schema: MaxSchema + 1,
+		PositiveSpans: []prompb.BucketSpan{
+			{Offset: 1, Length: 3},
+		},
+		PositiveCounts: []float64{1, 2, 3},
+	}, []Component{
+		{Name: "count", Value: 6},
+		{Name: "sum", Value: 10},
+		{Name: "pos:8:1", Value: 3},
+		{Name: "pos:8:2", Value: 3},
+	})
+}
+
+func TestAppendComponentsFailure(t *testing.T) {
+	f := func(schema int32) {
+		t.Helper()
+		h := &prompb.Histogram{
+			Count:  1,
+			Schema: schema,
+		}
+		if _, err := AppendComponents(nil, h); err == nil {
+			t.Fatalf("expecting non-nil error for schema %d", schema)
+		}
+	}
+	f(MinSchema - 1)
+
+	// custom buckets
+	f(-53)
+}
+
+func TestAppendExponentialComponents(t *testing.T) {
+	result, err := AppendExponentialComponents(nil, 7, 20, 2, 0, 1, -1, []uint64{1, 0, 2}, 0, []uint64{3})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resultExpected := []Component{
+		{Name: "count", Value: 7},
+		{Name: "sum", Value: 20},
+		{Name: "zero:0", Value: 1},
+		{Name: "pos:2:0", Value: 1},
+		{Name: "pos:2:1", Value: 0},
+		{Name: "pos:2:2", Value: 2},
+		{Name: "neg:2:1", Value: 3},
+	}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected components\ngot\n%v\nwant\n%v", result, resultExpected)
+	}
+}
+
+func TestParseComponentKeySuccess(t *testing.T) {
+	f := func(s string, ckExpected ComponentKey) {
+		t.Helper()
+		var ck ComponentKey
+		if err := ParseComponentKey(&ck, s); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ck != ckExpected {
+			t.Fatalf("unexpected key for %q; got %+v; want %+v", s, ck, ckExpected)
+		}
+	}
+	f("count", ComponentKey{Kind: ComponentKindCount})
+	f("sum", ComponentKey{Kind: ComponentKindSum})
+	f("zero:1e-05", ComponentKey{Kind: ComponentKindZero, ZeroThreshold: 1e-5})
+	f("pos:3:-12", ComponentKey{Kind: ComponentKindPositive, Schema: 3, Index: -12})
+	f("neg:-4:7", ComponentKey{Kind: ComponentKindNegative, Schema: -4, Index: 7})
+}
+
+func TestParseComponentKeyFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		var ck ComponentKey
+		if err := ParseComponentKey(&ck, s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+	f("")
+	f("foo")
+	f("zero:bar")
+	f("zero:-1")
+	f("pos:1")
+	f("pos:a:1")
+	f("neg:1:b")
+	f("pos:100:1")
+	f("bucket:1:1")
+}
+
+func TestBucketBounds(t *testing.T) {
+	f := func(schema, index int32, lowerExpected, upperExpected float64) {
+		t.Helper()
+		lower, upper := BucketBounds(schema, index)
+		if lower != lowerExpected || upper != upperExpected {
+			t.Fatalf("unexpected bounds for schema=%d, index=%d; got (%v...%v]; want (%v...%v]", schema, index, lower, upper, lowerExpected, upperExpected)
+		}
+	}
+	f(0, 0, 0.5, 1)
+	f(0, 3, 4, 8)
+	f(-1, 1, 1, 4)
+	f(1, 2, math.Exp2(0.5), 2)
+}
@@ -0,0 +1,282 @@
+package nativehistogram
+
+import (
+	"math"
+	"sort"
+)
+
+// Histogram is native histogram reconstructed from components.
+//
+// Call Reset, then Add for every component and then Normalize before using the histogram.
+type Histogram struct {
+	// Count is the total number of observations.
+	Count float64
+
+	// Sum is the sum of observations.
+	Sum float64
+
+	// Schema is the schema for PositiveBuckets and NegativeBuckets.
+	Schema int32
+
+	// ZeroThreshold is the threshold for the zero bucket.
+	ZeroThreshold float64
+
+	// ZeroCount is the number of observations in the zero bucket.
+	ZeroCount float64
+
+	// PositiveBuckets contains positive buckets sorted by index.
+	PositiveBuckets []Bucket
+
+	// NegativeBuckets contains negative buckets sorted by index.
+	NegativeBuckets []Bucket
+
+	hasCount   bool
+	hasSum     bool
+	hasBuckets bool
+}
+
+// Bucket is a single bucket of native histogram.
+type Bucket struct {
+	// Index is the bucket index.
+	Index int32
+
+	// Count is the number of observations in the bucket.
+	Count float64
+}
+
+// Reset resets h, so it can be re-used.
+func (h *Histogram) Reset() {
+	*h = Histogram{
+		PositiveBuckets: h.PositiveBuckets[:0],
+		NegativeBuckets: h.NegativeBuckets[:0],
+	}
+}
+
+// HasCount returns true if the count component has been added to h.
+func (h *Histogram) HasCount() bool {
+	return h.hasCount
+}
+
+// HasSum returns true if the sum component has been added to h.
+func (h *Histogram) HasSum() bool {
+	return h.hasSum
+}
+
+// IsEmpty returns true if no components have been added to h.
+func (h *Histogram) IsEmpty() bool {
+	return !h.hasCount && !h.hasSum && !h.hasBuckets
+}
+
+// Add adds the component with the given key and value v to h.
+//
+// Components with NaN values are ignored. Buckets with distinct schemas are converted to the smallest schema.
+func (h *Histogram) Add(ck *ComponentKey, v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	switch ck.Kind {
+	case ComponentKindCount:
+		h.Count += v
+		h.hasCount = true
+	case ComponentKindSum:
+		h.Sum += v
+		h.hasSum = true
+	case ComponentKindZero:
+		h.ZeroCount += v
+		h.ZeroThreshold = max(h.ZeroThreshold, ck.ZeroThreshold)
+		h.hasBuckets = true
+	case ComponentKindPositive, ComponentKindNegative:
+		if !h.hasBuckets || ck.Schema < h.Schema {
+			if h.hasBuckets {
+				d := uint(h.Schema - ck.Schema)
+				reduceBucketIndexes(h.PositiveBuckets, d)
+				reduceBucketIndexes(h.NegativeBuckets, d)
+			}
+			h.Schema = ck.Schema
+		}
+		h.hasBuckets = true
+		b := Bucket{
+			Index: reduceIndex(ck.Index, uint(ck.Schema-h.Schema)),
+			Count: v,
+		}
+		if ck.Kind == ComponentKindPositive {
+			h.PositiveBuckets = append(h.PositiveBuckets, b)
+		} else {
+			h.NegativeBuckets = append(h.NegativeBuckets, b)
+		}
+	}
+}
+
+func reduceBucketIndexes(buckets []Bucket, d uint) {
+	for i := range buckets {
+		buckets[i].Index = reduceIndex(buckets[i].Index, d)
+	}
+}
+
+// Normalize sorts buckets in h by index, merges buckets with identical indexes
+// and moves buckets, which fit the zero bucket, into the zero bucket.
+func (h *Histogram) Normalize() {
+	h.PositiveBuckets = h.normalizeBuckets(h.PositiveBuckets)
+	h.NegativeBuckets = h.normalizeBuckets(h.NegativeBuckets)
+}
+
+func (h *Histogram) normalizeBuckets(buckets []Bucket) []Bucket {
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Index < buckets[j].Index
+	})
+	dst := buckets[:0]
+	for _, b := range buckets {
+		if h.ZeroThreshold > 0 {
+			if _, upper := BucketBounds(h.Schema, b.Index); upper <= h.ZeroThreshold {
+				h.ZeroCount += b.Count
+				continue
+			}
+		}
+		if len(dst) > 0 && dst[len(dst)-1].Index == b.Index {
+			dst[len(dst)-1].Count += b.Count
+			continue
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// Quantile returns phi-quantile for h.
+//
+// The quantile is calculated in the same way as Prometheus does for native histograms:
+// exponential interpolation is used inside regular buckets, while linear interpolation is used inside the zero bucket.
+func (h *Histogram) Quantile(phi float64) float64 {
+	if math.IsNaN(phi) {
+		return math.NaN()
+	}
+	if phi < 0 {
+		return math.Inf(-1)
+	}
+	if phi > 1 {
+		return math.Inf(1)
+	}
+	total := h.bucketsTotal()
+	if total <= 0 {
+		return math.NaN()
+	}
+	rank := phi * total
+	cumulative := float64(0)
+	result := math.NaN()
+	h.visitBuckets(func(lower, upper, count float64, isZero bool) bool {
+		if count <= 0 {
+			return true
+		}
+		result = upper
+		if cumulative+count < rank {
+			cumulative += count
+			return true
+		}
+		fraction := (rank - cumulative) / count
+		result = interpolate(lower, upper, fraction, isZero)
+		return false
+	})
+	return result
+}
+
+// Fraction returns the estimated fraction of observations in h between lower and upper.
+func (h *Histogram) Fraction(lower, upper float64) float64 {
+	total := h.bucketsTotal()
+	if total <= 0 || math.IsNaN(lower) || math.IsNaN(upper) {
+		return math.NaN()
+	}
+	if lower >= upper {
+		return 0
+	}
+	return (h.rankAt(upper) - h.rankAt(lower)) / total
+}
+
+// rankAt returns the estimated number of observations in h, which are smaller or equal to x.
+func (h *Histogram) rankAt(x float64) float64 {
+	rank := float64(0)
+	h.visitBuckets(func(lower, upper, count float64, isZero bool) bool {
+		if x >= upper {
+			rank += count
+			return true
+		}
+		if x > lower {
+			rank += count * interpolationFraction(lower, upper, x, isZero)
+		}
+		return false
+	})
+	return rank
+}
+
+func (h *Histogram) bucketsTotal() float64 {
+	total := h.ZeroCount
+	for _, b := range h.PositiveBuckets {
+		total += b.Count
+	}
+	for _, b := range h.NegativeBuckets {
+		total += b.Count
+	}
+	return total
+}
+
+// visitBuckets calls f for all the buckets in h in ascending order of their bounds until f returns false.
+func (h *Histogram) visitBuckets(f func(lower, upper, count float64, isZero bool) bool) {
+	zt := h.ZeroThreshold
+	for i := len(h.NegativeBuckets) - 1; i >= 0; i-- {
+		b := h.NegativeBuckets[i]
+		lower, upper := BucketBounds(h.Schema, b.Index)
+		if lower < zt {
+			lower = zt
+		}
+		if !f(-upper, -lower, b.Count, false) {
+			return
+		}
+	}
+	if h.ZeroCount > 0 {
+		lower, upper := -zt, zt
+		// Observations in the zero bucket are likely to have the same sign as observations in other buckets.
+		if len(h.NegativeBuckets) == 0 && len(h.PositiveBuckets) > 0 {
+			lower = 0
+		} else if len(h.PositiveBuckets) == 0 && len(h.NegativeBuckets) > 0 {
+			upper = 0
+		}
+		if !f(lower, upper, h.ZeroCount, true) {
+			return
+		}
+	}
+	for _, b := range h.PositiveBuckets {
+		lower, upper := BucketBounds(h.Schema, b.Index)
+		if lower < zt {
+			lower = zt
+		}
+		if !f(lower, upper, b.Count, false) {
+			return
+		}
+	}
+}
+
+// interpolate returns the value at the given fraction of the bucket with the given bounds.
+func interpolate(lower, upper, fraction float64, isZero bool) float64 {
+	if isZero || lower == 0 || upper == 0 {
+		return lower + (upper-lower)*fraction
+	}
+	if upper > 0 {
+		logLower := math.Log2(lower)
+		return math.Exp2(logLower + (math.Log2(upper)-logLower)*fraction)
+	}
+	// Negative bucket
+	logLower := math.Log2(-lower)
+	return -math.Exp2(logLower + (math.Log2(-upper)-logLower)*fraction)
+}
+
+// interpolationFraction is the inverse of interpolate. It returns the fraction of the bucket with the given bounds, which is below x.
+func interpolationFraction(lower, upper, x float64, isZero bool) float64 {
+	if isZero || lower == 0 || upper == 0 {
+		return (x - lower) / (upper - lower)
+	}
+	if upper > 0 {
+		logLower := math.Log2(lower)
+		return (math.Log2(x) - logLower) / (math.Log2(upper) - logLower)
+	}
+	// Negative bucket
+	logLower := math.Log2(-lower)
+	return (math.Log2(-x) - logLower) / (math.Log2(-upper) - logLower)
+}
@@ -0,0 +1,131 @@
+package nativehistogram
+
+import (
+	"math"
+	"testing"
+)
+
+func newHistogram(t *testing.T, components []Component) *Histogram {
+	t.Helper()
+	var h Histogram
+	h.Reset()
+	for _, c := range components {
+		var ck ComponentKey
+		if err := ParseComponentKey(&ck, c.Name); err != nil {
+			t.Fatalf("cannot parse component %q: %s", c.Name, err)
+		}
+		h.Add(&ck, c.Value)
+	}
+	h.Normalize()
+	return &h
+}
+
+func TestHistogramAddDistinctSchemas(t *testing.T) {
+	h := newHistogram(t, []Component{
+		{Name: "count", Value: 6},
+		{Name: "count", Value: 4},
+		{Name: "pos:1:1", Value: 1},
+		{Name: "pos:1:2", Value: 2},
+		{Name: "pos:0:1", Value: 3},
+		{Name: "pos:1:4", Value: math.NaN()},
+		{Name: "neg:1:3", Value: 4},
+	})
+	if h.Count != 10 {
+		t.Fatalf("unexpected count; got %v; want 10", h.Count)
+	}
+	if h.Schema != 0 {
+		t.Fatalf("unexpected schema; got %d; want 0", h.Schema)
+	}
+	if len(h.PositiveBuckets) != 1 || h.PositiveBuckets[0] != (Bucket{Index: 1, Count: 6}) {
+		t.Fatalf("unexpected positive buckets: %v", h.PositiveBuckets)
+	}
+	if len(h.NegativeBuckets) != 1 || h.NegativeBuckets[0] != (Bucket{Index: 2, Count: 4}) {
+		t.Fatalf("unexpected negative buckets: %v", h.NegativeBuckets)
+	}
+}
+
+func TestHistogramNormalizeZeroBucket(t *testing.T) {
+	h := newHistogram(t, []Component{
+		{Name: "zero:0.5", Value: 1},
+		{Name: "pos:0:-1", Value: 2},
+		{Name: "pos:0:1", Value: 3},
+		{Name: "neg:0:-1", Value: 4},
+	})
+	if h.ZeroCount != 7 {
+		t.Fatalf("unexpected zero count; got %v; want 7", h.ZeroCount)
+	}
+	if len(h.PositiveBuckets) != 1 || len(h.NegativeBuckets) != 0 {
+		t.Fatalf("unexpected buckets; positive: %v; negative: %v", h.PositiveBuckets, h.NegativeBuckets)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := newHistogram(t, []Component{
+		{Name: "zero:0.001", Value: 2},
+		// (1...2]
+		{Name: "pos:0:1", Value: 4},
+		// (2...4]
+		{Name: "pos:0:2", Value: 2},
+		// [-4...-2)
+		{Name: "neg:0:2", Value: 2},
+	})
+
+	f := func(phi, resultExpected float64) {
+		t.Helper()
+		result := h.Quantile(phi)
+		if math.IsNaN(resultExpected) {
+			if !math.IsNaN(result) {
+				t.Fatalf("unexpected quantile for phi=%v; got %v; want NaN", phi, result)
+			}
+			return
+		}
+		if math.Abs(result-resultExpected) > 1e-12 {
+			t.Fatalf("unexpected quantile for phi=%v; got %v; want %v", phi, result, resultExpected)
+		}
+	}
+	f(math.NaN(), math.NaN())
+	f(-1, math.Inf(-1))
+	f(2, math.Inf(1))
+	f(0, -4)
+	f(0.1, -2*math.Sqrt2)
+	f(0.2, -2)
+	f(0.3, 0)
+	f(0.4, 0.001)
+	f(0.5, math.Pow(2, 0.25))
+	f(0.8, 2)
+	f(0.9, 2*math.Sqrt2)
+	f(1, 4)
+
+	var empty Histogram
+	if result := empty.Quantile(0.5); !math.IsNaN(result) {
+		t.Fatalf("unexpected quantile for empty histogram; got %v; want NaN", result)
+	}
+}
+
+func TestHistogramFraction(t *testing.T) {
+	h := newHistogram(t, []Component{
+		// (0.5...1]
+		{Name: "pos:0:0", Value: 2},
+		// (1...2]
+		{Name: "pos:0:1", Value: 2},
+	})
+
+	f := func(lower, upper, resultExpected float64) {
+		t.Helper()
+		result := h.Fraction(lower, upper)
+		if math.Abs(result-resultExpected) > 1e-12 {
+			t.Fatalf("unexpected fraction for (%v...%v]; got %v; want %v", lower, upper, result, resultExpected)
+		}
+	}
+	f(math.Inf(-1), math.Inf(1), 1)
+	f(0, 1, 0.5)
+	f(1, 2, 0.5)
+	f(math.Sqrt2, 2, 0.25)
+	f(2, 1, 0)
+	f(10, 20, 0)
+
+	var empty Histogram
+	if result := empty.Fraction(0, 1); !math.IsNaN(result) {
+		t.Fatalf("unexpected fraction for empty histogram; got %v; want NaN", result)
+	}
+}
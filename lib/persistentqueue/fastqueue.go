@@ -36,6 +36,9 @@ type FastQueue struct {
 	lastInmemoryBlockReadTime uint64
 
 	stopDeadline uint64
+
+	// readersPaused is set to true when MustReadBlock callers must wait until ResumeReaders call.
+	readersPaused bool
 }
 
 // MustOpenFastQueue opens persistent queue at the given path.
@@ -99,6 +102,30 @@ func (fq *FastQueue) UnblockAllReaders() {
 	fq.cond.Broadcast()
 }
 
+// PauseReaders makes MustReadBlock callers wait until ResumeReaders is called.
+//
+// Blocks can be read from fq via TryReadBlock while the readers are paused.
+// false is returned if the readers are already paused.
+func (fq *FastQueue) PauseReaders() bool {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	if fq.readersPaused {
+		return false
+	}
+	fq.readersPaused = true
+	return true
+}
+
+// ResumeReaders resumes the readers paused via PauseReaders.
+func (fq *FastQueue) ResumeReaders() {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	fq.readersPaused = false
+	fq.cond.Broadcast()
+}
+
 // MustClose unblocks all the readers.
 //
 // It is expected no new writers during and after the call.
@@ -224,6 +251,37 @@ func (fq *FastQueue) MustReadBlock(dst []byte) ([]byte, bool) {
 		if fq.stopDeadline > 0 && fasttime.UnixTimestamp() > fq.stopDeadline {
 			return dst, false
 		}
+		if fq.readersPaused && fq.stopDeadline == 0 {
+			fq.cond.Wait()
+			continue
+		}
+		data, ok := fq.readBlockLocked(dst)
+		if ok {
+			return data, true
+		}
+		dst = data
+		if fq.stopDeadline > 0 {
+			return dst, false
+		}
+		// There are no blocks. Wait for new block.
+		fq.pq.ResetIfEmpty()
+		fq.cond.Wait()
+	}
+}
+
+// TryReadBlock reads the next block from fq to dst and returns it.
+//
+// Unlike MustReadBlock, it doesn't wait for new blocks. false is returned if fq is empty.
+func (fq *FastQueue) TryReadBlock(dst []byte) ([]byte, bool) {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	return fq.readBlockLocked(dst)
+}
+
+func (fq *FastQueue) readBlockLocked(dst []byte) ([]byte, bool) {
+	// fq.mu must be locked by the caller.
+	for {
 		if len(fq.ch) > 0 {
 			if n := fq.pq.GetPendingBytes(); n > 0 {
 				logger.Panicf("BUG: the file-based queue must be empty when the inmemory queue is non-empty; it contains %d pending bytes", n)
@@ -243,13 +301,35 @@ func (fq *FastQueue) MustReadBlock(dst []byte) ([]byte, bool) {
 			dst = data
 			continue
 		}
-		if fq.stopDeadline > 0 {
-			return dst, false
+		return dst, false
+	}
+}
+
+// ForEachBlock calls f for every pending block in fq without removing blocks from fq.
+//
+// The iteration stops on the first error returned from f. f mustn't hold block after returning.
+// Blocks, which are read by concurrent readers during the iteration, may be skipped.
+func (fq *FastQueue) ForEachBlock(f func(block []byte) error) error {
+	fq.mu.Lock()
+	var inmemoryBlocks [][]byte
+	for i := len(fq.ch); i > 0; i-- {
+		// Rotate the in-memory queue in order to preserve the order of blocks in it.
+		bb := <-fq.ch
+		inmemoryBlocks = append(inmemoryBlocks, append([]byte{}, bb.B...))
+		fq.ch <- bb
+	}
+	qs := fq.pq.snapshot()
+	fq.mu.Unlock()
+
+	if err := qs.forEachBlock(f); err != nil {
+		return err
+	}
+	for _, block := range inmemoryBlocks {
+		if err := f(block); err != nil {
+			return err
 		}
-		// There are no blocks. Wait for new block.
-		fq.pq.ResetIfEmpty()
-		fq.cond.Wait()
 	}
+	return nil
 }
 
 // Dirname returns the directory name for persistent queue.
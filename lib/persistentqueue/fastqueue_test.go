@@ -2,6 +2,7 @@ package persistentqueue
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -193,6 +194,63 @@ func TestFastQueueReadUnblockByWrite(t *testing.T) {
 	fs.MustRemoveDir(path)
 }
 
+func TestFastQueuePauseReaders(t *testing.T) {
+	path := "fast-queue-pause-readers"
+	fs.MustRemoveDir(path)
+
+	fq := MustOpenFastQueue(path, "foobar", 13, 0, false)
+	if !fq.PauseReaders() {
+		t.Fatalf("PauseReaders must return true for non-paused readers")
+	}
+	if fq.PauseReaders() {
+		t.Fatalf("PauseReaders must return false for already paused readers")
+	}
+	block := "foodsafdsaf sdf"
+	if !fq.TryWriteBlock([]byte(block)) {
+		t.Fatalf("TryWriteBlock must return true in this context")
+	}
+	resultCh := make(chan error)
+	go func() {
+		data, ok := fq.MustReadBlock(nil)
+		if !ok {
+			resultCh <- fmt.Errorf("unexpected ok=false")
+			return
+		}
+		if string(data) != block {
+			resultCh <- fmt.Errorf("unexpected block read; got %q; want %q", data, block)
+			return
+		}
+		resultCh <- nil
+	}()
+	select {
+	case err := <-resultCh:
+		t.Fatalf("MustReadBlock must be blocked while the readers are paused; got err=%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// TryReadBlock must work while the readers are paused
+	data, ok := fq.TryReadBlock(nil)
+	if !ok {
+		t.Fatalf("unexpected ok=false")
+	}
+	if string(data) != block {
+		t.Fatalf("unexpected block read; got %q; want %q", data, block)
+	}
+	fq.MustWriteBlockIgnoreDisabledPQ(data)
+
+	fq.ResumeReaders()
+	select {
+	case err := <-resultCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+	fq.MustClose()
+	fs.MustRemoveDir(path)
+}
+
 func TestFastQueueReadWriteConcurrent(t *testing.T) {
 	path := "fast-queue-read-write-concurrent"
 	fs.MustRemoveDir(path)
@@ -368,3 +426,93 @@ func TestFastQueueWriteReadWithIgnoreDisabledPQ(t *testing.T) {
 	fq.MustClose()
 	fs.MustRemoveDir(path)
 }
+
+func TestFastQueueForEachBlock(t *testing.T) {
+	path := "fast-queue-for-each-block"
+	fs.MustRemoveDir(path)
+
+	capacity := 10
+	fq := MustOpenFastQueue(path, "foobar", capacity, 0, false)
+
+	f := func(blocksExpected []string) {
+		t.Helper()
+
+		var blocks []string
+		err := fq.ForEachBlock(func(block []byte) error {
+			blocks = append(blocks, string(block))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(blocks, blocksExpected) {
+			t.Fatalf("unexpected blocks\ngot\n%q\nwant\n%q", blocks, blocksExpected)
+		}
+	}
+
+	// empty queue
+	f(nil)
+
+	// in-memory blocks
+	var blocks []string
+	for i := 0; i < capacity; i++ {
+		block := fmt.Sprintf("block %d", i)
+		if !fq.TryWriteBlock([]byte(block)) {
+			t.Fatalf("TryWriteBlock must return true in this context")
+		}
+		blocks = append(blocks, block)
+	}
+	f(blocks)
+	if n := fq.GetInmemoryQueueLen(); n != capacity {
+		t.Fatalf("unexpected size of inmemory queue; got %d; want %d", n, capacity)
+	}
+
+	// file-based blocks
+	for i := capacity; i < 3*capacity; i++ {
+		block := fmt.Sprintf("block %d", i)
+		if !fq.TryWriteBlock([]byte(block)) {
+			t.Fatalf("TryWriteBlock must return true in this context")
+		}
+		blocks = append(blocks, block)
+	}
+	f(blocks)
+
+	// blocks must remain in the queue after the iteration
+	for _, block := range blocks[:5] {
+		buf, ok := fq.TryReadBlock(nil)
+		if !ok {
+			t.Fatalf("unexpected ok=false")
+		}
+		if string(buf) != block {
+			t.Fatalf("unexpected block read; got %q; want %q", buf, block)
+		}
+	}
+	f(blocks[5:])
+
+	// the iteration stops on error
+	errStop := fmt.Errorf("stop")
+	n := 0
+	err := fq.ForEachBlock(func(_ []byte) error {
+		n++
+		if n == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("unexpected error; got %v; want %v", err, errStop)
+	}
+
+	for range blocks[5:] {
+		if _, ok := fq.TryReadBlock(nil); !ok {
+			t.Fatalf("unexpected ok=false")
+		}
+	}
+	if _, ok := fq.TryReadBlock(nil); ok {
+		t.Fatalf("unexpected ok=true for empty queue")
+	}
+	f(nil)
+
+	fq.MustClose()
+	fs.MustRemoveDir(path)
+}
@@ -1,6 +1,7 @@
 package persistentqueue
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -334,7 +335,11 @@ func (q *queue) MustClose() {
 }
 
 func (q *queue) chunkFilePath(offset uint64) string {
-	return filepath.Join(q.dir, fmt.Sprintf("%016X", offset))
+	return getChunkFilePath(q.dir, offset)
+}
+
+func getChunkFilePath(dir string, offset uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016X", offset))
 }
 
 func (q *queue) metainfoPath() string {
@@ -626,6 +631,96 @@ func (q *queue) flushMetainfo() error {
 
 var headerBufPool bytesutil.ByteBufferPool
 
+// queueSnapshot contains the state of the queue needed for reading pending blocks without modifying the queue.
+type queueSnapshot struct {
+	dir           string
+	chunkFileSize uint64
+	maxBlockSize  uint64
+	readerOffset  uint64
+	writerOffset  uint64
+}
+
+// snapshot returns a snapshot of pending blocks at q.
+func (q *queue) snapshot() *queueSnapshot {
+	if q.writerOffset > q.writerFlushedOffset {
+		q.writer.MustFlush(false)
+		q.writerFlushedOffset = q.writerOffset
+	}
+	return &queueSnapshot{
+		dir:           q.dir,
+		chunkFileSize: q.chunkFileSize,
+		maxBlockSize:  q.maxBlockSize,
+		readerOffset:  q.readerOffset,
+		writerOffset:  q.writerOffset,
+	}
+}
+
+// forEachBlock calls f for every block in qs.
+//
+// Chunk files, which have been already removed by concurrent queue reader, are skipped.
+func (qs *queueSnapshot) forEachBlock(f func(block []byte) error) error {
+	var file *os.File
+	var br *bufio.Reader
+	defer func() {
+		if file != nil {
+			fs.MustClose(file)
+		}
+	}()
+	var header [8]byte
+	var block []byte
+	offset := qs.readerOffset
+	for offset < qs.writerOffset {
+		localOffset := offset % qs.chunkFileSize
+		if localOffset+qs.maxBlockSize+8 > qs.chunkFileSize {
+			// The remaining blocks are located in the next chunk file.
+			offset += qs.chunkFileSize - localOffset
+			if file != nil {
+				fs.MustClose(file)
+				file = nil
+			}
+			continue
+		}
+		if file == nil {
+			path := getChunkFilePath(qs.dir, offset-localOffset)
+			f, err := os.Open(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// The chunk file has been already read by concurrent reader.
+					offset += qs.chunkFileSize - localOffset
+					continue
+				}
+				return fmt.Errorf("cannot open chunk file: %w", err)
+			}
+			if _, err := f.Seek(int64(localOffset), io.SeekStart); err != nil {
+				fs.MustClose(f)
+				return fmt.Errorf("cannot seek to offset %d at %q: %w", localOffset, path, err)
+			}
+			file = f
+			if br == nil {
+				br = bufio.NewReaderSize(file, 64*1024)
+			} else {
+				br.Reset(file)
+			}
+		}
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return fmt.Errorf("cannot read block header from %q at offset %d: %w", file.Name(), localOffset, err)
+		}
+		blockLen := encoding.UnmarshalUint64(header[:])
+		if blockLen > qs.maxBlockSize {
+			return fmt.Errorf("too big block size read from %q at offset %d: %d bytes; cannot exceed %d bytes", file.Name(), localOffset, blockLen, qs.maxBlockSize)
+		}
+		block = bytesutil.ResizeNoCopyMayOverallocate(block, int(blockLen))
+		if _, err := io.ReadFull(br, block); err != nil {
+			return fmt.Errorf("cannot read block with size %d bytes from %q at offset %d: %w", blockLen, file.Name(), localOffset, err)
+		}
+		offset += 8 + blockLen
+		if err := f(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type metainfo struct {
 	Name         string
 	ReaderOffset uint64
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -390,3 +391,54 @@ func mustCreateEmptyMetainfo(path, name string) {
 		panic(fmt.Errorf("cannot create metainfo: %w", err))
 	}
 }
+
+func TestQueueSnapshotForEachBlock(t *testing.T) {
+	path := "queue-snapshot-for-each-block"
+	fs.MustRemoveDir(path)
+	const chunkFileSize = 100
+	const maxBlockSize = 20
+	q := mustOpenInternal(path, "foobar", chunkFileSize, maxBlockSize, 0)
+	defer fs.MustRemoveDir(path)
+	defer q.MustClose()
+
+	var blocks []string
+	for i := 0; i < 100; i++ {
+		block := fmt.Sprintf("block %d", i)
+		q.MustWriteBlock([]byte(block))
+		blocks = append(blocks, block)
+	}
+
+	// read a few blocks, so the first chunk files are removed
+	for _, block := range blocks[:20] {
+		data, ok := q.MustReadBlockNonblocking(nil)
+		if !ok {
+			t.Fatalf("unexpected ok=false")
+		}
+		if block != string(data) {
+			t.Fatalf("unexpected block read; got %q; want %q", data, block)
+		}
+	}
+	qs := q.snapshot()
+
+	// read more blocks after the snapshot is taken; they must be skipped
+	for range blocks[20:30] {
+		if _, ok := q.MustReadBlockNonblocking(nil); !ok {
+			t.Fatalf("unexpected ok=false")
+		}
+	}
+
+	var result []string
+	err := qs.forEachBlock(func(block []byte) error {
+		result = append(result, string(block))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(result) < len(blocks)-30 || len(result) > len(blocks)-20 {
+		t.Fatalf("unexpected number of blocks read; got %d; want from %d to %d", len(result), len(blocks)-30, len(blocks)-20)
+	}
+	if !reflect.DeepEqual(result, blocks[len(blocks)-len(result):]) {
+		t.Fatalf("unexpected blocks\ngot\n%q\nwant\n%q", result, blocks[len(blocks)-len(result):])
+	}
+}
@@ -0,0 +1,255 @@
+package prompb
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/easyproto"
+)
+
+// Histogram is Prometheus native histogram sample.
+//
+// See https://prometheus.io/docs/specs/native_histograms/
+type Histogram struct {
+	// Count is the total number of observations in the histogram.
+	Count float64
+
+	// Sum is the sum of observations in the histogram.
+	Sum float64
+
+	// Schema defines bucket boundaries. Bucket with index i covers the range (base^(i-1) ... base^i],
+	// where base = 2^(2^-Schema).
+	Schema int32
+
+	// ZeroThreshold is the upper bound of the zero bucket, which covers the range [-ZeroThreshold ... ZeroThreshold].
+	ZeroThreshold float64
+
+	// ZeroCount is the number of observations in the zero bucket.
+	ZeroCount float64
+
+	// NegativeSpans contains spans for negative buckets.
+	NegativeSpans []BucketSpan
+
+	// NegativeDeltas contains delta-encoded counts for negative buckets for integer histograms.
+	NegativeDeltas []int64
+
+	// NegativeCounts contains absolute counts for negative buckets for float histograms.
+	NegativeCounts []float64
+
+	// PositiveSpans contains spans for positive buckets.
+	PositiveSpans []BucketSpan
+
+	// PositiveDeltas contains delta-encoded counts for positive buckets for integer histograms.
+	PositiveDeltas []int64
+
+	// PositiveCounts contains absolute counts for positive buckets for float histograms.
+	PositiveCounts []float64
+
+	// Timestamp is unix timestamp for the histogram in milliseconds.
+	Timestamp int64
+}
+
+// BucketSpan defines a sequence of consecutive buckets in Histogram.
+type BucketSpan struct {
+	// Offset is the gap to the previous span, or the starting bucket index for the first span.
+	Offset int32
+
+	// Length is the number of consecutive buckets in the span.
+	Length uint32
+}
+
+// VisitPositiveBuckets calls f for every positive bucket in h in ascending order of bucket indexes.
+func (h *Histogram) VisitPositiveBuckets(f func(index int32, count float64)) {
+	visitBuckets(h.PositiveSpans, h.PositiveDeltas, h.PositiveCounts, f)
+}
+
+// VisitNegativeBuckets calls f for every negative bucket in h in ascending order of bucket indexes.
+func (h *Histogram) VisitNegativeBuckets(f func(index int32, count float64)) {
+	visitBuckets(h.NegativeSpans, h.NegativeDeltas, h.NegativeCounts, f)
+}
+
+func visitBuckets(spans []BucketSpan, deltas []int64, counts []float64, f func(index int32, count float64)) {
+	var index int32
+	var count int64
+	n := 0
+	for i, span := range spans {
+		if i == 0 {
+			index = span.Offset
+		} else {
+			index += span.Offset
+		}
+		for j := uint32(0); j < span.Length; j++ {
+			switch {
+			case n < len(deltas):
+				count += deltas[n]
+				f(index, float64(count))
+			case n < len(counts):
+				f(index, counts[n])
+			default:
+				// Malformed histogram with missing bucket counts.
+				return
+			}
+			n++
+			index++
+		}
+	}
+}
+
+func (h *Histogram) reset() {
+	*h = Histogram{
+		NegativeSpans:  h.NegativeSpans[:0],
+		NegativeDeltas: h.NegativeDeltas[:0],
+		NegativeCounts: h.NegativeCounts[:0],
+		PositiveSpans:  h.PositiveSpans[:0],
+		PositiveDeltas: h.PositiveDeltas[:0],
+		PositiveCounts: h.PositiveCounts[:0],
+	}
+}
+
+func (h *Histogram) unmarshalProtobuf(src []byte) (err error) {
+	// message Histogram {
+	//   oneof count {
+	//     uint64 count_int   = 1;
+	//     double count_float = 2;
+	//   }
+	//   double sum = 3;
+	//   sint32 schema = 4;
+	//   double zero_threshold = 5;
+	//   oneof zero_count {
+	//     uint64 zero_count_int   = 6;
+	//     double zero_count_float = 7;
+	//   }
+	//   repeated BucketSpan negative_spans = 8;
+	//   repeated sint64 negative_deltas = 9;
+	//   repeated double negative_counts = 10;
+	//   repeated BucketSpan positive_spans = 11;
+	//   repeated sint64 positive_deltas = 12;
+	//   repeated double positive_counts = 13;
+	//   ResetHint reset_hint = 14;
+	//   int64 timestamp = 15;
+	// }
+	h.reset()
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			n, ok := fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read count_int")
+			}
+			h.Count = float64(n)
+		case 2:
+			h.Count, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read count_float")
+			}
+		case 3:
+			h.Sum, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read sum")
+			}
+		case 4:
+			h.Schema, ok = fc.Sint32()
+			if !ok {
+				return fmt.Errorf("cannot read schema")
+			}
+		case 5:
+			h.ZeroThreshold, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read zero_threshold")
+			}
+		case 6:
+			n, ok := fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read zero_count_int")
+			}
+			h.ZeroCount = float64(n)
+		case 7:
+			h.ZeroCount, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read zero_count_float")
+			}
+		case 8:
+			h.NegativeSpans, err = appendBucketSpan(h.NegativeSpans, &fc)
+			if err != nil {
+				return fmt.Errorf("cannot read negative_spans: %w", err)
+			}
+		case 9:
+			h.NegativeDeltas, ok = fc.UnpackSint64s(h.NegativeDeltas)
+			if !ok {
+				return fmt.Errorf("cannot read negative_deltas")
+			}
+		case 10:
+			h.NegativeCounts, ok = fc.UnpackDoubles(h.NegativeCounts)
+			if !ok {
+				return fmt.Errorf("cannot read negative_counts")
+			}
+		case 11:
+			h.PositiveSpans, err = appendBucketSpan(h.PositiveSpans, &fc)
+			if err != nil {
+				return fmt.Errorf("cannot read positive_spans: %w", err)
+			}
+		case 12:
+			h.PositiveDeltas, ok = fc.UnpackSint64s(h.PositiveDeltas)
+			if !ok {
+				return fmt.Errorf("cannot read positive_deltas")
+			}
+		case 13:
+			h.PositiveCounts, ok = fc.UnpackDoubles(h.PositiveCounts)
+			if !ok {
+				return fmt.Errorf("cannot read positive_counts")
+			}
+		case 15:
+			h.Timestamp, ok = fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read timestamp")
+			}
+		}
+	}
+	return nil
+}
+
+func appendBucketSpan(dst []BucketSpan, fc *easyproto.FieldContext) ([]BucketSpan, error) {
+	data, ok := fc.MessageData()
+	if !ok {
+		return dst, fmt.Errorf("cannot read span data")
+	}
+	dst = append(dst, BucketSpan{})
+	span := &dst[len(dst)-1]
+	if err := span.unmarshalProtobuf(data); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (bs *BucketSpan) unmarshalProtobuf(src []byte) (err error) {
+	// message BucketSpan {
+	//   sint32 offset = 1;
+	//   uint32 length = 2;
+	// }
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			bs.Offset, ok = fc.Sint32()
+			if !ok {
+				return fmt.Errorf("cannot read offset")
+			}
+		case 2:
+			bs.Length, ok = fc.Uint32()
+			if !ok {
+				return fmt.Errorf("cannot read length")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package prompb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	promprompb "github.com/prometheus/prometheus/prompb"
+)
+
+func TestWriteRequestUnmarshalProtobufHistograms(t *testing.T) {
+	type bucket struct {
+		index int32
+		count float64
+	}
+	f := func(ph promprompb.Histogram, hExpected *Histogram, positiveExpected, negativeExpected []bucket) {
+		t.Helper()
+
+		pwr := promprompb.WriteRequest{
+			Timeseries: []promprompb.TimeSeries{
+				{
+					Labels:     []promprompb.Label{{Name: "__name__", Value: "foo"}},
+					Histograms: []promprompb.Histogram{ph},
+				},
+			},
+		}
+		data, err := pwr.Marshal()
+		if err != nil {
+			t.Fatalf("cannot marshal Prometheus WriteRequest: %s", err)
+		}
+		var wru WriteRequestUnmarshaler
+		wr, err := wru.UnmarshalProtobuf(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal WriteRequest: %s", err)
+		}
+		if len(wr.Timeseries) != 1 || len(wr.Timeseries[0].Histograms) != 1 {
+			t.Fatalf("unexpected WriteRequest: %#v", wr)
+		}
+		h := &wr.Timeseries[0].Histograms[0]
+		if !reflect.DeepEqual(h, hExpected) {
+			t.Fatalf("unexpected histogram\ngot\n%#v\nwant\n%#v", h, hExpected)
+		}
+
+		var positive, negative []bucket
+		h.VisitPositiveBuckets(func(index int32, count float64) {
+			positive = append(positive, bucket{index, count})
+		})
+		h.VisitNegativeBuckets(func(index int32, count float64) {
+			negative = append(negative, bucket{index, count})
+		})
+		if !reflect.DeepEqual(positive, positiveExpected) {
+			t.Fatalf("unexpected positive buckets\ngot\n%v\nwant\n%v", positive, positiveExpected)
+		}
+		if !reflect.DeepEqual(negative, negativeExpected) {
+			t.Fatalf("unexpected negative buckets\ngot\n%v\nwant\n%v", negative, negativeExpected)
+		}
+	}
+
+	// integer histogram
+	f(promprompb.FromIntHistogram(1000, &histogram.Histogram{
+		Count:           12,
+		Sum:             18.4,
+		Schema:          1,
+		ZeroThreshold:   0.001,
+		ZeroCount:       2,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}, {Offset: 1, Length: 2}},
+		PositiveBuckets: []int64{1, 1, -1, 0},
+		NegativeSpans:   []histogram.Span{{Offset: -2, Length: 1}},
+		NegativeBuckets: []int64{4},
+	}), &Histogram{
+		Count:          12,
+		Sum:            18.4,
+		Schema:         1,
+		ZeroThreshold:  0.001,
+		ZeroCount:      2,
+		NegativeSpans:  []BucketSpan{{Offset: -2, Length: 1}},
+		NegativeDeltas: []int64{4},
+		PositiveSpans:  []BucketSpan{{Offset: 0, Length: 2}, {Offset: 1, Length: 2}},
+		PositiveDeltas: []int64{1, 1, -1, 0},
+		Timestamp:      1000,
+	}, []bucket{{0, 1}, {1, 2}, {3, 1}, {4, 1}}, []bucket{{-2, 4}})
+
+	// float histogram
+	f(promprompb.FromFloatHistogram(2000, &histogram.FloatHistogram{
+		Count:           3.5,
+		Sum:             -1.5,
+		Schema:          -1,
+		PositiveSpans:   []histogram.Span{{Offset: 3, Length: 1}},
+		PositiveBuckets: []float64{1.5},
+		NegativeSpans:   []histogram.Span{{Offset: 1, Length: 2}},
+		NegativeBuckets: []float64{1, 1},
+	}), &Histogram{
+		Count:          3.5,
+		Sum:            -1.5,
+		Schema:         -1,
+		NegativeSpans:  []BucketSpan{{Offset: 1, Length: 2}},
+		NegativeCounts: []float64{1, 1},
+		PositiveSpans:  []BucketSpan{{Offset: 3, Length: 1}},
+		PositiveCounts: []float64{1.5},
+		Timestamp:      2000,
+	}, []bucket{{3, 1.5}}, []bucket{{1, 1}, {2, 1}})
+}
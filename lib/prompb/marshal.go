@@ -49,8 +49,44 @@ func (m *Sample) marshalToSizedBuffer(dst []byte) (int, error) {
 	return len(dst) - i, nil
 }
 
+func (m *Exemplar) marshalToSizedBuffer(dst []byte) (int, error) {
+	i := len(dst)
+	if m.Timestamp != 0 {
+		i = encodeVarint(dst, i, uint64(m.Timestamp))
+		i--
+		dst[i] = 0x18
+	}
+	if m.Value != 0 {
+		i -= 8
+		binary.LittleEndian.PutUint64(dst[i:], math.Float64bits(m.Value))
+		i--
+		dst[i] = 0x11
+	}
+	for j := len(m.Labels) - 1; j >= 0; j-- {
+		size, err := m.Labels[j].marshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0xa
+	}
+	return len(dst) - i, nil
+}
+
 func (m *TimeSeries) marshalToSizedBuffer(dst []byte) (int, error) {
 	i := len(dst)
+	for j := len(m.Exemplars) - 1; j >= 0; j-- {
+		size, err := m.Exemplars[j].marshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0x1a
+	}
 	for j := len(m.Samples) - 1; j >= 0; j-- {
 		size, err := m.Samples[j].marshalToSizedBuffer(dst[:i])
 		if err != nil {
@@ -118,6 +154,27 @@ func (m *TimeSeries) size() (n int) {
 		l := e.size()
 		n += 1 + l + sov(uint64(l))
 	}
+	for _, e := range m.Exemplars {
+		l := e.size()
+		n += 1 + l + sov(uint64(l))
+	}
+	return n
+}
+
+func (m *Exemplar) size() (n int) {
+	if m == nil {
+		return 0
+	}
+	for _, e := range m.Labels {
+		l := e.size()
+		n += 1 + l + sov(uint64(l))
+	}
+	if m.Value != 0 {
+		n += 9
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sov(uint64(m.Timestamp))
+	}
 	return n
 }
 
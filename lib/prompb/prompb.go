@@ -30,6 +30,31 @@ type TimeSeries struct {
 
 	// Samples is a list of samples for the given TimeSeries
 	Samples []Sample
+
+	// Exemplars is a list of exemplars for the given TimeSeries
+	Exemplars []Exemplar
+
+	// Histograms is a list of native histogram samples for the given TimeSeries
+	Histograms []Histogram
+
+	// CreatedTimestamp is unix timestamp in milliseconds when the given cumulative TimeSeries was created.
+	//
+	// It is set only for Prometheus remote write 2.0 requests. Zero means the timestamp is unknown.
+	CreatedTimestamp int64
+}
+
+// Exemplar is an exemplar attached to timeseries samples.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	// Labels is a list of exemplar labels such as trace_id.
+	Labels []Label
+
+	// Value is exemplar value.
+	Value float64
+
+	// Timestamp is unix timestamp for the exemplar in milliseconds.
+	Timestamp int64
 }
 
 // Sample is a timeseries sample.
@@ -82,6 +107,15 @@ type WriteRequestUnmarshaler struct {
 
 	labelsPool  []Label
 	samplesPool []Sample
+
+	exemplarsPool      []Exemplar
+	exemplarLabelsPool []Label
+
+	histogramsPool []Histogram
+
+	// symbols and refs are used for unmarshaling Prometheus remote write 2.0 requests.
+	symbols []string
+	refs    []uint32
 }
 
 func (wru *WriteRequestUnmarshaler) Reset() {
@@ -92,6 +126,20 @@ func (wru *WriteRequestUnmarshaler) Reset() {
 
 	clear(wru.samplesPool)
 	wru.samplesPool = wru.samplesPool[:0]
+
+	clear(wru.exemplarsPool)
+	wru.exemplarsPool = wru.exemplarsPool[:0]
+
+	clear(wru.exemplarLabelsPool)
+	wru.exemplarLabelsPool = wru.exemplarLabelsPool[:0]
+
+	// Do not clear histogramsPool items, since they do not refer to the unmarshaled data,
+	// while their buffers can be re-used.
+	wru.histogramsPool = wru.histogramsPool[:0]
+
+	clear(wru.symbols)
+	wru.symbols = wru.symbols[:0]
+	wru.refs = wru.refs[:0]
 }
 
 // UnmarshalProtobuf parses the given Protobuf-encoded `src` into an internal WriteRequest instance
@@ -114,8 +162,6 @@ func (wru *WriteRequestUnmarshaler) UnmarshalProtobuf(src []byte) (*WriteRequest
 	// }
 	tss := wru.wr.Timeseries
 	mds := wru.wr.Metadata
-	labelsPool := wru.labelsPool
-	samplesPool := wru.samplesPool
 	var fc easyproto.FieldContext
 	for len(src) > 0 {
 		src, err = fc.NextField(src)
@@ -134,8 +180,7 @@ func (wru *WriteRequestUnmarshaler) UnmarshalProtobuf(src []byte) (*WriteRequest
 				tss = append(tss, TimeSeries{})
 			}
 			ts := &tss[len(tss)-1]
-			labelsPool, samplesPool, err = ts.unmarshalProtobuf(data, labelsPool, samplesPool)
-			if err != nil {
+			if err := wru.unmarshalTimeSeries(ts, data); err != nil {
 				return nil, fmt.Errorf("cannot unmarshal timeseries: %w", err)
 			}
 		case 3:
@@ -157,30 +202,42 @@ func (wru *WriteRequestUnmarshaler) UnmarshalProtobuf(src []byte) (*WriteRequest
 	}
 	wru.wr.Timeseries = tss
 	wru.wr.Metadata = mds
-	wru.labelsPool = labelsPool
-	wru.samplesPool = samplesPool
 	return &wru.wr, nil
 }
 
-func (ts *TimeSeries) unmarshalProtobuf(src []byte, labelsPool []Label, samplesPool []Sample) ([]Label, []Sample, error) {
+func (wru *WriteRequestUnmarshaler) unmarshalTimeSeries(ts *TimeSeries, src []byte) error {
 	// message TimeSeries {
-	//   repeated Label labels   = 1;
-	//   repeated Sample samples = 2;
+	//   repeated Label labels       = 1;
+	//   repeated Sample samples     = 2;
+	//   repeated Exemplar exemplars = 3;
+	//   repeated Histogram histograms = 4;
 	// }
+	labelsPool := wru.labelsPool
+	samplesPool := wru.samplesPool
+	exemplarsPool := wru.exemplarsPool
 	labelsPoolLen := len(labelsPool)
 	samplesPoolLen := len(samplesPool)
+	exemplarsPoolLen := len(exemplarsPool)
+	histogramsPool := wru.histogramsPool
+	histogramsPoolLen := len(histogramsPool)
+	defer func() {
+		wru.labelsPool = labelsPool
+		wru.samplesPool = samplesPool
+		wru.exemplarsPool = exemplarsPool
+		wru.histogramsPool = histogramsPool
+	}()
 	var fc easyproto.FieldContext
 	for len(src) > 0 {
 		var err error
 		src, err = fc.NextField(src)
 		if err != nil {
-			return labelsPool, samplesPool, fmt.Errorf("cannot read the next field: %w", err)
+			return fmt.Errorf("cannot read the next field: %w", err)
 		}
 		switch fc.FieldNum {
 		case 1:
 			data, ok := fc.MessageData()
 			if !ok {
-				return labelsPool, samplesPool, fmt.Errorf("cannot read label data")
+				return fmt.Errorf("cannot read label data")
 			}
 			if len(labelsPool) < cap(labelsPool) {
 				labelsPool = labelsPool[:len(labelsPool)+1]
@@ -189,12 +246,12 @@ func (ts *TimeSeries) unmarshalProtobuf(src []byte, labelsPool []Label, samplesP
 			}
 			label := &labelsPool[len(labelsPool)-1]
 			if err := label.unmarshalProtobuf(data); err != nil {
-				return labelsPool, samplesPool, fmt.Errorf("cannot unmarshal label: %w", err)
+				return fmt.Errorf("cannot unmarshal label: %w", err)
 			}
 		case 2:
 			data, ok := fc.MessageData()
 			if !ok {
-				return labelsPool, samplesPool, fmt.Errorf("cannot read the sample data")
+				return fmt.Errorf("cannot read the sample data")
 			}
 			if len(samplesPool) < cap(samplesPool) {
 				samplesPool = samplesPool[:len(samplesPool)+1]
@@ -203,13 +260,97 @@ func (ts *TimeSeries) unmarshalProtobuf(src []byte, labelsPool []Label, samplesP
 			}
 			sample := &samplesPool[len(samplesPool)-1]
 			if err := sample.unmarshalProtobuf(data); err != nil {
-				return labelsPool, samplesPool, fmt.Errorf("cannot unmarshal sample: %w", err)
+				return fmt.Errorf("cannot unmarshal sample: %w", err)
+			}
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read the exemplar data")
+			}
+			if len(exemplarsPool) < cap(exemplarsPool) {
+				exemplarsPool = exemplarsPool[:len(exemplarsPool)+1]
+			} else {
+				exemplarsPool = append(exemplarsPool, Exemplar{})
+			}
+			exemplar := &exemplarsPool[len(exemplarsPool)-1]
+			wru.exemplarLabelsPool, err = exemplar.unmarshalProtobuf(data, wru.exemplarLabelsPool)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal exemplar: %w", err)
+			}
+		case 4:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read the histogram data")
+			}
+			if len(histogramsPool) < cap(histogramsPool) {
+				histogramsPool = histogramsPool[:len(histogramsPool)+1]
+			} else {
+				histogramsPool = append(histogramsPool, Histogram{})
+			}
+			h := &histogramsPool[len(histogramsPool)-1]
+			if err := h.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal histogram: %w", err)
 			}
 		}
 	}
 	ts.Labels = labelsPool[labelsPoolLen:]
 	ts.Samples = samplesPool[samplesPoolLen:]
-	return labelsPool, samplesPool, nil
+	if len(exemplarsPool) > exemplarsPoolLen {
+		ts.Exemplars = exemplarsPool[exemplarsPoolLen:]
+	}
+	if len(histogramsPool) > histogramsPoolLen {
+		ts.Histograms = histogramsPool[histogramsPoolLen:]
+	}
+	return nil
+}
+
+func (e *Exemplar) unmarshalProtobuf(src []byte, labelsPool []Label) ([]Label, error) {
+	// message Exemplar {
+	//   repeated Label labels = 1;
+	//   double value          = 2;
+	//   int64 timestamp       = 3;
+	// }
+	labelsPoolLen := len(labelsPool)
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return labelsPool, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return labelsPool, fmt.Errorf("cannot read label data")
+			}
+			if len(labelsPool) < cap(labelsPool) {
+				labelsPool = labelsPool[:len(labelsPool)+1]
+			} else {
+				labelsPool = append(labelsPool, Label{})
+			}
+			label := &labelsPool[len(labelsPool)-1]
+			if err := label.unmarshalProtobuf(data); err != nil {
+				return labelsPool, fmt.Errorf("cannot unmarshal label: %w", err)
+			}
+		case 2:
+			value, ok := fc.Double()
+			if !ok {
+				return labelsPool, fmt.Errorf("cannot read exemplar value")
+			}
+			e.Value = value
+		case 3:
+			timestamp, ok := fc.Int64()
+			if !ok {
+				return labelsPool, fmt.Errorf("cannot read exemplar timestamp")
+			}
+			e.Timestamp = timestamp
+		}
+	}
+	if len(labelsPool) > labelsPoolLen {
+		e.Labels = labelsPool[labelsPoolLen:]
+	}
+	return labelsPool, nil
 }
 
 func (lbl *Label) unmarshalProtobuf(src []byte) (err error) {
@@ -294,6 +435,30 @@ const (
 	MetricMetadataSTATESET MetricMetadataType = 7
 )
 
+// String returns Prometheus-compatible name for t.
+//
+// See https://github.com/prometheus/common/blob/95acce133ca2c07a966a71d475fb936fc282db18/model/metadata.go
+func (t MetricMetadataType) String() string {
+	switch t {
+	case MetricMetadataCOUNTER:
+		return "counter"
+	case MetricMetadataGAUGE:
+		return "gauge"
+	case MetricMetadataHISTOGRAM:
+		return "histogram"
+	case MetricMetadataGAUGEHISTOGRAM:
+		return "gaugehistogram"
+	case MetricMetadataSUMMARY:
+		return "summary"
+	case MetricMetadataINFO:
+		return "info"
+	case MetricMetadataSTATESET:
+		return "stateset"
+	default:
+		return "unknown"
+	}
+}
+
 // MetricMetadata represents additional meta information for specific MetricFamilyName
 // Refer to https://github.com/prometheus/prometheus/blob/c5282933765ec322a0664d0a0268f8276e83b156/prompb/types.proto#L21
 type MetricMetadata struct {
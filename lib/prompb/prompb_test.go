@@ -170,6 +170,54 @@ func TestWriteRequestMarshalUnmarshal(t *testing.T) {
 		},
 	})
 
+	// with exemplars
+	f(&prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []prompb.Label{
+					{
+						Name:  "__name__",
+						Value: "http_requests_total",
+					},
+				},
+				Samples: []prompb.Sample{
+					{
+						Value:     123,
+						Timestamp: 8939432423,
+					},
+				},
+				Exemplars: []prompb.Exemplar{
+					{
+						Labels: []prompb.Label{
+							{
+								Name:  "trace_id",
+								Value: "4bf92f3577b34da6a3ce929d0e0e4736",
+							},
+						},
+						Value:     0.25,
+						Timestamp: 8939432000,
+					},
+					{
+						Value: 1,
+					},
+				},
+			},
+			{
+				Labels: []prompb.Label{
+					{
+						Name:  "foo",
+						Value: "bar",
+					},
+				},
+				Samples: []prompb.Sample{
+					{
+						Value: 9873,
+					},
+				},
+			},
+		},
+	})
+
 	// only metadata
 	f(&prompb.WriteRequest{
 		Metadata: []prompb.MetricMetadata{
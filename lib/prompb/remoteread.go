@@ -0,0 +1,358 @@
+package prompb
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/easyproto"
+)
+
+// ReadRequest represents Prometheus remote read API request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/remote_read_api/
+type ReadRequest struct {
+	// Queries is a list of queries in the given ReadRequest
+	Queries []Query
+
+	// AcceptedResponseTypes is a list of response types the client can accept in the order of preference.
+	AcceptedResponseTypes []ReadResponseType
+}
+
+// ReadResponseType is the type of the response for ReadRequest.
+type ReadResponseType int32
+
+const (
+	// ReadResponseTypeSamples means the response must be ReadResponse with raw samples.
+	ReadResponseTypeSamples = ReadResponseType(0)
+
+	// ReadResponseTypeStreamedXORChunks means the response must be a stream of ChunkedReadResponse messages with XOR-encoded chunks.
+	ReadResponseTypeStreamedXORChunks = ReadResponseType(1)
+)
+
+// Query is a query for ReadRequest.
+type Query struct {
+	// StartTimestampMs is the start timestamp for the query in milliseconds.
+	StartTimestampMs int64
+
+	// EndTimestampMs is the end timestamp for the query in milliseconds.
+	EndTimestampMs int64
+
+	// Matchers is a list of label matchers for the query.
+	Matchers []LabelMatcher
+}
+
+// LabelMatcherType is the type of LabelMatcher.
+type LabelMatcherType int32
+
+const (
+	// LabelMatcherEQ is `name="value"` matcher.
+	LabelMatcherEQ = LabelMatcherType(0)
+
+	// LabelMatcherNEQ is `name!="value"` matcher.
+	LabelMatcherNEQ = LabelMatcherType(1)
+
+	// LabelMatcherRE is `name=~"value"` matcher.
+	LabelMatcherRE = LabelMatcherType(2)
+
+	// LabelMatcherNRE is `name!~"value"` matcher.
+	LabelMatcherNRE = LabelMatcherType(3)
+)
+
+// LabelMatcher is a label matcher for Query.
+type LabelMatcher struct {
+	// Type is the matcher type.
+	Type LabelMatcherType
+
+	// Name is label name to match.
+	Name string
+
+	// Value is label value or regexp to match.
+	Value string
+}
+
+// UnmarshalProtobuf unmarshals rr from protobuf message at src.
+//
+// rr refers to src after the return, so src mustn't be modified while rr is in use.
+func (rr *ReadRequest) UnmarshalProtobuf(src []byte) (err error) {
+	rr.Queries = rr.Queries[:0]
+	rr.AcceptedResponseTypes = rr.AcceptedResponseTypes[:0]
+
+	// message ReadRequest {
+	//   repeated Query queries = 1;
+	//   repeated ResponseType accepted_response_types = 2;
+	// }
+	var responseTypes []int32
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read query data")
+			}
+			rr.Queries = append(rr.Queries, Query{})
+			q := &rr.Queries[len(rr.Queries)-1]
+			if err := q.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal query: %w", err)
+			}
+		case 2:
+			var ok bool
+			responseTypes, ok = fc.UnpackInt32s(responseTypes[:0])
+			if !ok {
+				return fmt.Errorf("cannot read accepted_response_types")
+			}
+			for _, rt := range responseTypes {
+				rr.AcceptedResponseTypes = append(rr.AcceptedResponseTypes, ReadResponseType(rt))
+			}
+		}
+	}
+	return nil
+}
+
+func (q *Query) unmarshalProtobuf(src []byte) (err error) {
+	// message Query {
+	//   int64 start_timestamp_ms = 1;
+	//   int64 end_timestamp_ms = 2;
+	//   repeated LabelMatcher matchers = 3;
+	//   ReadHints hints = 4;
+	// }
+	//
+	// Hints are ignored, since they are optional and the response must be the same without them.
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			ts, ok := fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read start_timestamp_ms")
+			}
+			q.StartTimestampMs = ts
+		case 2:
+			ts, ok := fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read end_timestamp_ms")
+			}
+			q.EndTimestampMs = ts
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read matcher data")
+			}
+			q.Matchers = append(q.Matchers, LabelMatcher{})
+			lm := &q.Matchers[len(q.Matchers)-1]
+			if err := lm.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal matcher: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (lm *LabelMatcher) unmarshalProtobuf(src []byte) (err error) {
+	// message LabelMatcher {
+	//   Type type = 1;
+	//   string name = 2;
+	//   string value = 3;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			t, ok := fc.Int32()
+			if !ok {
+				return fmt.Errorf("cannot read matcher type")
+			}
+			if t < int32(LabelMatcherEQ) || t > int32(LabelMatcherNRE) {
+				return fmt.Errorf("unsupported matcher type: %d", t)
+			}
+			lm.Type = LabelMatcherType(t)
+		case 2:
+			name, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read matcher name")
+			}
+			lm.Name = name
+		case 3:
+			value, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read matcher value")
+			}
+			lm.Value = value
+		}
+	}
+	return nil
+}
+
+// MarshalProtobuf marshals rr to protobuf message, appends it to dst and returns the result.
+func (rr *ReadRequest) MarshalProtobuf(dst []byte) []byte {
+	m := mp.Get()
+	mm := m.MessageMarshaler()
+	for i := range rr.Queries {
+		q := &rr.Queries[i]
+		qm := mm.AppendMessage(1)
+		qm.AppendInt64(1, q.StartTimestampMs)
+		qm.AppendInt64(2, q.EndTimestampMs)
+		for j := range q.Matchers {
+			lm := &q.Matchers[j]
+			lmm := qm.AppendMessage(3)
+			lmm.AppendInt32(1, int32(lm.Type))
+			lmm.AppendString(2, lm.Name)
+			lmm.AppendString(3, lm.Value)
+		}
+	}
+	if len(rr.AcceptedResponseTypes) > 0 {
+		responseTypes := make([]int32, len(rr.AcceptedResponseTypes))
+		for i, rt := range rr.AcceptedResponseTypes {
+			responseTypes[i] = int32(rt)
+		}
+		mm.AppendInt32s(2, responseTypes)
+	}
+	dst = m.Marshal(dst)
+	mp.Put(m)
+	return dst
+}
+
+// ReadResponse is a response for ReadRequest with ReadResponseTypeSamples.
+type ReadResponse struct {
+	// Results contains results for ReadRequest.Queries in the same order.
+	Results []QueryResult
+}
+
+// QueryResult is a result for a single Query.
+type QueryResult struct {
+	// Timeseries contains the matching time series with samples.
+	Timeseries []TimeSeries
+}
+
+// MarshalProtobuf marshals rr to protobuf message, appends it to dst and returns the result.
+func (rr *ReadResponse) MarshalProtobuf(dst []byte) []byte {
+	// message ReadResponse {
+	//   repeated QueryResult results = 1;
+	// }
+	//
+	// message QueryResult {
+	//   repeated prometheus.TimeSeries timeseries = 1;
+	// }
+	m := mp.Get()
+	mm := m.MessageMarshaler()
+	for i := range rr.Results {
+		qr := &rr.Results[i]
+		qrm := mm.AppendMessage(1)
+		for j := range qr.Timeseries {
+			ts := &qr.Timeseries[j]
+			tsm := qrm.AppendMessage(1)
+			for k := range ts.Labels {
+				marshalLabel(tsm.AppendMessage(1), &ts.Labels[k])
+			}
+			for k := range ts.Samples {
+				s := &ts.Samples[k]
+				sm := tsm.AppendMessage(2)
+				sm.AppendDouble(1, s.Value)
+				sm.AppendInt64(2, s.Timestamp)
+			}
+		}
+	}
+	dst = m.Marshal(dst)
+	mp.Put(m)
+	return dst
+}
+
+// ChunkedReadResponse is a single frame of the response for ReadRequest with ReadResponseTypeStreamedXORChunks.
+type ChunkedReadResponse struct {
+	// ChunkedSeries contains series with chunks.
+	ChunkedSeries []ChunkedSeries
+
+	// QueryIndex is the index of ReadRequest.Queries item the response belongs to.
+	QueryIndex int64
+}
+
+// ChunkedSeries is a series with chunks.
+type ChunkedSeries struct {
+	// Labels is a list of labels for the series.
+	Labels []Label
+
+	// Chunks is a list of chunks for the series sorted by time.
+	Chunks []Chunk
+}
+
+// ChunkEncoding is the encoding type for Chunk.
+type ChunkEncoding int32
+
+const (
+	// ChunkEncodingXOR is XOR encoding for float samples used by Prometheus.
+	ChunkEncodingXOR = ChunkEncoding(1)
+)
+
+// Chunk is a chunk of samples for ChunkedSeries.
+type Chunk struct {
+	// MinTimeMs is the minimum sample timestamp in the chunk.
+	MinTimeMs int64
+
+	// MaxTimeMs is the maximum sample timestamp in the chunk.
+	MaxTimeMs int64
+
+	// Type is chunk encoding type.
+	Type ChunkEncoding
+
+	// Data is encoded chunk data.
+	Data []byte
+}
+
+// MarshalProtobuf marshals crr to protobuf message, appends it to dst and returns the result.
+func (crr *ChunkedReadResponse) MarshalProtobuf(dst []byte) []byte {
+	// message ChunkedReadResponse {
+	//   repeated prometheus.ChunkedSeries chunked_series = 1;
+	//   int64 query_index = 2;
+	// }
+	//
+	// message ChunkedSeries {
+	//   repeated Label labels = 1;
+	//   repeated Chunk chunks = 2;
+	// }
+	//
+	// message Chunk {
+	//   int64 min_time_ms = 1;
+	//   int64 max_time_ms = 2;
+	//   Encoding type = 3;
+	//   bytes data = 4;
+	// }
+	m := mp.Get()
+	mm := m.MessageMarshaler()
+	for i := range crr.ChunkedSeries {
+		cs := &crr.ChunkedSeries[i]
+		csm := mm.AppendMessage(1)
+		for j := range cs.Labels {
+			marshalLabel(csm.AppendMessage(1), &cs.Labels[j])
+		}
+		for j := range cs.Chunks {
+			c := &cs.Chunks[j]
+			cm := csm.AppendMessage(2)
+			cm.AppendInt64(1, c.MinTimeMs)
+			cm.AppendInt64(2, c.MaxTimeMs)
+			cm.AppendInt32(3, int32(c.Type))
+			cm.AppendBytes(4, c.Data)
+		}
+	}
+	mm.AppendInt64(2, crr.QueryIndex)
+	dst = m.Marshal(dst)
+	mp.Put(m)
+	return dst
+}
+
+func marshalLabel(mm *easyproto.MessageMarshaler, label *Label) {
+	mm.AppendString(1, label.Name)
+	mm.AppendString(2, label.Value)
+}
+
+var mp easyproto.MarshalerPool
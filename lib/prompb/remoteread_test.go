@@ -0,0 +1,156 @@
+package prompb
+
+import (
+	"reflect"
+	"testing"
+
+	promprompb "github.com/prometheus/prometheus/prompb"
+)
+
+func TestReadRequestUnmarshalProtobuf(t *testing.T) {
+	f := func(prr *promprompb.ReadRequest, rrExpected *ReadRequest) {
+		t.Helper()
+
+		data, err := prr.Marshal()
+		if err != nil {
+			t.Fatalf("cannot marshal Prometheus ReadRequest: %s", err)
+		}
+		var rr ReadRequest
+		if err := rr.UnmarshalProtobuf(data); err != nil {
+			t.Fatalf("cannot unmarshal ReadRequest: %s", err)
+		}
+		if !reflect.DeepEqual(&rr, rrExpected) {
+			t.Fatalf("unexpected ReadRequest\ngot\n%#v\nwant\n%#v", &rr, rrExpected)
+		}
+
+		// Verify MarshalProtobuf produces the message, which can be unmarshaled by Prometheus
+		data = rr.MarshalProtobuf(nil)
+		var prrResult promprompb.ReadRequest
+		if err := prrResult.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal Prometheus ReadRequest: %s", err)
+		}
+		if !reflect.DeepEqual(&prrResult, prr) {
+			t.Fatalf("unexpected Prometheus ReadRequest\ngot\n%#v\nwant\n%#v", &prrResult, prr)
+		}
+	}
+
+	f(&promprompb.ReadRequest{}, &ReadRequest{})
+	f(&promprompb.ReadRequest{
+		Queries: []*promprompb.Query{
+			{
+				StartTimestampMs: 1000,
+				EndTimestampMs:   2000,
+				Matchers: []*promprompb.LabelMatcher{
+					{Type: promprompb.LabelMatcher_EQ, Name: "__name__", Value: "foo"},
+					{Type: promprompb.LabelMatcher_NRE, Name: "job", Value: "bar.+"},
+				},
+			},
+			{
+				StartTimestampMs: 3000,
+				EndTimestampMs:   4000,
+				Matchers: []*promprompb.LabelMatcher{
+					{Type: promprompb.LabelMatcher_NEQ, Name: "a", Value: "b"},
+					{Type: promprompb.LabelMatcher_RE, Name: "c", Value: "d|e"},
+				},
+			},
+		},
+		AcceptedResponseTypes: []promprompb.ReadRequest_ResponseType{
+			promprompb.ReadRequest_STREAMED_XOR_CHUNKS,
+			promprompb.ReadRequest_SAMPLES,
+		},
+	}, &ReadRequest{
+		Queries: []Query{
+			{
+				StartTimestampMs: 1000,
+				EndTimestampMs:   2000,
+				Matchers: []LabelMatcher{
+					{Type: LabelMatcherEQ, Name: "__name__", Value: "foo"},
+					{Type: LabelMatcherNRE, Name: "job", Value: "bar.+"},
+				},
+			},
+			{
+				StartTimestampMs: 3000,
+				EndTimestampMs:   4000,
+				Matchers: []LabelMatcher{
+					{Type: LabelMatcherNEQ, Name: "a", Value: "b"},
+					{Type: LabelMatcherRE, Name: "c", Value: "d|e"},
+				},
+			},
+		},
+		AcceptedResponseTypes: []ReadResponseType{ReadResponseTypeStreamedXORChunks, ReadResponseTypeSamples},
+	})
+}
+
+func TestReadResponseMarshalProtobuf(t *testing.T) {
+	rr := &ReadResponse{
+		Results: []QueryResult{
+			{
+				Timeseries: []TimeSeries{
+					{
+						Labels:  []Label{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "bar"}},
+						Samples: []Sample{{Value: 1, Timestamp: 1000}, {Value: 2.5, Timestamp: 2000}},
+					},
+				},
+			},
+			{},
+		},
+	}
+	data := rr.MarshalProtobuf(nil)
+
+	var prr promprompb.ReadResponse
+	if err := prr.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal Prometheus ReadResponse: %s", err)
+	}
+	prrExpected := promprompb.ReadResponse{
+		Results: []*promprompb.QueryResult{
+			{
+				Timeseries: []*promprompb.TimeSeries{
+					{
+						Labels:  []promprompb.Label{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "bar"}},
+						Samples: []promprompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 2.5, Timestamp: 2000}},
+					},
+				},
+			},
+			{},
+		},
+	}
+	if !reflect.DeepEqual(&prr, &prrExpected) {
+		t.Fatalf("unexpected Prometheus ReadResponse\ngot\n%#v\nwant\n%#v", &prr, &prrExpected)
+	}
+}
+
+func TestChunkedReadResponseMarshalProtobuf(t *testing.T) {
+	crr := &ChunkedReadResponse{
+		ChunkedSeries: []ChunkedSeries{
+			{
+				Labels: []Label{{Name: "__name__", Value: "foo"}},
+				Chunks: []Chunk{
+					{MinTimeMs: 1000, MaxTimeMs: 2000, Type: ChunkEncodingXOR, Data: []byte("abc")},
+					{MinTimeMs: 3000, MaxTimeMs: 3000, Type: ChunkEncodingXOR, Data: []byte("de")},
+				},
+			},
+		},
+		QueryIndex: 3,
+	}
+	data := crr.MarshalProtobuf(nil)
+
+	var pcrr promprompb.ChunkedReadResponse
+	if err := pcrr.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal Prometheus ChunkedReadResponse: %s", err)
+	}
+	pcrrExpected := promprompb.ChunkedReadResponse{
+		ChunkedSeries: []*promprompb.ChunkedSeries{
+			{
+				Labels: []promprompb.Label{{Name: "__name__", Value: "foo"}},
+				Chunks: []promprompb.Chunk{
+					{MinTimeMs: 1000, MaxTimeMs: 2000, Type: promprompb.Chunk_XOR, Data: []byte("abc")},
+					{MinTimeMs: 3000, MaxTimeMs: 3000, Type: promprompb.Chunk_XOR, Data: []byte("de")},
+				},
+			},
+		},
+		QueryIndex: 3,
+	}
+	if !reflect.DeepEqual(&pcrr, &pcrrExpected) {
+		t.Fatalf("unexpected Prometheus ChunkedReadResponse\ngot\n%#v\nwant\n%#v", &pcrr, &pcrrExpected)
+	}
+}
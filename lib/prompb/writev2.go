@@ -0,0 +1,490 @@
+package prompb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/easyproto"
+)
+
+// UnmarshalProtobufV2 parses the given Protobuf-encoded Prometheus remote write 2.0 request in `src`
+// into an internal WriteRequest instance and returns a pointer to it.
+//
+// Label and exemplar label references are resolved via the request symbols table,
+// while per-series metadata is converted into WriteRequest.Metadata.
+//
+// See https://prometheus.io/docs/specs/prw/remote_write_spec_2_0/
+//
+// The same notes as for UnmarshalProtobuf apply to the returned WriteRequest.
+func (wru *WriteRequestUnmarshaler) UnmarshalProtobufV2(src []byte) (*WriteRequest, error) {
+	wru.Reset()
+
+	// message Request {
+	//   reserved 1 to 3;
+	//   repeated string symbols = 4;
+	//   repeated TimeSeries timeseries = 5;
+	// }
+	//
+	// Symbols must be read before timeseries, since timeseries refer to them.
+	// Protobuf doesn't guarantee the order of fields, so read src in two passes.
+	symbols := wru.symbols[:0]
+	var fc easyproto.FieldContext
+	var err error
+	tail := src
+	for len(tail) > 0 {
+		tail, err = fc.NextField(tail)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		if fc.FieldNum == 4 {
+			symbol, ok := fc.String()
+			if !ok {
+				return nil, fmt.Errorf("cannot read symbol")
+			}
+			symbols = append(symbols, symbol)
+		}
+	}
+	wru.symbols = symbols
+	if len(symbols) > 0 && symbols[0] != "" {
+		return nil, fmt.Errorf("the first item in symbols table must be an empty string; got %q", symbols[0])
+	}
+
+	tss := wru.wr.Timeseries
+	mms := wru.wr.Metadata
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		if fc.FieldNum != 5 {
+			continue
+		}
+		data, ok := fc.MessageData()
+		if !ok {
+			return nil, fmt.Errorf("cannot read timeseries data")
+		}
+		if len(tss) < cap(tss) {
+			tss = tss[:len(tss)+1]
+		} else {
+			tss = append(tss, TimeSeries{})
+		}
+		ts := &tss[len(tss)-1]
+		var md MetricMetadata
+		if err := wru.unmarshalTimeSeriesV2(ts, &md, data); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal timeseries: %w", err)
+		}
+		if md.Type == 0 && md.Help == "" && md.Unit == "" {
+			continue
+		}
+		md.MetricFamilyName = getMetricName(ts.Labels)
+		if len(mms) > 0 && mms[len(mms)-1] == md {
+			// Series of the same metric usually go one after another and share the same metadata.
+			continue
+		}
+		mms = append(mms, md)
+	}
+	wru.wr.Timeseries = tss
+	wru.wr.Metadata = mms
+	return &wru.wr, nil
+}
+
+func (wru *WriteRequestUnmarshaler) unmarshalTimeSeriesV2(ts *TimeSeries, md *MetricMetadata, src []byte) (err error) {
+	// message TimeSeries {
+	//   repeated uint32 labels_refs = 1;
+	//   repeated Sample samples = 2;
+	//   repeated Histogram histograms = 3;
+	//   repeated Exemplar exemplars = 4;
+	//   Metadata metadata = 5;
+	//   int64 created_timestamp = 6;
+	// }
+	labelsPool := wru.labelsPool
+	samplesPool := wru.samplesPool
+	exemplarsPool := wru.exemplarsPool
+	histogramsPool := wru.histogramsPool
+	labelsPoolLen := len(labelsPool)
+	samplesPoolLen := len(samplesPool)
+	exemplarsPoolLen := len(exemplarsPool)
+	histogramsPoolLen := len(histogramsPool)
+	defer func() {
+		wru.labelsPool = labelsPool
+		wru.samplesPool = samplesPool
+		wru.exemplarsPool = exemplarsPool
+		wru.histogramsPool = histogramsPool
+	}()
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			wru.refs, ok = fc.UnpackUint32s(wru.refs[:0])
+			if !ok {
+				return fmt.Errorf("cannot read labels_refs")
+			}
+			labelsPool, err = wru.appendLabelsByRefs(labelsPool, wru.refs)
+			if err != nil {
+				return fmt.Errorf("cannot read labels: %w", err)
+			}
+		case 2:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read the sample data")
+			}
+			if len(samplesPool) < cap(samplesPool) {
+				samplesPool = samplesPool[:len(samplesPool)+1]
+			} else {
+				samplesPool = append(samplesPool, Sample{})
+			}
+			sample := &samplesPool[len(samplesPool)-1]
+			if err := sample.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal sample: %w", err)
+			}
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read the histogram data")
+			}
+			if len(histogramsPool) < cap(histogramsPool) {
+				histogramsPool = histogramsPool[:len(histogramsPool)+1]
+			} else {
+				histogramsPool = append(histogramsPool, Histogram{})
+			}
+			h := &histogramsPool[len(histogramsPool)-1]
+			if err := h.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal histogram: %w", err)
+			}
+		case 4:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read the exemplar data")
+			}
+			if len(exemplarsPool) < cap(exemplarsPool) {
+				exemplarsPool = exemplarsPool[:len(exemplarsPool)+1]
+			} else {
+				exemplarsPool = append(exemplarsPool, Exemplar{})
+			}
+			exemplar := &exemplarsPool[len(exemplarsPool)-1]
+			if err := wru.unmarshalExemplarV2(exemplar, data); err != nil {
+				return fmt.Errorf("cannot unmarshal exemplar: %w", err)
+			}
+		case 5:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read the metadata")
+			}
+			if err := wru.unmarshalMetadataV2(md, data); err != nil {
+				return fmt.Errorf("cannot unmarshal metadata: %w", err)
+			}
+		case 6:
+			ts.CreatedTimestamp, ok = fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read created_timestamp")
+			}
+		}
+	}
+	ts.Labels = labelsPool[labelsPoolLen:]
+	ts.Samples = samplesPool[samplesPoolLen:]
+	if len(exemplarsPool) > exemplarsPoolLen {
+		ts.Exemplars = exemplarsPool[exemplarsPoolLen:]
+	}
+	if len(histogramsPool) > histogramsPoolLen {
+		ts.Histograms = histogramsPool[histogramsPoolLen:]
+	}
+	return nil
+}
+
+func (wru *WriteRequestUnmarshaler) unmarshalExemplarV2(e *Exemplar, src []byte) (err error) {
+	// message Exemplar {
+	//   repeated uint32 labels_refs = 1;
+	//   double value = 2;
+	//   int64 timestamp = 3;
+	// }
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			wru.refs, ok = fc.UnpackUint32s(wru.refs[:0])
+			if !ok {
+				return fmt.Errorf("cannot read labels_refs")
+			}
+			labelsPoolLen := len(wru.exemplarLabelsPool)
+			wru.exemplarLabelsPool, err = wru.appendLabelsByRefs(wru.exemplarLabelsPool, wru.refs)
+			if err != nil {
+				return fmt.Errorf("cannot read labels: %w", err)
+			}
+			e.Labels = wru.exemplarLabelsPool[labelsPoolLen:]
+		case 2:
+			e.Value, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar value")
+			}
+		case 3:
+			e.Timestamp, ok = fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar timestamp")
+			}
+		}
+	}
+	return nil
+}
+
+func (wru *WriteRequestUnmarshaler) unmarshalMetadataV2(md *MetricMetadata, src []byte) (err error) {
+	// message Metadata {
+	//   MetricType type = 1;
+	//   uint32 help_ref = 3;
+	//   uint32 unit_ref = 4;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			value, ok := fc.Uint32()
+			if !ok {
+				return fmt.Errorf("cannot read metric type")
+			}
+			md.Type = value
+		case 3:
+			ref, ok := fc.Uint32()
+			if !ok {
+				return fmt.Errorf("cannot read help_ref")
+			}
+			md.Help, err = wru.getSymbol(ref)
+			if err != nil {
+				return fmt.Errorf("cannot read help: %w", err)
+			}
+		case 4:
+			ref, ok := fc.Uint32()
+			if !ok {
+				return fmt.Errorf("cannot read unit_ref")
+			}
+			md.Unit, err = wru.getSymbol(ref)
+			if err != nil {
+				return fmt.Errorf("cannot read unit: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (wru *WriteRequestUnmarshaler) appendLabelsByRefs(dst []Label, refs []uint32) ([]Label, error) {
+	if len(refs)%2 != 0 {
+		return dst, fmt.Errorf("the number of label refs must be even; got %d refs", len(refs))
+	}
+	for i := 0; i < len(refs); i += 2 {
+		name, err := wru.getSymbol(refs[i])
+		if err != nil {
+			return dst, fmt.Errorf("cannot read label name: %w", err)
+		}
+		value, err := wru.getSymbol(refs[i+1])
+		if err != nil {
+			return dst, fmt.Errorf("cannot read label value: %w", err)
+		}
+		dst = append(dst, Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return dst, nil
+}
+
+func (wru *WriteRequestUnmarshaler) getSymbol(ref uint32) (string, error) {
+	if uint64(ref) >= uint64(len(wru.symbols)) {
+		return "", fmt.Errorf("symbol ref %d is out of symbols table with %d items", ref, len(wru.symbols))
+	}
+	return wru.symbols[ref], nil
+}
+
+func getMetricName(labels []Label) string {
+	for _, label := range labels {
+		if label.Name == "__name__" {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// MarshalProtobufV2 marshals wr to Prometheus remote write 2.0 request, appends it to dst and returns the result.
+//
+// wr.Metadata items are attached to series with the matching metric family name.
+// Metadata without matching series is sent as a series with only the metric name label and without samples.
+// Histograms aren't marshaled in the same way as in MarshalProtobuf.
+func (wr *WriteRequest) MarshalProtobufV2(dst []byte) []byte {
+	st := getSymbolsTable()
+	defer putSymbolsTable(st)
+
+	for i := range wr.Metadata {
+		md := &wr.Metadata[i]
+		if _, ok := st.metadata[md.MetricFamilyName]; !ok {
+			st.metadata[md.MetricFamilyName] = md
+		}
+	}
+
+	// Marshal timeseries into a separate message at first, since the symbols table must be built before it is marshaled.
+	m := mp.Get()
+	mm := m.MessageMarshaler()
+	for i := range wr.Timeseries {
+		ts := &wr.Timeseries[i]
+		tsm := mm.AppendMessage(5)
+		st.refs = st.appendLabelsRefs(st.refs[:0], ts.Labels)
+		tsm.AppendUint32s(1, st.refs)
+		for j := range ts.Samples {
+			s := &ts.Samples[j]
+			sm := tsm.AppendMessage(2)
+			sm.AppendDouble(1, s.Value)
+			sm.AppendInt64(2, s.Timestamp)
+		}
+		for j := range ts.Exemplars {
+			e := &ts.Exemplars[j]
+			em := tsm.AppendMessage(4)
+			st.refs = st.appendLabelsRefs(st.refs[:0], e.Labels)
+			em.AppendUint32s(1, st.refs)
+			em.AppendDouble(2, e.Value)
+			em.AppendInt64(3, e.Timestamp)
+		}
+		if md := st.getMetadata(getMetricName(ts.Labels)); md != nil {
+			st.marshalMetadata(tsm.AppendMessage(5), md)
+		}
+		if ts.CreatedTimestamp != 0 {
+			tsm.AppendInt64(6, ts.CreatedTimestamp)
+		}
+	}
+	for i := range wr.Metadata {
+		md := &wr.Metadata[i]
+		if st.usedMetadata[md.MetricFamilyName] {
+			continue
+		}
+		st.usedMetadata[md.MetricFamilyName] = true
+		tsm := mm.AppendMessage(5)
+		st.refs = append(st.refs[:0], st.ref("__name__"), st.ref(md.MetricFamilyName))
+		tsm.AppendUint32s(1, st.refs)
+		st.marshalMetadata(tsm.AppendMessage(5), md)
+	}
+	st.timeseries = m.Marshal(st.timeseries[:0])
+	mp.Put(m)
+
+	m = mp.Get()
+	mm = m.MessageMarshaler()
+	for _, symbol := range st.symbols {
+		mm.AppendString(4, symbol)
+	}
+	dst = m.Marshal(dst)
+	mp.Put(m)
+
+	// The timeseries are already marshaled as a sequence of field 5 messages, so they can be appended as is.
+	return append(dst, st.timeseries...)
+}
+
+type symbolsTable struct {
+	m       map[string]uint32
+	symbols []string
+	refs    []uint32
+
+	metadata     map[string]*MetricMetadata
+	usedMetadata map[string]bool
+
+	timeseries []byte
+}
+
+func (st *symbolsTable) reset() {
+	clear(st.m)
+	clear(st.symbols)
+	st.symbols = st.symbols[:0]
+	st.refs = st.refs[:0]
+	clear(st.metadata)
+	clear(st.usedMetadata)
+	st.timeseries = st.timeseries[:0]
+}
+
+func (st *symbolsTable) ref(s string) uint32 {
+	if len(st.symbols) == 0 {
+		// The first symbol must be an empty string according to the spec.
+		st.symbols = append(st.symbols, "")
+		st.m[""] = 0
+	}
+	if ref, ok := st.m[s]; ok {
+		return ref
+	}
+	ref := uint32(len(st.symbols))
+	st.symbols = append(st.symbols, s)
+	st.m[s] = ref
+	return ref
+}
+
+func (st *symbolsTable) appendLabelsRefs(dst []uint32, labels []Label) []uint32 {
+	for i := range labels {
+		label := &labels[i]
+		name := label.Name
+		if name == "" {
+			name = "__name__"
+		}
+		dst = append(dst, st.ref(name), st.ref(label.Value))
+	}
+	return dst
+}
+
+// getMetadata returns metadata for the given metricName.
+//
+// Series for histograms, summaries and counters have suffixes, which are missing in the metric family name.
+func (st *symbolsTable) getMetadata(metricName string) *MetricMetadata {
+	if len(st.metadata) == 0 || metricName == "" {
+		return nil
+	}
+	familyName := metricName
+	md, ok := st.metadata[familyName]
+	if !ok {
+		for _, suffix := range []string{"_bucket", "_count", "_sum", "_total"} {
+			if s, found := strings.CutSuffix(metricName, suffix); found {
+				familyName = s
+				md, ok = st.metadata[familyName]
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	st.usedMetadata[familyName] = true
+	return md
+}
+
+func (st *symbolsTable) marshalMetadata(mm *easyproto.MessageMarshaler, md *MetricMetadata) {
+	mm.AppendUint32(1, md.Type)
+	if md.Help != "" {
+		mm.AppendUint32(3, st.ref(md.Help))
+	}
+	if md.Unit != "" {
+		mm.AppendUint32(4, st.ref(md.Unit))
+	}
+}
+
+func getSymbolsTable() *symbolsTable {
+	v := symbolsTablePool.Get()
+	if v == nil {
+		return &symbolsTable{
+			m:            make(map[string]uint32),
+			metadata:     make(map[string]*MetricMetadata),
+			usedMetadata: make(map[string]bool),
+		}
+	}
+	return v.(*symbolsTable)
+}
+
+func putSymbolsTable(st *symbolsTable) {
+	st.reset()
+	symbolsTablePool.Put(st)
+}
+
+var symbolsTablePool sync.Pool
@@ -0,0 +1,221 @@
+package prompb
+
+import (
+	"reflect"
+	"testing"
+
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+)
+
+func TestWriteRequestUnmarshalProtobufV2(t *testing.T) {
+	st := writev2.NewSymbolTable()
+	ref := st.Symbolize
+	pr := writev2.Request{
+		Timeseries: []writev2.TimeSeries{
+			{
+				LabelsRefs: []uint32{ref("__name__"), ref("http_requests_total"), ref("job"), ref("api")},
+				Samples: []writev2.Sample{
+					{Value: 10, Timestamp: 1000},
+					{Value: 20, Timestamp: 2000},
+				},
+				Exemplars: []writev2.Exemplar{
+					{LabelsRefs: []uint32{ref("trace_id"), ref("abc")}, Value: 1, Timestamp: 1500},
+				},
+				Metadata: writev2.Metadata{
+					Type:    writev2.Metadata_METRIC_TYPE_COUNTER,
+					HelpRef: ref("The number of requests"),
+				},
+				CreatedTimestamp: 500,
+			},
+			{
+				LabelsRefs: []uint32{ref("__name__"), ref("http_requests_total"), ref("job"), ref("web")},
+				Samples: []writev2.Sample{
+					{Value: 30, Timestamp: 1000},
+				},
+				Metadata: writev2.Metadata{
+					Type:    writev2.Metadata_METRIC_TYPE_COUNTER,
+					HelpRef: ref("The number of requests"),
+				},
+			},
+			{
+				LabelsRefs: []uint32{ref("__name__"), ref("temperature")},
+				Samples: []writev2.Sample{
+					{Value: -1.5, Timestamp: 1000},
+				},
+				Metadata: writev2.Metadata{
+					Type:    writev2.Metadata_METRIC_TYPE_GAUGE,
+					UnitRef: ref("celsius"),
+				},
+			},
+		},
+	}
+	pr.Symbols = st.Symbols()
+	data, err := pr.Marshal()
+	if err != nil {
+		t.Fatalf("cannot marshal Prometheus remote write 2.0 request: %s", err)
+	}
+
+	wrExpected := &WriteRequest{
+		Timeseries: []TimeSeries{
+			{
+				Labels: []Label{
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "job", Value: "api"},
+				},
+				Samples: []Sample{
+					{Value: 10, Timestamp: 1000},
+					{Value: 20, Timestamp: 2000},
+				},
+				Exemplars: []Exemplar{
+					{Labels: []Label{{Name: "trace_id", Value: "abc"}}, Value: 1, Timestamp: 1500},
+				},
+				CreatedTimestamp: 500,
+			},
+			{
+				Labels: []Label{
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "job", Value: "web"},
+				},
+				Samples: []Sample{
+					{Value: 30, Timestamp: 1000},
+				},
+			},
+			{
+				Labels: []Label{
+					{Name: "__name__", Value: "temperature"},
+				},
+				Samples: []Sample{
+					{Value: -1.5, Timestamp: 1000},
+				},
+			},
+		},
+		Metadata: []MetricMetadata{
+			{
+				Type:             uint32(MetricMetadataCOUNTER),
+				MetricFamilyName: "http_requests_total",
+				Help:             "The number of requests",
+			},
+			{
+				Type:             uint32(MetricMetadataGAUGE),
+				MetricFamilyName: "temperature",
+				Unit:             "celsius",
+			},
+		},
+	}
+
+	var wru WriteRequestUnmarshaler
+	wr, err := wru.UnmarshalProtobufV2(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal remote write 2.0 request: %s", err)
+	}
+	if !reflect.DeepEqual(wr, wrExpected) {
+		t.Fatalf("unexpected WriteRequest\ngot\n%+v\nwant\n%+v", wr, wrExpected)
+	}
+
+	// Verify that MarshalProtobufV2 output is unmarshaled back to the same WriteRequest.
+	data = wrExpected.MarshalProtobufV2(nil)
+	wr, err = wru.UnmarshalProtobufV2(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal marshaled remote write 2.0 request: %s", err)
+	}
+	if !reflect.DeepEqual(wr, wrExpected) {
+		t.Fatalf("unexpected WriteRequest after marshaling\ngot\n%+v\nwant\n%+v", wr, wrExpected)
+	}
+
+	// Verify that the marshaled request can be read by Prometheus.
+	var prGot writev2.Request
+	if err := prGot.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal marshaled request with Prometheus: %s", err)
+	}
+	if len(prGot.Timeseries) != 3 {
+		t.Fatalf("unexpected number of series; got %d; want 3", len(prGot.Timeseries))
+	}
+	if prGot.Symbols[0] != "" {
+		t.Fatalf("the first symbol must be empty; got %q", prGot.Symbols[0])
+	}
+}
+
+func TestWriteRequestMarshalProtobufV2Metadata(t *testing.T) {
+	wr := &WriteRequest{
+		Timeseries: []TimeSeries{
+			{
+				Labels:  []Label{{Name: "__name__", Value: "request_duration_seconds_bucket"}, {Name: "le", Value: "1"}},
+				Samples: []Sample{{Value: 3, Timestamp: 1000}},
+			},
+		},
+		Metadata: []MetricMetadata{
+			{
+				Type:             uint32(MetricMetadataHISTOGRAM),
+				MetricFamilyName: "request_duration_seconds",
+				Help:             "Request duration",
+			},
+			{
+				Type:             uint32(MetricMetadataGAUGE),
+				MetricFamilyName: "queue_size",
+			},
+		},
+	}
+	data := wr.MarshalProtobufV2(nil)
+
+	var pr writev2.Request
+	if err := pr.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal request with Prometheus: %s", err)
+	}
+	if len(pr.Timeseries) != 2 {
+		t.Fatalf("unexpected number of series; got %d; want 2", len(pr.Timeseries))
+	}
+
+	// metadata must be attached to the histogram bucket series
+	md := pr.Timeseries[0].Metadata
+	if md.Type != writev2.Metadata_METRIC_TYPE_HISTOGRAM || pr.Symbols[md.HelpRef] != "Request duration" {
+		t.Fatalf("unexpected metadata for the histogram series: %+v", md)
+	}
+
+	// metadata without series must be sent as a series without samples
+	ts := &pr.Timeseries[1]
+	if len(ts.Samples) != 0 || len(ts.LabelsRefs) != 2 || pr.Symbols[ts.LabelsRefs[1]] != "queue_size" {
+		t.Fatalf("unexpected metadata-only series: %+v", ts)
+	}
+	if ts.Metadata.Type != writev2.Metadata_METRIC_TYPE_GAUGE {
+		t.Fatalf("unexpected metadata type; got %s; want %s", ts.Metadata.Type, writev2.Metadata_METRIC_TYPE_GAUGE)
+	}
+}
+
+func TestWriteRequestUnmarshalProtobufV2Failure(t *testing.T) {
+	f := func(pr *writev2.Request) {
+		t.Helper()
+
+		data, err := pr.Marshal()
+		if err != nil {
+			t.Fatalf("cannot marshal request: %s", err)
+		}
+		var wru WriteRequestUnmarshaler
+		if _, err := wru.UnmarshalProtobufV2(data); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing empty string at the start of symbols table
+	f(&writev2.Request{
+		Symbols: []string{"__name__", "foo"},
+		Timeseries: []writev2.TimeSeries{
+			{LabelsRefs: []uint32{0, 1}},
+		},
+	})
+
+	// out of range symbol ref
+	f(&writev2.Request{
+		Symbols: []string{"", "__name__", "foo"},
+		Timeseries: []writev2.TimeSeries{
+			{LabelsRefs: []uint32{1, 3}},
+		},
+	})
+
+	// odd number of label refs
+	f(&writev2.Request{
+		Symbols: []string{"", "__name__", "foo"},
+		Timeseries: []writev2.TimeSeries{
+			{LabelsRefs: []uint32{1, 2, 1}},
+		},
+	})
+}
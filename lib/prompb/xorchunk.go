@@ -0,0 +1,160 @@
+package prompb
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// MaxSamplesPerXORChunk is the maximum number of samples AppendXORChunks puts into a single chunk.
+//
+// This is the same limit as Prometheus uses for its own chunks.
+const MaxSamplesPerXORChunk = 120
+
+// AppendXORChunks encodes samples with the given timestamps and values into Prometheus XOR chunks and appends them to dst.
+//
+// timestamps must be sorted in ascending order. Every chunk contains up to MaxSamplesPerXORChunk samples.
+//
+// See https://github.com/prometheus/prometheus/blob/main/tsdb/docs/format/chunks.md#xor-chunk-data
+func AppendXORChunks(dst []Chunk, timestamps []int64, values []float64) []Chunk {
+	for len(timestamps) > 0 {
+		n := min(len(timestamps), MaxSamplesPerXORChunk)
+		var xe xorEncoder
+		xe.init()
+		for i := range timestamps[:n] {
+			xe.append(timestamps[i], values[i])
+		}
+		dst = append(dst, Chunk{
+			MinTimeMs: timestamps[0],
+			MaxTimeMs: timestamps[n-1],
+			Type:      ChunkEncodingXOR,
+			Data:      xe.bw.b,
+		})
+		timestamps = timestamps[n:]
+		values = values[n:]
+	}
+	return dst
+}
+
+// xorEncoder encodes samples in the same way as Prometheus xorAppender does.
+type xorEncoder struct {
+	bw bitWriter
+
+	samplesCount uint16
+
+	t      int64
+	v      float64
+	tDelta uint64
+
+	leading  uint8
+	trailing uint8
+}
+
+func (xe *xorEncoder) init() {
+	// The first two bytes contain the number of samples in the chunk.
+	xe.bw.b = make([]byte, 2, 128)
+	xe.leading = 0xff
+}
+
+func (xe *xorEncoder) append(t int64, v float64) {
+	var tDelta uint64
+	switch xe.samplesCount {
+	case 0:
+		xe.bw.writeBytes(binary.AppendVarint(nil, t))
+		xe.bw.writeBits(math.Float64bits(v), 64)
+	case 1:
+		tDelta = uint64(t - xe.t)
+		xe.bw.writeBytes(binary.AppendUvarint(nil, tDelta))
+		xe.writeValue(v)
+	default:
+		tDelta = uint64(t - xe.t)
+		dod := int64(tDelta - xe.tDelta)
+		switch {
+		case dod == 0:
+			xe.bw.writeBits(0, 1)
+		case isInBitRange(dod, 14):
+			xe.bw.writeBits(0b10, 2)
+			xe.bw.writeBits(uint64(dod), 14)
+		case isInBitRange(dod, 17):
+			xe.bw.writeBits(0b110, 3)
+			xe.bw.writeBits(uint64(dod), 17)
+		case isInBitRange(dod, 20):
+			xe.bw.writeBits(0b1110, 4)
+			xe.bw.writeBits(uint64(dod), 20)
+		default:
+			xe.bw.writeBits(0b1111, 4)
+			xe.bw.writeBits(uint64(dod), 64)
+		}
+		xe.writeValue(v)
+	}
+	xe.t = t
+	xe.v = v
+	xe.tDelta = tDelta
+	xe.samplesCount++
+	binary.BigEndian.PutUint16(xe.bw.b, xe.samplesCount)
+}
+
+func (xe *xorEncoder) writeValue(v float64) {
+	delta := math.Float64bits(v) ^ math.Float64bits(xe.v)
+	if delta == 0 {
+		xe.bw.writeBits(0, 1)
+		return
+	}
+	xe.bw.writeBits(1, 1)
+
+	leading := uint8(bits.LeadingZeros64(delta))
+	trailing := uint8(bits.TrailingZeros64(delta))
+	if leading >= 32 {
+		// The number of leading zeros must fit 5 bits.
+		leading = 31
+	}
+	if xe.leading != 0xff && leading >= xe.leading && trailing >= xe.trailing {
+		// Re-use the previous leading and trailing zeros.
+		xe.bw.writeBits(0, 1)
+		xe.bw.writeBits(delta>>xe.trailing, 64-int(xe.leading)-int(xe.trailing))
+		return
+	}
+	xe.leading = leading
+	xe.trailing = trailing
+
+	xe.bw.writeBits(1, 1)
+	xe.bw.writeBits(uint64(leading), 5)
+	// The number of significant bits is written as 0 if it equals to 64, since it doesn't fit 6 bits.
+	// Zero significant bits cannot occur here, since this case is covered by delta == 0 above.
+	sigbits := 64 - leading - trailing
+	xe.bw.writeBits(uint64(sigbits), 6)
+	xe.bw.writeBits(delta>>trailing, int(sigbits))
+}
+
+func isInBitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// bitWriter writes bits to b starting from the most significant bit of every byte.
+type bitWriter struct {
+	b []byte
+
+	// freeBits is the number of unused lower bits in the last byte of b.
+	freeBits uint8
+}
+
+func (bw *bitWriter) writeBytes(src []byte) {
+	for _, c := range src {
+		bw.writeBits(uint64(c), 8)
+	}
+}
+
+// writeBits writes the lower nbits of u to bw.
+func (bw *bitWriter) writeBits(u uint64, nbits int) {
+	for nbits > 0 {
+		if bw.freeBits == 0 {
+			bw.b = append(bw.b, 0)
+			bw.freeBits = 8
+		}
+		n := min(nbits, int(bw.freeBits))
+		chunk := byte((u >> (nbits - n)) & (1<<n - 1))
+		bw.freeBits -= uint8(n)
+		bw.b[len(bw.b)-1] |= chunk << bw.freeBits
+		nbits -= n
+	}
+}
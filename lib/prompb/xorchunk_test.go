@@ -0,0 +1,86 @@
+package prompb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+func TestAppendXORChunks(t *testing.T) {
+	f := func(timestamps []int64, values []float64, chunksExpected int) {
+		t.Helper()
+
+		chunks := AppendXORChunks(nil, timestamps, values)
+		if len(chunks) != chunksExpected {
+			t.Fatalf("unexpected number of chunks; got %d; want %d", len(chunks), chunksExpected)
+		}
+
+		// Verify the chunks can be decoded by Prometheus
+		var resultTimestamps []int64
+		var resultValues []float64
+		for _, c := range chunks {
+			if c.Type != ChunkEncodingXOR {
+				t.Fatalf("unexpected chunk type; got %d; want %d", c.Type, ChunkEncodingXOR)
+			}
+			pc, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+			if err != nil {
+				t.Fatalf("cannot decode chunk: %s", err)
+			}
+			it := pc.Iterator(nil)
+			n := 0
+			for it.Next() == chunkenc.ValFloat {
+				ts, v := it.At()
+				if n == 0 && ts != c.MinTimeMs {
+					t.Fatalf("unexpected chunk min time; got %d; want %d", c.MinTimeMs, ts)
+				}
+				resultTimestamps = append(resultTimestamps, ts)
+				resultValues = append(resultValues, v)
+				n++
+			}
+			if err := it.Err(); err != nil {
+				t.Fatalf("cannot iterate over chunk: %s", err)
+			}
+			if n != pc.NumSamples() {
+				t.Fatalf("unexpected number of samples in chunk; got %d; want %d", n, pc.NumSamples())
+			}
+			if resultTimestamps[len(resultTimestamps)-1] != c.MaxTimeMs {
+				t.Fatalf("unexpected chunk max time; got %d; want %d", c.MaxTimeMs, resultTimestamps[len(resultTimestamps)-1])
+			}
+		}
+		if !reflect.DeepEqual(resultTimestamps, timestamps) {
+			t.Fatalf("unexpected timestamps\ngot\n%v\nwant\n%v", resultTimestamps, timestamps)
+		}
+		if len(resultValues) != len(values) {
+			t.Fatalf("unexpected number of values; got %d; want %d", len(resultValues), len(values))
+		}
+		for i, v := range values {
+			if math.Float64bits(v) != math.Float64bits(resultValues[i]) {
+				t.Fatalf("unexpected value at position %d; got %v; want %v", i, resultValues[i], v)
+			}
+		}
+	}
+
+	// empty
+	f(nil, nil, 0)
+
+	// single sample
+	f([]int64{1000}, []float64{1.5}, 1)
+
+	// two samples
+	f([]int64{-1000, 1000}, []float64{1.5, -2}, 1)
+
+	// irregular timestamps and values, including special float values
+	f([]int64{1, 2, 4, 1000, 1001, 70000, 1e6, 1e9, 1e13, 1e13 + 1},
+		[]float64{0, 0, 1, 1e100, -1e-100, math.Inf(1), math.Inf(-1), math.Float64frombits(0x7ff0000000000002), 3.14, 3.14}, 1)
+
+	// multiple chunks
+	var timestamps []int64
+	var values []float64
+	for i := 0; i < 2*MaxSamplesPerXORChunk+1; i++ {
+		timestamps = append(timestamps, 1700000000000+int64(i)*15000+int64(i%7))
+		values = append(values, float64(i*i)/3)
+	}
+	f(timestamps, values, 3)
+}
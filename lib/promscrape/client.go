@@ -5,8 +5,10 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -32,10 +34,79 @@ var (
 		"It is possible to set 'stream_parse: true' individually per each 'scrape_config' section in '-promscrape.config' for fine-grained control")
 )
 
+// defaultAcceptHeader is used when `scrape_protocols` isn't set in `scrape_config`.
+//
+// The header has been copied from Prometheus sources.
+// See https://github.com/prometheus/prometheus/blob/f9d21f10ecd2a343a381044f131ea4e46381ce09/scrape/scrape.go#L532 .
+// This is needed as a workaround for scraping stupid Java-based servers such as Spring Boot.
+// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/608 for details.
+// Do not bloat the `Accept` header with OpenMetrics shit, since it looks like dead standard now.
+const defaultAcceptHeader = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+
+// scrapeProtocolMediaTypes contains media types for the supported values of `scrape_protocols` option.
+//
+// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#scrape_config
+var scrapeProtocolMediaTypes = map[string]string{
+	"PrometheusProto":      "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited",
+	"PrometheusText0.0.4":  "text/plain;version=0.0.4",
+	"PrometheusText1.0.0":  "text/plain;version=1.0.0",
+	"OpenMetricsText0.0.1": "application/openmetrics-text;version=0.0.1",
+	"OpenMetricsText1.0.0": "application/openmetrics-text;version=1.0.0",
+}
+
+func checkScrapeProtocols(protocols []string) error {
+	for i, protocol := range protocols {
+		if _, ok := scrapeProtocolMediaTypes[protocol]; !ok {
+			supported := make([]string, 0, len(scrapeProtocolMediaTypes))
+			for k := range scrapeProtocolMediaTypes {
+				supported = append(supported, k)
+			}
+			sort.Strings(supported)
+			return fmt.Errorf("unsupported scrape protocol %q; supported values: %s", protocol, strings.Join(supported, ", "))
+		}
+		for _, prevProtocol := range protocols[:i] {
+			if prevProtocol == protocol {
+				return fmt.Errorf("duplicate scrape protocol %q", protocol)
+			}
+		}
+	}
+	return nil
+}
+
+// getAcceptHeader returns the `Accept` header for the given protocols.
+//
+// Protocols are weighted in descending order in the same way as Prometheus does, so targets return the most preferred supported format.
+func getAcceptHeader(protocols []string) string {
+	if len(protocols) == 0 {
+		return defaultAcceptHeader
+	}
+	weight := len(scrapeProtocolMediaTypes) + 1
+	a := make([]string, 0, len(protocols)+1)
+	for _, protocol := range protocols {
+		a = append(a, fmt.Sprintf("%s;q=0.%d", scrapeProtocolMediaTypes[protocol], weight))
+		weight--
+	}
+	a = append(a, fmt.Sprintf("*/*;q=0.%d", weight))
+	return strings.Join(a, ",")
+}
+
+// isProtobufContentType returns true if contentType corresponds to Prometheus protobuf exposition format.
+func isProtobufContentType(contentType string) bool {
+	if !strings.HasPrefix(contentType, "application/vnd.google.protobuf") {
+		return false
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/vnd.google.protobuf" && params["proto"] == "io.prometheus.client.MetricFamily"
+}
+
 type client struct {
 	c                       *http.Client
 	ctx                     context.Context
 	scrapeURL               string
+	acceptHeader            string
 	scrapeTimeoutSecondsStr string
 	setHeaders              func(req *http.Request) error
 	setProxyHeaders         func(req *http.Request) error
@@ -106,6 +177,7 @@ func newClient(ctx context.Context, sw *ScrapeWork) (*client, error) {
 		c:                       hc,
 		ctx:                     ctx,
 		scrapeURL:               sw.ScrapeURL,
+		acceptHeader:            getAcceptHeader(sw.ScrapeProtocols),
 		scrapeTimeoutSecondsStr: fmt.Sprintf("%.3f", sw.ScrapeTimeout.Seconds()),
 		setHeaders:              setHeaders,
 		setProxyHeaders:         setProxyHeaders,
@@ -115,30 +187,28 @@ func newClient(ctx context.Context, sw *ScrapeWork) (*client, error) {
 	return c, nil
 }
 
-func (c *client) ReadData(dst *chunkedbuffer.Buffer) (bool, error) {
+// ReadData reads the scrape response into dst.
+//
+// It returns whether the response is gzipped and whether it is in Prometheus protobuf format.
+func (c *client) ReadData(dst *chunkedbuffer.Buffer) (bool, bool, error) {
 	deadline := time.Now().Add(c.c.Timeout)
 	ctx, cancel := context.WithDeadline(c.ctx, deadline)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.scrapeURL, nil)
 	if err != nil {
-		return false, fmt.Errorf("cannot create request for %q: %w", c.scrapeURL, err)
-	}
-	// The following `Accept` header has been copied from Prometheus sources.
-	// See https://github.com/prometheus/prometheus/blob/f9d21f10ecd2a343a381044f131ea4e46381ce09/scrape/scrape.go#L532 .
-	// This is needed as a workaround for scraping stupid Java-based servers such as Spring Boot.
-	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/608 for details.
-	// Do not bloat the `Accept` header with OpenMetrics shit, since it looks like dead standard now.
-	req.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
+		return false, false, fmt.Errorf("cannot create request for %q: %w", c.scrapeURL, err)
+	}
+	req.Header.Set("Accept", c.acceptHeader)
 	// Set X-Prometheus-Scrape-Timeout-Seconds like Prometheus does, since it is used by some exporters such as PushProx.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/1179#issuecomment-813117162
 	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", c.scrapeTimeoutSecondsStr)
 	req.Header.Set("User-Agent", "vm_promscrape")
 	if err := c.setHeaders(req); err != nil {
-		return false, fmt.Errorf("failed to set request headers for %q: %w", c.scrapeURL, err)
+		return false, false, fmt.Errorf("failed to set request headers for %q: %w", c.scrapeURL, err)
 	}
 	if err := c.setProxyHeaders(req); err != nil {
-		return false, fmt.Errorf("failed to set proxy request headers for %q: %w", c.scrapeURL, err)
+		return false, false, fmt.Errorf("failed to set proxy request headers for %q: %w", c.scrapeURL, err)
 	}
 	if !c.disableCompression {
 		req.Header.Set("Accept-Encoding", "gzip")
@@ -150,7 +220,7 @@ func (c *client) ReadData(dst *chunkedbuffer.Buffer) (bool, error) {
 		if ue, ok := err.(*url.Error); ok && ue.Timeout() {
 			scrapesTimedout.Inc()
 		}
-		return false, fmt.Errorf("cannot perform request to %q: %w", c.scrapeURL, err)
+		return false, false, fmt.Errorf("cannot perform request to %q: %w", c.scrapeURL, err)
 	}
 	defer resp.Body.Close()
 
@@ -160,7 +230,7 @@ func (c *client) ReadData(dst *chunkedbuffer.Buffer) (bool, error) {
 		if err != nil {
 			respBody = []byte(err.Error())
 		}
-		return false, fmt.Errorf("unexpected status code returned when scraping %q: %d; expecting %d; response body: %q",
+		return false, false, fmt.Errorf("unexpected status code returned when scraping %q: %d; expecting %d; response body: %q",
 			c.scrapeURL, resp.StatusCode, http.StatusOK, respBody)
 	}
 	scrapesOK.Inc()
@@ -172,17 +242,18 @@ func (c *client) ReadData(dst *chunkedbuffer.Buffer) (bool, error) {
 		if ue, ok := err.(*url.Error); ok && ue.Timeout() {
 			scrapesTimedout.Inc()
 		}
-		return false, fmt.Errorf("cannot read data from %s: %w", c.scrapeURL, err)
+		return false, false, fmt.Errorf("cannot read data from %s: %w", c.scrapeURL, err)
 	}
 	if int64(dst.Len()) >= c.maxScrapeSize {
 		maxScrapeSizeExceeded.Inc()
-		return false, fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize or max_scrape_size in the scrape config (%d bytes). "+
+		return false, false, fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize or max_scrape_size in the scrape config (%d bytes). "+
 			"Possible solutions are: reduce the response size for the target, increase -promscrape.maxScrapeSize command-line flag, "+
 			"increase max_scrape_size value in scrape config for the given target", c.scrapeURL, c.maxScrapeSize)
 	}
 
 	isGzipped := resp.Header.Get("Content-Encoding") == "gzip"
-	return isGzipped, nil
+	isProtobuf := isProtobufContentType(resp.Header.Get("Content-Type"))
+	return isGzipped, isProtobuf, nil
 }
 
 var (
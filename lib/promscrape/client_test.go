@@ -160,13 +160,16 @@ func TestClientProxyReadOk(t *testing.T) {
 		}
 
 		var cb chunkedbuffer.Buffer
-		isGzipped, err := c.ReadData(&cb)
+		isGzipped, isProtobuf, err := c.ReadData(&cb)
 		if err != nil {
 			t.Fatalf("unexpected error at ReadData: %s", err)
 		}
 		if isGzipped {
 			t.Fatalf("the response mustn't be gzipped")
 		}
+		if isProtobuf {
+			t.Fatalf("the response mustn't be in protobuf format")
+		}
 		got, err := io.ReadAll(cb.NewReader())
 		if err != nil {
 			t.Fatalf("err read: %s", err)
@@ -207,3 +210,54 @@ func TestClientProxyReadOk(t *testing.T) {
 	// backend tls and proxy auth
 	f(true, false, nil, &promauth.BasicAuthConfig{Username: "proxy-test", Password: promauth.NewSecret("1234")})
 }
+
+func TestGetAcceptHeader(t *testing.T) {
+	f := func(protocols []string, resultExpected string) {
+		t.Helper()
+		result := getAcceptHeader(protocols)
+		if result != resultExpected {
+			t.Fatalf("unexpected Accept header\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(nil, defaultAcceptHeader)
+	f([]string{"PrometheusProto"}, "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.6,*/*;q=0.5")
+	f([]string{"PrometheusProto", "PrometheusText0.0.4"}, "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.6,"+
+		"text/plain;version=0.0.4;q=0.5,*/*;q=0.4")
+	f([]string{"OpenMetricsText1.0.0", "OpenMetricsText0.0.1", "PrometheusText1.0.0", "PrometheusText0.0.4", "PrometheusProto"},
+		"application/openmetrics-text;version=1.0.0;q=0.6,application/openmetrics-text;version=0.0.1;q=0.5,text/plain;version=1.0.0;q=0.4,"+
+			"text/plain;version=0.0.4;q=0.3,application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.2,*/*;q=0.1")
+}
+
+func TestCheckScrapeProtocols(t *testing.T) {
+	f := func(protocols []string, isValidExpected bool) {
+		t.Helper()
+		err := checkScrapeProtocols(protocols)
+		if isValidExpected && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !isValidExpected && err == nil {
+			t.Fatalf("expecting non-nil error for %q", protocols)
+		}
+	}
+	f(nil, true)
+	f([]string{"PrometheusProto", "PrometheusText0.0.4"}, true)
+	f([]string{"PrometheusText0.0.4", "OpenMetricsText1.0.0"}, true)
+	f([]string{"prometheusproto"}, false)
+	f([]string{"PrometheusProto", "PrometheusProto"}, false)
+}
+
+func TestIsProtobufContentType(t *testing.T) {
+	f := func(contentType string, resultExpected bool) {
+		t.Helper()
+		result := isProtobufContentType(contentType)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %v; want %v", contentType, result, resultExpected)
+		}
+	}
+	f("", false)
+	f("text/plain; version=0.0.4; charset=utf-8", false)
+	f("application/vnd.google.protobuf", false)
+	f("application/vnd.google.protobuf; proto=foo.Bar; encoding=delimited", false)
+	f("application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited", true)
+	f("application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", true)
+}
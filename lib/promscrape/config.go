@@ -54,6 +54,8 @@ import (
 var (
 	enableMetadata = flag.Bool("enableMetadata", false, "Whether to enable metadata processing for metrics scraped from targets, received via VictoriaMetrics remote write, Prometheus remote write v1 or OpenTelemetry protocol. "+
 		"See also remoteWrite.maxMetadataPerBlock")
+	enableExemplars = flag.Bool("enableExemplars", false, "Whether to enable exemplars processing for metrics scraped from targets, received via Prometheus remote write or OpenTelemetry protocol. "+
+		"Single-node VictoriaMetrics stores exemplars and serves them via /api/v1/query_exemplars API. See also -storage.maxExemplarsPerSeries")
 	noStaleMarkers       = flag.Bool("promscrape.noStaleMarkers", false, "Whether to disable sending Prometheus stale markers for metrics when scrape target disappears. This option may reduce memory usage if stale markers aren't needed for your setup. This option also disables populating the scrape_series_added metric. See https://prometheus.io/docs/concepts/jobs_instances/#automatically-generated-labels-and-time-series")
 	seriesLimitPerTarget = flag.Int("promscrape.seriesLimitPerTarget", 0, "Optional limit on the number of unique time series a single scrape target can expose. See https://docs.victoriametrics.com/victoriametrics/vmagent/#cardinality-limiter for more info")
 	strictParse          = flag.Bool("promscrape.config.strictParse", true, "Whether to deny unsupported fields in -promscrape.config . Set to false in order to silently skip unsupported fields")
@@ -95,6 +97,11 @@ func IsMetadataEnabled() bool {
 	return *enableMetadata
 }
 
+// IsExemplarsEnabled returns true if exemplars processing is enabled.
+func IsExemplarsEnabled() bool {
+	return *enableExemplars
+}
+
 func mustInitClusterMemberID() {
 	s := *clusterMemberNum
 	// special case for kubernetes deployment, where pod-name formatted at some-pod-name-1
@@ -300,6 +307,7 @@ type ScrapeConfig struct {
 	MetricRelabelConfigs []promrelabel.RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
 	SampleLimit          int                         `yaml:"sample_limit,omitempty"`
 	LabelLimit           int                         `yaml:"label_limit,omitempty"`
+	ScrapeProtocols      []string                    `yaml:"scrape_protocols,omitempty"`
 
 	// This silly option is needed for compatibility with Prometheus.
 	// vmagent was supporting disable_compression option since the beginning, while Prometheus developers
@@ -972,6 +980,9 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 	if sc.EnableCompression != nil {
 		disableCompression = !*sc.EnableCompression
 	}
+	if err := checkScrapeProtocols(sc.ScrapeProtocols); err != nil {
+		return nil, fmt.Errorf("invalid `scrape_protocols` for `job_name` %q: %w", jobName, err)
+	}
 	swc := &scrapeWorkConfig{
 		scrapeInterval:       scrapeInterval,
 		scrapeIntervalString: scrapeInterval.String(),
@@ -1000,6 +1011,7 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 		scrapeOffset:         sc.ScrapeOffset.Duration(),
 		seriesLimit:          seriesLimit,
 		noStaleMarkers:       noStaleTracking,
+		scrapeProtocols:      sc.ScrapeProtocols,
 	}
 	return swc, nil
 }
@@ -1032,6 +1044,7 @@ type scrapeWorkConfig struct {
 	scrapeOffset         time.Duration
 	seriesLimit          int
 	noStaleMarkers       bool
+	scrapeProtocols      []string
 }
 
 func appendScrapeWorkForTargetLabels(dst []*ScrapeWork, swc *scrapeWorkConfig, targetLabels []*promutil.Labels, discoveryType string) []*ScrapeWork {
@@ -1326,6 +1339,7 @@ func (swc *scrapeWorkConfig) getScrapeWork(target string, extraLabels, metaLabel
 		SeriesLimit:          seriesLimit,
 		LabelLimit:           labelLimit,
 		NoStaleMarkers:       swc.noStaleMarkers,
+		ScrapeProtocols:      swc.scrapeProtocols,
 		AuthToken:            at,
 
 		jobNameOriginal: swc.jobName,
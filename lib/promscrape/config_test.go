@@ -663,6 +663,15 @@ scrape_configs:
   - targets: ["foo"]
 `, []*ScrapeWork{})
 
+	// Scrape config with invalid scrape_protocols must be skipped
+	f(`
+scrape_configs:
+- job_name: x
+  scrape_protocols: [PrometheusProto, foobar]
+  static_configs:
+  - targets: ["foo"]
+`, []*ScrapeWork{})
+
 	// Scrape config with missing job_name must be skipped
 	f(`
 scrape_configs:
@@ -1038,6 +1047,26 @@ scrape_configs:
 
 	f(`
 scrape_configs:
+- job_name: foo
+  scrape_protocols: [PrometheusProto, PrometheusText0.0.4]
+  static_configs:
+  - targets: ["foo.bar:1234"]
+`, []*ScrapeWork{
+		{
+			ScrapeURL:       "http://foo.bar:1234/metrics",
+			ScrapeInterval:  defaultScrapeInterval,
+			ScrapeTimeout:   defaultScrapeTimeout,
+			MaxScrapeSize:   maxScrapeSize.N,
+			ScrapeProtocols: []string{"PrometheusProto", "PrometheusText0.0.4"},
+			Labels: promutil.NewLabelsFromMap(map[string]string{
+				"instance": "foo.bar:1234",
+				"job":      "foo",
+			}),
+			jobNameOriginal: "foo",
+		},
+	})
+	f(`
+scrape_configs:
 - job_name: foo
   max_scrape_size: 8MiB
   metric_relabel_configs:
@@ -152,6 +152,10 @@ type ScrapeWork struct {
 	// See https://docs.victoriametrics.com/victoriametrics/vmagent/#prometheus-staleness-markers
 	NoStaleMarkers bool
 
+	// Optional list of protocols for negotiating the scrape response format with the target in the order of preference.
+	// See https://docs.victoriametrics.com/victoriametrics/vmagent/#scraping-targets-via-protobuf-format
+	ScrapeProtocols []string
+
 	// The Tenant Info
 	AuthToken *auth.Token
 
@@ -176,12 +180,12 @@ func (sw *ScrapeWork) key() string {
 		"HonorTimestamps=%v, DenyRedirects=%v, Labels=%s, ExternalLabels=%s, MaxScrapeSize=%d, "+
 		"ProxyURL=%s, ProxyAuthConfig=%s, AuthConfig=%s, MetricRelabelConfigs=%q, "+
 		"SampleLimit=%d, DisableCompression=%v, DisableKeepAlive=%v, StreamParse=%v, "+
-		"ScrapeAlignInterval=%s, ScrapeOffset=%s, SeriesLimit=%d, LabelLimit=%d, NoStaleMarkers=%v",
+		"ScrapeAlignInterval=%s, ScrapeOffset=%s, SeriesLimit=%d, LabelLimit=%d, NoStaleMarkers=%v, ScrapeProtocols=%q",
 		sw.jobNameOriginal, sw.ScrapeURL, sw.ScrapeInterval, sw.ScrapeTimeout, sw.HonorLabels,
 		sw.HonorTimestamps, sw.DenyRedirects, sw.Labels.String(), sw.ExternalLabels.String(), sw.MaxScrapeSize,
 		sw.ProxyURL.String(), sw.ProxyAuthConfig.String(), sw.AuthConfig.String(), sw.MetricRelabelConfigs.String(),
 		sw.SampleLimit, sw.DisableCompression, sw.DisableKeepAlive, sw.StreamParse,
-		sw.ScrapeAlignInterval, sw.ScrapeOffset, sw.SeriesLimit, sw.LabelLimit, sw.NoStaleMarkers)
+		sw.ScrapeAlignInterval, sw.ScrapeOffset, sw.SeriesLimit, sw.LabelLimit, sw.NoStaleMarkers, sw.ScrapeProtocols)
 	return key
 }
 
@@ -195,7 +199,9 @@ type scrapeWork struct {
 	Config *ScrapeWork
 
 	// ReadData is called for reading the scrape response data into dst.
-	ReadData func(dst *chunkedbuffer.Buffer) (bool, error)
+	//
+	// It must return whether the response is gzipped and whether it is in Prometheus protobuf format.
+	ReadData func(dst *chunkedbuffer.Buffer) (bool, bool, error)
 
 	// PushData is called for pushing collected data.
 	//
@@ -234,6 +240,11 @@ type scrapeWork struct {
 	// It is used as a hint in order to reduce memory usage when working with the last scraped response.
 	lastScrapeLen int
 
+	// lastScrapeSeriesHash contains the hash of series for the last response in protobuf format.
+	// It is used for detecting changes in series without converting protobuf responses to text.
+	// It is zero if the last response wasn't in protobuf format.
+	lastScrapeSeriesHash uint64
+
 	// nextErrorLogTime is the timestamp in millisecond when the next scrape error should be logged.
 	nextErrorLogTime int64
 
@@ -257,7 +268,10 @@ func (sw *scrapeWork) loadLastScrape(dst []byte) []byte {
 	return b
 }
 
-func (sw *scrapeWork) storeLastScrape(lastScrapeStr string) {
+// storeLastScrape stores the last scrape response in text exposition format together with seriesHash for protobuf responses.
+func (sw *scrapeWork) storeLastScrape(lastScrapeStr string, seriesHash uint64) {
+	sw.lastScrapeLen = len(lastScrapeStr)
+	sw.lastScrapeSeriesHash = seriesHash
 	if lastScrapeStr == "" {
 		sw.lastScrapeCompressed = sw.lastScrapeCompressed[:0]
 	} else {
@@ -423,14 +437,21 @@ func (sw *scrapeWork) getTargetResponse() ([]byte, error) {
 	cb := chunkedbuffer.Get()
 	defer chunkedbuffer.Put(cb)
 
-	isGzipped, err := sw.ReadData(cb)
+	isGzipped, isProtobuf, err := sw.ReadData(cb)
 	if err != nil {
 		return nil, err
 	}
 
 	var bb bytesutil.ByteBuffer
 	err = readFromBuffer(&bb, cb, isGzipped)
-	return bb.B, err
+	if err != nil || !isProtobuf {
+		return bb.B, err
+	}
+
+	// Convert protobuf response to human-readable text exposition format.
+	var rows parser.Rows
+	rows, _ = parser.UnmarshalProtobuf(rows, parser.MetadataRows{}, bb.B, sw.logError)
+	return parser.MarshalRowsText(nil, rows.Rows), nil
 }
 
 func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error {
@@ -440,7 +461,7 @@ func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error
 	// This also allows measuring the real scrape duration, which doesn't include
 	// the time needed for processing of the read response.
 	cb := chunkedbuffer.Get()
-	isGzipped, err := sw.ReadData(cb)
+	isGzipped, isProtobuf, err := sw.ReadData(cb)
 
 	// Measure scrape duration.
 	endTimestamp := time.Now().UnixMilli()
@@ -469,12 +490,12 @@ func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error
 		// Process response body from scrape target in streaming manner.
 		// This case is optimized for targets exposing more than ten thousand of metrics per target,
 		// such as kube-state-metrics.
-		err = sw.processDataInStreamMode(scrapeTimestamp, realTimestamp, body, scrapeDurationSeconds)
+		err = sw.processDataInStreamMode(scrapeTimestamp, realTimestamp, body, isProtobuf, scrapeDurationSeconds)
 	} else {
 		// Process response body from scrape target at once.
 		// This case should work more optimally than stream parse for common case when scrape target exposes
 		// up to a few thousand metrics.
-		err = sw.processDataOneShot(scrapeTimestamp, realTimestamp, body.B, scrapeDurationSeconds, err)
+		err = sw.processDataOneShot(scrapeTimestamp, realTimestamp, body.B, isProtobuf, scrapeDurationSeconds, err)
 	}
 
 	leveledbytebufferpool.Put(body)
@@ -504,21 +525,28 @@ func readFromBuffer(dst *bytesutil.ByteBuffer, src *chunkedbuffer.Buffer, isGzip
 	return nil
 }
 
-func (sw *scrapeWork) processDataOneShot(scrapeTimestamp, realTimestamp int64, body []byte, scrapeDurationSeconds float64, err error) error {
+func (sw *scrapeWork) processDataOneShot(scrapeTimestamp, realTimestamp int64, body []byte, isProtobuf bool, scrapeDurationSeconds float64, err error) error {
 	up := 1
 
-	bbLastScrape := leveledbytebufferpool.Get(sw.lastScrapeLen)
-	bbLastScrape.B = sw.loadLastScrape(bbLastScrape.B)
-	lastScrapeStr := bytesutil.ToUnsafeString(bbLastScrape.B)
-
-	bodyString := bytesutil.ToUnsafeString(body)
+	// bodyString contains the response in text exposition format, which is used for staleness tracking.
+	// It is empty for protobuf responses until the text is needed.
+	bodyString := ""
+	if !isProtobuf {
+		bodyString = bytesutil.ToUnsafeString(body)
+	}
+	var seriesHash uint64
 	cfg := sw.Config
-	areIdenticalSeries := areIdenticalSeries(cfg, lastScrapeStr, bodyString)
 
 	wc := writeRequestCtxPool.Get(sw.prevLabelsLen)
 	if err != nil {
 		up = 0
 		scrapesFailed.Inc()
+	} else if isProtobuf {
+		wc.rows, wc.metadataRows = parser.UnmarshalProtobuf(wc.rows, wc.metadataRows, body, sw.logError)
+		if !IsMetadataEnabled() {
+			wc.metadataRows.Reset()
+		}
+		seriesHash = getRowsSeriesHash(wc.rows.Rows)
 	} else {
 		if IsMetadataEnabled() {
 			wc.rows, wc.metadataRows = parser.UnmarshalWithMetadata(wc.rows, wc.metadataRows, bodyString, sw.logError)
@@ -526,6 +554,25 @@ func (sw *scrapeWork) processDataOneShot(scrapeTimestamp, realTimestamp int64, b
 			wc.rows.UnmarshalWithErrLogger(bodyString, sw.logError)
 		}
 	}
+
+	bbLastScrape := leveledbytebufferpool.Get(sw.lastScrapeLen)
+	var bbText *bytesutil.ByteBuffer
+	var areIdenticalSeries bool
+	if isProtobuf {
+		areIdenticalSeries = sw.areIdenticalSeriesHash(seriesHash)
+		if !areIdenticalSeries {
+			// The last response and the current response in text format are needed only for generating stale markers
+			// and for calculating scrape_series_added metric when the series change.
+			bbLastScrape.B = sw.loadLastScrape(bbLastScrape.B)
+			bbText = leveledbytebufferpool.Get(sw.lastScrapeLen)
+			bbText.B = parser.MarshalRowsText(bbText.B, wc.rows.Rows)
+			bodyString = bytesutil.ToUnsafeString(bbText.B)
+		}
+	} else {
+		bbLastScrape.B = sw.loadLastScrape(bbLastScrape.B)
+		areIdenticalSeries = sw.areIdenticalSeries(bytesutil.ToUnsafeString(bbLastScrape.B), bodyString)
+	}
+	lastScrapeStr := bytesutil.ToUnsafeString(bbLastScrape.B)
 	samplesPostRelabeling := 0
 	samplesScraped := len(wc.rows.Rows)
 	scrapedSamples.Update(float64(samplesScraped))
@@ -555,8 +602,12 @@ func (sw *scrapeWork) processDataOneShot(scrapeTimestamp, realTimestamp int64, b
 		up = 0
 	}
 
+	responseSize := 0
 	if up == 0 {
 		bodyString = ""
+		seriesHash = 0
+	} else {
+		responseSize = len(body)
 	}
 	seriesAdded := 0
 	if !areIdenticalSeries {
@@ -569,7 +620,6 @@ func (sw *scrapeWork) processDataOneShot(scrapeTimestamp, realTimestamp int64, b
 	if sw.seriesLimitExceeded.Load() || !areIdenticalSeries {
 		samplesDropped = wc.applySeriesLimit(sw)
 	}
-	responseSize := len(bodyString)
 
 	am := &autoMetrics{
 		up:                        up,
@@ -590,33 +640,40 @@ func (sw *scrapeWork) processDataOneShot(scrapeTimestamp, realTimestamp int64, b
 		// Send stale markers for disappeared metrics with the real scrape timestamp
 		// in order to guarantee that query doesn't return data after this time for the disappeared metrics.
 		sw.sendStaleSeries(lastScrapeStr, bodyString, realTimestamp, false)
-		sw.storeLastScrape(bodyString)
-		sw.lastScrapeLen = len(bodyString)
+		sw.storeLastScrape(bodyString, seriesHash)
 	}
 	leveledbytebufferpool.Put(bbLastScrape)
+	if bbText != nil {
+		leveledbytebufferpool.Put(bbText)
+	}
 
 	tsmGlobal.Update(sw, up == 1, realTimestamp, int64(scrapeDurationSeconds*1000), responseSize, samplesScraped, err)
 	return err
 }
 
-func (sw *scrapeWork) processDataInStreamMode(scrapeTimestamp, realTimestamp int64, body *bytesutil.ByteBuffer, scrapeDurationSeconds float64) error {
+func (sw *scrapeWork) processDataInStreamMode(scrapeTimestamp, realTimestamp int64, body *bytesutil.ByteBuffer, isProtobuf bool, scrapeDurationSeconds float64) error {
 	var samplesScraped atomic.Int64
 	var samplesPostRelabeling atomic.Int64
 	var samplesDroppedTotal atomic.Int64
 	var maxLabelsLen atomic.Int64
+	var seriesHash atomic.Uint64
 
 	maxLabelsLen.Store(int64(sw.prevLabelsLen))
 
 	bbLastScrape := leveledbytebufferpool.Get(sw.lastScrapeLen)
-	bbLastScrape.B = sw.loadLastScrape(bbLastScrape.B)
-	lastScrapeStr := bytesutil.ToUnsafeString(bbLastScrape.B)
-
-	bodyString := bytesutil.ToUnsafeString(body.B)
 	cfg := sw.Config
-	areIdenticalSeries := areIdenticalSeries(cfg, lastScrapeStr, bodyString)
 
-	r := body.NewReader()
-	err := stream.Parse(r, scrapeTimestamp, "", false, IsMetadataEnabled(), func(rows []parser.Row, mms []parser.Metadata) error {
+	// bodyString contains the response in text exposition format, which is used for staleness tracking.
+	// It is empty for protobuf responses until the text is needed.
+	bodyString := ""
+	areIdenticalSeries := false
+	if !isProtobuf {
+		bbLastScrape.B = sw.loadLastScrape(bbLastScrape.B)
+		bodyString = bytesutil.ToUnsafeString(body.B)
+		areIdenticalSeries = sw.areIdenticalSeries(bytesutil.ToUnsafeString(bbLastScrape.B), bodyString)
+	}
+
+	callback := func(rows []parser.Row, mms []parser.Metadata) error {
 		labelsLen := maxLabelsLen.Load()
 		wc := writeRequestCtxPool.Get(int(labelsLen))
 		defer func() {
@@ -650,14 +707,25 @@ func (sw *scrapeWork) processDataInStreamMode(scrapeTimestamp, realTimestamp int
 		}
 		wc.addMetadata(mms)
 
+		// Series in protobuf responses can be compared with the previous scrape only after the whole response is parsed,
+		// so the series limit is always applied to them.
 		if sw.seriesLimitExceeded.Load() || !areIdenticalSeries {
 			samplesDropped := wc.applySeriesLimit(sw)
 			samplesDroppedTotal.Add(int64(samplesDropped))
 		}
 
 		sw.pushData(&wc.writeRequest)
+		if isProtobuf {
+			seriesHash.Add(getRowsSeriesHash(rows))
+		}
 		return nil
-	}, sw.logError)
+	}
+	var err error
+	if isProtobuf {
+		err = stream.ParseProtobuf(body.B, scrapeTimestamp, IsMetadataEnabled(), callback, sw.logError)
+	} else {
+		err = stream.Parse(body.NewReader(), scrapeTimestamp, "", false, IsMetadataEnabled(), callback, sw.logError)
+	}
 
 	sw.prevLabelsLen = int(maxLabelsLen.Load())
 	scrapedSamples.Update(float64(samplesScraped.Load()))
@@ -667,8 +735,25 @@ func (sw *scrapeWork) processDataInStreamMode(scrapeTimestamp, realTimestamp int
 		// to remote storage. This makes the logic compatible with Prometheus.
 		up = 0
 		bodyString = ""
+		seriesHash.Store(0)
 		scrapesFailed.Inc()
 	}
+	var bbText *bytesutil.ByteBuffer
+	if isProtobuf {
+		areIdenticalSeries = sw.areIdenticalSeriesHash(seriesHash.Load())
+		if !areIdenticalSeries {
+			// The last response and the current response in text format are needed only for generating stale markers
+			// and for calculating scrape_series_added metric when the series change.
+			// The response is parsed again in this case, since the parsed rows aren't available after the stream parsing.
+			bbLastScrape.B = sw.loadLastScrape(bbLastScrape.B)
+			if up == 1 {
+				bbText = leveledbytebufferpool.Get(sw.lastScrapeLen)
+				bbText.B = marshalProtobufRowsText(bbText.B, body.B)
+				bodyString = bytesutil.ToUnsafeString(bbText.B)
+			}
+		}
+	}
+	lastScrapeStr := bytesutil.ToUnsafeString(bbLastScrape.B)
 	seriesAdded := 0
 	if !areIdenticalSeries {
 		// The returned value for seriesAdded may be bigger than the real number of added series
@@ -676,7 +761,10 @@ func (sw *scrapeWork) processDataInStreamMode(scrapeTimestamp, realTimestamp int
 		// This is a trade-off between performance and accuracy.
 		seriesAdded = getSeriesAdded(lastScrapeStr, bodyString)
 	}
-	responseSize := len(bodyString)
+	responseSize := 0
+	if up == 1 {
+		responseSize = len(body.B)
+	}
 
 	am := &autoMetrics{
 		up:                        up,
@@ -693,10 +781,12 @@ func (sw *scrapeWork) processDataInStreamMode(scrapeTimestamp, realTimestamp int
 		// Send stale markers for disappeared metrics with the real scrape timestamp
 		// in order to guarantee that query doesn't return data after this time for the disappeared metrics.
 		sw.sendStaleSeries(lastScrapeStr, bodyString, realTimestamp, false)
-		sw.storeLastScrape(bodyString)
-		sw.lastScrapeLen = len(bodyString)
+		sw.storeLastScrape(bodyString, seriesHash.Load())
 	}
 	leveledbytebufferpool.Put(bbLastScrape)
+	if bbText != nil {
+		leveledbytebufferpool.Put(bbText)
+	}
 
 	tsmGlobal.Update(sw, up == 1, realTimestamp, int64(scrapeDurationSeconds*1000), responseSize, int(samplesScraped.Load()), err)
 	// Do not track active series in streaming mode, since this may need too big amounts of memory
@@ -722,15 +812,57 @@ func (sw *scrapeWork) pushData(wr *prompb.WriteRequest) {
 	pushDataDuration.UpdateDuration(startTime)
 }
 
-func areIdenticalSeries(cfg *ScrapeWork, prevData, currData string) bool {
-	if cfg.NoStaleMarkers && cfg.SeriesLimit <= 0 {
-		// Do not spend CPU time on tracking the changes in series if stale markers are disabled.
-		// The check for series_limit is needed for https://github.com/VictoriaMetrics/VictoriaMetrics/issues/3660
+func (sw *scrapeWork) areIdenticalSeries(prevData, currData string) bool {
+	if !sw.needSeriesTracking() {
 		return true
 	}
 	return parser.AreIdenticalSeriesFast(prevData, currData)
 }
 
+// areIdenticalSeriesHash returns true if seriesHash for the protobuf response matches the series of the last response.
+func (sw *scrapeWork) areIdenticalSeriesHash(seriesHash uint64) bool {
+	if !sw.needSeriesTracking() {
+		return true
+	}
+	return sw.lastScrapeSeriesHash != 0 && sw.lastScrapeSeriesHash == seriesHash
+}
+
+func (sw *scrapeWork) needSeriesTracking() bool {
+	// Do not spend CPU time on tracking the changes in series if stale markers are disabled.
+	// The check for series_limit is needed for https://github.com/VictoriaMetrics/VictoriaMetrics/issues/3660
+	cfg := sw.Config
+	return !cfg.NoStaleMarkers || cfg.SeriesLimit > 0
+}
+
+// getRowsSeriesHash returns the hash of series in rows.
+//
+// The hash doesn't depend on the order of rows, so it can be calculated for rows parsed in stream mode.
+func getRowsSeriesHash(rows []parser.Row) uint64 {
+	var h uint64
+	d := xxhash.New()
+	for i := range rows {
+		r := &rows[i]
+		d.Reset()
+		_, _ = d.WriteString(r.Metric)
+		for _, tag := range r.Tags {
+			_, _ = d.WriteString("\x00")
+			_, _ = d.WriteString(tag.Key)
+			_, _ = d.WriteString("\x00")
+			_, _ = d.WriteString(tag.Value)
+		}
+		h += d.Sum64()
+	}
+	return h
+}
+
+// marshalProtobufRowsText appends rows from the Prometheus protobuf response in src to dst in text exposition format.
+func marshalProtobufRowsText(dst, src []byte) []byte {
+	// Parsing errors are ignored, since they are already logged when processing the response.
+	var rows parser.Rows
+	rows, _ = parser.UnmarshalProtobuf(rows, parser.MetadataRows{}, src, func(_ string) {})
+	return parser.MarshalRowsText(dst, rows.Rows)
+}
+
 // leveledWriteRequestCtxPool allows reducing memory usage when writeRequestCtx
 // structs contain mixed number of labels.
 //
@@ -780,9 +912,11 @@ type writeRequestCtx struct {
 	rows         parser.Rows
 	metadataRows parser.MetadataRows
 
-	writeRequest prompb.WriteRequest
-	labels       []prompb.Label
-	samples      []prompb.Sample
+	writeRequest   prompb.WriteRequest
+	labels         []prompb.Label
+	samples        []prompb.Sample
+	exemplars      []prompb.Exemplar
+	exemplarLabels []prompb.Label
 }
 
 func (wc *writeRequestCtx) reset() {
@@ -795,6 +929,12 @@ func (wc *writeRequestCtx) reset() {
 	wc.labels = wc.labels[:0]
 
 	wc.samples = wc.samples[:0]
+
+	clear(wc.exemplars)
+	wc.exemplars = wc.exemplars[:0]
+
+	clear(wc.exemplarLabels)
+	wc.exemplarLabels = wc.exemplarLabels[:0]
 }
 
 var writeRequestCtxPool leveledWriteRequestCtxPool
@@ -1137,9 +1277,35 @@ func (wc *writeRequestCtx) addRow(cfg *ScrapeWork, r *parser.Row, timestamp int6
 		Labels:  wc.labels[labelsLen:],
 		Samples: wc.samples[len(wc.samples)-1:],
 	})
+	if len(r.Exemplar.Tags) > 0 && IsExemplarsEnabled() {
+		wc.addExemplar(&r.Exemplar, sampleTimestamp)
+	}
 	return nil
 }
 
+// addExemplar attaches e to the last time series at wc.
+func (wc *writeRequestCtx) addExemplar(e *parser.Exemplar, sampleTimestamp int64) {
+	exemplarLabelsLen := len(wc.exemplarLabels)
+	for i := range e.Tags {
+		tag := &e.Tags[i]
+		wc.exemplarLabels = append(wc.exemplarLabels, prompb.Label{
+			Name:  tag.Key,
+			Value: tag.Value,
+		})
+	}
+	timestamp := e.Timestamp
+	if timestamp == 0 {
+		timestamp = sampleTimestamp
+	}
+	wc.exemplars = append(wc.exemplars, prompb.Exemplar{
+		Labels:    wc.exemplarLabels[exemplarLabelsLen:],
+		Value:     e.Value,
+		Timestamp: timestamp,
+	})
+	ts := &wc.writeRequest.Timeseries[len(wc.writeRequest.Timeseries)-1]
+	ts.Exemplars = wc.exemplars[len(wc.exemplars)-1:]
+}
+
 var bbPool bytesutil.ByteBufferPool
 
 func appendLabels(dst []prompb.Label, metric string, src []parser.Tag, extraLabels []prompb.Label, honorLabels bool) []prompb.Label {
@@ -1,6 +1,7 @@
 package promscrape
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sort"
 	"strings"
@@ -9,8 +10,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/easyproto"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/chunkedbuffer"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutil"
@@ -94,9 +98,9 @@ func TestScrapeWorkScrapeInternalFailure(t *testing.T) {
 	}
 
 	readDataCalls := 0
-	sw.ReadData = func(_ *chunkedbuffer.Buffer) (bool, error) {
+	sw.ReadData = func(_ *chunkedbuffer.Buffer) (bool, bool, error) {
 		readDataCalls++
-		return false, fmt.Errorf("error when reading data")
+		return false, false, fmt.Errorf("error when reading data")
 	}
 
 	pushDataCalls := 0
@@ -158,10 +162,10 @@ func testScrapeWorkScrapeInternalSuccess(t *testing.T, streamParse bool) {
 		sw.Config = cfg
 
 		readDataCalls := 0
-		sw.ReadData = func(dst *chunkedbuffer.Buffer) (bool, error) {
+		sw.ReadData = func(dst *chunkedbuffer.Buffer) (bool, bool, error) {
 			readDataCalls++
 			dst.MustWrite([]byte(data))
-			return false, nil
+			return false, false, nil
 		}
 
 		var pushDataMu sync.Mutex
@@ -598,6 +602,191 @@ func testScrapeWorkScrapeInternalSuccess(t *testing.T, streamParse bool) {
 // functions correctly and is free of race conditions.
 //
 // The core parsing functionality is validated separately in TestScrapeWorkScrapeInternalSuccess.
+func TestScrapeWorkScrapeInternalProtobuf(t *testing.T) {
+	testScrapeWorkScrapeInternalProtobuf(t, false)
+	testScrapeWorkScrapeInternalProtobuf(t, true)
+}
+
+func testScrapeWorkScrapeInternalProtobuf(t *testing.T, streamParse bool) {
+	oldIsmetadataEnabled := *enableMetadata
+	defer func() {
+		*enableMetadata = oldIsmetadataEnabled
+	}()
+	*enableMetadata = true
+
+	marshalGauge := func(dst []byte, name string, value float64) []byte {
+		var mp easyproto.MarshalerPool
+		m := mp.Get()
+		mm := m.MessageMarshaler()
+		mm.AppendString(1, name)
+		mm.AppendString(2, "test gauge")
+		mm.AppendInt32(3, 1)
+		mm.AppendMessage(4).AppendMessage(2).AppendDouble(1, value)
+		data := m.Marshal(nil)
+		mp.Put(m)
+		dst = binary.AppendUvarint(dst, uint64(len(data)))
+		return append(dst, data...)
+	}
+
+	var sw scrapeWork
+	sw.Config = &ScrapeWork{
+		ScrapeTimeout: time.Second * 42,
+		StreamParse:   streamParse,
+	}
+	var data []byte
+	sw.ReadData = func(dst *chunkedbuffer.Buffer) (bool, bool, error) {
+		dst.MustWrite(data)
+		return false, true, nil
+	}
+	var pushDataMu sync.Mutex
+	var tss []prompb.TimeSeries
+	var mms []prompb.MetricMetadata
+	sw.PushData = func(_ *auth.Token, wr *prompb.WriteRequest) {
+		pushDataMu.Lock()
+		defer pushDataMu.Unlock()
+
+		for _, ts := range wr.Timeseries {
+			tss = append(tss, prompb.TimeSeries{
+				Labels:  append([]prompb.Label{}, ts.Labels...),
+				Samples: append([]prompb.Sample{}, ts.Samples...),
+			})
+		}
+		mms = append(mms, wr.Metadata...)
+	}
+
+	protoparserutil.StartUnmarshalWorkers()
+	defer protoparserutil.StopUnmarshalWorkers()
+	tsmGlobal.Register(&sw)
+	defer tsmGlobal.Unregister(&sw)
+
+	// The first scrape must return all the series with metadata.
+	data = marshalGauge(nil, "foo", 1)
+	data = marshalGauge(data, "bar", 2)
+	timestamp := int64(123000)
+	if err := sw.scrapeInternal(timestamp, timestamp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dataExpected := fmt.Sprintf(`
+		foo 1 123
+		bar 2 123
+		up 1 123
+		scrape_samples_scraped 2 123
+		scrape_response_size_bytes %d 123
+		scrape_duration_seconds 0 123
+		scrape_samples_post_metric_relabeling 2 123
+		scrape_series_added 2 123
+		scrape_timeout_seconds 42 123
+	`, len(data))
+	if err := expectEqualTimeseries(tss, parseData(dataExpected)); err != nil {
+		t.Fatalf("unexpected data pushed: %s", err)
+	}
+	if err := expectEqualMetadata(mms, []prompb.MetricMetadata{
+		{
+			Type:             uint32(prompb.MetricMetadataGAUGE),
+			MetricFamilyName: "foo",
+			Help:             "test gauge",
+		},
+		{
+			Type:             uint32(prompb.MetricMetadataGAUGE),
+			MetricFamilyName: "bar",
+			Help:             "test gauge",
+		},
+	}); err != nil {
+		t.Fatalf("unexpected metadata pushed: %s", err)
+	}
+
+	// The second scrape must send staleness marker for the disappeared series.
+	tss = tss[:0]
+	data = marshalGauge(nil, "foo", 3)
+	if err := sw.scrapeInternal(timestamp+1000, timestamp+1000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	staleSeries := 0
+	for _, ts := range tss {
+		if ts.Labels[0].Value == "bar" {
+			if len(ts.Samples) != 1 || !decimal.IsStaleNaN(ts.Samples[0].Value) {
+				t.Fatalf("expecting staleness marker for bar; got %v", ts.Samples)
+			}
+			staleSeries++
+		}
+		if ts.Labels[0].Value == "scrape_series_added" && ts.Samples[0].Value != 0 {
+			t.Fatalf("unexpected scrape_series_added value; got %v; want 0", ts.Samples[0].Value)
+		}
+	}
+	if staleSeries != 1 {
+		t.Fatalf("unexpected number of staleness markers; got %d; want 1", staleSeries)
+	}
+	seriesHash := sw.lastScrapeSeriesHash
+	if seriesHash == 0 {
+		t.Fatalf("expecting non-zero hash for the series of the last scrape")
+	}
+
+	// The scrape with the same series must not send staleness markers.
+	tss = tss[:0]
+	data = marshalGauge(nil, "foo", 4)
+	if err := sw.scrapeInternal(timestamp+2000, timestamp+2000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, ts := range tss {
+		if decimal.IsStaleNaN(ts.Samples[0].Value) {
+			t.Fatalf("unexpected staleness marker for %s", ts.Labels[0].Value)
+		}
+	}
+	if sw.lastScrapeSeriesHash != seriesHash {
+		t.Fatalf("unexpected hash for the series of the last scrape; got %d; want %d", sw.lastScrapeSeriesHash, seriesHash)
+	}
+
+	// The scrape with new series must update scrape_series_added.
+	tss = tss[:0]
+	data = marshalGauge(nil, "foo", 5)
+	data = marshalGauge(data, "baz", 6)
+	if err := sw.scrapeInternal(timestamp+3000, timestamp+3000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	seriesAddedFound := false
+	for _, ts := range tss {
+		if ts.Labels[0].Value == "scrape_series_added" {
+			if ts.Samples[0].Value != 1 {
+				t.Fatalf("unexpected scrape_series_added value; got %v; want 1", ts.Samples[0].Value)
+			}
+			seriesAddedFound = true
+		}
+	}
+	if !seriesAddedFound {
+		t.Fatalf("missing scrape_series_added metric")
+	}
+	if sw.lastScrapeSeriesHash == seriesHash {
+		t.Fatalf("the hash for the series of the last scrape must be updated after adding new series")
+	}
+}
+
+func TestGetRowsSeriesHash(t *testing.T) {
+	f := func(s1, s2 string, equalExpected bool) {
+		t.Helper()
+
+		var rows1, rows2 prometheus.Rows
+		rows1.UnmarshalWithErrLogger(s1, nil)
+		rows2.UnmarshalWithErrLogger(s2, nil)
+		h1 := getRowsSeriesHash(rows1.Rows)
+		h2 := getRowsSeriesHash(rows2.Rows)
+		if (h1 == h2) != equalExpected {
+			t.Fatalf("unexpected hash comparison result for\n%s\nand\n%s\ngot equal=%v; want %v", s1, s2, h1 == h2, equalExpected)
+		}
+	}
+
+	// the same series with distinct values and timestamps
+	f("foo 1\nbar{x=\"y\"} 2", "foo 3 123\nbar{x=\"y\"} 4", true)
+
+	// distinct order of series
+	f("foo 1\nbar 2", "bar 2\nfoo 1", true)
+
+	// distinct series
+	f("foo 1", "bar 1", false)
+	f("foo 1", "foo 1\nbar 2", false)
+	f(`foo{x="y"} 1`, `foo{x="z"} 1`, false)
+	f(`foo{x="yz"} 1`, `foo{xy="z"} 1`, false)
+}
+
 func TestScrapeWorkScrapeInternalStreamConcurrency(t *testing.T) {
 	oldIsmetadataEnabled := *enableMetadata
 	defer func() {
@@ -611,10 +800,10 @@ func TestScrapeWorkScrapeInternalStreamConcurrency(t *testing.T) {
 		sw.Config = cfg
 
 		readDataCalls := 0
-		sw.ReadData = func(dst *chunkedbuffer.Buffer) (bool, error) {
+		sw.ReadData = func(dst *chunkedbuffer.Buffer) (bool, bool, error) {
 			readDataCalls++
 			dst.MustWrite([]byte(data))
-			return false, nil
+			return false, false, nil
 		}
 
 		var pushDataCalls atomic.Int64
@@ -205,9 +205,9 @@ func benchmarkScrapeWorkScrapeInternal(b *testing.B, data []byte, streamParse bo
 	protoparserutil.StartUnmarshalWorkers()
 	defer protoparserutil.StopUnmarshalWorkers()
 
-	readData := func(dst *chunkedbuffer.Buffer) (bool, error) {
+	readData := func(dst *chunkedbuffer.Buffer) (bool, bool, error) {
 		dst.MustWrite(data)
-		return false, nil
+		return false, false, nil
 	}
 
 	b.ReportAllocs()
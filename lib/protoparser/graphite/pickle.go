@@ -0,0 +1,427 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// UnmarshalPickle unmarshals graphite rows from a single pickle protocol message in data.
+//
+// The message must contain a list of `(path, (timestamp, value))` tuples.
+// Invalid tuples are skipped, while an error is returned if the message cannot be unpickled.
+//
+// Only a safe subset of pickle opcodes is supported, which is enough for unpickling lists, tuples, strings and numbers.
+// Opcodes, which can be used for creating arbitrary objects, are rejected.
+//
+// See https://graphite.readthedocs.io/en/latest/feeding-carbon.html#the-pickle-protocol
+//
+// data shouldn't be modified when rs is in use.
+func (rs *Rows) UnmarshalPickle(data []byte) error {
+	rs.Rows = rs.Rows[:0]
+	rs.tagsPool = rs.tagsPool[:0]
+
+	v, err := unpickle(data)
+	if err != nil {
+		return fmt.Errorf("cannot unpickle data: %w", err)
+	}
+	items, ok := getPickleSequence(v)
+	if !ok {
+		return fmt.Errorf("unexpected type of unpickled data: %T; want list of (path, (timestamp, value)) tuples", v)
+	}
+	for _, item := range items {
+		rs.Rows, rs.tagsPool, err = appendPickleRow(rs.Rows, rs.tagsPool, item)
+		if err != nil {
+			logger.Errorf("cannot unmarshal Graphite pickle item %v: %s", item, err)
+			invalidLines.Inc()
+		}
+	}
+	return nil
+}
+
+func appendPickleRow(dst []Row, tagsPool []Tag, item any) ([]Row, []Tag, error) {
+	a, ok := getPickleSequence(item)
+	if !ok || len(a) != 2 {
+		return dst, tagsPool, fmt.Errorf("expecting (path, (timestamp, value)) tuple")
+	}
+	path, ok := a[0].(string)
+	if !ok {
+		return dst, tagsPool, fmt.Errorf("unexpected type of path: %T; want string", a[0])
+	}
+	dp, ok := getPickleSequence(a[1])
+	if !ok || len(dp) != 2 {
+		return dst, tagsPool, fmt.Errorf("expecting (timestamp, value) tuple for %q", path)
+	}
+	timestamp, err := getPickleFloat(dp[0])
+	if err != nil {
+		return dst, tagsPool, fmt.Errorf("cannot parse timestamp for %q: %w", path, err)
+	}
+	value, err := getPickleFloat(dp[1])
+	if err != nil {
+		return dst, tagsPool, fmt.Errorf("cannot parse value for %q: %w", path, err)
+	}
+
+	dst = append(dst, Row{})
+	r := &dst[len(dst)-1]
+	tagsPool, err = r.UnmarshalMetricAndTags(path, tagsPool)
+	if err != nil {
+		return dst[:len(dst)-1], tagsPool, fmt.Errorf("cannot parse metric and tags from %q: %w", path, err)
+	}
+	r.Timestamp = int64(timestamp)
+	r.Value = value
+	return dst, tagsPool, nil
+}
+
+func getPickleSequence(v any) ([]any, bool) {
+	switch t := v.(type) {
+	case *pickleList:
+		return t.items, true
+	case pickleTuple:
+		return t, true
+	default:
+		return nil, false
+	}
+}
+
+func getPickleFloat(v any) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int64:
+		return float64(t), nil
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(t), 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T; want number", v)
+	}
+}
+
+// pickleList is an unpickled list. It is a pointer, since lists may be modified after being stored in memo.
+type pickleList struct {
+	items []any
+}
+
+// pickleTuple is an unpickled tuple.
+type pickleTuple []any
+
+// pickleMark is put on the stack by MARK opcode.
+type pickleMark struct{}
+
+// unpickle unpickles data with the safe subset of pickle opcodes.
+//
+// Strings are returned as unsafe references to data.
+//
+// See https://github.com/python/cpython/blob/main/Lib/pickletools.py for opcodes description.
+func unpickle(data []byte) (any, error) {
+	var stack []any
+	memo := make(map[uint64]any)
+
+	pop := func() (any, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("unexpected empty stack")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := v.(pickleMark); ok {
+			return nil, fmt.Errorf("unexpected MARK on the stack")
+		}
+		return v, nil
+	}
+	popMark := func() ([]any, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, ok := stack[i].(pickleMark); ok {
+				items := append([]any{}, stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot find MARK on the stack")
+	}
+	readBytes := func(n uint64) ([]byte, error) {
+		if n > uint64(len(data)) {
+			return nil, fmt.Errorf("cannot read %d bytes from %d bytes", n, len(data))
+		}
+		b := data[:n]
+		data = data[n:]
+		return b, nil
+	}
+	readUint := func(n uint64) (uint64, error) {
+		b, err := readBytes(n)
+		if err != nil {
+			return 0, err
+		}
+		var v uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		return v, nil
+	}
+	readLine := func() (string, error) {
+		n := strings.IndexByte(bytesutil.ToUnsafeString(data), '\n')
+		if n < 0 {
+			return "", fmt.Errorf("missing newline")
+		}
+		s := bytesutil.ToUnsafeString(data[:n])
+		data = data[n+1:]
+		return s, nil
+	}
+	readString := func(lenSize uint64) (string, error) {
+		n, err := readUint(lenSize)
+		if err != nil {
+			return "", err
+		}
+		b, err := readBytes(n)
+		if err != nil {
+			return "", err
+		}
+		return bytesutil.ToUnsafeString(b), nil
+	}
+	appendToList := func(items []any) error {
+		if len(stack) == 0 {
+			return fmt.Errorf("missing list on the stack")
+		}
+		list, ok := stack[len(stack)-1].(*pickleList)
+		if !ok {
+			return fmt.Errorf("unexpected type on the stack: %T; want list", stack[len(stack)-1])
+		}
+		list.items = append(list.items, items...)
+		return nil
+	}
+
+	for len(data) > 0 {
+		op := data[0]
+		data = data[1:]
+
+		var v any
+		var err error
+		switch op {
+		case '.': // STOP
+			return pop()
+		case '(': // MARK
+			stack = append(stack, pickleMark{})
+			continue
+		case '0': // POP
+			_, err = pop()
+		case '1': // POP_MARK
+			_, err = popMark()
+		case '2': // DUP
+			if v, err = pop(); err == nil {
+				stack = append(stack, v, v)
+			}
+		case 'N': // NONE
+			stack = append(stack, nil)
+		case 0x88: // NEWTRUE
+			stack = append(stack, true)
+		case 0x89: // NEWFALSE
+			stack = append(stack, false)
+		case 'I': // INT
+			var s string
+			if s, err = readLine(); err == nil {
+				switch s {
+				case "00":
+					stack = append(stack, false)
+				case "01":
+					stack = append(stack, true)
+				default:
+					var n int64
+					if n, err = strconv.ParseInt(s, 10, 64); err == nil {
+						stack = append(stack, n)
+					}
+				}
+			}
+		case 'L': // LONG
+			var s string
+			if s, err = readLine(); err == nil {
+				var n int64
+				if n, err = strconv.ParseInt(strings.TrimSuffix(s, "L"), 10, 64); err == nil {
+					stack = append(stack, n)
+				}
+			}
+		case 'J': // BININT
+			var n uint64
+			if n, err = readUint(4); err == nil {
+				stack = append(stack, int64(int32(n)))
+			}
+		case 'K': // BININT1
+			var n uint64
+			if n, err = readUint(1); err == nil {
+				stack = append(stack, int64(n))
+			}
+		case 'M': // BININT2
+			var n uint64
+			if n, err = readUint(2); err == nil {
+				stack = append(stack, int64(n))
+			}
+		case 0x8a, 0x8b: // LONG1, LONG4
+			lenSize := uint64(1)
+			if op == 0x8b {
+				lenSize = 4
+			}
+			var s string
+			if s, err = readString(lenSize); err == nil {
+				if len(s) > 8 {
+					err = fmt.Errorf("too big integer with %d bytes", len(s))
+				} else {
+					// Little-endian two's complement integer.
+					var n uint64
+					for i := len(s) - 1; i >= 0; i-- {
+						n = n<<8 | uint64(s[i])
+					}
+					if len(s) > 0 && len(s) < 8 && s[len(s)-1]&0x80 != 0 {
+						n |= math.MaxUint64 << (8 * len(s))
+					}
+					stack = append(stack, int64(n))
+				}
+			}
+		case 'F': // FLOAT
+			var s string
+			if s, err = readLine(); err == nil {
+				var f float64
+				if f, err = strconv.ParseFloat(s, 64); err == nil {
+					stack = append(stack, f)
+				}
+			}
+		case 'G': // BINFLOAT
+			var b []byte
+			if b, err = readBytes(8); err == nil {
+				stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(b)))
+			}
+		case 'S': // STRING
+			var s string
+			if s, err = readLine(); err == nil {
+				if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != '\'' && s[0] != '"') {
+					err = fmt.Errorf("invalid quoted string %q", s)
+				} else {
+					stack = append(stack, s[1:len(s)-1])
+				}
+			}
+		case 'V': // UNICODE
+			var s string
+			if s, err = readLine(); err == nil {
+				stack = append(stack, s)
+			}
+		case 'T', 'X', 'B': // BINSTRING, BINUNICODE, BINBYTES
+			var s string
+			if s, err = readString(4); err == nil {
+				stack = append(stack, s)
+			}
+		case 'U', 'C', 0x8c: // SHORT_BINSTRING, SHORT_BINBYTES, SHORT_BINUNICODE
+			var s string
+			if s, err = readString(1); err == nil {
+				stack = append(stack, s)
+			}
+		case 0x8d, 0x8e: // BINUNICODE8, BINBYTES8
+			var s string
+			if s, err = readString(8); err == nil {
+				stack = append(stack, s)
+			}
+		case ']': // EMPTY_LIST
+			stack = append(stack, &pickleList{})
+		case 'l': // LIST
+			var items []any
+			if items, err = popMark(); err == nil {
+				stack = append(stack, &pickleList{
+					items: items,
+				})
+			}
+		case 'a': // APPEND
+			if v, err = pop(); err == nil {
+				err = appendToList([]any{v})
+			}
+		case 'e': // APPENDS
+			var items []any
+			if items, err = popMark(); err == nil {
+				err = appendToList(items)
+			}
+		case ')': // EMPTY_TUPLE
+			stack = append(stack, pickleTuple{})
+		case 't': // TUPLE
+			var items []any
+			if items, err = popMark(); err == nil {
+				stack = append(stack, pickleTuple(items))
+			}
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op-0x85) + 1
+			if len(stack) < n {
+				err = fmt.Errorf("too small stack for TUPLE%d", n)
+			} else {
+				items := make(pickleTuple, n)
+				for i := n - 1; i >= 0; i-- {
+					if items[i], err = pop(); err != nil {
+						break
+					}
+				}
+				if err == nil {
+					stack = append(stack, items)
+				}
+			}
+		case 'p', 'q', 'r', 0x94: // PUT, BINPUT, LONG_BINPUT, MEMOIZE
+			var idx uint64
+			switch op {
+			case 'p':
+				var s string
+				if s, err = readLine(); err == nil {
+					idx, err = strconv.ParseUint(s, 10, 64)
+				}
+			case 'q':
+				idx, err = readUint(1)
+			case 'r':
+				idx, err = readUint(4)
+			default:
+				idx = uint64(len(memo))
+			}
+			if err == nil {
+				if len(stack) == 0 {
+					err = fmt.Errorf("cannot memoize item from empty stack")
+				} else {
+					memo[idx] = stack[len(stack)-1]
+				}
+			}
+		case 'g', 'h', 'j': // GET, BINGET, LONG_BINGET
+			var idx uint64
+			switch op {
+			case 'g':
+				var s string
+				if s, err = readLine(); err == nil {
+					idx, err = strconv.ParseUint(s, 10, 64)
+				}
+			case 'h':
+				idx, err = readUint(1)
+			default:
+				idx, err = readUint(4)
+			}
+			if err == nil {
+				var ok bool
+				if v, ok = memo[idx]; !ok {
+					err = fmt.Errorf("missing memo item %d", idx)
+				} else {
+					stack = append(stack, v)
+				}
+			}
+		case 0x80: // PROTO
+			var proto uint64
+			if proto, err = readUint(1); err == nil && proto > 5 {
+				err = fmt.Errorf("unsupported pickle protocol version %d", proto)
+			}
+		case 0x95: // FRAME
+			// Frames are used only for buffering, so their size can be ignored.
+			_, err = readUint(8)
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%02x", op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot process pickle opcode 0x%02x: %w", op, err)
+		}
+	}
+	return nil, fmt.Errorf("missing STOP opcode")
+}
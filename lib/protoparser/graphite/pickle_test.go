@@ -0,0 +1,123 @@
+package graphite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRowsUnmarshalPickleSuccess(t *testing.T) {
+	f := func(data string, rowsExpected []Row) {
+		t.Helper()
+
+		var rows Rows
+		if err := rows.UnmarshalPickle([]byte(data)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(rows.Rows, rowsExpected) {
+			t.Fatalf("unexpected rows\ngot\n%+v\nwant\n%+v", rows.Rows, rowsExpected)
+		}
+
+		// Try unmarshaling again
+		if err := rows.UnmarshalPickle([]byte(data)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(rows.Rows, rowsExpected) {
+			t.Fatalf("unexpected rows on the second unmarshal\ngot\n%+v\nwant\n%+v", rows.Rows, rowsExpected)
+		}
+	}
+
+	// empty list
+	f("\x80\x02]q\x00.", nil)
+
+	// pickle.dumps(rows) with protocols 0, 2 and 4 for the following rows:
+	//
+	// [("foo.bar", (1700000000, 1.5)), ("foo.baz;env=prod", (1700000001.0, 2)), ("foo.qux", (1700000002, -3)), ("foo.big", (1700000003, 2**40))]
+	rowsExpected := []Row{
+		{
+			Metric:    "foo.bar",
+			Value:     1.5,
+			Timestamp: 1700000000,
+		},
+		{
+			Metric: "foo.baz",
+			Tags: []Tag{{
+				Key:   "env",
+				Value: "prod",
+			}},
+			Value:     2,
+			Timestamp: 1700000001,
+		},
+		{
+			Metric:    "foo.qux",
+			Value:     -3,
+			Timestamp: 1700000002,
+		},
+		{
+			Metric:    "foo.big",
+			Value:     1 << 40,
+			Timestamp: 1700000003,
+		},
+	}
+	f("(lp0\n(Vfoo.bar\np1\n(I1700000000\nF1.5\ntp2\ntp3\na(Vfoo.baz;env=prod\np4\n(F1700000001.0\nI2\ntp5\ntp6\na(Vfoo.qux\np7\n(I1700000002\nI-3\ntp8\ntp9\na(Vfoo.big\np10\n(I1700000003\nL1099511627776L\ntp11\ntp12\na.", rowsExpected)
+	f("\x80\x02]q\x00(X\x07\x00\x00\x00foo.barq\x01J\x00\xf1SeG?\xf8\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x10\x00\x00\x00foo.baz;env=prodq\x04GA\xd9T\xfc@@\x00\x00K\x02\x86q\x05\x86q\x06X\x07\x00\x00\x00foo.quxq\x07J\x02\xf1SeJ\xfd\xff\xff\xff\x86q\x08\x86q\x09X\x07\x00\x00\x00foo.bigq\nJ\x03\xf1Se\x8a\x06\x00\x00\x00\x00\x00\x01\x86q\x0b\x86q\x0ce.", rowsExpected)
+	f("\x80\x04\x95v\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x07foo.bar\x94J\x00\xf1SeG?\xf8\x00\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\x10foo.baz;env=prod\x94GA\xd9T\xfc@@\x00\x00K\x02\x86\x94\x86\x94\x8c\x07foo.qux\x94J\x02\xf1SeJ\xfd\xff\xff\xff\x86\x94\x86\x94\x8c\x07foo.big\x94J\x03\xf1Se\x8a\x06\x00\x00\x00\x00\x00\x01\x86\x94\x86\x94e.", rowsExpected)
+
+	// Python 2 strings with string value
+	f("\x80\x02]q\x00U\x07foo.barq\x01J\x00\xf1SeU\x0412.5\x86q\x02\x86q\x03a.", []Row{{
+		Metric:    "foo.bar",
+		Value:     12.5,
+		Timestamp: 1700000000,
+	}})
+
+	// invalid items are skipped:
+	//
+	// [("ok.metric", (1700000000, 1)), ("bad", (1,)), (1, (2, 3)), ("bad2", (1700000000, "abc")), ("", (1, 2))]
+	f("\x80\x02]q\x00(X\x09\x00\x00\x00ok.metricq\x01J\x00\xf1SeK\x01\x86q\x02\x86q\x03X\x03\x00\x00\x00badq\x04K\x01\x85q\x05\x86q\x06K\x01K\x02K\x03\x86q\x07\x86q\x08X\x04\x00\x00\x00bad2q\x09J\x00\xf1SeX\x03\x00\x00\x00abcq\n\x86q\x0b\x86q\x0cX\x00\x00\x00\x00q\x0dK\x01K\x02\x86q\x0e\x86q\x0fe.", []Row{{
+		Metric:    "ok.metric",
+		Value:     1,
+		Timestamp: 1700000000,
+	}})
+}
+
+func TestRowsUnmarshalPickleFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		var rows Rows
+		if err := rows.UnmarshalPickle([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// empty data
+	f("")
+
+	// missing STOP
+	f("\x80\x02]q\x00")
+
+	// truncated string
+	f("\x80\x02]q\x00X\x07\x00\x00\x00foo")
+
+	// not a list
+	f("\x80\x02K\x01.")
+
+	// missing MARK
+	f("\x80\x02]q\x00e.")
+
+	// unknown memo item
+	f("\x80\x02h\x05.")
+
+	// too big integer
+	f("\x80\x02\x8a\x09\x00\x00\x00\x00\x00\x00\x00\x00\x01.")
+
+	// unsupported protocol
+	f("\x80\x06]q\x00.")
+
+	// GLOBAL and REDUCE opcodes are rejected:
+	//
+	// [os.system("echo")]
+	f("\x80\x02]q\x00cposix\nsystem\nq\x01X\x04\x00\x00\x00echoq\x02\x85q\x03Rq\x04a.")
+
+	// dicts aren't supported
+	f("\x80\x02}q\x00.")
+}
@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/graphite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var maxPickleMessageSize = flagutil.NewBytes("graphite.maxPickleMessageSize", 16*1024*1024, "The maximum size in bytes of a single message "+
+	"accepted via Graphite pickle protocol at -graphitePickleListenAddr")
+
+// ParsePickle parses Graphite pickle protocol messages from r and calls callback for the parsed rows.
+//
+// Every message must be prefixed with its length encoded as 4-byte big-endian unsigned integer.
+// See https://graphite.readthedocs.io/en/latest/feeding-carbon.html#the-pickle-protocol
+//
+// callback shouldn't hold rows after returning.
+func ParsePickle(r io.Reader, callback func(rows []graphite.Row) error) error {
+	wcr := writeconcurrencylimiter.GetReader(r)
+	defer writeconcurrencylimiter.PutReader(wcr)
+
+	ctx := getPickleContext(wcr)
+	defer putPickleContext(ctx)
+
+	for {
+		ok, err := ctx.readMessage()
+		wcr.DecConcurrency()
+		if err != nil {
+			pickleReadErrors.Inc()
+			return fmt.Errorf("cannot read graphite pickle protocol data: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		if err := ctx.rows.UnmarshalPickle(ctx.buf); err != nil {
+			pickleUnmarshalErrors.Inc()
+			return fmt.Errorf("cannot unmarshal graphite pickle message: %w", err)
+		}
+		rows := ctx.rows.Rows
+		pickleRowsRead.Add(len(rows))
+		normalizeTimestamps(rows)
+		if err := callback(rows); err != nil {
+			return fmt.Errorf("error when processing imported data: %w", err)
+		}
+	}
+}
+
+// readMessage reads the next pickle message into ctx.buf.
+//
+// It returns false if r has no more messages.
+func (ctx *pickleContext) readMessage() (bool, error) {
+	pickleReadCalls.Inc()
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(ctx.br, sizeBuf[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot read message size: %w", err)
+	}
+	size := binary.BigEndian.Uint32(sizeBuf[:])
+	if maxSize := maxPickleMessageSize.IntN(); int64(size) > int64(maxSize) {
+		return false, fmt.Errorf("too big message size: %d bytes; mustn't exceed -graphite.maxPickleMessageSize=%d bytes", size, maxSize)
+	}
+	ctx.buf = bytesutil.ResizeNoCopyNoOverallocate(ctx.buf, int(size))
+	if _, err := io.ReadFull(ctx.br, ctx.buf); err != nil {
+		return false, fmt.Errorf("cannot read message with size %d bytes: %w", size, err)
+	}
+	return true, nil
+}
+
+type pickleContext struct {
+	br   *bufio.Reader
+	buf  []byte
+	rows graphite.Rows
+}
+
+func (ctx *pickleContext) reset() {
+	ctx.br.Reset(nil)
+	ctx.buf = ctx.buf[:0]
+	ctx.rows.Reset()
+}
+
+func getPickleContext(r io.Reader) *pickleContext {
+	if v := pickleContextPool.Get(); v != nil {
+		ctx := v.(*pickleContext)
+		ctx.br.Reset(r)
+		return ctx
+	}
+	return &pickleContext{
+		br: bufio.NewReaderSize(r, 64*1024),
+	}
+}
+
+func putPickleContext(ctx *pickleContext) {
+	ctx.reset()
+	pickleContextPool.Put(ctx)
+}
+
+var pickleContextPool sync.Pool
+
+var (
+	pickleReadCalls       = metrics.NewCounter(`vm_protoparser_read_calls_total{type="graphite_pickle"}`)
+	pickleReadErrors      = metrics.NewCounter(`vm_protoparser_read_errors_total{type="graphite_pickle"}`)
+	pickleRowsRead        = metrics.NewCounter(`vm_protoparser_rows_read_total{type="graphite_pickle"}`)
+	pickleUnmarshalErrors = metrics.NewCounter(`vm_protoparser_unmarshal_errors_total{type="graphite_pickle"}`)
+)
@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/graphite"
+)
+
+func TestParsePickleSuccess(t *testing.T) {
+	f := func(messages []string, resultExpected string) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		for _, msg := range messages {
+			bb.Write(binary.BigEndian.AppendUint32(nil, uint32(len(msg))))
+			bb.WriteString(msg)
+		}
+		var sb strings.Builder
+		err := ParsePickle(&bb, func(rows []graphite.Row) error {
+			for _, r := range rows {
+				fmt.Fprintf(&sb, "%s %v %d\n", r.Metric, r.Value, r.Timestamp)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := sb.String(); result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// no messages
+	f(nil, "")
+
+	// multiple messages; timestamps are converted to milliseconds
+	f([]string{
+		// [("foo.bar", (1700000000, 1.5))]
+		"\x80\x02]q\x00X\x07\x00\x00\x00foo.barq\x01J\x00\xf1SeG?\xf8\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03a.",
+		// [("foo.baz", (1700000001, 2))]
+		"\x80\x02]q\x00X\x07\x00\x00\x00foo.bazq\x01J\x01\xf1SeK\x02\x86q\x02\x86q\x03a.",
+	}, "foo.bar 1.5 1700000000000\nfoo.baz 2 1700000001000\n")
+}
+
+func TestParsePickleFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		err := ParsePickle(strings.NewReader(data), func(_ []graphite.Row) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// truncated size
+	f("\x00\x00")
+
+	// truncated message
+	f("\x00\x00\x00\x10\x80\x02]q\x00.")
+
+	// too big message
+	f("\xff\xff\xff\xff")
+
+	// invalid message
+	f("\x00\x00\x00\x03foo")
+}
@@ -160,7 +160,16 @@ func (uw *unmarshalWork) Unmarshal() {
 	uw.rows.Unmarshal(bytesutil.ToUnsafeString(uw.reqBuf))
 	rows := uw.rows.Rows
 	rowsRead.Add(len(rows))
+	normalizeTimestamps(rows)
 
+	uw.runCallback(rows)
+	putUnmarshalWork(uw)
+}
+
+// normalizeTimestamps converts timestamps for the given rows from seconds to milliseconds.
+//
+// Missing timestamps are filled with the current timestamp.
+func normalizeTimestamps(rows []graphite.Row) {
 	// Fill missing timestamps with the current timestamp rounded to seconds.
 	currentTimestamp := int64(fasttime.UnixTimestamp())
 	for i := range rows {
@@ -182,9 +191,6 @@ func (uw *unmarshalWork) Unmarshal() {
 			row.Timestamp -= row.Timestamp % tsTrim
 		}
 	}
-
-	uw.runCallback(rows)
-	putUnmarshalWork(uw)
 }
 
 func getUnmarshalWork() *unmarshalWork {
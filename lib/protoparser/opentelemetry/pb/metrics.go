@@ -1,6 +1,7 @@
 package pb
 
 import (
+	"encoding/hex"
 	"fmt"
 	"strings"
 
@@ -322,17 +323,20 @@ func (g *Gauge) unmarshalProtobuf(src []byte) (err error) {
 
 // NumberDataPoint represents the corresponding OTEL protobuf message
 type NumberDataPoint struct {
-	Attributes   []*KeyValue
-	TimeUnixNano uint64
-	DoubleValue  *float64
-	IntValue     *int64
-	Flags        uint32
+	Attributes        []*KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	DoubleValue       *float64
+	IntValue          *int64
+	Exemplars         []*Exemplar
+	Flags             uint32
 }
 
 func (ndp *NumberDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	for _, a := range ndp.Attributes {
 		a.marshalProtobuf(mm.AppendMessage(7))
 	}
+	mm.AppendFixed64(2, ndp.StartTimeUnixNano)
 	mm.AppendFixed64(3, ndp.TimeUnixNano)
 	switch {
 	case ndp.DoubleValue != nil:
@@ -340,17 +344,22 @@ func (ndp *NumberDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	case ndp.IntValue != nil:
 		mm.AppendSfixed64(6, *ndp.IntValue)
 	}
+	for _, e := range ndp.Exemplars {
+		e.marshalProtobuf(mm.AppendMessage(5))
+	}
 	mm.AppendUint32(8, ndp.Flags)
 }
 
 func (ndp *NumberDataPoint) unmarshalProtobuf(src []byte) (err error) {
 	// message NumberDataPoint {
 	//   repeated KeyValue attributes = 7;
+	//   fixed64 start_time_unix_nano = 2;
 	//   fixed64 time_unix_nano = 3;
 	//   oneof value {
 	//     double as_double = 4;
 	//     sfixed64 as_int = 6;
 	//   }
+	//   repeated Exemplar exemplars = 5;
 	//   uint32 flags = 8;
 	// }
 	var fc easyproto.FieldContext
@@ -370,6 +379,12 @@ func (ndp *NumberDataPoint) unmarshalProtobuf(src []byte) (err error) {
 			if err := a.unmarshalProtobuf(data); err != nil {
 				return fmt.Errorf("cannot unmarshal Attribute: %w", err)
 			}
+		case 2:
+			startTimeUnixNano, ok := fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read StartTimeUnixNano")
+			}
+			ndp.StartTimeUnixNano = startTimeUnixNano
 		case 3:
 			timeUnixNano, ok := fc.Fixed64()
 			if !ok {
@@ -388,6 +403,16 @@ func (ndp *NumberDataPoint) unmarshalProtobuf(src []byte) (err error) {
 				return fmt.Errorf("cannot read IntValue")
 			}
 			ndp.IntValue = &intValue
+		case 5:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Exemplar")
+			}
+			ndp.Exemplars = append(ndp.Exemplars, &Exemplar{})
+			e := ndp.Exemplars[len(ndp.Exemplars)-1]
+			if err := e.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Exemplar: %w", err)
+			}
 		case 8:
 			flags, ok := fc.Uint32()
 			if !ok {
@@ -596,19 +621,22 @@ func (s *Summary) unmarshalProtobuf(src []byte) (err error) {
 
 // HistogramDataPoint represents the corresponding OTEL protobuf message
 type HistogramDataPoint struct {
-	Attributes     []*KeyValue
-	TimeUnixNano   uint64
-	Count          uint64
-	Sum            *float64
-	BucketCounts   []uint64
-	ExplicitBounds []float64
-	Flags          uint32
+	Attributes        []*KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Count             uint64
+	Sum               *float64
+	BucketCounts      []uint64
+	ExplicitBounds    []float64
+	Exemplars         []*Exemplar
+	Flags             uint32
 }
 
 func (dp *HistogramDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	for _, a := range dp.Attributes {
 		a.marshalProtobuf(mm.AppendMessage(9))
 	}
+	mm.AppendFixed64(2, dp.StartTimeUnixNano)
 	mm.AppendFixed64(3, dp.TimeUnixNano)
 	mm.AppendFixed64(4, dp.Count)
 	if dp.Sum != nil {
@@ -616,17 +644,22 @@ func (dp *HistogramDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	}
 	mm.AppendFixed64s(6, dp.BucketCounts)
 	mm.AppendDoubles(7, dp.ExplicitBounds)
+	for _, e := range dp.Exemplars {
+		e.marshalProtobuf(mm.AppendMessage(8))
+	}
 	mm.AppendUint32(10, dp.Flags)
 }
 
 func (dp *HistogramDataPoint) unmarshalProtobuf(src []byte) (err error) {
 	// message HistogramDataPoint {
 	//   repeated KeyValue attributes = 9;
+	//   fixed64 start_time_unix_nano = 2;
 	//   fixed64 time_unix_nano = 3;
 	//   fixed64 count = 4;
 	//   optional double sum = 5;
 	//   repeated fixed64 bucket_counts = 6;
 	//   repeated double explicit_bounds = 7;
+	//   repeated Exemplar exemplars = 8;
 	//   uint32 flags = 10;
 	// }
 	var fc easyproto.FieldContext
@@ -646,6 +679,12 @@ func (dp *HistogramDataPoint) unmarshalProtobuf(src []byte) (err error) {
 			if err := a.unmarshalProtobuf(data); err != nil {
 				return fmt.Errorf("cannot unmarshal Attribute: %w", err)
 			}
+		case 2:
+			startTimeUnixNano, ok := fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read StartTimeUnixNano")
+			}
+			dp.StartTimeUnixNano = startTimeUnixNano
 		case 3:
 			timeUnixNano, ok := fc.Fixed64()
 			if !ok {
@@ -676,6 +715,16 @@ func (dp *HistogramDataPoint) unmarshalProtobuf(src []byte) (err error) {
 				return fmt.Errorf("cannot read ExplicitBounds")
 			}
 			dp.ExplicitBounds = explicitBounds
+		case 8:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Exemplar")
+			}
+			dp.Exemplars = append(dp.Exemplars, &Exemplar{})
+			e := dp.Exemplars[len(dp.Exemplars)-1]
+			if err := e.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Exemplar: %w", err)
+			}
 		case 10:
 			flags, ok := fc.Uint32()
 			if !ok {
@@ -687,26 +736,126 @@ func (dp *HistogramDataPoint) unmarshalProtobuf(src []byte) (err error) {
 	return nil
 }
 
+// Exemplar represents the corresponding OTEL protobuf message
+type Exemplar struct {
+	FilteredAttributes []*KeyValue
+	TimeUnixNano       uint64
+	DoubleValue        *float64
+	IntValue           *int64
+	SpanID             string
+	TraceID            string
+}
+
+func (e *Exemplar) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	for _, a := range e.FilteredAttributes {
+		a.marshalProtobuf(mm.AppendMessage(7))
+	}
+	mm.AppendFixed64(2, e.TimeUnixNano)
+	switch {
+	case e.DoubleValue != nil:
+		mm.AppendDouble(3, *e.DoubleValue)
+	case e.IntValue != nil:
+		mm.AppendSfixed64(6, *e.IntValue)
+	}
+
+	spanID, err := hex.DecodeString(e.SpanID)
+	if err != nil {
+		spanID = []byte(e.SpanID)
+	}
+	mm.AppendBytes(4, spanID)
+
+	traceID, err := hex.DecodeString(e.TraceID)
+	if err != nil {
+		traceID = []byte(e.TraceID)
+	}
+	mm.AppendBytes(5, traceID)
+}
+
+func (e *Exemplar) unmarshalProtobuf(src []byte) (err error) {
+	// message Exemplar {
+	//   repeated KeyValue filtered_attributes = 7;
+	//   fixed64 time_unix_nano = 2;
+	//   oneof value {
+	//     double as_double = 3;
+	//     sfixed64 as_int = 6;
+	//   }
+	//   bytes span_id = 4;
+	//   bytes trace_id = 5;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in Exemplar: %w", err)
+		}
+		switch fc.FieldNum {
+		case 7:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read FilteredAttribute")
+			}
+			e.FilteredAttributes = append(e.FilteredAttributes, &KeyValue{})
+			a := e.FilteredAttributes[len(e.FilteredAttributes)-1]
+			if err := a.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal FilteredAttribute: %w", err)
+			}
+		case 2:
+			timeUnixNano, ok := fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read TimeUnixNano")
+			}
+			e.TimeUnixNano = timeUnixNano
+		case 3:
+			doubleValue, ok := fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read DoubleValue")
+			}
+			e.DoubleValue = &doubleValue
+		case 6:
+			intValue, ok := fc.Sfixed64()
+			if !ok {
+				return fmt.Errorf("cannot read IntValue")
+			}
+			e.IntValue = &intValue
+		case 4:
+			spanID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read SpanID")
+			}
+			e.SpanID = hex.EncodeToString(spanID)
+		case 5:
+			traceID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read TraceID")
+			}
+			e.TraceID = hex.EncodeToString(traceID)
+		}
+	}
+	return nil
+}
+
 // ExponentialHistogramDataPoint represents the corresponding OTEL protobuf message
 type ExponentialHistogramDataPoint struct {
-	Attributes    []*KeyValue
-	TimeUnixNano  uint64
-	Count         uint64
-	Sum           *float64
-	Scale         int32
-	ZeroCount     uint64
-	Positive      *Buckets
-	Negative      *Buckets
-	Flags         uint32
-	Min           *float64
-	Max           *float64
-	ZeroThreshold float64
+	Attributes        []*KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Count             uint64
+	Sum               *float64
+	Scale             int32
+	ZeroCount         uint64
+	Positive          *Buckets
+	Negative          *Buckets
+	Flags             uint32
+	Min               *float64
+	Max               *float64
+	ZeroThreshold     float64
 }
 
 func (dp *ExponentialHistogramDataPoint) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 	for _, a := range dp.Attributes {
 		a.marshalProtobuf(mm.AppendMessage(1))
 	}
+	mm.AppendFixed64(2, dp.StartTimeUnixNano)
 	mm.AppendFixed64(3, dp.TimeUnixNano)
 	mm.AppendFixed64(4, dp.Count)
 	if dp.Sum != nil {
@@ -733,6 +882,7 @@ func (dp *ExponentialHistogramDataPoint) marshalProtobuf(mm *easyproto.MessageMa
 func (dp *ExponentialHistogramDataPoint) unmarshalProtobuf(src []byte) (err error) {
 	// message ExponentialHistogramDataPoint {
 	//   repeated KeyValue attributes = 1;
+	//   fixed64 start_time_unix_nano = 2;
 	//   fixed64 time_unix_nano = 3;
 	//   fixed64 count = 4;
 	//   optional double sum = 5;
@@ -762,6 +912,12 @@ func (dp *ExponentialHistogramDataPoint) unmarshalProtobuf(src []byte) (err erro
 			if err := a.unmarshalProtobuf(data); err != nil {
 				return fmt.Errorf("cannot unmarshal Attribute: %w", err)
 			}
+		case 2:
+			startTimeUnixNano, ok := fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read StartTimeUnixNano")
+			}
+			dp.StartTimeUnixNano = startTimeUnixNano
 		case 3:
 			timeUnixNano, ok := fc.Fixed64()
 			if !ok {
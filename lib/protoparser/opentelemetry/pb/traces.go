@@ -0,0 +1,365 @@
+package pb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/easyproto"
+)
+
+// ExportTraceServiceRequest represents the corresponding OTEL protobuf message
+type ExportTraceServiceRequest struct {
+	ResourceSpans []*ResourceSpans
+}
+
+// MarshalProtobuf marshals r to protobuf message, appends it to dst and returns the result.
+func (r *ExportTraceServiceRequest) MarshalProtobuf(dst []byte) []byte {
+	m := mp.Get()
+	r.marshalProtobuf(m.MessageMarshaler())
+	dst = m.Marshal(dst)
+	mp.Put(m)
+	return dst
+}
+
+func (r *ExportTraceServiceRequest) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	for _, rs := range r.ResourceSpans {
+		rs.marshalProtobuf(mm.AppendMessage(1))
+	}
+}
+
+// UnmarshalProtobuf unmarshals r from protobuf message at src.
+func (r *ExportTraceServiceRequest) UnmarshalProtobuf(src []byte) (err error) {
+	// message ExportTraceServiceRequest {
+	//   repeated ResourceSpans resource_spans = 1;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in ExportTraceServiceRequest: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read ResourceSpans data")
+			}
+			rs := &ResourceSpans{}
+			if err := rs.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal ResourceSpans: %w", err)
+			}
+			r.ResourceSpans = append(r.ResourceSpans, rs)
+		}
+	}
+	return nil
+}
+
+// ResourceSpans represents the corresponding OTEL protobuf message
+type ResourceSpans struct {
+	Resource   Resource
+	ScopeSpans []*ScopeSpans
+}
+
+func (rs *ResourceSpans) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	rs.Resource.marshalProtobuf(mm.AppendMessage(1))
+	for _, ss := range rs.ScopeSpans {
+		ss.marshalProtobuf(mm.AppendMessage(2))
+	}
+}
+
+func (rs *ResourceSpans) unmarshalProtobuf(src []byte) (err error) {
+	// message ResourceSpans {
+	//   Resource resource = 1;
+	//   repeated ScopeSpans scope_spans = 2;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in ResourceSpans: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Resource data")
+			}
+			if err := rs.Resource.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot umarshal Resource: %w", err)
+			}
+		case 2:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read ScopeSpans data")
+			}
+			ss := &ScopeSpans{}
+			if err := ss.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal ScopeSpans: %w", err)
+			}
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+	}
+	return nil
+}
+
+// ScopeSpans represents the corresponding OTEL protobuf message
+type ScopeSpans struct {
+	Scope InstrumentationScope
+	Spans []*Span
+}
+
+func (ss *ScopeSpans) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	ss.Scope.marshalProtobuf(mm.AppendMessage(1))
+	for _, s := range ss.Spans {
+		s.marshalProtobuf(mm.AppendMessage(2))
+	}
+}
+
+func (ss *ScopeSpans) unmarshalProtobuf(src []byte) (err error) {
+	// message ScopeSpans {
+	//   InstrumentationScope scope = 1;
+	//   repeated Span spans = 2;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in ScopeSpans: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Scope data")
+			}
+			if err := ss.Scope.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Scope: %w", err)
+			}
+		case 2:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Span data")
+			}
+			s := &Span{}
+			if err := s.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Span: %w", err)
+			}
+			ss.Spans = append(ss.Spans, s)
+		}
+	}
+	return nil
+}
+
+// InstrumentationScope represents the corresponding OTEL protobuf message
+type InstrumentationScope struct {
+	Name    string
+	Version string
+}
+
+func (is *InstrumentationScope) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	mm.AppendString(1, is.Name)
+	mm.AppendString(2, is.Version)
+}
+
+func (is *InstrumentationScope) unmarshalProtobuf(src []byte) (err error) {
+	// message InstrumentationScope {
+	//   string name = 1;
+	//   string version = 2;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in InstrumentationScope: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			name, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read Name")
+			}
+			is.Name = strings.Clone(name)
+		case 2:
+			version, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read Version")
+			}
+			is.Version = strings.Clone(version)
+		}
+	}
+	return nil
+}
+
+// SpanKind represents the corresponding OTEL protobuf enum
+type SpanKind int32
+
+const (
+	// SpanKindInternal is used for internal operations
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is used for server-side handling of requests
+	SpanKindServer SpanKind = 2
+)
+
+// Span represents the corresponding OTEL protobuf message
+type Span struct {
+	TraceID           []byte
+	SpanID            []byte
+	ParentSpanID      []byte
+	Name              string
+	Kind              SpanKind
+	StartTimeUnixNano uint64
+	EndTimeUnixNano   uint64
+	Attributes        []*KeyValue
+	Status            Status
+}
+
+func (s *Span) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	mm.AppendBytes(1, s.TraceID)
+	mm.AppendBytes(2, s.SpanID)
+	mm.AppendBytes(4, s.ParentSpanID)
+	mm.AppendString(5, s.Name)
+	mm.AppendInt32(6, int32(s.Kind))
+	mm.AppendFixed64(7, s.StartTimeUnixNano)
+	mm.AppendFixed64(8, s.EndTimeUnixNano)
+	for _, a := range s.Attributes {
+		a.marshalProtobuf(mm.AppendMessage(9))
+	}
+	s.Status.marshalProtobuf(mm.AppendMessage(15))
+}
+
+func (s *Span) unmarshalProtobuf(src []byte) (err error) {
+	// message Span {
+	//   bytes trace_id = 1;
+	//   bytes span_id = 2;
+	//   bytes parent_span_id = 4;
+	//   string name = 5;
+	//   SpanKind kind = 6;
+	//   fixed64 start_time_unix_nano = 7;
+	//   fixed64 end_time_unix_nano = 8;
+	//   repeated KeyValue attributes = 9;
+	//   Status status = 15;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in Span: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			traceID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read TraceID")
+			}
+			s.TraceID = bytes.Clone(traceID)
+		case 2:
+			spanID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read SpanID")
+			}
+			s.SpanID = bytes.Clone(spanID)
+		case 4:
+			parentSpanID, ok := fc.Bytes()
+			if !ok {
+				return fmt.Errorf("cannot read ParentSpanID")
+			}
+			s.ParentSpanID = bytes.Clone(parentSpanID)
+		case 5:
+			name, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read Name")
+			}
+			s.Name = strings.Clone(name)
+		case 6:
+			kind, ok := fc.Int32()
+			if !ok {
+				return fmt.Errorf("cannot read Kind")
+			}
+			s.Kind = SpanKind(kind)
+		case 7:
+			ts, ok := fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read StartTimeUnixNano")
+			}
+			s.StartTimeUnixNano = ts
+		case 8:
+			ts, ok := fc.Fixed64()
+			if !ok {
+				return fmt.Errorf("cannot read EndTimeUnixNano")
+			}
+			s.EndTimeUnixNano = ts
+		case 9:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Attribute data")
+			}
+			a := &KeyValue{}
+			if err := a.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Attribute: %w", err)
+			}
+			s.Attributes = append(s.Attributes, a)
+		case 15:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read Status data")
+			}
+			if err := s.Status.unmarshalProtobuf(data); err != nil {
+				return fmt.Errorf("cannot unmarshal Status: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// StatusCode represents the corresponding OTEL protobuf enum
+type StatusCode int32
+
+const (
+	// StatusCodeUnset is the default status
+	StatusCodeUnset StatusCode = 0
+	// StatusCodeOk is used for successfully completed operations
+	StatusCodeOk StatusCode = 1
+	// StatusCodeError is used for failed operations
+	StatusCodeError StatusCode = 2
+)
+
+// Status represents the corresponding OTEL protobuf message
+type Status struct {
+	Message string
+	Code    StatusCode
+}
+
+func (st *Status) marshalProtobuf(mm *easyproto.MessageMarshaler) {
+	mm.AppendString(2, st.Message)
+	mm.AppendInt32(3, int32(st.Code))
+}
+
+func (st *Status) unmarshalProtobuf(src []byte) (err error) {
+	// message Status {
+	//   string message = 2;
+	//   StatusCode code = 3;
+	// }
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field in Status: %w", err)
+		}
+		switch fc.FieldNum {
+		case 2:
+			message, ok := fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read Message")
+			}
+			st.Message = strings.Clone(message)
+		case 3:
+			code, ok := fc.Int32()
+			if !ok {
+				return fmt.Errorf("cannot read Code")
+			}
+			st.Code = StatusCode(code)
+		}
+	}
+	return nil
+}
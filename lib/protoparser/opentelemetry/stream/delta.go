@@ -0,0 +1,398 @@
+package stream
+
+import (
+	"errors"
+	"flag"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
+)
+
+var (
+	convertDeltaToCumulative = flag.Bool("opentelemetry.convertDeltaToCumulative", false, "Whether to convert sums, histograms and exponential histograms with delta temporality "+
+		"to cumulative temporality for the metrics ingested via OpenTelemetry protocol. Such metrics are dropped if this flag isn't set; "+
+		"see https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#delta-temporality")
+	deltaToCumulativeMaxSeries = flag.Int("opentelemetry.deltaToCumulative.maxSeries", 1_000_000, "The maximum number of series with delta temporality to track "+
+		"when -opentelemetry.convertDeltaToCumulative is set. Samples for new series above this limit are dropped")
+	deltaToCumulativeStaleInterval = flag.Duration("opentelemetry.deltaToCumulative.staleInterval", 10*time.Minute, "The interval after which the state for series "+
+		"with delta temporality is dropped if it doesn't receive new samples when -opentelemetry.convertDeltaToCumulative is set. "+
+		"Samples received after that start the cumulative series from zero")
+)
+
+const (
+	deltaKindSum = iota
+	deltaKindHistogram
+	deltaKindExponentialHistogram
+)
+
+// isSupportedTemporality returns true if metrics with the given temporality can be ingested.
+func isSupportedTemporality(temporality pb.AggregationTemporality) bool {
+	if temporality == pb.AggregationTemporalityCumulative {
+		return true
+	}
+	return temporality == pb.AggregationTemporalityDelta && *convertDeltaToCumulative
+}
+
+// appendSampleFromDeltaNumericPoint converts p with delta temporality to cumulative temporality and appends it to wr.tss
+func (wr *writeContext) appendSampleFromDeltaNumericPoint(metricName string, p *pb.NumberDataPoint) {
+	var v float64
+	switch {
+	case p.IntValue != nil:
+		v = float64(*p.IntValue)
+	case p.DoubleValue != nil:
+		v = *p.DoubleValue
+	}
+	cp := *p
+	ok := wr.updateDeltaState(deltaKindSum, metricName, p.Attributes, p.StartTimeUnixNano, p.TimeUnixNano, p.Flags, func(st *deltaState) {
+		st.sum += v
+		sum := st.sum
+		cp.IntValue = nil
+		cp.DoubleValue = &sum
+	})
+	if ok {
+		wr.appendSampleFromNumericPoint(metricName, &cp)
+	}
+}
+
+// appendSamplesFromDeltaHistogram converts histogram p with delta temporality to cumulative temporality and appends it to wr.tss
+func (wr *writeContext) appendSamplesFromDeltaHistogram(metricName string, p *pb.HistogramDataPoint) {
+	if len(p.BucketCounts) == 0 || len(p.BucketCounts) != len(p.ExplicitBounds)+1 {
+		// Invalid histograms are dropped by appendSamplesFromHistogram without updating the state.
+		wr.appendSamplesFromHistogram(metricName, p)
+		return
+	}
+	cp := *p
+	ok := wr.updateDeltaState(deltaKindHistogram, metricName, p.Attributes, p.StartTimeUnixNano, p.TimeUnixNano, p.Flags, func(st *deltaState) {
+		st.addHistogram(p)
+		cp.Count = st.count
+		if p.Sum != nil {
+			sum := st.sum
+			cp.Sum = &sum
+		}
+		cp.BucketCounts = append([]uint64{}, st.bucketCounts...)
+	})
+	if ok {
+		wr.appendSamplesFromHistogram(metricName, &cp)
+	}
+}
+
+// appendSamplesFromDeltaExponentialHistogram converts histogram p with delta temporality to cumulative temporality and appends it to wr.tss
+func (wr *writeContext) appendSamplesFromDeltaExponentialHistogram(metricName string, p *pb.ExponentialHistogramDataPoint) {
+	cp := *p
+	ok := wr.updateDeltaState(deltaKindExponentialHistogram, metricName, p.Attributes, p.StartTimeUnixNano, p.TimeUnixNano, p.Flags, func(st *deltaState) {
+		st.addExponentialHistogram(p)
+		cp.Count = st.count
+		if p.Sum != nil {
+			sum := st.sum
+			cp.Sum = &sum
+		}
+		cp.Scale = st.scale
+		cp.ZeroCount = st.zeroCount
+		cp.Positive = st.positive.toPB()
+		cp.Negative = st.negative.toPB()
+	})
+	if ok {
+		wr.appendSamplesFromExponentialHistogram(metricName, &cp)
+	}
+}
+
+// updateDeltaState calls f for the state of the series with the given kind, metricName and attributes.
+//
+// f is called under the lock, so it must copy the needed data from the state.
+// It isn't called for points with NoRecordedValue flag - the state for such points is dropped,
+// so they can be passed as is in order to generate staleness markers.
+//
+// false is returned if the point must be dropped.
+func (wr *writeContext) updateDeltaState(kind byte, metricName string, attributes []*pb.KeyValue, startTimeUnixNano, timeUnixNano uint64, flags uint32, f func(st *deltaState)) bool {
+	wr.pointLabels = appendAttributesToPromLabels(wr.pointLabels[:0], attributes)
+
+	key := append(wr.deltaKey[:0], kind)
+	key = append(key, metricName...)
+	key = append(key, 0)
+	for _, labels := range [][]prompb.Label{wr.baseLabels, wr.pointLabels} {
+		for _, label := range labels {
+			key = append(key, label.Name...)
+			key = append(key, 0)
+			key = append(key, label.Value...)
+			key = append(key, 0)
+		}
+		key = append(key, 0)
+	}
+	wr.deltaKey = key
+
+	if timeUnixNano == 0 {
+		timeUnixNano = uint64(time.Now().UnixNano())
+	}
+	dc := getDeltaConverter()
+	if flags&uint32(1) != 0 {
+		dc.delete(key)
+		return true
+	}
+	if err := dc.update(key, startTimeUnixNano, timeUnixNano, f); err != nil {
+		skippedSampleLogger.Warnf("cannot convert point for %q from delta to cumulative temporality: %s; skipping it", metricName, err)
+		return false
+	}
+	return true
+}
+
+// deltaState holds the cumulative state for a single series with delta temporality.
+type deltaState struct {
+	// lastTimestamp is the timestamp in nanoseconds for the last accumulated point.
+	lastTimestamp uint64
+
+	// lastSeen is unix timestamp in seconds when the state was updated last time.
+	lastSeen uint64
+
+	// count and sum hold the accumulated count and sum for histograms. sum holds the accumulated value for sums.
+	count uint64
+	sum   float64
+
+	// bounds and bucketCounts hold the accumulated buckets for histograms.
+	bounds       []float64
+	bucketCounts []uint64
+
+	// the following fields hold the accumulated buckets for exponential histograms.
+	isInitialized bool
+	scale         int32
+	zeroThreshold float64
+	zeroCount     uint64
+	positive      expBuckets
+	negative      expBuckets
+}
+
+func (st *deltaState) addHistogram(p *pb.HistogramDataPoint) {
+	if !slices.Equal(st.bounds, p.ExplicitBounds) || len(st.bucketCounts) != len(p.BucketCounts) {
+		// Bucket bounds have been changed, so start accumulating from scratch.
+		// This results in counter reset for the converted series.
+		st.bounds = append(st.bounds[:0], p.ExplicitBounds...)
+		st.bucketCounts = append(st.bucketCounts[:0], make([]uint64, len(p.BucketCounts))...)
+		st.count = 0
+		st.sum = 0
+	}
+	st.count += p.Count
+	if p.Sum != nil {
+		st.sum += *p.Sum
+	}
+	for i, n := range p.BucketCounts {
+		st.bucketCounts[i] += n
+	}
+}
+
+func (st *deltaState) addExponentialHistogram(p *pb.ExponentialHistogramDataPoint) {
+	if !st.isInitialized || st.zeroThreshold != p.ZeroThreshold {
+		// Zero bucket width has been changed, so start accumulating from scratch.
+		// This results in counter reset for the converted series.
+		*st = deltaState{
+			lastTimestamp: st.lastTimestamp,
+			lastSeen:      st.lastSeen,
+			isInitialized: true,
+			scale:         p.Scale,
+			zeroThreshold: p.ZeroThreshold,
+		}
+	}
+
+	// Points may have different scales - merge them at the lowest scale.
+	// See https://opentelemetry.io/docs/specs/otel/metrics/data-model/#exponential-scale
+	scale := min(st.scale, p.Scale)
+	st.positive.downscale(st.scale - scale)
+	st.negative.downscale(st.scale - scale)
+	st.scale = scale
+	if p.Positive != nil {
+		st.positive.add(p.Positive.Offset, p.Positive.BucketCounts, p.Scale-scale)
+	}
+	if p.Negative != nil {
+		st.negative.add(p.Negative.Offset, p.Negative.BucketCounts, p.Scale-scale)
+	}
+
+	st.count += p.Count
+	if p.Sum != nil {
+		st.sum += *p.Sum
+	}
+	st.zeroCount += p.ZeroCount
+}
+
+// expBuckets holds exponential histogram buckets starting from the bucket with the index offset.
+type expBuckets struct {
+	offset int32
+	counts []uint64
+}
+
+func (eb *expBuckets) toPB() *pb.Buckets {
+	if len(eb.counts) == 0 {
+		return nil
+	}
+	return &pb.Buckets{
+		Offset:       eb.offset,
+		BucketCounts: append([]uint64{}, eb.counts...),
+	}
+}
+
+// downscale decreases the scale for eb by d, e.g. merges every 2^d adjacent buckets into a single bucket.
+func (eb *expBuckets) downscale(d int32) {
+	if d <= 0 || len(eb.counts) == 0 {
+		return
+	}
+	offset := eb.offset >> d
+	lastIdx := (eb.offset + int32(len(eb.counts)) - 1) >> d
+	counts := make([]uint64, lastIdx-offset+1)
+	for i, n := range eb.counts {
+		idx := (eb.offset + int32(i)) >> d
+		counts[idx-offset] += n
+	}
+	eb.offset = offset
+	eb.counts = counts
+}
+
+// add adds counts for buckets starting from offset to eb.
+//
+// The scale for the added buckets must be bigger by d than the scale for eb.
+func (eb *expBuckets) add(offset int32, counts []uint64, d int32) {
+	src := expBuckets{
+		offset: offset,
+		counts: counts,
+	}
+	src.downscale(d)
+	if len(src.counts) == 0 {
+		return
+	}
+	if len(eb.counts) == 0 {
+		eb.offset = src.offset
+		eb.counts = append(eb.counts[:0], src.counts...)
+		return
+	}
+
+	start := min(eb.offset, src.offset)
+	end := max(eb.offset+int32(len(eb.counts)), src.offset+int32(len(src.counts)))
+	if start != eb.offset || end != eb.offset+int32(len(eb.counts)) {
+		counts := make([]uint64, end-start)
+		copy(counts[eb.offset-start:], eb.counts)
+		eb.offset = start
+		eb.counts = counts
+	}
+	for i, n := range src.counts {
+		eb.counts[src.offset-start+int32(i)] += n
+	}
+}
+
+const deltaConverterShardsCount = 64
+
+// deltaConverter tracks the state for series with delta temporality.
+//
+// The state is lost on restart. This results in counter resets for the converted series,
+// which are properly handled by rate() and increase() functions.
+type deltaConverter struct {
+	shards            [deltaConverterShardsCount]deltaConverterShard
+	maxSeriesPerShard int
+	staleInterval     uint64
+}
+
+type deltaConverterShard struct {
+	mu          sync.Mutex
+	m           map[string]*deltaState
+	lastCleanup uint64
+}
+
+func newDeltaConverter(maxSeries int, staleInterval time.Duration) *deltaConverter {
+	dc := &deltaConverter{
+		maxSeriesPerShard: max(maxSeries/deltaConverterShardsCount, 1),
+		staleInterval:     max(uint64(staleInterval.Seconds()), 1),
+	}
+	for i := range dc.shards {
+		dc.shards[i].m = make(map[string]*deltaState)
+	}
+	return dc
+}
+
+var (
+	deltaConverterOnce   sync.Once
+	deltaConverterGlobal *deltaConverter
+)
+
+func getDeltaConverter() *deltaConverter {
+	deltaConverterOnce.Do(func() {
+		deltaConverterGlobal = newDeltaConverter(*deltaToCumulativeMaxSeries, *deltaToCumulativeStaleInterval)
+		_ = metrics.NewGauge(`vm_protoparser_delta_to_cumulative_series{type="opentelemetry"}`, func() float64 {
+			return float64(deltaConverterGlobal.seriesCount())
+		})
+	})
+	return deltaConverterGlobal
+}
+
+func (dc *deltaConverter) getShard(key []byte) *deltaConverterShard {
+	return &dc.shards[xxhash.Sum64(key)%deltaConverterShardsCount]
+}
+
+var (
+	errDeltaOutOfOrder  = errors.New("the point overlaps with the previously received points")
+	errDeltaSeriesLimit = errors.New("the limit on the number of tracked series is reached; see -opentelemetry.deltaToCumulative.maxSeries")
+)
+
+// update calls f for the state of the series with the given key.
+//
+// An error is returned without calling f if the point with the given timestamps overlaps with the previously accumulated points
+// or if the limit on the number of tracked series is reached.
+func (dc *deltaConverter) update(key []byte, startTimeUnixNano, timeUnixNano uint64, f func(st *deltaState)) error {
+	currentTime := fasttime.UnixTimestamp()
+	sh := dc.getShard(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if currentTime >= sh.lastCleanup+dc.staleInterval {
+		deadline := currentTime - dc.staleInterval
+		for k, st := range sh.m {
+			if st.lastSeen < deadline {
+				delete(sh.m, k)
+			}
+		}
+		sh.lastCleanup = currentTime
+	}
+
+	st := sh.m[string(key)]
+	if st == nil {
+		if len(sh.m) >= dc.maxSeriesPerShard {
+			rowsDroppedDeltaSeriesLimit.Inc()
+			return errDeltaSeriesLimit
+		}
+		st = &deltaState{}
+		sh.m[string(key)] = st
+	} else if timeUnixNano <= st.lastTimestamp || startTimeUnixNano != 0 && startTimeUnixNano < st.lastTimestamp {
+		rowsDroppedDeltaOutOfOrder.Inc()
+		return errDeltaOutOfOrder
+	}
+	f(st)
+	st.lastTimestamp = timeUnixNano
+	st.lastSeen = currentTime
+	return nil
+}
+
+// delete drops the state for the series with the given key.
+func (dc *deltaConverter) delete(key []byte) {
+	sh := dc.getShard(key)
+	sh.mu.Lock()
+	delete(sh.m, string(key))
+	sh.mu.Unlock()
+}
+
+func (dc *deltaConverter) seriesCount() int {
+	n := 0
+	for i := range dc.shards {
+		sh := &dc.shards[i]
+		sh.mu.Lock()
+		n += len(sh.m)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+var (
+	rowsDroppedDeltaOutOfOrder  = metrics.NewCounter(`vm_protoparser_rows_dropped_total{type="opentelemetry",reason="delta_out_of_order"}`)
+	rowsDroppedDeltaSeriesLimit = metrics.NewCounter(`vm_protoparser_rows_dropped_total{type="opentelemetry",reason="delta_series_limit_exceeded"}`)
+)
@@ -0,0 +1,251 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
+)
+
+func TestParseStreamDeltaToCumulative(t *testing.T) {
+	prevConvertDeltaToCumulative := *convertDeltaToCumulative
+	*convertDeltaToCumulative = true
+	defer func() {
+		*convertDeltaToCumulative = prevConvertDeltaToCumulative
+	}()
+
+	// f parses the given metrics in the given order, so the state is shared between them.
+	f := func(ms []*pb.Metric, resultExpected string) {
+		t.Helper()
+
+		var sb strings.Builder
+		for _, m := range ms {
+			req := &pb.ExportMetricsServiceRequest{
+				ResourceMetrics: []*pb.ResourceMetrics{
+					generateOTLPSamples([]*pb.Metric{m}),
+				},
+			}
+			err := ParseStream(bytes.NewBuffer(req.MarshalProtobuf(nil)), "", nil, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+				for _, ts := range tss {
+					for _, s := range ts.Samples {
+						fmt.Fprintf(&sb, "%s %v %d\n", prompb.LabelsToString(ts.Labels), s.Value, s.Timestamp)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("cannot parse protobuf: %s", err)
+			}
+		}
+		result := sb.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	deltaSum := func(name string, start, end time.Duration, v float64, flags uint32) *pb.Metric {
+		m := generateSum(name, "", true)
+		m.Sum.AggregationTemporality = pb.AggregationTemporalityDelta
+		p := m.Sum.DataPoints[0]
+		p.StartTimeUnixNano = uint64(start)
+		p.TimeUnixNano = uint64(end)
+		p.DoubleValue = &v
+		p.Flags = flags
+		return m
+	}
+
+	// sums are accumulated; overlapping points are dropped; the state is reset after NoRecordedValue point
+	f([]*pb.Metric{
+		deltaSum("delta-sum", 0, 10*time.Second, 5, 0),
+		deltaSum("delta-sum", 10*time.Second, 20*time.Second, 3, 0),
+		deltaSum("delta-sum", 10*time.Second, 15*time.Second, 100, 0),
+		deltaSum("delta-sum", 20*time.Second, 20*time.Second, 100, 0),
+		deltaSum("delta-sum", 25*time.Second, 30*time.Second, 1.5, 0),
+		deltaSum("delta-sum", 30*time.Second, 40*time.Second, 0, 1),
+		deltaSum("delta-sum", 40*time.Second, 50*time.Second, 2, 0),
+	}, `{__name__="delta-sum",job="vm",label5="value5"} 5 10000
+{__name__="delta-sum",job="vm",label5="value5"} 8 20000
+{__name__="delta-sum",job="vm",label5="value5"} 9.5 30000
+{__name__="delta-sum",job="vm",label5="value5"} NaN 40000
+{__name__="delta-sum",job="vm",label5="value5"} 2 50000
+`)
+
+	deltaHistogram := func(name string, end time.Duration, bounds []float64, counts []uint64, sum float64) *pb.Metric {
+		m := generateHistogram(name, "", true)
+		m.Histogram.AggregationTemporality = pb.AggregationTemporalityDelta
+		p := m.Histogram.DataPoints[0]
+		p.TimeUnixNano = uint64(end)
+		p.ExplicitBounds = bounds
+		p.BucketCounts = counts
+		p.Count = 0
+		for _, n := range counts {
+			p.Count += n
+		}
+		p.Sum = &sum
+		return m
+	}
+
+	// histograms are accumulated; the state is reset on bucket bounds change
+	f([]*pb.Metric{
+		deltaHistogram("delta-histogram", 10*time.Second, []float64{1, 5}, []uint64{1, 2, 3}, 10),
+		deltaHistogram("delta-histogram", 20*time.Second, []float64{1, 5}, []uint64{0, 1, 1}, 3),
+		deltaHistogram("delta-histogram", 30*time.Second, []float64{2}, []uint64{1, 1}, 1),
+	}, `{__name__="delta-histogram_count",job="vm",label2="value2"} 6 10000
+{__name__="delta-histogram_sum",job="vm",label2="value2"} 10 10000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="1"} 1 10000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="5"} 3 10000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="+Inf"} 6 10000
+{__name__="delta-histogram_count",job="vm",label2="value2"} 8 20000
+{__name__="delta-histogram_sum",job="vm",label2="value2"} 13 20000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="1"} 1 20000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="5"} 4 20000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="+Inf"} 8 20000
+{__name__="delta-histogram_count",job="vm",label2="value2"} 2 30000
+{__name__="delta-histogram_sum",job="vm",label2="value2"} 1 30000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="2"} 1 30000
+{__name__="delta-histogram_bucket",job="vm",label2="value2",le="+Inf"} 2 30000
+`)
+
+	deltaExpHistogram := func(name string, end time.Duration, scale int32, offset int32, counts []uint64, sum float64) *pb.Metric {
+		m := generateExpHistogram(name, "")
+		m.ExponentialHistogram.AggregationTemporality = pb.AggregationTemporalityDelta
+		p := m.ExponentialHistogram.DataPoints[0]
+		p.TimeUnixNano = uint64(end)
+		p.Scale = scale
+		p.Positive = &pb.Buckets{
+			Offset:       offset,
+			BucketCounts: counts,
+		}
+		p.Count = 0
+		for _, n := range counts {
+			p.Count += n
+		}
+		p.Sum = &sum
+		return m
+	}
+
+	// exponential histograms with distinct scales are merged at the lowest scale
+	f([]*pb.Metric{
+		deltaExpHistogram("delta-exp-histogram", 10*time.Second, 1, 0, []uint64{1, 2, 3}, 10),
+		deltaExpHistogram("delta-exp-histogram", 20*time.Second, 0, 0, []uint64{4}, 6),
+	}, `{__name__="delta-exp-histogram_count",job="vm",label1="value1"} 6 10000
+{__name__="delta-exp-histogram_sum",job="vm",label1="value1"} 10 10000
+{__name__="delta-exp-histogram_bucket",job="vm",label1="value1",vmrange="1.000e+00...1.414e+00"} 1 10000
+{__name__="delta-exp-histogram_bucket",job="vm",label1="value1",vmrange="1.414e+00...2.000e+00"} 2 10000
+{__name__="delta-exp-histogram_bucket",job="vm",label1="value1",vmrange="2.000e+00...2.828e+00"} 3 10000
+{__name__="delta-exp-histogram_count",job="vm",label1="value1"} 10 20000
+{__name__="delta-exp-histogram_sum",job="vm",label1="value1"} 16 20000
+{__name__="delta-exp-histogram_bucket",job="vm",label1="value1",vmrange="1.000e+00...2.000e+00"} 7 20000
+{__name__="delta-exp-histogram_bucket",job="vm",label1="value1",vmrange="2.000e+00...4.000e+00"} 3 20000
+`)
+
+	// delta metrics are dropped if -opentelemetry.convertDeltaToCumulative isn't set
+	*convertDeltaToCumulative = false
+	f([]*pb.Metric{
+		deltaSum("delta-sum-disabled", 0, 10*time.Second, 5, 0),
+		deltaHistogram("delta-histogram-disabled", 10*time.Second, []float64{1}, []uint64{1, 2}, 3),
+		deltaExpHistogram("delta-exp-histogram-disabled", 10*time.Second, 0, 0, []uint64{1}, 1),
+	}, ``)
+}
+
+func TestDeltaConverterUpdate(t *testing.T) {
+	dc := newDeltaConverter(deltaConverterShardsCount, time.Hour)
+
+	f := func(key string, start, end uint64, errExpected error) {
+		t.Helper()
+
+		err := dc.update([]byte(key), start, end, func(_ *deltaState) {})
+		if err != errExpected {
+			t.Fatalf("unexpected error for key=%q, start=%d, end=%d; got %v; want %v", key, start, end, err, errExpected)
+		}
+	}
+
+	f("foo", 0, 10, nil)
+	f("foo", 10, 20, nil)
+
+	// point with the same timestamp
+	f("foo", 10, 20, errDeltaOutOfOrder)
+
+	// overlapping point
+	f("foo", 15, 30, errDeltaOutOfOrder)
+
+	// gap between points
+	f("foo", 40, 50, nil)
+
+	// every shard can hold only a single series
+	sh := dc.getShard([]byte("foo"))
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("bar_%d", i)
+		if dc.getShard([]byte(key)) == sh {
+			f(key, 0, 10, errDeltaSeriesLimit)
+			break
+		}
+	}
+
+	// the state is dropped
+	dc.delete([]byte("foo"))
+	f("foo", 0, 10, nil)
+}
+
+func TestExpBucketsDownscale(t *testing.T) {
+	f := func(offset int32, counts []uint64, d, offsetExpected int32, countsExpected []uint64) {
+		t.Helper()
+
+		eb := expBuckets{
+			offset: offset,
+			counts: counts,
+		}
+		eb.downscale(d)
+		if eb.offset != offsetExpected {
+			t.Fatalf("unexpected offset; got %d; want %d", eb.offset, offsetExpected)
+		}
+		if !reflect.DeepEqual(eb.counts, countsExpected) {
+			t.Fatalf("unexpected counts; got %v; want %v", eb.counts, countsExpected)
+		}
+	}
+
+	f(0, nil, 1, 0, nil)
+	f(3, []uint64{1, 2}, 0, 3, []uint64{1, 2})
+	f(0, []uint64{1, 2, 3, 4, 5}, 1, 0, []uint64{3, 7, 5})
+	f(1, []uint64{1, 2, 3, 4, 5}, 1, 0, []uint64{1, 5, 9})
+	f(-3, []uint64{1, 2, 3, 4}, 1, -2, []uint64{1, 5, 4})
+	f(-3, []uint64{1, 2, 3, 4}, 2, -1, []uint64{6, 4})
+}
+
+func TestExpBucketsAdd(t *testing.T) {
+	f := func(offset int32, counts []uint64, srcOffset int32, srcCounts []uint64, d, offsetExpected int32, countsExpected []uint64) {
+		t.Helper()
+
+		eb := expBuckets{
+			offset: offset,
+			counts: counts,
+		}
+		eb.add(srcOffset, srcCounts, d)
+		if eb.offset != offsetExpected {
+			t.Fatalf("unexpected offset; got %d; want %d", eb.offset, offsetExpected)
+		}
+		if !reflect.DeepEqual(eb.counts, countsExpected) {
+			t.Fatalf("unexpected counts; got %v; want %v", eb.counts, countsExpected)
+		}
+	}
+
+	// add to empty buckets
+	f(0, nil, 2, []uint64{1, 2}, 0, 2, []uint64{1, 2})
+
+	// add empty buckets
+	f(2, []uint64{1, 2}, 0, nil, 0, 2, []uint64{1, 2})
+
+	// overlapping buckets
+	f(2, []uint64{1, 2}, 3, []uint64{3, 4}, 0, 2, []uint64{1, 5, 4})
+
+	// src buckets before dst buckets
+	f(2, []uint64{1, 2}, -1, []uint64{3}, 0, -1, []uint64{3, 0, 0, 1, 2})
+
+	// src buckets at the higher scale
+	f(0, []uint64{1, 2}, 0, []uint64{1, 1, 1, 1}, 1, 0, []uint64{3, 4})
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
@@ -88,13 +89,18 @@ func (wr *writeContext) appendFromScopeMetrics(sc *pb.ScopeMetrics, metadataList
 				metadata.Type = uint32(prompb.MetricMetadataGAUGE)
 			}
 		case m.Sum != nil:
-			if m.Sum.AggregationTemporality != pb.AggregationTemporalityCumulative {
+			if !isSupportedTemporality(m.Sum.AggregationTemporality) {
 				rowsDroppedUnsupportedSum.Inc()
-				skippedSampleLogger.Warnf("unsupported delta temporality for %q ('sum'): skipping it", metricName)
+				skippedSampleLogger.Warnf("unsupported delta temporality for %q ('sum'): skipping it; see -opentelemetry.convertDeltaToCumulative", metricName)
 				continue
 			}
+			isDelta := m.Sum.AggregationTemporality == pb.AggregationTemporalityDelta
 			for _, p := range m.Sum.DataPoints {
-				wr.appendSampleFromNumericPoint(metricName, p)
+				if isDelta {
+					wr.appendSampleFromDeltaNumericPoint(metricName, p)
+				} else {
+					wr.appendSampleFromNumericPoint(metricName, p)
+				}
 			}
 			if m.Sum.IsMonotonic {
 				metadata.Type = uint32(prompb.MetricMetadataCOUNTER)
@@ -115,23 +121,33 @@ func (wr *writeContext) appendFromScopeMetrics(sc *pb.ScopeMetrics, metadataList
 			}
 			metadata.Type = uint32(prompb.MetricMetadataSUMMARY)
 		case m.Histogram != nil:
-			if m.Histogram.AggregationTemporality != pb.AggregationTemporalityCumulative {
+			if !isSupportedTemporality(m.Histogram.AggregationTemporality) {
 				rowsDroppedUnsupportedHistogram.Inc()
-				skippedSampleLogger.Warnf("unsupported delta temporality for %q ('histogram'): skipping it", metricName)
+				skippedSampleLogger.Warnf("unsupported delta temporality for %q ('histogram'): skipping it; see -opentelemetry.convertDeltaToCumulative", metricName)
 				continue
 			}
+			isDelta := m.Histogram.AggregationTemporality == pb.AggregationTemporalityDelta
 			for _, p := range m.Histogram.DataPoints {
-				wr.appendSamplesFromHistogram(metricName, p)
+				if isDelta {
+					wr.appendSamplesFromDeltaHistogram(metricName, p)
+				} else {
+					wr.appendSamplesFromHistogram(metricName, p)
+				}
 			}
 			metadata.Type = uint32(prompb.MetricMetadataHISTOGRAM)
 		case m.ExponentialHistogram != nil:
-			if m.ExponentialHistogram.AggregationTemporality != pb.AggregationTemporalityCumulative {
+			if !isSupportedTemporality(m.ExponentialHistogram.AggregationTemporality) {
 				rowsDroppedUnsupportedExponentialHistogram.Inc()
-				skippedSampleLogger.Warnf("unsupported delta temporality for %q ('exponential histogram'): skipping it", metricName)
+				skippedSampleLogger.Warnf("unsupported delta temporality for %q ('exponential histogram'): skipping it; see -opentelemetry.convertDeltaToCumulative", metricName)
 				continue
 			}
+			isDelta := m.ExponentialHistogram.AggregationTemporality == pb.AggregationTemporalityDelta
 			for _, p := range m.ExponentialHistogram.DataPoints {
-				wr.appendSamplesFromExponentialHistogram(metricName, p)
+				if isDelta {
+					wr.appendSamplesFromDeltaExponentialHistogram(metricName, p)
+				} else {
+					wr.appendSamplesFromExponentialHistogram(metricName, p)
+				}
 			}
 			metadata.Type = uint32(prompb.MetricMetadataHISTOGRAM)
 		default:
@@ -170,6 +186,7 @@ func (wr *writeContext) appendSampleFromNumericPoint(metricName string, p *pb.Nu
 	wr.pointLabels = appendAttributesToPromLabels(wr.pointLabels[:0], p.Attributes)
 
 	wr.appendSample(metricName, t, v, isStale)
+	wr.appendExemplars(p.Exemplars, math.Inf(-1), math.Inf(1))
 }
 
 // appendSamplesFromSummary appends summary p to wr.tss
@@ -209,13 +226,17 @@ func (wr *writeContext) appendSamplesFromHistogram(metricName string, p *pb.Hist
 	}
 
 	var cumulative uint64
+	lowerBound := math.Inf(-1)
 	for index, bound := range p.ExplicitBounds {
 		cumulative += p.BucketCounts[index]
 		boundLabelValue := strconv.FormatFloat(bound, 'f', -1, 64)
 		wr.appendSampleWithExtraLabel(metricName+"_bucket", "le", boundLabelValue, t, float64(cumulative), isStale)
+		wr.appendExemplars(p.Exemplars, lowerBound, bound)
+		lowerBound = bound
 	}
 	cumulative += p.BucketCounts[len(p.BucketCounts)-1]
 	wr.appendSampleWithExtraLabel(metricName+"_bucket", "le", "+Inf", t, float64(cumulative), isStale)
+	wr.appendExemplars(p.Exemplars, lowerBound, math.Inf(1))
 }
 
 // appendSamplesFromExponentialHistogram appends histogram p to wr.tss
@@ -223,6 +244,10 @@ func (wr *writeContext) appendSamplesFromExponentialHistogram(metricName string,
 	t := int64(p.TimeUnixNano / 1e6)
 	isStale := (p.Flags)&uint32(1) != 0
 	wr.pointLabels = appendAttributesToPromLabels(wr.pointLabels[:0], p.Attributes)
+	if nativehistogram.IsEnabled() {
+		wr.appendNativeHistogramFromExponentialHistogram(metricName, p, t, isStale)
+		return
+	}
 	wr.appendSample(metricName+"_count", t, float64(p.Count), isStale)
 	if p.Sum == nil {
 		// fast path, convert metric as simple counter.
@@ -263,6 +288,37 @@ func (wr *writeContext) appendSamplesFromExponentialHistogram(metricName string,
 	}
 }
 
+// appendNativeHistogramFromExponentialHistogram appends histogram p to wr.tss as a set of native histogram components.
+//
+// See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#native-histograms
+func (wr *writeContext) appendNativeHistogramFromExponentialHistogram(metricName string, p *pb.ExponentialHistogramDataPoint, t int64, isStale bool) {
+	sum := math.NaN()
+	if p.Sum != nil {
+		sum = *p.Sum
+	}
+	var positiveOffset, negativeOffset int32
+	var positive, negative []uint64
+	if p.Positive != nil {
+		positiveOffset = p.Positive.Offset
+		positive = p.Positive.BucketCounts
+	}
+	if p.Negative != nil {
+		negativeOffset = p.Negative.Offset
+		negative = p.Negative.BucketCounts
+	}
+	var err error
+	wr.components, err = nativehistogram.AppendExponentialComponents(wr.components[:0], float64(p.Count), sum, p.Scale, p.ZeroThreshold, float64(p.ZeroCount),
+		positiveOffset, positive, negativeOffset, negative)
+	if err != nil {
+		rowsDroppedUnsupportedExponentialHistogram.Inc()
+		skippedSampleLogger.Warnf("cannot convert exponential histogram %q to native histogram: %s", metricName, err)
+		return
+	}
+	for _, c := range wr.components {
+		wr.appendSampleWithExtraLabel(metricName, nativehistogram.ComponentLabel, c.Name, t, c.Value, isStale)
+	}
+}
+
 // appendSample appends sample with the given metricName to wr.tss
 func (wr *writeContext) appendSample(metricName string, t int64, v float64, isStale bool) {
 	wr.appendSampleWithExtraLabel(metricName, "", "", t, v, isStale)
@@ -311,6 +367,55 @@ func (wr *writeContext) appendSampleWithExtraLabel(metricName, labelName, labelV
 	rowsRead.Inc()
 }
 
+// appendExemplars attaches exemplars with values in the range (lowerBound ... upperBound] to the last time series at wr.tss.
+//
+// This allows attaching histogram exemplars to the corresponding buckets in the same way as Prometheus does.
+func (wr *writeContext) appendExemplars(exemplars []*pb.Exemplar, lowerBound, upperBound float64) {
+	if len(exemplars) == 0 {
+		return
+	}
+	exemplarsPool := wr.exemplarsPool
+	exemplarsLen := len(exemplarsPool)
+	labelsPool := wr.exemplarLabelsPool
+	for _, e := range exemplars {
+		var v float64
+		switch {
+		case e.IntValue != nil:
+			v = float64(*e.IntValue)
+		case e.DoubleValue != nil:
+			v = *e.DoubleValue
+		}
+		if v <= lowerBound || v > upperBound {
+			continue
+		}
+		labelsLen := len(labelsPool)
+		labelsPool = appendAttributesToPromLabels(labelsPool, e.FilteredAttributes)
+		if e.TraceID != "" {
+			labelsPool = append(labelsPool, prompb.Label{
+				Name:  "trace_id",
+				Value: e.TraceID,
+			})
+		}
+		if e.SpanID != "" {
+			labelsPool = append(labelsPool, prompb.Label{
+				Name:  "span_id",
+				Value: e.SpanID,
+			})
+		}
+		exemplarsPool = append(exemplarsPool, prompb.Exemplar{
+			Labels:    labelsPool[labelsLen:],
+			Value:     v,
+			Timestamp: int64(e.TimeUnixNano / 1e6),
+		})
+	}
+	if len(exemplarsPool) > exemplarsLen {
+		ts := &wr.tss[len(wr.tss)-1]
+		ts.Exemplars = exemplarsPool[exemplarsLen:]
+	}
+	wr.exemplarsPool = exemplarsPool
+	wr.exemplarLabelsPool = labelsPool
+}
+
 // appendAttributesToPromLabels appends attributes to dst and returns the result.
 func appendAttributesToPromLabels(dst []prompb.Label, attributes []*pb.KeyValue) []prompb.Label {
 	for _, at := range attributes {
@@ -335,8 +440,16 @@ type writeContext struct {
 	pointLabels []prompb.Label
 
 	// pools are used for reducing memory allocations when parsing time series
-	labelsPool  []prompb.Label
-	samplesPool []prompb.Sample
+	labelsPool         []prompb.Label
+	samplesPool        []prompb.Sample
+	exemplarsPool      []prompb.Exemplar
+	exemplarLabelsPool []prompb.Label
+
+	// components is a buffer for native histogram components
+	components []nativehistogram.Component
+
+	// deltaKey is a buffer for the key of the series with delta temporality
+	deltaKey []byte
 }
 
 func (wr *writeContext) reset() {
@@ -349,6 +462,15 @@ func (wr *writeContext) reset() {
 
 	wr.labelsPool = resetLabels(wr.labelsPool)
 	wr.samplesPool = wr.samplesPool[:0]
+
+	clear(wr.exemplarsPool)
+	wr.exemplarsPool = wr.exemplarsPool[:0]
+	wr.exemplarLabelsPool = resetLabels(wr.exemplarLabelsPool)
+
+	clear(wr.components)
+	wr.components = wr.components[:0]
+
+	wr.deltaKey = wr.deltaKey[:0]
 }
 
 func resetLabels(labels []prompb.Label) []prompb.Label {
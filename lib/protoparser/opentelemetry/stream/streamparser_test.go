@@ -2,6 +2,7 @@ package stream
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"reflect"
@@ -447,6 +448,158 @@ func TestParseStream(t *testing.T) {
 	)
 }
 
+func TestParseStreamExemplars(t *testing.T) {
+	f := func(m *pb.Metric, exemplarsExpected map[string][]prompb.Exemplar) {
+		t.Helper()
+
+		req := &pb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*pb.ResourceMetrics{
+				generateOTLPSamples([]*pb.Metric{m}),
+			},
+		}
+		checkSeries := func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+			exemplars := make(map[string][]prompb.Exemplar)
+			for _, ts := range tss {
+				if len(ts.Exemplars) > 0 {
+					exemplars[prompb.LabelsToString(ts.Labels)] = append([]prompb.Exemplar{}, ts.Exemplars...)
+				}
+			}
+			if !reflect.DeepEqual(exemplars, exemplarsExpected) {
+				return fmt.Errorf("unexpected exemplars\ngot\n%v\nwant\n%v", exemplars, exemplarsExpected)
+			}
+			return nil
+		}
+		if err := checkParseStream(req.MarshalProtobuf(nil), checkSeries); err != nil {
+			t.Fatalf("cannot parse protobuf: %s", err)
+		}
+	}
+
+	exemplar := func(v float64, spanID string) *pb.Exemplar {
+		return &pb.Exemplar{
+			FilteredAttributes: attributesFromKV("user", "foo"),
+			TimeUnixNano:       uint64(20 * time.Second),
+			DoubleValue:        &v,
+			TraceID:            "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:             spanID,
+		}
+	}
+	exemplarLabels := func(spanID string) []prompb.Label {
+		return []prompb.Label{
+			{
+				Name:  "user",
+				Value: "foo",
+			},
+			{
+				Name:  "trace_id",
+				Value: "4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+			{
+				Name:  "span_id",
+				Value: spanID,
+			},
+		}
+	}
+
+	// gauge exemplars
+	gauge := generateGauge("my-gauge", "")
+	gauge.Gauge.DataPoints[0].Exemplars = []*pb.Exemplar{exemplar(15, "00f067aa0ba902b7")}
+	f(gauge, map[string][]prompb.Exemplar{
+		`{__name__="my-gauge",job="vm",label1="value1"}`: {
+			{
+				Labels:    exemplarLabels("00f067aa0ba902b7"),
+				Value:     15,
+				Timestamp: 20000,
+			},
+		},
+	})
+
+	// histogram exemplars are attached to the matching buckets
+	histogram := generateHistogram("my-histogram", "", true)
+	histogram.Histogram.DataPoints[0].Exemplars = []*pb.Exemplar{
+		exemplar(0.3, "00f067aa0ba902b7"),
+		exemplar(0.5, "00f067aa0ba902b8"),
+		exemplar(10, "00f067aa0ba902b9"),
+	}
+	f(histogram, map[string][]prompb.Exemplar{
+		`{__name__="my-histogram_bucket",job="vm",label2="value2",le="0.5"}`: {
+			{
+				Labels:    exemplarLabels("00f067aa0ba902b7"),
+				Value:     0.3,
+				Timestamp: 20000,
+			},
+			{
+				Labels:    exemplarLabels("00f067aa0ba902b8"),
+				Value:     0.5,
+				Timestamp: 20000,
+			},
+		},
+		`{__name__="my-histogram_bucket",job="vm",label2="value2",le="+Inf"}`: {
+			{
+				Labels:    exemplarLabels("00f067aa0ba902b9"),
+				Value:     10,
+				Timestamp: 20000,
+			},
+		},
+	})
+}
+
+func TestParseStreamNativeHistograms(t *testing.T) {
+	if err := flag.Set("enableNativeHistograms", "true"); err != nil {
+		t.Fatalf("cannot enable native histograms: %s", err)
+	}
+	defer func() {
+		if err := flag.Set("enableNativeHistograms", "false"); err != nil {
+			t.Fatalf("cannot disable native histograms: %s", err)
+		}
+	}()
+
+	m := generateExpHistogram("test-histogram", "")
+	dp := m.ExponentialHistogram.DataPoints[0]
+	dp.ZeroCount = 2
+	dp.ZeroThreshold = 0.5
+	dp.Negative = &pb.Buckets{
+		Offset:       -2,
+		BucketCounts: []uint64{3},
+	}
+	req := &pb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*pb.ResourceMetrics{
+			generateOTLPSamples([]*pb.Metric{m}),
+		},
+	}
+	resultExpected := map[string]float64{
+		`{__name__="test-histogram",__nh__="count",job="vm",label1="value1"}`:    20,
+		`{__name__="test-histogram",__nh__="sum",job="vm",label1="value1"}`:      4578,
+		`{__name__="test-histogram",__nh__="zero:0.5",job="vm",label1="value1"}`: 2,
+		`{__name__="test-histogram",__nh__="pos:7:8",job="vm",label1="value1"}`:  0,
+		`{__name__="test-histogram",__nh__="pos:7:9",job="vm",label1="value1"}`:  0,
+		`{__name__="test-histogram",__nh__="pos:7:10",job="vm",label1="value1"}`: 0,
+		`{__name__="test-histogram",__nh__="pos:7:11",job="vm",label1="value1"}`: 0,
+		`{__name__="test-histogram",__nh__="pos:7:12",job="vm",label1="value1"}`: 5,
+		`{__name__="test-histogram",__nh__="pos:7:13",job="vm",label1="value1"}`: 10,
+		`{__name__="test-histogram",__nh__="pos:7:14",job="vm",label1="value1"}`: 0,
+		`{__name__="test-histogram",__nh__="pos:7:15",job="vm",label1="value1"}`: 0,
+		`{__name__="test-histogram",__nh__="pos:7:16",job="vm",label1="value1"}`: 1,
+		`{__name__="test-histogram",__nh__="neg:7:-1",job="vm",label1="value1"}`: 3,
+	}
+	checkSeries := func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+		result := make(map[string]float64)
+		for _, ts := range tss {
+			sortLabels(ts.Labels)
+			if len(ts.Samples) != 1 || ts.Samples[0].Timestamp != 15000 {
+				return fmt.Errorf("unexpected samples for %s: %v", prompb.LabelsToString(ts.Labels), ts.Samples)
+			}
+			result[prompb.LabelsToString(ts.Labels)] = ts.Samples[0].Value
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			return fmt.Errorf("unexpected series\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+		return nil
+	}
+	if err := checkParseStream(req.MarshalProtobuf(nil), checkSeries); err != nil {
+		t.Fatalf("cannot parse protobuf: %s", err)
+	}
+}
+
 func checkParseStream(data []byte, checkSeries func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error) error {
 	// Verify parsing without compression
 	if err := ParseStream(bytes.NewBuffer(data), "", nil, checkSeries); err != nil {
@@ -108,18 +108,27 @@ type Row struct {
 	Tags      []Tag
 	Value     float64
 	Timestamp int64
+
+	// Exemplar is an optional exemplar attached to the row.
+	Exemplar Exemplar
 }
 
-func (r *Row) reset() {
-	*r = Row{}
+// Exemplar is an OpenMetrics exemplar.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	// Tags contains exemplar labels such as trace_id. Exemplars without labels are ignored.
+	Tags []Tag
+
+	// Value is exemplar value.
+	Value float64
+
+	// Timestamp is exemplar timestamp in milliseconds. It is set to 0 if the exemplar has no timestamp.
+	Timestamp int64
 }
 
-func skipTrailingComment(s string) string {
-	n := strings.IndexByte(s, '#')
-	if n < 0 {
-		return s
-	}
-	return s[:n]
+func (r *Row) reset() {
+	*r = Row{}
 }
 
 func skipLeadingWhitespace(s string) string {
@@ -159,6 +168,12 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 	r.reset()
 	s = skipLeadingWhitespace(s)
 	n := strings.IndexByte(s, '{')
+	if n >= 0 {
+		if m := nextWhitespace(s[:n]); m >= 0 && len(skipLeadingWhitespace(s[m:n])) > 0 {
+			// The '{' belongs to the exemplar for the metric without tags.
+			n = -1
+		}
+	}
 	if n >= 0 {
 		// Tags found. Parse them.
 		r.Metric = skipTrailingWhitespace(s[:n])
@@ -188,7 +203,11 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 		return tagsPool, fmt.Errorf("metric cannot be empty")
 	}
 	s = skipLeadingWhitespace(s)
-	s = skipTrailingComment(s)
+	if n := strings.IndexByte(s, '#'); n >= 0 {
+		// Invalid exemplars are ignored in the same way as trailing comments.
+		tagsPool = r.Exemplar.unmarshal(s[n+1:], tagsPool, noEscapes)
+		s = s[:n]
+	}
 	if len(s) == 0 {
 		return tagsPool, fmt.Errorf("value cannot be empty")
 	}
@@ -230,6 +249,47 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 	return tagsPool, nil
 }
 
+// unmarshal parses exemplar from s in the format `{labels} value [timestamp]`.
+//
+// Exemplar tags are stored in tagsPool. e is left empty if s doesn't contain valid exemplar.
+func (e *Exemplar) unmarshal(s string, tagsPool []Tag, noEscapes bool) []Tag {
+	s = skipLeadingWhitespace(s)
+	if len(s) == 0 || s[0] != '{' {
+		// This is a trailing comment.
+		return tagsPool
+	}
+	tagsStart := len(tagsPool)
+	var r Row
+	s, tagsPool, err := r.unmarshalTags(tagsPool, s[1:], noEscapes)
+	if err != nil || len(tagsPool) == tagsStart {
+		return tagsPool[:tagsStart]
+	}
+	s = skipTrailingWhitespace(skipLeadingWhitespace(s))
+	value := s
+	timestamp := ""
+	if n := nextWhitespace(s); n >= 0 {
+		value = s[:n]
+		timestamp = skipLeadingWhitespace(s[n+1:])
+	}
+	v, err := fastfloat.Parse(value)
+	if err != nil {
+		return tagsPool[:tagsStart]
+	}
+	var ts float64
+	if timestamp != "" {
+		// OpenMetrics exemplar timestamps are in Unix seconds.
+		ts, err = fastfloat.Parse(timestamp)
+		if err != nil {
+			return tagsPool[:tagsStart]
+		}
+	}
+	tags := tagsPool[tagsStart:]
+	e.Tags = tags[:len(tags):len(tags)]
+	e.Value = v
+	e.Timestamp = int64(ts * 1000)
+	return tagsPool
+}
+
 var rowsReadScrape = metrics.NewCounter(`vm_protoparser_rows_read_total{type="promscrape"}`)
 var metadataReadScrape = metrics.NewCounter(`vm_protoparser_metadata_read_total{type="promscrape"}`)
 
@@ -377,6 +377,39 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 		}},
 	})
 
+	// Exemplars without timestamp and invalid exemplars
+	f(`foo 1 # {trace_id="abc",span_id="def"} 0.5
+	   bar 2 # {trace_id="abc"} x
+	   baz 3 # {} 1`, &Rows{
+		Rows: []Row{
+			{
+				Metric: "foo",
+				Value:  1,
+				Exemplar: Exemplar{
+					Tags: []Tag{
+						{
+							Key:   "trace_id",
+							Value: "abc",
+						},
+						{
+							Key:   "span_id",
+							Value: "def",
+						},
+					},
+					Value: 0.5,
+				},
+			},
+			{
+				Metric: "bar",
+				Value:  2,
+			},
+			{
+				Metric: "baz",
+				Value:  3,
+			},
+		},
+	})
+
 	// Exemplars - see https://github.com/OpenObservability/OpenMetrics/blob/master/OpenMetrics.md#exemplars-1
 	f(`foo_bucket{le="10",a="#b"} 17 # {trace_id="oHg5SJ#YRHA0"} 9.8 1520879607.789
 	   abc 123 456 # foobar
@@ -395,6 +428,16 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 					},
 				},
 				Value: 17,
+				Exemplar: Exemplar{
+					Tags: []Tag{
+						{
+							Key:   "trace_id",
+							Value: "oHg5SJ#YRHA0",
+						},
+					},
+					Value:     9.8,
+					Timestamp: 1520879607789,
+				},
 			},
 			{
 				Metric:    "abc",
@@ -908,6 +951,16 @@ cassandra_token_ownership_ratio 78.9
 					},
 				},
 				Value: 17,
+				Exemplar: Exemplar{
+					Tags: []Tag{
+						{
+							Key:   "trace_id",
+							Value: "oHg5SJ#YRHA0",
+						},
+					},
+					Value:     9.8,
+					Timestamp: 1520879607789,
+				},
 			},
 			{
 				Metric:    "abc",
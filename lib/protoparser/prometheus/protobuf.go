@@ -0,0 +1,770 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/nativehistogram"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+// Metric types for io.prometheus.client.MetricFamily.
+//
+// See https://github.com/prometheus/client_model/blob/master/io/prometheus/client/metrics.proto
+const (
+	protobufTypeCounter        = 0
+	protobufTypeGauge          = 1
+	protobufTypeSummary        = 2
+	protobufTypeUntyped        = 3
+	protobufTypeHistogram      = 4
+	protobufTypeGaugeHistogram = 5
+)
+
+// UnmarshalProtobuf unmarshals Prometheus protobuf exposition format from src into dstRows and dstMeta.
+//
+// src must contain a sequence of varint length-delimited io.prometheus.client.MetricFamily messages.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/#protobuf-format
+//
+// Summaries and classic histograms are converted to the same rows as for Prometheus text exposition format.
+// Native histograms are converted to rows with nativehistogram.ComponentLabel if -enableNativeHistograms is set.
+//
+// src shouldn't be modified while dstRows and dstMeta are in use.
+func UnmarshalProtobuf(dstRows Rows, dstMeta MetadataRows, src []byte, errLogger func(s string)) (Rows, MetadataRows) {
+	if errLogger == nil {
+		errLogger = stdErrLogger
+	}
+	rowsLen := len(dstRows.Rows)
+	mdLen := len(dstMeta.Rows)
+
+	var p protobufParser
+	p.rows = dstRows.Rows
+	p.tagsPool = dstRows.tagsPool
+	p.mds = dstMeta.Rows
+	for len(src) > 0 {
+		size, n := binary.Uvarint(src)
+		if n <= 0 || size > uint64(len(src)-n) {
+			errLogger(fmt.Sprintf("cannot read MetricFamily message size from protobuf response; skipping the remaining %d bytes", len(src)))
+			break
+		}
+		data := src[n : n+int(size)]
+		src = src[n+int(size):]
+
+		// Roll back partially parsed rows and metadata on error.
+		rowsLenPrev := len(p.rows)
+		tagsLenPrev := len(p.tagsPool)
+		mdsLenPrev := len(p.mds)
+		if err := p.unmarshalMetricFamily(data); err != nil {
+			errLogger(fmt.Sprintf("cannot unmarshal MetricFamily from protobuf response: %s", err))
+			clear(p.rows[rowsLenPrev:])
+			p.rows = p.rows[:rowsLenPrev]
+			p.tagsPool = p.tagsPool[:tagsLenPrev]
+			p.mds = p.mds[:mdsLenPrev]
+		}
+	}
+
+	dstRows.Rows = p.rows
+	dstRows.tagsPool = p.tagsPool
+	dstMeta.Rows = p.mds
+	rowsReadScrape.Add(len(dstRows.Rows) - rowsLen)
+	metadataReadScrape.Add(len(dstMeta.Rows) - mdLen)
+	return dstRows, dstMeta
+}
+
+type protobufParser struct {
+	rows     []Row
+	tagsPool []Tag
+	mds      []Metadata
+
+	// metrics holds Metric messages for the currently parsed MetricFamily.
+	metrics [][]byte
+
+	// h is used for converting native histograms to components.
+	h          prompb.Histogram
+	components []nativehistogram.Component
+}
+
+func (p *protobufParser) unmarshalMetricFamily(src []byte) (err error) {
+	// message MetricFamily {
+	//   string name = 1;
+	//   string help = 2;
+	//   MetricType type = 3;
+	//   repeated Metric metric = 4;
+	// }
+	var name, help string
+	var typ uint64
+	p.metrics = p.metrics[:0]
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			name, ok = fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read name")
+			}
+		case 2:
+			help, ok = fc.String()
+			if !ok {
+				return fmt.Errorf("cannot read help")
+			}
+		case 3:
+			typ, ok = fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read type")
+			}
+		case 4:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read metric")
+			}
+			p.metrics = append(p.metrics, data)
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("missing metric family name")
+	}
+
+	md := Metadata{
+		Metric: name,
+		Help:   help,
+	}
+	switch typ {
+	case protobufTypeCounter:
+		md.Type = uint32(prompb.MetricMetadataCOUNTER)
+	case protobufTypeGauge:
+		md.Type = uint32(prompb.MetricMetadataGAUGE)
+	case protobufTypeSummary:
+		md.Type = uint32(prompb.MetricMetadataSUMMARY)
+	case protobufTypeUntyped:
+		md.Type = uint32(prompb.MetricMetadataUNKNOWN)
+	case protobufTypeHistogram:
+		md.Type = uint32(prompb.MetricMetadataHISTOGRAM)
+	case protobufTypeGaugeHistogram:
+		md.Type = uint32(prompb.MetricMetadataGAUGEHISTOGRAM)
+	default:
+		return fmt.Errorf("unsupported type %d for metric family %q", typ, name)
+	}
+	p.mds = append(p.mds, md)
+
+	fn := familyNames{
+		name: name,
+	}
+	for _, data := range p.metrics {
+		if err := p.unmarshalMetric(data, typ, &fn); err != nil {
+			return fmt.Errorf("cannot unmarshal metric for metric family %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// familyNames contains lazily initialized metric names for summary and histogram rows.
+type familyNames struct {
+	name   string
+	bucket string
+	sum    string
+	count  string
+}
+
+func (fn *familyNames) init() {
+	if fn.bucket != "" {
+		return
+	}
+	fn.bucket = fn.name + "_bucket"
+	fn.sum = fn.name + "_sum"
+	fn.count = fn.name + "_count"
+}
+
+func (p *protobufParser) unmarshalMetric(src []byte, typ uint64, fn *familyNames) (err error) {
+	// message Metric {
+	//   repeated LabelPair label = 1;
+	//   Gauge gauge = 2;
+	//   Counter counter = 3;
+	//   Summary summary = 4;
+	//   Untyped untyped = 5;
+	//   Histogram histogram = 7;
+	//   int64 timestamp_ms = 6;
+	// }
+	tagsStart := len(p.tagsPool)
+	var valueData []byte
+	var timestamp int64
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read label")
+			}
+			p.tagsPool, err = appendLabelPair(p.tagsPool, data)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal label: %w", err)
+			}
+		case 2, 3, 4, 5, 7:
+			if !isValueFieldForType(fc.FieldNum, typ) {
+				continue
+			}
+			valueData, ok = fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read value for field #%d", fc.FieldNum)
+			}
+		case 6:
+			timestamp, ok = fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read timestamp_ms")
+			}
+		}
+	}
+	tags := p.tagsPool[tagsStart:]
+	tags = tags[:len(tags):len(tags)]
+
+	switch typ {
+	case protobufTypeCounter, protobufTypeGauge, protobufTypeUntyped:
+		return p.unmarshalSimpleValue(valueData, fn.name, tags, timestamp)
+	case protobufTypeSummary:
+		fn.init()
+		return p.unmarshalSummary(valueData, fn, tags, timestamp)
+	default:
+		fn.init()
+		return p.unmarshalHistogram(valueData, fn, tags, timestamp)
+	}
+}
+
+func isValueFieldForType(fieldNum uint32, typ uint64) bool {
+	switch typ {
+	case protobufTypeCounter:
+		return fieldNum == 3
+	case protobufTypeGauge:
+		return fieldNum == 2
+	case protobufTypeSummary:
+		return fieldNum == 4
+	case protobufTypeUntyped:
+		return fieldNum == 5
+	default:
+		return fieldNum == 7
+	}
+}
+
+func (p *protobufParser) unmarshalSimpleValue(src []byte, metric string, tags []Tag, timestamp int64) (err error) {
+	// message Gauge {
+	//   double value = 1;
+	// }
+	// message Counter {
+	//   double value = 1;
+	//   Exemplar exemplar = 2;
+	// }
+	// message Untyped {
+	//   double value = 1;
+	// }
+	var value float64
+	var exemplarData []byte
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			value, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read value")
+			}
+		case 2:
+			exemplarData, ok = fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar")
+			}
+		}
+	}
+	r := p.appendRow(metric, tags, value, timestamp)
+	return p.unmarshalExemplar(r, exemplarData)
+}
+
+func (p *protobufParser) unmarshalSummary(src []byte, fn *familyNames, tags []Tag, timestamp int64) (err error) {
+	// message Summary {
+	//   uint64 sample_count = 1;
+	//   double sample_sum = 2;
+	//   repeated Quantile quantile = 3;
+	// }
+	var count uint64
+	var sum float64
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			count, ok = fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read sample_count")
+			}
+		case 2:
+			sum, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read sample_sum")
+			}
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read quantile")
+			}
+			quantile, value, err := unmarshalQuantile(data)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal quantile: %w", err)
+			}
+			p.appendRowWithTag(fn.name, tags, "quantile", formatFloat(quantile), value, timestamp)
+		}
+	}
+	p.appendRow(fn.sum, tags, sum, timestamp)
+	p.appendRow(fn.count, tags, float64(count), timestamp)
+	return nil
+}
+
+func unmarshalQuantile(src []byte) (quantile, value float64, err error) {
+	// message Quantile {
+	//   double quantile = 1;
+	//   double value = 2;
+	// }
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			quantile, ok = fc.Double()
+			if !ok {
+				return 0, 0, fmt.Errorf("cannot read quantile")
+			}
+		case 2:
+			value, ok = fc.Double()
+			if !ok {
+				return 0, 0, fmt.Errorf("cannot read value")
+			}
+		}
+	}
+	return quantile, value, nil
+}
+
+func (p *protobufParser) unmarshalHistogram(src []byte, fn *familyNames, tags []Tag, timestamp int64) (err error) {
+	// message Histogram {
+	//   uint64 sample_count = 1;
+	//   double sample_count_float = 4;
+	//   double sample_sum = 2;
+	//   repeated Bucket bucket = 3;
+	//   sint32 schema = 5;
+	//   double zero_threshold = 6;
+	//   uint64 zero_count = 7;
+	//   double zero_count_float = 8;
+	//   repeated BucketSpan negative_span = 9;
+	//   repeated sint64 negative_delta = 10;
+	//   repeated double negative_count = 11;
+	//   repeated BucketSpan positive_span = 12;
+	//   repeated sint64 positive_delta = 13;
+	//   repeated double positive_count = 14;
+	// }
+	h := &p.h
+	*h = prompb.Histogram{
+		NegativeSpans:  h.NegativeSpans[:0],
+		NegativeDeltas: h.NegativeDeltas[:0],
+		NegativeCounts: h.NegativeCounts[:0],
+		PositiveSpans:  h.PositiveSpans[:0],
+		PositiveDeltas: h.PositiveDeltas[:0],
+		PositiveCounts: h.PositiveCounts[:0],
+	}
+	rowsStart := len(p.rows)
+	hasInfBucket := false
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			n, ok := fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read sample_count")
+			}
+			h.Count = float64(n)
+		case 4:
+			h.Count, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read sample_count_float")
+			}
+		case 2:
+			h.Sum, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read sample_sum")
+			}
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read bucket")
+			}
+			if err := p.unmarshalBucket(data, fn.bucket, tags, timestamp, &hasInfBucket); err != nil {
+				return fmt.Errorf("cannot unmarshal bucket: %w", err)
+			}
+		case 5:
+			h.Schema, ok = fc.Sint32()
+			if !ok {
+				return fmt.Errorf("cannot read schema")
+			}
+		case 6:
+			h.ZeroThreshold, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read zero_threshold")
+			}
+		case 7:
+			n, ok := fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read zero_count")
+			}
+			h.ZeroCount = float64(n)
+		case 8:
+			h.ZeroCount, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read zero_count_float")
+			}
+		case 9:
+			h.NegativeSpans, err = appendBucketSpan(h.NegativeSpans, &fc)
+			if err != nil {
+				return fmt.Errorf("cannot read negative_span: %w", err)
+			}
+		case 10:
+			h.NegativeDeltas, ok = fc.UnpackSint64s(h.NegativeDeltas)
+			if !ok {
+				return fmt.Errorf("cannot read negative_delta")
+			}
+		case 11:
+			h.NegativeCounts, ok = fc.UnpackDoubles(h.NegativeCounts)
+			if !ok {
+				return fmt.Errorf("cannot read negative_count")
+			}
+		case 12:
+			h.PositiveSpans, err = appendBucketSpan(h.PositiveSpans, &fc)
+			if err != nil {
+				return fmt.Errorf("cannot read positive_span: %w", err)
+			}
+		case 13:
+			h.PositiveDeltas, ok = fc.UnpackSint64s(h.PositiveDeltas)
+			if !ok {
+				return fmt.Errorf("cannot read positive_delta")
+			}
+		case 14:
+			h.PositiveCounts, ok = fc.UnpackDoubles(h.PositiveCounts)
+			if !ok {
+				return fmt.Errorf("cannot read positive_count")
+			}
+		}
+	}
+
+	hasClassicBuckets := len(p.rows) > rowsStart
+	if hasClassicBuckets && !hasInfBucket {
+		// Prometheus text exposition always contains the bucket with le="+Inf".
+		p.appendRowWithTag(fn.bucket, tags, "le", "+Inf", h.Count, timestamp)
+	}
+
+	// Native histograms are detected in the same way as Prometheus does.
+	// Exporters set zero_threshold or add an empty span for native histograms without observations.
+	isNative := len(h.PositiveSpans) > 0 || len(h.NegativeSpans) > 0 || h.ZeroThreshold > 0 || h.ZeroCount > 0
+	if isNative && nativehistogram.IsEnabled() {
+		p.components, err = nativehistogram.AppendComponents(p.components[:0], h)
+		if err != nil {
+			return err
+		}
+		for _, c := range p.components {
+			p.appendRowWithTag(fn.name, tags, nativehistogram.ComponentLabel, c.Name, c.Value, timestamp)
+		}
+		if !hasClassicBuckets {
+			// Do not store _sum and _count series for native histograms without classic buckets,
+			// since they are already stored as native histogram components.
+			return nil
+		}
+	}
+
+	p.appendRow(fn.sum, tags, h.Sum, timestamp)
+	p.appendRow(fn.count, tags, h.Count, timestamp)
+	return nil
+}
+
+func (p *protobufParser) unmarshalBucket(src []byte, metric string, tags []Tag, timestamp int64, hasInfBucket *bool) (err error) {
+	// message Bucket {
+	//   uint64 cumulative_count = 1;
+	//   double cumulative_count_float = 4;
+	//   double upper_bound = 2;
+	//   Exemplar exemplar = 3;
+	// }
+	var count, upperBound float64
+	var exemplarData []byte
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			n, ok := fc.Uint64()
+			if !ok {
+				return fmt.Errorf("cannot read cumulative_count")
+			}
+			count = float64(n)
+		case 4:
+			count, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read cumulative_count_float")
+			}
+		case 2:
+			upperBound, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read upper_bound")
+			}
+		case 3:
+			exemplarData, ok = fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar")
+			}
+		}
+	}
+	if math.IsInf(upperBound, 1) {
+		*hasInfBucket = true
+	}
+	r := p.appendRowWithTag(metric, tags, "le", formatFloat(upperBound), count, timestamp)
+	return p.unmarshalExemplar(r, exemplarData)
+}
+
+// unmarshalExemplar unmarshals exemplar from src into r.
+func (p *protobufParser) unmarshalExemplar(r *Row, src []byte) (err error) {
+	// message Exemplar {
+	//   repeated LabelPair label = 1;
+	//   double value = 2;
+	//   google.protobuf.Timestamp timestamp = 3;
+	// }
+	if len(src) == 0 {
+		return nil
+	}
+	e := &r.Exemplar
+	tagsStart := len(p.tagsPool)
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read the next exemplar field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar label")
+			}
+			p.tagsPool, err = appendLabelPair(p.tagsPool, data)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal exemplar label: %w", err)
+			}
+		case 2:
+			e.Value, ok = fc.Double()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar value")
+			}
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read exemplar timestamp")
+			}
+			e.Timestamp, err = unmarshalTimestampMillis(data)
+			if err != nil {
+				return fmt.Errorf("cannot unmarshal exemplar timestamp: %w", err)
+			}
+		}
+	}
+	tags := p.tagsPool[tagsStart:]
+	e.Tags = tags[:len(tags):len(tags)]
+	return nil
+}
+
+func unmarshalTimestampMillis(src []byte) (int64, error) {
+	// message Timestamp {
+	//   int64 seconds = 1;
+	//   int32 nanos = 2;
+	// }
+	var secs int64
+	var nsecs int32
+	var fc easyproto.FieldContext
+	var ok bool
+	var err error
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			secs, ok = fc.Int64()
+			if !ok {
+				return 0, fmt.Errorf("cannot read seconds")
+			}
+		case 2:
+			nsecs, ok = fc.Int32()
+			if !ok {
+				return 0, fmt.Errorf("cannot read nanos")
+			}
+		}
+	}
+	return secs*1e3 + int64(nsecs)/1e6, nil
+}
+
+func appendLabelPair(dst []Tag, src []byte) (_ []Tag, err error) {
+	// message LabelPair {
+	//   string name = 1;
+	//   string value = 2;
+	// }
+	var tag Tag
+	var fc easyproto.FieldContext
+	var ok bool
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			tag.Key, ok = fc.String()
+			if !ok {
+				return dst, fmt.Errorf("cannot read name")
+			}
+		case 2:
+			tag.Value, ok = fc.String()
+			if !ok {
+				return dst, fmt.Errorf("cannot read value")
+			}
+		}
+	}
+	if tag.Key == "" {
+		return dst, fmt.Errorf("missing label name")
+	}
+	return append(dst, tag), nil
+}
+
+func appendBucketSpan(dst []prompb.BucketSpan, fc *easyproto.FieldContext) ([]prompb.BucketSpan, error) {
+	// message BucketSpan {
+	//   sint32 offset = 1;
+	//   uint32 length = 2;
+	// }
+	src, ok := fc.MessageData()
+	if !ok {
+		return dst, fmt.Errorf("cannot read span data")
+	}
+	var span prompb.BucketSpan
+	var spanFC easyproto.FieldContext
+	var err error
+	for len(src) > 0 {
+		src, err = spanFC.NextField(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch spanFC.FieldNum {
+		case 1:
+			span.Offset, ok = spanFC.Sint32()
+			if !ok {
+				return dst, fmt.Errorf("cannot read offset")
+			}
+		case 2:
+			span.Length, ok = spanFC.Uint32()
+			if !ok {
+				return dst, fmt.Errorf("cannot read length")
+			}
+		}
+	}
+	return append(dst, span), nil
+}
+
+func (p *protobufParser) appendRow(metric string, tags []Tag, value float64, timestamp int64) *Row {
+	p.rows = append(p.rows, Row{
+		Metric:    metric,
+		Tags:      tags,
+		Value:     value,
+		Timestamp: timestamp,
+	})
+	return &p.rows[len(p.rows)-1]
+}
+
+// appendRowWithTag appends a row with tags plus the given tag.
+func (p *protobufParser) appendRowWithTag(metric string, tags []Tag, key, value string, v float64, timestamp int64) *Row {
+	tagsStart := len(p.tagsPool)
+	p.tagsPool = append(p.tagsPool, tags...)
+	p.tagsPool = append(p.tagsPool, Tag{
+		Key:   key,
+		Value: value,
+	})
+	rowTags := p.tagsPool[tagsStart:]
+	return p.appendRow(metric, rowTags[:len(rowTags):len(rowTags)], v, timestamp)
+}
+
+// formatFloat formats v in the same way as Prometheus client libraries do in text exposition format,
+// so `le` and `quantile` label values do not depend on the scrape protocol.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// MarshalRowsText appends rows in Prometheus text exposition format to dst and returns the result.
+//
+// Exemplars aren't marshaled.
+func MarshalRowsText(dst []byte, rows []Row) []byte {
+	for i := range rows {
+		r := &rows[i]
+		dst = marshalMetricNameWithTags(dst, r)
+		dst = append(dst, ' ')
+		dst = appendFloat(dst, r.Value)
+		if r.Timestamp != 0 {
+			dst = append(dst, ' ')
+			dst = strconv.AppendInt(dst, r.Timestamp, 10)
+		}
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+func appendFloat(dst []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(dst, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(dst, "-Inf"...)
+	case math.IsNaN(v):
+		return append(dst, "NaN"...)
+	default:
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,297 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestUnmarshalProtobuf(t *testing.T) {
+	f := func(data []byte, rowsExpected string, mdsExpected []Metadata) {
+		t.Helper()
+
+		rows, mds := UnmarshalProtobuf(Rows{}, MetadataRows{}, data, func(s string) {
+			t.Fatalf("unexpected error: %s", s)
+		})
+		result := formatRowsWithExemplars(rows.Rows)
+		if result != rowsExpected {
+			t.Fatalf("unexpected rows\ngot\n%s\nwant\n%s", result, rowsExpected)
+		}
+		if len(mds.Rows) != len(mdsExpected) {
+			t.Fatalf("unexpected number of metadata rows; got %d; want %d", len(mds.Rows), len(mdsExpected))
+		}
+		for i := range mdsExpected {
+			if mds.Rows[i] != mdsExpected[i] {
+				t.Fatalf("unexpected metadata at position %d; got %+v; want %+v", i, mds.Rows[i], mdsExpected[i])
+			}
+		}
+	}
+
+	// empty data
+	f(nil, "", nil)
+
+	// counter with exemplar and timestamp
+	f(marshalMetricFamilies(func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "requests_total")
+		mm.AppendString(2, "The number of requests")
+		mm.AppendInt32(3, protobufTypeCounter)
+		m := mm.AppendMessage(4)
+		appendLabelPairs(m, "path", "/foo", "code", "200")
+		counter := m.AppendMessage(3)
+		counter.AppendDouble(1, 123)
+		exemplar := counter.AppendMessage(2)
+		appendLabelPairs(exemplar, "trace_id", "abc")
+		exemplar.AppendDouble(2, 0.5)
+		ts := exemplar.AppendMessage(3)
+		ts.AppendInt64(1, 1700000000)
+		ts.AppendInt32(2, 123000000)
+		m.AppendInt64(6, 1700000001000)
+		m = mm.AppendMessage(4)
+		appendLabelPairs(m, "path", "/bar")
+		m.AppendMessage(3).AppendDouble(1, 4)
+	}), `requests_total{path="/foo",code="200"} 123 1700000001000 # {trace_id="abc"} 0.5 1700000000123
+requests_total{path="/bar"} 4
+`, []Metadata{{
+		Metric: "requests_total",
+		Type:   uint32(prompb.MetricMetadataCOUNTER),
+		Help:   "The number of requests",
+	}})
+
+	// gauge and untyped
+	f(marshalMetricFamilies(func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "temperature")
+		mm.AppendInt32(3, protobufTypeGauge)
+		mm.AppendMessage(4).AppendMessage(2).AppendDouble(1, -12.5)
+	}, func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "foo")
+		mm.AppendInt32(3, protobufTypeUntyped)
+		m := mm.AppendMessage(4)
+		appendLabelPairs(m, "bar", `a"b`)
+		m.AppendMessage(5).AppendDouble(1, math.Inf(1))
+	}), `temperature -12.5
+foo{bar="a\"b"} +Inf
+`, []Metadata{
+		{
+			Metric: "temperature",
+			Type:   uint32(prompb.MetricMetadataGAUGE),
+		},
+		{
+			Metric: "foo",
+			Type:   uint32(prompb.MetricMetadataUNKNOWN),
+		},
+	})
+
+	// summary
+	f(marshalMetricFamilies(func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "rpc_duration_seconds")
+		mm.AppendInt32(3, protobufTypeSummary)
+		m := mm.AppendMessage(4)
+		appendLabelPairs(m, "service", "db")
+		summary := m.AppendMessage(4)
+		summary.AppendUint64(1, 10)
+		summary.AppendDouble(2, 1.5)
+		q := summary.AppendMessage(3)
+		q.AppendDouble(1, 0.5)
+		q.AppendDouble(2, 0.1)
+		q = summary.AppendMessage(3)
+		q.AppendDouble(1, 0.99)
+		q.AppendDouble(2, 0.4)
+	}), `rpc_duration_seconds{service="db",quantile="0.5"} 0.1
+rpc_duration_seconds{service="db",quantile="0.99"} 0.4
+rpc_duration_seconds_sum{service="db"} 1.5
+rpc_duration_seconds_count{service="db"} 10
+`, []Metadata{{
+		Metric: "rpc_duration_seconds",
+		Type:   uint32(prompb.MetricMetadataSUMMARY),
+	}})
+
+	// classic histogram without +Inf bucket
+	f(marshalMetricFamilies(func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "request_duration_seconds")
+		mm.AppendInt32(3, protobufTypeHistogram)
+		h := mm.AppendMessage(4).AppendMessage(7)
+		h.AppendUint64(1, 5)
+		h.AppendDouble(2, 3.25)
+		b := h.AppendMessage(3)
+		b.AppendUint64(1, 2)
+		b.AppendDouble(2, 0.1)
+		b = h.AppendMessage(3)
+		b.AppendUint64(1, 4)
+		b.AppendDouble(2, 1e6)
+		exemplar := b.AppendMessage(3)
+		appendLabelPairs(exemplar, "trace_id", "xyz")
+		exemplar.AppendDouble(2, 0.7)
+	}), `request_duration_seconds_bucket{le="0.1"} 2
+request_duration_seconds_bucket{le="1e+06"} 4 # {trace_id="xyz"} 0.7 0
+request_duration_seconds_bucket{le="+Inf"} 5
+request_duration_seconds_sum 3.25
+request_duration_seconds_count 5
+`, []Metadata{{
+		Metric: "request_duration_seconds",
+		Type:   uint32(prompb.MetricMetadataHISTOGRAM),
+	}})
+
+	// native histogram is stored as _sum and _count if native histograms are disabled
+	f(marshalMetricFamilies(marshalNativeHistogramFamily), `native_seconds_sum{job="a"} 7.5
+native_seconds_count{job="a"} 6
+`, []Metadata{{
+		Metric: "native_seconds",
+		Type:   uint32(prompb.MetricMetadataHISTOGRAM),
+	}})
+}
+
+func TestUnmarshalProtobufNativeHistograms(t *testing.T) {
+	if err := flag.Set("enableNativeHistograms", "true"); err != nil {
+		t.Fatalf("cannot enable native histograms: %s", err)
+	}
+	defer func() {
+		if err := flag.Set("enableNativeHistograms", "false"); err != nil {
+			t.Fatalf("cannot disable native histograms: %s", err)
+		}
+	}()
+
+	data := marshalMetricFamilies(marshalNativeHistogramFamily)
+	rows, _ := UnmarshalProtobuf(Rows{}, MetadataRows{}, data, func(s string) {
+		t.Fatalf("unexpected error: %s", s)
+	})
+	result := formatRowsWithExemplars(rows.Rows)
+	resultExpected := `native_seconds{job="a",__nh__="count"} 6
+native_seconds{job="a",__nh__="sum"} 7.5
+native_seconds{job="a",__nh__="zero:0.001"} 1
+native_seconds{job="a",__nh__="pos:0:1"} 2
+native_seconds{job="a",__nh__="pos:0:2"} 3
+`
+	if result != resultExpected {
+		t.Fatalf("unexpected rows\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestUnmarshalProtobufInvalidData(t *testing.T) {
+	f := func(data []byte, rowsExpected string) {
+		t.Helper()
+
+		errorsCount := 0
+		rows, _ := UnmarshalProtobuf(Rows{}, MetadataRows{}, data, func(_ string) {
+			errorsCount++
+		})
+		if errorsCount == 0 {
+			t.Fatalf("expecting at least a single error")
+		}
+		result := formatRowsWithExemplars(rows.Rows)
+		if result != rowsExpected {
+			t.Fatalf("unexpected rows\ngot\n%s\nwant\n%s", result, rowsExpected)
+		}
+	}
+
+	validFamily := func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "foo")
+		mm.AppendInt32(3, protobufTypeGauge)
+		mm.AppendMessage(4).AppendMessage(2).AppendDouble(1, 1)
+	}
+
+	// text data
+	f([]byte("foo 1\n"), "")
+
+	// truncated message
+	data := marshalMetricFamilies(validFamily)
+	f(data[:len(data)-1], "")
+
+	// missing metric family name; the next family must be parsed
+	f(marshalMetricFamilies(func(mm *easyproto.MessageMarshaler) {
+		mm.AppendInt32(3, protobufTypeGauge)
+		mm.AppendMessage(4).AppendMessage(2).AppendDouble(1, 1)
+	}, validFamily), "foo 1\n")
+
+	// missing label name
+	f(marshalMetricFamilies(func(mm *easyproto.MessageMarshaler) {
+		mm.AppendString(1, "bar")
+		mm.AppendInt32(3, protobufTypeGauge)
+		m := mm.AppendMessage(4)
+		m.AppendMessage(2).AppendDouble(1, 2)
+		m = mm.AppendMessage(4)
+		appendLabelPairs(m, "", "x")
+		m.AppendMessage(2).AppendDouble(1, 3)
+	}, validFamily), "foo 1\n")
+}
+
+func TestMarshalRowsText(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		var rows Rows
+		rows.UnmarshalWithErrLogger(s, func(s string) {
+			t.Fatalf("unexpected error: %s", s)
+		})
+		result := MarshalRowsText(nil, rows.Rows)
+		if string(result) != s {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, s)
+		}
+	}
+	f("")
+	f("foo 1\n")
+	f("foo{bar=\"baz\",x=\"a\\\\b\\n\"} -1.5 1700000000000\nbar NaN\nbaz +Inf\n")
+}
+
+func marshalNativeHistogramFamily(mm *easyproto.MessageMarshaler) {
+	mm.AppendString(1, "native_seconds")
+	mm.AppendInt32(3, protobufTypeHistogram)
+	m := mm.AppendMessage(4)
+	appendLabelPairs(m, "job", "a")
+	h := m.AppendMessage(7)
+	h.AppendUint64(1, 6)
+	h.AppendDouble(2, 7.5)
+	h.AppendSint32(5, 0)
+	h.AppendDouble(6, 0.001)
+	h.AppendUint64(7, 1)
+	span := h.AppendMessage(12)
+	span.AppendSint32(1, 1)
+	span.AppendUint32(2, 2)
+	h.AppendSint64s(13, []int64{2, 1})
+}
+
+func marshalMetricFamilies(fs ...func(mm *easyproto.MessageMarshaler)) []byte {
+	var mp easyproto.MarshalerPool
+	var dst []byte
+	for _, f := range fs {
+		m := mp.Get()
+		f(m.MessageMarshaler())
+		data := m.Marshal(nil)
+		mp.Put(m)
+		dst = binary.AppendUvarint(dst, uint64(len(data)))
+		dst = append(dst, data...)
+	}
+	return dst
+}
+
+func appendLabelPairs(mm *easyproto.MessageMarshaler, nameValues ...string) {
+	for i := 0; i < len(nameValues); i += 2 {
+		label := mm.AppendMessage(1)
+		label.AppendString(1, nameValues[i])
+		label.AppendString(2, nameValues[i+1])
+	}
+}
+
+func formatRowsWithExemplars(rows []Row) string {
+	var sb strings.Builder
+	for i := range rows {
+		r := &rows[i]
+		line := MarshalRowsText(nil, rows[i:i+1])
+		line = line[:len(line)-1]
+		sb.Write(line)
+		if len(r.Exemplar.Tags) > 0 {
+			e := &Row{
+				Tags: r.Exemplar.Tags,
+			}
+			fmt.Fprintf(&sb, " # %s %v %d", marshalMetricNameWithTags(nil, e), r.Exemplar.Value, r.Exemplar.Timestamp)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -2,6 +2,7 @@ package stream
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"sync"
@@ -60,6 +61,59 @@ func Parse(r io.Reader, defaultTimestamp int64, encoding string, limitConcurrenc
 	return ctx.callbackErr
 }
 
+// ParseProtobuf parses Prometheus protobuf exposition format from src and calls callback for the parsed rows.
+//
+// src must contain a sequence of varint length-delimited io.prometheus.client.MetricFamily messages.
+// It is split into blocks of whole messages, which are parsed concurrently.
+//
+// The callback can be called concurrently multiple times for the blocks from src.
+//
+// callback shouldn't hold rows after returning.
+func ParseProtobuf(src []byte, defaultTimestamp int64, enableMetadata bool, callback func(rows []prometheus.Row, metadataList []prometheus.Metadata) error, errLogger func(string)) error {
+	ctx := getStreamContext(nil)
+	defer putStreamContext(ctx)
+	for len(src) > 0 && !ctx.hasCallbackError() {
+		readCalls.Inc()
+		n := getProtobufBlockLen(src, protobufBlockSize)
+		uw := getUnmarshalWork()
+		uw.errLogger = errLogger
+		uw.ctx = ctx
+		uw.callback = callback
+		uw.defaultTimestamp = defaultTimestamp
+		uw.reqBuf = append(uw.reqBuf[:0], src[:n]...)
+		uw.enableMetadata = enableMetadata
+		uw.isProtobuf = true
+		src = src[n:]
+		ctx.wg.Add(1)
+		protoparserutil.ScheduleUnmarshalWork(uw)
+	}
+	ctx.wg.Wait()
+	return ctx.callbackErr
+}
+
+// protobufBlockSize is the preferred size of blocks, which are parsed by ParseProtobuf.
+const protobufBlockSize = 64 * 1024
+
+// getProtobufBlockLen returns the length of src prefix, which contains whole length-delimited messages with the total size up to maxSize.
+//
+// The prefix contains at least a single message. The whole src is returned if it contains a malformed message,
+// so the error is reported by the parser.
+func getProtobufBlockLen(src []byte, maxSize int) int {
+	n := 0
+	for n < len(src) {
+		size, sizeLen := binary.Uvarint(src[n:])
+		if sizeLen <= 0 || size > uint64(len(src)-n-sizeLen) {
+			return len(src)
+		}
+		msgLen := sizeLen + int(size)
+		if n > 0 && n+msgLen > maxSize {
+			break
+		}
+		n += msgLen
+	}
+	return n
+}
+
 func (ctx *streamContext) Read() bool {
 	readCalls.Inc()
 	if ctx.err != nil || ctx.hasCallbackError() {
@@ -144,6 +198,9 @@ type unmarshalWork struct {
 	reqBuf           []byte
 
 	enableMetadata bool
+
+	// isProtobuf is set if reqBuf contains data in Prometheus protobuf exposition format.
+	isProtobuf bool
 }
 
 func (uw *unmarshalWork) reset() {
@@ -154,6 +211,7 @@ func (uw *unmarshalWork) reset() {
 	uw.errLogger = nil
 	uw.defaultTimestamp = 0
 	uw.reqBuf = uw.reqBuf[:0]
+	uw.isProtobuf = false
 }
 
 func (uw *unmarshalWork) runCallback(rows []prometheus.Row, metadataList []prometheus.Metadata) {
@@ -170,7 +228,12 @@ func (uw *unmarshalWork) runCallback(rows []prometheus.Row, metadataList []prome
 
 // Unmarshal implements protoparserutil.UnmarshalWork
 func (uw *unmarshalWork) Unmarshal() {
-	if uw.enableMetadata {
+	if uw.isProtobuf {
+		uw.rows, uw.mmd = prometheus.UnmarshalProtobuf(uw.rows, uw.mmd, uw.reqBuf, uw.errLogger)
+		if !uw.enableMetadata {
+			uw.mmd.Reset()
+		}
+	} else if uw.enableMetadata {
 		uw.rows, uw.mmd = prometheus.UnmarshalWithMetadata(uw.rows, uw.mmd, bytesutil.ToUnsafeString(uw.reqBuf), uw.errLogger)
 	} else {
 		uw.rows.UnmarshalWithErrLogger(bytesutil.ToUnsafeString(uw.reqBuf), uw.errLogger)
@@ -3,12 +3,16 @@ package stream
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/binary"
+	"fmt"
 	"reflect"
 	"sort"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/easyproto"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 )
@@ -136,3 +140,113 @@ func appendRowCopies(dst, src []prometheus.Row) []prometheus.Row {
 func copyString(s string) string {
 	return string(append([]byte(nil), s...))
 }
+
+func TestParseProtobuf(t *testing.T) {
+	protoparserutil.StartUnmarshalWorkers()
+	defer protoparserutil.StopUnmarshalWorkers()
+
+	const defaultTimestamp = 123
+	f := func(familiesCount int, enableMetadata bool) {
+		t.Helper()
+
+		var mp easyproto.MarshalerPool
+		var src []byte
+		var rowsExpected []prometheus.Row
+		for i := 0; i < familiesCount; i++ {
+			name := fmt.Sprintf("metric_%05d", i)
+			m := mp.Get()
+			mm := m.MessageMarshaler()
+			mm.AppendString(1, name)
+			mm.AppendString(2, "some help")
+			mm.AppendUint64(3, 1) // GAUGE
+			metric := mm.AppendMessage(4)
+			label := metric.AppendMessage(1)
+			label.AppendString(1, "job")
+			label.AppendString(2, "foo")
+			metric.AppendMessage(2).AppendDouble(1, float64(i))
+			data := m.Marshal(nil)
+			mp.Put(m)
+			src = binary.AppendUvarint(src, uint64(len(data)))
+			src = append(src, data...)
+
+			rowsExpected = append(rowsExpected, prometheus.Row{
+				Metric: name,
+				Tags: []prometheus.Tag{{
+					Key:   "job",
+					Value: "foo",
+				}},
+				Value:     float64(i),
+				Timestamp: defaultTimestamp,
+			})
+		}
+
+		var result []prometheus.Row
+		var metadataCount int
+		var callbacks int
+		var lock sync.Mutex
+		err := ParseProtobuf(src, defaultTimestamp, enableMetadata, func(rows []prometheus.Row, mms []prometheus.Metadata) error {
+			lock.Lock()
+			result = appendRowCopies(result, rows)
+			metadataCount += len(mms)
+			callbacks++
+			lock.Unlock()
+			return nil
+		}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		sortRows(result)
+		if !reflect.DeepEqual(result, rowsExpected) {
+			t.Fatalf("unexpected rows parsed; got %d rows; want %d rows", len(result), len(rowsExpected))
+		}
+		metadataCountExpected := 0
+		if enableMetadata {
+			metadataCountExpected = familiesCount
+		}
+		if metadataCount != metadataCountExpected {
+			t.Fatalf("unexpected number of metadata entries; got %d; want %d", metadataCount, metadataCountExpected)
+		}
+		callbacksExpected := (len(src) + protobufBlockSize - 1) / protobufBlockSize
+		if callbacks < callbacksExpected {
+			t.Fatalf("unexpected number of callbacks; got %d; want at least %d", callbacks, callbacksExpected)
+		}
+	}
+
+	f(1, false)
+	f(10, true)
+
+	// multiple blocks
+	f(10000, false)
+	f(10000, true)
+}
+
+func TestGetProtobufBlockLen(t *testing.T) {
+	f := func(src []byte, maxSize, resultExpected int) {
+		t.Helper()
+
+		result := getProtobufBlockLen(src, maxSize)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %d; want %d", result, resultExpected)
+		}
+	}
+
+	// three messages with 9 bytes of data and 1 byte of varint size
+	var src []byte
+	for i := 0; i < 3; i++ {
+		src = binary.AppendUvarint(src, 9)
+		src = append(src, make([]byte, 9)...)
+	}
+
+	// all the messages fit maxSize
+	f(src, 100, 30)
+
+	// the first message exceeds maxSize
+	f(src, 5, 10)
+
+	// a part of messages fit maxSize
+	f(src, 25, 20)
+
+	// truncated message
+	f(src[:25], 100, 25)
+	f(src[:25], 15, 10)
+}
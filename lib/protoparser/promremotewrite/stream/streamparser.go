@@ -2,26 +2,115 @@ package stream
 
 import (
 	"bufio"
+	"encoding/binary"
+	"flag"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/golang/snappy"
 )
 
-var maxInsertRequestSize = flagutil.NewBytes("maxInsertRequestSize", 32*1024*1024, "The maximum size in bytes of a single Prometheus remote_write API request")
+var (
+	maxInsertRequestSize = flagutil.NewBytes("maxInsertRequestSize", 32*1024*1024, "The maximum size in bytes of a single Prometheus remote_write API request")
+
+	createdTimestampZeroIngestion = flag.Bool("promremotewrite.createdTimestampZeroIngestion", false, "Whether to ingest a zero sample at the created timestamp "+
+		"of cumulative series received via Prometheus remote write 2.0 protocol. This helps detecting counter resets for newly created series. "+
+		"See https://docs.victoriametrics.com/victoriametrics/integrations/prometheus/#remote-write-20")
+)
+
+const (
+	// remoteWriteV1Proto is the proto parameter of Content-Type header for Prometheus remote write 1.0 requests.
+	remoteWriteV1Proto = "prometheus.WriteRequest"
+
+	// remoteWriteV2Proto is the proto parameter of Content-Type header for Prometheus remote write 2.0 requests.
+	remoteWriteV2Proto = "io.prometheus.write.v2.Request"
+)
+
+// IsRemoteWriteV2 returns whether the given Content-Type header value corresponds to Prometheus remote write 2.0 request.
+//
+// It returns an error with http.StatusUnsupportedMediaType status code for unsupported protobuf messages
+// according to https://prometheus.io/docs/specs/prw/remote_write_spec_2_0/#protocol
+func IsRemoteWriteV2(contentType string) (bool, error) {
+	if contentType == "" {
+		return false, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/x-protobuf" {
+		// Be lenient to clients, which send arbitrary Content-Type headers with Prometheus remote write 1.0 requests.
+		return false, nil
+	}
+	switch proto := params["proto"]; proto {
+	case "", remoteWriteV1Proto:
+		return false, nil
+	case remoteWriteV2Proto:
+		return true, nil
+	default:
+		return false, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("unsupported proto=%q in Content-Type header; supported values: %q, %q", proto, remoteWriteV1Proto, remoteWriteV2Proto),
+			StatusCode: http.StatusUnsupportedMediaType,
+		}
+	}
+}
+
+// IsRemoteWriteV2Block returns true if the given snappy-compressed block contains Prometheus remote write 2.0 request.
+//
+// Remote write 2.0 requests start with either symbols (4) or timeseries (5) fields,
+// while remote write 1.0 requests start with either timeseries (1) or metadata (3) fields.
+// The first byte of the request is read without decompressing the whole block,
+// since a snappy block always starts with a literal after the varint-encoded length of the decompressed data.
+func IsRemoteWriteV2Block(block []byte) bool {
+	_, n := binary.Uvarint(block)
+	if n <= 0 || n >= len(block) {
+		return false
+	}
+	tag := block[n]
+	if tag&0x03 != 0 {
+		// The first element must be a literal.
+		return false
+	}
+	offset := n + 1
+	if x := tag >> 2; x >= 60 {
+		// The literal length is stored in the next x-59 bytes.
+		offset += int(x - 59)
+	}
+	if offset >= len(block) {
+		return false
+	}
+	switch block[offset] {
+	case 0x22, 0x2a:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetWrittenHeaders sets Prometheus remote write 2.0 response headers with the number of written samples, histograms and exemplars.
+//
+// See https://prometheus.io/docs/specs/prw/remote_write_spec_2_0/#required-written-response-headers
+func SetWrittenHeaders(h http.Header, samples, histograms, exemplars int) {
+	h.Set("X-Prometheus-Remote-Write-Samples-Written", strconv.Itoa(samples))
+	h.Set("X-Prometheus-Remote-Write-Histograms-Written", strconv.Itoa(histograms))
+	h.Set("X-Prometheus-Remote-Write-Exemplars-Written", strconv.Itoa(exemplars))
+}
 
 // Parse parses Prometheus remote_write message from reader and calls callback for the parsed timeseries.
 //
+// If isRemoteWriteV2 is set, then the message is parsed as Prometheus remote write 2.0 request.
+//
 // callback shouldn't hold tss after returning.
-func Parse(r io.Reader, isVMRemoteWrite bool, callback func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error) error {
+func Parse(r io.Reader, isVMRemoteWrite, isRemoteWriteV2 bool, callback func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error) error {
 	wcr := writeconcurrencylimiter.GetReader(r)
 	defer writeconcurrencylimiter.PutReader(wcr)
 	r = wcr
@@ -76,10 +165,23 @@ func Parse(r io.Reader, isVMRemoteWrite bool, callback func(tss []prompb.TimeSer
 	}
 	wru := getWriteRequestUnmarshaler()
 	defer putWriteRequestUnmarshaler(wru)
-	wr, err := wru.UnmarshalProtobuf(bb.B)
-	if err != nil {
-		unmarshalErrors.Inc()
-		return fmt.Errorf("cannot unmarshal prompb.WriteRequest with size %d bytes: %w", len(bb.B), err)
+	var wr *prompb.WriteRequest
+	if isRemoteWriteV2 {
+		requestsV2Read.Inc()
+		wr, err = wru.UnmarshalProtobufV2(bb.B)
+		if err != nil {
+			unmarshalErrors.Inc()
+			return fmt.Errorf("cannot unmarshal Prometheus remote write 2.0 request with size %d bytes: %w", len(bb.B), err)
+		}
+		if *createdTimestampZeroIngestion {
+			ctx.addCreatedTimestampSamples(wr.Timeseries)
+		}
+	} else {
+		wr, err = wru.UnmarshalProtobuf(bb.B)
+		if err != nil {
+			unmarshalErrors.Inc()
+			return fmt.Errorf("cannot unmarshal prompb.WriteRequest with size %d bytes: %w", len(bb.B), err)
+		}
 	}
 
 	rows := 0
@@ -102,11 +204,37 @@ var bodyBufferPool bytesutil.ByteBufferPool
 type pushCtx struct {
 	br     *bufio.Reader
 	reqBuf bytesutil.ByteBuffer
+
+	// samples holds samples for series with zero samples added at created timestamps.
+	samples []prompb.Sample
 }
 
 func (ctx *pushCtx) reset() {
 	ctx.br.Reset(nil)
 	ctx.reqBuf.Reset()
+	ctx.samples = ctx.samples[:0]
+}
+
+// addCreatedTimestampSamples adds zero samples at created timestamps to tss.
+//
+// The zero sample is added only if the created timestamp is smaller than the timestamp of the first sample.
+// Prometheus sends created timestamps only for cumulative series such as counters, histograms and summaries.
+func (ctx *pushCtx) addCreatedTimestampSamples(tss []prompb.TimeSeries) {
+	samples := ctx.samples[:0]
+	for i := range tss {
+		ts := &tss[i]
+		if ts.CreatedTimestamp <= 0 || len(ts.Samples) == 0 || ts.CreatedTimestamp >= ts.Samples[0].Timestamp {
+			continue
+		}
+		samplesLen := len(samples)
+		samples = append(samples, prompb.Sample{
+			Timestamp: ts.CreatedTimestamp,
+		})
+		samples = append(samples, ts.Samples...)
+		ts.Samples = samples[samplesLen:]
+		createdTimestampSamples.Inc()
+	}
+	ctx.samples = samples
 }
 
 func (ctx *pushCtx) Read() error {
@@ -131,6 +259,9 @@ var (
 	rowsRead        = metrics.NewCounter(`vm_protoparser_rows_read_total{type="promremotewrite"}`)
 	metadataRead    = metrics.NewCounter(`vm_protoparser_metadata_read_total{type="promremotewrite"}`)
 	unmarshalErrors = metrics.NewCounter(`vm_protoparser_unmarshal_errors_total{type="promremotewrite"}`)
+
+	requestsV2Read          = metrics.NewCounter(`vm_protoparser_promremotewrite_v2_requests_total`)
+	createdTimestampSamples = metrics.NewCounter(`vm_protoparser_promremotewrite_created_timestamp_samples_total`)
 )
 
 func getPushCtx(r io.Reader) *pushCtx {
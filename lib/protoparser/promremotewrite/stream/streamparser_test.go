@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestIsRemoteWriteV2(t *testing.T) {
+	f := func(contentType string, resultExpected bool) {
+		t.Helper()
+		result, err := IsRemoteWriteV2(contentType)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for Content-Type=%q; got %v; want %v", contentType, result, resultExpected)
+		}
+	}
+
+	f("", false)
+	f("application/x-protobuf", false)
+	f("application/x-protobuf;proto=prometheus.WriteRequest", false)
+	f("application/octet-stream", false)
+	f("application/x-protobuf;proto=io.prometheus.write.v2.Request", true)
+	f("application/x-protobuf; proto=io.prometheus.write.v2.Request", true)
+
+	// unsupported proto
+	if _, err := IsRemoteWriteV2("application/x-protobuf;proto=io.prometheus.write.v3.Request"); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported proto")
+	}
+}
+
+func TestParseRemoteWriteV2CreatedTimestamp(t *testing.T) {
+	wr := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:           []prompb.Label{{Name: "__name__", Value: "foo_total"}},
+				Samples:          []prompb.Sample{{Value: 5, Timestamp: 2000}},
+				CreatedTimestamp: 1000,
+			},
+			{
+				Labels:           []prompb.Label{{Name: "__name__", Value: "bar_total"}},
+				Samples:          []prompb.Sample{{Value: 7, Timestamp: 2000}},
+				CreatedTimestamp: 2000,
+			},
+		},
+	}
+	data := snappy.Encode(nil, wr.MarshalProtobufV2(nil))
+
+	f := func(zeroIngestion bool, samplesExpected [][]prompb.Sample) {
+		t.Helper()
+
+		prevValue := *createdTimestampZeroIngestion
+		*createdTimestampZeroIngestion = zeroIngestion
+		defer func() {
+			*createdTimestampZeroIngestion = prevValue
+		}()
+
+		var samples [][]prompb.Sample
+		err := Parse(bytes.NewReader(data), false, true, func(tss []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+			for i := range tss {
+				samples = append(samples, append([]prompb.Sample{}, tss[i].Samples...))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(samples, samplesExpected) {
+			t.Fatalf("unexpected samples\ngot\n%v\nwant\n%v", samples, samplesExpected)
+		}
+	}
+
+	f(false, [][]prompb.Sample{
+		{{Value: 5, Timestamp: 2000}},
+		{{Value: 7, Timestamp: 2000}},
+	})
+
+	// the zero sample must be added only if the created timestamp is smaller than the first sample timestamp
+	f(true, [][]prompb.Sample{
+		{{Value: 0, Timestamp: 1000}, {Value: 5, Timestamp: 2000}},
+		{{Value: 7, Timestamp: 2000}},
+	})
+}
+
+func TestIsRemoteWriteV2Block(t *testing.T) {
+	f := func(block []byte, resultExpected bool) {
+		t.Helper()
+		result := IsRemoteWriteV2Block(block)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	f(nil, false)
+	f([]byte("invalid snappy block"), false)
+	f(encoding.CompressZSTDLevel(nil, []byte("foobar"), 1), false)
+
+	// a long literal, which length is stored in separate bytes
+	wr := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: strings.Repeat("x", 200)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		}},
+	}
+	f(snappy.Encode(nil, wr.MarshalProtobuf(nil)), false)
+	f(snappy.Encode(nil, wr.MarshalProtobufV2(nil)), true)
+}
@@ -0,0 +1,269 @@
+package statsd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/datadogutil"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+	"github.com/valyala/fastjson/fastfloat"
+)
+
+// Supported StatsD metric types.
+//
+// See https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+// and https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+const (
+	// TypeCounter is a counter, which value is the increment since the previous sample.
+	TypeCounter = "c"
+
+	// TypeGauge is a gauge.
+	TypeGauge = "g"
+
+	// TypeTimer is a timer, which value is the duration in milliseconds.
+	TypeTimer = "ms"
+
+	// TypeHistogram is a histogram observation.
+	TypeHistogram = "h"
+
+	// TypeDistribution is a DogStatsD distribution observation.
+	TypeDistribution = "d"
+
+	// TypeSet is a set, which counts unique values.
+	TypeSet = "s"
+)
+
+// Rows contains parsed statsd rows.
+type Rows struct {
+	Rows []Row
+
+	tagsPool []Tag
+}
+
+// Reset resets rs.
+func (rs *Rows) Reset() {
+	// Reset items, so they can be GC'ed
+
+	for i := range rs.Rows {
+		rs.Rows[i].reset()
+	}
+	rs.Rows = rs.Rows[:0]
+
+	for i := range rs.tagsPool {
+		rs.tagsPool[i].reset()
+	}
+	rs.tagsPool = rs.tagsPool[:0]
+}
+
+// Unmarshal unmarshals statsd plaintext protocol rows from s.
+//
+// Lines with multiple values such as `foo:1:2:3|ms` are unmarshaled into multiple rows with the same Metric and Tags.
+//
+// See https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+// and https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+//
+// s shouldn't be modified when rs is in use.
+func (rs *Rows) Unmarshal(s string) {
+	rs.Rows, rs.tagsPool = unmarshalRows(rs.Rows[:0], s, rs.tagsPool[:0])
+}
+
+// Row is a single statsd row.
+type Row struct {
+	Metric string
+	Tags   []Tag
+
+	// Type is the metric type. It equals to one of Type* constants.
+	Type string
+
+	// Value is the sample value.
+	//
+	// Counter values are already scaled according to the sample rate.
+	// Set values are replaced with the hash of the original value, so they can be counted with unique_samples aggregation.
+	Value float64
+
+	// IsGaugeDelta is set for gauge values with `+` or `-` sign such as `foo:+5|g`.
+	//
+	// Such values must be added to the current gauge value instead of replacing it.
+	IsGaugeDelta bool
+
+	// Timestamp is unix timestamp in seconds. It is set only for DogStatsD lines with `|T` section.
+	Timestamp int64
+}
+
+func (r *Row) reset() {
+	r.Metric = ""
+	r.Tags = nil
+	r.Type = ""
+	r.Value = 0
+	r.IsGaugeDelta = false
+	r.Timestamp = 0
+}
+
+// Tag is a statsd tag.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+func (t *Tag) reset() {
+	t.Key = ""
+	t.Value = ""
+}
+
+func unmarshalRows(dst []Row, s string, tagsPool []Tag) ([]Row, []Tag) {
+	for len(s) > 0 {
+		n := strings.IndexByte(s, '\n')
+		if n < 0 {
+			// The last line.
+			return unmarshalRow(dst, s, tagsPool)
+		}
+		dst, tagsPool = unmarshalRow(dst, s[:n], tagsPool)
+		s = s[n+1:]
+	}
+	return dst, tagsPool
+}
+
+func unmarshalRow(dst []Row, s string, tagsPool []Tag) ([]Row, []Tag) {
+	if len(s) > 0 && s[len(s)-1] == '\r' {
+		s = s[:len(s)-1]
+	}
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		// Skip empty line
+		return dst, tagsPool
+	}
+	dstLen := len(dst)
+	tagsPoolLen := len(tagsPool)
+	var err error
+	dst, tagsPool, err = appendRows(dst, s, tagsPool)
+	if err != nil {
+		clear(dst[dstLen:])
+		dst = dst[:dstLen]
+		tagsPool = tagsPool[:tagsPoolLen]
+		logger.Errorf("cannot unmarshal StatsD line %q: %s", s, err)
+		invalidLines.Inc()
+	}
+	return dst, tagsPool
+}
+
+var invalidLines = metrics.NewCounter(`vm_rows_invalid_total{type="statsd"}`)
+
+// appendRows appends rows parsed from the line s in the format `<metric>:<value>[:<value>...]|<type>[|@<sample_rate>][|#<tags>][|T<timestamp>]` to dst.
+func appendRows(dst []Row, s string, tagsPool []Tag) ([]Row, []Tag, error) {
+	n := strings.IndexByte(s, '|')
+	if n < 0 {
+		return dst, tagsPool, fmt.Errorf("missing metric type")
+	}
+	metricAndValues := s[:n]
+	s = s[n+1:]
+
+	n = strings.IndexByte(metricAndValues, ':')
+	if n <= 0 {
+		return dst, tagsPool, fmt.Errorf("cannot find metric name and value separated by ':'")
+	}
+	metric := metricAndValues[:n]
+	values := metricAndValues[n+1:]
+
+	typ, s, _ := strings.Cut(s, "|")
+	switch typ {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution, TypeSet:
+	default:
+		return dst, tagsPool, fmt.Errorf("unsupported metric type %q; supported types: c, g, ms, h, d, s", typ)
+	}
+
+	sampleRate := 1.0
+	var timestamp int64
+	tagsStart := len(tagsPool)
+	for len(s) > 0 {
+		var section string
+		section, s, _ = strings.Cut(s, "|")
+		if len(section) == 0 {
+			continue
+		}
+		switch section[0] {
+		case '@':
+			v, err := fastfloat.Parse(section[1:])
+			if err != nil {
+				return dst, tagsPool, fmt.Errorf("cannot parse sample rate %q: %w", section[1:], err)
+			}
+			if v <= 0 || v > 1 {
+				return dst, tagsPool, fmt.Errorf("sample rate must be in the range (0..1]; got %v", v)
+			}
+			sampleRate = v
+		case '#':
+			tagsPool = unmarshalTags(tagsPool, section[1:])
+		case 'T':
+			ts, err := fastfloat.Parse(section[1:])
+			if err != nil {
+				return dst, tagsPool, fmt.Errorf("cannot parse timestamp %q: %w", section[1:], err)
+			}
+			timestamp = int64(ts)
+		default:
+			// Ignore unknown sections such as DogStatsD container id `|c:<container_id>`,
+			// since new sections may be added to the protocol in the future.
+		}
+	}
+	tags := tagsPool[tagsStart:]
+	tags = tags[:len(tags):len(tags)]
+	if len(tags) == 0 {
+		tags = nil
+	}
+
+	for {
+		valueStr, tail, hasTail := strings.Cut(values, ":")
+		if len(valueStr) == 0 {
+			return dst, tagsPool, fmt.Errorf("missing value")
+		}
+		var v float64
+		if typ == TypeSet {
+			// Set values may be arbitrary strings. Convert them to float64 numbers, which fit 53-bit mantissa,
+			// so they could be counted with unique_samples aggregation output.
+			v = float64(xxhash.Sum64String(valueStr) >> 11)
+		} else {
+			// fastfloat.Parse doesn't accept the leading `+` sign, which is used in gauge deltas.
+			numStr := strings.TrimPrefix(valueStr, "+")
+			var err error
+			v, err = fastfloat.Parse(numStr)
+			if err != nil {
+				return dst, tagsPool, fmt.Errorf("cannot parse value %q: %w", valueStr, err)
+			}
+		}
+		if typ == TypeCounter {
+			v /= sampleRate
+		}
+		dst = append(dst, Row{
+			Metric:       metric,
+			Tags:         tags,
+			Type:         typ,
+			Value:        v,
+			IsGaugeDelta: typ == TypeGauge && (valueStr[0] == '+' || valueStr[0] == '-'),
+			Timestamp:    timestamp,
+		})
+		if !hasTail {
+			return dst, tagsPool, nil
+		}
+		values = tail
+	}
+}
+
+func unmarshalTags(dst []Tag, s string) []Tag {
+	for len(s) > 0 {
+		var tag string
+		tag, s, _ = strings.Cut(s, ",")
+		if len(tag) == 0 {
+			continue
+		}
+		key, value := datadogutil.SplitTag(tag)
+		if len(key) == 0 || len(value) == 0 {
+			// Skip empty tag
+			continue
+		}
+		dst = append(dst, Tag{
+			Key:   key,
+			Value: value,
+		})
+	}
+	return dst
+}
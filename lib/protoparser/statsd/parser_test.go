@@ -0,0 +1,205 @@
+package statsd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestRowsUnmarshalFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		var rows Rows
+		rows.Unmarshal(s)
+		if len(rows.Rows) != 0 {
+			t.Fatalf("expecting zero rows; got %d rows", len(rows.Rows))
+		}
+
+		// Try again
+		rows.Unmarshal(s)
+		if len(rows.Rows) != 0 {
+			t.Fatalf("expecting zero rows; got %d rows", len(rows.Rows))
+		}
+	}
+
+	// Missing type
+	f("foo:1")
+
+	// Missing value
+	f("foo|c")
+	f("foo:|c")
+	f(":1|c")
+
+	// Unsupported type
+	f("foo:1|x")
+	f("foo:1")
+
+	// Invalid value
+	f("foo:bar|c")
+	f("foo:1:|ms")
+	f("foo:+|g")
+	f("foo:++1|g")
+
+	// Invalid sample rate
+	f("foo:1|c|@bar")
+	f("foo:1|c|@0")
+	f("foo:1|c|@2")
+
+	// Invalid timestamp
+	f("foo:1|g|Tbar")
+}
+
+func TestRowsUnmarshalSuccess(t *testing.T) {
+	f := func(s string, rowsExpected *Rows) {
+		t.Helper()
+		var rows Rows
+		rows.Unmarshal(s)
+		if !reflect.DeepEqual(rows.Rows, rowsExpected.Rows) {
+			t.Fatalf("unexpected rows;\ngot\n%+v\nwant\n%+v", rows.Rows, rowsExpected.Rows)
+		}
+
+		// Try unmarshaling again
+		rows.Unmarshal(s)
+		if !reflect.DeepEqual(rows.Rows, rowsExpected.Rows) {
+			t.Fatalf("unexpected rows at the second unmarshal;\ngot\n%+v\nwant\n%+v", rows.Rows, rowsExpected.Rows)
+		}
+
+		rows.Reset()
+		if len(rows.Rows) != 0 {
+			t.Fatalf("non-empty rows after reset: %+v", rows.Rows)
+		}
+	}
+
+	// Empty line
+	f("", &Rows{})
+	f("\r", &Rows{})
+	f("\n\n", &Rows{})
+
+	// Counter
+	f("foo:1|c", &Rows{
+		Rows: []Row{{
+			Metric: "foo",
+			Type:   TypeCounter,
+			Value:  1,
+		}},
+	})
+
+	// Counter with sample rate
+	f("foo.bar:2|c|@0.1", &Rows{
+		Rows: []Row{{
+			Metric: "foo.bar",
+			Type:   TypeCounter,
+			Value:  20,
+		}},
+	})
+
+	// Gauge
+	f("foo:1.5|g", &Rows{
+		Rows: []Row{{
+			Metric: "foo",
+			Type:   TypeGauge,
+			Value:  1.5,
+		}},
+	})
+
+	// Gauges with signed values adjust the current value
+	f("foo:-1.5|g\nbar:+5|g", &Rows{
+		Rows: []Row{
+			{
+				Metric:       "foo",
+				Type:         TypeGauge,
+				Value:        -1.5,
+				IsGaugeDelta: true,
+			},
+			{
+				Metric:       "bar",
+				Type:         TypeGauge,
+				Value:        5,
+				IsGaugeDelta: true,
+			},
+		},
+	})
+
+	// Sign is ignored for non-gauges
+	f("foo:+1|c", &Rows{
+		Rows: []Row{{
+			Metric: "foo",
+			Type:   TypeCounter,
+			Value:  1,
+		}},
+	})
+
+	// Timer with multiple values and the sample rate, which is ignored for non-counters
+	f("foo:1:2.5|ms|@0.5", &Rows{
+		Rows: []Row{
+			{
+				Metric: "foo",
+				Type:   TypeTimer,
+				Value:  1,
+			},
+			{
+				Metric: "foo",
+				Type:   TypeTimer,
+				Value:  2.5,
+			},
+		},
+	})
+
+	// DogStatsD histogram and distribution with tags and timestamp
+	f("foo:3|h|#env:prod,host:a,single|T1700000000\nbar:4|d|c:container123|#x:y", &Rows{
+		Rows: []Row{
+			{
+				Metric: "foo",
+				Tags: []Tag{
+					{Key: "env", Value: "prod"},
+					{Key: "host", Value: "a"},
+					{Key: "single", Value: "no_label_value"},
+				},
+				Type:      TypeHistogram,
+				Value:     3,
+				Timestamp: 1700000000,
+			},
+			{
+				Metric: "bar",
+				Tags: []Tag{
+					{Key: "x", Value: "y"},
+				},
+				Type:  TypeDistribution,
+				Value: 4,
+			},
+		},
+	})
+
+	// Set
+	f("users:alice|s\nusers:42|s", &Rows{
+		Rows: []Row{
+			{
+				Metric: "users",
+				Type:   TypeSet,
+				Value:  float64(xxhash.Sum64String("alice") >> 11),
+			},
+			{
+				Metric: "users",
+				Type:   TypeSet,
+				Value:  float64(xxhash.Sum64String("42") >> 11),
+			},
+		},
+	})
+
+	// Invalid lines are skipped
+	f("foo:1|c\nbar\r\n baz:2|g ", &Rows{
+		Rows: []Row{
+			{
+				Metric: "foo",
+				Type:   TypeCounter,
+				Value:  1,
+			},
+			{
+				Metric: "baz",
+				Type:   TypeGauge,
+				Value:  2,
+			},
+		},
+	})
+}
@@ -42,6 +42,9 @@ type Tracer struct {
 	// span contains span for the given Tracer. It is added via Tracer.AddJSON().
 	// If span is non-nil, then the remaining fields aren't used.
 	span *span
+
+	// isExportOnly is set for tracers created via NewForExport.
+	isExportOnly bool
 }
 
 // New creates a new instance of the tracer with the given fmt.Sprintf(format, args...) message.
@@ -61,6 +64,20 @@ func New(enabled bool, format string, args ...any) *Tracer {
 	}
 }
 
+// NewForExport creates a new instance of the tracer with the given fmt.Sprintf(format, args...) message,
+// which can be exported to external tracing systems via ToSpanData.
+//
+// Unlike New, ToJSON for the returned tracer returns an empty string, so the trace isn't returned to the client.
+//
+// Done or Donef must be called when the tracer should be finished.
+func NewForExport(format string, args ...any) *Tracer {
+	t := New(true, format, args...)
+	if t != nil {
+		t.isExportOnly = true
+	}
+	return t
+}
+
 // Enabled returns true if the t is enabled.
 func (t *Tracer) Enabled() bool {
 	return t != nil
@@ -216,8 +233,10 @@ func (t *Tracer) String() string {
 //
 // It is safe calling ToJSON() when child tracers aren't finished yet.
 // In this case they will contain the corresponding message.
+//
+// An empty string is returned for tracers created via NewForExport.
 func (t *Tracer) ToJSON() string {
-	if t == nil {
+	if t == nil || t.isExportOnly {
 		return ""
 	}
 	s := t.toSpan()
@@ -271,6 +290,97 @@ func (t *Tracer) toSpanInternal(prevTime time.Time) (*span, time.Time) {
 	return s, doneTime
 }
 
+// SpanData contains timing information for a single trace entry.
+//
+// It is used for exporting query traces to external tracing systems.
+type SpanData struct {
+	// Message is a trace message
+	Message string
+
+	// StartTime is the start time for the trace entry
+	StartTime time.Time
+
+	// EndTime is the end time for the trace entry
+	EndTime time.Time
+
+	// Children contains children trace entries
+	Children []*SpanData
+}
+
+// ToSpanData returns SpanData representation of t.
+//
+// ToSpanData must be called when t methods aren't called by other goroutines.
+//
+// It is safe calling ToSpanData() when child tracers aren't finished yet.
+// In this case they will contain the corresponding message.
+func (t *Tracer) ToSpanData() *SpanData {
+	if t == nil {
+		return nil
+	}
+	sd, _ := t.toSpanDataInternal(t.startTime)
+	return sd
+}
+
+func (t *Tracer) toSpanDataInternal(prevTime time.Time) (*SpanData, time.Time) {
+	if t.span != nil {
+		return t.span.toSpanData(prevTime)
+	}
+	if !t.isDone.Load() {
+		sd := &SpanData{
+			Message:   fmt.Sprintf("missing Tracer.Done() call for the trace with message=%s", t.message),
+			StartTime: prevTime,
+			EndTime:   prevTime,
+		}
+		return sd, prevTime
+	}
+	if t.doneTime.Equal(t.startTime) {
+		// a single-line trace covers the time since the previous trace entry
+		sd := &SpanData{
+			Message:   t.message,
+			StartTime: prevTime,
+			EndTime:   t.doneTime,
+		}
+		return sd, t.doneTime
+	}
+	// tracer with children
+	var children []*SpanData
+	var sdChild *SpanData
+	prevChildTime := t.startTime
+	for _, child := range t.children {
+		sdChild, prevChildTime = child.toSpanDataInternal(prevChildTime)
+		children = append(children, sdChild)
+	}
+	sd := &SpanData{
+		Message:   t.message,
+		StartTime: t.startTime,
+		EndTime:   t.doneTime,
+		Children:  children,
+	}
+	return sd, t.doneTime
+}
+
+// toSpanData converts s to SpanData starting at startTime.
+//
+// Children spans are placed sequentially, since s contains only durations.
+func (s *span) toSpanData(startTime time.Time) (*SpanData, time.Time) {
+	d := time.Duration(s.DurationMsec * float64(time.Millisecond))
+	endTime := startTime.Add(d)
+	var children []*SpanData
+	var sdChild *SpanData
+	prevChildTime := startTime
+	for _, child := range s.Children {
+		sdChild, prevChildTime = child.toSpanData(prevChildTime)
+		children = append(children, sdChild)
+	}
+	sd := &SpanData{
+		Message:   s.Message,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Children:  children,
+	}
+	return sd, endTime
+}
+
 // span represents a single trace span
 type span struct {
 	// DurationMsec is the duration for the current trace span in milliseconds.
@@ -1,9 +1,11 @@
 package querytracer
 
 import (
+	"reflect"
 	"regexp"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestTracerDisabled(t *testing.T) {
@@ -236,3 +238,49 @@ func zeroJSONDurationsInTrace(s string) string {
 }
 
 var skipJSONDurationRe = regexp.MustCompile(`"duration_msec":[0-9.]+`)
+
+func TestTracerForExport(t *testing.T) {
+	qt := NewForExport("test")
+	if !qt.Enabled() {
+		t.Fatalf("query tracer must be enabled")
+	}
+	qtChild := qt.NewChild("child done %d", 456)
+	qtChild.Printf("foo %d", 123)
+	qtChild.Done()
+	qt.Printf("parent %d", 789)
+	if err := qt.AddJSON([]byte(`{"duration_msec":1.5,"message":"remote","children":[{"duration_msec":1,"message":"remote child"}]}`)); err != nil {
+		t.Fatalf("unexpected error in AddJSON: %s", err)
+	}
+	qt.Done()
+	if s := qt.ToJSON(); s != "" {
+		t.Fatalf("unexpected json trace; got %s; want empty", s)
+	}
+
+	var messages []string
+	var walk func(sd *SpanData)
+	walk = func(sd *SpanData) {
+		if sd.EndTime.Before(sd.StartTime) {
+			t.Fatalf("unexpected span %q; end time %s is smaller than start time %s", sd.Message, sd.EndTime, sd.StartTime)
+		}
+		messages = append(messages, sd.Message)
+		for _, child := range sd.Children {
+			walk(child)
+		}
+	}
+	sd := qt.ToSpanData()
+	walk(sd)
+	messagesExpected := []string{": test", "child done 456", "foo 123", "parent 789", "remote", "remote child"}
+	if !reflect.DeepEqual(messages, messagesExpected) {
+		t.Fatalf("unexpected messages\ngot\n%q\nwant\n%q", messages, messagesExpected)
+	}
+	remote := sd.Children[2]
+	if d := remote.EndTime.Sub(remote.StartTime); d != 1500*time.Microsecond {
+		t.Fatalf("unexpected duration for the span added via AddJSON; got %s; want 1.5ms", d)
+	}
+
+	// Disabled tracer
+	var qtNil *Tracer
+	if sd := qtNil.ToSpanData(); sd != nil {
+		t.Fatalf("expecting nil SpanData for disabled tracer; got %v", sd)
+	}
+}
@@ -0,0 +1,144 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket limits per-second rate of arbitrary resources according to token bucket algorithm.
+//
+// Unlike RateLimiter, it never blocks. Callers must decide what to do when the limit is exceeded.
+type TokenBucket struct {
+	// perSecondLimit is the rate at which the bucket is refilled.
+	perSecondLimit float64
+
+	// burst is the maximum number of tokens the bucket can hold.
+	burst float64
+
+	// mu protects tokens and lastUpdate from concurrent access.
+	mu sync.Mutex
+
+	// The number of available tokens. It may become negative after Take() call.
+	tokens float64
+
+	// The last time tokens were refilled.
+	lastUpdate time.Time
+}
+
+// NewTokenBucket creates new token bucket with the given perSecondLimit and burst.
+//
+// The returned bucket is initially full. If burst <= 0, then it is set to perSecondLimit.
+func NewTokenBucket(perSecondLimit, burst float64) *TokenBucket {
+	if burst <= 0 {
+		burst = perSecondLimit
+	}
+	return &TokenBucket{
+		perSecondLimit: perSecondLimit,
+		burst:          burst,
+		tokens:         burst,
+		lastUpdate:     time.Now(),
+	}
+}
+
+// TryTake takes n tokens from tb if tb contains at least n tokens.
+//
+// It returns zero on success. Otherwise, it returns the duration after which n tokens become available.
+// n is capped by the bucket burst, so requests for more than burst tokens can eventually succeed.
+// TryTake(0) succeeds if tb isn't in debt after Take() calls.
+func (tb *TokenBucket) TryTake(n float64) time.Duration {
+	return tb.tryTake(time.Now(), n)
+}
+
+func (tb *TokenBucket) tryTake(now time.Time, n float64) time.Duration {
+	if tb == nil || tb.perSecondLimit <= 0 {
+		return 0
+	}
+	n = min(n, tb.burst)
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(now)
+	if tb.tokens >= n {
+		tb.tokens -= n
+		return 0
+	}
+	missing := n - tb.tokens
+	return time.Duration(missing / tb.perSecondLimit * float64(time.Second))
+}
+
+// TryTakeAll takes ns[i] tokens from every tbs[i] only if all the buckets contain enough tokens.
+//
+// It returns zero and -1 on success. Otherwise, no tokens are taken, and the duration after which the tokens become available
+// at the first bucket without enough tokens is returned together with the index of this bucket.
+// nil buckets are skipped. The buckets are locked in the order they are passed, so callers must pass the same buckets
+// in the same order in order to avoid deadlocks. The same bucket mustn't be passed multiple times.
+func TryTakeAll(tbs []*TokenBucket, ns []float64) (time.Duration, int) {
+	return tryTakeAll(time.Now(), tbs, ns)
+}
+
+func tryTakeAll(now time.Time, tbs []*TokenBucket, ns []float64) (time.Duration, int) {
+	for _, tb := range tbs {
+		if tb.isEnabled() {
+			tb.mu.Lock()
+		}
+	}
+	defer func() {
+		for _, tb := range tbs {
+			if tb.isEnabled() {
+				tb.mu.Unlock()
+			}
+		}
+	}()
+
+	for i, tb := range tbs {
+		if !tb.isEnabled() {
+			continue
+		}
+		tb.refill(now)
+		n := min(ns[i], tb.burst)
+		if tb.tokens < n {
+			missing := n - tb.tokens
+			return time.Duration(missing / tb.perSecondLimit * float64(time.Second)), i
+		}
+	}
+	for i, tb := range tbs {
+		if tb.isEnabled() {
+			tb.tokens -= min(ns[i], tb.burst)
+		}
+	}
+	return 0, -1
+}
+
+func (tb *TokenBucket) isEnabled() bool {
+	return tb != nil && tb.perSecondLimit > 0
+}
+
+// Take unconditionally takes n tokens from tb.
+//
+// tb may go into debt after this call, so subsequent TryTake() calls fail until the debt is repaid.
+// This is useful for resources, which amount isn't known beforehand, such as the size of streamed data.
+func (tb *TokenBucket) Take(n float64) {
+	tb.take(time.Now(), n)
+}
+
+func (tb *TokenBucket) take(now time.Time, n float64) {
+	if tb == nil || tb.perSecondLimit <= 0 {
+		return
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(now)
+	tb.tokens -= n
+}
+
+func (tb *TokenBucket) refill(now time.Time) {
+	d := now.Sub(tb.lastUpdate).Seconds()
+	if d <= 0 {
+		return
+	}
+	tb.lastUpdate = now
+	tb.tokens = min(tb.tokens+d*tb.perSecondLimit, tb.burst)
+}
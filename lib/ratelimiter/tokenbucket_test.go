@@ -0,0 +1,87 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(10, 20)
+	now := tb.lastUpdate
+
+	f := func(n float64, retryAfterExpected time.Duration) {
+		t.Helper()
+		retryAfter := tb.tryTake(now, n)
+		if retryAfter != retryAfterExpected {
+			t.Fatalf("unexpected retryAfter for n=%v; got %s; want %s", n, retryAfter, retryAfterExpected)
+		}
+	}
+
+	// the bucket is initially full
+	f(15, 0)
+	f(5, 0)
+	f(1, 100*time.Millisecond)
+	f(0, 0)
+
+	// the bucket is refilled with time
+	now = now.Add(500 * time.Millisecond)
+	f(6, 100*time.Millisecond)
+	f(5, 0)
+
+	// the bucket cannot hold more than burst tokens
+	now = now.Add(time.Hour)
+	f(25, 0)
+	f(1, 100*time.Millisecond)
+
+	// debt must be repaid before taking new tokens
+	now = now.Add(2 * time.Second)
+	tb.take(now, 50)
+	f(0, 3*time.Second)
+	now = now.Add(3 * time.Second)
+	f(0, 0)
+	f(1, 100*time.Millisecond)
+}
+
+func TestTokenBucketNoLimit(t *testing.T) {
+	var tb *TokenBucket
+	if d := tb.TryTake(100); d != 0 {
+		t.Fatalf("unexpected retryAfter for nil bucket: %s", d)
+	}
+	tb.Take(100)
+
+	tb = NewTokenBucket(0, 0)
+	if d := tb.TryTake(100); d != 0 {
+		t.Fatalf("unexpected retryAfter for zero limit: %s", d)
+	}
+}
+
+func TestTryTakeAll(t *testing.T) {
+	requests := NewTokenBucket(1, 2)
+	bytes := NewTokenBucket(10, 100)
+	now := requests.lastUpdate
+	bytes.lastUpdate = now
+	tbs := []*TokenBucket{requests, nil, bytes}
+
+	f := func(n float64, retryAfterExpected time.Duration, idxExpected int) {
+		t.Helper()
+		retryAfter, idx := tryTakeAll(now, tbs, []float64{1, 1, n})
+		if retryAfter != retryAfterExpected {
+			t.Fatalf("unexpected retryAfter for n=%v; got %s; want %s", n, retryAfter, retryAfterExpected)
+		}
+		if idx != idxExpected {
+			t.Fatalf("unexpected idx for n=%v; got %d; want %d", n, idx, idxExpected)
+		}
+	}
+
+	f(60, 0, -1)
+
+	// tokens mustn't be taken from the requests bucket if the bytes bucket has no enough tokens
+	f(50, time.Second, 2)
+	f(40, 0, -1)
+
+	// the requests bucket is empty
+	f(0, time.Second, 0)
+	if bytes.tokens != 0 {
+		t.Fatalf("unexpected tokens in the bytes bucket; got %v; want 0", bytes.tokens)
+	}
+}
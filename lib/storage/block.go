@@ -7,6 +7,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
@@ -150,8 +151,9 @@ func (b *Block) tooBig() bool {
 }
 
 func (b *Block) deduplicateSamplesDuringMerge() {
-	if !isDedupEnabled() {
-		// Deduplication is disabled
+	currentTimestamp := int64(fasttime.UnixTimestamp()) * 1000
+	if !isDedupEnabled() && !needsDownsampling(b.bh.MinTimestamp, currentTimestamp) {
+		// Deduplication is disabled and the block doesn't contain samples for downsampling.
 		return
 	}
 	// Unmarshal block if it isn't unmarshaled yet in order to apply the de-duplication to unmarshaled samples.
@@ -164,12 +166,8 @@ func (b *Block) deduplicateSamplesDuringMerge() {
 		return
 	}
 	dedupInterval := GetDedupInterval()
-	if dedupInterval <= 0 {
-		// Deduplication is disabled.
-		return
-	}
 	srcValues := b.values[b.nextIdx:]
-	timestamps, values := deduplicateSamplesDuringMerge(srcTimestamps, srcValues, dedupInterval)
+	timestamps, values := downsampleSamplesDuringMerge(srcTimestamps, srcValues, dedupInterval, currentTimestamp)
 	dedups := len(srcTimestamps) - len(timestamps)
 	dedupsDuringMerge.Add(uint64(dedups))
 	b.timestamps = b.timestamps[:b.nextIdx+len(timestamps)]
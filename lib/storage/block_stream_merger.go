@@ -16,6 +16,11 @@ type blockStreamMerger struct {
 	// Blocks with smaller timestamps are removed because of retention.
 	retentionDeadline int64
 
+	// retentionFilters is used for obtaining retention deadlines for time series matching retention filters.
+	//
+	// It is nil if retention filters aren't set.
+	retentionFilters *retentionFilters
+
 	// Whether the call to NextBlock must be no-op.
 	nextBlockNoop bool
 
@@ -35,15 +40,17 @@ func (bsm *blockStreamMerger) reset() {
 	bsm.bsrHeap = bsm.bsrHeap[:0]
 
 	bsm.retentionDeadline = 0
+	bsm.retentionFilters = nil
 	bsm.nextBlockNoop = false
 	bsm.err = nil
 	bsm.useSparseCache = false
 }
 
 // Init initializes bsm with the given bsrs.
-func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, retentionDeadline int64, useSparseCache bool) {
+func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, retentionDeadline int64, rfs *retentionFilters, useSparseCache bool) {
 	bsm.reset()
 	bsm.retentionDeadline = retentionDeadline
+	bsm.retentionFilters = rfs
 	for _, bsr := range bsrs {
 		if bsr.NextBlock() {
 			bsm.bsrHeap = append(bsm.bsrHeap, bsr)
@@ -66,8 +73,8 @@ func (bsm *blockStreamMerger) Init(bsrs []*blockStreamReader, retentionDeadline
 	bsm.useSparseCache = useSparseCache
 }
 
-func (bsm *blockStreamMerger) getRetentionDeadline(_ *blockHeader) int64 {
-	return bsm.retentionDeadline
+func (bsm *blockStreamMerger) getRetentionDeadline(bh *blockHeader) int64 {
+	return bsm.retentionFilters.getRetentionDeadline(bh.TSID.MetricID, bsm.retentionDeadline)
 }
 
 // NextBlock stores the next block in bsm.Block.
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// SetDownsamplingPeriods sets downsampling periods from the given `offset:interval` items.
+//
+// The last sample per each interval is left for samples older than the offset.
+// For example, `30d:5m` leaves the last sample per each 5-minute interval for samples older than 30 days.
+//
+// This function must be called after SetDedupInterval and before initializing the storage.
+func SetDownsamplingPeriods(items []string) error {
+	dps, err := parseDownsamplingPeriods(items, globalDedupInterval)
+	if err != nil {
+		return err
+	}
+	downsamplingPeriods = dps
+	return nil
+}
+
+// IsDownsamplingEnabled returns true if downsampling periods have been set via SetDownsamplingPeriods.
+func IsDownsamplingEnabled() bool {
+	return len(downsamplingPeriods) > 0
+}
+
+// downsamplingPeriods contains downsampling periods sorted by offset in descending order.
+var downsamplingPeriods []downsamplingPeriod
+
+type downsamplingPeriod struct {
+	// offset is the offset from the current time in milliseconds. Samples older than the offset are downsampled.
+	offset int64
+
+	// interval is the downsampling interval in milliseconds.
+	interval int64
+}
+
+func (dp *downsamplingPeriod) String() string {
+	return fmt.Sprintf("%dms:%dms", dp.offset, dp.interval)
+}
+
+// deadline returns the timestamp in milliseconds, which doesn't exceed currentTimestamp-dp.offset and is aligned to dp.interval.
+//
+// Samples with timestamps smaller or equal to the deadline must be downsampled with dp.interval.
+// The alignment guarantees that downsampling intervals do not cross the deadline.
+func (dp *downsamplingPeriod) deadline(currentTimestamp int64) int64 {
+	d := currentTimestamp - dp.offset
+	return d - d%dp.interval
+}
+
+func parseDownsamplingPeriods(items []string, dedupInterval int64) ([]downsamplingPeriod, error) {
+	var dps []downsamplingPeriod
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "{") {
+			return nil, fmt.Errorf("series filters aren't supported in -downsampling.period=%q; use offset:interval syntax", item)
+		}
+		offsetStr, intervalStr, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("missing ':' in -downsampling.period=%q; it must have offset:interval syntax", item)
+		}
+		offset, err := metricsql.DurationValue(offsetStr, 0)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("cannot parse offset in -downsampling.period=%q: it must be non-negative duration", item)
+		}
+		interval, err := metricsql.PositiveDurationValue(intervalStr, 0)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("cannot parse interval in -downsampling.period=%q: it must be positive duration", item)
+		}
+		if offset%interval != 0 {
+			return nil, fmt.Errorf("offset must be a multiple of interval in -downsampling.period=%q", item)
+		}
+		if dedupInterval > 0 {
+			if offset == 0 {
+				return nil, fmt.Errorf("-downsampling.period=%q with zero offset cannot be used together with -dedup.minScrapeInterval", item)
+			}
+			if interval%dedupInterval != 0 {
+				return nil, fmt.Errorf("interval in -downsampling.period=%q must be a multiple of -dedup.minScrapeInterval=%dms", item, dedupInterval)
+			}
+		}
+		dps = append(dps, downsamplingPeriod{
+			offset:   offset,
+			interval: interval,
+		})
+	}
+	sort.Slice(dps, func(i, j int) bool {
+		return dps[i].offset > dps[j].offset
+	})
+	for i := 1; i < len(dps); i++ {
+		older := &dps[i-1]
+		newer := &dps[i]
+		if older.offset == newer.offset {
+			return nil, fmt.Errorf("duplicate offset in -downsampling.period: %s and %s", older, newer)
+		}
+		if older.interval <= newer.interval || older.interval%newer.interval != 0 {
+			return nil, fmt.Errorf("interval for the bigger offset must be a multiple of the interval for the smaller offset in -downsampling.period; got %s and %s", older, newer)
+		}
+	}
+	return dps, nil
+}
+
+// getDownsamplingInterval returns the biggest interval in milliseconds, which must be applied to all the samples
+// with timestamps smaller or equal to maxTimestamp at currentTimestamp.
+//
+// It returns the deduplication interval if the samples mustn't be downsampled.
+func getDownsamplingInterval(maxTimestamp, currentTimestamp int64) int64 {
+	for i := range downsamplingPeriods {
+		dp := &downsamplingPeriods[i]
+		if maxTimestamp <= dp.deadline(currentTimestamp) {
+			return dp.interval
+		}
+	}
+	return globalDedupInterval
+}
+
+// needsDownsampling returns true if samples with timestamps starting from minTimestamp may need downsampling at currentTimestamp.
+func needsDownsampling(minTimestamp, currentTimestamp int64) bool {
+	if len(downsamplingPeriods) == 0 {
+		return false
+	}
+	dp := &downsamplingPeriods[len(downsamplingPeriods)-1]
+	return minTimestamp <= dp.deadline(currentTimestamp)
+}
+
+// DownsampleSamples applies the downsampling periods set via SetDownsamplingPeriods to src* samples
+// and de-duplicates the rest of samples with dedupInterval in milliseconds.
+//
+// currentTimestamp is the current time in milliseconds, which is used for determining sample ages.
+func DownsampleSamples(srcTimestamps []int64, srcValues []float64, dedupInterval, currentTimestamp int64) ([]int64, []float64) {
+	return downsampleSamplesGeneric(srcTimestamps, srcValues, dedupInterval, currentTimestamp, DeduplicateSamples)
+}
+
+func downsampleSamplesDuringMerge(srcTimestamps, srcValues []int64, dedupInterval, currentTimestamp int64) ([]int64, []int64) {
+	return downsampleSamplesGeneric(srcTimestamps, srcValues, dedupInterval, currentTimestamp, deduplicateSamplesDuringMerge)
+}
+
+func downsampleSamplesGeneric[T int64 | float64](srcTimestamps []int64, srcValues []T, dedupInterval, currentTimestamp int64,
+	dedup func(timestamps []int64, values []T, interval int64) ([]int64, []T)) ([]int64, []T) {
+	if len(srcTimestamps) == 0 || !needsDownsampling(srcTimestamps[0], currentTimestamp) {
+		// Fast path - there is no need in downsampling
+		return dedup(srcTimestamps, srcValues, dedupInterval)
+	}
+
+	// The downsampled samples are written to the beginning of src* slices.
+	// This is safe, since the number of written samples cannot exceed the number of processed samples.
+	dstTimestamps := srcTimestamps[:0]
+	dstValues := srcValues[:0]
+	for i := range downsamplingPeriods {
+		dp := &downsamplingPeriods[i]
+		deadline := dp.deadline(currentTimestamp)
+		n := sort.Search(len(srcTimestamps), func(i int) bool {
+			return srcTimestamps[i] > deadline
+		})
+		if n == 0 {
+			continue
+		}
+		timestamps, values := dedup(srcTimestamps[:n], srcValues[:n], dp.interval)
+		dstTimestamps = append(dstTimestamps, timestamps...)
+		dstValues = append(dstValues, values...)
+		srcTimestamps = srcTimestamps[n:]
+		srcValues = srcValues[n:]
+	}
+	timestamps, values := dedup(srcTimestamps, srcValues, dedupInterval)
+	dstTimestamps = append(dstTimestamps, timestamps...)
+	dstValues = append(dstValues, values...)
+	return dstTimestamps, dstValues
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDownsamplingPeriodsSuccess(t *testing.T) {
+	f := func(items []string, dedupInterval int64, dpsExpected []downsamplingPeriod) {
+		t.Helper()
+		dps, err := parseDownsamplingPeriods(items, dedupInterval)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(dps, dpsExpected) {
+			t.Fatalf("unexpected downsampling periods\ngot\n%v\nwant\n%v", dps, dpsExpected)
+		}
+	}
+	f(nil, 0, nil)
+	f([]string{""}, 0, nil)
+	f([]string{"0s:1m"}, 0, []downsamplingPeriod{
+		{offset: 0, interval: 60_000},
+	})
+	f([]string{"30d:5m", "180d:1h"}, 0, []downsamplingPeriod{
+		{offset: 180 * 24 * 3600_000, interval: 3600_000},
+		{offset: 30 * 24 * 3600_000, interval: 300_000},
+	})
+	f([]string{"180d:1h", "30d:5m"}, 30_000, []downsamplingPeriod{
+		{offset: 180 * 24 * 3600_000, interval: 3600_000},
+		{offset: 30 * 24 * 3600_000, interval: 300_000},
+	})
+}
+
+func TestParseDownsamplingPeriodsFailure(t *testing.T) {
+	f := func(items []string, dedupInterval int64) {
+		t.Helper()
+		if _, err := parseDownsamplingPeriods(items, dedupInterval); err == nil {
+			t.Fatalf("expecting non-nil error for %q", items)
+		}
+	}
+
+	// missing interval
+	f([]string{"30d"}, 0)
+
+	// invalid durations
+	f([]string{"foo:5m"}, 0)
+	f([]string{"30d:bar"}, 0)
+	f([]string{"-1d:5m"}, 0)
+	f([]string{"30d:0s"}, 0)
+
+	// series filters
+	f([]string{`{env="dev"}:30d:5m`}, 0)
+
+	// offset isn't a multiple of interval
+	f([]string{"1h:7m"}, 0)
+
+	// duplicate offsets
+	f([]string{"30d:5m", "30d:1h"}, 0)
+
+	// interval for the bigger offset is smaller than the interval for the smaller offset
+	f([]string{"30d:1h", "180d:5m"}, 0)
+
+	// intervals aren't multiples of each other
+	f([]string{"30d:2m", "180d:5m"}, 0)
+
+	// interval isn't a multiple of dedup interval
+	f([]string{"30d:5m"}, 7_000)
+
+	// zero offset together with deduplication
+	f([]string{"0s:5m"}, 30_000)
+}
+
+func TestGetDownsamplingInterval(t *testing.T) {
+	defer func() {
+		downsamplingPeriods = nil
+		globalDedupInterval = 0
+	}()
+	downsamplingPeriods = []downsamplingPeriod{
+		{offset: 100, interval: 20},
+		{offset: 40, interval: 10},
+	}
+	globalDedupInterval = 5
+
+	f := func(maxTimestamp, intervalExpected int64) {
+		t.Helper()
+		interval := getDownsamplingInterval(maxTimestamp, 200)
+		if interval != intervalExpected {
+			t.Fatalf("unexpected interval for maxTimestamp=%d; got %d; want %d", maxTimestamp, interval, intervalExpected)
+		}
+	}
+	f(0, 20)
+	f(100, 20)
+	f(101, 10)
+	f(160, 10)
+	f(161, 5)
+	f(300, 5)
+}
+
+func TestDownsampleSamples(t *testing.T) {
+	defer func() {
+		downsamplingPeriods = nil
+	}()
+	downsamplingPeriods = []downsamplingPeriod{
+		{offset: 100, interval: 20},
+		{offset: 40, interval: 10},
+	}
+
+	f := func(timestamps []int64, dedupInterval int64, timestampsExpected []int64) {
+		t.Helper()
+
+		values := make([]float64, len(timestamps))
+		for i, ts := range timestamps {
+			values[i] = float64(ts)
+		}
+		timestampsCopy := append([]int64(nil), timestamps...)
+		resultTimestamps, resultValues := DownsampleSamples(timestampsCopy, values, dedupInterval, 200)
+		if !reflect.DeepEqual(resultTimestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps\ngot\n%v\nwant\n%v", resultTimestamps, timestampsExpected)
+		}
+		for i, v := range resultValues {
+			if v != float64(resultTimestamps[i]) {
+				t.Fatalf("unexpected value at position %d; got %v; want %v", i, v, float64(resultTimestamps[i]))
+			}
+		}
+
+		timestampsCopy = append(timestampsCopy[:0], timestamps...)
+		valuesInt := append([]int64(nil), timestamps...)
+		resultTimestamps, resultValuesInt := downsampleSamplesDuringMerge(timestampsCopy, valuesInt, dedupInterval, 200)
+		if !reflect.DeepEqual(resultTimestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps during merge\ngot\n%v\nwant\n%v", resultTimestamps, timestampsExpected)
+		}
+		if !reflect.DeepEqual(resultValuesInt, timestampsExpected) {
+			t.Fatalf("unexpected values during merge\ngot\n%v\nwant\n%v", resultValuesInt, timestampsExpected)
+		}
+	}
+
+	newTimestamps := func(start, end, step int64) []int64 {
+		var timestamps []int64
+		for ts := start; ts <= end; ts += step {
+			timestamps = append(timestamps, ts)
+		}
+		return timestamps
+	}
+
+	// empty samples
+	f(nil, 0, nil)
+
+	// recent samples aren't downsampled
+	f(newTimestamps(165, 200, 5), 0, newTimestamps(165, 200, 5))
+
+	// recent samples are de-duplicated
+	f(newTimestamps(165, 200, 5), 10, newTimestamps(170, 200, 10))
+
+	// samples are downsampled according to their age
+	var timestampsExpected []int64
+	timestampsExpected = append(timestampsExpected, newTimestamps(0, 100, 20)...)
+	timestampsExpected = append(timestampsExpected, newTimestamps(110, 160, 10)...)
+	timestampsExpected = append(timestampsExpected, newTimestamps(165, 200, 5)...)
+	f(newTimestamps(0, 200, 5), 0, timestampsExpected)
+
+	// samples older than the biggest offset only
+	f(newTimestamps(1, 99, 2), 0, []int64{19, 39, 59, 79, 99})
+}
@@ -0,0 +1,350 @@
+package exemplars
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+// approximate in-memory overhead per each stored exemplar: labels slice header + value + timestamp
+const exemplarOverhead = 24 + 8 + 8
+
+// approximate in-memory overhead per each stored series: map entry + key string header + series struct
+const seriesOverhead = 16 + 16 + 24
+
+// Storage is a bounded in-memory storage for exemplars.
+//
+// It keeps up to maxExemplarsPerSeries most recent exemplars per each series.
+// Exemplars with timestamps older than retentionMsecs are removed by MustCleanup() calls.
+type Storage struct {
+	maxSizeBytes          uint64
+	maxExemplarsPerSeries int
+	retentionMsecs        int64
+	path                  string
+
+	currentSizeBytes   atomic.Uint64
+	currentItemsCount  atomic.Uint64
+	currentSeriesCount atomic.Uint64
+	itemsDropped       atomic.Uint64
+
+	// mu protects series
+	mu sync.RWMutex
+
+	// series contains exemplars per each series, sorted by timestamp.
+	//
+	// The key is the canonical marshaled metric name for the series.
+	series map[string]*seriesExemplars
+
+	// helper for tests
+	getCurrentTimestamp func() int64
+}
+
+type seriesExemplars struct {
+	exemplars []prompb.Exemplar
+}
+
+type recordForStore struct {
+	MetricName []byte
+	Labels     []prompb.Label
+	Value      float64
+	Timestamp  int64
+}
+
+// MustLoadFrom loads exemplars storage from the given path.
+//
+// Exemplars with timestamps older than retentionMsecs are dropped.
+func MustLoadFrom(path string, maxSizeBytes uint64, maxExemplarsPerSeries int, retentionMsecs int64) *Storage {
+	s, err := loadFrom(path, maxSizeBytes, maxExemplarsPerSeries, retentionMsecs)
+	if err != nil {
+		logger.Errorf("exemplars file at path %s is invalid: %s; init new exemplars storage", path, err)
+		return newStorage(path, maxSizeBytes, maxExemplarsPerSeries, retentionMsecs)
+	}
+	return s
+}
+
+func newStorage(path string, maxSizeBytes uint64, maxExemplarsPerSeries int, retentionMsecs int64) *Storage {
+	if maxExemplarsPerSeries <= 0 {
+		maxExemplarsPerSeries = 1
+	}
+	return &Storage{
+		maxSizeBytes:          maxSizeBytes,
+		maxExemplarsPerSeries: maxExemplarsPerSeries,
+		retentionMsecs:        retentionMsecs,
+		path:                  path,
+		series:                make(map[string]*seriesExemplars),
+		getCurrentTimestamp: func() int64 {
+			return time.Now().UnixMilli()
+		},
+	}
+}
+
+func loadFrom(path string, maxSizeBytes uint64, maxExemplarsPerSeries int, retentionMsecs int64) (*Storage, error) {
+	s := newStorage(path, maxSizeBytes, maxExemplarsPerSeries, retentionMsecs)
+	if !fs.IsPathExist(path) {
+		// Fast path - nothing to load.
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read exemplars from %q: %w", path, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new gzip reader: %w", err)
+	}
+	defer func() {
+		if err := zr.Close(); err != nil {
+			logger.Panicf("FATAL: cannot close gzip reader: %s", err)
+		}
+	}()
+
+	jr := json.NewDecoder(zr)
+	for {
+		var r recordForStore
+		if err := jr.Decode(&r); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("cannot parse exemplar record: %w", err)
+		}
+		e := prompb.Exemplar{
+			Labels:    r.Labels,
+			Value:     r.Value,
+			Timestamp: r.Timestamp,
+		}
+		s.addLocked(string(r.MetricName), &e, s.getDeadline())
+	}
+	logger.Infof("loaded %d exemplars for %d series from %q", s.currentItemsCount.Load(), s.currentSeriesCount.Load(), path)
+	return s, nil
+}
+
+// MustClose saves s to the path it was loaded from.
+func (s *Storage) MustClose() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bb bytes.Buffer
+	zw := gzip.NewWriter(&bb)
+	jw := json.NewEncoder(zw)
+	var r recordForStore
+	for metricName, se := range s.series {
+		r.MetricName = []byte(metricName)
+		for i := range se.exemplars {
+			e := &se.exemplars[i]
+			r.Labels = e.Labels
+			r.Value = e.Value
+			r.Timestamp = e.Timestamp
+			if err := jw.Encode(&r); err != nil {
+				logger.Panicf("BUG: cannot encode exemplar record: %s", err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		logger.Panicf("BUG: cannot flush exemplars writer: %s", err)
+	}
+	fs.MustMkdirIfNotExist(filepath.Dir(s.path))
+	fs.MustWriteAtomic(s.path, bb.Bytes(), true)
+}
+
+// Add registers exemplar e for the series with the given canonical metricName.
+//
+// Exemplars with timestamps outside the retention are ignored, while exemplars for new series
+// are dropped if s exceeds its maximum size.
+func (s *Storage) Add(metricName string, e *prompb.Exemplar) {
+	deadline := s.getDeadline()
+	if e.Timestamp < deadline {
+		return
+	}
+
+	s.mu.Lock()
+	s.addLocked(metricName, e, deadline)
+	s.mu.Unlock()
+}
+
+func (s *Storage) addLocked(metricName string, e *prompb.Exemplar, deadline int64) {
+	if e.Timestamp < deadline {
+		return
+	}
+
+	// Validate the exemplar before registering a new series, so dropped exemplars do not leave empty series behind.
+	se := s.series[metricName]
+	var exemplars []prompb.Exemplar
+	seriesSize := uint64(0)
+	if se == nil {
+		seriesSize = uint64(len(metricName)) + seriesOverhead
+	} else {
+		exemplars = se.exemplars
+	}
+	n := sort.Search(len(exemplars), func(i int) bool {
+		return exemplars[i].Timestamp > e.Timestamp
+	})
+	for i := n - 1; i >= 0 && exemplars[i].Timestamp == e.Timestamp; i-- {
+		if isEqualExemplar(&exemplars[i], e) {
+			// The exemplar is already registered. This is usual case for exemplars exposed by scrape targets.
+			return
+		}
+	}
+	if len(exemplars) >= s.maxExemplarsPerSeries {
+		if n == 0 {
+			// The exemplar is older than the stored exemplars.
+			return
+		}
+		// Drop the oldest exemplar.
+		s.removeExemplar(&exemplars[0])
+		copy(exemplars, exemplars[1:n])
+		n--
+	} else {
+		if s.currentSizeBytes.Load()+seriesSize+exemplarSize(e) > s.maxSizeBytes {
+			s.itemsDropped.Add(1)
+			return
+		}
+		exemplars = append(exemplars, prompb.Exemplar{})
+		copy(exemplars[n+1:], exemplars[n:])
+	}
+	exemplars[n] = cloneExemplar(e)
+
+	if se == nil {
+		se = &seriesExemplars{}
+		s.series[strings.Clone(metricName)] = se
+		s.currentSizeBytes.Add(seriesSize)
+		s.currentSeriesCount.Add(1)
+	}
+	se.exemplars = exemplars
+	s.currentSizeBytes.Add(exemplarSize(e))
+	s.currentItemsCount.Add(1)
+}
+
+func (s *Storage) removeExemplar(e *prompb.Exemplar) {
+	s.currentSizeBytes.Add(^(exemplarSize(e) - 1))
+	s.currentItemsCount.Add(^uint64(0))
+}
+
+func isEqualExemplar(a, b *prompb.Exemplar) bool {
+	if a.Value != b.Value || a.Timestamp != b.Timestamp || len(a.Labels) != len(b.Labels) {
+		return false
+	}
+	for i := range a.Labels {
+		if a.Labels[i] != b.Labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func cloneExemplar(e *prompb.Exemplar) prompb.Exemplar {
+	// Exemplar labels may refer to reusable buffers at the caller side, so they must be cloned.
+	labels := make([]prompb.Label, len(e.Labels))
+	for i, label := range e.Labels {
+		labels[i] = prompb.Label{
+			Name:  strings.Clone(label.Name),
+			Value: strings.Clone(label.Value),
+		}
+	}
+	return prompb.Exemplar{
+		Labels:    labels,
+		Value:     e.Value,
+		Timestamp: e.Timestamp,
+	}
+}
+
+func exemplarSize(e *prompb.Exemplar) uint64 {
+	n := exemplarOverhead
+	for _, label := range e.Labels {
+		n += len(label.Name) + len(label.Value) + 32
+	}
+	return uint64(n)
+}
+
+// MustCleanup removes exemplars with timestamps outside the retention.
+func (s *Storage) MustCleanup() {
+	deadline := s.getDeadline()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for metricName, se := range s.series {
+		exemplars := se.exemplars
+		n := sort.Search(len(exemplars), func(i int) bool {
+			return exemplars[i].Timestamp >= deadline
+		})
+		if n == 0 {
+			continue
+		}
+		for i := range exemplars[:n] {
+			s.removeExemplar(&exemplars[i])
+		}
+		if n == len(exemplars) {
+			delete(s.series, metricName)
+			s.currentSizeBytes.Add(^(uint64(len(metricName)) + seriesOverhead - 1))
+			s.currentSeriesCount.Add(^uint64(0))
+			continue
+		}
+		tail := copy(exemplars, exemplars[n:])
+		clear(exemplars[tail:])
+		se.exemplars = exemplars[:tail]
+	}
+}
+
+func (s *Storage) getDeadline() int64 {
+	return s.getCurrentTimestamp() - s.retentionMsecs
+}
+
+// Search returns exemplars with timestamps in the range [minTimestamp ... maxTimestamp] for the series with the given canonical metricName.
+//
+// The returned exemplars are sorted by timestamp.
+func (s *Storage) Search(metricName string, minTimestamp, maxTimestamp int64) []prompb.Exemplar {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	se := s.series[metricName]
+	if se == nil {
+		return nil
+	}
+	var dst []prompb.Exemplar
+	for _, e := range se.exemplars {
+		if e.Timestamp < minTimestamp || e.Timestamp > maxTimestamp {
+			continue
+		}
+		// There is no need in cloning labels, since they are never modified after the exemplar is stored.
+		dst = append(dst, e)
+	}
+	return dst
+}
+
+// Metrics holds metrics for Storage.
+type Metrics struct {
+	ItemsCount   uint64
+	SeriesCount  uint64
+	SizeBytes    uint64
+	MaxSizeBytes uint64
+	ItemsDropped uint64
+}
+
+// UpdateMetrics updates m with metrics from s.
+func (s *Storage) UpdateMetrics(m *Metrics) {
+	if s == nil {
+		return
+	}
+	m.ItemsCount += s.currentItemsCount.Load()
+	m.SeriesCount += s.currentSeriesCount.Load()
+	m.SizeBytes += s.currentSizeBytes.Load()
+	m.MaxSizeBytes += s.maxSizeBytes
+	m.ItemsDropped += s.itemsDropped.Load()
+}
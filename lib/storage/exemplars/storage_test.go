@@ -0,0 +1,158 @@
+package exemplars
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func newExemplar(traceID string, value float64, timestamp int64) prompb.Exemplar {
+	return prompb.Exemplar{
+		Labels: []prompb.Label{
+			{
+				Name:  "trace_id",
+				Value: traceID,
+			},
+		},
+		Value:     value,
+		Timestamp: timestamp,
+	}
+}
+
+func TestStorageAddSearch(t *testing.T) {
+	s := newStorage("", 1e6, 3, 3600_000)
+	s.getCurrentTimestamp = func() int64 { return 10_000_000 }
+
+	f := func(metricName string, minTimestamp, maxTimestamp int64, resultExpected []prompb.Exemplar) {
+		t.Helper()
+		result := s.Search(metricName, minTimestamp, maxTimestamp)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	e1 := newExemplar("a", 1, 9_000_000)
+	e2 := newExemplar("b", 2, 9_100_000)
+	e3 := newExemplar("c", 3, 9_200_000)
+	e4 := newExemplar("d", 4, 9_300_000)
+
+	// out of order exemplars are stored sorted by timestamp; duplicates are ignored
+	s.Add("foo", &e2)
+	s.Add("foo", &e1)
+	s.Add("foo", &e2)
+	f("foo", 0, 1e9, []prompb.Exemplar{e1, e2})
+	f("bar", 0, 1e9, nil)
+
+	// time range filter
+	f("foo", 9_050_000, 1e9, []prompb.Exemplar{e2})
+	f("foo", 0, 9_050_000, []prompb.Exemplar{e1})
+
+	// the oldest exemplar is dropped when the per-series limit is reached
+	s.Add("foo", &e4)
+	s.Add("foo", &e3)
+	f("foo", 0, 1e9, []prompb.Exemplar{e2, e3, e4})
+
+	// the exemplar older than the stored exemplars is ignored when the per-series limit is reached
+	s.Add("foo", &e1)
+	f("foo", 0, 1e9, []prompb.Exemplar{e2, e3, e4})
+
+	// exemplars outside the retention are ignored
+	eOld := newExemplar("old", 1, 1_000_000)
+	s.Add("bar", &eOld)
+	f("bar", 0, 1e9, nil)
+
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCount != 3 {
+		t.Fatalf("unexpected number of items; got %d; want 3", m.ItemsCount)
+	}
+	if m.SeriesCount != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", m.SeriesCount)
+	}
+}
+
+func TestStorageMaxSize(t *testing.T) {
+	e := newExemplar("a", 1, 1000)
+	s := newStorage("", uint64(len("foo"))+seriesOverhead+exemplarSize(&e), 10, 3600_000)
+	s.getCurrentTimestamp = func() int64 { return 2000 }
+
+	s.Add("foo", &e)
+	s.Add("bar", &e)
+	e2 := newExemplar("b", 2, 1500)
+	s.Add("foo", &e2)
+
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCount != 1 {
+		t.Fatalf("unexpected number of items; got %d; want 1", m.ItemsCount)
+	}
+	if m.ItemsDropped != 2 {
+		t.Fatalf("unexpected number of dropped items; got %d; want 2", m.ItemsDropped)
+	}
+	if m.SeriesCount != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", m.SeriesCount)
+	}
+	if m.SizeBytes != m.MaxSizeBytes {
+		t.Fatalf("unexpected size; got %d; want %d", m.SizeBytes, m.MaxSizeBytes)
+	}
+	if len(s.series) != 1 {
+		t.Fatalf("unexpected number of series entries; got %d; want 1", len(s.series))
+	}
+}
+
+func TestStorageCleanup(t *testing.T) {
+	ts := int64(100_000)
+	s := newStorage("", 1e6, 10, 10_000)
+	s.getCurrentTimestamp = func() int64 { return ts }
+
+	e1 := newExemplar("a", 1, 95_000)
+	e2 := newExemplar("b", 2, 99_000)
+	s.Add("foo", &e1)
+	s.Add("foo", &e2)
+	s.Add("bar", &e1)
+
+	ts += 7_000
+	s.MustCleanup()
+
+	if result := s.Search("foo", 0, 1e9); !reflect.DeepEqual(result, []prompb.Exemplar{e2}) {
+		t.Fatalf("unexpected exemplars for foo after cleanup: %v", result)
+	}
+	if result := s.Search("bar", 0, 1e9); result != nil {
+		t.Fatalf("unexpected exemplars for bar after cleanup: %v", result)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCount != 1 {
+		t.Fatalf("unexpected number of items; got %d; want 1", m.ItemsCount)
+	}
+	if m.SeriesCount != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", m.SeriesCount)
+	}
+	if sizeExpected := uint64(len("foo")) + seriesOverhead + exemplarSize(&e2); m.SizeBytes != sizeExpected {
+		t.Fatalf("unexpected size bytes; got %d; want %d", m.SizeBytes, sizeExpected)
+	}
+}
+
+func TestStorageMustCloseMustLoadFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exemplars")
+
+	s := MustLoadFrom(path, 1e6, 10, 3600_000)
+	ts := s.getCurrentTimestamp()
+	e1 := newExemplar("a", 1, ts-1000)
+	e2 := newExemplar("b", 2, ts)
+	s.Add("foo\x00\x01", &e1)
+	s.Add("foo\x00\x01", &e2)
+	s.Add("bar", &e1)
+	s.MustClose()
+
+	s = MustLoadFrom(path, 1e6, 10, 3600_000)
+	if result := s.Search("foo\x00\x01", 0, ts); !reflect.DeepEqual(result, []prompb.Exemplar{e1, e2}) {
+		t.Fatalf("unexpected exemplars for foo after reload: %v", result)
+	}
+	if result := s.Search("bar", 0, ts); !reflect.DeepEqual(result, []prompb.Exemplar{e1}) {
+		t.Fatalf("unexpected exemplars for bar after reload: %v", result)
+	}
+	s.MustClose()
+}
@@ -0,0 +1,360 @@
+package metricsmetadata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+// approximate in-memory overhead per each stored entry: key strings headers + map entry + entry
+const entryOverhead = 3*16 + 16 + 48
+
+// Storage is an in-memory storage for metrics metadata.
+//
+// It keeps a unique set of (type, help, unit) tuples per each metric family name.
+// Entries, which weren't updated during maxAgeSeconds, are removed by MustCleanup() calls.
+type Storage struct {
+	maxSizeBytes  uint64
+	maxAgeSeconds uint64
+	path          string
+
+	currentSizeBytes  atomic.Uint64
+	currentItemsCount atomic.Uint64
+	itemsDropped      atomic.Uint64
+
+	// mu protects store
+	mu    sync.RWMutex
+	store map[entryKey]*entry
+
+	// helper for tests
+	getCurrentTs func() uint64
+}
+
+type entryKey struct {
+	accountID        uint32
+	projectID        uint32
+	metricFamilyName string
+	typ              uint32
+	help             string
+	unit             string
+}
+
+type entry struct {
+	lastSeenTs atomic.Uint64
+}
+
+type recordForStore struct {
+	AccountID        uint32
+	ProjectID        uint32
+	MetricFamilyName string
+	Type             uint32
+	Help             string
+	Unit             string
+	LastSeenTs       uint64
+}
+
+// MustLoadFrom loads metrics metadata storage from the given path.
+//
+// Metadata entries, which weren't updated during maxAgeSeconds, are removed.
+func MustLoadFrom(path string, maxSizeBytes, maxAgeSeconds uint64) *Storage {
+	s, err := loadFrom(path, maxSizeBytes, maxAgeSeconds)
+	if err != nil {
+		logger.Errorf("metrics metadata file at path %s is invalid: %s; init new metrics metadata storage", path, err)
+		return newStorage(path, maxSizeBytes, maxAgeSeconds)
+	}
+	return s
+}
+
+func newStorage(path string, maxSizeBytes, maxAgeSeconds uint64) *Storage {
+	return &Storage{
+		maxSizeBytes:  maxSizeBytes,
+		maxAgeSeconds: maxAgeSeconds,
+		path:          path,
+		store:         make(map[entryKey]*entry),
+		getCurrentTs:  fasttime.UnixTimestamp,
+	}
+}
+
+func loadFrom(path string, maxSizeBytes, maxAgeSeconds uint64) (*Storage, error) {
+	s := newStorage(path, maxSizeBytes, maxAgeSeconds)
+	if !fs.IsPathExist(path) {
+		// Fast path - nothing to load.
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read metrics metadata from %q: %w", path, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new gzip reader: %w", err)
+	}
+	defer func() {
+		if err := zr.Close(); err != nil {
+			logger.Panicf("FATAL: cannot close gzip reader: %s", err)
+		}
+	}()
+
+	jr := json.NewDecoder(zr)
+	deadline := s.getDeadline()
+	var r recordForStore
+	for {
+		if err := jr.Decode(&r); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("cannot parse metrics metadata record: %w", err)
+		}
+		if r.LastSeenTs < deadline {
+			continue
+		}
+		k := entryKey{
+			accountID:        r.AccountID,
+			projectID:        r.ProjectID,
+			metricFamilyName: r.MetricFamilyName,
+			typ:              r.Type,
+			help:             r.Help,
+			unit:             r.Unit,
+		}
+		if !s.addEntryLocked(k, r.LastSeenTs) {
+			break
+		}
+	}
+	logger.Infof("loaded %d metrics metadata entries from %q", s.currentItemsCount.Load(), path)
+	return s, nil
+}
+
+// MustClose saves s to the path it was loaded from.
+func (s *Storage) MustClose() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bb bytes.Buffer
+	zw := gzip.NewWriter(&bb)
+	jw := json.NewEncoder(zw)
+	var r recordForStore
+	for k, e := range s.store {
+		r.AccountID = k.accountID
+		r.ProjectID = k.projectID
+		r.MetricFamilyName = k.metricFamilyName
+		r.Type = k.typ
+		r.Help = k.help
+		r.Unit = k.unit
+		r.LastSeenTs = e.lastSeenTs.Load()
+		if err := jw.Encode(&r); err != nil {
+			logger.Panicf("BUG: cannot encode metrics metadata record: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		logger.Panicf("BUG: cannot flush metrics metadata writer: %s", err)
+	}
+	fs.MustMkdirIfNotExist(filepath.Dir(s.path))
+	fs.MustWriteAtomic(s.path, bb.Bytes(), true)
+}
+
+// Add registers mms in s.
+//
+// New entries are dropped if s exceeds its maximum size.
+func (s *Storage) Add(mms []prompb.MetricMetadata) {
+	if len(mms) == 0 {
+		return
+	}
+	ts := s.getCurrentTs()
+	var missing []int
+
+	s.mu.RLock()
+	for i := range mms {
+		mm := &mms[i]
+		e, ok := s.store[newEntryKey(mm)]
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		if e.lastSeenTs.Load() != ts {
+			e.lastSeenTs.Store(ts)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	for i, idx := range missing {
+		mm := &mms[idx]
+		k := newEntryKey(mm)
+		if e, ok := s.store[k]; ok {
+			// The entry could be registered by concurrent goroutine.
+			e.lastSeenTs.Store(ts)
+			continue
+		}
+		// The key refers to mm strings, which may be backed by reusable buffers at the caller side.
+		k.metricFamilyName = strings.Clone(k.metricFamilyName)
+		k.help = strings.Clone(k.help)
+		k.unit = strings.Clone(k.unit)
+		if !s.addEntryLocked(k, ts) {
+			s.itemsDropped.Add(uint64(len(missing) - i))
+			break
+		}
+	}
+	s.mu.Unlock()
+}
+
+func newEntryKey(mm *prompb.MetricMetadata) entryKey {
+	return entryKey{
+		accountID:        mm.AccountID,
+		projectID:        mm.ProjectID,
+		metricFamilyName: mm.MetricFamilyName,
+		typ:              mm.Type,
+		help:             mm.Help,
+		unit:             mm.Unit,
+	}
+}
+
+func (s *Storage) addEntryLocked(k entryKey, lastSeenTs uint64) bool {
+	size := entrySize(&k)
+	if s.currentSizeBytes.Load()+size > s.maxSizeBytes {
+		return false
+	}
+	e := &entry{}
+	e.lastSeenTs.Store(lastSeenTs)
+	s.store[k] = e
+	s.currentSizeBytes.Add(size)
+	s.currentItemsCount.Add(1)
+	return true
+}
+
+func entrySize(k *entryKey) uint64 {
+	return uint64(len(k.metricFamilyName)+len(k.help)+len(k.unit)) + entryOverhead
+}
+
+// MustCleanup removes entries, which weren't updated during maxAgeSeconds.
+func (s *Storage) MustCleanup() {
+	deadline := s.getDeadline()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, e := range s.store {
+		if e.lastSeenTs.Load() >= deadline {
+			continue
+		}
+		delete(s.store, k)
+		s.currentSizeBytes.Add(^(entrySize(&k) - 1))
+		s.currentItemsCount.Add(^uint64(0))
+	}
+}
+
+func (s *Storage) getDeadline() uint64 {
+	ts := s.getCurrentTs()
+	if ts < s.maxAgeSeconds {
+		return 0
+	}
+	return ts - s.maxAgeSeconds
+}
+
+// Search returns metrics metadata for the given tenant.
+//
+// If metricFamilyName is non-empty, then only metadata for the given metric family name is returned.
+// limit limits the number of returned metric family names, while limitPerMetric limits the number
+// of returned entries per each metric family name. Non-positive limits mean no limit.
+//
+// The returned entries are sorted by metric family name.
+func (s *Storage) Search(accountID, projectID uint32, metricFamilyName string, limit, limitPerMetric int) []prompb.MetricMetadata {
+	var mms []prompb.MetricMetadata
+
+	s.mu.RLock()
+	for k := range s.store {
+		if k.accountID != accountID || k.projectID != projectID {
+			continue
+		}
+		if metricFamilyName != "" && k.metricFamilyName != metricFamilyName {
+			continue
+		}
+		mms = append(mms, prompb.MetricMetadata{
+			Type:             k.typ,
+			MetricFamilyName: k.metricFamilyName,
+			Help:             k.help,
+			Unit:             k.unit,
+			AccountID:        k.accountID,
+			ProjectID:        k.projectID,
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(mms, func(i, j int) bool {
+		a, b := &mms[i], &mms[j]
+		if a.MetricFamilyName != b.MetricFamilyName {
+			return a.MetricFamilyName < b.MetricFamilyName
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Help != b.Help {
+			return a.Help < b.Help
+		}
+		return a.Unit < b.Unit
+	})
+
+	if limit <= 0 && limitPerMetric <= 0 {
+		return mms
+	}
+	dst := mms[:0]
+	metricsCount := 0
+	perMetricCount := 0
+	prevName := ""
+	for i := range mms {
+		mm := mms[i]
+		if i == 0 || mm.MetricFamilyName != prevName {
+			if limit > 0 && metricsCount >= limit {
+				break
+			}
+			metricsCount++
+			perMetricCount = 0
+			prevName = mm.MetricFamilyName
+		}
+		if limitPerMetric > 0 && perMetricCount >= limitPerMetric {
+			continue
+		}
+		perMetricCount++
+		dst = append(dst, mm)
+	}
+	return dst
+}
+
+// Metrics holds metrics for Storage.
+type Metrics struct {
+	ItemsCount   uint64
+	SizeBytes    uint64
+	MaxSizeBytes uint64
+	ItemsDropped uint64
+}
+
+// UpdateMetrics updates m with metrics from s.
+func (s *Storage) UpdateMetrics(m *Metrics) {
+	if s == nil {
+		return
+	}
+	m.ItemsCount += s.currentItemsCount.Load()
+	m.SizeBytes += s.currentSizeBytes.Load()
+	m.MaxSizeBytes += s.maxSizeBytes
+	m.ItemsDropped += s.itemsDropped.Load()
+}
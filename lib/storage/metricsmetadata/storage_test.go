@@ -0,0 +1,111 @@
+package metricsmetadata
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestStorageSearch(t *testing.T) {
+	s := newStorage("", 1e6, 3600)
+	s.Add([]prompb.MetricMetadata{
+		{MetricFamilyName: "up", Type: uint32(prompb.MetricMetadataGAUGE), Help: "target is up"},
+		{MetricFamilyName: "requests_total", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "requests"},
+		{MetricFamilyName: "requests_total", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "total requests"},
+		{MetricFamilyName: "up", Type: uint32(prompb.MetricMetadataGAUGE), Help: "target is up"},
+		{MetricFamilyName: "latency", Type: uint32(prompb.MetricMetadataHISTOGRAM), Help: "latency", Unit: "seconds"},
+		{MetricFamilyName: "up", Type: uint32(prompb.MetricMetadataGAUGE), Help: "target is up", AccountID: 1},
+	})
+
+	f := func(metricFamilyName string, limit, limitPerMetric int, resultExpected []prompb.MetricMetadata) {
+		t.Helper()
+		result := s.Search(0, 0, metricFamilyName, limit, limitPerMetric)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	latency := prompb.MetricMetadata{MetricFamilyName: "latency", Type: uint32(prompb.MetricMetadataHISTOGRAM), Help: "latency", Unit: "seconds"}
+	requests1 := prompb.MetricMetadata{MetricFamilyName: "requests_total", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "requests"}
+	requests2 := prompb.MetricMetadata{MetricFamilyName: "requests_total", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "total requests"}
+	up := prompb.MetricMetadata{MetricFamilyName: "up", Type: uint32(prompb.MetricMetadataGAUGE), Help: "target is up"}
+
+	// no limits
+	f("", 0, 0, []prompb.MetricMetadata{latency, requests1, requests2, up})
+
+	// filter by metric name
+	f("requests_total", 0, 0, []prompb.MetricMetadata{requests1, requests2})
+	f("missing", 0, 0, nil)
+
+	// limit the number of metrics
+	f("", 2, 0, []prompb.MetricMetadata{latency, requests1, requests2})
+
+	// limit the number of entries per metric
+	f("", 0, 1, []prompb.MetricMetadata{latency, requests1, up})
+	f("", 2, 1, []prompb.MetricMetadata{latency, requests1})
+}
+
+func TestStorageMaxSize(t *testing.T) {
+	mm := prompb.MetricMetadata{MetricFamilyName: "foo", Help: "bar"}
+	s := newStorage("", entrySize(&entryKey{metricFamilyName: "foo", help: "bar"}), 3600)
+	s.Add([]prompb.MetricMetadata{mm, {MetricFamilyName: "bar"}, {MetricFamilyName: "baz"}})
+
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCount != 1 {
+		t.Fatalf("unexpected number of items; got %d; want 1", m.ItemsCount)
+	}
+	if m.ItemsDropped != 2 {
+		t.Fatalf("unexpected number of dropped items; got %d; want 2", m.ItemsDropped)
+	}
+	if m.SizeBytes != m.MaxSizeBytes {
+		t.Fatalf("unexpected size; got %d; want %d", m.SizeBytes, m.MaxSizeBytes)
+	}
+}
+
+func TestStorageCleanup(t *testing.T) {
+	ts := uint64(10_000)
+	s := newStorage("", 1e6, 100)
+	s.getCurrentTs = func() uint64 { return ts }
+
+	s.Add([]prompb.MetricMetadata{{MetricFamilyName: "foo"}, {MetricFamilyName: "bar"}})
+	ts += 60
+	s.Add([]prompb.MetricMetadata{{MetricFamilyName: "foo"}})
+	ts += 60
+	s.MustCleanup()
+
+	result := s.Search(0, 0, "", 0, 0)
+	resultExpected := []prompb.MetricMetadata{{MetricFamilyName: "foo"}}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected result after cleanup\ngot\n%v\nwant\n%v", result, resultExpected)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.ItemsCount != 1 {
+		t.Fatalf("unexpected number of items; got %d; want 1", m.ItemsCount)
+	}
+	if m.SizeBytes != entrySize(&entryKey{metricFamilyName: "foo"}) {
+		t.Fatalf("unexpected size bytes: %d", m.SizeBytes)
+	}
+}
+
+func TestStorageMustCloseMustLoadFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics_metadata")
+
+	s := MustLoadFrom(path, 1e6, 3600)
+	s.Add([]prompb.MetricMetadata{
+		{MetricFamilyName: "foo", Type: uint32(prompb.MetricMetadataCOUNTER), Help: "foo help", Unit: "bytes"},
+		{MetricFamilyName: "bar", Type: uint32(prompb.MetricMetadataGAUGE)},
+	})
+	resultExpected := s.Search(0, 0, "", 0, 0)
+	s.MustClose()
+
+	s = MustLoadFrom(path, 1e6, 3600)
+	result := s.Search(0, 0, "", 0, 0)
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected result after reload\ngot\n%v\nwant\n%v", result, resultExpected)
+	}
+	s.MustClose()
+}
@@ -31,6 +31,11 @@ type partHeader struct {
 
 	// MinDedupInterval is minimal dedup interval in milliseconds across all the blocks in the part.
 	MinDedupInterval int64
+
+	// MinRetentionFiltersTimestamp is the minimum timestamp in milliseconds when retention filters were applied to the blocks in the part.
+	//
+	// It is set to 0 if retention filters weren't applied to the part.
+	MinRetentionFiltersTimestamp int64
 }
 
 // String returns string representation of ph.
@@ -45,6 +50,7 @@ func (ph *partHeader) Reset() {
 	ph.MinTimestamp = (1 << 63) - 1
 	ph.MaxTimestamp = -1 << 63
 	ph.MinDedupInterval = 0
+	ph.MinRetentionFiltersTimestamp = 0
 }
 
 func (ph *partHeader) readMinDedupInterval(partPath string) error {
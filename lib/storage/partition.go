@@ -16,6 +16,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
@@ -89,7 +90,8 @@ type partition struct {
 	smallRowsDeleted    atomic.Uint64
 	bigRowsDeleted      atomic.Uint64
 
-	isDedupScheduled atomic.Bool
+	isDedupScheduled            atomic.Bool
+	isRetentionFiltersScheduled atomic.Bool
 
 	mergeIdx atomic.Uint64
 
@@ -335,6 +337,9 @@ type partitionMetrics struct {
 
 	ScheduledDownsamplingPartitions     uint64
 	ScheduledDownsamplingPartitionsSize uint64
+
+	ScheduledRetentionFiltersPartitions     uint64
+	ScheduledRetentionFiltersPartitionsSize uint64
 }
 
 // TotalRowsCount returns total number of rows in tm.
@@ -352,6 +357,10 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 	if isDedupScheduled {
 		m.ScheduledDownsamplingPartitions++
 	}
+	isRetentionFiltersScheduled := pt.isRetentionFiltersScheduled.Load()
+	if isRetentionFiltersScheduled {
+		m.ScheduledRetentionFiltersPartitions++
+	}
 
 	for _, pw := range pt.inmemoryParts {
 		p := pw.p
@@ -362,6 +371,9 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 		if isDedupScheduled {
 			m.ScheduledDownsamplingPartitionsSize += p.size
 		}
+		if isRetentionFiltersScheduled {
+			m.ScheduledRetentionFiltersPartitionsSize += p.size
+		}
 	}
 	for _, pw := range pt.smallParts {
 		p := pw.p
@@ -372,6 +384,9 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 		if isDedupScheduled {
 			m.ScheduledDownsamplingPartitionsSize += p.size
 		}
+		if isRetentionFiltersScheduled {
+			m.ScheduledRetentionFiltersPartitionsSize += p.size
+		}
 	}
 	for _, pw := range pt.bigParts {
 		p := pw.p
@@ -382,6 +397,9 @@ func (pt *partition) UpdateMetrics(m *partitionMetrics) {
 		if isDedupScheduled {
 			m.ScheduledDownsamplingPartitionsSize += p.size
 		}
+		if isRetentionFiltersScheduled {
+			m.ScheduledRetentionFiltersPartitionsSize += p.size
+		}
 	}
 
 	m.InmemoryPartsCount += uint64(len(pt.inmemoryParts))
@@ -1351,7 +1369,10 @@ func (pt *partition) releasePartsToMerge(pws []*partWrapper) {
 }
 
 func (pt *partition) isFinalDedupNeeded() bool {
-	dedupInterval := GetDedupInterval()
+	// All the samples in the partition must be de-duplicated or downsampled with the interval
+	// applicable to the newest sample in the partition.
+	currentTimestamp := time.Now().UnixMilli()
+	dedupInterval := getDownsamplingInterval(pt.tr.MaxTimestamp, currentTimestamp)
 
 	pws := pt.GetParts(nil, false)
 	minDedupInterval := getMinDedupInterval(pws)
@@ -1360,6 +1381,20 @@ func (pt *partition) isFinalDedupNeeded() bool {
 	return dedupInterval > minDedupInterval
 }
 
+func (pt *partition) isRetentionFiltersMergeNeeded() bool {
+	rfs := pt.s.retentionFilters
+	if rfs == nil {
+		return false
+	}
+	currentTimestamp := time.Now().UnixMilli()
+
+	pws := pt.GetParts(nil, false)
+	ok := rfs.isPartitionMergeNeeded(pt.tr, pws, currentTimestamp)
+	pt.PutParts(pws)
+
+	return ok
+}
+
 func getMinDedupInterval(pws []*partWrapper) int64 {
 	if len(pws) == 0 {
 		return 0
@@ -1401,7 +1436,7 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}, isFi
 	mergeIdx := pt.nextMergeIdx()
 	dstPartPath := pt.getDstPartPath(dstPartType, mergeIdx)
 
-	if !isDedupEnabled() && isFinal && len(pws) == 1 && pws[0].mp != nil {
+	if !isDedupEnabled() && !IsDownsamplingEnabled() && isFinal && len(pws) == 1 && pws[0].mp != nil {
 		// Fast path: flush a single in-memory part to disk.
 		mp := pws[0].mp
 		mp.MustStoreToDisk(dstPartPath)
@@ -1576,16 +1611,22 @@ func (pt *partition) mergePartsInternal(dstPartPath string, bsw *blockStreamWrit
 		logger.Panicf("BUG: unknown partType=%d", dstPartType)
 	}
 	retentionDeadline := currentTimestamp - pt.s.retentionMsecs
+	// Blocks are downsampled during the merge according to fasttime.UnixTimestamp(),
+	// which cannot be smaller than the downsamplingTimestamp.
+	downsamplingTimestamp := int64(fasttime.UnixTimestamp()) * 1000
 	activeMerges.Add(1)
 	dmis := pt.s.getDeletedMetricIDs()
-	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, retentionDeadline, rowsMerged, rowsDeleted, useSparseCache)
+	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, retentionDeadline, pt.s.retentionFilters, rowsMerged, rowsDeleted, useSparseCache)
 	activeMerges.Add(-1)
 	mergesCount.Add(1)
 	if err != nil {
 		return nil, fmt.Errorf("cannot merge %d parts to %s: %w", len(bsrs), dstPartPath, err)
 	}
 	if dstPartPath != "" {
-		ph.MinDedupInterval = GetDedupInterval()
+		ph.MinDedupInterval = getDownsamplingInterval(ph.MaxTimestamp, downsamplingTimestamp)
+		if pt.s.retentionFilters != nil {
+			ph.MinRetentionFiltersTimestamp = currentTimestamp
+		}
 		ph.MustWriteMetadata(dstPartPath)
 	}
 	return &ph, nil
@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metricsql"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
+)
+
+// RetentionFilter contains retention for time series matching the given filters.
+type RetentionFilter struct {
+	// Filters contains or-delimited tag filters for the matching time series.
+	Filters [][]TagFilter
+
+	// Retention is the retention for the matching time series.
+	Retention time.Duration
+}
+
+// String returns string representation of rf.
+func (rf *RetentionFilter) String() string {
+	a := make([]string, 0, len(rf.Filters))
+	for _, tfs := range rf.Filters {
+		b := make([]string, 0, len(tfs))
+		for i := range tfs {
+			b = append(b, tfs[i].String())
+		}
+		a = append(a, strings.Join(b, ","))
+	}
+	return fmt.Sprintf("{%s}:%s", strings.Join(a, " or "), rf.Retention)
+}
+
+// ParseRetentionFilter parses retention filter from s in the format `series_selector:duration`.
+//
+// For example, `{team="dev"}:7d` sets 7 days retention for time series with team="dev" label.
+func ParseRetentionFilter(s string) (*RetentionFilter, error) {
+	n := strings.LastIndexByte(s, ':')
+	if n < 0 {
+		return nil, fmt.Errorf("missing ':' in retention filter %q; it must have series_selector:duration format", s)
+	}
+	selector, retentionStr := s[:n], s[n+1:]
+	retentionMsecs, err := metricsql.PositiveDurationValue(retentionStr, 0)
+	if err != nil || retentionMsecs <= 0 {
+		return nil, fmt.Errorf("cannot parse retention in %q: it must be positive duration", s)
+	}
+	expr, err := metricsql.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse series selector in %q: %w", s, err)
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok || len(me.LabelFilterss) == 0 {
+		return nil, fmt.Errorf("expecting series selector in %q; got %q", s, expr.AppendString(nil))
+	}
+	rf := &RetentionFilter{
+		Retention: time.Duration(retentionMsecs) * time.Millisecond,
+	}
+	for _, lfs := range me.LabelFilterss {
+		tfs := make([]TagFilter, 0, len(lfs))
+		for _, lf := range lfs {
+			tf := TagFilter{
+				Value:      []byte(lf.Value),
+				IsNegative: lf.IsNegative,
+				IsRegexp:   lf.IsRegexp,
+			}
+			if lf.Label != "__name__" {
+				tf.Key = []byte(lf.Label)
+			}
+			tfs = append(tfs, tf)
+		}
+		rf.Filters = append(rf.Filters, tfs)
+	}
+	return rf, nil
+}
+
+// retentionFilters applies RetentionFilter list to time series stored in Storage.
+type retentionFilters struct {
+	s *Storage
+
+	filters []retentionFilter
+
+	// mu protects curr and prev.
+	mu sync.RWMutex
+
+	// curr contains the results of matching metricIDs against filters.
+	//
+	// It is moved to prev when it becomes too big, while both curr and prev are reset
+	// when the indexdb generation changes. This keeps the memory usage for the cache bounded.
+	curr *retentionFiltersCache
+
+	// prev contains the previous results of matching metricIDs against filters.
+	//
+	// The entries are moved from prev to curr on access.
+	prev *retentionFiltersCache
+}
+
+// retentionFiltersCache contains the results of matching metricIDs against retentionFilters.
+type retentionFiltersCache struct {
+	// generation is the indexdb generation the cache is created for.
+	generation uint64
+
+	// checkedMetricIDs contains metricIDs, which were already matched against filters.
+	checkedMetricIDs uint64set.Set
+
+	// missingMetricIDs contains metricIDs without metric names in the indexdb.
+	//
+	// The global retention is applied to such metricIDs.
+	missingMetricIDs uint64set.Set
+
+	// matchedMetricIDs contains metricIDs matching the corresponding filters item.
+	matchedMetricIDs []uint64set.Set
+}
+
+func newRetentionFiltersCache(generation uint64, filtersCount int) *retentionFiltersCache {
+	return &retentionFiltersCache{
+		generation:       generation,
+		matchedMetricIDs: make([]uint64set.Set, filtersCount),
+	}
+}
+
+// getMatchedFilterIdx returns the index for the filter matching metricID from rfc.
+//
+// -1 is returned if metricID doesn't match any filter or if the metric name for metricID is missing.
+// false is returned if metricID isn't found in rfc.
+func (rfc *retentionFiltersCache) getMatchedFilterIdx(metricID uint64) (int, bool) {
+	if rfc.missingMetricIDs.Has(metricID) {
+		return -1, true
+	}
+	if !rfc.checkedMetricIDs.Has(metricID) {
+		return -1, false
+	}
+	for i := range rfc.matchedMetricIDs {
+		if rfc.matchedMetricIDs[i].Has(metricID) {
+			return i, true
+		}
+	}
+	return -1, true
+}
+
+func (rfc *retentionFiltersCache) add(metricID uint64, idx int, ok bool) {
+	if !ok {
+		rfc.missingMetricIDs.Add(metricID)
+		return
+	}
+	rfc.checkedMetricIDs.Add(metricID)
+	if idx >= 0 {
+		rfc.matchedMetricIDs[idx].Add(metricID)
+	}
+}
+
+func (rfc *retentionFiltersCache) itemsCount() int {
+	return rfc.checkedMetricIDs.Len() + rfc.missingMetricIDs.Len()
+}
+
+// getMaxRetentionFiltersCacheItems returns the maximum number of metricIDs, which can be stored in retentionFiltersCache.
+func getMaxRetentionFiltersCacheItems() int {
+	// Every metricID occupies up to 8 bytes in uint64set.Set.
+	return memory.Allowed() / 100 / 8
+}
+
+type retentionFilter struct {
+	tfss []*TagFilters
+
+	retentionMsecs int64
+}
+
+func newRetentionFilters(s *Storage, rfs []RetentionFilter) (*retentionFilters, error) {
+	if len(rfs) == 0 {
+		return nil, nil
+	}
+	filters := make([]retentionFilter, 0, len(rfs))
+	for i := range rfs {
+		rf := &rfs[i]
+		retentionMsecs := rf.Retention.Milliseconds()
+		if retentionMsecs <= 0 {
+			return nil, fmt.Errorf("retention must be positive in the retention filter %s", rf)
+		}
+		if retentionMsecs > s.retentionMsecs {
+			return nil, fmt.Errorf("retention in the retention filter %s cannot exceed the global retention %s",
+				rf, time.Duration(s.retentionMsecs)*time.Millisecond)
+		}
+		tfss := make([]*TagFilters, 0, len(rf.Filters))
+		for _, tfs := range rf.Filters {
+			tfsCompiled := NewTagFilters()
+			for j := range tfs {
+				tf := &tfs[j]
+				if err := tfsCompiled.Add(tf.Key, tf.Value, tf.IsNegative, tf.IsRegexp); err != nil {
+					return nil, fmt.Errorf("cannot parse the retention filter %s: %w", rf, err)
+				}
+			}
+			tfss = append(tfss, tfsCompiled)
+		}
+		filters = append(filters, retentionFilter{
+			tfss:           tfss,
+			retentionMsecs: retentionMsecs,
+		})
+	}
+	// The indexdb isn't opened yet, so the cache is created with zero generation.
+	// It is reset on the first access with the actual indexdb generation.
+	return &retentionFilters{
+		s:       s,
+		filters: filters,
+		curr:    newRetentionFiltersCache(0, len(filters)),
+		prev:    newRetentionFiltersCache(0, len(filters)),
+	}, nil
+}
+
+// getRetentionDeadline returns retention deadline for the given metricID according to rfs.
+//
+// retentionDeadline must contain the retention deadline for the global retention.
+func (rfs *retentionFilters) getRetentionDeadline(metricID uint64, retentionDeadline int64) int64 {
+	if rfs == nil {
+		return retentionDeadline
+	}
+	return retentionDeadline + rfs.s.retentionMsecs - rfs.getRetentionMsecs(metricID)
+}
+
+// getRetentionMsecs returns retention in milliseconds for the given metricID.
+//
+// The smallest retention across matching filters is returned. The global retention is returned if metricID doesn't match any filter.
+func (rfs *retentionFilters) getRetentionMsecs(metricID uint64) int64 {
+	generation := rfs.s.idbCurr.Load().generation
+
+	rfs.mu.RLock()
+	idx, ok := -1, false
+	if rfs.curr.generation == generation {
+		idx, ok = rfs.curr.getMatchedFilterIdx(metricID)
+	}
+	rfs.mu.RUnlock()
+
+	if !ok {
+		idx = rfs.getMatchedFilterIdxSlow(metricID, generation)
+	}
+
+	if idx < 0 {
+		return rfs.s.retentionMsecs
+	}
+	return rfs.filters[idx].retentionMsecs
+}
+
+func (rfs *retentionFilters) getMatchedFilterIdxSlow(metricID, generation uint64) int {
+	rfs.mu.Lock()
+	if rfs.curr.generation != generation {
+		// The indexdb has been rotated. Reset the cache, since the previous generation
+		// may contain metricIDs, which will be never seen again.
+		rfs.curr = newRetentionFiltersCache(generation, len(rfs.filters))
+		rfs.prev = newRetentionFiltersCache(generation, len(rfs.filters))
+	}
+	idx, ok := rfs.curr.getMatchedFilterIdx(metricID)
+	if !ok {
+		idx, ok = rfs.prev.getMatchedFilterIdx(metricID)
+		if ok {
+			// Move the entry from prev to curr, so it survives the next cache rotation.
+			isFound := idx >= 0 || rfs.prev.checkedMetricIDs.Has(metricID)
+			rfs.addLocked(metricID, idx, isFound)
+		}
+	}
+	rfs.mu.Unlock()
+	if ok {
+		return idx
+	}
+
+	// Match metricID without holding the lock, since this may be slow.
+	// Cache misses for the metric name lookup too, since otherwise the lookup in indexdb
+	// would be repeated for every block of such metricID during merges and searches.
+	// The global retention is applied to such metricIDs.
+	idx, ok = rfs.matchMetricID(metricID)
+
+	rfs.mu.Lock()
+	if rfs.curr.generation == generation {
+		rfs.addLocked(metricID, idx, ok)
+	}
+	rfs.mu.Unlock()
+	return idx
+}
+
+func (rfs *retentionFilters) addLocked(metricID uint64, idx int, ok bool) {
+	if rfs.curr.itemsCount() >= getMaxRetentionFiltersCacheItems() {
+		rfs.prev = rfs.curr
+		rfs.curr = newRetentionFiltersCache(rfs.prev.generation, len(rfs.filters))
+	}
+	rfs.curr.add(metricID, idx, ok)
+}
+
+// matchMetricID returns the index of the filter with the smallest retention, which matches the given metricID.
+//
+// -1 is returned if metricID doesn't match any filter.
+// false is returned if the metric name for metricID cannot be found.
+func (rfs *retentionFilters) matchMetricID(metricID uint64) (int, bool) {
+	idbPrev, idbCurr := rfs.s.getPrevAndCurrIndexDBs()
+	metricName, ok := rfs.s.searchMetricName(idbPrev, idbCurr, nil, metricID, false)
+	rfs.s.putPrevAndCurrIndexDBs(idbPrev, idbCurr)
+	if !ok {
+		return -1, false
+	}
+
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+	if err := mn.Unmarshal(metricName); err != nil {
+		logger.Panicf("FATAL: cannot unmarshal metricName for metricID=%d: %s", metricID, err)
+	}
+
+	kb := kbPool.Get()
+	defer kbPool.Put(kb)
+
+	idx := -1
+	var tfs []*tagFilter
+	for i := range rfs.filters {
+		if idx >= 0 && rfs.filters[i].retentionMsecs >= rfs.filters[idx].retentionMsecs {
+			// The filter cannot reduce the retention for the already matched metricID.
+			continue
+		}
+		for _, tfsCompiled := range rfs.filters[i].tfss {
+			// matchTagFilters may re-order tfs, so a copy is passed to it in order to avoid data races.
+			tfs = tfs[:0]
+			for j := range tfsCompiled.tfs {
+				tfs = append(tfs, &tfsCompiled.tfs[j])
+			}
+			ok, err := matchTagFilters(mn, tfs, kb)
+			if err != nil {
+				logger.Errorf("cannot match metricName %s against the retention filter: %s", mn, err)
+				continue
+			}
+			if ok {
+				idx = i
+				break
+			}
+		}
+	}
+	return idx, true
+}
+
+// isPartitionMergeNeeded returns true if the partition with the given time range and parts
+// must be merged in order to drop samples outside retention filters at currentTimestamp.
+func (rfs *retentionFilters) isPartitionMergeNeeded(tr TimeRange, pws []*partWrapper, currentTimestamp int64) bool {
+	if rfs == nil || len(pws) == 0 {
+		return false
+	}
+	minAppliedTimestamp := pws[0].p.ph.MinRetentionFiltersTimestamp
+	for _, pw := range pws[1:] {
+		minAppliedTimestamp = min(minAppliedTimestamp, pw.p.ph.MinRetentionFiltersTimestamp)
+	}
+	if currentTimestamp-minAppliedTimestamp < retentionFiltersMergeInterval.Milliseconds() {
+		// Retention filters were applied to the partition recently.
+		return false
+	}
+	for i := range rfs.filters {
+		retentionMsecs := rfs.filters[i].retentionMsecs
+		if tr.MinTimestamp >= currentTimestamp-retentionMsecs {
+			// The partition doesn't contain samples outside the retention for the given filter.
+			continue
+		}
+		if tr.MaxTimestamp < minAppliedTimestamp-retentionMsecs {
+			// All the samples outside the retention for the given filter were already dropped during the previous merge.
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// retentionFiltersMergeInterval is the minimum interval between merges for historical partitions,
+// which are performed in order to drop samples outside retention filters.
+const retentionFiltersMergeInterval = 24 * time.Hour
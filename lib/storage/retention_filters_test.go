@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetentionFilterSuccess(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		rf, err := ParseRetentionFilter(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := rf.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %s; want %s", s, result, resultExpected)
+		}
+	}
+	f(`{team="dev"}:7d`, `{team="dev"}:168h0m0s`)
+	f(`{instance="host:9100"}:12h`, `{instance="host:9100"}:12h0m0s`)
+	f(`foo{env=~"dev|test",job!="bar"}:1w`, `{__name__="foo",env=~"dev|test",job!="bar"}:168h0m0s`)
+	f(`{env="dev" or env="test"}:3d`, `{env="dev" or env="test"}:72h0m0s`)
+}
+
+func TestParseRetentionFilterFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := ParseRetentionFilter(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+	f(``)
+	f(`{team="dev"}`)
+	f(`{team="dev"}:`)
+	f(`{team="dev"}:foo`)
+	f(`{team="dev"}:0s`)
+	f(`{team="dev":7d`)
+	f(`sum(foo):7d`)
+}
+
+func TestStorageRetentionFilters(t *testing.T) {
+	defer testRemoveAll(t)
+
+	rf, err := ParseRetentionFilter(`{team="dev"}:7d`)
+	if err != nil {
+		t.Fatalf("cannot parse retention filter: %s", err)
+	}
+	s := MustOpenStorage(t.Name(), OpenOptions{
+		Retention:        30 * 24 * time.Hour,
+		RetentionFilters: []RetentionFilter{*rf},
+	})
+	defer s.MustClose()
+
+	now := timestampFromTime(time.Now())
+	newMetricRow := func(team string, timestamp int64) MetricRow {
+		mn := MetricName{
+			MetricGroup: []byte("metric"),
+			Tags: []Tag{
+				{[]byte("team"), []byte(team)},
+			},
+		}
+		return MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     timestamp,
+			Value:         float64(timestamp),
+		}
+	}
+	oldTimestamp := now - 10*24*3600*1000
+	recentTimestamp := now - 3600*1000
+
+	// Store old and recent samples into distinct parts.
+	s.AddRows([]MetricRow{
+		newMetricRow("dev", oldTimestamp),
+		newMetricRow("prod", oldTimestamp),
+	}, defaultPrecisionBits)
+	s.DebugFlush()
+	s.AddRows([]MetricRow{
+		newMetricRow("dev", recentTimestamp),
+		newMetricRow("prod", recentTimestamp),
+	}, defaultPrecisionBits)
+	s.DebugFlush()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: now - 20*24*3600*1000,
+		MaxTimestamp: now,
+	}
+	want := []MetricRow{
+		newMetricRow("dev", recentTimestamp),
+		newMetricRow("prod", oldTimestamp),
+		newMetricRow("prod", recentTimestamp),
+	}
+
+	// Samples outside the retention filter must be excluded from search
+	if err := testAssertSearchResult(s, tr, tfs, want); err != nil {
+		t.Fatalf("unexpected search result before the merge: %s", err)
+	}
+
+	// Samples outside the retention filter must be dropped during merge
+	if err := s.ForceMergePartitions(""); err != nil {
+		t.Fatalf("cannot force merge partitions: %s", err)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if rows := m.TableMetrics.TotalRowsCount(); rows != uint64(len(want)) {
+		t.Fatalf("unexpected number of rows after the merge; got %d; want %d", rows, len(want))
+	}
+	if err := testAssertSearchResult(s, tr, tfs, want); err != nil {
+		t.Fatalf("unexpected search result after the merge: %s", err)
+	}
+}
+
+func TestRetentionFiltersCache(t *testing.T) {
+	rfc := newRetentionFiltersCache(1, 2)
+
+	f := func(metricID uint64, idxExpected int, okExpected bool) {
+		t.Helper()
+		idx, ok := rfc.getMatchedFilterIdx(metricID)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for metricID=%d; got %v; want %v", metricID, ok, okExpected)
+		}
+		if idx != idxExpected {
+			t.Fatalf("unexpected idx for metricID=%d; got %d; want %d", metricID, idx, idxExpected)
+		}
+	}
+
+	rfc.add(1, 0, true)
+	rfc.add(2, 1, true)
+	rfc.add(3, -1, true)
+	rfc.add(4, -1, false)
+
+	f(1, 0, true)
+	f(2, 1, true)
+	f(3, -1, true)
+
+	// Missing metric names must be cached
+	f(4, -1, true)
+
+	// Unknown metricID
+	f(5, -1, false)
+
+	if n := rfc.itemsCount(); n != 4 {
+		t.Fatalf("unexpected itemsCount; got %d; want 4", n)
+	}
+}
@@ -113,8 +113,8 @@ type Search struct {
 	// tfss contains tag filters used in the search.
 	tfss []*TagFilters
 
-	// deadline in unix timestamp seconds for the current search.
-	deadline uint64
+	// deadline for the current search.
+	deadline Deadline
 
 	err error
 
@@ -139,7 +139,7 @@ func (s *Search) reset() {
 	s.ts.reset()
 	s.tr = TimeRange{}
 	s.tfss = nil
-	s.deadline = 0
+	s.deadline = Deadline{}
 	s.err = nil
 	s.needClosing = false
 	s.loops = 0
@@ -152,7 +152,7 @@ func (s *Search) reset() {
 // MustClose must be called when the search is done.
 //
 // Init returns the upper bound on the number of found time series.
-func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
+func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline Deadline) int {
 	qt = qt.NewChild("init series search: filters=%s, timeRange=%s", tfss, &tr)
 	defer qt.Done()
 
@@ -191,7 +191,7 @@ func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilte
 //
 // The method will fail if the number of found TSIDs exceeds maxMetrics or the
 // search has not completed within the specified deadline.
-func (s *Search) searchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+func (s *Search) searchTSIDs(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline Deadline) ([]TSID, error) {
 	qt = qt.NewChild("search TSIDs: filters=%s, timeRange=%s, maxMetrics=%d", tfss, &tr, maxMetrics)
 	defer qt.Done()
 
@@ -261,7 +261,8 @@ func (s *Search) NextMetricBlock() bool {
 		s.loops++
 		tsid := &s.ts.BlockRef.bh.TSID
 		if tsid.MetricID != s.prevMetricID {
-			if s.ts.BlockRef.bh.MaxTimestamp < s.retentionDeadline {
+			retentionDeadline := s.storage.retentionFilters.getRetentionDeadline(tsid.MetricID, s.retentionDeadline)
+			if s.ts.BlockRef.bh.MaxTimestamp < retentionDeadline {
 				// Skip the block, since it contains only data outside the configured retention.
 				continue
 			}
@@ -503,11 +504,39 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 	return src, nil
 }
 
-func checkSearchDeadlineAndPace(deadline uint64) error {
-	if fasttime.UnixTimestamp() > deadline {
+// Deadline limits the duration of search operations.
+type Deadline struct {
+	// timestamp is the deadline in unix timestamp seconds.
+	timestamp uint64
+
+	// done is closed when the search must be stopped before the timestamp.
+	done <-chan struct{}
+}
+
+// NewDeadline returns a deadline for search operations at the given unix timestamp in seconds.
+//
+// If done isn't nil, then search operations are also stopped with ErrDeadlineExceeded after done is closed.
+// For example, ctx.Done() can be passed as done in order to stop search operations when ctx is canceled.
+func NewDeadline(timestamp uint64, done <-chan struct{}) Deadline {
+	return Deadline{
+		timestamp: timestamp,
+		done:      done,
+	}
+}
+
+// noDeadline is used for search operations, which mustn't be stopped.
+var noDeadline = NewDeadline(1<<64-1, nil)
+
+func checkSearchDeadlineAndPace(deadline Deadline) error {
+	if fasttime.UnixTimestamp() > deadline.timestamp {
 		return ErrDeadlineExceeded
 	}
-	return nil
+	select {
+	case <-deadline.done:
+		return ErrDeadlineExceeded
+	default:
+		return nil
+	}
 }
 
 const (
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -146,6 +148,58 @@ func TestSearch(t *testing.T) {
 	})
 }
 
+func TestSearch_CanceledDeadline(t *testing.T) {
+	defer testRemoveAll(t)
+
+	st := MustOpenStorage(t.Name(), OpenOptions{})
+	defer st.MustClose()
+
+	rng := rand.New(rand.NewSource(1))
+	tr := TimeRange{
+		MinTimestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		MaxTimestamp: time.Date(2000, 1, 1, 23, 59, 59, 999, time.UTC).UnixMilli(),
+	}
+	mrs := testGenerateMetricRowsWithPrefix(rng, 100, "metric", tr)
+	st.AddRows(mrs, defaultPrecisionBits)
+	st.DebugFlush()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric.*"), false, true); err != nil {
+		t.Fatalf("unexpected error in TagFilters.Add: %s", err)
+	}
+	tfss := []*TagFilters{tfs}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deadline := NewDeadline(uint64(time.Now().Add(time.Hour).Unix()), ctx.Done())
+
+	f := func(errExpected error) {
+		t.Helper()
+
+		if _, err := st.SearchMetricNames(nil, tfss, tr, 1e5, deadline); !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected error from SearchMetricNames; got %v; want %v", err, errExpected)
+		}
+		if _, err := st.SearchLabelNames(nil, tfss, tr, 1e5, 1e5, deadline); !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected error from SearchLabelNames; got %v; want %v", err, errExpected)
+		}
+
+		var s Search
+		s.Init(nil, st, tfss, tr, 1e5, deadline)
+		for s.NextMetricBlock() {
+		}
+		err := s.Error()
+		s.MustClose()
+		if !errors.Is(err, errExpected) {
+			t.Fatalf("unexpected error from Search; got %v; want %v", err, errExpected)
+		}
+	}
+
+	f(nil)
+
+	// The search must be stopped after the deadline is canceled.
+	cancel()
+	f(ErrDeadlineExceeded)
+}
+
 func TestSearch_VariousTimeRanges(t *testing.T) {
 	defer testRemoveAll(t)
 
@@ -16,15 +16,19 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/backupnames"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bloomfilter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/snapshot/snapshotutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/exemplars"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/metricnamestats"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/metricsmetadata"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/workingsetcache"
@@ -67,6 +71,9 @@ type Storage struct {
 	cachePath      string
 	retentionMsecs int64
 
+	// retentionFilters contains retention filters. It is nil if retention filters aren't set.
+	retentionFilters *retentionFilters
+
 	// lock file for exclusive access to the storage on the given path.
 	flockF *os.File
 
@@ -136,6 +143,7 @@ type Storage struct {
 	nextDayMetricIDsUpdaterWG  sync.WaitGroup
 	retentionWatcherWG         sync.WaitGroup
 	freeDiskSpaceWatcherWG     sync.WaitGroup
+	inmemoryDataCleanerWG      sync.WaitGroup
 
 	// The snapshotLock prevents from concurrent creation of snapshots,
 	// since this may result in snapshots without recently added data,
@@ -168,6 +176,12 @@ type Storage struct {
 
 	metricsTracker *metricnamestats.Tracker
 
+	// metricsMetadata holds TYPE, HELP and UNIT metadata for the ingested metrics.
+	metricsMetadata *metricsmetadata.Storage
+
+	// exemplars holds the most recent exemplars for the ingested series.
+	exemplars *exemplars.Storage
+
 	// idbPrefillStartSeconds defines the start time of the idbNext prefill.
 	// It helps to spread load in time for index records creation and reduce resource usage.
 	idbPrefillStartSeconds int64
@@ -188,6 +202,28 @@ type OpenOptions struct {
 	TrackMetricNamesStats bool
 	IDBPrefillStart       time.Duration
 	LogNewSeries          bool
+
+	// MetricsMetadataMaxAge is the duration for keeping metrics metadata, which isn't updated.
+	//
+	// Metrics metadata is kept for 24 hours if MetricsMetadataMaxAge isn't set.
+	MetricsMetadataMaxAge time.Duration
+
+	// MaxExemplarsPerSeries is the maximum number of exemplars to keep per each series.
+	//
+	// Up to 10 exemplars are kept per series if MaxExemplarsPerSeries isn't set.
+	MaxExemplarsPerSeries int
+
+	// ExemplarsRetention is the duration for keeping exemplars.
+	//
+	// Exemplars are kept for 24 hours if ExemplarsRetention isn't set.
+	ExemplarsRetention time.Duration
+
+	// RetentionFilters contains retention for time series matching the given filters.
+	//
+	// The smallest retention across matching filters is applied to every time series.
+	// Time series, which do not match any filter, use Retention.
+	// Retention for every filter cannot exceed Retention.
+	RetentionFilters []RetentionFilter
 }
 
 // MustOpenStorage opens storage on the given path with the given retentionMsecs.
@@ -275,6 +311,22 @@ func MustOpenStorage(path string, opts OpenOptions) *Storage {
 		}
 	}
 
+	metricsMetadataMaxAge := opts.MetricsMetadataMaxAge
+	if metricsMetadataMaxAge <= 0 {
+		metricsMetadataMaxAge = 24 * time.Hour
+	}
+	s.metricsMetadata = metricsmetadata.MustLoadFrom(filepath.Join(s.cachePath, "metrics_metadata"), uint64(getMetricsMetadataCacheSize()), uint64(metricsMetadataMaxAge.Seconds()))
+
+	maxExemplarsPerSeries := opts.MaxExemplarsPerSeries
+	if maxExemplarsPerSeries <= 0 {
+		maxExemplarsPerSeries = 10
+	}
+	exemplarsRetention := opts.ExemplarsRetention
+	if exemplarsRetention <= 0 {
+		exemplarsRetention = 24 * time.Hour
+	}
+	s.exemplars = exemplars.MustLoadFrom(filepath.Join(s.cachePath, "exemplars"), uint64(getExemplarsCacheSize()), maxExemplarsPerSeries, exemplarsRetention.Milliseconds())
+
 	// Load metadata
 	metadataDir := filepath.Join(path, metadataDirname)
 	isEmptyDB := !fs.IsPathExist(filepath.Join(path, indexdbDirname))
@@ -283,6 +335,12 @@ func MustOpenStorage(path string, opts OpenOptions) *Storage {
 
 	s.disablePerDayIndex = opts.DisablePerDayIndex
 
+	rfs, err := newRetentionFilters(s, opts.RetentionFilters)
+	if err != nil {
+		logger.Panicf("FATAL: cannot initialize retention filters: %s", err)
+	}
+	s.retentionFilters = rfs
+
 	// Load indexdb
 	idbPath := filepath.Join(path, indexdbDirname)
 	idbSnapshotsPath := filepath.Join(idbPath, snapshotsDirname)
@@ -328,6 +386,7 @@ func MustOpenStorage(path string, opts OpenOptions) *Storage {
 	s.startCurrHourMetricIDsUpdater()
 	s.startNextDayMetricIDsUpdater()
 	s.startRetentionWatcher()
+	s.startInmemoryDataCleaner()
 
 	return s
 }
@@ -360,6 +419,34 @@ func getMetricNamesStatsCacheSize() int {
 	return maxMetricNamesStatsCacheSize
 }
 
+var maxMetricsMetadataCacheSize int
+
+// SetMetricsMetadataCacheSize overrides the default size of storage/metricsMetadata
+func SetMetricsMetadataCacheSize(size int) {
+	maxMetricsMetadataCacheSize = size
+}
+
+func getMetricsMetadataCacheSize() int {
+	if maxMetricsMetadataCacheSize <= 0 {
+		return memory.Allowed() / 100
+	}
+	return maxMetricsMetadataCacheSize
+}
+
+var maxExemplarsCacheSize int
+
+// SetExemplarsCacheSize overrides the default size of storage/exemplars
+func SetExemplarsCacheSize(size int) {
+	maxExemplarsCacheSize = size
+}
+
+func getExemplarsCacheSize() int {
+	if maxExemplarsCacheSize <= 0 {
+		return memory.Allowed() / 100
+	}
+	return maxExemplarsCacheSize
+}
+
 var maxMetricNameCacheSize int
 
 // SetMetricNameCacheSize overrides the default size of storage/metricName cache
@@ -655,6 +742,17 @@ type Metrics struct {
 	MetricNamesUsageTrackerSizeBytes    uint64
 	MetricNamesUsageTrackerSizeMaxBytes uint64
 
+	MetricsMetadataSize         uint64
+	MetricsMetadataSizeBytes    uint64
+	MetricsMetadataSizeMaxBytes uint64
+	MetricsMetadataDropped      uint64
+
+	ExemplarsSize         uint64
+	ExemplarsSeriesCount  uint64
+	ExemplarsSizeBytes    uint64
+	ExemplarsSizeMaxBytes uint64
+	ExemplarsDropped      uint64
+
 	IndexDBMetrics IndexDBMetrics
 	TableMetrics   TableMetrics
 }
@@ -757,6 +855,21 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.MetricNamesUsageTrackerSize = tm.CurrentItemsCount
 	m.MetricNamesUsageTrackerSizeMaxBytes = tm.MaxSizeBytes
 
+	var mmm metricsmetadata.Metrics
+	s.metricsMetadata.UpdateMetrics(&mmm)
+	m.MetricsMetadataSize = mmm.ItemsCount
+	m.MetricsMetadataSizeBytes = mmm.SizeBytes
+	m.MetricsMetadataSizeMaxBytes = mmm.MaxSizeBytes
+	m.MetricsMetadataDropped = mmm.ItemsDropped
+
+	var em exemplars.Metrics
+	s.exemplars.UpdateMetrics(&em)
+	m.ExemplarsSize = em.ItemsCount
+	m.ExemplarsSeriesCount = em.SeriesCount
+	m.ExemplarsSizeBytes = em.SizeBytes
+	m.ExemplarsSizeMaxBytes = em.MaxSizeBytes
+	m.ExemplarsDropped = em.ItemsDropped
+
 	d := s.nextRetentionSeconds()
 	if d < 0 {
 		d = 0
@@ -859,6 +972,30 @@ func (s *Storage) retentionWatcher() {
 	}
 }
 
+func (s *Storage) startInmemoryDataCleaner() {
+	s.inmemoryDataCleanerWG.Add(1)
+	go func() {
+		s.inmemoryDataCleaner()
+		s.inmemoryDataCleanerWG.Done()
+	}()
+}
+
+// inmemoryDataCleaner periodically removes outdated metrics metadata and exemplars.
+func (s *Storage) inmemoryDataCleaner() {
+	d := timeutil.AddJitterToDuration(time.Minute)
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.metricsMetadata.MustCleanup()
+			s.exemplars.MustCleanup()
+		}
+	}
+}
+
 func (s *Storage) startCurrHourMetricIDsUpdater() {
 	s.currHourMetricIDsUpdaterWG.Add(1)
 	go func() {
@@ -993,6 +1130,7 @@ func (s *Storage) MustClose() {
 	s.retentionWatcherWG.Wait()
 	s.currHourMetricIDsUpdaterWG.Wait()
 	s.nextDayMetricIDsUpdaterWG.Wait()
+	s.inmemoryDataCleanerWG.Wait()
 
 	s.tb.MustClose()
 
@@ -1017,6 +1155,8 @@ func (s *Storage) MustClose() {
 	s.mustSaveNextDayMetricIDs(nextDayMetricIDs)
 
 	s.metricsTracker.MustClose()
+	s.metricsMetadata.MustClose()
+	s.exemplars.MustClose()
 	// Release lock file.
 	fs.MustClose(s.flockF)
 	s.flockF = nil
@@ -1415,7 +1555,7 @@ func (s *Storage) searchMetricName(idbPrev, idbCurr *indexDB, dst []byte, metric
 // If -disablePerDayIndex is set or the time range is more than 40 days, the
 // time range is ignored and the metrics are searched within the entire
 // retention period, i.e. the global index are used for searching.
-func (s *Storage) SearchMetricNames(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]string, error) {
+func (s *Storage) SearchMetricNames(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline Deadline) ([]string, error) {
 	qt = qt.NewChild("search metric names: filters=%s, timeRange=%s, maxMetrics: %d", tfss, &tr, maxMetrics)
 	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) ([]string, error) {
 		return idb.SearchMetricNames(qt, tfss, tr, maxMetrics, deadline)
@@ -1445,6 +1585,45 @@ func (s *Storage) SearchMetricNames(qt *querytracer.Tracer, tfss []*TagFilters,
 	return res, nil
 }
 
+// SearchSeriesCount returns the number of series matching the given tfss on
+// the given tr.
+//
+// Unlike SearchMetricNames, it doesn't load metric names for the matching
+// series. If the number of matching series exceeds maxMetrics, then
+// maxMetrics+1 is returned instead of an error.
+func (s *Storage) SearchSeriesCount(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline Deadline) (int, error) {
+	qt = qt.NewChild("search series count: filters=%s, timeRange=%s, maxMetrics: %d", tfss, &tr, maxMetrics)
+	defer qt.Done()
+
+	var limitExceeded atomic.Bool
+	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) ([]uint64, error) {
+		metricIDs, err := idb.searchMetricIDs(qt, tfss, tr, maxMetrics, deadline)
+		if isTooManyTimeseriesError(err) {
+			limitExceeded.Store(true)
+			return nil, nil
+		}
+		return metricIDs, err
+	}
+	merge := func(data [][]uint64) []uint64 {
+		var m uint64set.Set
+		for _, d := range data {
+			m.AddMulti(d)
+		}
+		return m.AppendTo(nil)
+	}
+	metricIDs, err := searchAndMerge(qt, s, tr, search, merge)
+	if err != nil {
+		return 0, err
+	}
+	n := len(metricIDs)
+	if limitExceeded.Load() || n > maxMetrics {
+		qt.Printf("the number of matching series exceeds %d", maxMetrics)
+		return maxMetrics + 1, nil
+	}
+	qt.Printf("found %d series", n)
+	return n, nil
+}
+
 // ErrDeadlineExceeded is returned when the request times out.
 var ErrDeadlineExceeded = fmt.Errorf("deadline exceeded")
 
@@ -1506,7 +1685,7 @@ func (s *Storage) DeleteSeries(qt *querytracer.Tracer, tfss []*TagFilters, maxMe
 // If -disablePerDayIndex is set or the time range is more than 40 days, the
 // time range is ignored and the label names are searched within the entire
 // retention period, i.e. the global index are used for searching.
-func (s *Storage) SearchLabelNames(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxLabelNames, maxMetrics int, deadline uint64) ([]string, error) {
+func (s *Storage) SearchLabelNames(qt *querytracer.Tracer, tfss []*TagFilters, tr TimeRange, maxLabelNames, maxMetrics int, deadline Deadline) ([]string, error) {
 	qt = qt.NewChild("search for label names: filters=%s, timeRange=%s, maxLabelNames=%d, maxMetrics=%d", tfss, &tr, maxLabelNames, maxMetrics)
 	defer qt.Done()
 
@@ -1531,7 +1710,7 @@ func (s *Storage) SearchLabelNames(qt *querytracer.Tracer, tfss []*TagFilters, t
 // If -disablePerDayIndex is set or the time range is more than 40 days, the
 // time range is ignored and the label values are searched within the entire
 // retention period, i.e. the global index are used for searching.
-func (s *Storage) SearchLabelValues(qt *querytracer.Tracer, labelName string, tfss []*TagFilters, tr TimeRange, maxLabelValues, maxMetrics int, deadline uint64) ([]string, error) {
+func (s *Storage) SearchLabelValues(qt *querytracer.Tracer, labelName string, tfss []*TagFilters, tr TimeRange, maxLabelValues, maxMetrics int, deadline Deadline) ([]string, error) {
 	qt = qt.NewChild("search for label values: labelName=%q, filters=%s, timeRange=%s, maxLabelNames=%d, maxMetrics=%d", labelName, tfss, &tr, maxLabelValues, maxMetrics)
 	defer qt.Done()
 
@@ -1563,7 +1742,7 @@ func (s *Storage) SearchLabelValues(qt *querytracer.Tracer, labelName string, tf
 // If -disablePerDayIndex is set or the time range is more than 40 days, the
 // time range is ignored and the tag value suffixes are searched within the
 // entire retention period, i.e. the global index are used for searching.
-func (s *Storage) SearchTagValueSuffixes(qt *querytracer.Tracer, tr TimeRange, tagKey, tagValuePrefix string, delimiter byte, maxTagValueSuffixes int, deadline uint64) ([]string, error) {
+func (s *Storage) SearchTagValueSuffixes(qt *querytracer.Tracer, tr TimeRange, tagKey, tagValuePrefix string, delimiter byte, maxTagValueSuffixes int, deadline Deadline) ([]string, error) {
 	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) (map[string]struct{}, error) {
 		return idb.SearchTagValueSuffixes(qt, tr, tagKey, tagValuePrefix, delimiter, maxTagValueSuffixes, deadline)
 	}
@@ -1585,7 +1764,7 @@ func (s *Storage) SearchTagValueSuffixes(qt *querytracer.Tracer, tr TimeRange, t
 // If -disablePerDayIndex is set or the time range is more than 40 days, the
 // time range is ignored and the graphite paths are searched within the entire
 // retention period, i.e. global index are used for searching.
-func (s *Storage) SearchGraphitePaths(qt *querytracer.Tracer, tr TimeRange, query []byte, maxPaths int, deadline uint64) ([]string, error) {
+func (s *Storage) SearchGraphitePaths(qt *querytracer.Tracer, tr TimeRange, query []byte, maxPaths int, deadline Deadline) ([]string, error) {
 	query = replaceAlternateRegexpsWithGraphiteWildcards(query)
 	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) (map[string]struct{}, error) {
 		return idb.SearchGraphitePaths(qt, tr, nil, query, maxPaths, deadline)
@@ -1645,7 +1824,7 @@ func replaceAlternateRegexpsWithGraphiteWildcards(b []byte) []byte {
 //
 // It includes the deleted series too and may count the same series
 // up to two times - in curr and prev indexDBs.
-func (s *Storage) GetSeriesCount(deadline uint64) (uint64, error) {
+func (s *Storage) GetSeriesCount(deadline Deadline) (uint64, error) {
 	tr := TimeRange{
 		MinTimestamp: 0,
 		MaxTimestamp: time.Now().UnixMilli(),
@@ -1670,7 +1849,7 @@ func (s *Storage) GetSeriesCount(deadline uint64) (uint64, error) {
 //
 // Otherwise, the date is ignored and the status is calculated for the entire
 // retention period, i.e. the global index are used for calculation.
-func (s *Storage) GetTSDBStatus(qt *querytracer.Tracer, tfss []*TagFilters, date uint64, focusLabel string, topN, maxMetrics int, deadline uint64) (*TSDBStatus, error) {
+func (s *Storage) GetTSDBStatus(qt *querytracer.Tracer, tfss []*TagFilters, date uint64, focusLabel string, topN, maxMetrics int, deadline Deadline) (*TSDBStatus, error) {
 	qt = qt.NewChild("getting TSDB status")
 	defer qt.Done()
 
@@ -2957,3 +3136,60 @@ func (s *Storage) GetMetricNamesStats(_ *querytracer.Tracer, limit, le int, matc
 func (s *Storage) ResetMetricNamesStats(_ *querytracer.Tracer) {
 	s.metricsTracker.Reset(s.tsidCache.Reset)
 }
+
+// AddMetricsMetadata adds mms to the metrics metadata storage.
+func (s *Storage) AddMetricsMetadata(mms []prompb.MetricMetadata) {
+	s.metricsMetadata.Add(mms)
+}
+
+// SearchMetricsMetadata returns metrics metadata for the given metricFamilyName.
+//
+// Metadata for all the metric names is returned if metricFamilyName is empty.
+// limit limits the number of returned metric names, while limitPerMetric limits the number of metadata entries per metric name.
+func (s *Storage) SearchMetricsMetadata(qt *querytracer.Tracer, metricFamilyName string, limit, limitPerMetric int) []prompb.MetricMetadata {
+	mms := s.metricsMetadata.Search(0, 0, metricFamilyName, limit, limitPerMetric)
+	qt.Printf("found %d metrics metadata entries", len(mms))
+	return mms
+}
+
+// ExemplarRow is an exemplar for the series with the given MetricNameRaw.
+type ExemplarRow struct {
+	// MetricNameRaw contains raw metric name, which must be decoded
+	// with MetricName.UnmarshalRaw.
+	MetricNameRaw []byte
+
+	// Exemplar is the exemplar for the series.
+	Exemplar prompb.Exemplar
+}
+
+// AddExemplars adds ers to the exemplars storage.
+func (s *Storage) AddExemplars(ers []ExemplarRow) {
+	if len(ers) == 0 {
+		return
+	}
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+
+	var metricNameBuf []byte
+	var prevMetricNameRaw []byte
+	for i := range ers {
+		er := &ers[i]
+		if prevMetricNameRaw == nil || !bytes.Equal(er.MetricNameRaw, prevMetricNameRaw) {
+			if err := mn.UnmarshalRaw(er.MetricNameRaw); err != nil {
+				s.invalidRawMetricNames.Add(1)
+				continue
+			}
+			mn.sortTags()
+			metricNameBuf = mn.Marshal(metricNameBuf[:0])
+			prevMetricNameRaw = er.MetricNameRaw
+		}
+		s.exemplars.Add(bytesutil.ToUnsafeString(metricNameBuf), &er.Exemplar)
+	}
+}
+
+// SearchExemplars returns exemplars on the given tr for the given metricName.
+//
+// metricName must be obtained via SearchMetricNames.
+func (s *Storage) SearchExemplars(metricName string, tr TimeRange) []prompb.Exemplar {
+	return s.exemplars.Search(metricName, tr.MinTimestamp, tr.MaxTimestamp)
+}
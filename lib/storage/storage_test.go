@@ -20,6 +20,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
 	"github.com/google/go-cmp/cmp"
 )
@@ -1439,6 +1440,78 @@ func TestStorageDeleteSeries_CachesAreUpdatedOrReset(t *testing.T) {
 	assertDeletedMetricIDsCacheSize(3)
 }
 
+func TestStorageAddSearchExemplars(t *testing.T) {
+	defer testRemoveAll(t)
+
+	s := MustOpenStorage(t.Name(), OpenOptions{})
+	defer s.MustClose()
+
+	now := timestampFromTime(time.Now())
+	var mn MetricName
+	mn.MetricGroup = []byte("http_requests_total")
+	// Tags are intentionally unsorted in order to verify that exemplars are stored under the canonical metric name.
+	mn.Tags = []Tag{
+		{[]byte("job"), []byte("webservice")},
+		{[]byte("instance"), []byte("1.2.3.4")},
+	}
+	metricNameRaw := mn.marshalRaw(nil)
+	s.AddRows([]MetricRow{
+		{
+			MetricNameRaw: metricNameRaw,
+			Timestamp:     now,
+			Value:         1,
+		},
+	}, defaultPrecisionBits)
+	s.DebugFlush()
+
+	e := prompb.Exemplar{
+		Labels: []prompb.Label{
+			{
+				Name:  "trace_id",
+				Value: "4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+		},
+		Value:     0.5,
+		Timestamp: now,
+	}
+	s.AddExemplars([]ExemplarRow{
+		{
+			MetricNameRaw: metricNameRaw,
+			Exemplar:      e,
+		},
+		{
+			MetricNameRaw: []byte("invalid"),
+			Exemplar:      e,
+		},
+	})
+
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("http_requests_total"), false, false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: now - 3600*1000,
+		MaxTimestamp: now,
+	}
+	metricNames, err := s.SearchMetricNames(nil, []*TagFilters{tfs}, tr, 1e3, noDeadline)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(metricNames) != 1 {
+		t.Fatalf("unexpected number of metric names; got %d; want 1", len(metricNames))
+	}
+	result := s.SearchExemplars(metricNames[0], tr)
+	if !reflect.DeepEqual(result, []prompb.Exemplar{e}) {
+		t.Fatalf("unexpected exemplars\ngot\n%v\nwant\n%v", result, []prompb.Exemplar{e})
+	}
+
+	// exemplars outside the time range must be skipped
+	tr.MaxTimestamp = now - 1
+	if result := s.SearchExemplars(metricNames[0], tr); len(result) != 0 {
+		t.Fatalf("unexpected exemplars outside the time range: %v", result)
+	}
+}
+
 func TestStorageRegisterMetricNamesSerial(t *testing.T) {
 	path := "TestStorageRegisterMetricNamesSerial"
 	s := MustOpenStorage(path, OpenOptions{})
@@ -2725,6 +2798,55 @@ func TestStorageSearchMetricNames_TooManyTimeseries(t *testing.T) {
 	})
 }
 
+func TestStorageSearchSeriesCount(t *testing.T) {
+	defer testRemoveAll(t)
+
+	const numRows = 10
+	rng := rand.New(rand.NewSource(1))
+	tr := TimeRange{
+		MinTimestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		MaxTimestamp: time.Date(2000, 1, 1, 23, 59, 59, 999, time.UTC).UnixMilli(),
+	}
+	var mrs []MetricRow
+	mrs = append(mrs, testGenerateMetricRowsWithPrefix(rng, numRows, "metric1", tr)...)
+	mrs = append(mrs, testGenerateMetricRowsWithPrefix(rng, numRows, "metric2", tr)...)
+
+	s := MustOpenStorage(t.Name(), OpenOptions{})
+	defer s.MustClose()
+	s.AddRows(mrs[:numRows], defaultPrecisionBits)
+	// Rotate the indexDB to ensure that the series from both current and prev indexDBs are counted.
+	s.mustRotateIndexDB(time.Now())
+	s.AddRows(mrs[numRows:], defaultPrecisionBits)
+	s.DebugFlush()
+
+	f := func(filter string, maxMetrics, countExpected int) {
+		t.Helper()
+
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(filter), false, true); err != nil {
+			t.Fatalf("unexpected error in TagFilters.Add: %v", err)
+		}
+		count, err := s.SearchSeriesCount(nil, []*TagFilters{tfs}, tr, maxMetrics, noDeadline)
+		if err != nil {
+			t.Fatalf("unexpected error in SearchSeriesCount(%q, %d): %v", filter, maxMetrics, err)
+		}
+		if count != countExpected {
+			t.Fatalf("unexpected series count for %q, maxMetrics=%d; got %d; want %d", filter, maxMetrics, count, countExpected)
+		}
+	}
+
+	// maxMetrics isn't exceeded
+	f("metric1.*", numRows, numRows)
+	f("metric.*", 2*numRows, 2*numRows)
+
+	// no matching series
+	f("metric3.*", numRows, 0)
+
+	// maxMetrics is exceeded
+	f("metric1.*", numRows-1, numRows)
+	f("metric.*", numRows, numRows+1)
+}
+
 func TestStorageSearchLabelNames_VariousTimeRanges(t *testing.T) {
 	defer testRemoveAll(t)
 
@@ -3899,7 +4021,7 @@ func TestStorageAddRows_currHourMetricIDs(t *testing.T) {
 // The returned metricIDs are sorted. The function panics in in case of error.
 // The function is not a part of Storage beause it is currently used in unit
 // tests only.
-func testSearchMetricIDs(s *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) []uint64 {
+func testSearchMetricIDs(s *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline Deadline) []uint64 {
 	search := func(qt *querytracer.Tracer, idb *indexDB, tr TimeRange) ([]uint64, error) {
 		return idb.searchMetricIDs(qt, tfss, tr, maxMetrics, deadline)
 	}
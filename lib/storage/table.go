@@ -445,8 +445,8 @@ func (tb *table) startHistoricalMergeWatcher() {
 }
 
 func (tb *table) historicalMergeWatcher() {
-	if !isDedupEnabled() {
-		// Deduplication and retentionFilters are disabled.
+	if !isDedupEnabled() && !IsDownsamplingEnabled() && tb.s.retentionFilters == nil {
+		// Deduplication, downsampling and retentionFilters are disabled.
 		return
 	}
 
@@ -474,6 +474,11 @@ func (tb *table) historicalMergeWatcher() {
 				ptw.pt.isDedupScheduled.Store(true)
 				mergeScheduled = true
 			}
+			if ptw.pt.isRetentionFiltersMergeNeeded() {
+				// mark partition with retention filters marker
+				ptw.pt.isRetentionFiltersScheduled.Store(true)
+				mergeScheduled = true
+			}
 			if mergeScheduled {
 				ptwsToMerge = append(ptwsToMerge, ptw)
 			}
@@ -486,6 +491,14 @@ func (tb *table) historicalMergeWatcher() {
 			if pt.isDedupScheduled.Load() {
 				logContext = append(logContext, "removing duplicate samples")
 				logErrContext = append(logErrContext, "remove duplicate samples")
+				if IsDownsamplingEnabled() {
+					logContext = append(logContext, "downsampling samples")
+					logErrContext = append(logErrContext, "downsample samples")
+				}
+			}
+			if pt.isRetentionFiltersScheduled.Load() {
+				logContext = append(logContext, "applying retention filters")
+				logErrContext = append(logErrContext, "apply retention filters")
 			}
 
 			logger.Infof("start %s for partition (%s, %s)", strings.Join(logContext, " and "), pt.bigPartsPath, pt.smallPartsPath)
@@ -495,6 +508,7 @@ func (tb *table) historicalMergeWatcher() {
 			logger.Infof("finished %s for partition (%s, %s) in %.3f seconds", strings.Join(logContext, " and "), pt.bigPartsPath, pt.smallPartsPath, time.Since(t).Seconds())
 
 			pt.isDedupScheduled.Store(false)
+			pt.isRetentionFiltersScheduled.Store(false)
 		}
 	}
 
@@ -0,0 +1,263 @@
+package streamaggr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+// LoadFromCarbonRulesFile loads Aggregators from the given path containing carbon aggregation rules.
+//
+// See https://graphite.readthedocs.io/en/latest/config-carbon.html#aggregation-rules-conf
+//
+// opts can contain additional options. If opts is nil, then default options are used.
+//
+// alias is used as url label in metrics exposed for the returned Aggregators.
+//
+// The returned Aggregators must be stopped with MustStop() when no longer needed.
+func LoadFromCarbonRulesFile(path string, pushFunc PushFunc, opts *Options, alias string) (*Aggregators, error) {
+	data, err := fscore.ReadFileOrHTTP(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load carbon aggregation rules: %w", err)
+	}
+	data = envtemplate.ReplaceBytes(data)
+
+	cfgs, err := ParseCarbonAggregationRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse carbon aggregation rules from %q: %w", path, err)
+	}
+	as, err := loadFromConfigs(cfgs, path, pushFunc, opts, alias)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize aggregators from carbon aggregation rules at %q: %w", path, err)
+	}
+	return as, nil
+}
+
+// ParseCarbonAggregationRules converts carbon aggregation rules from data to stream aggregation configs.
+//
+// Every rule must have the following format:
+//
+//	output_template (frequency) = method input_pattern
+//
+// Every rule is converted into a Config, which selects input series by Graphite path with `input_pattern`,
+// renames them according to `output_template` with `action: graphite` relabeling
+// and aggregates them with the output corresponding to `method` over `frequency` seconds.
+//
+// See https://graphite.readthedocs.io/en/latest/config-carbon.html#aggregation-rules-conf
+func ParseCarbonAggregationRules(data []byte) ([]*Config, error) {
+	var cfgs []*Config
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cfg, err := parseCarbonAggregationRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse rule at line %d: %w", lineNum, err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read carbon aggregation rules: %w", err)
+	}
+	return cfgs, nil
+}
+
+var carbonAggregationRuleRegexp = regexp.MustCompile(`^(\S+)\s+\((\d+)\)\s*=\s*(\S+)\s+(\S+)$`)
+
+func parseCarbonAggregationRule(line string) (*Config, error) {
+	m := carbonAggregationRuleRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected rule %q; want `output_template (frequency) = method input_pattern`", line)
+	}
+	outputTemplate, frequencyStr, method, inputPattern := m[1], m[2], m[3], m[4]
+
+	frequency, err := strconv.ParseUint(frequencyStr, 10, 32)
+	if err != nil || frequency == 0 {
+		return nil, fmt.Errorf("invalid frequency %q in rule %q; it must be a positive number of seconds", frequencyStr, line)
+	}
+	co, ok := carbonOutputs[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported method %q in rule %q", method, line)
+	}
+	regex, graphiteMatch, fields, err := parseCarbonInputPattern(inputPattern)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse input pattern %q in rule %q: %w", inputPattern, line, err)
+	}
+	graphiteName, err := parseCarbonOutputTemplate(outputTemplate, fields)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse output template %q in rule %q: %w", outputTemplate, line, err)
+	}
+
+	var ie promrelabel.IfExpression
+	if err := ie.Parse(fmt.Sprintf(`{__name__=~%s}`, strconv.Quote(regex))); err != nil {
+		return nil, fmt.Errorf("BUG: cannot parse match expression for rule %q: %w", line, err)
+	}
+	interval := fmt.Sprintf("%ds", frequency)
+	outputRelabelConfigs := []promrelabel.RelabelConfig{{
+		// Remove the suffix added by stream aggregation, since carbon doesn't add it.
+		Action:       "replace",
+		SourceLabels: []string{"__name__"},
+		Regex: &promrelabel.MultiLineRegex{
+			S: "(.+):" + regexp.QuoteMeta(interval+"_"+co.suffix),
+		},
+		TargetLabel: "__name__",
+		Replacement: &carbonNameReplacement,
+	}}
+	if co.suffix == "quantiles" {
+		outputRelabelConfigs = append(outputRelabelConfigs, promrelabel.RelabelConfig{
+			Action: "labeldrop",
+			Regex: &promrelabel.MultiLineRegex{
+				S: "quantile",
+			},
+		})
+	}
+	keepMetricNames := false
+	return &Config{
+		Name:            line,
+		Match:           &ie,
+		Interval:        interval,
+		Outputs:         []string{co.output},
+		KeepMetricNames: &keepMetricNames,
+		By:              []string{"__name__"},
+		InputRelabelConfigs: []promrelabel.RelabelConfig{{
+			Action: "graphite",
+			Match:  graphiteMatch,
+			Labels: map[string]string{
+				"__name__": graphiteName,
+			},
+		}},
+		OutputRelabelConfigs: outputRelabelConfigs,
+	}, nil
+}
+
+var carbonNameReplacement = "$1"
+
+type carbonOutput struct {
+	output string
+	suffix string
+}
+
+var carbonOutputs = map[string]carbonOutput{
+	"sum":   {"sum_samples", "sum_samples"},
+	"avg":   {"avg", "avg"},
+	"min":   {"min", "min"},
+	"max":   {"max", "max"},
+	"count": {"count_samples", "count_samples"},
+	"p50":   {"quantiles(0.5)", "quantiles"},
+	"p75":   {"quantiles(0.75)", "quantiles"},
+	"p80":   {"quantiles(0.8)", "quantiles"},
+	"p90":   {"quantiles(0.9)", "quantiles"},
+	"p95":   {"quantiles(0.95)", "quantiles"},
+	"p99":   {"quantiles(0.99)", "quantiles"},
+	"p999":  {"quantiles(0.999)", "quantiles"},
+}
+
+// parseCarbonInputPattern converts carbon input pattern s to a regexp for matching metric names
+// and to a template for `action: graphite` relabeling.
+//
+// It also returns the capture index for every `<field>` in s.
+func parseCarbonInputPattern(s string) (string, string, map[string]int, error) {
+	if strings.ContainsAny(s, "[]{}()|\\$") {
+		return "", "", nil, fmt.Errorf("regexp syntax isn't supported")
+	}
+	if strings.Contains(s, "<<") {
+		return "", "", nil, fmt.Errorf("multi-node `<<field>>` isn't supported")
+	}
+	fields := make(map[string]int)
+	captureIdx := 0
+	regexParts := make([]string, 0, strings.Count(s, ".")+1)
+	matchParts := make([]string, 0, cap(regexParts))
+	for _, node := range strings.Split(s, ".") {
+		if node == "" {
+			return "", "", nil, fmt.Errorf("empty node")
+		}
+		if node == "*" {
+			captureIdx++
+			regexParts = append(regexParts, `[^.]+`)
+			matchParts = append(matchParts, "*")
+			continue
+		}
+		if n := strings.IndexByte(node, '<'); n >= 0 {
+			m := strings.IndexByte(node, '>')
+			if m < n {
+				return "", "", nil, fmt.Errorf("missing `>` in node %q", node)
+			}
+			prefix, name, suffix := node[:n], node[n+1:m], node[m+1:]
+			if name == "" {
+				return "", "", nil, fmt.Errorf("empty field name in node %q", node)
+			}
+			if strings.ContainsAny(prefix+suffix, "*<>") {
+				return "", "", nil, fmt.Errorf("node %q may contain only a single `<field>` without other wildcards", node)
+			}
+			if _, ok := fields[name]; ok {
+				return "", "", nil, fmt.Errorf("duplicate field %q", name)
+			}
+			captureIdx++
+			fields[name] = captureIdx
+			regexParts = append(regexParts, regexp.QuoteMeta(prefix)+`[^.]+?`+regexp.QuoteMeta(suffix))
+			matchParts = append(matchParts, prefix+"*"+suffix)
+			continue
+		}
+		if strings.Contains(node, ">") {
+			return "", "", nil, fmt.Errorf("missing `<` in node %q", node)
+		}
+		if strings.Contains(node, "**") {
+			return "", "", nil, fmt.Errorf("adjacent wildcards aren't supported in node %q", node)
+		}
+		captureIdx += strings.Count(node, "*")
+		literals := strings.Split(node, "*")
+		for i, literal := range literals {
+			literals[i] = regexp.QuoteMeta(literal)
+		}
+		regexParts = append(regexParts, strings.Join(literals, `[^.]*`))
+		matchParts = append(matchParts, node)
+	}
+	return strings.Join(regexParts, `\.`), strings.Join(matchParts, "."), fields, nil
+}
+
+// parseCarbonOutputTemplate converts carbon output template s to a template for `action: graphite` relabeling.
+//
+// Every `<field>` in s is substituted with the corresponding capture from fields.
+func parseCarbonOutputTemplate(s string, fields map[string]int) (string, error) {
+	if strings.Contains(s, "$") {
+		return "", fmt.Errorf("`$` isn't allowed")
+	}
+	if strings.Contains(s, "<<") {
+		return "", fmt.Errorf("multi-node `<<field>>` isn't supported")
+	}
+	var b strings.Builder
+	for {
+		n := strings.IndexByte(s, '<')
+		if n < 0 {
+			if strings.Contains(s, ">") {
+				return "", fmt.Errorf("missing `<`")
+			}
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:n])
+		s = s[n+1:]
+		m := strings.IndexByte(s, '>')
+		if m < 0 {
+			return "", fmt.Errorf("missing `>`")
+		}
+		name := s[:m]
+		s = s[m+1:]
+		idx, ok := fields[name]
+		if !ok {
+			return "", fmt.Errorf("field %q is missing in the input pattern", name)
+		}
+		fmt.Fprintf(&b, "${%d}", idx)
+	}
+}
@@ -0,0 +1,184 @@
+package streamaggr
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+)
+
+func TestParseCarbonAggregationRulesSuccess(t *testing.T) {
+	f := func(data, resultExpected string) {
+		t.Helper()
+
+		cfgs, err := ParseCarbonAggregationRules([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result, err := yaml.Marshal(cfgs)
+		if err != nil {
+			t.Fatalf("cannot marshal configs: %s", err)
+		}
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+
+		// Verify the generated configs are valid
+		as, err := loadFromConfigs(cfgs, "inmemory", func(_ []prompb.TimeSeries) {}, nil, "")
+		if err != nil {
+			t.Fatalf("cannot initialize aggregators: %s", err)
+		}
+		as.MustStop()
+	}
+
+	// empty rules
+	f("", "[]\n")
+	f("# comment\n\n  \n", "[]\n")
+
+	// fields and wildcards
+	f(`
+# aggregate requests per app
+<env>.applications.<app>.all.requests (60) = sum <env>.applications.<app>.*.requests
+`, `- name: <env>.applications.<app>.all.requests (60) = sum <env>.applications.<app>.*.requests
+  match: '{__name__=~"[^.]+?\\.applications\\.[^.]+?\\.[^.]+\\.requests"}'
+  interval: 60s
+  outputs:
+  - sum_samples
+  keep_metric_names: false
+  by:
+  - __name__
+  input_relabel_configs:
+  - action: graphite
+    match: '*.applications.*.*.requests'
+    labels:
+      __name__: ${1}.applications.${2}.all.requests
+  output_relabel_configs:
+  - action: replace
+    source_labels: [__name__]
+    target_label: __name__
+    regex: (.+):60s_sum_samples
+    replacement: $1
+`)
+
+	// field with prefix and suffix; wildcard inside node; quantile output
+	f(`total.<host>_x.p99 (10) = p99 servers.srv-<host>_x.cpu*.load`, `- name: total.<host>_x.p99 (10) = p99 servers.srv-<host>_x.cpu*.load
+  match: '{__name__=~"servers\\.srv-[^.]+?_x\\.cpu[^.]*\\.load"}'
+  interval: 10s
+  outputs:
+  - quantiles(0.99)
+  keep_metric_names: false
+  by:
+  - __name__
+  input_relabel_configs:
+  - action: graphite
+    match: servers.srv-*_x.cpu*.load
+    labels:
+      __name__: total.${1}_x.p99
+  output_relabel_configs:
+  - action: replace
+    source_labels: [__name__]
+    target_label: __name__
+    regex: (.+):10s_quantiles
+    replacement: $1
+  - action: labeldrop
+    regex: quantile
+`)
+}
+
+func TestParseCarbonAggregationRulesFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		_, err := ParseCarbonAggregationRules([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid format
+	f("foo")
+	f("foo (60) sum bar")
+	f("foo 60 = sum bar")
+	f("foo (60) = sum")
+
+	// invalid frequency
+	f("foo (0) = sum bar")
+	f("foo (-1) = sum bar")
+
+	// unsupported method
+	f("foo (60) = last bar")
+
+	// unsupported input pattern
+	f("foo (60) = sum bar.<<baz>>")
+	f("foo (60) = sum bar.{a,b}")
+	f("foo (60) = sum bar.[ab]")
+	f("foo (60) = sum bar..baz")
+	f("foo (60) = sum bar.<a><b>")
+	f("foo (60) = sum bar.<a>*")
+	f("foo (60) = sum bar.a**")
+	f("foo (60) = sum bar.<>")
+	f("foo (60) = sum bar.<a")
+	f("foo (60) = sum bar.a>")
+	f("foo.<a> (60) = sum bar.<a>.<a>")
+
+	// unknown field in output template
+	f("foo.<b> (60) = sum bar.<a>")
+	f("foo.<a (60) = sum bar.<a>")
+	f("foo.$1 (60) = sum bar.<a>")
+}
+
+func TestCarbonAggregationRulesAggregate(t *testing.T) {
+	data := `
+<env>.all.requests (60) = sum <env>.host-*.requests
+<env>.max.latency (60) = max <env>.*.latency
+`
+	cfgs, err := ParseCarbonAggregationRules([]byte(data))
+	if err != nil {
+		t.Fatalf("cannot parse rules: %s", err)
+	}
+	var tssOutput []prompb.TimeSeries
+	var tssOutputLock sync.Mutex
+	pushFunc := func(tss []prompb.TimeSeries) {
+		tssOutputLock.Lock()
+		tssOutput = appendClonedTimeseries(tssOutput, tss)
+		tssOutputLock.Unlock()
+	}
+	opts := &Options{
+		FlushOnShutdown: true,
+	}
+	as, err := loadFromConfigs(cfgs, "inmemory", pushFunc, opts, "")
+	if err != nil {
+		t.Fatalf("cannot initialize aggregators: %s", err)
+	}
+	tssInput := prometheus.MustParsePromMetrics(`
+prod.host-1.requests 1
+prod.host-2.requests{tag="x"} 2
+dev.host-1.requests 3
+prod.host-1.latency 5
+prod.host-2.latency 7
+prod.host.requests.total 100
+`, time.Now().UnixMilli())
+	matchIdxs := as.Push(tssInput, nil)
+	as.MustStop()
+
+	matchIdxsStr := ""
+	for _, v := range matchIdxs {
+		matchIdxsStr += strconv.Itoa(int(v))
+	}
+	if matchIdxsStrExpected := "111110"; matchIdxsStr != matchIdxsStrExpected {
+		t.Fatalf("unexpected matchIdxs;\ngot\n%s\nwant\n%s", matchIdxsStr, matchIdxsStrExpected)
+	}
+	outputMetrics := timeSeriessToString(tssOutput)
+	outputMetricsExpected := `dev.all.requests 3
+prod.all.requests 3
+prod.max.latency 7
+`
+	if outputMetrics != outputMetricsExpected {
+		t.Fatalf("unexpected output metrics;\ngot\n%s\nwant\n%s", outputMetrics, outputMetricsExpected)
+	}
+}
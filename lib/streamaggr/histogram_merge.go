@@ -0,0 +1,12 @@
+package streamaggr
+
+// newHistogramMergeAggrConfig returns config for output=histogram_merge.
+//
+// histogram_merge sums counter-type histogram buckets such as Prometheus `le` buckets and VictoriaMetrics `vmrange` buckets
+// across the aggregated series. Counter resets are detected individually per each input series in the same way as for output=total.
+// Bucket labels are always kept in the output, so the aggregated buckets remain valid histograms.
+func newHistogramMergeAggrConfig(ignoreFirstSampleIntervalSecs uint64) aggrConfig {
+	ac := newTotalAggrConfig(ignoreFirstSampleIntervalSecs, false, true).(*totalAggrConfig)
+	ac.suffix = "histogram_merge"
+	return ac
+}
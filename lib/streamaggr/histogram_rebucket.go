@@ -0,0 +1,358 @@
+package streamaggr
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+const (
+	// bucketKindNone is used for series without bucket labels such as `_sum` and `_count`
+	bucketKindNone = iota
+
+	// bucketKindLe is used for cumulative Prometheus buckets with `le` label
+	bucketKindLe
+
+	// bucketKindVMRange is used for VictoriaMetrics buckets with `vmrange` label
+	bucketKindVMRange
+
+	// bucketKindInvalid is used for series with unparsable bucket labels. Such series are ignored.
+	bucketKindInvalid
+)
+
+type histogramRebucketLastValue struct {
+	value          float64
+	timestamp      int64
+	deleteDeadline int64
+
+	// groupKey identifies the source histogram for the series, e.g. input labels without the bucket label.
+	groupKey string
+
+	// lowerBound and upperBound are the bounds of the bucket for the series.
+	// lowerBound is set only for `vmrange` buckets, since `le` buckets are cumulative.
+	lowerBound float64
+	upperBound float64
+
+	// total is the sum of increases for the series since it has been created.
+	// It is used for `le` buckets, so buckets without new samples keep their last totals.
+	total float64
+
+	bucketKind int
+}
+
+type histogramRebucketAggrValueShared struct {
+	lastValues map[string]*histogramRebucketLastValue
+
+	// groupCounts contains cumulative counts per each histogramRebucketAggrConfig.upperBounds entry
+	// for every source histogram with `le` buckets, which were added to counts.
+	groupCounts map[string][]float64
+
+	// counts contains cumulative counts per each histogramRebucketAggrConfig.upperBounds entry
+	counts     []float64
+	hasBuckets bool
+
+	// total contains the total for series without bucket labels
+	total    float64
+	hasTotal bool
+}
+
+// histogramRebucketAggrValue calculates output=histogram_rebucket, e.g. Prometheus histogram with the given buckets
+// over input Prometheus or VictoriaMetrics histogram buckets.
+type histogramRebucketAggrValue struct {
+	// increases contains per-series increases since the last flush
+	increases map[string]float64
+	shared    *histogramRebucketAggrValueShared
+}
+
+type histogramRebucketBucket struct {
+	groupKey   string
+	upperBound float64
+	total      float64
+}
+
+func (av *histogramRebucketAggrValue) pushSample(c aggrConfig, sample *pushSample, key string, deleteDeadline int64) {
+	ac := c.(*histogramRebucketAggrConfig)
+	currentTime := fasttime.UnixTimestamp()
+	keepFirstSample := currentTime >= ac.ignoreFirstSampleDeadline
+	lv, ok := av.shared.lastValues[key]
+	if ok {
+		if sample.timestamp < lv.timestamp {
+			// Skip out of order sample
+			return
+		}
+	} else {
+		lv = newHistogramRebucketLastValue(key, ac.useInputKey)
+		key = bytesutil.InternString(key)
+		av.shared.lastValues[key] = lv
+	}
+	if ok || keepFirstSample {
+		increase := sample.value - lv.value
+		if sample.value < lv.value {
+			// counter reset
+			increase = sample.value
+		}
+		if _, ok := av.increases[key]; !ok {
+			key = bytesutil.InternString(key)
+		}
+		av.increases[key] += increase
+	}
+	lv.value = sample.value
+	lv.timestamp = sample.timestamp
+	lv.deleteDeadline = deleteDeadline
+}
+
+func newHistogramRebucketLastValue(key string, useInputKey bool) *histogramRebucketLastValue {
+	if !useInputKey {
+		// The key contains both output and input labels. Extract input labels from it.
+		src := bytesutil.ToUnsafeBytes(key)
+		outputKeyLen, nSize := encoding.UnmarshalVarUint64(src)
+		if nSize <= 0 {
+			logger.Panicf("BUG: cannot unmarshal outputKeyLen from uvarint")
+		}
+		key = bytesutil.ToUnsafeString(src[nSize+int(outputKeyLen):])
+	}
+	labels := decompressLabels(nil, key)
+	lv := &histogramRebucketLastValue{
+		bucketKind: bucketKindNone,
+	}
+	dst := labels[:0]
+	for _, label := range labels {
+		switch label.Name {
+		case "le":
+			lv.bucketKind, lv.upperBound = bucketKindLe, parseBucketUpperBound(label.Value)
+		case "vmrange":
+			if lv.bucketKind != bucketKindLe {
+				start, end, _ := strings.Cut(label.Value, "...")
+				lv.bucketKind, lv.lowerBound, lv.upperBound = bucketKindVMRange, parseBucketUpperBound(start), parseBucketUpperBound(end)
+			}
+		default:
+			dst = append(dst, label)
+		}
+	}
+	if math.IsNaN(lv.lowerBound) || math.IsNaN(lv.upperBound) {
+		lv.bucketKind = bucketKindInvalid
+	}
+	lv.groupKey = string(lc.Compress(nil, dst))
+	return lv
+}
+
+func parseBucketUpperBound(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+func (av *histogramRebucketAggrValue) flush(c aggrConfig, ctx *flushCtx, key string, isLast bool) {
+	ac := c.(*histogramRebucketAggrConfig)
+	shared := av.shared
+
+	// Cumulative `le` buckets must be re-bucketed per each source histogram, since this requires all its buckets.
+	// So collect them first.
+	var buckets []histogramRebucketBucket
+	liveGroups := make(map[string]struct{})
+	lvs := shared.lastValues
+	for lk, lv := range lvs {
+		increase := av.increases[lk]
+		switch lv.bucketKind {
+		case bucketKindNone:
+			shared.total += increase
+			shared.hasTotal = true
+		case bucketKindLe:
+			// Buckets without samples since the last flush keep their last totals,
+			// so they do not break the relation between the buckets of the source histogram.
+			lv.total += increase
+			buckets = append(buckets, histogramRebucketBucket{
+				groupKey:   lv.groupKey,
+				upperBound: lv.upperBound,
+				total:      lv.total,
+			})
+		case bucketKindVMRange:
+			shared.addRangeIncrease(ac.upperBounds, lv.lowerBound, lv.upperBound, increase)
+		}
+		// check for stale entries
+		if ctx.flushTimestamp > lv.deleteDeadline || isLast {
+			delete(lvs, lk)
+		} else if lv.bucketKind == bucketKindLe {
+			liveGroups[lv.groupKey] = struct{}{}
+		}
+	}
+	clear(av.increases)
+	sort.Slice(buckets, func(i, j int) bool {
+		a, b := &buckets[i], &buckets[j]
+		if a.groupKey != b.groupKey {
+			return a.groupKey < b.groupKey
+		}
+		return a.upperBound < b.upperBound
+	})
+	groupCounts := shared.groupCounts
+	for len(buckets) > 0 {
+		n := 1
+		for n < len(buckets) && buckets[n].groupKey == buckets[0].groupKey {
+			n++
+		}
+		counts := shared.addGroupTotals(ac.upperBounds, buckets[:n])
+		groupCounts[buckets[0].groupKey] = counts
+		buckets = buckets[n:]
+	}
+	// Drop the state for source histograms without live buckets.
+	for groupKey := range groupCounts {
+		if _, ok := liveGroups[groupKey]; !ok {
+			delete(groupCounts, groupKey)
+		}
+	}
+
+	if shared.hasTotal {
+		ctx.appendSeries(key, "histogram_rebucket", shared.total)
+	}
+	if shared.hasBuckets {
+		for i, le := range ac.leValues {
+			ctx.appendSeriesWithExtraLabel(key, "histogram_rebucket", shared.counts[i], "le", le)
+		}
+	}
+}
+
+// addGroupTotals adds the cumulative counts for the source histogram with the given `le` buckets sorted by upper bound
+// to shared.counts and returns the cumulative counts per each upperBounds entry for the source histogram.
+//
+// Only the growth since the previous call for the same source histogram is added to shared.counts,
+// so shared.counts never decrease.
+func (shared *histogramRebucketAggrValueShared) addGroupTotals(upperBounds []float64, buckets []histogramRebucketBucket) []float64 {
+	shared.hasBuckets = true
+
+	// Totals must be non-decreasing by le. They may be temporarily violated when samples for some buckets
+	// are received after the flush, so adjust them to the totals of the preceding buckets.
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].total < buckets[i-1].total {
+			buckets[i].total = buckets[i-1].total
+		}
+	}
+
+	groupKey := buckets[0].groupKey
+	counts := shared.groupCounts[groupKey]
+	if counts == nil {
+		counts = make([]float64, len(upperBounds))
+	}
+	for i, upperBound := range upperBounds {
+		v := getCumulativeCount(buckets, upperBound)
+		if v > counts[i] {
+			shared.counts[i] += v - counts[i]
+			counts[i] = v
+		}
+	}
+	return counts
+}
+
+// getCumulativeCount returns the cumulative count for the given le over the given `le` buckets sorted by upper bound.
+//
+// The count is linearly interpolated within the bucket containing le in the same way as histogram_quantile does.
+// The lower bound for the first bucket is 0 if its upper bound is positive.
+func getCumulativeCount(buckets []histogramRebucketBucket, le float64) float64 {
+	n := sort.Search(len(buckets), func(i int) bool {
+		return buckets[i].upperBound > le
+	})
+	lowerBound, lowerCount := 0.0, 0.0
+	if n > 0 {
+		lowerBound, lowerCount = buckets[n-1].upperBound, buckets[n-1].total
+	}
+	if n == len(buckets) {
+		return lowerCount
+	}
+	b := &buckets[n]
+	if math.IsInf(b.upperBound, 1) || math.IsInf(lowerBound, -1) || le <= lowerBound || b.upperBound <= lowerBound {
+		return lowerCount
+	}
+	return lowerCount + (b.total-lowerCount)*(le-lowerBound)/(b.upperBound-lowerBound)
+}
+
+// addRangeIncrease adds the given increase for the (lowerBound...upperBound] bucket to the output buckets.
+//
+// The increase is linearly interpolated for the output bucket, which upper bound is inside the bucket.
+func (shared *histogramRebucketAggrValueShared) addRangeIncrease(upperBounds []float64, lowerBound, upperBound, increase float64) {
+	shared.hasBuckets = true
+	for i := sort.SearchFloat64s(upperBounds, lowerBound); i < len(upperBounds); i++ {
+		le := upperBounds[i]
+		switch {
+		case le >= upperBound:
+			shared.counts[i] += increase
+		case le > lowerBound && !math.IsInf(upperBound, 1) && !math.IsInf(lowerBound, -1):
+			shared.counts[i] += increase * (le - lowerBound) / (upperBound - lowerBound)
+		}
+	}
+}
+
+func (av *histogramRebucketAggrValue) state() any {
+	return av.shared
+}
+
+func newHistogramRebucketAggrConfig(upperBounds []float64, useInputKey bool, ignoreFirstSampleIntervalSecs uint64) aggrConfig {
+	upperBounds = append([]float64{}, upperBounds...)
+	sort.Float64s(upperBounds)
+	upperBounds = removeDuplicateFloats(upperBounds)
+	if len(upperBounds) == 0 || !math.IsInf(upperBounds[len(upperBounds)-1], 1) {
+		upperBounds = append(upperBounds, math.Inf(1))
+	}
+	leValues := make([]string, len(upperBounds))
+	for i, upperBound := range upperBounds {
+		leValues[i] = strconv.FormatFloat(upperBound, 'g', -1, 64)
+	}
+	return &histogramRebucketAggrConfig{
+		upperBounds:               upperBounds,
+		leValues:                  leValues,
+		useInputKey:               useInputKey,
+		ignoreFirstSampleDeadline: fasttime.UnixTimestamp() + ignoreFirstSampleIntervalSecs,
+	}
+}
+
+func removeDuplicateFloats(a []float64) []float64 {
+	if len(a) < 2 {
+		return a
+	}
+	dst := a[:1]
+	for _, v := range a[1:] {
+		if v != dst[len(dst)-1] {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+type histogramRebucketAggrConfig struct {
+	// upperBounds contains sorted upper bounds for the output buckets. The last bound is always +Inf.
+	upperBounds []float64
+
+	// leValues contains `le` label values for upperBounds
+	leValues []string
+
+	// useInputKey is set if only input labels are passed to pushSample.
+	// Otherwise the passed key contains both output and input labels.
+	useInputKey bool
+
+	// The first sample per each new series is ignored until this unix timestamp deadline in seconds.
+	// See totalAggrConfig.ignoreFirstSampleDeadline for details.
+	ignoreFirstSampleDeadline uint64
+}
+
+func (ac *histogramRebucketAggrConfig) getValue(s any) aggrValue {
+	var shared *histogramRebucketAggrValueShared
+	if s == nil {
+		shared = &histogramRebucketAggrValueShared{
+			lastValues:  make(map[string]*histogramRebucketLastValue),
+			groupCounts: make(map[string][]float64),
+			counts:      make([]float64, len(ac.upperBounds)),
+		}
+	} else {
+		shared = s.(*histogramRebucketAggrValueShared)
+	}
+	return &histogramRebucketAggrValue{
+		increases: make(map[string]float64),
+		shared:    shared,
+	}
+}
@@ -0,0 +1,121 @@
+package streamaggr
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGetCumulativeCount(t *testing.T) {
+	f := func(buckets []histogramRebucketBucket, le, countExpected float64) {
+		t.Helper()
+
+		count := getCumulativeCount(buckets, le)
+		if math.Abs(count-countExpected) > 1e-9 {
+			t.Fatalf("unexpected count for le=%v; got %v; want %v", le, count, countExpected)
+		}
+	}
+
+	buckets := []histogramRebucketBucket{
+		{upperBound: 0.1, total: 2},
+		{upperBound: 1, total: 8},
+		{upperBound: math.Inf(1), total: 10},
+	}
+
+	// le matches bucket upper bounds
+	f(buckets, 0.1, 2)
+	f(buckets, 1, 8)
+	f(buckets, math.Inf(1), 10)
+
+	// le inside the first bucket is interpolated from zero
+	f(buckets, 0.05, 1)
+
+	// le inside the bucket is interpolated
+	f(buckets, 0.55, 5)
+
+	// le inside +Inf bucket
+	f(buckets, 5, 8)
+
+	// le below zero
+	f(buckets, -1, 0)
+
+	// missing +Inf bucket
+	f(buckets[:2], math.Inf(1), 8)
+}
+
+func TestHistogramRebucketAddGroupTotals(t *testing.T) {
+	upperBounds := []float64{0.1, 1, math.Inf(1)}
+	shared := &histogramRebucketAggrValueShared{
+		groupCounts: make(map[string][]float64),
+		counts:      make([]float64, len(upperBounds)),
+	}
+	f := func(buckets []histogramRebucketBucket, countsExpected []float64) {
+		t.Helper()
+
+		shared.groupCounts["foo"] = shared.addGroupTotals(upperBounds, buckets)
+		if !reflect.DeepEqual(shared.counts, countsExpected) {
+			t.Fatalf("unexpected counts; got %v; want %v", shared.counts, countsExpected)
+		}
+	}
+
+	f([]histogramRebucketBucket{
+		{groupKey: "foo", upperBound: 0.1, total: 1},
+		{groupKey: "foo", upperBound: 1, total: 3},
+		{groupKey: "foo", upperBound: math.Inf(1), total: 4},
+	}, []float64{1, 3, 4})
+
+	// the sample for +Inf bucket is received after the flush, so the bucket keeps its last total.
+	// It cannot be smaller than the total for the preceding bucket.
+	f([]histogramRebucketBucket{
+		{groupKey: "foo", upperBound: 0.1, total: 3},
+		{groupKey: "foo", upperBound: 1, total: 5},
+		{groupKey: "foo", upperBound: math.Inf(1), total: 4},
+	}, []float64{3, 5, 5})
+
+	// the sample for +Inf bucket is received
+	f([]histogramRebucketBucket{
+		{groupKey: "foo", upperBound: 0.1, total: 3},
+		{groupKey: "foo", upperBound: 1, total: 5},
+		{groupKey: "foo", upperBound: math.Inf(1), total: 6},
+	}, []float64{3, 5, 6})
+
+	// the sample for 0.1 bucket is received after the flush, so the counts do not decrease
+	f([]histogramRebucketBucket{
+		{groupKey: "foo", upperBound: 0.1, total: 3},
+		{groupKey: "foo", upperBound: 1, total: 7},
+		{groupKey: "foo", upperBound: math.Inf(1), total: 8},
+	}, []float64{3, 7, 8})
+	f([]histogramRebucketBucket{
+		{groupKey: "foo", upperBound: 0.1, total: 5},
+		{groupKey: "foo", upperBound: 1, total: 7},
+		{groupKey: "foo", upperBound: math.Inf(1), total: 8},
+	}, []float64{5, 7, 8})
+}
+
+func TestHistogramRebucketAddRangeIncrease(t *testing.T) {
+	f := func(lowerBound, upperBound, increase float64, countsExpected []float64) {
+		t.Helper()
+
+		upperBounds := []float64{0.5, 1, math.Inf(1)}
+		shared := &histogramRebucketAggrValueShared{
+			counts: make([]float64, len(upperBounds)),
+		}
+		shared.addRangeIncrease(upperBounds, lowerBound, upperBound, increase)
+		if !reflect.DeepEqual(shared.counts, countsExpected) {
+			t.Fatalf("unexpected counts for (%v...%v]; got %v; want %v", lowerBound, upperBound, shared.counts, countsExpected)
+		}
+	}
+
+	// the range is inside the output bucket
+	f(0.1, 0.2, 4, []float64{4, 4, 4})
+	f(0.5, 1, 4, []float64{0, 4, 4})
+
+	// the range contains the output bucket upper bound
+	f(0.25, 0.75, 4, []float64{2, 4, 4})
+
+	// the range is above the finite output buckets
+	f(2, 3, 4, []float64{0, 0, 4})
+
+	// the range with infinite upper bound
+	f(0.25, math.Inf(1), 4, []float64{0, 0, 4})
+}
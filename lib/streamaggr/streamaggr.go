@@ -36,6 +36,8 @@ var supportedOutputs = []string{
 	"count_samples",
 	"count_series",
 	"histogram_bucket",
+	"histogram_merge",
+	"histogram_rebucket(le1, ..., leN)",
 	"increase",
 	"increase_prometheus",
 	"last",
@@ -289,7 +291,19 @@ func loadFromData(data []byte, filePath string, pushFunc PushFunc, opts *Options
 	if err := yaml.UnmarshalStrict(data, &cfgs); err != nil {
 		return nil, fmt.Errorf("cannot parse stream aggregation config: %w", err)
 	}
+	return loadFromConfigs(cfgs, filePath, pushFunc, opts, alias)
+}
+
+// LoadFromConfigs loads aggregators from cfgs.
+//
+// filePath is used for identifying the returned Aggregators in logs and metrics.
+//
+// opts can contain additional options. If opts is nil, then default options are used.
+func LoadFromConfigs(cfgs []*Config, filePath string, pushFunc PushFunc, opts *Options, alias string) (*Aggregators, error) {
+	return loadFromConfigs(cfgs, filePath, pushFunc, opts, alias)
+}
 
+func loadFromConfigs(cfgs []*Config, filePath string, pushFunc PushFunc, opts *Options, alias string) (*Aggregators, error) {
 	ms := metrics.NewSet()
 	as := make([]*aggregator, len(cfgs))
 	for i, cfg := range cfgs {
@@ -538,10 +552,26 @@ func newAggregator(cfg *Config, path string, pushFunc PushFunc, ms *metrics.Set,
 	if len(by) > 0 && len(without) > 0 {
 		return nil, fmt.Errorf("`by: %s` and `without: %s` lists cannot be set simultaneously; see https://docs.victoriametrics.com/victoriametrics/stream-aggregation/", by, without)
 	}
+
+	// initialize suffix to add to metric names after aggregation
+	suffix := ":" + cfg.Interval
+	if labels := removeUnderscoreName(by); len(labels) > 0 {
+		suffix += fmt.Sprintf("_by_%s", strings.Join(labels, "_"))
+	}
+	if labels := removeUnderscoreName(without); len(labels) > 0 {
+		suffix += fmt.Sprintf("_without_%s", strings.Join(labels, "_"))
+	}
+	suffix += "_"
+
 	aggregateOnlyByTime := (len(by) == 0 && len(without) == 0)
 	if !aggregateOnlyByTime && len(without) == 0 {
 		by = addMissingUnderscoreName(by)
 	}
+	by, without, err = adjustHistogramBucketLabels(cfg.Outputs, by, without)
+	if err != nil {
+		return nil, err
+	}
+	aggregateOnlyByTime = (len(by) == 0 && len(without) == 0)
 
 	// check cfg.KeepMetricNames
 	keepMetricNames := opts.KeepMetricNames
@@ -557,7 +587,8 @@ func newAggregator(cfg *Config, path string, pushFunc PushFunc, ms *metrics.Set,
 			return nil, fmt.Errorf("`outputs` list must contain only a single entry if `keep_metric_names` is set; got %q; "+
 				"see https://docs.victoriametrics.com/victoriametrics/stream-aggregation/#output-metric-names", cfg.Outputs)
 		}
-		if cfg.Outputs[0] == "histogram_bucket" || strings.HasPrefix(cfg.Outputs[0], "quantiles(") && strings.Contains(cfg.Outputs[0], ",") {
+		if cfg.Outputs[0] == "histogram_bucket" || strings.HasPrefix(cfg.Outputs[0], "histogram_rebucket(") ||
+			strings.HasPrefix(cfg.Outputs[0], "quantiles(") && strings.Contains(cfg.Outputs[0], ",") {
 			return nil, fmt.Errorf("`keep_metric_names` cannot be applied to `outputs: %q`, since they can generate multiple time series; "+
 				"see https://docs.victoriametrics.com/victoriametrics/stream-aggregation/#output-metric-names", cfg.Outputs)
 		}
@@ -601,7 +632,7 @@ func newAggregator(cfg *Config, path string, pushFunc PushFunc, ms *metrics.Set,
 	}
 	outputsSeen := make(map[string]struct{}, len(cfg.Outputs))
 	for i, output := range cfg.Outputs {
-		ac, err := newOutputConfig(output, outputsSeen, useSharedState, ignoreFirstSampleInterval)
+		ac, err := newOutputConfig(output, outputsSeen, useSharedState, useInputKey, ignoreFirstSampleInterval)
 		if err != nil {
 			return nil, err
 		}
@@ -614,16 +645,6 @@ func newAggregator(cfg *Config, path string, pushFunc PushFunc, ms *metrics.Set,
 	metricLabels := fmt.Sprintf(`outputs=%q,name=%q,path=%q,url=%q,position="%d"`, strings.Join(outputsLabels, ","), name, path, alias, aggrID)
 	aggrOutputs.outputSamples = ms.NewCounter(fmt.Sprintf(`vm_streamaggr_output_samples_total{%s}`, metricLabels))
 
-	// initialize suffix to add to metric names after aggregation
-	suffix := ":" + cfg.Interval
-	if labels := removeUnderscoreName(by); len(labels) > 0 {
-		suffix += fmt.Sprintf("_by_%s", strings.Join(labels, "_"))
-	}
-	if labels := removeUnderscoreName(without); len(labels) > 0 {
-		suffix += fmt.Sprintf("_without_%s", strings.Join(labels, "_"))
-	}
-	suffix += "_"
-
 	// initialize the aggregator
 	a := &aggregator{
 		match: cfg.Match,
@@ -713,7 +734,7 @@ func newAggregator(cfg *Config, path string, pushFunc PushFunc, ms *metrics.Set,
 	return a, nil
 }
 
-func newOutputConfig(output string, outputsSeen map[string]struct{}, useSharedState bool, ignoreFirstSampleInterval time.Duration) (aggrConfig, error) {
+func newOutputConfig(output string, outputsSeen map[string]struct{}, useSharedState, useInputKey bool, ignoreFirstSampleInterval time.Duration) (aggrConfig, error) {
 	// check for duplicated output
 	if _, ok := outputsSeen[output]; ok {
 		return nil, fmt.Errorf("`outputs` list contains duplicate aggregation function: %s", output)
@@ -748,6 +769,33 @@ func newOutputConfig(output string, outputsSeen map[string]struct{}, useSharedSt
 		return newQuantilesAggrConfig(phis), nil
 	}
 	ignoreFirstSampleIntervalSecs := uint64(ignoreFirstSampleInterval.Seconds())
+	if strings.HasPrefix(output, "histogram_rebucket(") {
+		if !strings.HasSuffix(output, ")") {
+			return nil, fmt.Errorf("missing closing brace for `histogram_rebucket()` output")
+		}
+		argsStr := output[len("histogram_rebucket(") : len(output)-1]
+		if len(argsStr) == 0 {
+			return nil, fmt.Errorf("`histogram_rebucket()` must contain at least one le")
+		}
+		args := strings.Split(argsStr, ",")
+		upperBounds := make([]float64, len(args))
+		for i, arg := range args {
+			arg = strings.TrimSpace(arg)
+			le, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse le=%q for histogram_rebucket(%s): %w", arg, argsStr, err)
+			}
+			if math.IsNaN(le) {
+				return nil, fmt.Errorf("le inside histogram_rebucket(%s) cannot be NaN", argsStr)
+			}
+			upperBounds[i] = le
+		}
+		if _, ok := outputsSeen["histogram_rebucket"]; ok {
+			return nil, fmt.Errorf("`outputs` list contains duplicated `histogram_rebucket()` function, please combine multiple le* like `histogram_rebucket(0.1, 1)`")
+		}
+		outputsSeen["histogram_rebucket"] = struct{}{}
+		return newHistogramRebucketAggrConfig(upperBounds, useInputKey, ignoreFirstSampleIntervalSecs), nil
+	}
 
 	switch output {
 	case "avg":
@@ -758,6 +806,8 @@ func newOutputConfig(output string, outputsSeen map[string]struct{}, useSharedSt
 		return newCountSeriesAggrConfig(), nil
 	case "histogram_bucket":
 		return newHistogramBucketAggrConfig(useSharedState), nil
+	case "histogram_merge":
+		return newHistogramMergeAggrConfig(ignoreFirstSampleIntervalSecs), nil
 	case "increase":
 		return newTotalAggrConfig(ignoreFirstSampleIntervalSecs, true, true), nil
 	case "increase_prometheus":
@@ -1112,6 +1162,52 @@ func putPushCtx(ctx *pushCtx) {
 
 var pushCtxPool sync.Pool
 
+// histogramBucketLabels contains names of labels for histogram buckets.
+var histogramBucketLabels = []string{"le", "vmrange"}
+
+// adjustHistogramBucketLabels adjusts by and without lists for histogram_merge and histogram_rebucket outputs.
+//
+// histogram_merge requires histogram bucket labels to be present in output labels,
+// while histogram_rebucket requires them to be present in input labels, since it generates its own buckets.
+func adjustHistogramBucketLabels(outputs, by, without []string) ([]string, []string, error) {
+	var output string
+	for _, o := range outputs {
+		if o == "histogram_merge" || strings.HasPrefix(o, "histogram_rebucket(") {
+			output = o
+			break
+		}
+	}
+	if output == "" {
+		return by, without, nil
+	}
+	if len(outputs) != 1 {
+		return nil, nil, fmt.Errorf("`outputs: %q` cannot be combined with other outputs in the same config, since it changes grouping by %q labels; "+
+			"see https://docs.victoriametrics.com/victoriametrics/stream-aggregation/configuration/#aggregation-outputs", output, histogramBucketLabels)
+	}
+	keepBucketLabels := output == "histogram_merge"
+	switch {
+	case len(without) > 0:
+		without = slices.DeleteFunc(slices.Clone(without), func(label string) bool {
+			return slices.Contains(histogramBucketLabels, label)
+		})
+		if !keepBucketLabels {
+			without = sortAndRemoveDuplicates(append(without, histogramBucketLabels...))
+		}
+	case len(by) > 0:
+		by = slices.DeleteFunc(slices.Clone(by), func(label string) bool {
+			return slices.Contains(histogramBucketLabels, label)
+		})
+		if keepBucketLabels {
+			by = sortAndRemoveDuplicates(append(by, histogramBucketLabels...))
+		}
+	default:
+		if !keepBucketLabels {
+			without = histogramBucketLabels
+		}
+	}
+	return by, without, nil
+}
+
 func getInputOutputLabels(dstInput, dstOutput, labels []prompb.Label, by, without []string) ([]prompb.Label, []prompb.Label) {
 	if len(without) > 0 {
 		for _, label := range labels {
@@ -596,6 +596,98 @@ cpu_usage:1m_without_cpu_histogram_bucket{vmrange="8.799e+01...1.000e+02"} 1
   outputs: [histogram_bucket]
 `, "1111111")
 
+	// histogram_merge output
+	f([]string{`
+http_duration_seconds_bucket{pod="a",le="0.1"} 1
+http_duration_seconds_bucket{pod="a",le="1"} 3
+http_duration_seconds_bucket{pod="a",le="+Inf"} 4
+http_duration_seconds_count{pod="a"} 4
+http_duration_seconds_bucket{pod="b",le="0.1"} 2
+http_duration_seconds_bucket{pod="b",le="1"} 2
+http_duration_seconds_bucket{pod="b",le="+Inf"} 5
+http_duration_seconds_count{pod="b"} 5
+http_duration_seconds_bucket{pod="a",le="0.1"} 2
+http_duration_seconds_bucket{pod="a",le="1"} 5
+http_duration_seconds_bucket{pod="a",le="+Inf"} 6
+http_duration_seconds_count{pod="a"} 6
+http_duration_seconds_bucket{pod="b",le="0.1"} 1
+http_duration_seconds_bucket{pod="b",le="1"} 1
+http_duration_seconds_bucket{pod="b",le="+Inf"} 1
+http_duration_seconds_count{pod="b"} 1
+`}, time.Minute, `http_duration_seconds_bucket:1m_without_pod_histogram_merge{le="+Inf"} 12
+http_duration_seconds_bucket:1m_without_pod_histogram_merge{le="0.1"} 5
+http_duration_seconds_bucket:1m_without_pod_histogram_merge{le="1"} 8
+http_duration_seconds_count:1m_without_pod_histogram_merge 12
+`, `
+- interval: 1m
+  without: [pod]
+  outputs: [histogram_merge]
+  ignore_first_sample_interval: 0s
+`, "1111111111111111")
+
+	// histogram_merge output with by
+	f([]string{`
+foo{pod="a",job="x",vmrange="1.000e+00...1.136e+00"} 1
+foo{pod="b",job="x",vmrange="1.000e+00...1.136e+00"} 2
+foo{pod="b",job="x",vmrange="1.136e+00...1.292e+00"} 3
+`}, time.Minute, `foo:1m_by_job_histogram_merge{job="x",vmrange="1.000e+00...1.136e+00"} 3
+foo:1m_by_job_histogram_merge{job="x",vmrange="1.136e+00...1.292e+00"} 3
+`, `
+- interval: 1m
+  by: [job]
+  outputs: [histogram_merge]
+  ignore_first_sample_interval: 0s
+`, "111")
+
+	// histogram_rebucket output
+	f([]string{`
+http_duration_seconds_bucket{pod="a",le="0.1"} 1
+http_duration_seconds_bucket{pod="a",le="0.5"} 2
+http_duration_seconds_bucket{pod="a",le="1"} 3
+http_duration_seconds_bucket{pod="a",le="+Inf"} 4
+http_duration_seconds_count{pod="a"} 4
+http_duration_seconds_bucket{pod="b",le="0.25"} 2
+http_duration_seconds_bucket{pod="b",le="1.0"} 2
+http_duration_seconds_bucket{pod="b",le="+Inf"} 5
+http_duration_seconds_count{pod="b"} 5
+http_duration_seconds_bucket{pod="c",vmrange="4.642e-01...5.275e-01"} 3
+http_duration_seconds_bucket{pod="c",vmrange="8.799e+00...1.000e+01"} 1
+http_duration_seconds_bucket{pod="a",le="0.1"} 2
+http_duration_seconds_bucket{pod="a",le="0.5"} 2
+http_duration_seconds_bucket{pod="a",le="1"} 5
+http_duration_seconds_bucket{pod="a",le="+Inf"} 6
+http_duration_seconds_count{pod="a"} 6
+http_duration_seconds_bucket{pod="b",le="0.25"} 1
+http_duration_seconds_bucket{pod="b",le="1.0"} 1
+http_duration_seconds_bucket{pod="b",le="+Inf"} 1
+http_duration_seconds_count{pod="b"} 1
+http_duration_seconds_bucket{pod="c",vmrange="4.642e-01...5.275e-01"} 4
+http_duration_seconds_bucket{pod="c",vmrange="8.799e+00...1.000e+01"} 1
+`}, time.Minute, `http_duration_seconds_bucket:1m_by_job_histogram_rebucket{le="+Inf"} 17
+http_duration_seconds_bucket:1m_by_job_histogram_rebucket{le="0.5"} 7.262243285939969
+http_duration_seconds_bucket:1m_by_job_histogram_rebucket{le="1"} 12
+http_duration_seconds_count:1m_by_job_histogram_rebucket 12
+`, `
+- interval: 1m
+  by: [job]
+  outputs: ["histogram_rebucket(0.5, 1)"]
+  ignore_first_sample_interval: 0s
+`, "1111111111111111111111")
+
+	// histogram_rebucket output with dedup_interval
+	f([]string{`
+foo_bucket{pod="a",le="0.1"} 1
+foo_bucket{pod="a",le="1"} 3
+foo_bucket{pod="a",le="+Inf"} 4
+`, ``, ``}, 30*time.Second, `foo_bucket:1m_histogram_rebucket{le="+Inf",pod="a"} 4
+foo_bucket:1m_histogram_rebucket{le="0.5",pod="a"} 1.8888888888888888
+`, `
+- interval: 1m
+  dedup_interval: 30s
+  outputs: ["histogram_rebucket(0.5)"]
+  ignore_first_sample_interval: 0s
+`, "111")
+
 	// quantiles output
 	f([]string{`
 cpu_usage{cpu="1"} 12.5
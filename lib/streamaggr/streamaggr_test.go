@@ -123,6 +123,11 @@ func TestAggregatorsFailure(t *testing.T) {
   keep_metric_names: true
   outputs: ["histogram_bucket"]
 `)
+	f(`
+- interval: 1m
+  keep_metric_names: true
+  outputs: ["histogram_rebucket(0.5)"]
+`)
 
 	// Invalid input_relabel_configs
 	f(`
@@ -185,6 +190,38 @@ func TestAggregatorsFailure(t *testing.T) {
 - interval: 1m
   outputs: [total, total]
 `)
+	// Invalid histogram_rebucket()
+	f(`
+- interval: 1m
+  outputs: ["histogram_rebucket("]
+`)
+	f(`
+- interval: 1m
+  outputs: ["histogram_rebucket()"]
+`)
+	f(`
+- interval: 1m
+  outputs: ["histogram_rebucket(foo)"]
+`)
+	f(`
+- interval: 1m
+  outputs: ["histogram_rebucket(NaN)"]
+`)
+	f(`
+- interval: 1m
+  outputs: ["histogram_rebucket(0.5)", "histogram_rebucket(1)"]
+`)
+
+	// histogram_merge and histogram_rebucket cannot be combined with other outputs
+	f(`
+- interval: 1m
+  outputs: [histogram_merge, total]
+`)
+	f(`
+- interval: 1m
+  outputs: [total, "histogram_rebucket(0.5)"]
+`)
+
 	// "quantiles(0.5)", "quantiles(0.9)" should be set as "quantiles(0.5, 0.9)"
 	f(`
 - interval: 1m
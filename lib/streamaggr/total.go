@@ -86,6 +86,9 @@ func newTotalAggrConfig(ignoreFirstSampleIntervalSecs uint64, resetTotalOnFlush,
 type totalAggrConfig struct {
 	resetTotalOnFlush bool
 
+	// suffix overrides the default output suffix if set.
+	suffix string
+
 	// Whether to take into account the first sample in new time series when calculating the output value.
 	keepFirstSample bool
 
@@ -110,6 +113,9 @@ func (*totalAggrConfig) getValue(s any) aggrValue {
 }
 
 func (ac *totalAggrConfig) getSuffix() string {
+	if ac.suffix != "" {
+		return ac.suffix
+	}
 	if ac.resetTotalOnFlush {
 		if ac.keepFirstSample {
 			return "increase"
@@ -0,0 +1,481 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+)
+
+var (
+	otlpEndpoint = flag.String("tracing.otlpEndpoint", "", "Optional OpenTelemetry collector endpoint for exporting spans for incoming HTTP requests and query traces "+
+		"in OTLP protobuf format over HTTP, e.g. http://otel-collector:4318/v1/traces . Traces aren't exported by default. "+
+		"See https://docs.victoriametrics.com/victoriametrics/single-server-victoriametrics/#exporting-traces-to-opentelemetry")
+	sampleRate = flag.Float64("tracing.sampleRate", 0, "The share of incoming HTTP requests in the range [0..1] to export to -tracing.otlpEndpoint . "+
+		"Requests with W3C traceparent header without the sampled flag aren't exported, while requests with trace=1 query arg are always exported. "+
+		"See also -tracing.trustParentSampled")
+	trustParentSampled = flag.Bool("tracing.trustParentSampled", false, "Whether to export all the incoming HTTP requests with the sampled flag in W3C traceparent header "+
+		"to -tracing.otlpEndpoint . By default such requests are exported according to -tracing.sampleRate , since any client can set the sampled flag. "+
+		"Enable this flag only if the traceparent header is set by trusted clients")
+	serviceName = flag.String("tracing.serviceName", "", "The service.name resource attribute for spans exported to -tracing.otlpEndpoint . "+
+		"By default the name of the executable is used")
+	otlpHeaders = flagutil.NewArrayString("tracing.otlpHeader", "Optional HTTP request header to send to -tracing.otlpEndpoint . "+
+		"For example, -tracing.otlpHeader='Authorization: Bearer foobar' adds 'Authorization: Bearer foobar' header to every request to -tracing.otlpEndpoint")
+	flushInterval = flag.Duration("tracing.flushInterval", time.Second, "Interval for sending the collected spans to -tracing.otlpEndpoint")
+)
+
+func init() {
+	// The -tracing.otlpHeader flag can contain auth creds, so it mustn't be visible when exposing the flags.
+	flagutil.RegisterSecretFlag("tracing.otlpHeader")
+}
+
+// maxPendingSpans is the maximum number of spans, which may wait for sending to -tracing.otlpEndpoint.
+//
+// Newly added spans are dropped if the number of pending spans exceeds this limit.
+const maxPendingSpans = 10000
+
+// maxSpanNameLen is the maximum length of the name for spans created from query traces.
+const maxSpanNameLen = 128
+
+// Init starts exporting spans to -tracing.otlpEndpoint if it is set.
+//
+// Init must be called after logger.Init and before starting the http server. Stop must be called when spans are no longer exported.
+func Init() {
+	if *otlpEndpoint == "" {
+		return
+	}
+	u, err := url.Parse(*otlpEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		logger.Fatalf("invalid -tracing.otlpEndpoint=%q; it must be an url with http or https scheme", *otlpEndpoint)
+	}
+	headers, err := parseHeaders(*otlpHeaders)
+	if err != nil {
+		logger.Fatalf("cannot parse -tracing.otlpHeader: %s", err)
+	}
+	if *flushInterval <= 0 {
+		logger.Fatalf("-tracing.flushInterval must be positive; got %s", *flushInterval)
+	}
+	requestHeaders = headers
+	httpClient = &http.Client{
+		Transport: httputil.NewTransport(false, "vm_tracing"),
+		Timeout:   10 * time.Second,
+	}
+	exporterStopCh = make(chan struct{})
+	exporterWG.Add(1)
+	go func() {
+		defer exporterWG.Done()
+		t := time.NewTicker(*flushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-exporterStopCh:
+				return
+			case <-t.C:
+				Flush()
+			}
+		}
+	}()
+	enabled.Store(true)
+}
+
+// Stop stops exporting spans and sends the remaining spans to -tracing.otlpEndpoint.
+//
+// Stop must be called after the http server is stopped, so the spans for all the processed requests are exported.
+func Stop() {
+	if !enabled.Load() {
+		return
+	}
+	enabled.Store(false)
+	close(exporterStopCh)
+	exporterWG.Wait()
+	Flush()
+}
+
+// Enabled returns true if spans are exported to -tracing.otlpEndpoint.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// parseHeaders parses headers in the form `Name: value`.
+func parseHeaders(headers []string) (http.Header, error) {
+	hs := make(http.Header, len(headers))
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("missing ':' in header %q", h)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("missing header name in %q", h)
+		}
+		hs.Set(name, strings.TrimSpace(value))
+	}
+	return hs, nil
+}
+
+// Span represents a server span for the incoming HTTP request.
+//
+// Span methods must be called from the goroutine, which handles the request.
+type Span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID []byte
+
+	name       string
+	startTime  time.Time
+	attributes []*pb.KeyValue
+
+	queryTraces []*querytracer.Tracer
+}
+
+// StartRequestSpan starts a server span for the given r.
+//
+// nil is returned if -tracing.otlpEndpoint isn't set or if r isn't sampled.
+// It is safe calling Span methods on nil span.
+//
+// Span.End must be called when the request is processed.
+func StartRequestSpan(r *http.Request) *Span {
+	if !Enabled() {
+		return nil
+	}
+	s := &Span{
+		name:      r.Method + " " + r.URL.Path,
+		startTime: time.Now(),
+	}
+	traceID, parentSpanID, parentSampled, hasParent := parseTraceparent(r.Header.Get("traceparent"))
+	if hasParent && !parentSampled {
+		return nil
+	}
+	// The sampled flag from traceparent header is set by the client, so it is trusted only if -tracing.trustParentSampled is set.
+	// Otherwise the request is sampled according to -tracing.sampleRate, since query tracing may be expensive.
+	if !hasParent || !*trustParentSampled {
+		// Do not use httputil.GetBool here, since it may read the request body.
+		if !isTrueString(r.URL.Query().Get("trace")) && rand.Float64() >= *sampleRate {
+			return nil
+		}
+	}
+	if hasParent {
+		s.traceID = traceID
+		s.parentSpanID = parentSpanID[:]
+	} else {
+		putRandomBytes(s.traceID[:])
+	}
+	putRandomBytes(s.spanID[:])
+	s.SetAttribute("http.request.method", r.Method)
+	s.SetAttribute("url.path", r.URL.Path)
+	return s
+}
+
+func isTrueString(s string) bool {
+	switch strings.ToLower(s) {
+	case "", "0", "f", "false", "no":
+		return false
+	default:
+		return true
+	}
+}
+
+func putRandomBytes(dst []byte) {
+	for i := range dst {
+		dst[i] = byte(rand.Uint32())
+	}
+}
+
+// parseTraceparent parses W3C traceparent header value.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+func parseTraceparent(s string) (traceID [16]byte, parentSpanID [8]byte, sampled, ok bool) {
+	// The traceparent has the following format: version-traceID-parentSpanID-flags
+	a := strings.Split(strings.TrimSpace(s), "-")
+	if len(a) < 4 {
+		return traceID, parentSpanID, false, false
+	}
+	version := a[0]
+	if len(version) != 2 || version == "ff" {
+		return traceID, parentSpanID, false, false
+	}
+	if version == "00" && len(a) != 4 {
+		return traceID, parentSpanID, false, false
+	}
+	if !decodeHexID(traceID[:], a[1]) || !decodeHexID(parentSpanID[:], a[2]) {
+		return traceID, parentSpanID, false, false
+	}
+	var flags [1]byte
+	if len(a[3]) != 2 {
+		return traceID, parentSpanID, false, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(a[3])); err != nil {
+		return traceID, parentSpanID, false, false
+	}
+	return traceID, parentSpanID, flags[0]&1 != 0, true
+}
+
+// decodeHexID decodes lowercase hex-encoded non-zero id from s to dst.
+func decodeHexID(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return false
+	}
+	for _, b := range dst {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceID returns hex-encoded trace id for s.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetAttribute sets the given attribute with the given value for s.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.attributes = append(s.attributes, newStringKeyValue(key, value))
+}
+
+// AddQueryTrace adds the given qt to s.
+//
+// qt spans are exported as children of s when s.End is called, so qt must be finished before this.
+func (s *Span) AddQueryTrace(qt *querytracer.Tracer) {
+	if s == nil || !qt.Enabled() {
+		return
+	}
+	s.queryTraces = append(s.queryTraces, qt)
+}
+
+// End finishes s and schedules it for sending to -tracing.otlpEndpoint.
+//
+// statusCode must contain the response status code for the request.
+func (s *Span) End(statusCode int) {
+	if s == nil {
+		return
+	}
+	endTime := time.Now()
+	s.attributes = append(s.attributes, newIntKeyValue("http.response.status_code", int64(statusCode)))
+	ps := &pb.Span{
+		TraceID:           s.traceID[:],
+		SpanID:            s.spanID[:],
+		ParentSpanID:      s.parentSpanID,
+		Name:              s.name,
+		Kind:              pb.SpanKindServer,
+		StartTimeUnixNano: uint64(s.startTime.UnixNano()),
+		EndTimeUnixNano:   uint64(endTime.UnixNano()),
+		Attributes:        s.attributes,
+	}
+	if statusCode >= 500 {
+		ps.Status = pb.Status{
+			Code:    pb.StatusCodeError,
+			Message: http.StatusText(statusCode),
+		}
+	}
+	spans := []*pb.Span{ps}
+	for _, qt := range s.queryTraces {
+		spans = appendQuerySpans(spans, s.traceID[:], s.spanID[:], qt.ToSpanData())
+	}
+	addPendingSpans(spans)
+}
+
+func appendQuerySpans(dst []*pb.Span, traceID, parentSpanID []byte, sd *querytracer.SpanData) []*pb.Span {
+	if sd == nil {
+		return dst
+	}
+	spanID := make([]byte, 8)
+	putRandomBytes(spanID)
+	name, _, _ := strings.Cut(sd.Message, "\n")
+	if len(name) > maxSpanNameLen {
+		name = name[:maxSpanNameLen] + "..."
+	}
+	var attributes []*pb.KeyValue
+	if name != sd.Message {
+		attributes = append(attributes, newStringKeyValue("vm.trace.message", sd.Message))
+	}
+	dst = append(dst, &pb.Span{
+		TraceID:           traceID,
+		SpanID:            spanID,
+		ParentSpanID:      parentSpanID,
+		Name:              name,
+		Kind:              pb.SpanKindInternal,
+		StartTimeUnixNano: uint64(sd.StartTime.UnixNano()),
+		EndTimeUnixNano:   uint64(sd.EndTime.UnixNano()),
+		Attributes:        attributes,
+	})
+	for _, child := range sd.Children {
+		dst = appendQuerySpans(dst, traceID, spanID, child)
+	}
+	return dst
+}
+
+func newStringKeyValue(key, value string) *pb.KeyValue {
+	return &pb.KeyValue{
+		Key: key,
+		Value: &pb.AnyValue{
+			StringValue: &value,
+		},
+	}
+}
+
+func newIntKeyValue(key string, value int64) *pb.KeyValue {
+	return &pb.KeyValue{
+		Key: key,
+		Value: &pb.AnyValue{
+			IntValue: &value,
+		},
+	}
+}
+
+type spanContextKey struct{}
+
+// NewContext returns a copy of ctx with the given s.
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// FromContext returns the span stored in ctx via NewContext.
+//
+// nil is returned if ctx has no span.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+var (
+	pendingSpansLock sync.Mutex
+	pendingSpans     []*pb.Span
+
+	// exportLock serializes requests to -tracing.otlpEndpoint
+	exportLock sync.Mutex
+
+	enabled        atomic.Bool
+	exporterStopCh chan struct{}
+	exporterWG     sync.WaitGroup
+
+	httpClient     *http.Client
+	requestHeaders http.Header
+)
+
+func addPendingSpans(spans []*pb.Span) {
+	pendingSpansLock.Lock()
+	n := maxPendingSpans - len(pendingSpans)
+	if n < len(spans) {
+		droppedSpans.Add(len(spans) - max(n, 0))
+		spans = spans[:max(n, 0)]
+	}
+	pendingSpans = append(pendingSpans, spans...)
+	pendingSpansLock.Unlock()
+}
+
+// Flush sends all the pending spans to -tracing.otlpEndpoint.
+func Flush() {
+	pendingSpansLock.Lock()
+	spans := pendingSpans
+	pendingSpans = nil
+	pendingSpansLock.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	exportLock.Lock()
+	defer exportLock.Unlock()
+	if err := exportSpans(spans); err != nil {
+		exportErrors.Inc()
+		droppedSpans.Add(len(spans))
+		logger.Errorf("cannot export %d spans to -tracing.otlpEndpoint=%q: %s", len(spans), *otlpEndpoint, err)
+		return
+	}
+	exportedSpans.Add(len(spans))
+}
+
+func exportSpans(spans []*pb.Span) error {
+	req := &pb.ExportTraceServiceRequest{
+		ResourceSpans: []*pb.ResourceSpans{
+			{
+				Resource: pb.Resource{
+					Attributes: getResourceAttributes(),
+				},
+				ScopeSpans: []*pb.ScopeSpans{
+					{
+						Scope: pb.InstrumentationScope{
+							Name:    "github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing",
+							Version: buildinfo.Version,
+						},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+	data := req.MarshalProtobuf(nil)
+
+	r, err := http.NewRequest(http.MethodPost, *otlpEndpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for name, values := range requestHeaders {
+		r.Header[name] = values
+	}
+	resp, err := httpClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status code: %d; want 2xx; response body: %q", resp.StatusCode, body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func getResourceAttributes() []*pb.KeyValue {
+	name := *serviceName
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	attrs := []*pb.KeyValue{
+		newStringKeyValue("service.name", name),
+	}
+	if buildinfo.Version != "" {
+		attrs = append(attrs, newStringKeyValue("service.version", buildinfo.Version))
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs = append(attrs, newStringKeyValue("host.name", hostname))
+	}
+	return attrs
+}
+
+var (
+	exportedSpans = metrics.NewCounter(`vm_tracing_exported_spans_total`)
+	droppedSpans  = metrics.NewCounter(`vm_tracing_dropped_spans_total`)
+	exportErrors  = metrics.NewCounter(`vm_tracing_export_errors_total`)
+)
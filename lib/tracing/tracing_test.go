@@ -0,0 +1,258 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/opentelemetry/pb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+)
+
+func TestParseTraceparentSuccess(t *testing.T) {
+	f := func(s, traceIDExpected, parentSpanIDExpected string, sampledExpected bool) {
+		t.Helper()
+
+		traceID, parentSpanID, sampled, ok := parseTraceparent(s)
+		if !ok {
+			t.Fatalf("cannot parse traceparent %q", s)
+		}
+		if id := hex.EncodeToString(traceID[:]); id != traceIDExpected {
+			t.Fatalf("unexpected traceID; got %s; want %s", id, traceIDExpected)
+		}
+		if id := hex.EncodeToString(parentSpanID[:]); id != parentSpanIDExpected {
+			t.Fatalf("unexpected parentSpanID; got %s; want %s", id, parentSpanIDExpected)
+		}
+		if sampled != sampledExpected {
+			t.Fatalf("unexpected sampled; got %v; want %v", sampled, sampledExpected)
+		}
+	}
+
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false)
+	f(" 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03 ", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+
+	// future versions may contain additional fields
+	f("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foobar", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+}
+
+func TestParseTraceparentFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		_, _, _, ok := parseTraceparent(s)
+		if ok {
+			t.Fatalf("expecting failure when parsing traceparent %q", s)
+		}
+	}
+
+	f("")
+	f("foobar")
+
+	// invalid version
+	f("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	f("0-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// extra fields for version 00
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foobar")
+
+	// invalid trace id
+	f("00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01")
+	f("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+	f("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+
+	// invalid parent span id
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01")
+
+	// invalid flags
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz")
+}
+
+func TestExportSpans(t *testing.T) {
+	reqCh := make(chan *pb.ExportTraceServiceRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("unexpected Content-Type; got %q; want %q", ct, "application/x-protobuf")
+		}
+		if h := r.Header.Get("Authorization"); h != "Bearer foobar" {
+			t.Errorf("unexpected Authorization header; got %q; want %q", h, "Bearer foobar")
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request body: %s", err)
+		}
+		var req pb.ExportTraceServiceRequest
+		if err := req.UnmarshalProtobuf(data); err != nil {
+			t.Errorf("cannot unmarshal request: %s", err)
+		}
+		reqCh <- &req
+	}))
+	defer srv.Close()
+
+	origEndpoint, origHeaders, origServiceName := *otlpEndpoint, *otlpHeaders, *serviceName
+	*otlpEndpoint = srv.URL
+	*otlpHeaders = []string{"Authorization: Bearer foobar"}
+	*serviceName = "test-service"
+	defer func() {
+		*otlpEndpoint, *otlpHeaders, *serviceName = origEndpoint, origHeaders, origServiceName
+	}()
+	Init()
+	defer Stop()
+
+	// The request isn't sampled
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if span := StartRequestSpan(r); span != nil {
+		t.Fatalf("expecting nil span for the request, which isn't sampled")
+	}
+
+	// The sampled flag in traceparent isn't trusted by default
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if span := StartRequestSpan(r); span != nil {
+		t.Fatalf("expecting nil span for the request with untrusted sampled flag")
+	}
+
+	// The request is sampled via traceparent
+	origTrustParentSampled := *trustParentSampled
+	*trustParentSampled = true
+	defer func() {
+		*trustParentSampled = origTrustParentSampled
+	}()
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := StartRequestSpan(r)
+	if span == nil {
+		t.Fatalf("expecting non-nil span for the sampled request")
+	}
+	if FromContext(NewContext(r.Context(), span)) != span {
+		t.Fatalf("unexpected span in the context")
+	}
+	qt := querytracer.NewForExport("query")
+	qt.Printf("foo")
+	qt.Done()
+	span.AddQueryTrace(qt)
+	span.End(http.StatusServiceUnavailable)
+	Flush()
+
+	req := <-reqCh
+	if len(req.ResourceSpans) != 1 {
+		t.Fatalf("unexpected number of ResourceSpans; got %d; want 1", len(req.ResourceSpans))
+	}
+	rs := req.ResourceSpans[0]
+	if attr := rs.Resource.Attributes[0]; attr.Key != "service.name" || *attr.Value.StringValue != "test-service" {
+		t.Fatalf("unexpected first resource attribute; got %s=%s; want service.name=test-service", attr.Key, attr.Value.FormatString(true))
+	}
+	if len(rs.ScopeSpans) != 1 {
+		t.Fatalf("unexpected number of ScopeSpans; got %d; want 1", len(rs.ScopeSpans))
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("unexpected number of spans; got %d; want 3", len(spans))
+	}
+
+	serverSpan := spans[0]
+	if id := hex.EncodeToString(serverSpan.TraceID); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected traceID; got %s; want 4bf92f3577b34da6a3ce929d0e0e4736", id)
+	}
+	if id := hex.EncodeToString(serverSpan.ParentSpanID); id != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected parentSpanID; got %s; want 00f067aa0ba902b7", id)
+	}
+	if serverSpan.Name != "GET /api/v1/query" {
+		t.Fatalf("unexpected span name; got %q; want %q", serverSpan.Name, "GET /api/v1/query")
+	}
+	if serverSpan.Kind != pb.SpanKindServer {
+		t.Fatalf("unexpected span kind; got %d; want %d", serverSpan.Kind, pb.SpanKindServer)
+	}
+	if serverSpan.Status.Code != pb.StatusCodeError {
+		t.Fatalf("unexpected status code; got %d; want %d", serverSpan.Status.Code, pb.StatusCodeError)
+	}
+
+	querySpan := spans[1]
+	if string(querySpan.ParentSpanID) != string(serverSpan.SpanID) {
+		t.Fatalf("unexpected parent span for the query span; got %x; want %x", querySpan.ParentSpanID, serverSpan.SpanID)
+	}
+	if querySpan.Kind != pb.SpanKindInternal {
+		t.Fatalf("unexpected query span kind; got %d; want %d", querySpan.Kind, pb.SpanKindInternal)
+	}
+	childSpan := spans[2]
+	if childSpan.Name != "foo" {
+		t.Fatalf("unexpected child span name; got %q; want %q", childSpan.Name, "foo")
+	}
+	if string(childSpan.ParentSpanID) != string(querySpan.SpanID) {
+		t.Fatalf("unexpected parent span for the child span; got %x; want %x", childSpan.ParentSpanID, querySpan.SpanID)
+	}
+}
+
+func TestStartRequestSpanUntrustedParent(t *testing.T) {
+	origEndpoint, origSampleRate := *otlpEndpoint, *sampleRate
+	*otlpEndpoint = "http://localhost:4318/v1/traces"
+	defer func() {
+		*otlpEndpoint, *sampleRate = origEndpoint, origSampleRate
+	}()
+	Init()
+	defer Stop()
+
+	f := func(traceparent, query string, rate float64, traceIDExpected string) {
+		t.Helper()
+
+		*sampleRate = rate
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query"+query, nil)
+		r.Header.Set("traceparent", traceparent)
+		span := StartRequestSpan(r)
+		if traceID := span.TraceID(); traceID != traceIDExpected {
+			t.Fatalf("unexpected traceID; got %q; want %q", traceID, traceIDExpected)
+		}
+	}
+
+	// the sampled flag is ignored without -tracing.trustParentSampled
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", 0, "")
+
+	// the request is sampled according to -tracing.sampleRate and keeps the trace id from traceparent
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", 1, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// the request is sampled via trace query arg
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "?trace=1", 0, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// the request without the sampled flag isn't exported
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "", 1, "")
+}
+
+func TestParseHeaders(t *testing.T) {
+	f := func(headers []string, resultExpected http.Header) {
+		t.Helper()
+
+		result, err := parseHeaders(headers)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected headers; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	f(nil, http.Header{})
+	f([]string{"Authorization: Bearer foobar", " x-scope-orgid :1"}, http.Header{
+		"Authorization": {"Bearer foobar"},
+		"X-Scope-Orgid": {"1"},
+	})
+
+	fError := func(headers []string) {
+		t.Helper()
+
+		if _, err := parseHeaders(headers); err == nil {
+			t.Fatalf("expecting non-nil error for headers %q", headers)
+		}
+	}
+
+	// missing ':'
+	fError([]string{"Authorization Bearer foobar"})
+
+	// missing header name
+	fError([]string{": foobar"})
+}